@@ -0,0 +1,162 @@
+// Package claudecodetest provides utilities for testing code built on the
+// claudecode package.
+package claudecodetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// FakeClock is a claudecode.Clock whose time only moves when Advance is
+// called, so timeouts, deadlines, and heartbeats fire deterministically.
+// Pass it with claudecode.WithClock. It is safe for concurrent use.
+//
+// Example:
+//
+//	clock := claudecodetest.NewFakeClock(time.Now())
+//	client := claudecode.NewClient(
+//	    claudecode.WithClock(clock),
+//	    claudecode.WithMaxSessionDuration(time.Hour),
+//	)
+//	// ... Connect and send a query ...
+//	clock.BlockUntil(1)       // The session deadline timer is waiting
+//	clock.Advance(time.Hour)  // The deadline fires immediately
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	clock := &FakeClock{now: start}
+	clock.cond = sync.NewCond(&clock.mu)
+	return clock
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a Timer that fires once the clock is advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) shared.Timer {
+	return fakeTimer{c.addWaiter(d, 0)}
+}
+
+// NewTicker returns a Ticker that fires each time the clock passes a
+// multiple of d. Like time.Ticker, it drops ticks the reader is not ready for.
+// It panics if d is not positive.
+func (c *FakeClock) NewTicker(d time.Duration) shared.Ticker {
+	if d <= 0 {
+		panic("claudecodetest: non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.addWaiter(d, d)}
+}
+
+// Advance moves the clock forward by d, firing due timers and tickers in
+// time order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].when.Before(c.waiters[j].when)
+		})
+		if len(c.waiters) == 0 || c.waiters[0].when.After(target) {
+			break
+		}
+		next := c.waiters[0]
+		c.now = next.when
+		select {
+		case next.c <- c.now:
+		default:
+		}
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+	c.now = target
+}
+
+// BlockUntil waits until at least n timers and tickers are waiting to fire.
+// Use it before Advance when the SDK creates its timers on another goroutine.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// Waiters returns the number of timers and tickers waiting to fire.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// addWaiter registers a timer (period 0) or ticker due after d.
+func (c *FakeClock) addWaiter(d, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiter := &fakeWaiter{
+		clock:  c,
+		when:   c.now.Add(d),
+		period: period,
+		c:      make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, waiter)
+	c.cond.Broadcast()
+	return waiter
+}
+
+// removeWaiter unregisters w and reports whether it was registered.
+func (c *FakeClock) removeWaiter(w *fakeWaiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeWaiter is a FakeClock timer or ticker.
+type fakeWaiter struct {
+	clock  *FakeClock
+	when   time.Time
+	period time.Duration // Zero for timers
+	c      chan time.Time
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+type fakeTimer struct{ *fakeWaiter }
+
+func (t fakeTimer) Stop() bool {
+	return t.clock.removeWaiter(t.fakeWaiter)
+}
+
+type fakeTicker struct{ *fakeWaiter }
+
+func (t fakeTicker) Stop() {
+	t.clock.removeWaiter(t.fakeWaiter)
+}
+
+// Compile-time check that FakeClock implements the SDK's Clock.
+var _ shared.Clock = (*FakeClock)(nil)
@@ -0,0 +1,97 @@
+package claudecodetest
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeClockTimer tests timers fire only once the clock reaches them
+func TestFakeClockTimer(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Minute)
+	clock.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("Expected timer not to fire before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case fired := <-timer.C():
+		if !fired.Equal(start.Add(time.Minute)) {
+			t.Errorf("Expected fire time %v, got %v", start.Add(time.Minute), fired)
+		}
+	default:
+		t.Fatal("Expected timer to fire at its deadline")
+	}
+	if timer.Stop() {
+		t.Error("Expected Stop to return false for a fired timer")
+	}
+	if got := clock.Waiters(); got != 0 {
+		t.Errorf("Expected no waiters after the timer fired, got %d", got)
+	}
+}
+
+// TestFakeClockTimerStop tests a stopped timer never fires
+func TestFakeClockTimerStop(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	timer := clock.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Error("Expected Stop to return true for a pending timer")
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Error("Expected stopped timer not to fire")
+	default:
+	}
+}
+
+// TestFakeClockTicker tests tickers fire every period and drop unread ticks
+func TestFakeClockTicker(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewFakeClock(start)
+	ticker := clock.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(10 * time.Second)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("Expected tick at 10s, got %v", tick.Sub(start))
+	}
+
+	// Three periods pass unread; one tick is buffered, the rest are dropped
+	clock.Advance(30 * time.Second)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("Expected buffered tick at 20s, got %v", tick.Sub(start))
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Expected dropped ticks, got tick at %v", tick.Sub(start))
+	default:
+	}
+	if got := clock.Now(); !got.Equal(start.Add(40 * time.Second)) {
+		t.Errorf("Expected clock at 40s, got %v", got.Sub(start))
+	}
+}
+
+// TestFakeClockBlockUntil tests BlockUntil waits for timers created on other goroutines
+func TestFakeClockBlockUntil(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	fired := make(chan struct{})
+	go func() {
+		timer := clock.NewTimer(time.Hour)
+		<-timer.C()
+		close(fired)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for timer to fire")
+	}
+}
@@ -0,0 +1,144 @@
+package claudecodetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// Transport is the part of claudecode.Transport that RunTransportConformance
+// exercises. Every claudecode.Transport satisfies it.
+type Transport interface {
+	Connect(ctx context.Context) error
+	SendMessage(ctx context.Context, message shared.StreamMessage) error
+	ReceiveMessages(ctx context.Context) (<-chan shared.Message, <-chan error)
+	Close() error
+	GetValidator() *shared.StreamValidator
+}
+
+// rawSender matches claudecode.RawSender, which transports may implement.
+type rawSender interface {
+	SendRaw(ctx context.Context, frame []byte) error
+}
+
+// RunTransportConformance verifies the behavior every claudecode.Transport
+// must provide, such as failing sends after Close, honoring cancelled
+// contexts, and an idempotent Close. SendRaw is checked too for transports
+// that implement claudecode.RawSender. Each check runs as a subtest of t with
+// a fresh, unconnected transport from newTransport.
+//
+// Example:
+//
+//	func TestMyTransportConformance(t *testing.T) {
+//	    claudecodetest.RunTransportConformance(t, func(t *testing.T) claudecodetest.Transport {
+//	        return NewMyTransport(testAddr(t))
+//	    })
+//	}
+func RunTransportConformance(t *testing.T, newTransport func(t *testing.T) Transport) {
+	t.Helper()
+
+	t.Run("connect_provides_channels", func(t *testing.T) {
+		ctx, transport := connectConformanceTransport(t, newTransport)
+		msgChan, errChan := transport.ReceiveMessages(ctx)
+		if msgChan == nil || errChan == nil {
+			t.Error("Expected non-nil message and error channels after Connect")
+		}
+	})
+
+	t.Run("send_message", func(t *testing.T) {
+		ctx, transport := connectConformanceTransport(t, newTransport)
+		msg := shared.StreamMessage{Type: "user", Message: map[string]any{"role": "user", "content": "hi"}}
+		if err := transport.SendMessage(ctx, msg); err != nil {
+			t.Errorf("Expected SendMessage to succeed, got %v", err)
+		}
+	})
+
+	t.Run("send_raw_frame", func(t *testing.T) {
+		ctx, transport := connectConformanceTransport(t, newTransport)
+		raw := requireRawSender(t, transport)
+		frame := []byte(`{"type":"user","message":{"role":"user","content":"hi"}}` + "\n")
+		if err := raw.SendRaw(ctx, frame); err != nil {
+			t.Errorf("Expected SendRaw to succeed, got %v", err)
+		}
+	})
+
+	t.Run("send_raw_rejects_invalid_frame", func(t *testing.T) {
+		ctx, transport := connectConformanceTransport(t, newTransport)
+		raw := requireRawSender(t, transport)
+		if err := raw.SendRaw(ctx, []byte(`{"type":`)); err == nil {
+			t.Error("Expected error for malformed frame")
+		}
+	})
+
+	t.Run("send_honors_cancelled_context", func(t *testing.T) {
+		ctx, transport := connectConformanceTransport(t, newTransport)
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := transport.SendMessage(cancelledCtx, shared.StreamMessage{Type: "user"}); err == nil {
+			t.Error("Expected SendMessage error for cancelled context")
+		}
+		if raw, ok := transport.(rawSender); ok {
+			if err := raw.SendRaw(cancelledCtx, []byte(`{"type":"user"}`)); err == nil {
+				t.Error("Expected SendRaw error for cancelled context")
+			}
+		}
+	})
+
+	t.Run("close_is_idempotent", func(t *testing.T) {
+		_, transport := connectConformanceTransport(t, newTransport)
+		if err := transport.Close(); err != nil {
+			t.Errorf("Expected Close to succeed, got %v", err)
+		}
+		if err := transport.Close(); err != nil {
+			t.Errorf("Expected a second Close to succeed, got %v", err)
+		}
+	})
+
+	t.Run("send_after_close_fails", func(t *testing.T) {
+		ctx, transport := connectConformanceTransport(t, newTransport)
+		if err := transport.Close(); err != nil {
+			t.Fatalf("Expected Close to succeed, got %v", err)
+		}
+		if err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user"}); err == nil {
+			t.Error("Expected SendMessage error after Close")
+		}
+		if raw, ok := transport.(rawSender); ok {
+			if err := raw.SendRaw(ctx, []byte(`{"type":"user"}`)); err == nil {
+				t.Error("Expected SendRaw error after Close")
+			}
+		}
+	})
+
+	t.Run("validator_available", func(t *testing.T) {
+		_, transport := connectConformanceTransport(t, newTransport)
+		if transport.GetValidator() == nil {
+			t.Error("Expected non-nil stream validator")
+		}
+	})
+}
+
+// requireRawSender returns transport as a rawSender, skipping t if it is not one.
+func requireRawSender(t *testing.T, transport Transport) rawSender {
+	t.Helper()
+	raw, ok := transport.(rawSender)
+	if !ok {
+		t.Skip("transport does not implement SendRaw")
+	}
+	return raw
+}
+
+// connectConformanceTransport creates and connects a transport, registering cleanup.
+func connectConformanceTransport(t *testing.T, newTransport func(t *testing.T) Transport) (context.Context, Transport) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	transport := newTransport(t)
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { _ = transport.Close() })
+	return ctx, transport
+}
@@ -0,0 +1,94 @@
+package claudecodetest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	claudecode "github.com/severity1/claude-agent-sdk-go"
+	"github.com/severity1/claude-agent-sdk-go/claudecodetest"
+)
+
+// Every claudecode.Transport can be passed to RunTransportConformance.
+var _ claudecodetest.Transport = claudecode.Transport(nil)
+
+// TestRunTransportConformance tests the suite passes for a minimal
+// in-memory transport written the way a downstream author would, with and
+// without SendRaw
+func TestRunTransportConformance(t *testing.T) {
+	t.Run("raw_sender", func(t *testing.T) {
+		claudecodetest.RunTransportConformance(t, func(_ *testing.T) claudecodetest.Transport {
+			return &memoryTransport{}
+		})
+	})
+
+	t.Run("without_send_raw", func(t *testing.T) {
+		claudecodetest.RunTransportConformance(t, func(_ *testing.T) claudecodetest.Transport {
+			// Embedding the interface hides SendRaw
+			return struct{ claudecodetest.Transport }{&memoryTransport{}}
+		})
+	})
+}
+
+// memoryTransport accepts every frame and delivers nothing.
+type memoryTransport struct {
+	mu        sync.Mutex
+	connected bool
+	msgs      chan claudecode.Message
+	errs      chan error
+	validator *claudecode.StreamValidator
+}
+
+func (m *memoryTransport) Connect(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = true
+	m.msgs = make(chan claudecode.Message)
+	m.errs = make(chan error)
+	m.validator = claudecode.NewStreamValidator()
+	return nil
+}
+
+func (m *memoryTransport) SendMessage(ctx context.Context, message claudecode.StreamMessage) error {
+	frame, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return m.SendRaw(ctx, frame)
+}
+
+func (m *memoryTransport) SendRaw(ctx context.Context, frame []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.connected {
+		return errors.New("not connected")
+	}
+	if !json.Valid(frame) {
+		return errors.New("invalid frame")
+	}
+	return nil
+}
+
+func (m *memoryTransport) ReceiveMessages(context.Context) (<-chan claudecode.Message, <-chan error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.msgs, m.errs
+}
+
+func (m *memoryTransport) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = false
+	return nil
+}
+
+func (m *memoryTransport) GetValidator() *claudecode.StreamValidator {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.validator
+}
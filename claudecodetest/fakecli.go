@@ -0,0 +1,300 @@
+package claudecodetest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeCLIEnv names the script file of the FakeCLI a process runs as.
+const fakeCLIEnv = "CLAUDECODETEST_FAKE_CLI"
+
+// DefaultFakeCLIVersion is the version a FakeCLI reports for -v unless
+// Version is set.
+const DefaultFakeCLIVersion = "2.1.0"
+
+// FakeCLI is a scripted stand-in for the Claude Code CLI that runs as a real
+// subprocess, for integration tests that exercise the SDK's process
+// management, flags, and stream-json parsing without the real CLI. It answers
+// each prompt with the stream-json lines registered for it and accepts every
+// control request, such as the initialize handshake or an interrupt.
+//
+// The fake runs as the test binary itself, so the test package's TestMain
+// must call RunFakeCLI first. FakeCLI needs a POSIX shell; on Windows Install
+// skips the test.
+//
+// Example:
+//
+//	func TestMain(m *testing.M) {
+//	    claudecodetest.RunFakeCLI()
+//	    os.Exit(m.Run())
+//	}
+//
+//	func TestAnswer(t *testing.T) {
+//	    cli := claudecodetest.NewFakeCLI().
+//	        OnPrompt("What is 2+2?",
+//	            claudecodetest.AssistantText("4"),
+//	            claudecodetest.ResultSuccess("4"))
+//	    iter, err := claudecode.Query(ctx, "What is 2+2?",
+//	        claudecode.WithCLIPath(cli.Install(t)))
+//	    // ...
+//	}
+type FakeCLI struct {
+	// Version is reported for -v. Empty uses DefaultFakeCLIVersion.
+	Version string
+
+	responses map[string][]string
+	fallback  []string
+}
+
+// fakeCLIScript is the FakeCLI configuration read by the fake process.
+type fakeCLIScript struct {
+	Version   string              `json:"version"`
+	Responses map[string][]string `json:"responses"`
+	Fallback  []string            `json:"fallback"`
+}
+
+// NewFakeCLI returns a FakeCLI with no scripted responses.
+func NewFakeCLI() *FakeCLI {
+	return &FakeCLI{responses: make(map[string][]string)}
+}
+
+// OnPrompt makes the fake write lines, each a stream-json message, when it
+// receives exactly prompt, replacing any lines registered for it before. A
+// turn should end with a result line such as ResultSuccess.
+func (f *FakeCLI) OnPrompt(prompt string, lines ...string) *FakeCLI {
+	f.responses[prompt] = append([]string(nil), lines...)
+	return f
+}
+
+// OnAnyPrompt sets the lines written for prompts without their own response.
+// Without it, such prompts get a ResultError naming the prompt.
+func (f *FakeCLI) OnAnyPrompt(lines ...string) *FakeCLI {
+	f.fallback = append([]string(nil), lines...)
+	return f
+}
+
+// Install writes the fake's script and an executable that runs it into a
+// temporary directory removed when the test ends, and returns the
+// executable's path for claudecode.WithCLIPath. Responses registered later do
+// not affect the installed fake. Install fails the test if a registered line
+// is not a JSON object, and skips it on Windows.
+func (f *FakeCLI) Install(t testing.TB) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("FakeCLI requires a POSIX shell")
+	}
+
+	script := fakeCLIScript{Version: f.Version, Responses: f.responses, Fallback: f.fallback}
+	for prompt, lines := range f.responses {
+		validateFakeCLILines(t, fmt.Sprintf("response to %q", prompt), lines)
+	}
+	validateFakeCLILines(t, "fallback response", f.fallback)
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatalf("FakeCLI: encoding script: %v", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("FakeCLI: locating test binary: %v", err)
+	}
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "script.json")
+	if err := os.WriteFile(scriptPath, data, 0o600); err != nil {
+		t.Fatalf("FakeCLI: writing script: %v", err)
+	}
+	cliPath := filepath.Join(dir, "claude")
+	wrapper := fmt.Sprintf("#!/bin/sh\n%s=%s exec %s \"$@\"\n",
+		fakeCLIEnv, shellQuote(scriptPath), shellQuote(executable))
+	if err := os.WriteFile(cliPath, []byte(wrapper), 0o700); err != nil { // #nosec G306 - The fake CLI must be executable
+		t.Fatalf("FakeCLI: writing executable: %v", err)
+	}
+	return cliPath
+}
+
+// validateFakeCLILines fails the test if any line is not a JSON object.
+func validateFakeCLILines(t testing.TB, what string, lines []string) {
+	t.Helper()
+	for i, line := range lines {
+		var message map[string]any
+		if err := json.Unmarshal([]byte(line), &message); err != nil {
+			t.Fatalf("FakeCLI: line %d of %s is not a JSON object: %v", i+1, what, err)
+		}
+	}
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// RunFakeCLI runs this process as a FakeCLI and exits if it was started by
+// one, and returns immediately otherwise. Call it first in TestMain.
+func RunFakeCLI() {
+	scriptPath := os.Getenv(fakeCLIEnv)
+	if scriptPath == "" {
+		return
+	}
+	os.Exit(runFakeCLI(scriptPath, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// runFakeCLI acts as the CLI invoked with args: it prints the version for
+// -v, answers a --print prompt argument, or else answers user messages and
+// control requests read from stdin until it closes. Returns the exit code.
+func runFakeCLI(scriptPath string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	data, err := os.ReadFile(scriptPath) // #nosec G304 - Path comes from the fake's own wrapper
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "fake claude: %v\n", err)
+		return 1
+	}
+	var script fakeCLIScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		_, _ = fmt.Fprintf(stderr, "fake claude: %v\n", err)
+		return 1
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer func() { _ = out.Flush() }()
+	writeLines := func(lines ...string) {
+		for _, line := range lines {
+			_, _ = out.WriteString(line + "\n")
+		}
+		_ = out.Flush()
+	}
+
+	for i, arg := range args {
+		switch arg {
+		case "-v", "--version":
+			version := script.Version
+			if version == "" {
+				version = DefaultFakeCLIVersion
+			}
+			writeLines(version + " (Claude Code)")
+			return 0
+		case "--print":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				writeLines(script.respond(args[i+1])...)
+				return 0
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var message map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			continue
+		}
+		switch message["type"] {
+		case "control_request":
+			requestID, _ := message["request_id"].(string)
+			writeLines(controlSuccessLine(requestID))
+		case "user":
+			if prompt, ok := userPrompt(message); ok {
+				writeLines(script.respond(prompt)...)
+			}
+		}
+	}
+	return 0
+}
+
+// respond returns the lines to write for prompt.
+func (s *fakeCLIScript) respond(prompt string) []string {
+	if lines, ok := s.Responses[prompt]; ok {
+		return lines
+	}
+	if s.Fallback != nil {
+		return s.Fallback
+	}
+	return []string{ResultError(fmt.Sprintf("fake claude: no response scripted for prompt %q", prompt))}
+}
+
+// userPrompt returns the text of a stream-json user message: its string
+// content, or its text blocks joined. Messages carrying only tool results are
+// not prompts.
+func userPrompt(message map[string]any) (string, bool) {
+	body, _ := message["message"].(map[string]any)
+	switch content := body["content"].(type) {
+	case string:
+		return content, true
+	case []any:
+		var texts []string
+		for _, item := range content {
+			block, _ := item.(map[string]any)
+			if text, ok := block["text"].(string); ok && block["type"] == "text" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, ""), len(texts) > 0
+	}
+	return "", false
+}
+
+// controlSuccessLine returns a successful control response to requestID.
+func controlSuccessLine(requestID string) string {
+	return mustJSONLine(map[string]any{
+		"type": "control_response",
+		"response": map[string]any{
+			"subtype":    "success",
+			"request_id": requestID,
+			"response":   map[string]any{},
+		},
+	})
+}
+
+// AssistantText returns a stream-json assistant message with a single text
+// block, for FakeCLI responses.
+func AssistantText(text string) string {
+	return mustJSONLine(map[string]any{
+		"type": "assistant",
+		"message": map[string]any{
+			"role":    "assistant",
+			"model":   "claude-fake",
+			"content": []any{map[string]any{"type": "text", "text": text}},
+		},
+	})
+}
+
+// ResultSuccess returns a stream-json result message ending a turn
+// successfully with result, for FakeCLI responses.
+func ResultSuccess(result string) string {
+	return resultLine("success", false, result)
+}
+
+// ResultError returns a stream-json result message ending a turn in an error
+// described by message, for FakeCLI responses.
+func ResultError(message string) string {
+	return resultLine("error_during_execution", true, message)
+}
+
+// resultLine returns a stream-json result message.
+func resultLine(subtype string, isError bool, result string) string {
+	return mustJSONLine(map[string]any{
+		"type":            "result",
+		"subtype":         subtype,
+		"is_error":        isError,
+		"duration_ms":     1,
+		"duration_api_ms": 1,
+		"num_turns":       1,
+		"session_id":      "fake-session",
+		"total_cost_usd":  0,
+		"result":          result,
+	})
+}
+
+// mustJSONLine encodes a message built from JSON-safe values.
+func mustJSONLine(message map[string]any) string {
+	data, err := json.Marshal(message)
+	if err != nil {
+		panic(fmt.Sprintf("claudecodetest: encoding message: %v", err))
+	}
+	return string(data)
+}
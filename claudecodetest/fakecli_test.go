@@ -0,0 +1,138 @@
+package claudecodetest_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	claudecode "github.com/severity1/claude-agent-sdk-go"
+	"github.com/severity1/claude-agent-sdk-go/claudecodetest"
+)
+
+func TestMain(m *testing.M) {
+	claudecodetest.RunFakeCLI()
+	os.Exit(m.Run())
+}
+
+// collectTurn reads messages until the turn's ResultMessage.
+func collectTurn(ctx context.Context, t *testing.T, iter claudecode.MessageIterator) []claudecode.Message {
+	t.Helper()
+	var messages []claudecode.Message
+	for {
+		msg, err := iter.Next(ctx)
+		if err == claudecode.ErrNoMoreMessages {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error reading turn: %v", err)
+		}
+		messages = append(messages, msg)
+		if _, ok := msg.(*claudecode.ResultMessage); ok {
+			return messages
+		}
+	}
+}
+
+// assertAnswer checks a turn is an assistant text reply then a successful result.
+func assertAnswer(t *testing.T, messages []claudecode.Message, want string) {
+	t.Helper()
+	if len(messages) != 2 {
+		t.Fatalf("Expected assistant and result messages, got %d: %#v", len(messages), messages)
+	}
+	assistant, ok := messages[0].(*claudecode.AssistantMessage)
+	if !ok || assistant.Text() != want {
+		t.Errorf("Expected assistant text %q, got %#v", want, messages[0])
+	}
+	result, ok := messages[1].(*claudecode.ResultMessage)
+	if !ok || result.IsError || result.Result == nil || *result.Result != want {
+		t.Errorf("Expected successful result %q, got %#v", want, messages[1])
+	}
+}
+
+// TestFakeCLIQuery tests a one-shot Query runs the fake as its subprocess
+func TestFakeCLIQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cliPath := claudecodetest.NewFakeCLI().
+		OnPrompt("What is 2+2?", claudecodetest.AssistantText("4"), claudecodetest.ResultSuccess("4")).
+		Install(t)
+
+	iter, err := claudecode.Query(ctx, "What is 2+2?", claudecode.WithCLIPath(cliPath))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	defer func() { _ = iter.Close() }()
+	assertAnswer(t, collectTurn(ctx, t, iter), "4")
+}
+
+// TestFakeCLIClient tests a Client holds a multi-turn conversation with the
+// fake, including the control protocol handshake
+func TestFakeCLIClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cliPath := claudecodetest.NewFakeCLI().
+		OnPrompt("Hello", claudecodetest.AssistantText("Hi there"), claudecodetest.ResultSuccess("Hi there")).
+		OnPrompt("Bye", claudecodetest.AssistantText("Goodbye"), claudecodetest.ResultSuccess("Goodbye")).
+		Install(t)
+
+	client := claudecode.NewClient(
+		claudecode.WithCLIPath(cliPath),
+		// A permission callback makes Connect perform the initialize handshake
+		claudecode.WithCanUseTool(func(
+			context.Context, string, map[string]any, claudecode.ToolPermissionContext,
+		) (claudecode.PermissionResult, error) {
+			return claudecode.NewPermissionResultAllow(), nil
+		}),
+	)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer func() { _ = client.Disconnect() }()
+
+	for _, turn := range []struct{ prompt, answer string }{{"Hello", "Hi there"}, {"Bye", "Goodbye"}} {
+		if err := client.Query(ctx, turn.prompt); err != nil {
+			t.Fatalf("Query %q failed: %v", turn.prompt, err)
+		}
+		assertAnswer(t, collectTurn(ctx, t, client.ReceiveResponse(ctx)), turn.answer)
+	}
+}
+
+// TestFakeCLIUnscriptedPrompt tests prompts without a response get an error
+// result unless a fallback is set
+func TestFakeCLIUnscriptedPrompt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("error_result", func(t *testing.T) {
+		cliPath := claudecodetest.NewFakeCLI().Install(t)
+		iter, err := claudecode.Query(ctx, "Anything?", claudecode.WithCLIPath(cliPath))
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer func() { _ = iter.Close() }()
+
+		messages := collectTurn(ctx, t, iter)
+		result, ok := messages[len(messages)-1].(*claudecode.ResultMessage)
+		if !ok || !result.IsError || result.Result == nil {
+			t.Fatalf("Expected an error result, got %#v", messages)
+		}
+		if want := `fake claude: no response scripted for prompt "Anything?"`; *result.Result != want {
+			t.Errorf("Expected result %q, got %q", want, *result.Result)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		cliPath := claudecodetest.NewFakeCLI().
+			OnAnyPrompt(claudecodetest.AssistantText("default"), claudecodetest.ResultSuccess("default")).
+			Install(t)
+		iter, err := claudecode.Query(ctx, "Anything?", claudecode.WithCLIPath(cliPath))
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		defer func() { _ = iter.Close() }()
+		assertAnswer(t, collectTurn(ctx, t, iter), "default")
+	})
+}
@@ -2,11 +2,18 @@ package claudecode
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/severity1/claude-agent-sdk-go/internal/cli"
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 	"github.com/severity1/claude-agent-sdk-go/internal/subprocess"
 )
 
@@ -18,8 +25,16 @@ type Client interface {
 	Disconnect() error
 	Query(ctx context.Context, prompt string) error
 	QueryWithSession(ctx context.Context, prompt string, sessionID string) error
+	// QueryWithID sends a query like Query and returns a generated query ID.
+	// Every message produced by that turn carries the ID in its QueryID field
+	// (see MessageQueryID), and the ID is written to the debug writer when the
+	// query is sent and when its result arrives.
+	QueryWithID(ctx context.Context, prompt string) (string, error)
 	QueryStream(ctx context.Context, messages <-chan StreamMessage) error
 	ReceiveMessages(ctx context.Context) <-chan Message
+	// Messages returns a channel of MessageEvents that reports errors and the
+	// end of the stream explicitly instead of through a closed channel.
+	Messages(ctx context.Context) <-chan MessageEvent
 	ReceiveResponse(ctx context.Context) MessageIterator
 	Interrupt(ctx context.Context) error
 	// SetModel changes the AI model during a streaming session.
@@ -36,27 +51,91 @@ type Client interface {
 	// Requires WithFileCheckpointing() or WithEnableFileCheckpointing(true) option.
 	// Only works in streaming mode (after Connect()).
 	RewindFiles(ctx context.Context, messageUUID string) error
+	// SetAllowedTools restricts the tools approved for subsequent turns.
+	// Requires WithCanUseTool() so permission prompts reach the SDK.
+	// Pass nil to remove the restriction.
+	// Only works in streaming mode (after Connect()).
+	SetAllowedTools(ctx context.Context, tools []string) error
 	GetStreamIssues() []StreamIssue
 	GetStreamStats() StreamStats
 	GetServerInfo(ctx context.Context) (map[string]interface{}, error)
+	// WaitForReady blocks until the init system message confirms the CLI and
+	// all MCP servers are fully loaded, the stream ends, or ctx expires.
+	// The CLI sends the init message only once the first query is sent, so
+	// call it after a query. Only works in streaming mode (after Connect()).
+	WaitForReady(ctx context.Context) error
+	// ReceiveUntil reads response messages until pred returns true, returning
+	// the messages read before the match and the matching message.
+	// If the turn's ResultMessage arrives without a match, it returns the
+	// collected messages (including the result) and a nil match.
+	ReceiveUntil(ctx context.Context, pred func(Message) bool) ([]Message, Message, error)
+	// QueryTo sends a query and writes the assistant's text to w as it
+	// arrives, returning when the turn completes.
+	QueryTo(ctx context.Context, prompt string, w io.Writer) error
+	// QueryChan sends a query and returns a channel of the turn's messages,
+	// closed after its ResultMessage.
+	QueryChan(ctx context.Context, prompt string) (<-chan Message, error)
+	// ActiveSessions returns the session IDs this client has sent messages to
+	// since it connected, in order of first use.
+	ActiveSessions() []string
+	// HasSession reports whether this client has sent a message to the
+	// session since it connected.
+	HasSession(sessionID string) bool
+	// SendUserMessage sends msg as-is in the default session, keeping its
+	// content blocks, UUID, and parent tool use ID.
+	SendUserMessage(ctx context.Context, msg *UserMessage) error
+	// QueueInput sends text as additional user input while a turn is in
+	// progress. The CLI queues it behind the active turn.
+	// Only works in streaming mode (after Connect()).
+	QueueInput(ctx context.Context, text string) error
+	// Reset starts a fresh conversation over the existing connection by
+	// sending the CLI's /clear command. Later Query and QueryWithID calls
+	// also use a new session ID. The subprocess and MCP servers stay up.
+	Reset(ctx context.Context) error
+	// ClearApprovalCache forgets the tool permission decisions remembered by
+	// WithToolApprovalCache, so later requests are decided again.
+	ClearApprovalCache()
+	// DiagnosticSnapshot bundles the connection state, server info, stream
+	// statistics and issues, recent CLI stderr, and CLI version into one report.
+	DiagnosticSnapshot(ctx context.Context) (*Diagnostics, error)
+	// Stats returns cumulative counts of turns, messages, tool uses, and
+	// errors since the client last connected.
+	Stats() ClientStats
 }
 
 // ClientImpl implements the Client interface.
 type ClientImpl struct {
-	mu              sync.RWMutex
-	transport       Transport
-	customTransport Transport // For testing with WithTransport
-	options         *Options
-	connected       bool
-	msgChan         <-chan Message
-	errChan         <-chan error
+	mu               sync.RWMutex
+	sendMu           sync.Mutex // Serializes sendTurn so turns are recorded in send order
+	transport        Transport
+	customTransport  Transport // For testing with WithTransport
+	options          *Options
+	connected        bool
+	msgChan          <-chan Message
+	errChan          <-chan error
+	queryCounter     uint64
+	sessionID        string // Session used by Query; empty means defaultSessionID
+	sessions         []string
+	sessionSet       map[string]bool
+	turns            *turnQueue       // Sent turns awaiting their results
+	forwarder        *streamForwarder // Copies transport messages to msgChan through hooks
+	watcher          *connectionWatcher
+	persister        *sessionPersister
+	rateLimiter      *shared.RateLimiter // Paces queries; nil when unlimited
+	resumedSession   string              // Session resumed from the session store, or empty
+	contextFilesSent bool                // Context files were sent on this connection
+	idle             *idleMonitor        // Disconnects when idle; nil without MaxIdleTime
+	idleErr          error               // Set when disconnected for being idle
+	stats            *statsCounter       // Counts for Stats; kept after Disconnect
+	overload         *overloadRetrier    // Retries overloaded turns; nil without OverloadBackoffBase
 }
 
 // NewClient creates a new Client with the given options.
 func NewClient(opts ...Option) Client {
 	options := NewOptions(opts...)
 	client := &ClientImpl{
-		options: options,
+		options:     options,
+		rateLimiter: newQueryRateLimiter(options),
 	}
 	return client
 }
@@ -67,7 +146,25 @@ func NewClientWithTransport(transport Transport, opts ...Option) Client {
 	return &ClientImpl{
 		customTransport: transport,
 		options:         options,
+		rateLimiter:     newQueryRateLimiter(options),
+	}
+}
+
+// newQueryRateLimiter creates the limiter pacing a client's queries, or
+// returns nil if options set no rate.
+func newQueryRateLimiter(options *Options) *shared.RateLimiter {
+	if options == nil || options.QueryRateLimit <= 0 {
+		return nil
+	}
+	return shared.NewRateLimiter(options.QueryRateLimit, options.QueryRateBurst, options.Clock)
+}
+
+// clock returns the configured Clock, or the system clock.
+func (c *ClientImpl) clock() Clock {
+	if c.options == nil {
+		return shared.SystemClock()
 	}
+	return shared.ClockOrSystem(c.options.Clock)
 }
 
 // WithClient provides Go-idiomatic resource management equivalent to Python SDK's async context manager.
@@ -184,14 +281,29 @@ func (c *ClientImpl) validateOptions() error {
 		return nil // Nil options are acceptable (use defaults)
 	}
 
-	// Auto-configure PermissionPromptToolName when CanUseTool callback is set
+	// Auto-configure PermissionPromptToolName when CanUseTool callback is set,
+	// agent tool allowlists are enforced, or plan proposals or file edits are
+	// decided (all use the permission callback).
 	// This tells CLI to route permission prompts through stdio (control protocol)
 	// Matches Python SDK behavior: permission_prompt_tool_name="stdio"
-	if c.options.CanUseTool != nil && c.options.PermissionPromptToolName == nil {
+	if (c.options.CanUseTool != nil || c.options.EnforceAgentToolAllowlist || c.options.OnPlanProposal != nil ||
+		c.options.EditConfirmation != nil) && c.options.PermissionPromptToolName == nil {
 		stdio := "stdio"
 		c.options.PermissionPromptToolName = &stdio
 	}
 
+	// Validate thinking budget bounds
+	if err := shared.ValidateMaxThinkingTokens(c.options.MaxThinkingTokens); err != nil {
+		return err
+	}
+
+	// Agent tool allowlist enforcement needs agent definitions with tool lists
+	if c.options.EnforceAgentToolAllowlist {
+		if err := c.options.Validate(); err != nil {
+			return err
+		}
+	}
+
 	// Validate working directory
 	if c.options.Cwd != nil {
 		if _, err := os.Stat(*c.options.Cwd); os.IsNotExist(err) {
@@ -221,7 +333,22 @@ func (c *ClientImpl) validateOptions() error {
 }
 
 // Connect establishes a connection to the Claude Code CLI.
+// With WithWarmup, it also completes the CLI's initialize handshake before returning.
 func (c *ClientImpl) Connect(ctx context.Context, _ ...StreamMessage) error {
+	if err := c.connect(ctx); err != nil {
+		return err
+	}
+	if c.options != nil && c.options.Warmup {
+		if err := c.warmup(ctx); err != nil {
+			_ = c.Disconnect()
+			return fmt.Errorf("warmup failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// connect starts the transport and sets up the message channels.
+func (c *ClientImpl) connect(ctx context.Context) error {
 	// Check context before acquiring lock
 	if ctx.Err() != nil {
 		return ctx.Err()
@@ -240,18 +367,27 @@ func (c *ClientImpl) Connect(ctx context.Context, _ ...StreamMessage) error {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	// Resume the session saved in the session store
+	c.resumedSession = ""
+	if c.options != nil && c.options.SessionStore != nil {
+		var err error
+		if c.resumedSession, err = c.resumeFromStore(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Use custom transport if provided, otherwise create default
 	if c.customTransport != nil {
 		c.transport = c.customTransport
 	} else {
 		// Create default subprocess transport directly (like Python SDK)
-		cliPath, err := cli.FindCLI()
+		cliPath, err := findCLI(c.options)
 		if err != nil {
 			return fmt.Errorf("claude CLI not found: %w", err)
 		}
 
 		// Create subprocess transport for streaming mode (closeStdin=false)
-		c.transport = subprocess.New(cliPath, c.options, false, "sdk-go-client")
+		c.transport = subprocess.New(cliPath, c.transportOptions(), false, "sdk-go-client")
 	}
 
 	// Connect the transport
@@ -259,8 +395,44 @@ func (c *ClientImpl) Connect(ctx context.Context, _ ...StreamMessage) error {
 		return fmt.Errorf("failed to connect transport: %w", err)
 	}
 
-	// Get message channels
-	c.msgChan, c.errChan = c.transport.ReceiveMessages(ctx)
+	// Get message channels, forwarded through the client's stream hooks in order
+	forwarder := newStreamForwarder()
+	c.stats = newStatsCounter(c.clock().Now())
+	if c.options != nil && c.options.SessionStore != nil {
+		c.persister = newSessionPersister(c.options.SessionStore, c.options.SessionStoreKey, c.resumedSession)
+		forwarder.add(c.persister.hook(ctx))
+	}
+	if c.options != nil && c.options.OverloadBackoffBase > 0 {
+		c.overload = newOverloadRetrier(c.options, c.transport, forwarder.stop)
+		forwarder.add(c.overload.hook())
+	}
+	// Stats count only what the client sees, not results retried away
+	forwarder.add(c.stats.hook())
+	c.turns = &turnQueue{}
+	if c.options != nil {
+		c.turns.onStart = c.options.OnTurnStart
+		c.turns.onEnd = c.options.OnTurnEnd
+	}
+	forwarder.add(c.turns.hook())
+	if c.options != nil && c.options.MaxIdleTime > 0 {
+		idle := newIdleMonitor(c.options.Clock, c.options.MaxIdleTime, forwarder.stop, nil)
+		idle.onIdle = func() { c.disconnectIdle(idle) }
+		c.idle = idle
+		forwarder.add(idle.hook())
+		go idle.run()
+	}
+	if c.options != nil && c.options.OnDisconnect != nil {
+		c.watcher = newConnectionWatcher(c.options.OnDisconnect, c.transport)
+		forwarder.add(c.watcher.hook(ctx))
+		go c.watcher.watchContext(ctx, forwarder.finished)
+	}
+	c.forwarder = forwarder
+	c.msgChan, c.errChan = forwarder.start(c.transport.ReceiveMessages(ctx))
+
+	// Sessions live in the CLI process, so a new connection starts with none
+	c.sessions, c.sessionSet = nil, nil
+	c.contextFilesSent = false
+	c.idleErr = nil
 
 	c.connected = true
 	return nil
@@ -269,8 +441,25 @@ func (c *ClientImpl) Connect(ctx context.Context, _ ...StreamMessage) error {
 // Disconnect closes the connection to the Claude Code CLI.
 func (c *ClientImpl) Disconnect() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	forwarder := c.forwarder
+	watcher := c.watcher
+	err := c.disconnectLocked()
+	c.mu.Unlock()
+
+	// Wait outside the lock so the disconnect callback can use the client
+	if watcher != nil && err == nil && !watcher.inCallback() {
+		forwarder.wait()
+	}
+	return err
+}
 
+// disconnectLocked closes the transport and resets connection state.
+// Must be called with mutex already held.
+func (c *ClientImpl) disconnectLocked() error {
+	if c.forwarder != nil {
+		// Stopped first, so the stream closing below reads as a clean disconnect
+		c.forwarder.stopForwarding(nil)
+	}
 	if c.transport != nil && c.connected {
 		if err := c.transport.Close(); err != nil {
 			return fmt.Errorf("failed to close transport: %w", err)
@@ -280,24 +469,119 @@ func (c *ClientImpl) Disconnect() error {
 	c.transport = nil
 	c.msgChan = nil
 	c.errChan = nil
+	c.forwarder = nil
+	c.watcher = nil
+	c.persister = nil
+	c.idle = nil
+	c.overload = nil
+	if c.turns != nil {
+		c.turns.removeAll()
+	}
+	c.turns = nil
 	return nil
 }
 
+// connectionWatcher calls the disconnect callback once when the connection ends.
+type connectionWatcher struct {
+	onDisconnect func(reason error)
+	transport    Transport
+
+	mu        sync.Mutex
+	notifying bool // The callback is running
+	notified  bool // The callback has been called
+}
+
+// newConnectionWatcher creates a watcher for a connected transport.
+func newConnectionWatcher(onDisconnect func(reason error), transport Transport) *connectionWatcher {
+	return &connectionWatcher{
+		onDisconnect: onDisconnect,
+		transport:    transport,
+	}
+}
+
+// hook returns the stream hook reporting why the connection ended once
+// forwarding ends: the reason given by the client if it stopped forwarding,
+// or else what ended the stream.
+func (w *connectionWatcher) hook(ctx context.Context) streamHook {
+	var lastErr error
+	return streamHook{
+		error: func(err error) { lastErr = err },
+		end: func(stopped bool, reason error) {
+			if !stopped {
+				reason = w.endReason(ctx, lastErr)
+			}
+			w.notify(reason)
+		},
+	}
+}
+
+// watchContext reports the end of ctx as the disconnect reason, unless
+// forwarding finishes first.
+func (w *connectionWatcher) watchContext(ctx context.Context, finished <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+		w.notify(ctx.Err())
+	case <-finished:
+	}
+}
+
+// endReason explains a stream that ended without Disconnect.
+func (w *connectionWatcher) endReason(ctx context.Context, lastErr error) error {
+	switch {
+	case lastErr != nil:
+		return lastErr
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.Is(endOfStreamError(w.transport), ErrUnexpectedEOF):
+		return ErrUnexpectedEOF
+	}
+	return NewConnectionError("CLI closed the connection", nil)
+}
+
+// notify calls the disconnect callback the first time it is called. Later
+// calls return at once, even while the callback is still running.
+func (w *connectionWatcher) notify(reason error) {
+	w.mu.Lock()
+	if w.notified {
+		w.mu.Unlock()
+		return
+	}
+	w.notified, w.notifying = true, true
+	w.mu.Unlock()
+
+	shared.SafeCallback(func() { w.onDisconnect(reason) })
+
+	w.mu.Lock()
+	w.notifying = false
+	w.mu.Unlock()
+}
+
+// inCallback reports whether the disconnect callback is running. Disconnect
+// does not wait for forwarding to end then, since the callback may be the
+// caller and forwarding ends only after it returns.
+func (w *connectionWatcher) inCallback() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.notifying
+}
+
 // Query sends a simple text query using the default session.
-// This is equivalent to QueryWithSession(ctx, prompt, "default").
+// This is equivalent to QueryWithSession(ctx, prompt, "default") until Reset
+// switches the default session.
 //
 // Example:
 //
 //	client.Query(ctx, "What is Go?")
 func (c *ClientImpl) Query(ctx context.Context, prompt string) error {
-	return c.queryWithSession(ctx, prompt, defaultSessionID)
+	return c.queryWithSession(ctx, prompt, c.currentSessionID(), "")
 }
 
 // QueryWithSession sends a simple text query using the specified session ID.
 // Each session maintains its own conversation context, allowing for isolated
 // conversations within the same client connection.
 //
-// If sessionID is empty, it defaults to "default".
+// If sessionID is empty, the default session is used ("default" unless Reset
+// has started a new one).
 //
 // Example:
 //
@@ -307,17 +591,239 @@ func (c *ClientImpl) Query(ctx context.Context, prompt string) error {
 func (c *ClientImpl) QueryWithSession(ctx context.Context, prompt string, sessionID string) error {
 	// Use default session if empty session ID provided
 	if sessionID == "" {
-		sessionID = defaultSessionID
+		sessionID = c.currentSessionID()
+	}
+	return c.queryWithSession(ctx, prompt, sessionID, "")
+}
+
+// QueryWithID sends a simple text query in the default session and returns
+// a generated ID for it. Messages produced by the query's turn carry the ID,
+// which makes responses easy to correlate in logs when many queries share
+// one client:
+//
+//	id, _ := client.QueryWithID(ctx, "Summarize the README")
+//	for msg := range client.ReceiveMessages(ctx) {
+//	    log.Printf("[%s] %T", claudecode.MessageQueryID(msg), msg)
+//	}
+//
+// Query IDs are matched to turns in send order, so send every query whose
+// messages should be correlated with QueryWithID.
+func (c *ClientImpl) QueryWithID(ctx context.Context, prompt string) (string, error) {
+	queryID := c.generateQueryID()
+	if err := c.queryWithSession(ctx, prompt, c.currentSessionID(), queryID); err != nil {
+		return "", err
+	}
+	return queryID, nil
+}
+
+// generateQueryID creates a unique query ID.
+// Format: query_{counter}_{random_hex}
+func (c *ClientImpl) generateQueryID() string {
+	c.mu.Lock()
+	c.queryCounter++
+	counter := c.queryCounter
+	c.mu.Unlock()
+
+	randomBytes := make([]byte, 4)
+	_, _ = rand.Read(randomBytes)
+
+	return fmt.Sprintf("query_%d_%x", counter, randomBytes)
+}
+
+// clearCommand is the CLI slash command that starts a new conversation,
+// discarding the history of the current one.
+const clearCommand = "/clear"
+
+// Reset starts a fresh conversation without reconnecting. It sends the CLI's
+// /clear command, which discards the conversation history, and waits for it
+// to complete. It also switches the client's default session to a newly
+// generated session ID for later Query, QueryWithID, and QueryWithSession
+// calls with an empty session ID. The CLI subprocess and MCP servers stay
+// running. With WithSessionStore, the store is updated to the session the
+// CLI reports for the cleared conversation; if the CLI keeps the old session
+// ID, the stored ID is deleted so a later Connect does not resume it.
+//
+// Call Reset between turns: it reads the client's messages until the clear
+// command's ResultMessage, so messages of a turn still in progress are lost.
+// The clear command is not reported to the turn callbacks.
+//
+// Example:
+//
+//	client.Query(ctx, "Refactor the parser")
+//	// ... consume the response ...
+//	client.Reset(ctx)
+//	client.Query(ctx, "Write release notes") // No memory of the refactor
+func (c *ClientImpl) Reset(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	randomBytes := make([]byte, 8)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	c.mu.RLock()
+	persister := c.persister
+	c.mu.RUnlock()
+	var before string
+	if persister != nil {
+		before = persister.current()
+	}
+
+	result, err := c.runInternalTurn(ctx, clearCommand, c.currentSessionID())
+	if err != nil {
+		return fmt.Errorf("failed to clear the conversation: %w", err)
+	}
+	if err := resultMessageError(result); err != nil {
+		return fmt.Errorf("failed to clear the conversation: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.transport == nil {
+		return c.notConnectedErrorLocked()
+	}
+
+	// The persister saved the session the CLI reported for the cleared
+	// conversation. If the CLI kept the old session ID, a later Connect must
+	// not resume it.
+	if persister != nil && (result.SessionID == "" || result.SessionID == before) {
+		if err := persister.discard(ctx, before); err != nil {
+			return err
+		}
+	}
+
+	c.sessionID = fmt.Sprintf("session_%x", randomBytes)
+	c.contextFilesSent = false
+	return nil
+}
+
+// runInternalTurn sends prompt in sessionID as a turn of the SDK's own and
+// reads the client's messages up to its ResultMessage, which it returns.
+// The turn is not reported to the turn callbacks. Call it between turns.
+func (c *ClientImpl) runInternalTurn(ctx context.Context, prompt, sessionID string) (*ResultMessage, error) {
+	c.mu.RLock()
+	connected := c.connected
+	transport := c.transport
+	msgChan := c.msgChan
+	errChan := c.errChan
+	c.mu.RUnlock()
+	if !connected || transport == nil || msgChan == nil {
+		return nil, c.notConnectedError()
+	}
+	c.markActive()
+
+	streamMsg := StreamMessage{
+		Type: "user",
+		Message: map[string]interface{}{
+			"role":    "user",
+			"content": prompt,
+		},
+		SessionID: sessionID,
+	}
+	if err := c.sendTurn(ctx, transport, streamMsg, false, queuedTurn{internal: true}); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case msg, ok := <-msgChan:
+			if !ok {
+				return nil, fmt.Errorf("stream ended before the turn completed")
+			}
+			if result, ok := msg.(*ResultMessage); ok {
+				return result, nil
+			}
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ClearApprovalCache forgets the tool permission decisions remembered by
+// WithToolApprovalCache, so the next request for each tool and input is
+// decided by the permission callback again. It does nothing without
+// WithToolApprovalCache and may be called whether or not the client is
+// connected.
+func (c *ClientImpl) ClearApprovalCache() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.options != nil && c.options.ToolApprovalCache != nil {
+		c.options.ToolApprovalCache.Clear()
+	}
+}
+
+// ActiveSessions returns the session IDs this client has sent messages to
+// since it connected, in order of first use. Sessions used through Query,
+// QueryWithSession, QueryWithID, and QueryStream are included.
+//
+// Example:
+//
+//	client.QueryWithSession(ctx, "Remember: x = 5", "math")
+//	client.Query(ctx, "Hello")
+//	client.ActiveSessions() // ["math", "default"]
+func (c *ClientImpl) ActiveSessions() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.sessions...)
+}
+
+// HasSession reports whether this client has sent a message to sessionID
+// since it connected. An empty sessionID refers to the default session.
+func (c *ClientImpl) HasSession(sessionID string) bool {
+	if sessionID == "" {
+		sessionID = c.currentSessionID()
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sessionSet[sessionID]
+}
+
+// trackSession records that a message was sent to sessionID.
+func (c *ClientImpl) trackSession(sessionID string) {
+	if sessionID == "" {
+		return
 	}
-	return c.queryWithSession(ctx, prompt, sessionID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessionSet[sessionID] {
+		return
+	}
+	if c.sessionSet == nil {
+		c.sessionSet = make(map[string]bool)
+	}
+	c.sessionSet[sessionID] = true
+	c.sessions = append(c.sessions, sessionID)
+}
+
+// currentSessionID returns the session used by queries without an explicit session.
+func (c *ClientImpl) currentSessionID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.sessionID == "" {
+		return defaultSessionID
+	}
+	return c.sessionID
 }
 
 // queryWithSession is the internal implementation for sending queries with session management.
-func (c *ClientImpl) queryWithSession(ctx context.Context, prompt string, sessionID string) error {
+// A non-empty queryID is attached to the messages of the query's turn.
+func (c *ClientImpl) queryWithSession(ctx context.Context, prompt, sessionID, queryID string) error {
 	// Check context before proceeding
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	if err := validatePrompt(c.options, prompt); err != nil {
+		return err
+	}
 
 	// Check connection status with read lock
 	c.mu.RLock()
@@ -326,14 +832,34 @@ func (c *ClientImpl) queryWithSession(ctx context.Context, prompt string, sessio
 	c.mu.RUnlock()
 
 	if !connected || transport == nil {
-		return fmt.Errorf("client not connected")
+		return c.notConnectedError()
 	}
+	c.markActive()
 
 	// Check context again after acquiring connection info
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
 
+	// Wait for the query's turn under the rate limit
+	if c.rateLimiter != nil {
+		if err := c.rateLimiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Only the first query of a conversation carries the context files
+	c.mu.Lock()
+	withContextFiles := !c.contextFilesSent
+	c.contextFilesSent = true
+	c.mu.Unlock()
+
+	prompt, promptFile, err := preparePrompt(c.options, prompt, withContextFiles)
+	if err != nil {
+		c.unclaimContextFiles(withContextFiles)
+		return err
+	}
+
 	// Create user message in Python SDK compatible format
 	streamMsg := StreamMessage{
 		Type: "user",
@@ -343,10 +869,238 @@ func (c *ClientImpl) queryWithSession(ctx context.Context, prompt string, sessio
 		},
 		ParentToolUseID: nil,
 		SessionID:       sessionID,
+		QueryID:         queryID,
 	}
 
 	// Send message via transport (without holding mutex to avoid blocking other operations)
-	return transport.SendMessage(ctx, streamMsg)
+	if err := c.sendTurn(ctx, transport, streamMsg, true, queuedTurn{promptFile: promptFile, prompt: &prompt}); err != nil {
+		removePromptFile(promptFile)
+		c.unclaimContextFiles(withContextFiles)
+		return err
+	}
+	c.trackSession(sessionID)
+	return nil
+}
+
+// unclaimContextFiles lets the next query carry the context files after a
+// query that claimed them failed to send.
+func (c *ClientImpl) unclaimContextFiles(claimed bool) {
+	if !claimed {
+		return
+	}
+	c.mu.Lock()
+	c.contextFilesSent = false
+	c.mu.Unlock()
+}
+
+// sendTurn sends msg through transport, recording its turn first so that
+// a result read before SendMessage returns finds the turn queued. The
+// record is undone if the send fails; otherwise the turn is reported to
+// the turn start callback. Sends are serialized so turns are recorded in
+// the order the CLI receives them.
+func (c *ClientImpl) sendTurn(ctx context.Context, transport Transport, msg StreamMessage, retry bool, turn queuedTurn) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	record := c.recordTurn(msg, retry, turn)
+	if err := transport.SendMessage(ctx, msg); err != nil {
+		c.unrecordTurn(record)
+		return err
+	}
+	if record.turn == nil {
+		// Not queued, so no result will remove the prompt file
+		removePromptFile(turn.promptFile)
+		return nil
+	}
+	record.turns.start(record.turn)
+	return nil
+}
+
+// turnRecord is what recordTurn queued for a turn, so that unrecordTurn can
+// take it back. Fields are nil for hooks the turn was not recorded with.
+type turnRecord struct {
+	overload *overloadRetrier
+	prompt   *pendingPrompt
+	idle     *idleMonitor
+	turns    *turnQueue
+	turn     *queuedTurn
+}
+
+// recordTurn tells the client's hooks msg is about to be sent, if it starts
+// a turn: the overload retrier queues it, resending it only if retry is
+// set, the idle monitor pauses until its result, and turn is queued until
+// then.
+func (c *ClientImpl) recordTurn(msg StreamMessage, retry bool, turn queuedTurn) turnRecord {
+	var record turnRecord
+	if !msg.StartsTurn() {
+		return record
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overload != nil {
+		record.overload = c.overload
+		if retry {
+			record.prompt = c.overload.record(&msg)
+		} else {
+			record.prompt = c.overload.record(nil)
+		}
+	}
+	if c.idle != nil {
+		record.idle = c.idle
+		c.idle.startTurn()
+	}
+	if c.turns != nil {
+		record.turns = c.turns
+		record.turn = c.turns.push(turn)
+	}
+	return record
+}
+
+// unrecordTurn undoes recordTurn after the turn's message failed to send.
+func (c *ClientImpl) unrecordTurn(record turnRecord) {
+	if record.overload != nil {
+		record.overload.remove(record.prompt)
+	}
+	if record.idle != nil {
+		record.idle.endTurn()
+	}
+	if record.turns != nil {
+		record.turns.remove(record.turn)
+	}
+}
+
+// SendUserMessage sends a fully formed user message in the default session.
+// The message content (a string or []ContentBlock) is serialized as given,
+// with each block's type taken from BlockType, so callers can send mixed
+// text and tool_result blocks. UUID and ParentToolUseID are sent along.
+// The request interceptor is not applied.
+//
+// Example:
+//
+//	client.SendUserMessage(ctx, &claudecode.UserMessage{Content: []claudecode.ContentBlock{
+//	    &claudecode.ToolResultBlock{ToolUseID: "toolu_01", Content: "42"},
+//	    &claudecode.TextBlock{Text: "Use this result."},
+//	}})
+func (c *ClientImpl) SendUserMessage(ctx context.Context, msg *UserMessage) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if msg == nil {
+		return fmt.Errorf("user message is required")
+	}
+
+	c.mu.RLock()
+	connected := c.connected
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if !connected || transport == nil {
+		return c.notConnectedError()
+	}
+	c.markActive()
+
+	content, err := userMessageWireContent(msg.Content)
+	if err != nil {
+		return err
+	}
+
+	sessionID := c.currentSessionID()
+	streamMsg := StreamMessage{
+		Type: "user",
+		Message: map[string]interface{}{
+			"role":    "user",
+			"content": content,
+		},
+		ParentToolUseID: msg.ParentToolUseID,
+		SessionID:       sessionID,
+	}
+	if msg.UUID != nil {
+		streamMsg.UUID = *msg.UUID
+	}
+
+	if err := c.sendTurn(ctx, transport, streamMsg, false, queuedTurn{}); err != nil {
+		return err
+	}
+	c.trackSession(sessionID)
+	return nil
+}
+
+// QueueInput sends text as an additional user message in the default session
+// while a turn is in progress, without waiting for the turn to finish. The CLI
+// queues it behind the active turn and answers it with a ResultMessage of its
+// own, so it is tracked like a Query turn: it opens a turn span and takes its
+// place in the query ID queue, without a query ID.
+// The request interceptor and large prompt handling are not applied.
+//
+// Example:
+//
+//	client.Query(ctx, "Refactor the parser")
+//	// ... while the turn is running ...
+//	client.QueueInput(ctx, "Keep the public API unchanged")
+func (c *ClientImpl) QueueInput(ctx context.Context, text string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if text == "" {
+		return fmt.Errorf("input text is required")
+	}
+
+	c.mu.RLock()
+	connected := c.connected
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if !connected || transport == nil {
+		return c.notConnectedError()
+	}
+	c.markActive()
+
+	streamMsg := StreamMessage{
+		Type: "user",
+		Message: map[string]interface{}{
+			"role":    "user",
+			"content": text,
+		},
+		SessionID: c.currentSessionID(),
+	}
+	if err := c.sendTurn(ctx, transport, streamMsg, false, queuedTurn{}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// userMessageWireContent converts user message content to its stream-json form.
+// Content blocks get their type from BlockType, and tool use blocks use "id"
+// for their ID as the CLI expects. Other content is passed through unchanged.
+func userMessageWireContent(content interface{}) (interface{}, error) {
+	switch c := content.(type) {
+	case nil:
+		return nil, fmt.Errorf("user message content is required")
+	case []ContentBlock:
+		wire := make([]map[string]interface{}, 0, len(c))
+		for i, block := range c {
+			if block == nil {
+				return nil, fmt.Errorf("user message content block %d is nil", i)
+			}
+			data, err := json.Marshal(block)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal content block %d: %w", i, err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				return nil, fmt.Errorf("failed to marshal content block %d: %w", i, err)
+			}
+			fields["type"] = block.BlockType()
+			switch block.(type) {
+			case *ToolUseBlock, *ServerToolUseBlock:
+				fields["id"] = fields["tool_use_id"]
+				delete(fields, "tool_use_id")
+			}
+			wire = append(wire, fields)
+		}
+		return wire, nil
+	default:
+		return content, nil
+	}
 }
 
 // QueryStream sends a stream of messages.
@@ -358,7 +1112,7 @@ func (c *ClientImpl) QueryStream(ctx context.Context, messages <-chan StreamMess
 	c.mu.RUnlock()
 
 	if !connected || transport == nil {
-		return fmt.Errorf("client not connected")
+		return c.notConnectedError()
 	}
 
 	// Send messages from channel in a goroutine
@@ -369,10 +1123,12 @@ func (c *ClientImpl) QueryStream(ctx context.Context, messages <-chan StreamMess
 				if !ok {
 					return // Channel closed
 				}
-				if err := transport.SendMessage(ctx, msg); err != nil {
+				c.markActive()
+				if err := c.sendTurn(ctx, transport, msg, false, queuedTurn{}); err != nil {
 					// Log error but continue processing
 					return
 				}
+				c.trackSession(msg.SessionID)
 			case <-ctx.Done():
 				return
 			}
@@ -401,6 +1157,127 @@ func (c *ClientImpl) ReceiveMessages(_ context.Context) <-chan Message {
 	return msgChan
 }
 
+// MessageEvent is an event delivered by Client.Messages: a message, a
+// non-fatal stream error, or the end of the stream.
+type MessageEvent struct {
+	// Message is the received message, or nil for error events. It is nil
+	// for done events, except one sent because ctx ended while this message
+	// was being delivered.
+	Message Message
+	// Err is a stream error. On the done event it is nil when the stream
+	// ended normally, ErrUnexpectedEOF when it ended mid-turn, the
+	// context's error when ctx ended, or why the stream could not be read.
+	Err error
+	// Done marks the last event; the channel is closed after it.
+	Done bool
+}
+
+// Messages returns a channel of every incoming message like ReceiveMessages,
+// but with errors and the end of the stream as explicit events: messages
+// and stream errors are delivered in order, then exactly one event with
+// Done set, after which the channel is closed. The done event is sent when
+// the stream ends or ctx ends; once ctx ends, the channel is closed even if
+// the reader has fallen behind and the done event could not be buffered. No
+// message is taken from the stream once ctx has ended, and a message that
+// was already taken is carried by the done event. If the client is not
+// connected, the only event is a done event with an error.
+//
+// Messages reads the same stream as ReceiveMessages and ReceiveResponse, so
+// use only one of them at a time. Reading continues until the stream or ctx
+// ends: cancel ctx when done with the channel, such as after a turn's
+// ResultMessage, so the next reader sees the following messages.
+//
+// Example:
+//
+//	for event := range client.Messages(ctx) {
+//	    switch {
+//	    case event.Done:
+//	        return event.Err
+//	    case event.Err != nil:
+//	        log.Printf("stream error: %v", event.Err)
+//	    default:
+//	        handle(event.Message)
+//	    }
+//	}
+func (c *ClientImpl) Messages(ctx context.Context) <-chan MessageEvent {
+	c.mu.RLock()
+	connected := c.connected
+	msgChan := c.msgChan
+	errChan := c.errChan
+	transport := c.transport
+	c.mu.RUnlock()
+
+	events := make(chan MessageEvent, 1)
+	if !connected || msgChan == nil {
+		events <- MessageEvent{Err: c.notConnectedError(), Done: true}
+		close(events)
+		return events
+	}
+
+	go func() {
+		defer close(events)
+		// Once ctx ends, the done event is only sent if the buffer has room.
+		// held is a message received but not yet delivered, carried by the
+		// done event so it is not lost to a reader that reads until Done.
+		done := func(err error, held Message) {
+			event := MessageEvent{Message: held, Err: err, Done: true}
+			select {
+			case events <- event:
+				return
+			default:
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+		send := func(event MessageEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				done(ctx.Err(), event.Message)
+				return false
+			}
+		}
+
+		for {
+			// Check ctx first so no message is taken from the stream after it ends
+			if ctx.Err() != nil {
+				done(ctx.Err(), nil)
+				return
+			}
+			select {
+			case msg, ok := <-msgChan:
+				if !ok {
+					err := endOfStreamError(transport)
+					if errors.Is(err, ErrNoMoreMessages) {
+						err = nil
+					}
+					done(err, nil)
+					return
+				}
+				if !send(MessageEvent{Message: msg}) {
+					return
+				}
+			case err, ok := <-errChan:
+				if !ok {
+					// Error channel closed; keep reading messages until msgChan closes
+					errChan = nil
+					continue
+				}
+				if !send(MessageEvent{Err: err}) {
+					return
+				}
+			case <-ctx.Done():
+				done(ctx.Err(), nil)
+				return
+			}
+		}
+	}()
+	return events
+}
+
 // ReceiveResponse returns an iterator for the response messages.
 func (c *ClientImpl) ReceiveResponse(_ context.Context) MessageIterator {
 	// Check connection status with read lock
@@ -408,6 +1285,10 @@ func (c *ClientImpl) ReceiveResponse(_ context.Context) MessageIterator {
 	connected := c.connected
 	msgChan := c.msgChan
 	errChan := c.errChan
+	transport := c.transport
+	failFast := c.options != nil && c.options.FailFast
+	stopAfterFirst := c.options != nil && c.options.StopAfterFirstResponse
+	strictSchema := strictOutputSchema(c.options)
 	c.mu.RUnlock()
 
 	if !connected || msgChan == nil {
@@ -416,8 +1297,12 @@ func (c *ClientImpl) ReceiveResponse(_ context.Context) MessageIterator {
 
 	// Create a simple iterator over the message channel
 	return &clientIterator{
-		msgChan: msgChan,
-		errChan: errChan,
+		msgChan:        msgChan,
+		errChan:        errChan,
+		transport:      transport,
+		failFast:       failFast,
+		stopAfterFirst: stopAfterFirst,
+		strictSchema:   strictSchema,
 	}
 }
 
@@ -435,7 +1320,7 @@ func (c *ClientImpl) Interrupt(ctx context.Context) error {
 	c.mu.RUnlock()
 
 	if !connected || transport == nil {
-		return fmt.Errorf("client not connected")
+		return c.notConnectedError()
 	}
 
 	return transport.Interrupt(ctx)
@@ -466,7 +1351,7 @@ func (c *ClientImpl) SetModel(ctx context.Context, model *string) error {
 	c.mu.RUnlock()
 
 	if !connected || transport == nil {
-		return fmt.Errorf("client not connected")
+		return c.notConnectedError()
 	}
 
 	return transport.SetModel(ctx, model)
@@ -497,12 +1382,51 @@ func (c *ClientImpl) SetPermissionMode(ctx context.Context, mode PermissionMode)
 	c.mu.RUnlock()
 
 	if !connected || transport == nil {
-		return fmt.Errorf("client not connected")
+		return c.notConnectedError()
 	}
 
 	return transport.SetPermissionMode(ctx, string(mode))
 }
 
+// SetAllowedTools restricts the tools approved for the rest of the session,
+// for example to drop Write once a review phase is over. The CLI has no
+// control request for this, so the SDK enforces it: permission requests for
+// tools outside the list are denied before the WithCanUseTool callback runs.
+// Entries may carry a rule suffix such as "Bash(git:*)"; only the tool name
+// is matched. An empty list denies every tool and nil removes the restriction.
+//
+// Tools the CLI approves without asking, such as those in WithAllowedTools,
+// never reach the SDK, so leave tools you intend to revoke out of
+// WithAllowedTools and approve them from the callback instead.
+// Returns error if not connected, if WithCanUseTool is not configured, or if
+// a custom transport does not implement AllowedToolsSetter.
+//
+// Example - Disable writes after an approval phase:
+//
+//	err := client.SetAllowedTools(ctx, []string{"Read", "Grep", "Glob"})
+func (c *ClientImpl) SetAllowedTools(ctx context.Context, tools []string) error {
+	// Check context before proceeding (Go idiom: fail fast)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Check connection status with read lock (minimize lock duration)
+	c.mu.RLock()
+	connected := c.connected
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if !connected || transport == nil {
+		return c.notConnectedError()
+	}
+
+	setter, ok := transport.(AllowedToolsSetter)
+	if !ok {
+		return fmt.Errorf("transport does not support SetAllowedTools")
+	}
+	return setter.SetAllowedTools(ctx, tools)
+}
+
 // RewindFiles reverts tracked files to their state at a specific user message.
 // The messageUUID should be the UUID from a UserMessage received during the session.
 // Requires file checkpointing to be enabled via WithFileCheckpointing() option.
@@ -528,7 +1452,7 @@ func (c *ClientImpl) RewindFiles(ctx context.Context, messageUUID string) error
 	c.mu.RUnlock()
 
 	if !connected || transport == nil {
-		return fmt.Errorf("client not connected")
+		return c.notConnectedError()
 	}
 
 	return transport.RewindFiles(ctx, messageUUID)
@@ -536,9 +1460,13 @@ func (c *ClientImpl) RewindFiles(ctx context.Context, messageUUID string) error
 
 // clientIterator implements MessageIterator for client message reception
 type clientIterator struct {
-	msgChan <-chan Message
-	errChan <-chan error
-	closed  bool
+	msgChan        <-chan Message
+	errChan        <-chan error
+	transport      Transport
+	failFast       bool
+	stopAfterFirst bool
+	strictSchema   map[string]any
+	closed         bool
 }
 
 func (ci *clientIterator) Next(ctx context.Context) (Message, error) {
@@ -546,20 +1474,58 @@ func (ci *clientIterator) Next(ctx context.Context) (Message, error) {
 		return nil, ErrNoMoreMessages
 	}
 
-	select {
-	case msg, ok := <-ci.msgChan:
-		if !ok {
+	for {
+		select {
+		case msg, ok := <-ci.msgChan:
+			return ci.handleMessage(ctx, msg, ok)
+		case err, ok := <-ci.errChan:
+			if !ok {
+				// Error channel closed; drain buffered messages until msgChan closes
+				ci.errChan = nil
+				continue
+			}
+			ci.closed = true
+			return nil, err
+		case <-ctx.Done():
 			ci.closed = true
-			return nil, ErrNoMoreMessages
+			return nil, ctx.Err()
 		}
-		return msg, nil
-	case err := <-ci.errChan:
+	}
+}
+
+// handleMessage applies iterator options to a message received from msgChan.
+// ok is false when the channel has been closed.
+func (ci *clientIterator) handleMessage(ctx context.Context, msg Message, ok bool) (Message, error) {
+	if !ok {
+		ci.closed = true
+		return nil, endOfStreamError(ci.transport)
+	}
+
+	if ci.failFast {
+		if toolErr := findToolExecutionError(msg); toolErr != nil {
+			ci.closed = true
+			ci.interruptTurn(ctx)
+			return nil, toolErr
+		}
+	}
+	if err := validateStrictOutput(ci.strictSchema, msg); err != nil {
 		ci.closed = true
 		return nil, err
-	case <-ctx.Done():
+	}
+	if _, ok := msg.(*AssistantMessage); ok && ci.stopAfterFirst {
 		ci.closed = true
-		return nil, ctx.Err()
+		ci.interruptTurn(ctx)
 	}
+	return msg, nil
+}
+
+// interruptTurn interrupts the turn being read and discards the rest of it,
+// so its messages and result do not reach the next ReceiveResponse.
+func (ci *clientIterator) interruptTurn(ctx context.Context) {
+	if ci.transport != nil {
+		_ = ci.transport.Interrupt(ctx)
+	}
+	drainTurn(ctx, ci.msgChan, ci.errChan, nil)
 }
 
 func (ci *clientIterator) Close() error {
@@ -567,6 +1533,72 @@ func (ci *clientIterator) Close() error {
 	return nil
 }
 
+// drainTurn discards messages until the turn's ResultMessage, calling seen,
+// if set, for each. It stops early if the stream ends, an error arrives, or
+// ctx ends.
+func drainTurn(ctx context.Context, msgs <-chan Message, errs <-chan error, seen func(Message)) {
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			if seen != nil {
+				seen(msg)
+			}
+			if _, isResult := msg.(*ResultMessage); isResult {
+				return
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// findToolExecutionError returns a ToolExecutionError for the first tool result
+// in msg that reports is_error=true, or nil if there is none.
+func findToolExecutionError(msg Message) *ToolExecutionError {
+	userMsg, ok := msg.(*UserMessage)
+	if !ok {
+		return nil
+	}
+	blocks, ok := userMsg.Content.([]ContentBlock)
+	if !ok {
+		return nil
+	}
+	for _, block := range blocks {
+		result, ok := block.(*ToolResultBlock)
+		if ok && result.IsError != nil && *result.IsError {
+			return NewToolExecutionError(result.ToolUseID, result.Content)
+		}
+	}
+	return nil
+}
+
+// strictOutputSchema returns the output schema to enforce in strict mode, or nil.
+func strictOutputSchema(options *Options) map[string]any {
+	if options == nil || !options.StrictStructuredOutput || options.OutputFormat == nil {
+		return nil
+	}
+	return options.OutputFormat.Schema
+}
+
+// validateStrictOutput checks a ResultMessage's structured output against a
+// strict schema. Other messages, and a nil schema, always pass.
+func validateStrictOutput(schema map[string]any, msg Message) error {
+	result, ok := msg.(*ResultMessage)
+	if !ok || schema == nil {
+		return nil
+	}
+	return ValidateStrictOutput(schema, result.StructuredOutput)
+}
+
 // GetStreamIssues returns validation issues found in the message stream.
 // This can help diagnose problems like missing tool results or incomplete streams.
 func (c *ClientImpl) GetStreamIssues() []StreamIssue {
@@ -605,6 +1637,305 @@ func (c *ClientImpl) GetStreamStats() StreamStats {
 	return validator.GetStats()
 }
 
+// WaitForReady blocks until the CLI reports its MCP servers are loaded.
+// Readiness is confirmed by an init system message in which no MCP server is
+// pending. In streaming mode the CLI sends that message only after it reads
+// the first user message, so WaitForReady must follow a query: called before
+// any query, it waits until ctx expires or the startup timeout elapses. It
+// does not consume the query's messages. Use WithWarmup to confirm the CLI
+// itself has started before the first query.
+//
+// Returns ctx.Err() if the context expires first, or an error if the client
+// is not connected or the stream ends before the CLI becomes ready.
+// With WithMcpServerStartupTimeout, it returns a ConnectionError naming the
+// servers still pending once the timeout elapses.
+//
+// Example:
+//
+//	if err := client.Query(ctx, prompt); err != nil {
+//	    return err
+//	}
+//	readyCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+//	defer cancel()
+//	if err := client.WaitForReady(readyCtx); err != nil {
+//	    return err
+//	}
+func (c *ClientImpl) WaitForReady(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	c.mu.RLock()
+	connected := c.connected
+	transport := c.transport
+	c.mu.RUnlock()
+
+	if !connected || transport == nil {
+		return c.notConnectedError()
+	}
+
+	validator := transport.GetValidator()
+	if validator == nil {
+		return fmt.Errorf("transport does not track stream readiness")
+	}
+
+	// A nil channel never fires, leaving the wait unbounded
+	var startupTimeout <-chan time.Time
+	if c.options != nil && c.options.McpServerStartupTimeout > 0 {
+		timer := c.clock().NewTimer(c.options.McpServerStartupTimeout)
+		defer timer.Stop()
+		startupTimeout = timer.C()
+	}
+
+	select {
+	case <-validator.Ready():
+		return nil
+	case <-validator.Ended():
+		// Ready may have been signaled just before the stream ended
+		select {
+		case <-validator.Ready():
+			return nil
+		default:
+		}
+		return fmt.Errorf("stream ended before CLI became ready")
+	case <-startupTimeout:
+		return c.mcpStartupTimeoutError(validator)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mcpStartupTimeoutError builds the ConnectionError returned when MCP servers
+// are not ready within the startup timeout. Servers still pending in the latest
+// init message are named; if no init message arrived, all configured servers are.
+func (c *ClientImpl) mcpStartupTimeoutError(validator *StreamValidator) error {
+	pending, initSeen := validator.PendingMcpServers()
+	if !initSeen {
+		for name := range c.options.McpServers {
+			pending = append(pending, name)
+		}
+		sort.Strings(pending)
+	}
+
+	message := fmt.Sprintf("MCP servers not ready after %s", c.options.McpServerStartupTimeout)
+	if len(pending) > 0 {
+		message += ": " + strings.Join(pending, ", ")
+	}
+	return NewConnectionError(message, context.DeadlineExceeded)
+}
+
+// ReceiveUntil reads response messages until pred returns true.
+// It returns the messages read before the match and the message that satisfied
+// pred. Reading stops at the end of the turn: if the ResultMessage does not
+// satisfy pred, the collected messages include it and the match is nil.
+// Messages are read through ReceiveResponse, so fail-fast and strict output
+// options apply; their errors are returned with the messages collected so far.
+func (c *ClientImpl) ReceiveUntil(ctx context.Context, pred func(Message) bool) ([]Message, Message, error) {
+	if pred == nil {
+		return nil, nil, fmt.Errorf("predicate is required")
+	}
+
+	iter := c.ReceiveResponse(ctx)
+	if iter == nil {
+		return nil, nil, c.notConnectedError()
+	}
+	defer func() { _ = iter.Close() }()
+
+	var collected []Message
+	for {
+		msg, err := iter.Next(ctx)
+		if err != nil {
+			return collected, nil, err
+		}
+		if pred(msg) {
+			return collected, msg, nil
+		}
+		collected = append(collected, msg)
+		if _, ok := msg.(*ResultMessage); ok {
+			return collected, nil, nil
+		}
+	}
+}
+
+// QueryTo sends prompt like Query and writes the assistant's text to w as it
+// arrives, returning when the turn's ResultMessage is received. With
+// WithPartialStreaming, text is written delta by delta; otherwise each text
+// block is written when its message arrives. Consecutive text blocks are
+// separated by a newline, and only text is written: tool use, thinking, and
+// the result are not.
+//
+// Returns the first error from writing to w or receiving the response, or an
+// error describing an error result.
+//
+// Example:
+//
+//	if err := client.QueryTo(ctx, "Summarize README.md", os.Stdout); err != nil {
+//	    log.Fatal(err)
+//	}
+func (c *ClientImpl) QueryTo(ctx context.Context, prompt string, w io.Writer) error {
+	if w == nil {
+		return fmt.Errorf("writer is required")
+	}
+	if err := c.Query(ctx, prompt); err != nil {
+		return err
+	}
+
+	iter := c.ReceiveResponse(ctx)
+	if iter == nil {
+		return c.notConnectedError()
+	}
+	defer func() { _ = iter.Close() }()
+
+	out := &turnTextWriter{w: w}
+	for {
+		msg, err := iter.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if result, ok := msg.(*ResultMessage); ok {
+			return resultMessageError(result)
+		}
+		if err := out.write(msg); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+	}
+}
+
+// QueryChan sends prompt like Query and returns a channel of the turn's
+// messages, closed after its ResultMessage is delivered. Messages are read
+// through ReceiveResponse, so fail-fast and strict output options apply. If
+// receiving fails or ctx ends first, the channel is closed without a
+// ResultMessage. Read the channel until it is closed, or cancel ctx, so the
+// next turn's reader sees the following messages.
+//
+// Example:
+//
+//	messages, err := client.QueryChan(ctx, "List the Go files")
+//	if err != nil {
+//	    return err
+//	}
+//	for msg := range messages {
+//	    handle(msg)
+//	}
+func (c *ClientImpl) QueryChan(ctx context.Context, prompt string) (<-chan Message, error) {
+	if err := c.Query(ctx, prompt); err != nil {
+		return nil, err
+	}
+
+	iter := c.ReceiveResponse(ctx)
+	if iter == nil {
+		return nil, c.notConnectedError()
+	}
+
+	messages := make(chan Message)
+	go func() {
+		defer close(messages)
+		defer func() { _ = iter.Close() }()
+		for {
+			msg, err := iter.Next(ctx)
+			if err != nil {
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+			if _, ok := msg.(*ResultMessage); ok {
+				return
+			}
+		}
+	}()
+	return messages, nil
+}
+
+// turnTextWriter writes the text of a turn's messages to w, preferring
+// streamed deltas over the complete blocks that follow them.
+type turnTextWriter struct {
+	w        io.Writer
+	started  bool // Some text has been written
+	lastByte byte // Last byte written
+	streamed bool // Text deltas were written for the message in progress
+}
+
+// write writes the text carried by msg.
+func (tw *turnTextWriter) write(msg Message) error {
+	switch m := msg.(type) {
+	case *StreamEvent:
+		event := ParseStreamEvent(m)
+		switch {
+		case event.Type == StreamEventTypeContentBlockStart && event.ContentBlock["type"] == ContentBlockTypeText:
+			return tw.separate()
+		case event.Delta != nil && event.Delta.Type == StreamDeltaTypeText:
+			tw.streamed = true
+			return tw.writeString(event.Delta.Text)
+		}
+	case *AssistantMessage:
+		// The complete message repeats text already written from deltas
+		if tw.streamed {
+			tw.streamed = false
+			return nil
+		}
+		for _, block := range m.Content {
+			if text, ok := block.(*TextBlock); ok && text.Text != "" {
+				if err := tw.separate(); err != nil {
+					return err
+				}
+				if err := tw.writeString(text.Text); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// separate starts a new text block on its own line.
+func (tw *turnTextWriter) separate() error {
+	if !tw.started || tw.lastByte == '\n' {
+		return nil
+	}
+	return tw.writeString("\n")
+}
+
+// writeString writes text to w.
+func (tw *turnTextWriter) writeString(text string) error {
+	if text == "" {
+		return nil
+	}
+	if _, err := io.WriteString(tw.w, text); err != nil {
+		return err
+	}
+	tw.started = true
+	tw.lastByte = text[len(text)-1]
+	return nil
+}
+
+// resultMessageError returns an error describing result if it reports one.
+// The error wraps a CLIResultError holding the CLI's original result.
+func resultMessageError(result *ResultMessage) error {
+	if !result.IsError {
+		return nil
+	}
+	return &queryFailedError{cause: NewCLIResultError(result)}
+}
+
+// queryFailedError reports a turn that ended in an error result.
+type queryFailedError struct {
+	cause *CLIResultError
+}
+
+func (e *queryFailedError) Error() string {
+	if e.cause.Result != "" {
+		return fmt.Sprintf("query failed (%s): %s", e.cause.Subtype, e.cause.Result)
+	}
+	return fmt.Sprintf("query failed (%s)", e.cause.Subtype)
+}
+
+func (e *queryFailedError) Unwrap() error {
+	return e.cause
+}
+
 // GetServerInfo returns diagnostic information about the client and its connection.
 // This provides useful information for debugging, health checks, and support scenarios.
 //
@@ -630,7 +1961,7 @@ func (c *ClientImpl) GetServerInfo(_ context.Context) (map[string]interface{}, e
 	defer c.mu.RUnlock()
 
 	if !c.connected || c.transport == nil {
-		return nil, fmt.Errorf("client not connected")
+		return nil, c.notConnectedErrorLocked()
 	}
 
 	info := map[string]interface{}{
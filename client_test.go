@@ -2,12 +2,18 @@ package claudecode
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/claudecodetest"
 )
 
 const (
@@ -381,6 +387,43 @@ func TestClientCanUseToolAutoConfiguresPermissionPromptToolName(t *testing.T) {
 	}
 }
 
+// TestClientPlanProposalAutoConfiguresPermissionPromptToolName verifies that
+// WithOnPlanProposal alone routes permission prompts through stdio, so
+// ExitPlanMode requests reach the SDK.
+func TestClientPlanProposalAutoConfiguresPermissionPromptToolName(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	client := NewClientWithTransport(newClientMockTransport(),
+		WithPermissionMode(PermissionModePlan),
+		WithOnPlanProposal(func(*PlanProposal) bool { return true }))
+	defer disconnectClientSafely(t, client)
+	connectClientSafely(ctx, t, client)
+
+	impl := client.(*ClientImpl)
+	if name := impl.options.PermissionPromptToolName; name == nil || *name != "stdio" {
+		t.Errorf("Expected PermissionPromptToolName = 'stdio', got %v", name)
+	}
+}
+
+// TestClientEditConfirmationAutoConfiguresPermissionPromptToolName tests
+// edit confirmation routes permission prompts through stdio so Write and
+// Edit requests reach the SDK.
+func TestClientEditConfirmationAutoConfiguresPermissionPromptToolName(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	client := NewClientWithTransport(newClientMockTransport(),
+		WithEditConfirmation(func(string, string) bool { return true }))
+	defer disconnectClientSafely(t, client)
+	connectClientSafely(ctx, t, client)
+
+	impl := client.(*ClientImpl)
+	if name := impl.options.PermissionPromptToolName; name == nil || *name != "stdio" {
+		t.Errorf("Expected PermissionPromptToolName = 'stdio', got %v", name)
+	}
+}
+
 // TestClientReceiveMessages tests message reception through client channels
 // Covers T137: Client Message Reception
 func TestClientReceiveMessages(t *testing.T) {
@@ -1014,6 +1057,7 @@ type clientMockTransport struct {
 	connected    bool
 	closed       bool
 	sentMessages []StreamMessage
+	sentFrames   [][]byte
 
 	// Minimal message support for essential tests
 	testMessages []Message
@@ -1029,6 +1073,11 @@ type clientMockTransport struct {
 	setModelError          error
 	setPermissionModeError error
 	rewindFilesError       error
+	allowedTools           []string
+	allowedToolsCalls      int
+
+	interruptCount int
+	validator      *StreamValidator
 }
 
 func (c *clientMockTransport) Connect(ctx context.Context) error {
@@ -1073,6 +1122,34 @@ func (c *clientMockTransport) SendMessage(ctx context.Context, message StreamMes
 		return fmt.Errorf("not connected")
 	}
 	c.sentMessages = append(c.sentMessages, message)
+
+	// Like the CLI, answer the clear command sent by Reset with a result
+	if body, ok := message.Message.(map[string]interface{}); ok && body["content"] == clearCommand && c.msgChan != nil {
+		c.msgChan <- &ResultMessage{Subtype: "success", SessionID: "cleared"}
+	}
+	return nil
+}
+
+func (c *clientMockTransport) SendRaw(ctx context.Context, frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if c.sendError != nil {
+		return c.sendError
+	}
+	if !c.connected {
+		return fmt.Errorf("not connected")
+	}
+	if !json.Valid(frame) {
+		return fmt.Errorf("invalid frame")
+	}
+	c.sentFrames = append(c.sentFrames, append([]byte(nil), frame...))
 	return nil
 }
 
@@ -1110,6 +1187,7 @@ func (c *clientMockTransport) ReceiveMessages(_ context.Context) (msgChan <-chan
 func (c *clientMockTransport) Interrupt(_ context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.interruptCount++
 	if c.interruptError != nil {
 		return c.interruptError
 	}
@@ -1184,6 +1262,11 @@ func (c *clientMockTransport) injectTestMessage(msg Message) {
 }
 
 func (c *clientMockTransport) GetValidator() *StreamValidator {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.validator != nil {
+		return c.validator
+	}
 	return &StreamValidator{}
 }
 
@@ -1214,6 +1297,14 @@ func (c *clientMockTransport) RewindFiles(_ context.Context, _ string) error {
 	return nil
 }
 
+func (c *clientMockTransport) SetAllowedTools(_ context.Context, tools []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.allowedTools = tools
+	c.allowedToolsCalls++
+	return nil
+}
+
 // Streamlined Mock Transport Options - reduced from 11 to 6 essential functions
 type ClientMockTransportOption func(*clientMockTransport)
 
@@ -2529,6 +2620,41 @@ func TestGetServerInfoConcurrent(t *testing.T) {
 func TestClientDynamicControl(t *testing.T) {
 	t.Run("set_model", testClientSetModel)
 	t.Run("set_permission_mode", testClientSetPermissionMode)
+	t.Run("set_allowed_tools", testClientSetAllowedTools)
+}
+
+func testClientSetAllowedTools(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newClientMockTransport()
+	client := setupClientForTest(t, transport)
+
+	err := client.SetAllowedTools(ctx, []string{"Read"})
+	assertClientError(t, err, true, "not connected")
+
+	connectClientSafely(ctx, t, client)
+	defer disconnectClientSafely(t, client)
+
+	assertNoError(t, client.SetAllowedTools(ctx, []string{"Read", "Grep"}))
+	transport.mu.Lock()
+	got, calls := transport.allowedTools, transport.allowedToolsCalls
+	transport.mu.Unlock()
+	if calls != 1 || !reflect.DeepEqual(got, []string{"Read", "Grep"}) {
+		t.Errorf("Expected transport to receive [Read Grep] once, got %v after %d calls", got, calls)
+	}
+
+	cancelled, cancelNow := context.WithCancel(ctx)
+	cancelNow()
+	if err := client.SetAllowedTools(cancelled, nil); err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+	// A custom transport need not support it
+	custom := setupClientForTest(t, struct{ Transport }{newClientMockTransport()})
+	connectClientSafely(ctx, t, custom)
+	defer disconnectClientSafely(t, custom)
+	err = custom.SetAllowedTools(ctx, []string{"Read"})
+	assertClientError(t, err, true, "does not support SetAllowedTools")
 }
 
 func testClientSetModel(t *testing.T) {
@@ -2802,3 +2928,3118 @@ func testClientRewindFilesTransportError(t *testing.T) {
 		t.Errorf("expected transport error, got: %v", err)
 	}
 }
+
+// TestClientFailFast tests that WithFailFast interrupts on the first tool
+// error and discards the rest of the turn
+func TestClientFailFast(t *testing.T) {
+	isError := true
+	toolErrorMessages := []Message{
+		&AssistantMessage{
+			Content: []ContentBlock{&ToolUseBlock{ToolUseID: "toolu_01", Name: "Bash"}},
+			Model:   "claude-sonnet-4-5",
+		},
+		&UserMessage{
+			Content: []ContentBlock{&ToolResultBlock{ToolUseID: "toolu_01", Content: "command not found", IsError: &isError}},
+		},
+		&AssistantMessage{
+			Content: []ContentBlock{&TextBlock{Text: "Let me try something else"}},
+			Model:   "claude-sonnet-4-5",
+		},
+		&ResultMessage{Subtype: "error_during_execution", IsError: true, SessionID: "s1"},
+	}
+
+	t.Run("interrupts_on_tool_error", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages(toolErrorMessages))
+		client := NewClientWithTransport(transport, WithFailFast())
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		iter := client.ReceiveResponse(ctx)
+		if _, err := iter.Next(ctx); err != nil {
+			t.Fatalf("Expected tool use message, got error: %v", err)
+		}
+
+		_, err := iter.Next(ctx)
+		toolErr := AsToolExecutionError(err)
+		if toolErr == nil {
+			t.Fatalf("Expected ToolExecutionError, got %v", err)
+		}
+		if toolErr.ToolUseID != "toolu_01" || toolErr.Content != "command not found" {
+			t.Errorf("Unexpected tool error fields: %+v", toolErr)
+		}
+
+		transport.mu.Lock()
+		interrupts := transport.interruptCount
+		transport.mu.Unlock()
+		if interrupts != 1 {
+			t.Errorf("Expected session to be interrupted once, got %d", interrupts)
+		}
+
+		if _, err := iter.Next(ctx); err != ErrNoMoreMessages {
+			t.Errorf("Expected ErrNoMoreMessages after fail-fast, got %v", err)
+		}
+
+		// The interrupted turn was discarded, so the next response starts clean
+		next := &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Next turn"}}, Model: "claude-sonnet-4-5"}
+		transport.injectTestMessage(next)
+		if msg, err := client.ReceiveResponse(ctx).Next(ctx); err != nil || msg != next {
+			t.Errorf("Expected the next turn's message, got %#v, %v", msg, err)
+		}
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages(toolErrorMessages))
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		iter := client.ReceiveResponse(ctx)
+		for i := range toolErrorMessages {
+			if _, err := iter.Next(ctx); err != nil {
+				t.Fatalf("Message %d: unexpected error: %v", i, err)
+			}
+		}
+		if transport.interruptCount != 0 {
+			t.Errorf("Expected no interrupt without fail-fast, got %d", transport.interruptCount)
+		}
+	})
+}
+
+// TestClientWaitForReady tests blocking until the init message reports readiness
+func TestClientWaitForReady(t *testing.T) {
+	initMessage := &SystemMessage{
+		Subtype: SystemSubtypeInit,
+		Data: map[string]any{
+			"mcp_servers": []any{map[string]any{"name": "docs", "status": "connected"}},
+		},
+	}
+
+	t.Run("returns_after_delayed_init", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		transport.validator = NewStreamValidator()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		var mu sync.Mutex
+		initSent := false
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			initSent = true
+			mu.Unlock()
+			transport.validator.TrackMessage(initMessage)
+		}()
+
+		assertNoError(t, client.WaitForReady(ctx))
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !initSent {
+			t.Error("WaitForReady returned before init message was received")
+		}
+	})
+
+	t.Run("context_expires_while_waiting", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		transport.validator = NewStreamValidator()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer waitCancel()
+		if err := client.WaitForReady(waitCtx); err != context.DeadlineExceeded {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("stream_ends_before_ready", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		transport.validator = NewStreamValidator()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		transport.validator.MarkStreamEnd()
+		assertClientError(t, client.WaitForReady(ctx), true, "stream ended before CLI became ready")
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		assertClientError(t, client.WaitForReady(ctx), true, "client not connected")
+	})
+}
+
+// TestClientMcpServerStartupTimeout tests WaitForReady gives up on MCP servers that never become ready
+func TestClientMcpServerStartupTimeout(t *testing.T) {
+	servers := map[string]McpServerConfig{
+		"search": &McpStdioServerConfig{Type: McpServerTypeStdio, Command: "search-mcp"},
+		"docs":   &McpStdioServerConfig{Type: McpServerTypeStdio, Command: "docs-mcp"},
+	}
+
+	tests := []struct {
+		name        string
+		init        Message
+		wantServers string
+	}{
+		{
+			name: "init_reports_pending_server",
+			init: &SystemMessage{
+				Subtype: SystemSubtypeInit,
+				Data: map[string]any{
+					"mcp_servers": []any{
+						map[string]any{"name": "docs", "status": "connected"},
+						map[string]any{"name": "search", "status": McpServerStatusPending},
+					},
+				},
+			},
+			wantServers: ": search",
+		},
+		{
+			name:        "no_init_message",
+			wantServers: ": docs, search",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupClientTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newClientMockTransport()
+			transport.validator = NewStreamValidator()
+			client := NewClientWithTransport(transport,
+				WithMcpServers(servers),
+				WithMcpServerStartupTimeout(30*time.Millisecond),
+			)
+			defer disconnectClientSafely(t, client)
+			connectClientSafely(ctx, t, client)
+
+			if test.init != nil {
+				transport.validator.TrackMessage(test.init)
+			}
+
+			start := time.Now()
+			err := client.WaitForReady(ctx)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected WaitForReady to stop at the startup timeout, took %v", elapsed)
+			}
+			if !IsConnectionError(err) {
+				t.Fatalf("Expected ConnectionError, got %T: %v", err, err)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Expected error to wrap context.DeadlineExceeded, got %v", err)
+			}
+			want := "MCP servers not ready after 30ms" + test.wantServers
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Expected error containing %q, got %q", want, err.Error())
+			}
+		})
+	}
+
+	t.Run("fake_clock_times_out_without_waiting", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		transport.validator = NewStreamValidator()
+		client := NewClientWithTransport(transport,
+			WithMcpServers(servers),
+			WithMcpServerStartupTimeout(10*time.Minute),
+			WithClock(clock),
+		)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		done := make(chan error, 1)
+		go func() { done <- client.WaitForReady(ctx) }()
+		clock.BlockUntil(1) // The startup timer is waiting
+		clock.Advance(10 * time.Minute)
+
+		select {
+		case err := <-done:
+			if !IsConnectionError(err) || !strings.Contains(err.Error(), "not ready after 10m0s") {
+				t.Errorf("Expected startup timeout ConnectionError, got %v", err)
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for WaitForReady")
+		}
+	})
+
+	t.Run("ready_before_timeout", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		transport.validator = NewStreamValidator()
+		client := NewClientWithTransport(transport, WithMcpServerStartupTimeout(time.Second))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		transport.validator.TrackMessage(&SystemMessage{Subtype: SystemSubtypeInit, Data: map[string]any{}})
+		assertNoError(t, client.WaitForReady(ctx))
+	})
+}
+
+// TestClientStopAfterFirstResponse tests ReceiveResponse stops after the
+// first assistant message and discards the rest of the turn
+func TestClientStopAfterFirstResponse(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newClientMockTransportWithOptions(WithClientResponseMessages([]Message{
+		&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "negative"}}, Model: "claude-sonnet-4-5"},
+		&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "more output"}}, Model: "claude-sonnet-4-5"},
+		&ResultMessage{Subtype: "success", SessionID: "s1"},
+	}))
+	client := NewClientWithTransport(transport, WithStopAfterFirstResponse())
+	defer disconnectClientSafely(t, client)
+	connectClientSafely(ctx, t, client)
+
+	iter := client.ReceiveResponse(ctx)
+	msg, err := iter.Next(ctx)
+	assertNoError(t, err)
+	if text := msg.(*AssistantMessage).Content[0].(*TextBlock).Text; text != "negative" {
+		t.Errorf("Expected first response 'negative', got %q", text)
+	}
+
+	transport.mu.Lock()
+	interrupts := transport.interruptCount
+	transport.mu.Unlock()
+	if interrupts != 1 {
+		t.Errorf("Expected session to be interrupted once, got %d", interrupts)
+	}
+
+	if _, err := iter.Next(ctx); err != ErrNoMoreMessages {
+		t.Errorf("Expected ErrNoMoreMessages after first response, got %v", err)
+	}
+
+	// The rest of the interrupted turn was discarded
+	next := &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "positive"}}, Model: "claude-sonnet-4-5"}
+	transport.injectTestMessage(next)
+	transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "s1"})
+	if msg, err := client.ReceiveResponse(ctx).Next(ctx); err != nil || msg != next {
+		t.Errorf("Expected the next turn's message, got %#v, %v", msg, err)
+	}
+}
+
+// TestClientIteratorStreamTermination tests a closed stream ends with
+// ErrNoMoreMessages or ErrUnexpectedEOF, draining buffered messages first
+func TestClientIteratorStreamTermination(t *testing.T) {
+	tests := []struct {
+		name       string
+		unexpected bool
+		wantErr    error
+	}{
+		{"normal_completion", false, ErrNoMoreMessages},
+		{"premature_eof", true, ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupClientTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newClientMockTransport()
+			transport.validator = NewStreamValidator()
+			if test.unexpected {
+				transport.validator.MarkUnexpectedEnd()
+			}
+
+			// Both channels closed with a message still buffered
+			msgChan := make(chan Message, 1)
+			msgChan <- &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "buffered"}}}
+			close(msgChan)
+			errChan := make(chan error)
+			close(errChan)
+
+			iter := &clientIterator{msgChan: msgChan, errChan: errChan, transport: transport}
+
+			msg, err := iter.Next(ctx)
+			assertNoError(t, err)
+			if _, ok := msg.(*AssistantMessage); !ok {
+				t.Fatalf("Expected buffered AssistantMessage, got %T", msg)
+			}
+
+			if _, err := iter.Next(ctx); !errors.Is(err, test.wantErr) {
+				t.Errorf("Expected %v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestClientReceiveUntil tests predicate-based consumption of a response
+func TestClientReceiveUntil(t *testing.T) {
+	turn := []Message{
+		&AssistantMessage{
+			Content: []ContentBlock{&TextBlock{Text: "Let me look"}},
+			Model:   "claude-sonnet-4-5",
+		},
+		&AssistantMessage{
+			Content: []ContentBlock{&ToolUseBlock{ToolUseID: "toolu_01", Name: "Grep", Input: map[string]any{"pattern": "TODO"}}},
+			Model:   "claude-sonnet-4-5",
+		},
+		&UserMessage{
+			Content: []ContentBlock{&ToolResultBlock{ToolUseID: "toolu_01", Content: "main.go:10"}},
+		},
+		&ResultMessage{Subtype: "success", NumTurns: 1, SessionID: "s1"},
+	}
+
+	usesTool := func(name string) func(Message) bool {
+		return func(msg Message) bool {
+			assistant, ok := msg.(*AssistantMessage)
+			if !ok {
+				return false
+			}
+			for _, block := range assistant.Content {
+				if toolUse, ok := block.(*ToolUseBlock); ok && toolUse.Name == name {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	t.Run("matches_tool_use_mid_turn", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages(turn))
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		collected, match, err := client.ReceiveUntil(ctx, usesTool("Grep"))
+		assertNoError(t, err)
+		if len(collected) != 1 || collected[0] != turn[0] {
+			t.Errorf("Expected the first message collected before the match, got %v", collected)
+		}
+		if match != turn[1] {
+			t.Fatalf("Expected the Grep tool use as the match, got %#v", match)
+		}
+
+		// Remaining messages stay available to the caller
+		rest, _, err := client.ReceiveUntil(ctx, func(Message) bool { return false })
+		assertNoError(t, err)
+		if len(rest) != 2 {
+			t.Errorf("Expected tool result and result message remaining, got %d messages", len(rest))
+		}
+	})
+
+	t.Run("turn_ends_without_match", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages(turn))
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		collected, match, err := client.ReceiveUntil(ctx, usesTool("Write"))
+		assertNoError(t, err)
+		if match != nil {
+			t.Errorf("Expected no match, got %#v", match)
+		}
+		if len(collected) != len(turn) {
+			t.Errorf("Expected all %d messages collected, got %d", len(turn), len(collected))
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		if _, _, err := client.ReceiveUntil(ctx, usesTool("Grep")); err == nil {
+			t.Error("Expected error when not connected")
+		}
+
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		if _, _, err := client.ReceiveUntil(ctx, nil); err == nil {
+			t.Error("Expected error for nil predicate")
+		}
+	})
+}
+
+// TestClientQueryTo tests QueryTo writes a turn's text to the writer and
+// returns at the result
+func TestClientQueryTo(t *testing.T) {
+	streamEvent := func(event map[string]any) *StreamEvent {
+		return &StreamEvent{UUID: "e", SessionID: "s1", Event: event}
+	}
+	textDelta := func(text string) *StreamEvent {
+		return streamEvent(map[string]any{
+			"type": StreamEventTypeContentBlockDelta, "index": 0,
+			"delta": map[string]any{"type": StreamDeltaTypeText, "text": text},
+		})
+	}
+	textStart := streamEvent(map[string]any{
+		"type": StreamEventTypeContentBlockStart, "index": 0,
+		"content_block": map[string]any{"type": ContentBlockTypeText, "text": ""},
+	})
+	errorText := "API Error: 529 overloaded"
+
+	tests := []struct {
+		name    string
+		turn    []Message
+		want    string
+		wantErr string
+	}{
+		{
+			name: "multi_block_messages",
+			turn: []Message{
+				&AssistantMessage{Content: []ContentBlock{
+					&TextBlock{Text: "First block"},
+					&ThinkingBlock{Thinking: "hidden"},
+					&TextBlock{Text: "Second block\n"},
+				}},
+				&AssistantMessage{Content: []ContentBlock{&ToolUseBlock{ToolUseID: "toolu_01", Name: "Read"}}},
+				&UserMessage{Content: []ContentBlock{&ToolResultBlock{ToolUseID: "toolu_01", Content: "ok"}}},
+				&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Done."}}},
+				&ResultMessage{Subtype: "success", SessionID: "s1"},
+			},
+			want: "First block\nSecond block\nDone.",
+		},
+		{
+			name: "streamed_deltas",
+			turn: []Message{
+				textStart, textDelta("Hel"), textDelta("lo"),
+				&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Hello"}}},
+				textStart, textDelta("World"),
+				&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "World"}}},
+				&ResultMessage{Subtype: "success", SessionID: "s1"},
+			},
+			want: "Hello\nWorld",
+		},
+		{
+			name: "error_result",
+			turn: []Message{
+				&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Partial"}}},
+				&ResultMessage{Subtype: "error_during_execution", IsError: true, Result: &errorText},
+			},
+			want:    "Partial",
+			wantErr: "529 overloaded",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupClientTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newClientMockTransportWithOptions(WithClientResponseMessages(test.turn))
+			client := setupClientForTest(t, transport)
+			defer disconnectClientSafely(t, client)
+			connectClientSafely(ctx, t, client)
+
+			var out strings.Builder
+			err := client.QueryTo(ctx, "Hello", &out)
+			assertClientError(t, err, test.wantErr != "", test.wantErr)
+			if out.String() != test.want {
+				t.Errorf("Expected output %q, got %q", test.want, out.String())
+			}
+			assertClientMessageCount(t, transport, 1)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		assertClientError(t, client.QueryTo(ctx, "Hello", &strings.Builder{}), true, "not connected")
+
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		assertClientError(t, client.QueryTo(ctx, "Hello", nil), true, "writer is required")
+	})
+
+	t.Run("error_result_payload", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		raw := `{"type":"result","subtype":"error_during_execution","is_error":true,` +
+			`"result":"API Error: 529 overloaded","error":{"type":"overloaded_error","request_id":"req_1"}}`
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages([]Message{
+			&ResultMessage{
+				Subtype: "error_during_execution", IsError: true, Result: &errorText,
+				ErrorType: ResultErrorOverloaded, Raw: []byte(raw),
+			},
+		}))
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		err := client.QueryTo(ctx, "Hello", &strings.Builder{})
+		if err == nil || err.Error() != "query failed (error_during_execution): API Error: 529 overloaded" {
+			t.Fatalf("Expected the query failure message, got %v", err)
+		}
+		var resultErr *CLIResultError
+		if !errors.As(err, &resultErr) {
+			t.Fatalf("Expected the error to wrap a CLIResultError, got %T", err)
+		}
+		if errors.Unwrap(err) != resultErr {
+			t.Error("Expected Unwrap to return the CLIResultError")
+		}
+		if string(resultErr.Raw) != raw || resultErr.ErrorType != ResultErrorOverloaded {
+			t.Errorf("Expected the original payload, got %s (%q)", resultErr.Raw, resultErr.ErrorType)
+		}
+	})
+}
+
+// TestClientQueryChan tests the channel carries one turn's messages and is
+// closed after its result
+func TestClientQueryChan(t *testing.T) {
+	// collect reads messages until the channel is closed
+	collect := func(t *testing.T, messages <-chan Message) []Message {
+		t.Helper()
+		var got []Message
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return got
+				}
+				got = append(got, msg)
+			case <-time.After(2 * time.Second):
+				t.Fatal("Timed out waiting for the channel to close")
+				return nil
+			}
+		}
+	}
+
+	t.Run("closes_after_result", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		assistant := &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "main.go"}}, Model: testModelSonnet}
+		result := &ResultMessage{Subtype: "success", SessionID: defaultSessionID}
+		next := &AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "next turn"}}, Model: testModelSonnet}
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages([]Message{assistant, result, next}))
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		messages, err := client.QueryChan(ctx, "List the Go files")
+		assertNoError(t, err)
+		got := collect(t, messages)
+		if len(got) != 2 || got[0] != assistant || got[1] != result {
+			t.Fatalf("Expected the turn's assistant message and result, got %#v", got)
+		}
+		assertClientMessageCount(t, transport, 1)
+
+		// The next turn's messages are left for the next reader
+		msg, err := client.ReceiveResponse(ctx).Next(ctx)
+		assertNoError(t, err)
+		if msg != next {
+			t.Errorf("Expected the next turn's message, got %#v", msg)
+		}
+	})
+
+	t.Run("closes_when_context_ends", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		queryCtx, queryCancel := context.WithCancel(ctx)
+		messages, err := client.QueryChan(queryCtx, "Hello")
+		assertNoError(t, err)
+		queryCancel()
+		if got := collect(t, messages); len(got) != 0 {
+			t.Errorf("Expected no messages, got %#v", got)
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		messages, err := client.QueryChan(ctx, "Hello")
+		assertClientError(t, err, true, "not connected")
+		if messages != nil {
+			t.Error("Expected no channel when the query fails")
+		}
+	})
+}
+
+// TestQueryJSON tests structured output is decoded into a typed value and
+// the schema is applied before connecting
+func TestQueryJSON(t *testing.T) {
+	type summary struct {
+		Title  string   `json:"title"`
+		Points []string `json:"points"`
+	}
+	schema := JSONSchemaFromType(summary{})
+	output := map[string]any{"title": "README", "points": []any{"install", "usage"}}
+	errorText := "API Error: 529 overloaded"
+
+	tests := []struct {
+		name    string
+		result  *ResultMessage
+		want    summary
+		wantErr string
+	}{
+		{
+			name:   "decodes_structured_output",
+			result: &ResultMessage{Subtype: "success", SessionID: "s1", StructuredOutput: output},
+			want:   summary{Title: "README", Points: []string{"install", "usage"}},
+		},
+		{
+			name:    "no_structured_output",
+			result:  &ResultMessage{Subtype: "success", SessionID: "s1"},
+			wantErr: "no structured output",
+		},
+		{
+			name:    "mismatched_structured_output",
+			result:  &ResultMessage{Subtype: "success", SessionID: "s1", StructuredOutput: map[string]any{"title": 42}},
+			wantErr: "failed to decode structured output",
+		},
+		{
+			name:    "error_result",
+			result:  &ResultMessage{Subtype: "error_during_execution", IsError: true, Result: &errorText},
+			wantErr: "529 overloaded",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupClientTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newClientMockTransportWithOptions(WithClientResponseMessages([]Message{
+				&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Done."}}, Model: testModelSonnet},
+				test.result,
+			}))
+			client := setupClientForTest(t, transport)
+			defer disconnectClientSafely(t, client)
+
+			got, err := QueryJSON[summary](ctx, client, "Summarize README.md", schema)
+			assertClientError(t, err, test.wantErr != "", test.wantErr)
+			if !reflect.DeepEqual(got, test.want) && test.wantErr == "" {
+				t.Errorf("Expected %+v, got %+v", test.want, got)
+			}
+
+			format := client.(*ClientImpl).options.OutputFormat
+			if format == nil || !reflect.DeepEqual(format.Schema, schema) {
+				t.Errorf("Expected the schema to be set before connecting, got %+v", format)
+			}
+			assertClientMessageCount(t, transport, 1)
+		})
+	}
+
+	t.Run("connected_with_other_schema", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithJSONSchema(map[string]any{"type": "object"}))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		_, err := QueryJSON[summary](ctx, client, "Summarize README.md", schema)
+		assertClientError(t, err, true, "different output schema")
+		assertClientMessageCount(t, transport, 0)
+	})
+
+	t.Run("connected_with_strict_schema", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages([]Message{
+			&ResultMessage{Subtype: "success", SessionID: "s1", StructuredOutput: output},
+		}))
+		client := NewClientWithTransport(transport, WithJSONSchemaStrict(schema))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		got, err := QueryJSON[summary](ctx, client, "Summarize README.md", schema)
+		assertNoError(t, err)
+		if got.Title != "README" {
+			t.Errorf("Expected decoded title README, got %q", got.Title)
+		}
+	})
+}
+
+// TestClientMessages tests Messages delivers messages and errors as events
+// and signals the end of the stream exactly once
+func TestClientMessages(t *testing.T) {
+	// collect reads events until the channel closes
+	collect := func(t *testing.T, events <-chan MessageEvent) (msgs []Message, errs []error, done []MessageEvent) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return msgs, errs, done
+				}
+				switch {
+				case event.Done:
+					done = append(done, event)
+				case event.Err != nil:
+					errs = append(errs, event.Err)
+				default:
+					msgs = append(msgs, event.Message)
+				}
+			case <-timeout:
+				t.Fatal("Timed out waiting for the events channel to close")
+			}
+		}
+	}
+
+	t.Run("messages_errors_and_done", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		asyncErr := errors.New("parse failure")
+		turn := []Message{
+			&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Hi"}}, Model: "claude-sonnet-4-5"},
+			&ResultMessage{Subtype: "success", SessionID: "s1"},
+		}
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages(turn), WithClientAsyncError(asyncErr))
+		client := setupClientForTest(t, transport)
+		connectClientSafely(ctx, t, client)
+
+		// Read the buffered messages and error, then end the stream
+		events := client.Messages(ctx)
+		var msgs []Message
+		var errs []error
+		for len(msgs)+len(errs) < 3 {
+			select {
+			case event := <-events:
+				if event.Done {
+					t.Fatalf("Unexpected done event before the stream ended: %+v", event)
+				}
+				if event.Err != nil {
+					errs = append(errs, event.Err)
+				} else {
+					msgs = append(msgs, event.Message)
+				}
+			case <-ctx.Done():
+				t.Fatal("Timed out waiting for events")
+			}
+		}
+		assertNoError(t, client.Disconnect())
+
+		rest, restErrs, done := collect(t, events)
+		if len(rest) != 0 || len(restErrs) != 0 {
+			t.Errorf("Expected only the done event after Disconnect, got %v and %v", rest, restErrs)
+		}
+		if len(msgs) != 2 || msgs[0] != turn[0] || msgs[1] != turn[1] {
+			t.Errorf("Expected the turn's messages in order, got %v", msgs)
+		}
+		if len(errs) != 1 || !errors.Is(errs[0], asyncErr) {
+			t.Errorf("Expected the stream error as an event, got %v", errs)
+		}
+		if len(done) != 1 || done[0].Err != nil || done[0].Message != nil {
+			t.Errorf("Expected one clean done event, got %+v", done)
+		}
+	})
+
+	t.Run("context_ends", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		eventsCtx, stop := context.WithCancel(ctx)
+		events := client.Messages(eventsCtx)
+		stop()
+
+		_, _, done := collect(t, events)
+		if len(done) != 1 || !errors.Is(done[0].Err, context.Canceled) {
+			t.Errorf("Expected one done event with context.Canceled, got %+v", done)
+		}
+	})
+
+	t.Run("ended_context_leaves_messages_unread", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		turn := []Message{
+			&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Hi"}}, Model: "claude-sonnet-4-5"},
+			&ResultMessage{Subtype: "success", SessionID: "s1"},
+		}
+		client := setupClientForTest(t, newClientMockTransportWithOptions(WithClientResponseMessages(turn)))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		// Messages are waiting, but a reader whose context already ended takes none
+		for i := 0; i < 20; i++ {
+			eventsCtx, stop := context.WithCancel(ctx)
+			stop()
+			msgs, _, done := collect(t, client.Messages(eventsCtx))
+			if len(msgs) != 0 || len(done) != 1 || done[0].Message != nil {
+				t.Fatalf("Expected only an empty done event, got %v and %+v", msgs, done)
+			}
+		}
+
+		msgChan := client.ReceiveMessages(ctx)
+		for i, want := range turn {
+			select {
+			case msg := <-msgChan:
+				if msg != want {
+					t.Errorf("Message %d: expected %v, got %v", i, want, msg)
+				}
+			case <-ctx.Done():
+				t.Fatalf("Timed out waiting for message %d", i)
+			}
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		msgs, errs, done := collect(t, client.Messages(ctx))
+		if len(msgs) != 0 || len(errs) != 0 {
+			t.Errorf("Expected no messages or errors, got %v and %v", msgs, errs)
+		}
+		if len(done) != 1 || done[0].Err == nil || !strings.Contains(done[0].Err.Error(), "not connected") {
+			t.Errorf("Expected one done event reporting not connected, got %+v", done)
+		}
+	})
+}
+
+// TestClientQueryWithID tests QueryWithID generates unique IDs and attaches them to the sent query
+func TestClientQueryWithID(t *testing.T) {
+	t.Run("attaches_generated_id", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		first, err := client.QueryWithID(ctx, "first")
+		assertNoError(t, err)
+		second, err := client.QueryWithID(ctx, "second")
+		assertNoError(t, err)
+		err = client.Query(ctx, "untagged")
+		assertNoError(t, err)
+
+		if first == "" || first == second {
+			t.Fatalf("Expected unique non-empty query IDs, got %q and %q", first, second)
+		}
+		if !strings.HasPrefix(first, "query_1_") || !strings.HasPrefix(second, "query_2_") {
+			t.Errorf("Expected query_{counter}_{hex} IDs, got %q and %q", first, second)
+		}
+
+		transport.mu.Lock()
+		sent := append([]StreamMessage(nil), transport.sentMessages...)
+		transport.mu.Unlock()
+		wantIDs := []string{first, second, ""}
+		if len(sent) != len(wantIDs) {
+			t.Fatalf("Expected %d sent messages, got %d", len(wantIDs), len(sent))
+		}
+		for i, want := range wantIDs {
+			if sent[i].QueryID != want {
+				t.Errorf("Sent message %d: expected query ID %q, got %q", i, want, sent[i].QueryID)
+			}
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		queryID, err := client.QueryWithID(ctx, "hello")
+		if err == nil {
+			t.Fatal("Expected error when not connected")
+		}
+		if queryID != "" {
+			t.Errorf("Expected empty query ID on error, got %q", queryID)
+		}
+	})
+}
+
+// TestMessageQueryID tests reading the query ID attached to messages
+func TestMessageQueryID(t *testing.T) {
+	tagged := []Message{
+		&UserMessage{QueryID: "q"},
+		&AssistantMessage{QueryID: "q"},
+		&SystemMessage{QueryID: "q"},
+		&ResultMessage{QueryID: "q"},
+		&StreamEvent{QueryID: "q"},
+	}
+	for _, msg := range tagged {
+		if got := MessageQueryID(msg); got != "q" {
+			t.Errorf("%T: expected query ID %q, got %q", msg, "q", got)
+		}
+	}
+	if got := MessageQueryID(nil); got != "" {
+		t.Errorf("Expected empty query ID for nil message, got %q", got)
+	}
+}
+
+// TestClientContextFiles tests context files are prepended to the first
+// query of a connection and again after Reset
+func TestClientContextFiles(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	assertNoError(t, os.WriteFile(path, []byte("package main\n"), 0o600))
+	header := fmt.Sprintf("<file path=%q>\npackage main\n</file>\n\n", path)
+
+	transport := newClientMockTransport()
+	client := NewClientWithTransport(transport, WithContextFiles(path))
+	defer disconnectClientSafely(t, client)
+	connectClientSafely(ctx, t, client)
+
+	assertNoError(t, client.Query(ctx, "What does it do?"))
+	assertNoError(t, client.QueryWithSession(ctx, "And here?", "named"))
+	assertNoError(t, client.Reset(ctx))
+	_, err := client.QueryWithID(ctx, "Fresh start")
+	assertNoError(t, err)
+
+	transport.mu.Lock()
+	var prompts []string
+	for _, msg := range transport.sentMessages {
+		content, _ := msg.Message.(map[string]interface{})["content"].(string)
+		prompts = append(prompts, content)
+	}
+	transport.mu.Unlock()
+
+	want := []string{header + "What does it do?", "And here?", clearCommand, header + "Fresh start"}
+	if strings.Join(prompts, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected prompts %q, got %q", want, prompts)
+	}
+}
+
+// TestClientReset tests Reset clears the CLI conversation and moves later
+// queries to a fresh session
+func TestClientReset(t *testing.T) {
+	t.Run("questions_after_reset_use_new_session", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Query(ctx, "Remember: x = 5"))
+		assertNoError(t, client.QueryWithSession(ctx, "Remember: lang = Go", "named"))
+		assertNoError(t, client.Reset(ctx))
+		assertNoError(t, client.Query(ctx, "What is x?"))
+		_, err := client.QueryWithID(ctx, "What did I ask before?")
+		assertNoError(t, err)
+		assertNoError(t, client.QueryWithSession(ctx, "What is lang?", "named"))
+
+		// Conversation context per session, as the CLI would track it
+		transport.mu.Lock()
+		history := make(map[string][]string)
+		var sessions []string
+		for _, msg := range transport.sentMessages {
+			content, _ := msg.Message.(map[string]interface{})["content"].(string)
+			history[msg.SessionID] = append(history[msg.SessionID], content)
+			sessions = append(sessions, msg.SessionID)
+		}
+		transport.mu.Unlock()
+
+		if sessions[0] != defaultSessionID {
+			t.Errorf("Expected first query in %q session, got %q", defaultSessionID, sessions[0])
+		}
+		// The CLI's conversation is cleared in the session being reset
+		if history[defaultSessionID][1] != clearCommand {
+			t.Errorf("Expected Reset to send %s in the old session, got %v", clearCommand, history[defaultSessionID])
+		}
+		fresh := sessions[3]
+		if fresh == defaultSessionID || fresh == "" {
+			t.Fatalf("Expected a new session ID after Reset, got %q", fresh)
+		}
+		if sessions[4] != fresh {
+			t.Errorf("Expected QueryWithID to use the reset session %q, got %q", fresh, sessions[4])
+		}
+		want := []string{"What is x?", "What did I ask before?"}
+		if strings.Join(history[fresh], "|") != strings.Join(want, "|") {
+			t.Errorf("Expected fresh session to hold only post-reset questions %v, got %v", want, history[fresh])
+		}
+		if len(history["named"]) != 2 {
+			t.Errorf("Expected named session to keep its context, got %v", history["named"])
+		}
+	})
+
+	t.Run("each_reset_starts_new_session", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Reset(ctx))
+		assertNoError(t, client.Query(ctx, "first"))
+		assertNoError(t, client.Reset(ctx))
+		assertNoError(t, client.Query(ctx, "second"))
+
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		first, second := transport.sentMessages[1], transport.sentMessages[3]
+		if first.SessionID == second.SessionID {
+			t.Errorf("Expected distinct sessions after each Reset, got %q twice", first.SessionID)
+		}
+	})
+
+	t.Run("clear_not_reported_as_turn", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		ended := make(chan *ResultMessage, 1)
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithTurnCallback(nil, func(result *ResultMessage) {
+			ended <- result
+		}))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Reset(ctx))
+		if len(ended) != 0 {
+			t.Errorf("Expected the clear command's result not reported, got %d turn ends", len(ended))
+		}
+		if count := transport.getSentMessageCount(); count != 1 {
+			t.Errorf("Expected only the clear command sent, got %d messages", count)
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		assertClientError(t, client.Reset(ctx), true, "client not connected")
+	})
+}
+
+// TestClientInputValidation tests invalid prompts return a ValidationError
+// without being sent
+func TestClientInputValidation(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newClientMockTransport()
+	client := NewClientWithTransport(transport, WithInputValidation(3, 20))
+	connectClientSafely(ctx, t, client)
+	defer disconnectClientSafely(t, client)
+
+	invalid := []struct {
+		name string
+		send func() error
+	}{
+		{"empty_query", func() error { return client.Query(ctx, "") }},
+		{"whitespace_session_query", func() error { return client.QueryWithSession(ctx, "   ", "s1") }},
+		{"too_short_query", func() error { return client.Query(ctx, "hi") }},
+		{"too_long_query_with_id", func() error {
+			_, err := client.QueryWithID(ctx, strings.Repeat("x", 21))
+			return err
+		}},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.send()
+			if validationErr := AsValidationError(err); validationErr == nil || validationErr.Field != "prompt" {
+				t.Fatalf("Expected prompt ValidationError, got %v", err)
+			}
+			if sent := transport.getSentMessageCount(); sent != 0 {
+				t.Errorf("Expected invalid prompt not sent, got %d messages", sent)
+			}
+		})
+	}
+
+	t.Run("valid_query_sent", func(t *testing.T) {
+		assertNoError(t, client.Query(ctx, "What is Go?"))
+		if sent := transport.getSentMessageCount(); sent != 1 {
+			t.Errorf("Expected valid prompt sent, got %d messages", sent)
+		}
+	})
+}
+
+// TestClientRequestInterceptor tests prompts are rewritten or rejected before sending
+func TestClientRequestInterceptor(t *testing.T) {
+	errContainsSecret := errors.New("prompt contains a secret")
+	interceptor := func(prompt string) (string, error) {
+		if strings.Contains(prompt, "password") {
+			return "", errContainsSecret
+		}
+		if strings.Contains(prompt, "panic") {
+			panic("interceptor bug")
+		}
+		return strings.ReplaceAll(prompt, "alice@example.com", "[EMAIL]"), nil
+	}
+
+	tests := []struct {
+		name     string
+		send     func(ctx context.Context, client Client) error
+		wantSent string
+		wantErr  string
+	}{
+		{
+			name:     "query_rewritten",
+			send:     func(ctx context.Context, c Client) error { return c.Query(ctx, "Email alice@example.com") },
+			wantSent: "Email [EMAIL]",
+		},
+		{
+			name: "session_query_rewritten",
+			send: func(ctx context.Context, c Client) error {
+				return c.QueryWithSession(ctx, "Ping alice@example.com", "s1")
+			},
+			wantSent: "Ping [EMAIL]",
+		},
+		{
+			name: "query_with_id_rewritten",
+			send: func(ctx context.Context, c Client) error {
+				_, err := c.QueryWithID(ctx, "Cc alice@example.com")
+				return err
+			},
+			wantSent: "Cc [EMAIL]",
+		},
+		{
+			name:    "rejected_prompt_not_sent",
+			send:    func(ctx context.Context, c Client) error { return c.Query(ctx, "my password is hunter2") },
+			wantErr: "prompt rejected by request interceptor: prompt contains a secret",
+		},
+		{
+			name:    "panic_rejects_prompt",
+			send:    func(ctx context.Context, c Client) error { return c.Query(ctx, "panic please") },
+			wantErr: "request interceptor panicked: interceptor bug",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupClientTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newClientMockTransport()
+			client := NewClientWithTransport(transport, WithRequestInterceptor(interceptor))
+			defer disconnectClientSafely(t, client)
+			connectClientSafely(ctx, t, client)
+
+			err := test.send(ctx, client)
+
+			transport.mu.Lock()
+			sent := append([]StreamMessage(nil), transport.sentMessages...)
+			transport.mu.Unlock()
+
+			if test.wantErr != "" {
+				assertClientError(t, err, true, test.wantErr)
+				if len(sent) != 0 {
+					t.Errorf("Expected rejected prompt not to be sent, got %d messages", len(sent))
+				}
+				return
+			}
+			assertNoError(t, err)
+			if len(sent) != 1 {
+				t.Fatalf("Expected 1 sent message, got %d", len(sent))
+			}
+			content := sent[0].Message.(map[string]interface{})["content"]
+			if content != test.wantSent {
+				t.Errorf("Expected sent prompt %q, got %q", test.wantSent, content)
+			}
+		})
+	}
+
+	t.Run("error_wraps_interceptor_error", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := NewClientWithTransport(newClientMockTransport(), WithRequestInterceptor(interceptor))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		if err := client.Query(ctx, "password: x"); !errors.Is(err, errContainsSecret) {
+			t.Errorf("Expected error wrapping the interceptor error, got %v", err)
+		}
+	})
+}
+
+// TestClientSessionTracking tests ActiveSessions and HasSession across multiple sessions
+func TestClientSessionTracking(t *testing.T) {
+	t.Run("tracks_sessions_in_first_use_order", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		if got := client.ActiveSessions(); len(got) != 0 {
+			t.Errorf("Expected no sessions before any query, got %v", got)
+		}
+
+		assertNoError(t, client.QueryWithSession(ctx, "Remember: x = 5", "math"))
+		assertNoError(t, client.Query(ctx, "Hello"))
+		assertNoError(t, client.QueryWithSession(ctx, "Remember: lang = Go", "prog"))
+		assertNoError(t, client.QueryWithSession(ctx, "What is x?", "math"))
+		assertNoError(t, client.QueryWithSession(ctx, "Default again", ""))
+
+		want := []string{"math", defaultSessionID, "prog"}
+		if got := client.ActiveSessions(); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected sessions %v, got %v", want, got)
+		}
+		for _, id := range []string{"math", "prog", defaultSessionID, ""} {
+			if !client.HasSession(id) {
+				t.Errorf("Expected HasSession(%q) to be true", id)
+			}
+		}
+		if client.HasSession("unknown") {
+			t.Error("Expected HasSession(unknown) to be false")
+		}
+
+		// The returned slice is a copy
+		client.ActiveSessions()[0] = "mutated"
+		if client.ActiveSessions()[0] != "math" {
+			t.Error("Expected ActiveSessions to return a copy")
+		}
+	})
+
+	t.Run("reset_and_stream_sessions", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Query(ctx, "before"))
+		assertNoError(t, client.Reset(ctx))
+		if client.HasSession("") {
+			t.Error("Expected the fresh default session to be unused after Reset")
+		}
+		assertNoError(t, client.Query(ctx, "after"))
+		if !client.HasSession("") || len(client.ActiveSessions()) != 2 {
+			t.Errorf("Expected the reset session to be tracked, got %v", client.ActiveSessions())
+		}
+
+		messages := make(chan StreamMessage, 1)
+		messages <- StreamMessage{Type: "user", SessionID: "streamed"}
+		close(messages)
+		assertNoError(t, client.QueryStream(ctx, messages))
+
+		deadline := time.Now().Add(2 * time.Second)
+		for !client.HasSession("streamed") && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if !client.HasSession("streamed") {
+			t.Error("Expected QueryStream session to be tracked")
+		}
+	})
+
+	t.Run("failed_send_not_tracked", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		transport.sendError = fmt.Errorf("broken pipe")
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		if err := client.QueryWithSession(ctx, "hello", "s1"); err == nil {
+			t.Fatal("Expected send error")
+		}
+		if client.HasSession("s1") {
+			t.Error("Expected failed send not to create a session")
+		}
+	})
+
+	t.Run("reconnect_clears_sessions", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.QueryWithSession(ctx, "hello", "s1"))
+		assertNoError(t, client.Disconnect())
+		connectClientSafely(ctx, t, client)
+
+		if client.HasSession("s1") || len(client.ActiveSessions()) != 0 {
+			t.Errorf("Expected no sessions after reconnecting, got %v", client.ActiveSessions())
+		}
+	})
+}
+
+// TestClientSendUserMessage tests a fully formed user message is serialized
+// with its own blocks and metadata
+func TestClientQueueInput(t *testing.T) {
+	t.Run("sent_as_a_queued_turn", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Query(ctx, "Refactor the parser"))
+		assertNoError(t, client.QueueInput(ctx, "Keep the public API unchanged"))
+
+		// The input goes through SendMessage so the transport tracks it as a turn
+		if count := transport.getSentMessageCount(); count != 2 {
+			t.Fatalf("Expected 2 sent messages, got %d", count)
+		}
+		input, _ := transport.getSentMessage(1)
+		if input.QueryID != "" || input.SessionID != defaultSessionID {
+			t.Errorf("Expected input in the default session without a query ID, got %+v", input)
+		}
+		if content := input.Message.(map[string]interface{})["content"]; content != "Keep the public API unchanged" {
+			t.Errorf("Unexpected input content: %v", content)
+		}
+
+		// The CLI answers the query, then the queued input
+		for _, text := range []string{"Refactored.", "Understood, keeping the public API unchanged."} {
+			transport.injectTestMessage(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: text}}})
+			transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "default"})
+		}
+		for _, want := range []string{"Refactored.", "public API"} {
+			messages, match, err := client.ReceiveUntil(ctx, func(msg Message) bool {
+				_, ok := msg.(*ResultMessage)
+				return ok
+			})
+			assertNoError(t, err)
+			if match == nil || len(messages) != 1 {
+				t.Fatalf("Expected a reply then its result, got %d messages and %v", len(messages), match)
+			}
+			if text := messages[0].(*AssistantMessage).Content[0].(*TextBlock).Text; !strings.Contains(text, want) {
+				t.Errorf("Expected reply containing %q, got %q", want, text)
+			}
+		}
+	})
+
+	t.Run("uses_current_session", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Reset(ctx))
+		assertNoError(t, client.QueueInput(ctx, "More detail please"))
+
+		got, _ := transport.getSentMessage(1)
+		if got.SessionID == defaultSessionID || !strings.HasPrefix(got.SessionID, "session_") {
+			t.Errorf("Expected the reset session ID, got %q", got.SessionID)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		assertClientError(t, client.QueueInput(ctx, "hello"), true, "client not connected")
+
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		assertClientError(t, client.QueueInput(ctx, ""), true, "input text is required")
+
+		cancelled, cancelNow := context.WithCancel(ctx)
+		cancelNow()
+		if err := client.QueueInput(cancelled, "hello"); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+// TestClientRateLimiter tests queries are spaced per the configured rate and
+// burst, and that a query waiting for its turn honors context cancellation
+func TestClientRateLimiter(t *testing.T) {
+	startQuery := func(ctx context.Context, client Client, prompt string) <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- client.Query(ctx, prompt) }()
+		return done
+	}
+	assertWaiting := func(t *testing.T, done <-chan error) {
+		t.Helper()
+		select {
+		case err := <-done:
+			t.Fatalf("Expected query to wait for its turn, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	assertSent := func(t *testing.T, done <-chan error) {
+		t.Helper()
+		select {
+		case err := <-done:
+			assertNoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected query to be sent")
+		}
+	}
+
+	t.Run("spaced_per_rate", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithRateLimiter(2, 1), WithClock(clock))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Query(ctx, "first"))
+
+		second := startQuery(ctx, client, "second")
+		clock.BlockUntil(1) // Waiting for the next token
+		clock.Advance(499 * time.Millisecond)
+		assertWaiting(t, second)
+		if count := transport.getSentMessageCount(); count != 1 {
+			t.Errorf("Expected 1 query sent before the interval, got %d", count)
+		}
+
+		clock.Advance(time.Millisecond)
+		assertSent(t, second)
+
+		// QueryWithSession shares the same bucket
+		third := make(chan error, 1)
+		go func() { third <- client.QueryWithSession(ctx, "third", "other") }()
+		clock.BlockUntil(1)
+		clock.Advance(500 * time.Millisecond)
+		assertSent(t, third)
+		if count := transport.getSentMessageCount(); count != 3 {
+			t.Errorf("Expected 3 queries sent, got %d", count)
+		}
+	})
+
+	t.Run("burst_sent_immediately", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithRateLimiter(1, 3), WithClock(clock))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		for i := 0; i < 3; i++ {
+			assertNoError(t, client.Query(ctx, fmt.Sprintf("burst %d", i)))
+		}
+		fourth := startQuery(ctx, client, "fourth")
+		clock.BlockUntil(1)
+		assertWaiting(t, fourth)
+		clock.Advance(time.Second)
+		assertSent(t, fourth)
+	})
+
+	t.Run("cancelled_while_waiting", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithRateLimiter(1, 1), WithClock(clock))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.Query(ctx, "first"))
+
+		queryCtx, queryCancel := context.WithCancel(ctx)
+		waiting := startQuery(queryCtx, client, "abandoned")
+		clock.BlockUntil(1)
+		queryCancel()
+		select {
+		case err := <-waiting:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the waiting query to return on cancellation")
+		}
+		if count := transport.getSentMessageCount(); count != 1 {
+			t.Errorf("Expected the cancelled query not to be sent, got %d sent", count)
+		}
+
+		// The abandoned query gave its token back
+		clock.Advance(time.Second)
+		assertNoError(t, client.Query(ctx, "next"))
+	})
+}
+
+// TestClientSessionStore tests the session ID is saved when the CLI reports
+// it and resumed from the store on the next Connect
+func TestClientSessionStore(t *testing.T) {
+	receiveResult := func(ctx context.Context, t *testing.T, client Client) {
+		t.Helper()
+		_, match, err := client.ReceiveUntil(ctx, func(msg Message) bool {
+			_, ok := msg.(*ResultMessage)
+			return ok
+		})
+		assertNoError(t, err)
+		if match == nil {
+			t.Fatal("Expected a result message")
+		}
+	}
+	resumeOf := func(client Client) string {
+		impl := client.(*ClientImpl)
+		impl.mu.RLock()
+		defer impl.mu.RUnlock()
+		if resume := impl.transportOptions().Resume; resume != nil {
+			return *resume
+		}
+		return ""
+	}
+
+	t.Run("saves_and_resumes", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		first := NewClientWithTransport(newClientMockTransport(), WithSessionStore(store, "user-1"))
+		connectClientSafely(ctx, t, first)
+		if resume := resumeOf(first); resume != "" {
+			t.Errorf("Expected no resume with an empty store, got %q", resume)
+		}
+
+		transport := first.(*ClientImpl).transport.(*clientMockTransport)
+		transport.injectTestMessage(&SystemMessage{Subtype: "init", Data: map[string]any{"session_id": "sess-1"}})
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "sess-1"})
+		receiveResult(ctx, t, first)
+		disconnectClientSafely(t, first)
+
+		if got := store.get("user-1"); got != "sess-1" {
+			t.Fatalf("Expected sess-1 to be saved, got %q", got)
+		}
+		if saves := store.saveCount(); saves != 1 {
+			t.Errorf("Expected an unchanged session ID to be saved once, got %d saves", saves)
+		}
+
+		second := NewClientWithTransport(newClientMockTransport(), WithSessionStore(store, "user-1"))
+		connectClientSafely(ctx, t, second)
+		defer disconnectClientSafely(t, second)
+		if resume := resumeOf(second); resume != "sess-1" {
+			t.Errorf("Expected the new client to resume sess-1, got %q", resume)
+		}
+		if resume := second.(*ClientImpl).options.Resume; resume != nil {
+			t.Errorf("Expected the client's Options to be left unchanged, got Resume %q", *resume)
+		}
+	})
+
+	t.Run("reconnect_resumes_latest_session", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		store.sessions["user-1"] = "sess-1"
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithSessionStore(store, "user-1"))
+		connectClientSafely(ctx, t, client)
+		if resume := resumeOf(client); resume != "sess-1" {
+			t.Fatalf("Expected to resume sess-1, got %q", resume)
+		}
+
+		// The CLI reports a new session, e.g. after forking
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "sess-2"})
+		receiveResult(ctx, t, client)
+		disconnectClientSafely(t, client)
+
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		if resume := resumeOf(client); resume != "sess-2" {
+			t.Errorf("Expected reconnect to resume sess-2, got %q", resume)
+		}
+	})
+
+	t.Run("explicit_resume_wins", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		store.sessions["user-1"] = "sess-stored"
+		client := NewClientWithTransport(newClientMockTransport(),
+			WithSessionStore(store, "user-1"), WithResume("sess-explicit"))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		if resume := resumeOf(client); resume != "sess-explicit" {
+			t.Errorf("Expected the explicit session to be resumed, got %q", resume)
+		}
+	})
+
+	t.Run("reset_saves_cleared_session", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithSessionStore(store, "user-1"))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "sess-1"})
+		receiveResult(ctx, t, client)
+		assertNoError(t, client.Reset(ctx))
+
+		// The mock CLI reports a new session for the cleared conversation
+		if got := store.get("user-1"); got != "cleared" {
+			t.Errorf("Expected the cleared session to be saved, got %q", got)
+		}
+	})
+
+	t.Run("reset_discards_unchanged_session", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithSessionStore(store, "user-1"))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		// The CLI keeps reporting the session ID it had before the clear
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "cleared"})
+		receiveResult(ctx, t, client)
+		assertNoError(t, client.Reset(ctx))
+		if got := store.get("user-1"); got != "" {
+			t.Errorf("Expected Reset to delete the stored session, got %q", got)
+		}
+
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "cleared"})
+		receiveResult(ctx, t, client)
+		if got := store.get("user-1"); got != "" {
+			t.Errorf("Expected the reset session not to be saved again, got %q", got)
+		}
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "sess-2"})
+		receiveResult(ctx, t, client)
+		if got := store.get("user-1"); got != "sess-2" {
+			t.Errorf("Expected sess-2 to be saved, got %q", got)
+		}
+	})
+
+	t.Run("load_error_fails_connect", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		store.loadErr = errors.New("redis unavailable")
+		client := NewClientWithTransport(newClientMockTransport(), WithSessionStore(store, "user-1"))
+		err := client.Connect(ctx)
+		assertClientError(t, err, true, "failed to load session from store")
+		if !errors.Is(err, store.loadErr) {
+			t.Errorf("Expected the store error to be wrapped, got %v", err)
+		}
+	})
+
+	t.Run("save_error_delivered", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		store := newMemorySessionStore()
+		store.saveErr = errors.New("redis unavailable")
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithSessionStore(store, "user-1"))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: "sess-1"})
+		iter := client.ReceiveResponse(ctx)
+		var err error
+		for i := 0; i < 2 && err == nil; i++ {
+			_, err = iter.Next(ctx)
+		}
+		if !errors.Is(err, store.saveErr) {
+			t.Errorf("Expected the save error to be delivered, got %v", err)
+		}
+	})
+}
+
+// memorySessionStore is an in-memory SessionStore for tests.
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]string
+	saves    int
+	loadErr  error
+	saveErr  error
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]string)}
+}
+
+func (s *memorySessionStore) Save(_ context.Context, key, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.sessions[key] = sessionID
+	s.saves++
+	return nil
+}
+
+func (s *memorySessionStore) Load(_ context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loadErr != nil {
+		return "", false, s.loadErr
+	}
+	sessionID, found := s.sessions[key]
+	return sessionID, found, nil
+}
+
+func (s *memorySessionStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+	return nil
+}
+
+func (s *memorySessionStore) get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[key]
+}
+
+func (s *memorySessionStore) saveCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+func TestClientSendUserMessage(t *testing.T) {
+	t.Run("mixed_blocks_serialized", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		uuid := "msg-uuid-1"
+		parent := "toolu_parent"
+		isError := true
+		err := client.SendUserMessage(ctx, &UserMessage{
+			Content: []ContentBlock{
+				&ToolResultBlock{ToolUseID: "toolu_01", Content: "exit 1", IsError: &isError},
+				&TextBlock{Text: "Fix the build."},
+				&ToolUseBlock{ToolUseID: "toolu_02", Name: "Bash", Input: map[string]any{"command": "make"}},
+			},
+			UUID:            &uuid,
+			ParentToolUseID: &parent,
+		})
+		assertNoError(t, err)
+
+		sent, ok := transport.getSentMessage(0)
+		if !ok {
+			t.Fatal("Expected a sent message")
+		}
+		data, err := json.Marshal(sent)
+		assertNoError(t, err)
+
+		var got map[string]any
+		assertNoError(t, json.Unmarshal(data, &got))
+		var want map[string]any
+		assertNoError(t, json.Unmarshal([]byte(`{
+			"type": "user",
+			"message": {"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_01", "content": "exit 1", "is_error": true},
+				{"type": "text", "text": "Fix the build."},
+				{"type": "tool_use", "id": "toolu_02", "name": "Bash", "input": {"command": "make"}}
+			]},
+			"parent_tool_use_id": "toolu_parent",
+			"session_id": "default",
+			"uuid": "msg-uuid-1"
+		}`), &want))
+
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("Serialized message mismatch:\ngot:  %s\nwant: %s", gotJSON, wantJSON)
+		}
+		if !client.HasSession("") {
+			t.Error("Expected default session to be tracked")
+		}
+	})
+
+	t.Run("string_content_unchanged", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithRequestInterceptor(func(string) (string, error) {
+			return "rewritten", nil
+		}))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertNoError(t, client.SendUserMessage(ctx, &UserMessage{Content: "as written"}))
+		sent, _ := transport.getSentMessage(0)
+		message := sent.Message.(map[string]interface{})
+		if message["content"] != "as written" {
+			t.Errorf("Expected content sent as given, got %v", message["content"])
+		}
+	})
+
+	t.Run("invalid_messages", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := setupClientForTest(t, transport)
+
+		assertClientError(t, client.SendUserMessage(ctx, &UserMessage{Content: "hi"}), true, "client not connected")
+
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		assertClientError(t, client.SendUserMessage(ctx, nil), true, "user message is required")
+		assertClientError(t, client.SendUserMessage(ctx, &UserMessage{}), true, "user message content is required")
+		assertClientError(t, client.SendUserMessage(ctx, &UserMessage{Content: []ContentBlock{nil}}),
+			true, "user message content block 0 is nil")
+		if transport.getSentMessageCount() != 0 {
+			t.Errorf("Expected nothing sent for invalid messages, got %d", transport.getSentMessageCount())
+		}
+	})
+}
+
+// TestClientLargePromptFiles tests oversized prompts are saved to files that
+// are referenced in the sent prompt and removed once their turn ends, or on
+// Disconnect
+func TestClientLargePromptFiles(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	oversized := strings.Repeat("large prompt ", 10)
+	transport := newClientMockTransport()
+	client := NewClientWithTransport(transport, WithLargePromptHandling(32, LargePromptStrategyFile))
+	connectClientSafely(ctx, t, client)
+
+	assertNoError(t, client.Query(ctx, oversized))
+	assertNoError(t, client.Query(ctx, "small prompt"))
+	assertNoError(t, client.Query(ctx, oversized))
+
+	transport.mu.Lock()
+	sent := append([]StreamMessage(nil), transport.sentMessages...)
+	transport.mu.Unlock()
+	if len(sent) != 3 {
+		t.Fatalf("Expected 3 sent messages, got %d", len(sent))
+	}
+	if content := sent[1].Message.(map[string]interface{})["content"]; content != "small prompt" {
+		t.Errorf("Expected small prompt unchanged, got %q", content)
+	}
+
+	clientImpl := client.(*ClientImpl)
+	clientImpl.mu.RLock()
+	queue := clientImpl.turns
+	clientImpl.mu.RUnlock()
+	queue.mu.Lock()
+	var pending []string
+	for _, turn := range queue.turns {
+		pending = append(pending, turn.promptFile)
+	}
+	queue.mu.Unlock()
+	if len(pending) != 3 || pending[0] == "" || pending[1] != "" || pending[2] == "" {
+		t.Fatalf("Expected files for the first and third turns, got %q", pending)
+	}
+	for i, path := range []string{pending[0], pending[2]} {
+		content := sent[i*2].Message.(map[string]interface{})["content"].(string)
+		if !strings.Contains(content, path) {
+			t.Errorf("Expected sent prompt to reference %s, got %q", path, content)
+		}
+		saved, err := os.ReadFile(path)
+		assertNoError(t, err)
+		if string(saved) != oversized {
+			t.Errorf("Expected prompt file to hold the original prompt, got %q", saved)
+		}
+	}
+
+	// The first turn's result removes only its file
+	transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: defaultSessionID})
+	if _, err := client.ReceiveResponse(ctx).Next(ctx); err != nil {
+		t.Fatalf("Expected the first turn's result, got %v", err)
+	}
+	if _, err := os.Stat(pending[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected the first prompt file removed with its result, got %v", err)
+	}
+	if _, err := os.Stat(pending[2]); err != nil {
+		t.Errorf("Expected the pending turn's prompt file kept, got %v", err)
+	}
+
+	assertNoError(t, client.Disconnect())
+	if _, err := os.Stat(pending[2]); !os.IsNotExist(err) {
+		t.Errorf("Expected prompt file removed on Disconnect, got %v", err)
+	}
+}
+
+// TestClientTurnAnsweredBeforeSendReturns tests a turn whose result is
+// handled before SendMessage returns still removes its prompt file, and
+// later turns are attributed to their own results
+func TestClientTurnAnsweredBeforeSendReturns(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	oversized := strings.Repeat("large prompt ", 10)
+	var ended []*ResultMessage
+	transport := newAnsweringMockTransport()
+	client := NewClientWithTransport(transport,
+		WithLargePromptHandling(32, LargePromptStrategyFile),
+		WithTurnCallback(nil, func(result *ResultMessage) { ended = append(ended, result) }),
+	)
+	connectClientSafely(ctx, t, client)
+	defer disconnectClientSafely(t, client)
+
+	var promptFile string
+	transport.answer = func(msg StreamMessage) {
+		content, _ := msg.Message.(map[string]interface{})["content"].(string)
+		if content == clearCommand {
+			return // Answered by the mock itself
+		}
+		queue := client.(*ClientImpl).turns
+		queue.mu.Lock()
+		if promptFile == "" && len(queue.turns) == 1 {
+			promptFile = queue.turns[0].promptFile
+		}
+		queue.mu.Unlock()
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: defaultSessionID, Result: &content})
+		select {
+		case <-client.ReceiveMessages(ctx):
+		case <-time.After(2 * time.Second):
+			t.Error("Timed out waiting for the turn's result")
+		}
+	}
+
+	assertNoError(t, client.Query(ctx, oversized))
+	if promptFile == "" {
+		t.Fatal("Expected the large prompt sent as a file")
+	}
+	if _, err := os.Stat(promptFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the prompt file removed with its result, got %v", err)
+	}
+
+	// The internal clear turn is not reported, and the next query's is
+	assertNoError(t, client.Reset(ctx))
+	assertNoError(t, client.Query(ctx, "small prompt"))
+	if len(ended) != 2 || *ended[1].Result != "small prompt" {
+		t.Errorf("Expected the large and small prompt turns reported, got %d results", len(ended))
+	}
+}
+
+// TestClientDisconnectCallback tests the disconnect callback fires once with
+// the reason the connection ended
+func TestClientDisconnectCallback(t *testing.T) {
+	// recordReasons returns a callback that sends each reason to the channel
+	recordReasons := func() (func(error), chan error) {
+		reasons := make(chan error, 4)
+		return func(reason error) { reasons <- reason }, reasons
+	}
+	// endStream closes the mock's channels as if the CLI had exited
+	endStream := func(transport *clientMockTransport) {
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		close(transport.msgChan)
+		close(transport.errChan)
+		transport.msgChan, transport.errChan = nil, nil
+	}
+	expectReason := func(t *testing.T, reasons chan error) error {
+		t.Helper()
+		select {
+		case reason := <-reasons:
+			return reason
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for disconnect callback")
+			return nil
+		}
+	}
+	expectNoMoreReasons := func(t *testing.T, reasons chan error) {
+		t.Helper()
+		select {
+		case reason := <-reasons:
+			t.Errorf("Expected callback to fire once, fired again with %v", reason)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	t.Run("clean_disconnect", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		callback, reasons := recordReasons()
+		transport := newClientMockTransportWithOptions(WithClientResponseMessages([]Message{
+			&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "hi"}}, Model: testModelSonnet},
+		}))
+		client := NewClientWithTransport(transport, WithDisconnectCallback(callback))
+		connectClientSafely(ctx, t, client)
+
+		// Messages still reach the caller through the watcher
+		msg, err := client.ReceiveResponse(ctx).Next(ctx)
+		assertNoError(t, err)
+		if _, ok := msg.(*AssistantMessage); !ok {
+			t.Errorf("Expected *AssistantMessage, got %T", msg)
+		}
+
+		assertNoError(t, client.Disconnect())
+		// Disconnect waits for the callback, so the reason is already sent
+		select {
+		case reason := <-reasons:
+			if reason != nil {
+				t.Errorf("Expected nil reason for Disconnect, got %v", reason)
+			}
+		default:
+			t.Fatal("Expected callback to run before Disconnect returned")
+		}
+		assertNoError(t, client.Disconnect())
+		expectNoMoreReasons(t, reasons)
+	})
+
+	t.Run("error_disconnect", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		callback, reasons := recordReasons()
+		processErr := NewProcessError("CLI crashed", 1, "fatal")
+		transport := newMockTransportWithError("async", processErr)
+		client := NewClientWithTransport(transport, WithDisconnectCallback(callback))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		// The error is still delivered to the caller
+		if _, err := client.ReceiveResponse(ctx).Next(ctx); !errors.Is(err, processErr) {
+			t.Errorf("Expected iterator to return the process error, got %v", err)
+		}
+
+		endStream(transport)
+		if reason := expectReason(t, reasons); !errors.Is(reason, processErr) {
+			t.Errorf("Expected reason to be the process error, got %v", reason)
+		}
+		assertNoError(t, client.Disconnect())
+		expectNoMoreReasons(t, reasons)
+	})
+
+	t.Run("cli_exit_without_error", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		callback, reasons := recordReasons()
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithDisconnectCallback(callback))
+		defer disconnectClientSafely(t, client)
+		connectClientSafely(ctx, t, client)
+
+		endStream(transport)
+		if reason := expectReason(t, reasons); !IsConnectionError(reason) {
+			t.Errorf("Expected *ConnectionError, got %v", reason)
+		}
+	})
+
+	t.Run("context_cancel", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		callback, reasons := recordReasons()
+		connectCtx, cancelConnect := context.WithCancel(ctx)
+		client := NewClientWithTransport(newClientMockTransport(), WithDisconnectCallback(callback))
+		connectClientSafely(connectCtx, t, client)
+
+		cancelConnect()
+		if reason := expectReason(t, reasons); !errors.Is(reason, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", reason)
+		}
+		assertNoError(t, client.Disconnect())
+		expectNoMoreReasons(t, reasons)
+	})
+
+	t.Run("callback_panic_recovered", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := NewClientWithTransport(newClientMockTransport(),
+			WithDisconnectCallback(func(error) { panic("callback bug") }))
+		connectClientSafely(ctx, t, client)
+		assertNoError(t, client.Disconnect())
+	})
+
+	t.Run("disconnect_from_callback", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		reasons := make(chan error, 4)
+		disconnected := make(chan error, 1)
+		var client Client
+		transport := newClientMockTransport()
+		client = NewClientWithTransport(transport, WithDisconnectCallback(func(reason error) {
+			disconnected <- client.Disconnect()
+			reasons <- reason
+		}))
+		connectClientSafely(ctx, t, client)
+
+		// The CLI stops and the callback cleans up by disconnecting
+		endStream(transport)
+		if reason := expectReason(t, reasons); !IsConnectionError(reason) {
+			t.Errorf("Expected *ConnectionError, got %v", reason)
+		}
+		assertNoError(t, <-disconnected)
+		if err := client.Query(ctx, "hello"); err == nil {
+			t.Error("Expected client disconnected by the callback")
+		}
+
+		// Cancelling the Connect context calls the callback from another goroutine
+		connectCtx, cancelConnect := context.WithCancel(ctx)
+		connectClientSafely(connectCtx, t, client)
+		cancelConnect()
+		if reason := expectReason(t, reasons); !errors.Is(reason, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", reason)
+		}
+		assertNoError(t, <-disconnected)
+		expectNoMoreReasons(t, reasons)
+	})
+
+	t.Run("fires_per_connection", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		callback, reasons := recordReasons()
+		client := NewClientWithTransport(newClientMockTransport(), WithDisconnectCallback(callback))
+		for i := 0; i < 2; i++ {
+			connectClientSafely(ctx, t, client)
+			assertNoError(t, client.Disconnect())
+			if reason := expectReason(t, reasons); reason != nil {
+				t.Errorf("Connection %d: expected nil reason, got %v", i, reason)
+			}
+		}
+	})
+}
+
+// diagnosticsMockTransport adds the CLI details reported by the subprocess
+// transport to the client mock
+type diagnosticsMockTransport struct {
+	*clientMockTransport
+	version string
+	stderr  []string
+}
+
+func (d *diagnosticsMockTransport) CLIVersion() string     { return d.version }
+func (d *diagnosticsMockTransport) RecentStderr() []string { return d.stderr }
+
+func TestClientDiagnosticSnapshot(t *testing.T) {
+	t.Run("connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		mock := newClientMockTransport()
+		mock.validator = NewStreamValidator()
+		mock.validator.TrackMessage(&AssistantMessage{
+			Content: []ContentBlock{&ToolUseBlock{ToolUseID: "tool-1", Name: "Read"}},
+			Model:   testModelSonnet,
+		})
+		mock.validator.MarkStreamEnd()
+		transport := &diagnosticsMockTransport{
+			clientMockTransport: mock,
+			version:             "2.3.4",
+			stderr:              []string{"warming up", "ready"},
+		}
+
+		captured := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		client := NewClientWithTransport(transport, WithClock(claudecodetest.NewFakeClock(captured)))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		diag, err := client.DiagnosticSnapshot(ctx)
+		assertNoError(t, err)
+
+		if !diag.CapturedAt.Equal(captured) {
+			t.Errorf("Expected CapturedAt %v, got %v", captured, diag.CapturedAt)
+		}
+		if !diag.Connected {
+			t.Error("Expected Connected to be true")
+		}
+		if diag.ServerInfo["transport_type"] != "subprocess" {
+			t.Errorf("Expected server info, got %v", diag.ServerInfo)
+		}
+		if diag.StreamStats.ToolsRequested != 1 || !diag.StreamStats.StreamEnded {
+			t.Errorf("Expected stream stats from the validator, got %+v", diag.StreamStats)
+		}
+		if len(diag.StreamIssues) == 0 || diag.StreamIssues[0].Type != "missing_tool_result" {
+			t.Errorf("Expected missing_tool_result issue, got %+v", diag.StreamIssues)
+		}
+		if !reflect.DeepEqual(diag.RecentStderr, []string{"warming up", "ready"}) {
+			t.Errorf("Expected recent stderr from the transport, got %q", diag.RecentStderr)
+		}
+		if diag.CLIVersion != "2.3.4" {
+			t.Errorf("Expected CLI version 2.3.4, got %q", diag.CLIVersion)
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		diag, err := client.DiagnosticSnapshot(ctx)
+		assertNoError(t, err)
+
+		if diag.Connected || diag.ServerInfo != nil {
+			t.Errorf("Expected disconnected report without server info, got %+v", diag)
+		}
+		if diag.CLIVersion != "" || diag.RecentStderr != nil {
+			t.Errorf("Expected no CLI details without a transport, got %+v", diag)
+		}
+	})
+
+	t.Run("context_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		if _, err := client.DiagnosticSnapshot(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+// TestClientNilOptions tests a client built without options connects and
+// reports stats and diagnostics using the system clock
+func TestClientNilOptions(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	before := time.Now()
+	client := &ClientImpl{customTransport: newClientMockTransport()}
+	connectClientSafely(ctx, t, client)
+	defer disconnectClientSafely(t, client)
+
+	if since := client.Stats().ConnectedSince; since.Before(before) {
+		t.Errorf("Expected stats from the system clock, got %v", since)
+	}
+	diag, err := client.DiagnosticSnapshot(ctx)
+	assertNoError(t, err)
+	if diag.CapturedAt.Before(before) {
+		t.Errorf("Expected the snapshot time from the system clock, got %v", diag.CapturedAt)
+	}
+}
+
+// TestClientStats tests cumulative counts across several turns
+func TestClientStats(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	connectedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock := newClientMockTransport()
+	client := NewClientWithTransport(mock, WithClock(claudecodetest.NewFakeClock(connectedAt)))
+	if stats := client.Stats(); stats != (ClientStats{}) {
+		t.Errorf("Expected zero stats before Connect, got %+v", stats)
+	}
+	connectClientSafely(ctx, t, client)
+
+	errResult := "Reached max turns"
+	turns := [][]Message{
+		{
+			&AssistantMessage{
+				Content: []ContentBlock{
+					&ToolUseBlock{ToolUseID: "tool-1", Name: "Read"},
+					&ToolUseBlock{ToolUseID: "tool-2", Name: "Grep"},
+				},
+				Model: testModelSonnet,
+			},
+			&UserMessage{Content: []ContentBlock{&ToolResultBlock{ToolUseID: "tool-1"}}},
+			&ResultMessage{Subtype: "success", SessionID: "s1"},
+		},
+		{
+			&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "done"}}, Model: testModelSonnet},
+			&ResultMessage{Subtype: "success", SessionID: "s1"},
+		},
+		{
+			&AssistantMessage{
+				Content: []ContentBlock{&ToolUseBlock{ToolUseID: "tool-3", Name: "Bash"}},
+				Model:   testModelSonnet,
+			},
+			&ResultMessage{Subtype: "error_max_turns", IsError: true, Result: &errResult, SessionID: "s1"},
+		},
+	}
+	for i, turn := range turns {
+		assertNoError(t, client.Query(ctx, fmt.Sprintf("turn %d", i)))
+		for _, msg := range turn {
+			mock.injectTestMessage(msg)
+		}
+		iter := client.ReceiveResponse(ctx)
+		for {
+			msg, err := iter.Next(ctx)
+			if err != nil {
+				break
+			}
+			if _, ok := msg.(*ResultMessage); ok {
+				break
+			}
+		}
+	}
+
+	// Errors from the error channel are counted when read
+	mock.errChan <- fmt.Errorf("stream hiccup")
+	select {
+	case <-client.(*ClientImpl).errChan:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for stream error")
+	}
+
+	expected := ClientStats{
+		ConnectedSince: connectedAt,
+		TurnsCompleted: 3,
+		Messages:       7,
+		ToolUses:       3,
+		Errors:         2,
+	}
+	if stats := client.Stats(); stats != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+
+	// Counts stay readable after Disconnect and restart on Connect
+	disconnectClientSafely(t, client)
+	if stats := client.Stats(); stats != expected {
+		t.Errorf("Expected stats %+v after Disconnect, got %+v", expected, stats)
+	}
+	connectClientSafely(ctx, t, client)
+	defer disconnectClientSafely(t, client)
+	if stats := client.Stats(); stats != (ClientStats{ConnectedSince: connectedAt}) {
+		t.Errorf("Expected counts to restart on Connect, got %+v", stats)
+	}
+}
+
+// TestClientMaxIdleTime tests an unused client disconnects after its idle
+// limit and reports an IdleDisconnectError until it reconnects
+func TestClientMaxIdleTime(t *testing.T) {
+	const maxIdle = 10 * time.Minute
+
+	// waitForIdleDisconnect polls, without counting as activity, until the
+	// client reports it is disconnected
+	waitForIdleDisconnect := func(ctx context.Context, t *testing.T, client Client) error {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if _, err := client.GetServerInfo(ctx); err != nil {
+				return err
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatal("Timed out waiting for idle disconnect")
+		return nil
+	}
+
+	t.Run("disconnects_after_idle", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		reasons := make(chan error, 2)
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport,
+			WithMaxIdleTime(maxIdle),
+			WithClock(clock),
+			WithDisconnectCallback(func(reason error) { reasons <- reason }),
+		)
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		clock.BlockUntil(1)
+		clock.Advance(maxIdle)
+
+		err := waitForIdleDisconnect(ctx, t, client)
+		if !IsIdleDisconnectError(err) {
+			t.Fatalf("Expected IdleDisconnectError, got %v", err)
+		}
+		if idleErr := AsIdleDisconnectError(err); idleErr.MaxIdleTime != maxIdle {
+			t.Errorf("Expected MaxIdleTime %v, got %v", maxIdle, idleErr.MaxIdleTime)
+		}
+		transport.mu.Lock()
+		closed := transport.closed
+		transport.mu.Unlock()
+		if !closed {
+			t.Error("Expected the transport to be closed")
+		}
+		select {
+		case reason := <-reasons:
+			if !IsIdleDisconnectError(reason) {
+				t.Errorf("Expected idle disconnect reason, got %v", reason)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for disconnect callback")
+		}
+		if err := client.Query(ctx, "hello"); !IsIdleDisconnectError(err) {
+			t.Errorf("Expected IdleDisconnectError from Query, got %v", err)
+		}
+
+		// Reconnecting clears the idle state
+		connectClientSafely(ctx, t, client)
+		assertNoError(t, client.Query(ctx, "hello again"))
+	})
+
+	t.Run("activity_postpones_disconnect", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithMaxIdleTime(maxIdle), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		clock.BlockUntil(1)
+		clock.Advance(maxIdle / 2)
+		assertNoError(t, client.Query(ctx, "still here"))
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: defaultSessionID})
+		if _, err := client.ReceiveResponse(ctx).Next(ctx); err != nil {
+			t.Fatalf("Expected the turn's result, got %v", err)
+		}
+
+		// The first deadline passes, but the turn restarted the idle time
+		clock.Advance(maxIdle / 2)
+		clock.BlockUntil(1)
+		assertNoError(t, client.Query(ctx, "and again"))
+		assertClientMessageCount(t, transport, 2)
+	})
+
+	t.Run("silent_turn_is_not_idle", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithMaxIdleTime(maxIdle), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		// A long tool run or a slow permission answer sends nothing for a while
+		clock.BlockUntil(1)
+		assertNoError(t, client.Query(ctx, "run the full test suite"))
+		clock.Advance(3 * maxIdle)
+		clock.BlockUntil(0)
+		if _, err := client.GetServerInfo(ctx); err != nil {
+			t.Fatalf("Expected the client connected during the turn, got %v", err)
+		}
+
+		// The idle time restarts when the turn's result arrives
+		transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: defaultSessionID})
+		if _, err := client.ReceiveResponse(ctx).Next(ctx); err != nil {
+			t.Fatalf("Expected the turn's result, got %v", err)
+		}
+		clock.BlockUntil(1)
+		clock.Advance(maxIdle)
+		if err := waitForIdleDisconnect(ctx, t, client); !IsIdleDisconnectError(err) {
+			t.Fatalf("Expected IdleDisconnectError after the turn, got %v", err)
+		}
+	})
+
+	t.Run("result_before_send_returns", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newAnsweringMockTransport()
+		client := NewClientWithTransport(transport, WithMaxIdleTime(maxIdle), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		// The turn's result is handled before SendMessage returns
+		transport.answer = func(StreamMessage) {
+			transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: defaultSessionID})
+			select {
+			case <-client.ReceiveMessages(ctx):
+			case <-time.After(2 * time.Second):
+				t.Error("Timed out waiting for the turn's result")
+			}
+		}
+		clock.BlockUntil(1)
+		assertNoError(t, client.Query(ctx, "quick question"))
+
+		// The turn ended, so the idle time runs again
+		waitForWaiters(t, clock, 1)
+		clock.Advance(maxIdle)
+		if err := waitForIdleDisconnect(ctx, t, client); !IsIdleDisconnectError(err) {
+			t.Fatalf("Expected IdleDisconnectError after the turn, got %v", err)
+		}
+	})
+
+	t.Run("failed_send_is_not_a_turn", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithMaxIdleTime(maxIdle), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		clock.BlockUntil(1)
+		transport.mu.Lock()
+		transport.sendError = errors.New("broken pipe")
+		transport.mu.Unlock()
+		if err := client.Query(ctx, "lost question"); err == nil {
+			t.Fatal("Expected the send to fail")
+		}
+
+		waitForWaiters(t, clock, 1)
+		clock.Advance(maxIdle)
+		if err := waitForIdleDisconnect(ctx, t, client); !IsIdleDisconnectError(err) {
+			t.Fatalf("Expected IdleDisconnectError after the failed send, got %v", err)
+		}
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := setupClientForTest(t, newClientMockTransport())
+		connectClientSafely(ctx, t, client)
+		assertNoError(t, client.Disconnect())
+
+		err := client.Query(ctx, "hello")
+		if err == nil || IsIdleDisconnectError(err) {
+			t.Errorf("Expected plain not connected error, got %v", err)
+		}
+	})
+}
+
+// waitForWaiters polls until clock has n pending timers and tickers.
+func waitForWaiters(t *testing.T, clock *claudecodetest.FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for clock.Waiters() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d clock waiters, got %d", n, clock.Waiters())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// answeringMockTransport is a client mock that calls answer with each sent
+// message before SendMessage returns, like a CLI answering faster than the
+// client finishes sending.
+type answeringMockTransport struct {
+	*clientMockTransport
+	answer func(StreamMessage)
+}
+
+func newAnsweringMockTransport() *answeringMockTransport {
+	return &answeringMockTransport{clientMockTransport: newClientMockTransport()}
+}
+
+func (m *answeringMockTransport) SendMessage(ctx context.Context, message StreamMessage) error {
+	if err := m.clientMockTransport.SendMessage(ctx, message); err != nil {
+		return err
+	}
+	if m.answer != nil {
+		m.answer(message)
+	}
+	return nil
+}
+
+// TestClientWarmup tests Connect completes the initialize handshake without
+// sending a turn
+func TestClientWarmup(t *testing.T) {
+	t.Run("warms_up_on_connect", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		mock := newInitializingMockTransport(nil)
+		turnCalls := 0
+		client := NewClientWithTransport(mock, WithWarmup(), WithTurnCallback(
+			func(string) { turnCalls++ }, func(*ResultMessage) { turnCalls++ }))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		if got := mock.initializeCount(); got != 1 {
+			t.Errorf("Expected 1 initialize handshake during Connect, got %d", got)
+		}
+		if got := mock.getSentMessageCount(); got != 0 {
+			t.Errorf("Expected no messages sent during Connect, got %d", got)
+		}
+		if turnCalls != 0 {
+			t.Errorf("Expected no turn callbacks, got %d", turnCalls)
+		}
+	})
+
+	t.Run("failed_warmup_disconnects", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		failure := errors.New("initialize timed out")
+		client := NewClientWithTransport(newInitializingMockTransport(failure), WithWarmup())
+		err := client.Connect(ctx)
+		if err == nil || !strings.Contains(err.Error(), "warmup failed") || !errors.Is(err, failure) {
+			t.Fatalf("Expected warmup failure wrapping the handshake error, got %v", err)
+		}
+		if err := client.Query(ctx, "hello"); err == nil {
+			t.Error("Expected client to be disconnected after a failed warmup")
+		}
+	})
+
+	t.Run("context_ends_first", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+		connectCtx, connectCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer connectCancel()
+
+		mock := newInitializingMockTransport(nil)
+		mock.block = true
+		client := NewClientWithTransport(mock, WithWarmup())
+		if err := client.Connect(connectCtx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("transport_without_handshake", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		mock := newClientMockTransport()
+		client := NewClientWithTransport(mock, WithWarmup())
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		if got := mock.getSentMessageCount(); got != 0 {
+			t.Errorf("Expected no messages sent during Connect, got %d", got)
+		}
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		mock := newInitializingMockTransport(nil)
+		client := setupClientForTest(t, mock)
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+		if got := mock.initializeCount(); got != 0 {
+			t.Errorf("Expected no initialize handshake without warmup, got %d", got)
+		}
+	})
+}
+
+// initializingMockTransport is a client mock with an initialize handshake
+// that fails with err, or with block set, waits for its context to end.
+type initializingMockTransport struct {
+	*clientMockTransport
+	err   error
+	block bool
+
+	initMu      sync.Mutex
+	initialized int
+}
+
+func newInitializingMockTransport(err error) *initializingMockTransport {
+	return &initializingMockTransport{clientMockTransport: newClientMockTransport(), err: err}
+}
+
+func (m *initializingMockTransport) Initialize(ctx context.Context) error {
+	m.initMu.Lock()
+	m.initialized++
+	m.initMu.Unlock()
+	if m.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return m.err
+}
+
+func (m *initializingMockTransport) initializeCount() int {
+	m.initMu.Lock()
+	defer m.initMu.Unlock()
+	return m.initialized
+}
+
+// TestClientOverloadBackoff tests overloaded turns are retried with growing
+// jittered delays and other results are delivered immediately
+func TestClientOverloadBackoff(t *testing.T) {
+	const base, maxDelay = time.Second, 4 * time.Second
+	overloaded := func(n int) *ResultMessage {
+		text := fmt.Sprintf("overloaded %d", n)
+		return &ResultMessage{Subtype: "error_during_execution", IsError: true, ErrorType: ResultErrorOverloaded, Result: &text}
+	}
+
+	// waitForSent polls until the transport has sent n messages
+	waitForSent := func(t *testing.T, transport *clientMockTransport, n int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for transport.getSentMessageCount() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %d sent messages, got %d", n, transport.getSentMessageCount())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("retries_with_increasing_delays", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithOverloadBackoff(base, maxDelay), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		assertNoError(t, client.Query(ctx, "busy question"))
+
+		// Each retry waits between half and all of base doubled per retry, up to the cap
+		delays := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second}
+		for i, delay := range delays {
+			transport.injectTestMessage(overloaded(i))
+			clock.BlockUntil(1)
+
+			clock.Advance(delay/2 - time.Nanosecond)
+			if clock.Waiters() != 1 || transport.getSentMessageCount() != i+1 {
+				t.Fatalf("Retry %d: expected no resend before %v", i+1, delay/2)
+			}
+			clock.Advance(delay/2 + time.Nanosecond)
+			waitForSent(t, transport, i+2)
+			if clock.Waiters() != 0 {
+				t.Fatalf("Retry %d: expected the backoff to end by %v", i+1, delay)
+			}
+
+			resent, _ := transport.getSentMessage(i + 1)
+			content, _ := resent.Message.(map[string]interface{})["content"].(string)
+			if content != "busy question" || resent.SessionID != defaultSessionID {
+				t.Errorf("Retry %d: expected the same prompt resent, got %q in %q", i+1, content, resent.SessionID)
+			}
+		}
+
+		// Retries are used up, so the next overloaded result is delivered
+		last := overloaded(len(delays))
+		transport.injectTestMessage(last)
+		msg, err := client.ReceiveResponse(ctx).Next(ctx)
+		assertNoError(t, err)
+		if msg != last {
+			t.Errorf("Expected only the final overloaded result delivered, got %#v", msg)
+		}
+		if sent := transport.getSentMessageCount(); sent != 1+MaxOverloadRetries {
+			t.Errorf("Expected %d sends, got %d", 1+MaxOverloadRetries, sent)
+		}
+	})
+
+	t.Run("delivers_result_after_successful_retry", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithOverloadBackoff(base, maxDelay), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		assertNoError(t, client.Query(ctx, "busy question"))
+		transport.injectTestMessage(overloaded(0))
+		clock.BlockUntil(1)
+		clock.Advance(base)
+		waitForSent(t, transport, 2)
+
+		answer := "done"
+		success := &ResultMessage{Subtype: "success", Result: &answer}
+		transport.injectTestMessage(success)
+		msg, err := client.ReceiveResponse(ctx).Next(ctx)
+		assertNoError(t, err)
+		if msg != success {
+			t.Errorf("Expected the retried turn's result, got %#v", msg)
+		}
+
+		// The turn ended, so a later overloaded result without a new query is delivered
+		late := overloaded(1)
+		transport.injectTestMessage(late)
+		msg, err = client.ReceiveResponse(ctx).Next(ctx)
+		assertNoError(t, err)
+		if msg != late || transport.getSentMessageCount() != 2 {
+			t.Errorf("Expected overloaded result without a query delivered unretried, got %#v", msg)
+		}
+	})
+
+	t.Run("retries_the_overloaded_turn_of_several", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithOverloadBackoff(base, maxDelay), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		assertNoError(t, client.Query(ctx, "first question"))
+		assertNoError(t, client.QueryWithSession(ctx, "second question", "other"))
+
+		// The first turn is overloaded, so its prompt is resent, not the latest
+		transport.injectTestMessage(overloaded(0))
+		clock.BlockUntil(1)
+		clock.Advance(base)
+		waitForSent(t, transport, 3)
+		resent, _ := transport.getSentMessage(2)
+		content, _ := resent.Message.(map[string]interface{})["content"].(string)
+		if content != "first question" || resent.SessionID != defaultSessionID {
+			t.Fatalf("Expected the first prompt resent, got %q in %q", content, resent.SessionID)
+		}
+
+		// The second turn's result is next; the resent first prompt answers after it
+		second := &ResultMessage{Subtype: "success", SessionID: "other"}
+		first := &ResultMessage{Subtype: "success", SessionID: defaultSessionID}
+		transport.injectTestMessage(second)
+		transport.injectTestMessage(first)
+		for _, want := range []*ResultMessage{second, first} {
+			msg, err := client.ReceiveResponse(ctx).Next(ctx)
+			assertNoError(t, err)
+			if msg != want {
+				t.Errorf("Expected result for session %q, got %#v", want.SessionID, msg)
+			}
+		}
+
+		// Only delivered results are counted
+		if stats := client.Stats(); stats.TurnsCompleted != 2 || stats.Errors != 0 || stats.Messages != 2 {
+			t.Errorf("Expected the held back overloaded result uncounted, got %+v", stats)
+		}
+		if sent := transport.getSentMessageCount(); sent != 3 {
+			t.Errorf("Expected 3 sends, got %d", sent)
+		}
+	})
+
+	t.Run("result_before_send_returns", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := newAnsweringMockTransport()
+		client := NewClientWithTransport(transport, WithOverloadBackoff(base, maxDelay), WithClock(clock))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		// The first turn is overloaded before SendMessage returns, so its
+		// result is held back for a retry
+		transport.answer = func(StreamMessage) {
+			transport.answer = nil
+			transport.injectTestMessage(overloaded(0))
+			waitForWaiters(t, clock, 1)
+		}
+		assertNoError(t, client.Query(ctx, "fast question"))
+		clock.Advance(base)
+		waitForSent(t, transport.clientMockTransport, 2)
+		resent, _ := transport.getSentMessage(1)
+		if content, _ := resent.Message.(map[string]interface{})["content"].(string); content != "fast question" {
+			t.Fatalf("Expected the overloaded prompt resent, got %q", content)
+		}
+
+		// The resent prompt stays first in line, ahead of a later turn
+		assertNoError(t, client.QueryWithSession(ctx, "next question", "other"))
+		transport.injectTestMessage(overloaded(1))
+		waitForWaiters(t, clock, 1)
+		clock.Advance(maxDelay)
+		waitForSent(t, transport.clientMockTransport, 4)
+		resent, _ = transport.getSentMessage(3)
+		if content, _ := resent.Message.(map[string]interface{})["content"].(string); content != "fast question" {
+			t.Errorf("Expected the first prompt resent again, got %q", content)
+		}
+	})
+
+	t.Run("other_errors_not_retried", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newClientMockTransport()
+		client := NewClientWithTransport(transport, WithOverloadBackoff(base, maxDelay))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		assertNoError(t, client.Query(ctx, "question"))
+		rateLimited := &ResultMessage{Subtype: "error_during_execution", IsError: true, ErrorType: ResultErrorRateLimit}
+		transport.injectTestMessage(rateLimited)
+		msg, err := client.ReceiveResponse(ctx).Next(ctx)
+		assertNoError(t, err)
+		if msg != rateLimited || transport.getSentMessageCount() != 1 {
+			t.Errorf("Expected rate limit result delivered unretried, got %#v", msg)
+		}
+	})
+}
+
+// TestClientTurnCallback tests a client query reports its turn start once
+// sent and its end with the result, surviving callback panics
+func TestClientTurnCallback(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var events []string
+	var ended []*ResultMessage
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	mock := newClientMockTransport()
+	client := NewClientWithTransport(mock, WithTurnCallback(
+		func(prompt string) {
+			record("start " + prompt)
+			if sent := mock.getSentMessageCount(); sent != 1 {
+				t.Errorf("Expected onStart once the prompt is sent, %d sent", sent)
+			}
+			panic("start callback panic")
+		},
+		func(result *ResultMessage) {
+			mu.Lock()
+			ended = append(ended, result)
+			mu.Unlock()
+			record("end")
+			panic("end callback panic")
+		},
+	))
+	connectClientSafely(ctx, t, client)
+	defer client.Disconnect()
+
+	assertNoError(t, client.Query(ctx, "What is 2+2?"))
+	if got := mock.getSentMessageCount(); got != 1 {
+		t.Fatalf("Expected the prompt sent despite the panic, got %d messages", got)
+	}
+	result := &ResultMessage{Subtype: "success", SessionID: "s1"}
+	mock.injectTestMessage(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "4"}}, Model: testModelSonnet})
+	mock.injectTestMessage(result)
+
+	iter := client.ReceiveResponse(ctx)
+	for {
+		msg, err := iter.Next(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := msg.(*ResultMessage); ok {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"start What is 2+2?", "end"}; strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+	if len(ended) != 1 || ended[0] != result {
+		t.Errorf("Expected onEnd to receive the injected result, got %v", ended)
+	}
+}
+
+// TestClientTurnCallbackOrdering tests a turn start is reported only for a
+// prompt that was sent, and before its end even when the result is read
+// before SendMessage returns
+func TestClientTurnCallbackOrdering(t *testing.T) {
+	t.Run("failed_send_not_reported", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		var started []string
+		mock := newClientMockTransport()
+		client := NewClientWithTransport(mock, WithTurnCallback(
+			func(prompt string) { started = append(started, prompt) }, nil))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		mock.mu.Lock()
+		mock.sendError = errors.New("broken pipe")
+		mock.mu.Unlock()
+		if err := client.Query(ctx, "lost question"); err == nil {
+			t.Fatal("Expected the send to fail")
+		}
+		if len(started) != 0 {
+			t.Errorf("Expected no onStart for a failed send, got %q", started)
+		}
+	})
+
+	t.Run("result_before_send_returns", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		var mu sync.Mutex
+		var events []string
+		record := func(event string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}
+		transport := newAnsweringMockTransport()
+		client := NewClientWithTransport(transport, WithTurnCallback(
+			func(prompt string) { record("start " + prompt) },
+			func(*ResultMessage) { record("end") },
+		))
+		connectClientSafely(ctx, t, client)
+		defer disconnectClientSafely(t, client)
+
+		transport.answer = func(StreamMessage) {
+			transport.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: defaultSessionID})
+			select {
+			case <-client.ReceiveMessages(ctx):
+			case <-time.After(2 * time.Second):
+				t.Error("Timed out waiting for the turn's result")
+			}
+		}
+		assertNoError(t, client.Query(ctx, "quick question"))
+
+		mu.Lock()
+		defer mu.Unlock()
+		if want := []string{"start quick question", "end"}; strings.Join(events, "|") != strings.Join(want, "|") {
+			t.Errorf("Expected events %v, got %v", want, events)
+		}
+	})
+}
+
+// TestClientPromptSuffix tests the prompt suffix is appended to every query,
+// before the request interceptor runs
+func TestClientPromptSuffix(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	var intercepted []string
+	transport := newClientMockTransport()
+	client := NewClientWithTransport(transport,
+		WithPromptSuffix("Always respond in Markdown."),
+		WithRequestInterceptor(func(prompt string) (string, error) {
+			intercepted = append(intercepted, prompt)
+			return prompt, nil
+		}),
+	)
+	defer disconnectClientSafely(t, client)
+	connectClientSafely(ctx, t, client)
+
+	assertNoError(t, client.Query(ctx, "Summarize the README"))
+	assertNoError(t, client.QueryWithSession(ctx, "List the open issues", "s1"))
+	_, err := client.QueryWithID(ctx, "Draft a changelog")
+	assertNoError(t, err)
+
+	want := []string{
+		"Summarize the README\n\nAlways respond in Markdown.",
+		"List the open issues\n\nAlways respond in Markdown.",
+		"Draft a changelog\n\nAlways respond in Markdown.",
+	}
+	for i, prompt := range want {
+		msg, ok := transport.getSentMessage(i)
+		if !ok {
+			t.Fatalf("Expected message %d to be sent", i)
+		}
+		if content := msg.Message.(map[string]interface{})["content"]; content != prompt {
+			t.Errorf("Expected sent prompt %q, got %q", prompt, content)
+		}
+	}
+	if strings.Join(intercepted, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected the interceptor to see suffixed prompts %q, got %q", want, intercepted)
+	}
+}
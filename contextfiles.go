@@ -0,0 +1,63 @@
+package claudecode
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// prependContextFiles returns prompt preceded by the contents of the
+// configured context files, within the configured size budget.
+func prependContextFiles(options *Options, prompt string) (string, error) {
+	if options == nil || len(options.ContextFiles) == 0 {
+		return prompt, nil
+	}
+
+	remaining := options.ContextFilesMaxBytes
+	if remaining == 0 {
+		remaining = DefaultContextFilesMaxBytes
+	}
+
+	var b strings.Builder
+	for _, path := range options.ContextFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read context file %s: %w", path, err)
+		}
+
+		// Files after the first one cut are left empty
+		content := string(data)
+		truncated := len(content) > remaining
+		if truncated {
+			content = truncateUTF8(content, remaining)
+			remaining = 0
+		} else {
+			remaining -= len(content)
+		}
+
+		if truncated {
+			fmt.Fprintf(&b, "<file path=%q truncated=\"true\">\n", path)
+		} else {
+			fmt.Fprintf(&b, "<file path=%q>\n", path)
+		}
+		b.WriteString(content)
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString("</file>\n\n")
+	}
+	b.WriteString(prompt)
+	return b.String(), nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
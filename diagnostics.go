@@ -0,0 +1,70 @@
+package claudecode
+
+import (
+	"context"
+	"time"
+)
+
+// Diagnostics is a point-in-time health report of a Client, suitable for
+// logging or attaching to a bug report.
+type Diagnostics struct {
+	// CapturedAt is when the snapshot was taken.
+	CapturedAt time.Time
+	// Connected reports whether the client was connected.
+	Connected bool
+	// ServerInfo is the result of GetServerInfo, or nil if not connected.
+	ServerInfo map[string]interface{}
+	// StreamStats is the result of GetStreamStats.
+	StreamStats StreamStats
+	// StreamIssues is the result of GetStreamIssues.
+	StreamIssues []StreamIssue
+	// RecentStderr holds the last lines the CLI wrote to stderr, oldest
+	// first, redacted if WithRedactDebugOutput is set.
+	RecentStderr []string
+	// CLIVersion is the CLI version detected on Connect, or empty if unknown
+	// or CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK is set.
+	CLIVersion string
+}
+
+// diagnosticsTransport is implemented by transports that report CLI details
+// for DiagnosticSnapshot.
+type diagnosticsTransport interface {
+	CLIVersion() string
+	RecentStderr() []string
+}
+
+// DiagnosticSnapshot gathers the client's connection state, server info,
+// stream statistics and issues, recent CLI stderr, and CLI version into one
+// report. A disconnected client yields a report with Connected false rather
+// than an error. Returns an error only if ctx is done.
+func (c *ClientImpl) DiagnosticSnapshot(ctx context.Context) (*Diagnostics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	connected := c.connected && c.transport != nil
+	transport := c.transport
+	c.mu.RUnlock()
+
+	diag := &Diagnostics{
+		CapturedAt:   c.clock().Now(),
+		Connected:    connected,
+		StreamStats:  c.GetStreamStats(),
+		StreamIssues: c.GetStreamIssues(),
+	}
+	if connected {
+		info, err := c.GetServerInfo(ctx)
+		if err == nil {
+			diag.ServerInfo = info
+		} else {
+			// Disconnected since the state was read
+			diag.Connected = false
+		}
+	}
+	if dt, ok := transport.(diagnosticsTransport); ok {
+		diag.CLIVersion = dt.CLIVersion()
+		diag.RecentStderr = dt.RecentStderr()
+	}
+	return diag, nil
+}
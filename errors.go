@@ -25,6 +25,34 @@ type JSONDecodeError = shared.JSONDecodeError
 // MessageParseError represents errors parsing message content.
 type MessageParseError = shared.MessageParseError
 
+// ToolExecutionError indicates a tool returned an error result.
+type ToolExecutionError = shared.ToolExecutionError
+
+// StructuredOutputError indicates structured output has fields the schema does not allow.
+type StructuredOutputError = shared.StructuredOutputError
+
+// ValidationError indicates an option has an invalid value.
+type ValidationError = shared.ValidationError
+
+// SessionExpiredError indicates a session exceeded its maximum duration.
+type SessionExpiredError = shared.SessionExpiredError
+
+// IdleDisconnectError indicates a Client was disconnected after its maximum idle time.
+type IdleDisconnectError = shared.IdleDisconnectError
+
+// CLIResultError carries a result message that ended its turn in an error,
+// with the CLI's original JSON.
+type CLIResultError = shared.CLIResultError
+
+// PromptTooLargeError indicates a prompt exceeded the large prompt threshold.
+type PromptTooLargeError = shared.PromptTooLargeError
+
+// OutputLimitExceededError indicates CLI output exceeded the session's byte limit.
+type OutputLimitExceededError = shared.OutputLimitExceededError
+
+// PartialResultsError carries the messages a cancelled query received.
+type PartialResultsError = shared.PartialResultsError
+
 // NewConnectionError creates a new connection error.
 var NewConnectionError = shared.NewConnectionError
 
@@ -40,6 +68,33 @@ var NewJSONDecodeError = shared.NewJSONDecodeError
 // NewMessageParseError creates a new message parse error.
 var NewMessageParseError = shared.NewMessageParseError
 
+// NewToolExecutionError creates a new tool execution error.
+var NewToolExecutionError = shared.NewToolExecutionError
+
+// NewStructuredOutputError creates a new structured output error.
+var NewStructuredOutputError = shared.NewStructuredOutputError
+
+// NewValidationError creates a new validation error.
+var NewValidationError = shared.NewValidationError
+
+// NewSessionExpiredError creates a new session expired error.
+var NewSessionExpiredError = shared.NewSessionExpiredError
+
+// NewIdleDisconnectError creates a new idle disconnect error.
+var NewIdleDisconnectError = shared.NewIdleDisconnectError
+
+// NewCLIResultError creates a new CLI result error.
+var NewCLIResultError = shared.NewCLIResultError
+
+// NewPromptTooLargeError creates a new prompt too large error.
+var NewPromptTooLargeError = shared.NewPromptTooLargeError
+
+// NewOutputLimitExceededError creates a new output limit exceeded error.
+var NewOutputLimitExceededError = shared.NewOutputLimitExceededError
+
+// NewPartialResultsError creates a new partial results error.
+var NewPartialResultsError = shared.NewPartialResultsError
+
 // Error type checking helpers (Go-specific, follows os.IsNotExist pattern).
 // These use errors.As() internally to handle wrapped errors correctly.
 
@@ -58,6 +113,33 @@ var IsJSONDecodeError = shared.IsJSONDecodeError
 // IsMessageParseError reports whether err is or wraps a MessageParseError.
 var IsMessageParseError = shared.IsMessageParseError
 
+// IsToolExecutionError reports whether err is or wraps a ToolExecutionError.
+var IsToolExecutionError = shared.IsToolExecutionError
+
+// IsStructuredOutputError reports whether err is or wraps a StructuredOutputError.
+var IsStructuredOutputError = shared.IsStructuredOutputError
+
+// IsValidationError reports whether err is or wraps a ValidationError.
+var IsValidationError = shared.IsValidationError
+
+// IsSessionExpiredError reports whether err is or wraps a SessionExpiredError.
+var IsSessionExpiredError = shared.IsSessionExpiredError
+
+// IsIdleDisconnectError reports whether err is or wraps an IdleDisconnectError.
+var IsIdleDisconnectError = shared.IsIdleDisconnectError
+
+// IsCLIResultError reports whether err is or wraps a CLIResultError.
+var IsCLIResultError = shared.IsCLIResultError
+
+// IsPromptTooLargeError reports whether err is or wraps a PromptTooLargeError.
+var IsPromptTooLargeError = shared.IsPromptTooLargeError
+
+// IsOutputLimitExceededError reports whether err is or wraps an OutputLimitExceededError.
+var IsOutputLimitExceededError = shared.IsOutputLimitExceededError
+
+// IsPartialResultsError reports whether err is or wraps a PartialResultsError.
+var IsPartialResultsError = shared.IsPartialResultsError
+
 // Error type extraction helpers (Go-specific).
 // Returns typed pointer for field access, or nil if not matching type.
 
@@ -80,3 +162,43 @@ var AsJSONDecodeError = shared.AsJSONDecodeError
 // AsMessageParseError returns the error as a *MessageParseError if it is one,
 // or nil otherwise.
 var AsMessageParseError = shared.AsMessageParseError
+
+// AsToolExecutionError returns the error as a *ToolExecutionError if it is one,
+// or nil otherwise.
+var AsToolExecutionError = shared.AsToolExecutionError
+
+// AsStructuredOutputError returns the error as a *StructuredOutputError if it is one,
+// or nil otherwise.
+var AsStructuredOutputError = shared.AsStructuredOutputError
+
+// AsValidationError returns the error as a *ValidationError if it is one,
+// or nil otherwise.
+var AsValidationError = shared.AsValidationError
+
+// AsSessionExpiredError returns the error as a *SessionExpiredError if it is one,
+// or nil otherwise.
+var AsSessionExpiredError = shared.AsSessionExpiredError
+
+// AsIdleDisconnectError returns the error as an *IdleDisconnectError if it is one,
+// or nil otherwise.
+var AsIdleDisconnectError = shared.AsIdleDisconnectError
+
+// AsCLIResultError returns the error as a *CLIResultError if it is one,
+// or nil otherwise.
+var AsCLIResultError = shared.AsCLIResultError
+
+// AsPromptTooLargeError returns the error as a *PromptTooLargeError if it is one,
+// or nil otherwise.
+var AsPromptTooLargeError = shared.AsPromptTooLargeError
+
+// AsOutputLimitExceededError returns the error as an *OutputLimitExceededError
+// if it is one, or nil otherwise.
+var AsOutputLimitExceededError = shared.AsOutputLimitExceededError
+
+// AsPartialResultsError returns the error as a *PartialResultsError if it is
+// one, or nil otherwise.
+var AsPartialResultsError = shared.AsPartialResultsError
+
+// IsRetryable reports whether err is a transient failure that may succeed if
+// the operation is retried.
+var IsRetryable = shared.IsRetryable
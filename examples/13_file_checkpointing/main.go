@@ -337,45 +337,43 @@ func streamWithCheckpoints(
 	onCheckpoint func(uuid, query string),
 	currentQuery string,
 ) error {
-	msgChan := client.ReceiveMessages(ctx)
+	// Stop reading when this turn is handled so later turns are not consumed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	for {
-		select {
-		case message := <-msgChan:
-			if message == nil {
-				return nil
-			}
+	for event := range client.Messages(ctx) {
+		if event.Done || event.Err != nil {
+			return event.Err
+		}
 
-			switch msg := message.(type) {
-			case *claudecode.UserMessage:
-				// Capture the UUID for this user message
-				if msg.UUID != nil {
-					onCheckpoint(*msg.UUID, currentQuery)
-					fmt.Printf("  [CHECKPOINT] UUID captured: %s\n", truncate(*msg.UUID, 24))
-				}
-			case *claudecode.AssistantMessage:
-				for _, block := range msg.Content {
-					if textBlock, ok := block.(*claudecode.TextBlock); ok {
-						text := textBlock.Text
-						if len(text) > 150 {
-							text = text[:150] + "..."
-						}
-						fmt.Printf("  Response: %s\n", strings.ReplaceAll(text, "\n", " "))
+		switch msg := event.Message.(type) {
+		case *claudecode.UserMessage:
+			// Capture the UUID for this user message
+			if msg.UUID != nil {
+				onCheckpoint(*msg.UUID, currentQuery)
+				fmt.Printf("  [CHECKPOINT] UUID captured: %s\n", truncate(*msg.UUID, 24))
+			}
+		case *claudecode.AssistantMessage:
+			for _, block := range msg.Content {
+				if textBlock, ok := block.(*claudecode.TextBlock); ok {
+					text := textBlock.Text
+					if len(text) > 150 {
+						text = text[:150] + "..."
 					}
+					fmt.Printf("  Response: %s\n", strings.ReplaceAll(text, "\n", " "))
 				}
-			case *claudecode.ResultMessage:
-				if msg.IsError {
-					if msg.Result != nil {
-						return fmt.Errorf("error: %s", *msg.Result)
-					}
-					return fmt.Errorf("error: unknown error")
+			}
+		case *claudecode.ResultMessage:
+			if msg.IsError {
+				if msg.Result != nil {
+					return fmt.Errorf("error: %s", *msg.Result)
 				}
-				return nil
+				return fmt.Errorf("error: unknown error")
 			}
-		case <-ctx.Done():
-			return ctx.Err()
+			return nil
 		}
 	}
+	return nil
 }
 
 // streamWithModifications processes messages and tracks tool use for modifications
@@ -385,48 +383,46 @@ func streamWithModifications(
 	modifications *[]string,
 	mu *sync.Mutex,
 ) error {
-	msgChan := client.ReceiveMessages(ctx)
+	// Stop reading when this turn is handled so later turns are not consumed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	for {
-		select {
-		case message := <-msgChan:
-			if message == nil {
-				return nil
-			}
+	for event := range client.Messages(ctx) {
+		if event.Done || event.Err != nil {
+			return event.Err
+		}
 
-			switch msg := message.(type) {
-			case *claudecode.AssistantMessage:
-				for _, block := range msg.Content {
-					switch b := block.(type) {
-					case *claudecode.TextBlock:
-						text := b.Text
-						if len(text) > 150 {
-							text = text[:150] + "..."
-						}
-						fmt.Printf("  Response: %s\n", strings.ReplaceAll(text, "\n", " "))
-					case *claudecode.ToolUseBlock:
-						// Track potential file modifications
-						if b.Name == "Write" || b.Name == "Edit" {
-							mu.Lock()
-							*modifications = append(*modifications, fmt.Sprintf("%s tool used", b.Name))
-							mu.Unlock()
-							fmt.Printf("  [MODIFY] %s tool invoked\n", b.Name)
-						}
+		switch msg := event.Message.(type) {
+		case *claudecode.AssistantMessage:
+			for _, block := range msg.Content {
+				switch b := block.(type) {
+				case *claudecode.TextBlock:
+					text := b.Text
+					if len(text) > 150 {
+						text = text[:150] + "..."
 					}
-				}
-			case *claudecode.ResultMessage:
-				if msg.IsError {
-					if msg.Result != nil {
-						return fmt.Errorf("error: %s", *msg.Result)
+					fmt.Printf("  Response: %s\n", strings.ReplaceAll(text, "\n", " "))
+				case *claudecode.ToolUseBlock:
+					// Track potential file modifications
+					if b.Name == "Write" || b.Name == "Edit" {
+						mu.Lock()
+						*modifications = append(*modifications, fmt.Sprintf("%s tool used", b.Name))
+						mu.Unlock()
+						fmt.Printf("  [MODIFY] %s tool invoked\n", b.Name)
 					}
-					return fmt.Errorf("error: unknown error")
 				}
-				return nil
 			}
-		case <-ctx.Done():
-			return ctx.Err()
+		case *claudecode.ResultMessage:
+			if msg.IsError {
+				if msg.Result != nil {
+					return fmt.Errorf("error: %s", *msg.Result)
+				}
+				return fmt.Errorf("error: unknown error")
+			}
+			return nil
 		}
 	}
+	return nil
 }
 
 // truncate shortens a string to maxLen characters
@@ -9,6 +9,7 @@
 // - Integration with strongly-typed applications
 //
 // Key components:
+// - WithResponseSchemaFromType: Schema generated from a Go struct
 // - WithJSONSchema: Convenience function for JSON schema constraint
 // - WithOutputFormat: Explicit output format control
 // - OutputFormatJSONSchema: Creates OutputFormat from schema
@@ -52,10 +53,11 @@ func main() {
 	fmt.Println("Structured output example completed!")
 }
 
-// TaskList represents a list of tasks extracted from text
+// TaskList represents a list of tasks extracted from text.
+// Its JSON schema is generated from the struct and its tags.
 type TaskList struct {
-	Tasks    []string `json:"tasks"`
-	Priority string   `json:"priority"`
+	Tasks    []string `json:"tasks" description:"List of tasks extracted from the text"`
+	Priority string   `json:"priority" enum:"low,medium,high" description:"Overall priority level of the tasks"`
 }
 
 // runTaskExtractionExample demonstrates extracting tasks from natural language
@@ -63,24 +65,6 @@ func runTaskExtractionExample() {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	// Define JSON schema for task extraction
-	taskSchema := map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"tasks": map[string]any{
-				"type":        "array",
-				"items":       map[string]any{"type": "string"},
-				"description": "List of tasks extracted from the text",
-			},
-			"priority": map[string]any{
-				"type":        "string",
-				"enum":        []string{"low", "medium", "high"},
-				"description": "Overall priority level of the tasks",
-			},
-		},
-		"required": []string{"tasks", "priority"},
-	}
-
 	inputText := "I need to fix the login bug urgently, then add unit tests, and finally update the documentation."
 	fmt.Printf("Input: %q\n", inputText)
 	fmt.Println()
@@ -118,7 +102,7 @@ func runTaskExtractionExample() {
 			}
 		}
 	},
-		claudecode.WithJSONSchema(taskSchema),
+		claudecode.WithResponseSchemaFromType(TaskList{}),
 		claudecode.WithMaxTurns(1),
 	)
 
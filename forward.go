@@ -0,0 +1,162 @@
+package claudecode
+
+import "sync"
+
+// streamHook observes the messages and errors a streamForwarder copies to
+// the client. Any of its functions may be nil.
+type streamHook struct {
+	// message is called for each message before it is delivered. Returning
+	// false holds the message back from later hooks and the client. A
+	// non-nil error is passed to later hooks and delivered before the message.
+	message func(msg Message) (deliver bool, err error)
+	// error is called for each error before it is delivered.
+	error func(err error)
+	// end is called once forwarding ends, with whether the client stopped it
+	// and the reason it gave.
+	end func(stopped bool, reason error)
+}
+
+// streamForwarder copies a transport's message and error channels to the
+// client, running each message and error through its hooks in order, until
+// both transport channels close or the client stops it.
+type streamForwarder struct {
+	hooks      []streamHook
+	stop       chan struct{} // Closed by the client when it disconnects
+	stopOnce   sync.Once
+	stopReason error         // Passed to end hooks; nil for Disconnect
+	finished   chan struct{} // Closed once forwarding and the end hooks are done
+}
+
+// newStreamForwarder creates a forwarder with no hooks.
+func newStreamForwarder() *streamForwarder {
+	return &streamForwarder{
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+// add appends hook, to run after the hooks already added. Must be called
+// before start.
+func (f *streamForwarder) add(hook streamHook) {
+	f.hooks = append(f.hooks, hook)
+}
+
+// start begins forwarding msgs and errs and returns the channels to read
+// instead, buffered like the originals.
+func (f *streamForwarder) start(msgs <-chan Message, errs <-chan error) (<-chan Message, <-chan error) {
+	outMsgs := make(chan Message, cap(msgs))
+	outErrs := make(chan error, cap(errs))
+	go f.forward(msgs, errs, outMsgs, outErrs)
+	return outMsgs, outErrs
+}
+
+// forward copies messages and errors through the hooks, then runs the end
+// hooks before closing the client's channels.
+func (f *streamForwarder) forward(
+	msgs <-chan Message,
+	errs <-chan error,
+	outMsgs chan<- Message,
+	outErrs chan<- error,
+) {
+	defer close(f.finished)
+	defer close(outMsgs)
+	defer close(outErrs)
+
+	f.copyAll(msgs, errs, outMsgs, outErrs)
+	stopped, reason := false, error(nil)
+	select {
+	case <-f.stop:
+		stopped, reason = true, f.stopReason
+	default:
+	}
+	for _, hook := range f.hooks {
+		if hook.end != nil {
+			hook.end(stopped, reason)
+		}
+	}
+}
+
+// copyAll copies until both transport channels close or the forwarder is stopped.
+func (f *streamForwarder) copyAll(
+	msgs <-chan Message,
+	errs <-chan error,
+	outMsgs chan<- Message,
+	outErrs chan<- error,
+) {
+	for msgs != nil || errs != nil {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+			if !f.handleMessage(msg, outMsgs, outErrs) {
+				return
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			f.observeError(err, 0)
+			select {
+			case outErrs <- err:
+			case <-f.stop:
+				return
+			}
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// handleMessage runs msg through the hooks and delivers it unless a hook
+// held it back. Returns false once the forwarder is stopped.
+func (f *streamForwarder) handleMessage(msg Message, outMsgs chan<- Message, outErrs chan<- error) bool {
+	for i, hook := range f.hooks {
+		if hook.message == nil {
+			continue
+		}
+		deliver, err := hook.message(msg)
+		if err != nil {
+			f.observeError(err, i+1)
+			select {
+			case outErrs <- err:
+			case <-f.stop:
+				return false
+			}
+		}
+		if !deliver {
+			return true
+		}
+	}
+	select {
+	case outMsgs <- msg:
+		return true
+	case <-f.stop:
+		return false
+	}
+}
+
+// observeError passes err to the error hooks from index from on.
+func (f *streamForwarder) observeError(err error, from int) {
+	for _, hook := range f.hooks[from:] {
+		if hook.error != nil {
+			hook.error(err)
+		}
+	}
+}
+
+// stopForwarding ends forwarding when the client disconnects, passing reason
+// to the end hooks. Only the first call's reason is kept.
+func (f *streamForwarder) stopForwarding(reason error) {
+	f.stopOnce.Do(func() {
+		f.stopReason = reason
+		close(f.stop)
+	})
+}
+
+// wait blocks until forwarding has ended and the end hooks have returned.
+func (f *streamForwarder) wait() {
+	<-f.finished
+}
@@ -0,0 +1,171 @@
+package claudecode
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// idleMonitor calls onIdle once no activity has been seen for maxIdle.
+// Messages received and queries sent (reported with touch) are activity, and
+// the idle time is paused while a turn awaits its result, however quiet the
+// turn is.
+type idleMonitor struct {
+	clock   Clock
+	maxIdle time.Duration
+	onIdle  func()
+	stop    <-chan struct{} // Closed when the client disconnects
+	resume  chan struct{}   // Signaled when the last pending turn ends
+
+	mu    sync.Mutex
+	last  time.Time // Time of the latest activity
+	turns int       // Sent turns awaiting their result
+}
+
+// newIdleMonitor creates a monitor whose idle time starts now and which
+// stops timing once stop is closed.
+func newIdleMonitor(clock Clock, maxIdle time.Duration, stop <-chan struct{}, onIdle func()) *idleMonitor {
+	clock = shared.ClockOrSystem(clock)
+	return &idleMonitor{
+		clock:   clock,
+		maxIdle: maxIdle,
+		onIdle:  onIdle,
+		stop:    stop,
+		resume:  make(chan struct{}, 1),
+		last:    clock.Now(),
+	}
+}
+
+// hook returns the stream hook counting each message as activity and each
+// result as the end of a pending turn.
+func (m *idleMonitor) hook() streamHook {
+	return streamHook{
+		message: func(msg Message) (bool, error) {
+			if _, ok := msg.(*ResultMessage); ok {
+				m.endTurn()
+			} else {
+				m.touch()
+			}
+			return true, nil
+		},
+	}
+}
+
+// run waits until maxIdle has passed since the latest activity with no turn
+// pending, then calls onIdle. Returns early if the monitor stops.
+func (m *idleMonitor) run() {
+	for {
+		m.mu.Lock()
+		deadline := m.last.Add(m.maxIdle)
+		busy := m.turns > 0
+		m.mu.Unlock()
+
+		if busy {
+			select {
+			case <-m.resume:
+				continue
+			case <-m.stop:
+				return
+			}
+		}
+
+		wait := deadline.Sub(m.clock.Now())
+		if wait <= 0 {
+			m.onIdle()
+			return
+		}
+		timer := m.clock.NewTimer(wait)
+		select {
+		case <-timer.C():
+		case <-m.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// touch records activity, restarting the idle time.
+func (m *idleMonitor) touch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = m.clock.Now()
+}
+
+// startTurn pauses the idle time until the sent turn's result arrives.
+func (m *idleMonitor) startTurn() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = m.clock.Now()
+	m.turns++
+}
+
+// endTurn records a result, resuming the idle time from now once no turn
+// is pending.
+func (m *idleMonitor) endTurn() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last = m.clock.Now()
+	if m.turns == 0 {
+		return
+	}
+	m.turns--
+	if m.turns == 0 {
+		select {
+		case m.resume <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// markActive records a query as activity for the idle monitor, if any.
+func (c *ClientImpl) markActive() {
+	c.mu.RLock()
+	idle := c.idle
+	c.mu.RUnlock()
+	if idle != nil {
+		idle.touch()
+	}
+}
+
+// disconnectIdle disconnects the client after m found it idle, unless m
+// belongs to an earlier connection. Later use returns an IdleDisconnectError.
+func (c *ClientImpl) disconnectIdle(m *idleMonitor) {
+	c.mu.Lock()
+	if c.idle != m || !c.connected {
+		c.mu.Unlock()
+		return
+	}
+	idleErr := NewIdleDisconnectError(m.maxIdle)
+	forwarder := c.forwarder
+	if forwarder != nil {
+		forwarder.stopForwarding(idleErr)
+	}
+	err := c.disconnectLocked()
+	if err == nil {
+		c.idleErr = idleErr
+	}
+	c.mu.Unlock()
+
+	// Wait outside the lock so the disconnect callback can use the client
+	if forwarder != nil && err == nil {
+		forwarder.wait()
+	}
+}
+
+// notConnectedError returns the error for a call that needs a connection:
+// an IdleDisconnectError if the client was disconnected for being idle.
+func (c *ClientImpl) notConnectedError() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.notConnectedErrorLocked()
+}
+
+// notConnectedErrorLocked is notConnectedError for callers holding c.mu.
+func (c *ClientImpl) notConnectedErrorLocked() error {
+	if c.idleErr != nil {
+		return c.idleErr
+	}
+	return fmt.Errorf("client not connected")
+}
@@ -191,12 +191,47 @@ func addToolsFlag(cmd []string, options *shared.Options) []string {
 	return cmd
 }
 
+// appendSystemPrompt returns the text for --append-system-prompt: the
+// configured append prompt followed by the context manifest section.
+// Reports false if there is neither.
+func appendSystemPrompt(options *shared.Options) (string, bool) {
+	manifest := contextManifestSection(options.ContextManifest)
+	switch {
+	case options.AppendSystemPrompt == nil && manifest == "":
+		return "", false
+	case options.AppendSystemPrompt == nil:
+		return manifest, true
+	case manifest == "":
+		return *options.AppendSystemPrompt, true
+	}
+	return *options.AppendSystemPrompt + "\n\n" + manifest, true
+}
+
+// contextManifestSection lists the context manifest paths as a system prompt
+// section, or returns "" if there are none.
+func contextManifestSection(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<context_manifest>\n")
+	b.WriteString("These files are relevant to this session. Their contents are not included; " +
+		"read them with your tools when needed, before searching elsewhere.\n")
+	for _, path := range paths {
+		b.WriteString("- ")
+		b.WriteString(path)
+		b.WriteString("\n")
+	}
+	b.WriteString("</context_manifest>")
+	return b.String()
+}
+
 func addModelAndPromptFlags(cmd []string, options *shared.Options) []string {
 	if options.SystemPrompt != nil {
 		cmd = append(cmd, "--system-prompt", *options.SystemPrompt)
 	}
-	if options.AppendSystemPrompt != nil {
-		cmd = append(cmd, "--append-system-prompt", *options.AppendSystemPrompt)
+	if appendPrompt, ok := appendSystemPrompt(options); ok {
+		cmd = append(cmd, "--append-system-prompt", appendPrompt)
 	}
 	if options.Model != nil {
 		cmd = append(cmd, "--model", *options.Model)
@@ -207,10 +242,10 @@ func addModelAndPromptFlags(cmd []string, options *shared.Options) []string {
 	if options.MaxBudgetUSD != nil {
 		cmd = append(cmd, "--max-budget-usd", fmt.Sprintf("%.2f", *options.MaxBudgetUSD))
 	}
-	// NOTE: --max-thinking-tokens not supported by current CLI version
-	// if options.MaxThinkingTokens > 0 {
-	//	cmd = append(cmd, "--max-thinking-tokens", fmt.Sprintf("%d", options.MaxThinkingTokens))
-	// }
+	// Zero leaves thinking to the CLI's default
+	if options.MaxThinkingTokens > 0 {
+		cmd = append(cmd, "--max-thinking-tokens", strconv.Itoa(options.MaxThinkingTokens))
+	}
 	// NOTE: User and MaxBufferSize are internal SDK options without CLI flag mappings
 	return cmd
 }
@@ -232,6 +267,9 @@ func addSessionFlags(cmd []string, options *shared.Options) []string {
 	if options.Resume != nil {
 		cmd = append(cmd, "--resume", *options.Resume)
 	}
+	if options.ResumeSessionAt != nil {
+		cmd = append(cmd, "--resume-session-at", *options.ResumeSessionAt)
+	}
 	if options.MaxTurns > 0 {
 		cmd = append(cmd, "--max-turns", fmt.Sprintf("%d", options.MaxTurns))
 	}
@@ -428,6 +466,12 @@ func ValidateWorkingDirectory(cwd string) error {
 // Mimics Python SDK _check_claude_version() behavior.
 // Non-blocking - errors are silently ignored.
 func CheckCLIVersion(ctx context.Context, cliPath string) (warning string) {
+	return CLIVersionWarning(DetectCLIVersion(ctx, cliPath))
+}
+
+// DetectCLIVersion runs the CLI with -v and returns its X.Y.Z version, or an
+// empty string if the version check is skipped or the version is unknown.
+func DetectCLIVersion(ctx context.Context, cliPath string) string {
 	if os.Getenv("CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK") != "" {
 		return ""
 	}
@@ -450,7 +494,15 @@ func CheckCLIVersion(ctx context.Context, cliPath string) (warning string) {
 	if len(match) < 2 {
 		return "" // No valid version found
 	}
-	version := match[1]
+	return match[1]
+}
+
+// CLIVersionWarning returns a warning if version is below the minimum
+// supported version, or an empty string if it is supported or unknown.
+func CLIVersionWarning(version string) string {
+	if version == "" {
+		return ""
+	}
 
 	// Compare version parts (matches Python SDK list comparison)
 	if compareVersionParts(version, MinimumCLIVersion) < 0 {
@@ -179,6 +179,16 @@ func TestBetasFlagSupport(t *testing.T) {
 	}
 }
 
+// TestMaxThinkingTokensFlagSupport tests the thinking budget is passed to the
+// CLI only when positive
+func TestMaxThinkingTokensFlagSupport(t *testing.T) {
+	cmd := BuildCommand("/usr/local/bin/claude", &shared.Options{MaxThinkingTokens: 16000}, true)
+	assertContainsArgs(t, cmd, "--max-thinking-tokens", "16000")
+
+	cmd = BuildCommand("/usr/local/bin/claude", &shared.Options{}, true)
+	assertNotContainsArg(t, cmd, "--max-thinking-tokens")
+}
+
 // TestBuildCommandWithPrompt tests CLI command construction with prompt argument
 func TestBuildCommandWithPrompt(t *testing.T) {
 	tests := []struct {
@@ -394,6 +404,7 @@ func validateFullOptionsCommand(t *testing.T, cmd []string) {
 	assertContainsArgs(t, cmd, "--disallowed-tools", "Bash,Delete")
 	assertContainsArgs(t, cmd, "--system-prompt", "You are a helpful assistant")
 	assertContainsArgs(t, cmd, "--model", "claude-3-sonnet")
+	assertContainsArgs(t, cmd, "--max-thinking-tokens", "10000")
 	assertContainsArg(t, cmd, "--continue")
 	assertContainsArgs(t, cmd, "--resume", "session123")
 	assertContainsArg(t, cmd, "--custom-flag")
@@ -860,6 +871,30 @@ func TestSessionManagementFlagsSupport(t *testing.T) {
 			},
 			validate: validateForkSessionWithResume,
 		},
+		{
+			name: "resume_session_at",
+			options: &shared.Options{
+				Resume:          stringPtr("session-123"),
+				ResumeSessionAt: stringPtr("msg-uuid-456"),
+				SettingSources:  []shared.SettingSource{},
+			},
+			validate: validateResumeSessionAt,
+		},
+		{
+			name: "resume_session_at_with_fork",
+			options: &shared.Options{
+				Resume:          stringPtr("session-123"),
+				ResumeSessionAt: stringPtr("msg-uuid-456"),
+				ForkSession:     true,
+				SettingSources:  []shared.SettingSource{},
+			},
+			validate: validateResumeSessionAtWithFork,
+		},
+		{
+			name:     "resume_without_session_at",
+			options:  &shared.Options{Resume: stringPtr("session-123"), SettingSources: []shared.SettingSource{}},
+			validate: validateNoResumeSessionAt,
+		},
 	}
 
 	for _, test := range tests {
@@ -907,6 +942,26 @@ func validateForkSessionWithResume(t *testing.T, cmd []string) {
 	assertContainsArgs(t, cmd, "--setting-sources", "user")
 }
 
+func validateResumeSessionAt(t *testing.T, cmd []string) {
+	t.Helper()
+	assertContainsArgs(t, cmd, "--resume", "session-123")
+	assertContainsArgs(t, cmd, "--resume-session-at", "msg-uuid-456")
+	assertNotContainsArg(t, cmd, "--fork-session")
+}
+
+func validateResumeSessionAtWithFork(t *testing.T, cmd []string) {
+	t.Helper()
+	assertContainsArgs(t, cmd, "--resume", "session-123")
+	assertContainsArgs(t, cmd, "--resume-session-at", "msg-uuid-456")
+	assertContainsArg(t, cmd, "--fork-session")
+}
+
+func validateNoResumeSessionAt(t *testing.T, cmd []string) {
+	t.Helper()
+	assertContainsArgs(t, cmd, "--resume", "session-123")
+	assertNotContainsArg(t, cmd, "--resume-session-at")
+}
+
 // TestPluginsFlagSupport tests --plugin-dir CLI flag generation
 func TestPluginsFlagSupport(t *testing.T) {
 	tests := []struct {
@@ -1567,6 +1622,57 @@ func TestIncludePartialMessagesWithOtherOptions(t *testing.T) {
 	assertContainsArg(t, cmd, "--continue")
 }
 
+// TestContextManifestSupport tests the manifest is appended to the system prompt
+func TestContextManifestSupport(t *testing.T) {
+	manifest := "<context_manifest>\n" +
+		"These files are relevant to this session. Their contents are not included; " +
+		"read them with your tools when needed, before searching elsewhere.\n" +
+		"- docs/design.md\n" +
+		"- internal/parser/json.go\n" +
+		"</context_manifest>"
+	appendPrompt := "Be concise."
+
+	tests := []struct {
+		name     string
+		options  *shared.Options
+		expected string // Expected --append-system-prompt value, "" for none
+	}{
+		{
+			name:     "manifest_only",
+			options:  &shared.Options{ContextManifest: []string{"docs/design.md", "internal/parser/json.go"}},
+			expected: manifest,
+		},
+		{
+			name: "after_append_system_prompt",
+			options: &shared.Options{
+				AppendSystemPrompt: &appendPrompt,
+				ContextManifest:    []string{"docs/design.md", "internal/parser/json.go"},
+			},
+			expected: appendPrompt + "\n\n" + manifest,
+		},
+		{
+			name:     "append_system_prompt_only",
+			options:  &shared.Options{AppendSystemPrompt: &appendPrompt},
+			expected: appendPrompt,
+		},
+		{
+			name:    "no_flag_by_default",
+			options: &shared.Options{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := BuildCommand("/usr/local/bin/claude", test.options, false)
+			if test.expected == "" {
+				assertNotContainsArg(t, cmd, "--append-system-prompt")
+				return
+			}
+			assertContainsArgs(t, cmd, "--append-system-prompt", test.expected)
+		})
+	}
+}
+
 // TestCompareVersionParts tests semantic version comparison (mimics Python SDK list comparison)
 func TestCompareVersionParts(t *testing.T) {
 	tests := []struct {
@@ -1641,6 +1747,30 @@ func TestCheckCLIVersionSkipEnvVar(t *testing.T) {
 	}
 }
 
+// TestDetectCLIVersion tests extracting the version from the CLI's -v output
+func TestDetectCLIVersion(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reports_version", func(t *testing.T) {
+		mockCLI := createVersionMockCLI(t, "2.1.5 (Claude Code)")
+		if got := DetectCLIVersion(ctx, mockCLI); got != "2.1.5" {
+			t.Errorf("DetectCLIVersion() = %q, want %q", got, "2.1.5")
+		}
+	})
+
+	t.Run("invalid_path_empty", func(t *testing.T) {
+		if got := DetectCLIVersion(ctx, "/nonexistent/claude"); got != "" {
+			t.Errorf("DetectCLIVersion() = %q, want empty", got)
+		}
+	})
+
+	t.Run("unknown_version_no_warning", func(t *testing.T) {
+		if warning := CLIVersionWarning(""); warning != "" {
+			t.Errorf("Expected no warning for unknown version, got: %s", warning)
+		}
+	})
+}
+
 // createVersionMockCLI creates a mock CLI script that outputs the given version
 func createVersionMockCLI(t *testing.T, version string) string {
 	t.Helper()
@@ -6,6 +6,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
 // handleMcpMessageRequest routes MCP JSONRPC messages to SDK servers.
@@ -31,6 +33,8 @@ func (p *Protocol) handleMcpMessageRequest(ctx context.Context, requestID string
 			fmt.Sprintf("server '%s' not found", serverName))
 	}
 
+	p.traceMcpRequest(message)
+
 	// Route JSONRPC method with panic recovery
 	var mcpResponse map[string]any
 	var routeErr error
@@ -47,9 +51,59 @@ func (p *Protocol) handleMcpMessageRequest(ctx context.Context, requestID string
 		return p.sendMcpErrorResponse(ctx, requestID, message, -32603, routeErr.Error())
 	}
 
+	if getString(message, "method") == "tools/call" {
+		p.postProcessMcpToolResult(serverName, message, mcpResponse)
+	}
+
 	return p.sendMcpResponse(ctx, requestID, mcpResponse)
 }
 
+// traceMcpRequest passes the method and params of a JSON-RPC request to the
+// SDK MCP trace function. A panicking trace function does not affect the
+// request.
+func (p *Protocol) traceMcpRequest(message map[string]any) {
+	if p.sdkMcpTrace == nil {
+		return
+	}
+
+	var params json.RawMessage
+	if raw, exists := message["params"]; exists {
+		if data, err := json.Marshal(raw); err == nil {
+			params = data
+		}
+	}
+
+	shared.SafeCallback(func() { p.sdkMcpTrace(getString(message, "method"), params) })
+}
+
+// postProcessMcpToolResult applies the tool result post-processor to a
+// tools/call response in place. The processor sees the tool under its
+// CLI-visible name (mcp__<server>__<tool>) and the MCP content list.
+// A processor returning a string is wrapped as a single text content item.
+// Processor panics leave the original content unchanged.
+func (p *Protocol) postProcessMcpToolResult(serverName string, message, mcpResponse map[string]any) {
+	if p.toolResultPostProcessor == nil {
+		return
+	}
+	result, _ := mcpResponse["result"].(map[string]any)
+	if result == nil {
+		return
+	}
+
+	params, _ := message["params"].(map[string]any)
+	toolName := fmt.Sprintf("mcp__%s__%s", serverName, getString(params, "name"))
+
+	defer func() {
+		_ = recover() // Keep original content if the processor panics
+	}()
+
+	processed := p.toolResultPostProcessor(toolName, result["content"])
+	if text, ok := processed.(string); ok {
+		processed = []map[string]any{{"type": "text", "text": text}}
+	}
+	result["content"] = processed
+}
+
 // routeMcpMethod dispatches JSONRPC methods to server handlers.
 func (p *Protocol) routeMcpMethod(ctx context.Context, server McpServer, msg map[string]any) (map[string]any, error) {
 	method := getString(msg, "method")
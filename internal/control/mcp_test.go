@@ -437,6 +437,190 @@ func TestWithSdkMcpServers(t *testing.T) {
 	}
 }
 
+// TestMcpToolResultPostProcessor tests the post-processor transforms tools/call content.
+func TestMcpToolResultPostProcessor(t *testing.T) {
+	tests := []struct {
+		name      string
+		processor ToolResultPostProcessor
+		wantText  string
+		wantTool  string
+	}{
+		{
+			name: "string_result_wrapped_as_text",
+			processor: func(_ string, content any) any {
+				items, _ := content.([]map[string]any)
+				return "1: " + items[0]["text"].(string)
+			},
+			wantText: "1: line one",
+			wantTool: "mcp__calc__add",
+		},
+		{
+			name: "content_list_replaced",
+			processor: func(_ string, _ any) any {
+				return []map[string]any{{"type": "text", "text": "[truncated]"}}
+			},
+			wantText: "[truncated]",
+			wantTool: "mcp__calc__add",
+		},
+		{
+			name:      "panic_keeps_original",
+			processor: func(_ string, _ any) any { panic("boom") },
+			wantText:  "line one",
+			wantTool:  "mcp__calc__add",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := setupMcpTestContext(t, 5*time.Second)
+			defer cancel()
+
+			server := newMockMcpServer("calc", "1.0.0")
+			server.callResult = &McpToolResult{Content: []McpContent{{Type: "text", Text: "line one"}}}
+
+			var seenTool string
+			processor := func(toolName string, content any) any {
+				seenTool = toolName
+				return tt.processor(toolName, content)
+			}
+
+			transport := newMcpMockTransport()
+			p := NewProtocol(transport,
+				WithSdkMcpServers(map[string]McpServer{"calc": server}),
+				WithToolResultPostProcessor(processor))
+
+			request := map[string]any{
+				"server_name": "calc",
+				"message": map[string]any{
+					"jsonrpc": "2.0",
+					"id":      1,
+					"method":  "tools/call",
+					"params":  map[string]any{"name": "add", "arguments": map[string]any{}},
+				},
+			}
+			if err := p.handleMcpMessageRequest(ctx, "req_1", request); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if seenTool != tt.wantTool {
+				t.Errorf("toolName = %q, want %q", seenTool, tt.wantTool)
+			}
+
+			var response struct {
+				Response struct {
+					Response struct {
+						McpResponse struct {
+							Result struct {
+								Content []map[string]any `json:"content"`
+							} `json:"result"`
+						} `json:"mcp_response"`
+					} `json:"response"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal(transport.sentData[0], &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			content := response.Response.Response.McpResponse.Result.Content
+			if len(content) != 1 || content[0]["text"] != tt.wantText {
+				t.Errorf("content = %v, want single text %q", content, tt.wantText)
+			}
+		})
+	}
+}
+
+// TestMcpSdkTrace tests the trace receives the method and raw params of each
+// request dispatched to an SDK MCP server
+func TestMcpSdkTrace(t *testing.T) {
+	type traced struct {
+		method string
+		params json.RawMessage
+	}
+
+	tests := []struct {
+		name       string
+		serverName string
+		message    map[string]any
+		panics     bool
+		want       []traced
+	}{
+		{
+			name:       "tool_call",
+			serverName: "calc",
+			message: map[string]any{
+				"jsonrpc": "2.0",
+				"id":      7,
+				"method":  "tools/call",
+				"params":  map[string]any{"name": "add", "arguments": map[string]any{"a": 1, "b": 2}},
+			},
+			want: []traced{{method: "tools/call", params: json.RawMessage(`{"arguments":{"a":1,"b":2},"name":"add"}`)}},
+		},
+		{
+			name:       "request_without_params",
+			serverName: "calc",
+			message:    map[string]any{"jsonrpc": "2.0", "id": 1, "method": "tools/list"},
+			want:       []traced{{method: "tools/list"}},
+		},
+		{
+			name:       "panic_does_not_affect_request",
+			serverName: "calc",
+			message: map[string]any{
+				"jsonrpc": "2.0",
+				"id":      2,
+				"method":  "tools/call",
+				"params":  map[string]any{"name": "add"},
+			},
+			panics: true,
+			want:   []traced{{method: "tools/call", params: json.RawMessage(`{"name":"add"}`)}},
+		},
+		{
+			name:       "unknown_server_not_traced",
+			serverName: "missing",
+			message:    map[string]any{"jsonrpc": "2.0", "id": 3, "method": "tools/list"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := setupMcpTestContext(t, 5*time.Second)
+			defer cancel()
+
+			server := newMockMcpServer("calc", "1.0.0")
+			server.callResult = &McpToolResult{Content: []McpContent{{Type: "text", Text: "3"}}}
+
+			var seen []traced
+			trace := func(method string, params json.RawMessage) {
+				seen = append(seen, traced{method: method, params: params})
+				if tt.panics {
+					panic("boom")
+				}
+			}
+
+			transport := newMcpMockTransport()
+			p := NewProtocol(transport,
+				WithSdkMcpServers(map[string]McpServer{"calc": server}),
+				WithSdkMcpTrace(trace))
+
+			request := map[string]any{"server_name": tt.serverName, "message": tt.message}
+			if err := p.handleMcpMessageRequest(ctx, "req_1", request); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(seen) != len(tt.want) {
+				t.Fatalf("Expected %d traced requests, got %d: %v", len(tt.want), len(seen), seen)
+			}
+			for i, want := range tt.want {
+				if seen[i].method != want.method || string(seen[i].params) != string(want.params) {
+					t.Errorf("traced[%d] = %s %s, want %s %s",
+						i, seen[i].method, seen[i].params, want.method, want.params)
+				}
+			}
+			if len(transport.sentData) != 1 {
+				t.Errorf("Expected 1 response to be sent, got %d", len(transport.sentData))
+			}
+		})
+	}
+}
+
 // =============================================================================
 // Mock Types
 // =============================================================================
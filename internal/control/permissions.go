@@ -22,11 +22,12 @@ func (p *Protocol) handleCanUseToolRequest(ctx context.Context, requestID string
 		input = make(map[string]any)
 	}
 
-	// Parse suggestions from context
+	// Parse suggestions and requesting agent from context
 	var permCtx ToolPermissionContext
 	if suggestions, ok := request["permission_suggestions"].([]any); ok {
 		permCtx.Suggestions = parsePermissionSuggestions(suggestions)
 	}
+	permCtx.AgentID, _ = request["agent_id"].(string)
 
 	// Get callback (thread-safe read)
 	p.mu.Lock()
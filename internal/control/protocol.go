@@ -57,6 +57,12 @@ type Protocol struct {
 	// SDK MCP servers for in-process tool handling (Issue #7)
 	sdkMcpServers map[string]McpServer
 
+	// Transforms SDK MCP tool results before they are returned to the CLI
+	toolResultPostProcessor ToolResultPostProcessor
+
+	// Observes JSON-RPC requests dispatched to SDK MCP servers
+	sdkMcpTrace SdkMcpTraceFunc
+
 	// Background goroutine management
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -105,6 +111,22 @@ func WithSdkMcpServers(servers map[string]McpServer) ProtocolOption {
 	}
 }
 
+// WithToolResultPostProcessor sets a function that transforms SDK MCP tool
+// results before they are returned to the CLI.
+func WithToolResultPostProcessor(processor ToolResultPostProcessor) ProtocolOption {
+	return func(p *Protocol) {
+		p.toolResultPostProcessor = processor
+	}
+}
+
+// WithSdkMcpTrace sets a function that observes each JSON-RPC request
+// dispatched to an SDK MCP server.
+func WithSdkMcpTrace(trace SdkMcpTraceFunc) ProtocolOption {
+	return func(p *Protocol) {
+		p.sdkMcpTrace = trace
+	}
+}
+
 // NewProtocol creates a new control protocol handler.
 func NewProtocol(transport Transport, opts ...ProtocolOption) *Protocol {
 	p := &Protocol{
@@ -1383,6 +1383,7 @@ func TestPermissionCallback(t *testing.T) {
 	t.Run("callback_error", testPermissionCallbackError)
 	t.Run("no_callback_registered", testPermissionNoCallbackRegistered)
 	t.Run("callback_panic_recovery", testPermissionCallbackPanicRecovery)
+	t.Run("agent_id_in_context", testPermissionAgentIDInContext)
 }
 
 func testPermissionAllowCallback(t *testing.T) {
@@ -1809,6 +1810,47 @@ func testPermissionCallbackPanicRecovery(t *testing.T) {
 	assertControlEqual(t, ResponseSubtypeError, resp.Response.Subtype)
 }
 
+func testPermissionAgentIDInContext(t *testing.T) {
+	t.Helper()
+
+	ctx, cancel := setupControlTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newControlMockTransport()
+
+	var agentIDs []string
+	callback := func(_ context.Context, _ string, _ map[string]any, permCtx ToolPermissionContext) (PermissionResult, error) {
+		agentIDs = append(agentIDs, permCtx.AgentID)
+		return NewPermissionResultAllow(), nil
+	}
+
+	protocol := NewProtocol(transport, WithCanUseToolCallback(callback))
+
+	err := protocol.Start(ctx)
+	assertControlNoError(t, err)
+	defer func() { _ = protocol.Close() }()
+
+	// Subagent request carries agent_id; main agent request does not
+	for i, inner := range []map[string]any{
+		{"subtype": SubtypeCanUseTool, "tool_name": "Bash", "input": map[string]any{}, "agent_id": "reviewer"},
+		{"subtype": SubtypeCanUseTool, "tool_name": "Bash", "input": map[string]any{}},
+	} {
+		request := map[string]any{
+			"type":       MessageTypeControlRequest,
+			"request_id": fmt.Sprintf("req_perm_agent_%d", i),
+			"request":    inner,
+		}
+		err = protocol.HandleIncomingMessage(ctx, request)
+		assertControlNoError(t, err)
+	}
+
+	if len(agentIDs) != 2 {
+		t.Fatalf("expected 2 callback invocations, got %d", len(agentIDs))
+	}
+	assertControlEqual(t, "reviewer", agentIDs[0])
+	assertControlEqual(t, "", agentIDs[1])
+}
+
 // TestPermissionTypeSerialization tests JSON serialization of permission types.
 func TestPermissionTypeSerialization(t *testing.T) {
 	t.Run("marshal_allow_result", testMarshalPermissionAllowResult)
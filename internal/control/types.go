@@ -4,6 +4,7 @@ package control
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
@@ -183,6 +184,9 @@ type ToolPermissionContext struct {
 	Signal any `json:"-"`
 	// Suggestions contains permission suggestions from CLI.
 	Suggestions []PermissionUpdate `json:"suggestions,omitempty"`
+	// AgentID identifies the subagent requesting the tool.
+	// Empty when the request comes from the main agent.
+	AgentID string `json:"agent_id,omitempty"`
 }
 
 // PermissionResult is the interface for permission callback results.
@@ -268,3 +272,12 @@ type (
 	// McpContent represents content returned by a tool.
 	McpContent = shared.McpContent
 )
+
+// ToolResultPostProcessor transforms a tool result's content before it is
+// returned to the model. It receives the tool name and the current content
+// and returns the replacement content.
+type ToolResultPostProcessor func(toolName string, content any) any
+
+// SdkMcpTraceFunc receives the JSON-RPC method and raw params of each request
+// dispatched to an SDK MCP server. params is nil if the request has none.
+type SdkMcpTraceFunc func(method string, params json.RawMessage)
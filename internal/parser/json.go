@@ -4,8 +4,10 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
@@ -18,9 +20,10 @@ const (
 // Parser handles JSON message parsing with speculative parsing and buffer management.
 // It implements the same speculative parsing strategy as the Python SDK.
 type Parser struct {
-	buffer        strings.Builder
-	maxBufferSize int
-	mu            sync.Mutex // Thread safety
+	buffer             strings.Builder
+	maxBufferSize      int
+	strictContentTypes bool
+	mu                 sync.Mutex // Thread safety
 }
 
 // New creates a new JSON parser with default buffer size.
@@ -30,18 +33,35 @@ func New() *Parser {
 	}
 }
 
+// SetStrictContentTypes controls how content blocks of unknown type are
+// handled. By default they are skipped; when strict, the message fails to
+// parse with a MessageParseError carrying the block's raw data.
+func (p *Parser) SetStrictContentTypes(strict bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strictContentTypes = strict
+}
+
 // ProcessLine processes a line of JSON input with speculative parsing.
 // Handles multiple JSON objects on single line and embedded newlines.
 func (p *Parser) ProcessLine(line string) ([]shared.Message, error) {
+	messages, _, err := p.ProcessLineRaw(line)
+	return messages, err
+}
+
+// ProcessLineRaw is like ProcessLine but also returns the complete JSON object
+// each message was parsed from, index-aligned with the returned messages.
+func (p *Parser) ProcessLineRaw(line string) ([]shared.Message, []string, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	line = strings.TrimSpace(line)
 	if line == "" {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	var messages []shared.Message
+	var raws []string
 
 	// Handle multiple JSON objects on single line by splitting on newlines
 	jsonLines := strings.Split(line, "\n")
@@ -52,16 +72,17 @@ func (p *Parser) ProcessLine(line string) ([]shared.Message, error) {
 		}
 
 		// Process each JSON line with speculative parsing (unlocked version)
-		msg, err := p.processJSONLineUnlocked(jsonLine)
+		msg, raw, err := p.processJSONLineUnlocked(jsonLine)
 		if err != nil {
-			return messages, err
+			return messages, raws, err
 		}
 		if msg != nil {
 			messages = append(messages, msg)
+			raws = append(raws, raw)
 		}
 	}
 
-	return messages, nil
+	return messages, raws, nil
 }
 
 // ParseMessage parses a raw JSON object into the appropriate Message type.
@@ -117,19 +138,21 @@ func (p *Parser) processJSONLine(jsonLine string) (shared.Message, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	return p.processJSONLineUnlocked(jsonLine)
+	msg, _, err := p.processJSONLineUnlocked(jsonLine)
+	return msg, err
 }
 
 // processJSONLineUnlocked is the unlocked version of processJSONLine.
+// It also returns the complete JSON object once one has been parsed.
 // Must be called with mutex already held.
-func (p *Parser) processJSONLineUnlocked(jsonLine string) (shared.Message, error) {
+func (p *Parser) processJSONLineUnlocked(jsonLine string) (shared.Message, string, error) {
 	p.buffer.WriteString(jsonLine)
 
 	// Check buffer size limit
 	if p.buffer.Len() > p.maxBufferSize {
 		bufferSize := p.buffer.Len()
 		p.buffer.Reset()
-		return nil, shared.NewJSONDecodeError(
+		return nil, "", shared.NewJSONDecodeError(
 			"buffer overflow",
 			0,
 			fmt.Errorf("buffer size %d exceeds limit %d", bufferSize, p.maxBufferSize),
@@ -143,12 +166,16 @@ func (p *Parser) processJSONLineUnlocked(jsonLine string) (shared.Message, error
 	if err := json.Unmarshal([]byte(bufferContent), &rawData); err != nil {
 		// JSON is incomplete - continue accumulating
 		// This is NOT an error condition in speculative parsing!
-		return nil, nil
+		return nil, "", nil
 	}
 
 	// Successfully parsed complete JSON - reset buffer and parse message
 	p.buffer.Reset()
-	return p.ParseMessage(rawData)
+	msg, err := p.ParseMessage(rawData)
+	if result, ok := msg.(*shared.ResultMessage); ok {
+		result.Raw = json.RawMessage(bufferContent)
+	}
+	return msg, bufferContent, err
 }
 
 // parseUserMessage parses a user message from raw JSON data.
@@ -192,13 +219,9 @@ func (p *Parser) parseUserMessage(data map[string]any) (*shared.UserMessage, err
 		}, nil
 	case []any:
 		// Array of content blocks
-		blocks := make([]shared.ContentBlock, len(c))
-		for i, blockData := range c {
-			block, err := p.parseContentBlock(blockData)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse content block %d: %w", i, err)
-			}
-			blocks[i] = block
+		blocks, err := p.parseContentBlocks(c)
+		if err != nil {
+			return nil, err
 		}
 		return &shared.UserMessage{
 			Content:         blocks,
@@ -228,14 +251,11 @@ func (p *Parser) parseAssistantMessage(data map[string]any) (*shared.AssistantMe
 		return nil, shared.NewMessageParseError("assistant message missing model field", data)
 	}
 
-	blocks := make([]shared.ContentBlock, len(contentArray))
-	for i, blockData := range contentArray {
-		block, err := p.parseContentBlock(blockData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse content block %d: %w", i, err)
-		}
-		blocks[i] = block
+	blocks, err := p.parseContentBlocks(contentArray)
+	if err != nil {
+		return nil, err
 	}
+	linkWebSearchQueries(blocks)
 
 	// Parse optional error field
 	var errorPtr *shared.AssistantMessageError
@@ -277,12 +297,14 @@ func (p *Parser) parseResultMessage(data map[string]any) (*shared.ResultMessage,
 
 	if durationMS, ok := data["duration_ms"].(float64); ok {
 		result.DurationMs = int(durationMS)
+		result.Duration = millisecondsToDuration(durationMS)
 	} else {
 		return nil, shared.NewMessageParseError("result message missing or invalid duration_ms field", data)
 	}
 
 	if durationAPIMS, ok := data["duration_api_ms"].(float64); ok {
 		result.DurationAPIMs = int(durationAPIMS)
+		result.APIDuration = millisecondsToDuration(durationAPIMS)
 	} else {
 		return nil, shared.NewMessageParseError("result message missing or invalid duration_api_ms field", data)
 	}
@@ -325,9 +347,141 @@ func (p *Parser) parseResultMessage(data map[string]any) (*shared.ResultMessage,
 		result.StructuredOutput = structuredOutput
 	}
 
+	result.ErrorType = resultErrorType(data, result)
+
 	return result, nil
 }
 
+// resultSubtypeErrors maps CLI error result subtypes that name a specific
+// cause. error_during_execution is only used when nothing more specific is known.
+var resultSubtypeErrors = map[string]shared.ResultErrorType{
+	"error_max_turns":                     shared.ResultErrorMaxTurns,
+	"error_max_budget_usd":                shared.ResultErrorMaxBudget,
+	"error_max_structured_output_retries": shared.ResultErrorStructuredOutput,
+}
+
+// resultAPIErrors maps API error types and codes, as found in a result's
+// error field, to result error types.
+var resultAPIErrors = map[string]shared.ResultErrorType{
+	"rate_limit_error":      shared.ResultErrorRateLimit,
+	"rate_limit":            shared.ResultErrorRateLimit,
+	"invalid_request_error": shared.ResultErrorInvalidRequest,
+	"invalid_request":       shared.ResultErrorInvalidRequest,
+	"authentication_error":  shared.ResultErrorAuthFailed,
+	"authentication_failed": shared.ResultErrorAuthFailed,
+	"permission_error":      shared.ResultErrorAuthFailed,
+	"billing_error":         shared.ResultErrorBilling,
+	"overloaded_error":      shared.ResultErrorOverloaded,
+	"api_error":             shared.ResultErrorServer,
+	"server_error":          shared.ResultErrorServer,
+}
+
+// apiErrorStatus matches the HTTP status the CLI reports in API error results,
+// e.g. "API Error: 429 {...}".
+var apiErrorStatus = regexp.MustCompile(`^API Error: (\d{3})\b`)
+
+// resultErrorType categorizes an error result from its subtype, its error
+// field (a string code or an object with a type), or the API status code in
+// its result text. Returns empty for successful results.
+func resultErrorType(data map[string]any, result *shared.ResultMessage) shared.ResultErrorType {
+	if !result.IsError && !strings.HasPrefix(result.Subtype, "error") {
+		return ""
+	}
+
+	if errorType, ok := resultSubtypeErrors[result.Subtype]; ok {
+		return errorType
+	}
+
+	var code string
+	switch v := data["error"].(type) {
+	case string:
+		code = v
+	case map[string]any:
+		code, _ = v["type"].(string)
+		if nested, ok := v["error"].(map[string]any); ok && code == "error" {
+			code, _ = nested["type"].(string) // Anthropic API error envelope
+		}
+	}
+	if errorType, ok := resultAPIErrors[code]; ok {
+		return errorType
+	}
+
+	if result.Result != nil {
+		if match := apiErrorStatus.FindStringSubmatch(*result.Result); match != nil {
+			if errorType := httpStatusErrorType(match[1]); errorType != "" {
+				return errorType
+			}
+		}
+	}
+
+	if result.Subtype == "error_during_execution" {
+		return shared.ResultErrorExecution
+	}
+	return shared.ResultErrorUnknown
+}
+
+// httpStatusErrorType maps an API HTTP status code to a result error type,
+// or returns empty for unrecognized codes.
+func httpStatusErrorType(status string) shared.ResultErrorType {
+	switch status {
+	case "429":
+		return shared.ResultErrorRateLimit
+	case "400", "404", "413":
+		return shared.ResultErrorInvalidRequest
+	case "401", "403":
+		return shared.ResultErrorAuthFailed
+	case "402":
+		return shared.ResultErrorBilling
+	case "529":
+		return shared.ResultErrorOverloaded
+	}
+	if strings.HasPrefix(status, "5") {
+		return shared.ResultErrorServer
+	}
+	return ""
+}
+
+// millisecondsToDuration converts a JSON millisecond count, which may be
+// fractional, to a time.Duration.
+func millisecondsToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// parseContentBlocks parses an array of content blocks. Blocks of unknown
+// type are skipped unless strict content types are enabled.
+func (p *Parser) parseContentBlocks(blocksData []any) ([]shared.ContentBlock, error) {
+	blocks := make([]shared.ContentBlock, 0, len(blocksData))
+	for i, blockData := range blocksData {
+		if !p.strictContentTypes && isUnknownContentBlock(blockData) {
+			continue
+		}
+		block, err := p.parseContentBlock(blockData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse content block %d: %w", i, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// isUnknownContentBlock reports whether blockData is a block object whose
+// type is neither built in nor registered. Malformed blocks are not unknown.
+func isUnknownContentBlock(blockData any) bool {
+	data, ok := blockData.(map[string]any)
+	if !ok {
+		return false
+	}
+	blockType, ok := data["type"].(string)
+	if !ok {
+		return false
+	}
+	if isBuiltinContentBlockType(blockType) {
+		return false
+	}
+	_, registered := registeredContentBlockParser(blockType)
+	return !registered
+}
+
 // parseContentBlock parses a content block based on its type field.
 func (p *Parser) parseContentBlock(blockData any) (shared.ContentBlock, error) {
 	data, ok := blockData.(map[string]any)
@@ -349,7 +503,17 @@ func (p *Parser) parseContentBlock(blockData any) (shared.ContentBlock, error) {
 		return p.parseToolUseBlock(data)
 	case shared.ContentBlockTypeToolResult:
 		return p.parseToolResultBlock(data)
+	case shared.ContentBlockTypeServerToolUse:
+		return p.parseServerToolUseBlock(data)
+	case shared.ContentBlockTypeWebSearchToolResult:
+		return p.parseWebSearchResultBlock(data)
 	default:
+		if isServerToolResultType(blockType) {
+			return p.parseServerToolResultBlock(blockType, data)
+		}
+		if parser, ok := registeredContentBlockParser(blockType); ok {
+			return parseRegisteredBlock(blockType, parser, data)
+		}
 		return nil, shared.NewMessageParseError(
 			fmt.Sprintf("unknown content block type: %s", blockType),
 			data,
@@ -362,7 +526,65 @@ func (p *Parser) parseTextBlock(data map[string]any) (shared.ContentBlock, error
 	if !ok {
 		return nil, shared.NewMessageParseError("text block missing text field", data)
 	}
-	return &shared.TextBlock{Text: text}, nil
+	return &shared.TextBlock{
+		Text:      text,
+		Citations: parseCitations(data["citations"]),
+	}, nil
+}
+
+// parseCitations extracts citation metadata attached to a text block.
+// Malformed entries are skipped rather than failing the whole block.
+func parseCitations(raw any) []shared.Citation {
+	entries, ok := raw.([]any)
+	if !ok || len(entries) == 0 {
+		return nil
+	}
+
+	citations := make([]shared.Citation, 0, len(entries))
+	for _, entry := range entries {
+		data, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		citationType, ok := data["type"].(string)
+		if !ok {
+			continue
+		}
+		citedText, _ := data["cited_text"].(string)
+		citations = append(citations, shared.Citation{
+			Type:            citationType,
+			CitedText:       citedText,
+			DocumentIndex:   optionalInt(data, "document_index"),
+			DocumentTitle:   optionalString(data, "document_title"),
+			StartCharIndex:  optionalInt(data, "start_char_index"),
+			EndCharIndex:    optionalInt(data, "end_char_index"),
+			StartPageNumber: optionalInt(data, "start_page_number"),
+			EndPageNumber:   optionalInt(data, "end_page_number"),
+			StartBlockIndex: optionalInt(data, "start_block_index"),
+			EndBlockIndex:   optionalInt(data, "end_block_index"),
+			URL:             optionalString(data, "url"),
+			Title:           optionalString(data, "title"),
+			Source:          optionalString(data, "source"),
+		})
+	}
+	return citations
+}
+
+// optionalInt returns a pointer to a numeric field, or nil if absent or not a number.
+func optionalInt(data map[string]any, key string) *int {
+	if v, ok := data[key].(float64); ok {
+		i := int(v)
+		return &i
+	}
+	return nil
+}
+
+// optionalString returns a pointer to a string field, or nil if absent or not a string.
+func optionalString(data map[string]any, key string) *string {
+	if v, ok := data[key].(string); ok {
+		return &v
+	}
+	return nil
 }
 
 func (p *Parser) parseThinkingBlock(data map[string]any) (shared.ContentBlock, error) {
@@ -417,6 +639,100 @@ func (p *Parser) parseToolResultBlock(data map[string]any) (shared.ContentBlock,
 	}, nil
 }
 
+func (p *Parser) parseServerToolUseBlock(data map[string]any) (shared.ContentBlock, error) {
+	id, ok := data["id"].(string)
+	if !ok {
+		return nil, shared.NewMessageParseError("server_tool_use block missing id field", data)
+	}
+	name, ok := data["name"].(string)
+	if !ok {
+		return nil, shared.NewMessageParseError("server_tool_use block missing name field", data)
+	}
+	input, _ := data["input"].(map[string]any) // Optional field
+	if input == nil {
+		input = make(map[string]any)
+	}
+	return &shared.ServerToolUseBlock{
+		ToolUseID: id,
+		Name:      name,
+		Input:     input,
+	}, nil
+}
+
+// parseServerToolResultBlock parses results of built-in server tools that have
+// no dedicated block type, keeping the content as raw JSON data.
+func (p *Parser) parseServerToolResultBlock(blockType string, data map[string]any) (shared.ContentBlock, error) {
+	toolUseID, ok := data["tool_use_id"].(string)
+	if !ok {
+		return nil, shared.NewMessageParseError(blockType+" block missing tool_use_id field", data)
+	}
+	return &shared.ServerToolResultBlock{
+		MessageType: blockType,
+		ToolUseID:   toolUseID,
+		Content:     data["content"],
+	}, nil
+}
+
+// isServerToolResultType reports whether blockType is a built-in server tool
+// result, such as web_fetch_tool_result.
+func isServerToolResultType(blockType string) bool {
+	return blockType != shared.ContentBlockTypeToolResult && strings.HasSuffix(blockType, "_tool_result")
+}
+
+// parseWebSearchResultBlock parses web search results. Content is either a
+// list of web_search_result entries or a web_search_tool_result_error object.
+func (p *Parser) parseWebSearchResultBlock(data map[string]any) (shared.ContentBlock, error) {
+	toolUseID, ok := data["tool_use_id"].(string)
+	if !ok {
+		return nil, shared.NewMessageParseError("web_search_tool_result block missing tool_use_id field", data)
+	}
+
+	block := &shared.WebSearchResultBlock{ToolUseID: toolUseID}
+	switch content := data["content"].(type) {
+	case []any:
+		block.Results = make([]shared.WebSearchResult, 0, len(content))
+		for _, entry := range content {
+			result, ok := entry.(map[string]any)
+			if !ok {
+				continue
+			}
+			url, _ := result["url"].(string)
+			title, _ := result["title"].(string)
+			encrypted, _ := result["encrypted_content"].(string)
+			block.Results = append(block.Results, shared.WebSearchResult{
+				URL:              url,
+				Title:            title,
+				EncryptedContent: encrypted,
+				PageAge:          optionalString(result, "page_age"),
+			})
+		}
+	case map[string]any:
+		errorCode, _ := content["error_code"].(string)
+		block.ErrorCode = errorCode
+	default:
+		return nil, shared.NewMessageParseError("web_search_tool_result block content must be array or error object", data)
+	}
+	return block, nil
+}
+
+// linkWebSearchQueries copies the query from each server_tool_use block onto
+// the web search results it produced.
+func linkWebSearchQueries(blocks []shared.ContentBlock) {
+	queries := make(map[string]string)
+	for _, block := range blocks {
+		if toolUse, ok := block.(*shared.ServerToolUseBlock); ok {
+			if query, ok := toolUse.Input["query"].(string); ok {
+				queries[toolUse.ToolUseID] = query
+			}
+		}
+	}
+	for _, block := range blocks {
+		if result, ok := block.(*shared.WebSearchResultBlock); ok && result.Query == "" {
+			result.Query = queries[result.ToolUseID]
+		}
+	}
+}
+
 // parseStreamEventMessage parses a stream event message from raw JSON data.
 func (p *Parser) parseStreamEventMessage(data map[string]any) (*shared.StreamEvent, error) {
 	uuid, ok := data["uuid"].(string)
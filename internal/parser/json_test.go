@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
@@ -407,6 +408,41 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+// TestProcessLineRaw tests raw JSON objects are returned aligned with their messages
+func TestProcessLineRaw(t *testing.T) {
+	parser := setupParserTest(t)
+
+	messages, raws, err := parser.ProcessLineRaw(`{"type": "user", "message":`)
+	assertNoParseError(t, err)
+	if len(messages) != 0 || len(raws) != 0 {
+		t.Fatalf("Expected nothing for incomplete JSON, got %d messages and %d raws", len(messages), len(raws))
+	}
+
+	messages, raws, err = parser.ProcessLineRaw(` {"content": "Hello"}}` + "\n" + `{"type":"system","subtype":"status"}`)
+	assertNoParseError(t, err)
+	if len(messages) != 2 || len(raws) != 2 {
+		t.Fatalf("Expected 2 messages and 2 raws, got %d and %d", len(messages), len(raws))
+	}
+	if raws[0] != `{"type": "user", "message":{"content": "Hello"}}` {
+		t.Errorf("Expected the reassembled user object, got %s", raws[0])
+	}
+	if raws[1] != `{"type":"system","subtype":"status"}` {
+		t.Errorf("Expected the system object, got %s", raws[1])
+	}
+
+	// Result messages keep the object they were parsed from
+	resultLine := `{"type":"result","subtype":"error_during_execution","duration_ms":1,"duration_api_ms":1,` +
+		`"is_error":true,"num_turns":1,"session_id":"s1","error":{"type":"overloaded_error","request_id":"req_1"}}`
+	messages, _, err = parser.ProcessLineRaw(resultLine)
+	assertNoParseError(t, err)
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	if result, ok := messages[0].(*shared.ResultMessage); !ok || string(result.Raw) != resultLine {
+		t.Errorf("Expected the result to keep its original JSON, got %#v", messages[0])
+	}
+}
+
 // TestSpeculativeJSONParsing tests incomplete JSON handling
 func TestSpeculativeJSONParsing(t *testing.T) {
 	parser := setupParserTest(t)
@@ -754,7 +790,7 @@ func TestParseErrorConditions(t *testing.T) {
 				"type": "assistant",
 				"message": map[string]any{
 					"content": []any{
-						map[string]any{"type": "unknown_block"},
+						map[string]any{"type": "text"},
 					},
 					"model": "claude-3",
 				},
@@ -926,6 +962,204 @@ func TestResultMessageOptionalFields(t *testing.T) {
 	}
 }
 
+// TestResultMessageDurations tests turn timings are exposed as time.Duration
+func TestResultMessageDurations(t *testing.T) {
+	parser := setupParserTest(t)
+
+	line := `{"type":"result","subtype":"success","duration_ms":12345.5,"duration_api_ms":8000,` +
+		`"is_error":false,"num_turns":3,"session_id":"s1"}`
+	messages, err := parser.ProcessLine(line)
+	assertNoParseError(t, err)
+	assertMessageCount(t, messages, 1)
+
+	result, ok := messages[0].(*shared.ResultMessage)
+	if !ok {
+		t.Fatalf("Expected ResultMessage, got %T", messages[0])
+	}
+	if result.Duration != 12345500*time.Microsecond {
+		t.Errorf("Expected Duration 12.3455s, got %v", result.Duration)
+	}
+	if result.APIDuration != 8*time.Second {
+		t.Errorf("Expected APIDuration 8s, got %v", result.APIDuration)
+	}
+	if result.DurationMs != 12345 || result.DurationAPIMs != 8000 {
+		t.Errorf("Expected millisecond fields unchanged, got %d and %d", result.DurationMs, result.DurationAPIMs)
+	}
+}
+
+// TestResultMessageCacheUsage tests prompt cache token counts are parsed from usage
+func TestResultMessageCacheUsage(t *testing.T) {
+	parser := setupParserTest(t)
+
+	line := `{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,` +
+		`"num_turns":1,"session_id":"s1","usage":{"input_tokens":20,"output_tokens":150,` +
+		`"cache_creation_input_tokens":2000,"cache_read_input_tokens":6000}}`
+	messages, err := parser.ProcessLine(line)
+	assertNoParseError(t, err)
+	assertMessageCount(t, messages, 1)
+
+	result, ok := messages[0].(*shared.ResultMessage)
+	if !ok {
+		t.Fatalf("Expected ResultMessage, got %T", messages[0])
+	}
+	expected := shared.Usage{InputTokens: 20, OutputTokens: 150, CacheCreationInputTokens: 2000, CacheReadInputTokens: 6000}
+	if got := result.TokenUsage(); got != expected {
+		t.Errorf("Expected usage %+v, got %+v", expected, got)
+	}
+	if got := result.TokenUsage().CacheHitRate(); got < 0.7481 || got > 0.7482 {
+		t.Errorf("Expected cache hit rate 6000/8020, got %f", got)
+	}
+}
+
+// TestResultMessageErrorType tests CLI error result payloads are mapped to
+// result error types
+func TestResultMessageErrorType(t *testing.T) {
+	const prefix = `{"type":"result","duration_ms":10,"duration_api_ms":5,"num_turns":1,"session_id":"s1",`
+
+	tests := []struct {
+		name   string
+		fields string
+		want   shared.ResultErrorType
+	}{
+		{
+			name:   "success",
+			fields: `"subtype":"success","is_error":false,"result":"Done"`,
+			want:   "",
+		},
+		{
+			name:   "max_turns",
+			fields: `"subtype":"error_max_turns","is_error":true`,
+			want:   shared.ResultErrorMaxTurns,
+		},
+		{
+			name:   "max_budget",
+			fields: `"subtype":"error_max_budget_usd","is_error":true`,
+			want:   shared.ResultErrorMaxBudget,
+		},
+		{
+			name:   "structured_output_retries",
+			fields: `"subtype":"error_max_structured_output_retries","is_error":true`,
+			want:   shared.ResultErrorStructuredOutput,
+		},
+		{
+			name: "rate_limit_from_result_text",
+			fields: `"subtype":"success","is_error":true,` +
+				`"result":"API Error: 429 {\"type\":\"error\",\"error\":{\"type\":\"rate_limit_error\"}}"`,
+			want: shared.ResultErrorRateLimit,
+		},
+		{
+			name:   "invalid_request_from_result_text",
+			fields: `"subtype":"success","is_error":true,"result":"API Error: 400 prompt is too long"`,
+			want:   shared.ResultErrorInvalidRequest,
+		},
+		{
+			name:   "overloaded_from_result_text",
+			fields: `"subtype":"success","is_error":true,"result":"API Error: 529 Overloaded"`,
+			want:   shared.ResultErrorOverloaded,
+		},
+		{
+			name:   "server_from_result_text",
+			fields: `"subtype":"success","is_error":true,"result":"API Error: 503 Service Unavailable"`,
+			want:   shared.ResultErrorServer,
+		},
+		{
+			name:   "error_code_string",
+			fields: `"subtype":"error_during_execution","is_error":true,"error":"authentication_failed"`,
+			want:   shared.ResultErrorAuthFailed,
+		},
+		{
+			name:   "error_object",
+			fields: `"subtype":"error_during_execution","is_error":true,"error":{"type":"billing_error","message":"credit balance too low"}`,
+			want:   shared.ResultErrorBilling,
+		},
+		{
+			name: "api_error_envelope",
+			fields: `"subtype":"error_during_execution","is_error":true,` +
+				`"error":{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			want: shared.ResultErrorOverloaded,
+		},
+		{
+			name:   "tool_failure_during_execution",
+			fields: `"subtype":"error_during_execution","is_error":true,"result":"Bash tool crashed"`,
+			want:   shared.ResultErrorExecution,
+		},
+		{
+			name:   "unrecognized_error",
+			fields: `"subtype":"success","is_error":true,"result":"Something went wrong"`,
+			want:   shared.ResultErrorUnknown,
+		},
+		{
+			name:   "unrecognized_status_code",
+			fields: `"subtype":"success","is_error":true,"result":"API Error: 302 Found"`,
+			want:   shared.ResultErrorUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := setupParserTest(t)
+			messages, err := parser.ProcessLine(prefix + test.fields + "}")
+			assertNoParseError(t, err)
+			assertMessageCount(t, messages, 1)
+
+			result, ok := messages[0].(*shared.ResultMessage)
+			if !ok {
+				t.Fatalf("Expected ResultMessage, got %T", messages[0])
+			}
+			if result.ErrorType != test.want {
+				t.Errorf("Expected ErrorType %q, got %q", test.want, result.ErrorType)
+			}
+		})
+	}
+}
+
+// TestStrictContentTypes tests unknown content blocks are skipped by default
+// and rejected in strict mode
+func TestStrictContentTypes(t *testing.T) {
+	line := `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+		`{"type":"text","text":"before"},` +
+		`{"type":"hologram","frames":[1,2,3]},` +
+		`{"type":"text","text":"after"}]}}`
+
+	t.Run("lenient_skips_unknown_block", func(t *testing.T) {
+		parser := setupParserTest(t)
+
+		messages, err := parser.ProcessLine(line)
+		assertNoParseError(t, err)
+		assertMessageCount(t, messages, 1)
+
+		assistant := messages[0].(*shared.AssistantMessage)
+		assertContentBlockCount(t, assistant.Content, 2)
+		assertTextBlockContent(t, assistant.Content[0], "before")
+		assertTextBlockContent(t, assistant.Content[1], "after")
+	})
+
+	t.Run("strict_rejects_unknown_block", func(t *testing.T) {
+		parser := setupParserTest(t)
+		parser.SetStrictContentTypes(true)
+
+		messages, err := parser.ProcessLine(line)
+		assertParseError(t, err, "unknown content block type: hologram")
+		assertMessageCount(t, messages, 0)
+
+		parseErr := shared.AsMessageParseError(err)
+		if parseErr == nil {
+			t.Fatalf("Expected MessageParseError, got %T", err)
+		}
+		block, ok := parseErr.Data.(map[string]any)
+		if !ok || block["type"] != "hologram" || block["frames"] == nil {
+			t.Errorf("Expected raw block data, got %v", parseErr.Data)
+		}
+	})
+
+	t.Run("lenient_still_rejects_malformed_block", func(t *testing.T) {
+		parser := setupParserTest(t)
+
+		_, err := parser.ProcessLine(`{"type":"user","message":{"content":[{"text":"no type"}]}}`)
+		assertParseError(t, err, "content block missing type field")
+	})
+}
+
 // TestContentBlockErrorConditions tests uncovered content block parsing paths
 func TestContentBlockErrorConditions(t *testing.T) {
 	parser := setupParserTest(t)
@@ -1005,6 +1239,21 @@ func TestContentBlockErrorConditions(t *testing.T) {
 			blockData:   map[string]any{"type": "tool_result", "tool_use_id": 123, "content": "result"},
 			expectError: "tool_result block missing tool_use_id field",
 		},
+		{
+			name:        "server_tool_use_block_missing_id",
+			blockData:   map[string]any{"type": "server_tool_use", "name": "web_search"},
+			expectError: "server_tool_use block missing id field",
+		},
+		{
+			name:        "web_search_result_block_missing_tool_use_id",
+			blockData:   map[string]any{"type": "web_search_tool_result", "content": []any{}},
+			expectError: "web_search_tool_result block missing tool_use_id field",
+		},
+		{
+			name:        "web_search_result_block_invalid_content",
+			blockData:   map[string]any{"type": "web_search_tool_result", "tool_use_id": "srvtoolu_1", "content": "text"},
+			expectError: "web_search_tool_result block content must be array or error object",
+		},
 	}
 
 	for _, test := range tests {
@@ -1059,12 +1308,239 @@ func TestContentBlockOptionalFields(t *testing.T) {
 	}
 }
 
+// TestTextBlockCitations tests parsing of citation metadata attached to text blocks
+func TestTextBlockCitations(t *testing.T) {
+	parser := setupParserTest(t)
+
+	t.Run("assistant_message_with_citations", func(t *testing.T) {
+		line := `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+			`{"type":"text","text":"The grass is green.","citations":[` +
+			`{"type":"char_location","cited_text":"The grass is green.","document_index":0,` +
+			`"document_title":"Nature","start_char_index":0,"end_char_index":19},` +
+			`{"type":"page_location","cited_text":"Sky is blue","document_index":1,` +
+			`"start_page_number":3,"end_page_number":4},` +
+			`{"type":"web_search_result_location","cited_text":"Water is wet",` +
+			`"url":"https://example.com","title":"Example"}]}]}}`
+
+		messages, err := parser.ProcessLine(line)
+		assertNoParseError(t, err)
+		assertMessageCount(t, messages, 1)
+
+		assistant, ok := messages[0].(*shared.AssistantMessage)
+		if !ok {
+			t.Fatalf("Expected AssistantMessage, got %T", messages[0])
+		}
+		assertContentBlockCount(t, assistant.Content, 1)
+		text := assistant.Content[0].(*shared.TextBlock)
+		if len(text.Citations) != 3 {
+			t.Fatalf("Expected 3 citations, got %d", len(text.Citations))
+		}
+
+		charLoc := text.Citations[0]
+		if charLoc.Type != shared.CitationTypeCharLocation || charLoc.CitedText != "The grass is green." {
+			t.Errorf("Unexpected char_location citation: %+v", charLoc)
+		}
+		assertIntPtr(t, "DocumentIndex", charLoc.DocumentIndex, 0)
+		assertIntPtr(t, "StartCharIndex", charLoc.StartCharIndex, 0)
+		assertIntPtr(t, "EndCharIndex", charLoc.EndCharIndex, 19)
+		if charLoc.DocumentTitle == nil || *charLoc.DocumentTitle != "Nature" {
+			t.Errorf("Expected DocumentTitle 'Nature', got %v", charLoc.DocumentTitle)
+		}
+
+		pageLoc := text.Citations[1]
+		assertIntPtr(t, "DocumentIndex", pageLoc.DocumentIndex, 1)
+		assertIntPtr(t, "StartPageNumber", pageLoc.StartPageNumber, 3)
+		assertIntPtr(t, "EndPageNumber", pageLoc.EndPageNumber, 4)
+		if pageLoc.StartCharIndex != nil {
+			t.Errorf("Expected nil StartCharIndex for page_location, got %d", *pageLoc.StartCharIndex)
+		}
+
+		webLoc := text.Citations[2]
+		if webLoc.URL == nil || *webLoc.URL != "https://example.com" {
+			t.Errorf("Expected URL 'https://example.com', got %v", webLoc.URL)
+		}
+		if webLoc.Title == nil || *webLoc.Title != "Example" {
+			t.Errorf("Expected Title 'Example', got %v", webLoc.Title)
+		}
+	})
+
+	t.Run("text_block_without_citations", func(t *testing.T) {
+		block, err := parser.parseContentBlock(map[string]any{"type": "text", "text": "plain"})
+		assertNoParseError(t, err)
+		if citations := block.(*shared.TextBlock).Citations; citations != nil {
+			t.Errorf("Expected nil citations, got %v", citations)
+		}
+	})
+
+	t.Run("malformed_citations_skipped", func(t *testing.T) {
+		block, err := parser.parseContentBlock(map[string]any{
+			"type": "text",
+			"text": "partial",
+			"citations": []any{
+				"not an object",
+				map[string]any{"cited_text": "missing type"},
+				map[string]any{"type": "char_location", "cited_text": "ok"},
+			},
+		})
+		assertNoParseError(t, err)
+		citations := block.(*shared.TextBlock).Citations
+		if len(citations) != 1 || citations[0].CitedText != "ok" {
+			t.Errorf("Expected only the valid citation, got %+v", citations)
+		}
+	})
+}
+
+// TestWebSearchResultBlock tests parsing web search tool use and results
+func TestWebSearchResultBlock(t *testing.T) {
+	parser := setupParserTest(t)
+
+	t.Run("assistant_message_with_web_search", func(t *testing.T) {
+		line := `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+			`{"type":"server_tool_use","id":"srvtoolu_01","name":"web_search","input":{"query":"go 1.18 release date"}},` +
+			`{"type":"web_search_tool_result","tool_use_id":"srvtoolu_01","content":[` +
+			`{"type":"web_search_result","url":"https://go.dev/doc/go1.18","title":"Go 1.18 Release Notes",` +
+			`"encrypted_content":"EqgfCioIARgBIiQ","page_age":"March 15, 2022"},` +
+			`{"type":"web_search_result","url":"https://go.dev/blog/go1.18","title":"Go 1.18 is released!"}]},` +
+			`{"type":"text","text":"Go 1.18 was released in March 2022."}]}}`
+
+		messages, err := parser.ProcessLine(line)
+		assertNoParseError(t, err)
+		assertMessageCount(t, messages, 1)
+
+		assistant, ok := messages[0].(*shared.AssistantMessage)
+		if !ok {
+			t.Fatalf("Expected AssistantMessage, got %T", messages[0])
+		}
+		assertContentBlockCount(t, assistant.Content, 3)
+
+		toolUse, ok := assistant.Content[0].(*shared.ServerToolUseBlock)
+		if !ok {
+			t.Fatalf("Expected ServerToolUseBlock, got %T", assistant.Content[0])
+		}
+		if toolUse.ToolUseID != "srvtoolu_01" || toolUse.Name != "web_search" {
+			t.Errorf("Unexpected server tool use: %+v", toolUse)
+		}
+
+		search, ok := assistant.Content[1].(*shared.WebSearchResultBlock)
+		if !ok {
+			t.Fatalf("Expected WebSearchResultBlock, got %T", assistant.Content[1])
+		}
+		if search.BlockType() != shared.ContentBlockTypeWebSearchToolResult {
+			t.Errorf("Expected block type %q, got %q", shared.ContentBlockTypeWebSearchToolResult, search.BlockType())
+		}
+		if search.ToolUseID != "srvtoolu_01" || search.Query != "go 1.18 release date" {
+			t.Errorf("Expected query linked from server_tool_use, got %+v", search)
+		}
+		if len(search.Results) != 2 {
+			t.Fatalf("Expected 2 results, got %d", len(search.Results))
+		}
+		first := search.Results[0]
+		if first.URL != "https://go.dev/doc/go1.18" || first.Title != "Go 1.18 Release Notes" || first.EncryptedContent != "EqgfCioIARgBIiQ" {
+			t.Errorf("Unexpected first result: %+v", first)
+		}
+		if first.PageAge == nil || *first.PageAge != "March 15, 2022" {
+			t.Errorf("Expected PageAge 'March 15, 2022', got %v", first.PageAge)
+		}
+		if search.Results[1].PageAge != nil {
+			t.Errorf("Expected nil PageAge for second result, got %v", *search.Results[1].PageAge)
+		}
+	})
+
+	t.Run("web_search_error", func(t *testing.T) {
+		block, err := parser.parseContentBlock(map[string]any{
+			"type":        "web_search_tool_result",
+			"tool_use_id": "srvtoolu_02",
+			"content":     map[string]any{"type": "web_search_tool_result_error", "error_code": "max_uses_exceeded"},
+		})
+		assertNoParseError(t, err)
+		search := block.(*shared.WebSearchResultBlock)
+		if search.ErrorCode != "max_uses_exceeded" || search.Results != nil {
+			t.Errorf("Expected error code without results, got %+v", search)
+		}
+	})
+}
+
+// TestServerToolBlocks tests parsing built-in server tools other than web search
+func TestServerToolBlocks(t *testing.T) {
+	parser := setupParserTest(t)
+
+	t.Run("code_execution_use_and_result", func(t *testing.T) {
+		line := `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+			`{"type":"server_tool_use","id":"srvtoolu_03","name":"code_execution","input":{"code":"print(1+1)"}},` +
+			`{"type":"code_execution_tool_result","tool_use_id":"srvtoolu_03","content":` +
+			`{"type":"code_execution_result","stdout":"2\n","stderr":"","return_code":0}}]}}`
+
+		messages, err := parser.ProcessLine(line)
+		assertNoParseError(t, err)
+		assertMessageCount(t, messages, 1)
+
+		assistant, ok := messages[0].(*shared.AssistantMessage)
+		if !ok {
+			t.Fatalf("Expected AssistantMessage, got %T", messages[0])
+		}
+		assertContentBlockCount(t, assistant.Content, 2)
+
+		toolUse, ok := assistant.Content[0].(*shared.ServerToolUseBlock)
+		if !ok {
+			t.Fatalf("Expected ServerToolUseBlock, got %T", assistant.Content[0])
+		}
+		if toolUse.Name != "code_execution" || toolUse.Input["code"] != "print(1+1)" {
+			t.Errorf("Unexpected server tool use: %+v", toolUse)
+		}
+
+		result, ok := assistant.Content[1].(*shared.ServerToolResultBlock)
+		if !ok {
+			t.Fatalf("Expected ServerToolResultBlock, got %T", assistant.Content[1])
+		}
+		if result.BlockType() != "code_execution_tool_result" || result.ToolUseID != "srvtoolu_03" {
+			t.Errorf("Unexpected server tool result: %+v", result)
+		}
+		content, ok := result.Content.(map[string]any)
+		if !ok || content["stdout"] != "2\n" {
+			t.Errorf("Expected raw content to be kept, got %v", result.Content)
+		}
+	})
+
+	t.Run("server_tool_use_without_input", func(t *testing.T) {
+		block, err := parser.parseContentBlock(map[string]any{
+			"type": "server_tool_use",
+			"id":   "srvtoolu_04",
+			"name": "web_fetch",
+		})
+		assertNoParseError(t, err)
+		toolUse := block.(*shared.ServerToolUseBlock)
+		if toolUse.Input == nil || len(toolUse.Input) != 0 {
+			t.Errorf("Expected empty input map, got %v", toolUse.Input)
+		}
+	})
+
+	t.Run("result_missing_tool_use_id", func(t *testing.T) {
+		_, err := parser.parseContentBlock(map[string]any{
+			"type":    "web_fetch_tool_result",
+			"content": map[string]any{"type": "web_fetch_result"},
+		})
+		assertParseError(t, err, "web_fetch_tool_result block missing tool_use_id field")
+	})
+}
+
+// assertIntPtr verifies an optional int field is set to the expected value
+func assertIntPtr(t *testing.T, field string, actual *int, expected int) {
+	t.Helper()
+	if actual == nil {
+		t.Errorf("Expected %s = %d, got nil", field, expected)
+		return
+	}
+	if *actual != expected {
+		t.Errorf("Expected %s = %d, got %d", field, expected, *actual)
+	}
+}
+
 // TestProcessLineEdgeCases tests uncovered ProcessLine scenarios
 func TestProcessLineEdgeCases(t *testing.T) {
 	parser := setupParserTest(t)
 
 	// Test line with content block parse error
-	invalidBlockLine := `{"type": "user", "message": {"content": [{"type": "unknown_block"}]}}`
+	invalidBlockLine := `{"type": "user", "message": {"content": [{"type": "tool_use"}]}}`
 	messages, err := parser.ProcessLine(invalidBlockLine)
 	if err == nil {
 		t.Error("Expected error for invalid content block")
@@ -1766,3 +2242,117 @@ func TestStreamEventErrorConditions(t *testing.T) {
 		})
 	}
 }
+
+// TestParseStreamEventShapes tests stream event lines from the CLI decode into
+// typed ParsedStreamEvents
+func TestParseStreamEventShapes(t *testing.T) {
+	const prefix = `{"type":"stream_event","uuid":"evt-1","session_id":"s1","event":`
+
+	tests := []struct {
+		name     string
+		event    string
+		validate func(*testing.T, shared.ParsedStreamEvent)
+	}{
+		{
+			name:  "text_delta",
+			event: `{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				if parsed.Type != shared.StreamEventTypeContentBlockDelta || parsed.Index != 1 {
+					t.Errorf("expected content_block_delta at index 1, got %q at %d", parsed.Type, parsed.Index)
+				}
+				want := shared.StreamDelta{Type: shared.StreamDeltaTypeText, Text: "Hello"}
+				if parsed.Delta == nil || *parsed.Delta != want {
+					t.Errorf("expected delta %+v, got %+v", want, parsed.Delta)
+				}
+			},
+		},
+		{
+			name:  "input_json_delta",
+			event: `{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				want := shared.StreamDelta{Type: shared.StreamDeltaTypeInputJSON, PartialJSON: `{"path":`}
+				if parsed.Index != 2 || parsed.Delta == nil || *parsed.Delta != want {
+					t.Errorf("expected delta %+v at index 2, got %+v at %d", want, parsed.Delta, parsed.Index)
+				}
+			},
+		},
+		{
+			name:  "content_block_start",
+			event: `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"Read","input":{}}}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				if parsed.Type != shared.StreamEventTypeContentBlockStart || parsed.ContentBlock["name"] != "Read" {
+					t.Errorf("expected content_block_start for Read, got %+v", parsed)
+				}
+				if parsed.Delta != nil || parsed.Message != nil {
+					t.Errorf("expected no delta or message, got %+v", parsed)
+				}
+			},
+		},
+		{
+			name: "message_start",
+			event: `{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant",` +
+				`"model":"claude-sonnet-4-5","content":[],"usage":{"input_tokens":12,"output_tokens":1}}}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				want := shared.StreamMessageStart{ID: "msg_1", Model: "claude-sonnet-4-5", Role: "assistant"}
+				if parsed.Type != shared.StreamEventTypeMessageStart || parsed.Message == nil || *parsed.Message != want {
+					t.Errorf("expected message_start %+v, got %+v", want, parsed.Message)
+				}
+				if parsed.Usage == nil || parsed.Usage.InputTokens != 12 || parsed.Usage.OutputTokens != 1 {
+					t.Errorf("expected usage 12/1, got %+v", parsed.Usage)
+				}
+			},
+		},
+		{
+			name:  "message_delta",
+			event: `{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":42}}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				if parsed.StopReason != "tool_use" || parsed.Usage == nil || parsed.Usage.OutputTokens != 42 {
+					t.Errorf("expected stop reason tool_use with 42 output tokens, got %+v", parsed)
+				}
+			},
+		},
+		{
+			name:  "message_stop",
+			event: `{"type":"message_stop"}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				if parsed.Type != shared.StreamEventTypeMessageStop {
+					t.Errorf("expected message_stop, got %q", parsed.Type)
+				}
+				if parsed.Delta != nil || parsed.Message != nil || parsed.Usage != nil || parsed.Index != 0 {
+					t.Errorf("expected no decoded fields, got %+v", parsed)
+				}
+			},
+		},
+		{
+			name:  "unknown_event",
+			event: `{"type":"ping"}`,
+			validate: func(t *testing.T, parsed shared.ParsedStreamEvent) {
+				t.Helper()
+				if parsed.Type != "ping" || parsed.Raw == nil || parsed.Raw.UUID != "evt-1" {
+					t.Errorf("expected raw ping event, got %+v", parsed)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := setupParserTest(t)
+			messages, err := parser.ProcessLine(prefix + test.event + "}")
+			assertNoParseError(t, err)
+			assertMessageCount(t, messages, 1)
+
+			event, ok := messages[0].(*shared.StreamEvent)
+			if !ok {
+				t.Fatalf("Expected StreamEvent, got %T", messages[0])
+			}
+			test.validate(t, shared.ParseStreamEvent(event))
+		})
+	}
+}
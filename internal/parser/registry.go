@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// ContentBlockParser parses the raw JSON object of a content block into a
+// ContentBlock. Returned errors are wrapped in a MessageParseError.
+type ContentBlockParser func(data map[string]any) (shared.ContentBlock, error)
+
+// contentBlockParsers holds the parsers registered for custom block types.
+var contentBlockParsers = struct {
+	sync.RWMutex
+	byType map[string]ContentBlockParser
+}{byType: make(map[string]ContentBlockParser)}
+
+// RegisterContentBlockParser teaches every parser a content block type the
+// SDK does not know about. Blocks of that type are passed to parser instead
+// of being skipped (or rejected under strict content types). Registering a
+// type again replaces its parser, and a nil parser removes it.
+// It panics if typeName is empty or names a built-in block type.
+func RegisterContentBlockParser(typeName string, parser ContentBlockParser) {
+	if typeName == "" {
+		panic("parser: empty content block type name")
+	}
+	if isBuiltinContentBlockType(typeName) {
+		panic(fmt.Sprintf("parser: cannot replace built-in content block type %q", typeName))
+	}
+
+	contentBlockParsers.Lock()
+	defer contentBlockParsers.Unlock()
+	if parser == nil {
+		delete(contentBlockParsers.byType, typeName)
+		return
+	}
+	contentBlockParsers.byType[typeName] = parser
+}
+
+// registeredContentBlockParser returns the parser registered for blockType.
+func registeredContentBlockParser(blockType string) (ContentBlockParser, bool) {
+	contentBlockParsers.RLock()
+	defer contentBlockParsers.RUnlock()
+	parser, ok := contentBlockParsers.byType[blockType]
+	return parser, ok
+}
+
+// parseRegisteredBlock runs a registered parser, converting its errors,
+// panics, and nil results into a MessageParseError.
+func parseRegisteredBlock(blockType string, parser ContentBlockParser, data map[string]any) (block shared.ContentBlock, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			block = nil
+			err = shared.NewMessageParseError(fmt.Sprintf("%s block parser panicked: %v", blockType, r), data)
+		}
+	}()
+
+	block, err = parser(data)
+	if err != nil {
+		return nil, shared.NewMessageParseError(fmt.Sprintf("failed to parse %s block: %v", blockType, err), data)
+	}
+	if block == nil {
+		return nil, shared.NewMessageParseError(fmt.Sprintf("%s block parser returned no block", blockType), data)
+	}
+	return block, nil
+}
+
+// isBuiltinContentBlockType reports whether the SDK parses blockType itself.
+func isBuiltinContentBlockType(blockType string) bool {
+	switch blockType {
+	case shared.ContentBlockTypeText, shared.ContentBlockTypeThinking,
+		shared.ContentBlockTypeToolUse, shared.ContentBlockTypeToolResult,
+		shared.ContentBlockTypeServerToolUse, shared.ContentBlockTypeWebSearchToolResult:
+		return true
+	}
+	return isServerToolResultType(blockType)
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// TestRegisterContentBlockParser tests custom block types parse into their
+// registered ContentBlock
+func TestRegisterContentBlockParser(t *testing.T) {
+	const diagramLine = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+		`{"type":"text","text":"Here is the flow"},` +
+		`{"type":"diagram","format":"mermaid","source":"graph TD; A-->B"}]}}`
+
+	t.Run("parses_custom_type", func(t *testing.T) {
+		registerTestDiagramParser(t)
+
+		for _, strict := range []bool{false, true} {
+			parser := New()
+			parser.SetStrictContentTypes(strict)
+			messages, err := parser.ProcessLine(diagramLine)
+			if err != nil {
+				t.Fatalf("strict=%v: unexpected error: %v", strict, err)
+			}
+			assistant := messages[0].(*shared.AssistantMessage)
+			if len(assistant.Content) != 2 {
+				t.Fatalf("strict=%v: expected 2 blocks, got %d", strict, len(assistant.Content))
+			}
+			diagram, ok := assistant.Content[1].(*testDiagramBlock)
+			if !ok {
+				t.Fatalf("strict=%v: expected *testDiagramBlock, got %T", strict, assistant.Content[1])
+			}
+			if diagram.Format != "mermaid" || diagram.Source != "graph TD; A-->B" {
+				t.Errorf("strict=%v: unexpected diagram %+v", strict, diagram)
+			}
+		}
+	})
+
+	t.Run("unregistered_type_skipped", func(t *testing.T) {
+		registerTestDiagramParser(t)
+		RegisterContentBlockParser("diagram", nil)
+
+		messages, err := New().ProcessLine(diagramLine)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if blocks := messages[0].(*shared.AssistantMessage).Content; len(blocks) != 1 {
+			t.Errorf("Expected the unregistered block to be skipped, got %d blocks", len(blocks))
+		}
+	})
+
+	parserFailures := []struct {
+		name    string
+		parser  ContentBlockParser
+		wantErr string
+	}{
+		{
+			name: "parser_error",
+			parser: func(map[string]any) (shared.ContentBlock, error) {
+				return nil, errors.New("missing source")
+			},
+			wantErr: "failed to parse diagram block: missing source",
+		},
+		{
+			name: "parser_panic",
+			parser: func(map[string]any) (shared.ContentBlock, error) {
+				panic("boom")
+			},
+			wantErr: "diagram block parser panicked: boom",
+		},
+		{
+			name: "nil_block",
+			parser: func(map[string]any) (shared.ContentBlock, error) {
+				return nil, nil
+			},
+			wantErr: "diagram block parser returned no block",
+		},
+	}
+	for _, test := range parserFailures {
+		t.Run(test.name, func(t *testing.T) {
+			RegisterContentBlockParser("diagram", test.parser)
+			defer RegisterContentBlockParser("diagram", nil)
+
+			_, err := New().ProcessLine(diagramLine)
+			if !shared.IsMessageParseError(err) {
+				t.Fatalf("Expected MessageParseError, got %v", err)
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+
+	invalidNames := []string{"", shared.ContentBlockTypeText, shared.ContentBlockTypeToolUse, "web_fetch_tool_result"}
+	for _, name := range invalidNames {
+		t.Run("rejects_"+name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic registering %q", name)
+				}
+			}()
+			RegisterContentBlockParser(name, func(map[string]any) (shared.ContentBlock, error) {
+				return &testDiagramBlock{}, nil
+			})
+		})
+	}
+}
+
+// testDiagramBlock is a custom content block registered by tests.
+type testDiagramBlock struct {
+	Format string
+	Source string
+}
+
+func (b *testDiagramBlock) BlockType() string { return "diagram" }
+
+// registerTestDiagramParser registers a parser for "diagram" blocks until
+// the test ends.
+func registerTestDiagramParser(t *testing.T) {
+	t.Helper()
+	RegisterContentBlockParser("diagram", func(data map[string]any) (shared.ContentBlock, error) {
+		format, _ := data["format"].(string)
+		source, _ := data["source"].(string)
+		return &testDiagramBlock{Format: format, Source: source}, nil
+	})
+	t.Cleanup(func() { RegisterContentBlockParser("diagram", nil) })
+}
@@ -0,0 +1,181 @@
+package shared
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Delta type constants for content_block_delta stream events.
+const (
+	// StreamDeltaTypeText is the content_block_delta type carrying partial text.
+	StreamDeltaTypeText = "text_delta"
+	// StreamDeltaTypeInputJSON is the content_block_delta type carrying partial tool input JSON.
+	StreamDeltaTypeInputJSON = "input_json_delta"
+	// StreamDeltaTypeThinking is the content_block_delta type carrying partial thinking.
+	StreamDeltaTypeThinking = "thinking_delta"
+	// StreamDeltaTypeSignature is the content_block_delta type carrying a thinking signature.
+	StreamDeltaTypeSignature = "signature_delta"
+)
+
+// PartialToolInput is a tool_use input assembled from input_json_delta stream events.
+type PartialToolInput struct {
+	// ToolUseID is the tool_use block ID from content_block_start.
+	ToolUseID string
+	// Name is the tool name from content_block_start.
+	Name string
+	// Index is the content block index within the streamed message.
+	Index int
+	// ParentToolUseID is set when the tool use belongs to a subagent.
+	ParentToolUseID *string
+	// PartialJSON is the raw input JSON received so far.
+	PartialJSON string
+	// Complete is true once content_block_stop has been received.
+	Complete bool
+}
+
+// Input decodes the assembled JSON into a map.
+// Returns an error if the JSON is not yet complete or is malformed.
+func (p PartialToolInput) Input() (map[string]any, error) {
+	input := make(map[string]any)
+	if p.PartialJSON == "" {
+		return input, nil
+	}
+	if err := json.Unmarshal([]byte(p.PartialJSON), &input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// toolInputKey identifies a streaming tool_use block across main and subagent streams.
+type toolInputKey struct {
+	parentToolUseID string
+	index           int
+}
+
+// ToolInputAccumulator assembles tool_use inputs from partial stream events.
+// Feed every StreamEvent to Accumulate; a message_start event begins a new
+// message and discards blocks from the previous one. It is safe for concurrent use.
+type ToolInputAccumulator struct {
+	mu     sync.Mutex
+	inputs map[toolInputKey]*PartialToolInput
+	order  []toolInputKey
+}
+
+// NewToolInputAccumulator creates an empty accumulator.
+func NewToolInputAccumulator() *ToolInputAccumulator {
+	return &ToolInputAccumulator{
+		inputs: make(map[toolInputKey]*PartialToolInput),
+	}
+}
+
+// Accumulate processes a stream event and returns a snapshot of the tool input
+// it affected, or nil if the event does not relate to tool input streaming.
+func (a *ToolInputAccumulator) Accumulate(event *StreamEvent) *PartialToolInput {
+	if event == nil || event.Event == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := toolInputKey{index: eventIndex(event.Event)}
+	if event.ParentToolUseID != nil {
+		key.parentToolUseID = *event.ParentToolUseID
+	}
+
+	switch event.Event["type"] {
+	case StreamEventTypeMessageStart:
+		a.resetParent(key.parentToolUseID)
+		return nil
+
+	case StreamEventTypeContentBlockStart:
+		block, _ := event.Event["content_block"].(map[string]any)
+		if block == nil || block["type"] != ContentBlockTypeToolUse {
+			return nil
+		}
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+		if _, exists := a.inputs[key]; !exists {
+			a.order = append(a.order, key)
+		}
+		a.inputs[key] = &PartialToolInput{
+			ToolUseID:       id,
+			Name:            name,
+			Index:           key.index,
+			ParentToolUseID: event.ParentToolUseID,
+		}
+		return a.snapshot(key)
+
+	case StreamEventTypeContentBlockDelta:
+		input, exists := a.inputs[key]
+		if !exists {
+			return nil
+		}
+		delta, _ := event.Event["delta"].(map[string]any)
+		if delta == nil || delta["type"] != StreamDeltaTypeInputJSON {
+			return nil
+		}
+		partial, _ := delta["partial_json"].(string)
+		input.PartialJSON += partial
+		return a.snapshot(key)
+
+	case StreamEventTypeContentBlockStop:
+		input, exists := a.inputs[key]
+		if !exists {
+			return nil
+		}
+		input.Complete = true
+		return a.snapshot(key)
+	}
+
+	return nil
+}
+
+// Inputs returns snapshots of all tool inputs in the order their blocks started.
+func (a *ToolInputAccumulator) Inputs() []PartialToolInput {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := make([]PartialToolInput, 0, len(a.order))
+	for _, key := range a.order {
+		result = append(result, *a.inputs[key])
+	}
+	return result
+}
+
+// Reset discards all accumulated tool inputs.
+func (a *ToolInputAccumulator) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inputs = make(map[toolInputKey]*PartialToolInput)
+	a.order = nil
+}
+
+// resetParent discards tool inputs belonging to the given stream.
+// Must be called with mutex already held.
+func (a *ToolInputAccumulator) resetParent(parentToolUseID string) {
+	kept := a.order[:0]
+	for _, key := range a.order {
+		if key.parentToolUseID == parentToolUseID {
+			delete(a.inputs, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	a.order = kept
+}
+
+// snapshot returns a copy of the tool input for key.
+// Must be called with mutex already held.
+func (a *ToolInputAccumulator) snapshot(key toolInputKey) *PartialToolInput {
+	copied := *a.inputs[key]
+	return &copied
+}
+
+// eventIndex extracts the content block index from a stream event.
+func eventIndex(event map[string]any) int {
+	if index, ok := event["index"].(float64); ok {
+		return int(index)
+	}
+	return 0
+}
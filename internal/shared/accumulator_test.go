@@ -0,0 +1,179 @@
+package shared
+
+import (
+	"testing"
+)
+
+// TestToolInputAccumulator tests assembling tool_use inputs from input_json_delta events
+func TestToolInputAccumulator(t *testing.T) {
+	t.Run("assembles_partial_json", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+
+		events := []*StreamEvent{
+			newAccumulatorEvent(map[string]any{"type": StreamEventTypeMessageStart, "message": map[string]any{}}),
+			newToolUseStartEvent(1, "toolu_01", "Bash"),
+			newInputDeltaEvent(1, `{"comm`),
+			newInputDeltaEvent(1, `and": "ls -la",`),
+			newInputDeltaEvent(1, ` "timeout": 5000}`),
+		}
+		var last *PartialToolInput
+		for _, event := range events {
+			if partial := acc.Accumulate(event); partial != nil {
+				last = partial
+			}
+		}
+
+		if last == nil {
+			t.Fatal("Expected partial tool input")
+		}
+		if last.Complete {
+			t.Error("Expected input to be incomplete before content_block_stop")
+		}
+		if last.PartialJSON != `{"command": "ls -la", "timeout": 5000}` {
+			t.Errorf("Unexpected PartialJSON: %q", last.PartialJSON)
+		}
+
+		final := acc.Accumulate(newAccumulatorEvent(map[string]any{"type": StreamEventTypeContentBlockStop, "index": float64(1)}))
+		if final == nil || !final.Complete {
+			t.Fatalf("Expected complete tool input, got %+v", final)
+		}
+		if final.ToolUseID != "toolu_01" || final.Name != "Bash" || final.Index != 1 {
+			t.Errorf("Unexpected tool metadata: %+v", final)
+		}
+
+		input, err := final.Input()
+		if err != nil {
+			t.Fatalf("Unexpected error decoding input: %v", err)
+		}
+		if input["command"] != "ls -la" || input["timeout"] != float64(5000) {
+			t.Errorf("Unexpected assembled input: %v", input)
+		}
+	})
+
+	t.Run("incomplete_json_fails_to_decode", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+		acc.Accumulate(newToolUseStartEvent(0, "toolu_01", "Read"))
+		partial := acc.Accumulate(newInputDeltaEvent(0, `{"file_path": "/tm`))
+
+		if _, err := partial.Input(); err == nil {
+			t.Error("Expected decode error for incomplete JSON")
+		}
+	})
+
+	t.Run("empty_input_decodes_to_empty_map", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+		acc.Accumulate(newToolUseStartEvent(0, "toolu_01", "TodoRead"))
+		final := acc.Accumulate(newAccumulatorEvent(map[string]any{"type": StreamEventTypeContentBlockStop, "index": float64(0)}))
+
+		input, err := final.Input()
+		if err != nil || len(input) != 0 {
+			t.Errorf("Expected empty input, got %v (err: %v)", input, err)
+		}
+	})
+
+	t.Run("ignores_non_tool_events", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+		textStart := newAccumulatorEvent(map[string]any{
+			"type":          StreamEventTypeContentBlockStart,
+			"index":         float64(0),
+			"content_block": map[string]any{"type": "text", "text": ""},
+		})
+		textDelta := newAccumulatorEvent(map[string]any{
+			"type":  StreamEventTypeContentBlockDelta,
+			"index": float64(0),
+			"delta": map[string]any{"type": "text_delta", "text": "hello"},
+		})
+
+		if acc.Accumulate(textStart) != nil || acc.Accumulate(textDelta) != nil {
+			t.Error("Expected nil for text block events")
+		}
+		if acc.Accumulate(nil) != nil {
+			t.Error("Expected nil for nil event")
+		}
+		if len(acc.Inputs()) != 0 {
+			t.Errorf("Expected no inputs, got %d", len(acc.Inputs()))
+		}
+	})
+
+	t.Run("multiple_tools_in_order", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+		acc.Accumulate(newToolUseStartEvent(1, "toolu_a", "Read"))
+		acc.Accumulate(newToolUseStartEvent(2, "toolu_b", "Grep"))
+		acc.Accumulate(newInputDeltaEvent(2, `{"pattern":"x"}`))
+		acc.Accumulate(newInputDeltaEvent(1, `{"file_path":"a.go"}`))
+
+		inputs := acc.Inputs()
+		if len(inputs) != 2 {
+			t.Fatalf("Expected 2 inputs, got %d", len(inputs))
+		}
+		if inputs[0].ToolUseID != "toolu_a" || inputs[0].PartialJSON != `{"file_path":"a.go"}` {
+			t.Errorf("Unexpected first input: %+v", inputs[0])
+		}
+		if inputs[1].ToolUseID != "toolu_b" || inputs[1].PartialJSON != `{"pattern":"x"}` {
+			t.Errorf("Unexpected second input: %+v", inputs[1])
+		}
+	})
+
+	t.Run("message_start_resets_blocks", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+		acc.Accumulate(newToolUseStartEvent(0, "toolu_a", "Read"))
+		acc.Accumulate(newAccumulatorEvent(map[string]any{"type": StreamEventTypeMessageStart}))
+		acc.Accumulate(newToolUseStartEvent(0, "toolu_b", "Bash"))
+
+		inputs := acc.Inputs()
+		if len(inputs) != 1 || inputs[0].ToolUseID != "toolu_b" {
+			t.Errorf("Expected only the new message's input, got %+v", inputs)
+		}
+
+		acc.Reset()
+		if len(acc.Inputs()) != 0 {
+			t.Error("Expected no inputs after Reset")
+		}
+	})
+
+	t.Run("subagent_streams_are_separate", func(t *testing.T) {
+		acc := NewToolInputAccumulator()
+		parent := "toolu_task"
+		acc.Accumulate(newToolUseStartEvent(0, "toolu_main", "Task"))
+
+		sub := newToolUseStartEvent(0, "toolu_sub", "Read")
+		sub.ParentToolUseID = &parent
+		acc.Accumulate(sub)
+
+		subDelta := newInputDeltaEvent(0, `{"file_path":"b.go"}`)
+		subDelta.ParentToolUseID = &parent
+		partial := acc.Accumulate(subDelta)
+
+		if partial.ToolUseID != "toolu_sub" {
+			t.Errorf("Expected delta routed to subagent tool, got %q", partial.ToolUseID)
+		}
+		if len(acc.Inputs()) != 2 {
+			t.Errorf("Expected 2 inputs, got %d", len(acc.Inputs()))
+		}
+	})
+}
+
+func newAccumulatorEvent(event map[string]any) *StreamEvent {
+	return &StreamEvent{UUID: "uuid", SessionID: "session", Event: event}
+}
+
+func newToolUseStartEvent(index int, id, name string) *StreamEvent {
+	return newAccumulatorEvent(map[string]any{
+		"type":  StreamEventTypeContentBlockStart,
+		"index": float64(index),
+		"content_block": map[string]any{
+			"type":  ContentBlockTypeToolUse,
+			"id":    id,
+			"name":  name,
+			"input": map[string]any{},
+		},
+	})
+}
+
+func newInputDeltaEvent(index int, partialJSON string) *StreamEvent {
+	return newAccumulatorEvent(map[string]any{
+		"type":  StreamEventTypeContentBlockDelta,
+		"index": float64(index),
+		"delta": map[string]any{"type": StreamDeltaTypeInputJSON, "partial_json": partialJSON},
+	})
+}
@@ -0,0 +1,71 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// ToolApprovalCache remembers permission decisions keyed by tool name and
+// input, so identical requests are decided without asking again. Inputs are
+// compared by their JSON encoding, which sorts object keys. It is safe for
+// concurrent use.
+type ToolApprovalCache struct {
+	mu        sync.Mutex
+	decisions map[string]any
+}
+
+// NewToolApprovalCache creates an empty cache.
+func NewToolApprovalCache() *ToolApprovalCache {
+	return &ToolApprovalCache{decisions: make(map[string]any)}
+}
+
+// Lookup returns the decision stored for toolName and input, if any.
+func (c *ToolApprovalCache) Lookup(toolName string, input map[string]any) (any, bool) {
+	key, ok := approvalKey(toolName, input)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	decision, found := c.decisions[key]
+	return decision, found
+}
+
+// Store remembers decision for toolName and input. Inputs that cannot be
+// encoded as JSON are not cached.
+func (c *ToolApprovalCache) Store(toolName string, input map[string]any, decision any) {
+	key, ok := approvalKey(toolName, input)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.decisions[key] = decision
+}
+
+// Clear forgets every stored decision.
+func (c *ToolApprovalCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.decisions = make(map[string]any)
+}
+
+// Len returns the number of stored decisions.
+func (c *ToolApprovalCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.decisions)
+}
+
+// approvalKey builds the cache key for toolName and input.
+func approvalKey(toolName string, input map[string]any) (string, bool) {
+	if input == nil {
+		input = map[string]any{}
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s\x00%s", toolName, data), true
+}
@@ -0,0 +1,10 @@
+package shared
+
+// SafeCallback calls fn, recovering any panic so a user callback cannot
+// crash the SDK. Use it for callbacks whose result the SDK does not need.
+func SafeCallback(fn func()) {
+	defer func() {
+		_ = recover()
+	}()
+	fn()
+}
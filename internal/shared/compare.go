@@ -0,0 +1,179 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MessagesEqual reports whether a and b are the same message type with
+// deeply equal fields and content blocks.
+func MessagesEqual(a, b Message) bool {
+	return DiffMessages(a, b) == ""
+}
+
+// DiffMessages returns a readable description of the differences between an
+// expected message a and an actual message b, one difference per line, or ""
+// if they are equal. Messages are compared by their concrete type, then field
+// by field using their JSON form, so numeric map values compare by value
+// (int 1 equals float64 1). Content blocks are compared by BlockType even when
+// the MessageType field is left empty.
+func DiffMessages(a, b Message) string {
+	if isNilMessage(a) || isNilMessage(b) {
+		if isNilMessage(a) && isNilMessage(b) {
+			return ""
+		}
+		return fmt.Sprintf("message: expected %s, got %s", describeMessage(a), describeMessage(b))
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || a.Type() != b.Type() {
+		return fmt.Sprintf("type: expected %s, got %s", describeMessage(a), describeMessage(b))
+	}
+
+	expected, errA := normalizeMessage(a)
+	actual, errB := normalizeMessage(b)
+	if errA != nil || errB != nil {
+		// Fall back to reflection when a message cannot be serialized
+		if reflect.DeepEqual(a, b) {
+			return ""
+		}
+		return fmt.Sprintf("message: expected %+v, got %+v", a, b)
+	}
+
+	var diffs []string
+	diffValues("", expected, actual, &diffs)
+	return strings.Join(diffs, "\n")
+}
+
+// isNilMessage reports whether msg is nil or a typed nil pointer.
+func isNilMessage(msg Message) bool {
+	if msg == nil {
+		return true
+	}
+	v := reflect.ValueOf(msg)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// describeMessage returns a short label for a message in diff output.
+func describeMessage(msg Message) string {
+	if isNilMessage(msg) {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%T (%s)", msg, msg.Type())
+}
+
+// normalizeMessage converts a message into a generic JSON tree for comparison.
+func normalizeMessage(msg Message) (any, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var tree any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	// Content block MessageType fields are often unset; use BlockType instead
+	root, _ := tree.(map[string]any)
+	items, _ := root["content"].([]any)
+	for i, block := range messageContentBlocks(msg) {
+		if i < len(items) && block != nil {
+			if item, ok := items[i].(map[string]any); ok {
+				item["type"] = block.BlockType()
+			}
+		}
+	}
+	return tree, nil
+}
+
+// messageContentBlocks returns the content blocks of messages that carry them.
+func messageContentBlocks(msg Message) []ContentBlock {
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		return m.Content
+	case *UserMessage:
+		blocks, _ := m.Content.([]ContentBlock)
+		return blocks
+	}
+	return nil
+}
+
+// diffValues appends a line to diffs for every path where expected and actual differ.
+func diffValues(path string, expected, actual any, diffs *[]string) {
+	switch exp := expected.(type) {
+	case map[string]any:
+		act, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, key := range unionKeys(exp, act) {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			expValue, expOK := exp[key]
+			actValue, actOK := act[key]
+			switch {
+			case !expOK:
+				*diffs = append(*diffs, fmt.Sprintf("%s: unexpected %s", childPath, formatDiffValue(actValue)))
+			case !actOK:
+				*diffs = append(*diffs, fmt.Sprintf("%s: missing, expected %s", childPath, formatDiffValue(expValue)))
+			default:
+				diffValues(childPath, expValue, actValue, diffs)
+			}
+		}
+		return
+
+	case []any:
+		act, ok := actual.([]any)
+		if !ok {
+			break
+		}
+		if len(exp) != len(act) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected %d items, got %d", diffPath(path), len(exp), len(act)))
+		}
+		for i := 0; i < len(exp) && i < len(act); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i], diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s",
+			diffPath(path), formatDiffValue(expected), formatDiffValue(actual)))
+	}
+}
+
+// unionKeys returns the sorted union of keys in a and b.
+func unionKeys(a, b map[string]any) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	keys := make([]string, 0, len(a)+len(b))
+	for _, m := range []map[string]any{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// diffPath returns path, or "message" for the root.
+func diffPath(path string) string {
+	if path == "" {
+		return "message"
+	}
+	return path
+}
+
+// formatDiffValue renders a value compactly as JSON.
+func formatDiffValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
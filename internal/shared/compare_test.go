@@ -0,0 +1,141 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMessagesEqual tests equality and diffs for each message type
+func TestMessagesEqual(t *testing.T) {
+	isError := true
+	cost := 0.01
+	result := "done"
+
+	tests := []struct {
+		name     string
+		expected Message
+		actual   Message
+		wantDiff []string // substrings expected in the diff; nil means equal
+	}{
+		{
+			name:     "user_string_equal",
+			expected: &UserMessage{Content: "hello"},
+			actual:   &UserMessage{Content: "hello"},
+		},
+		{
+			name:     "user_string_differs",
+			expected: &UserMessage{Content: "hello"},
+			actual:   &UserMessage{Content: "goodbye"},
+			wantDiff: []string{`content: expected "hello", got "goodbye"`},
+		},
+		{
+			name: "user_tool_result_differs",
+			expected: &UserMessage{Content: []ContentBlock{
+				&ToolResultBlock{ToolUseID: "toolu_1", Content: "ok"},
+			}},
+			actual: &UserMessage{Content: []ContentBlock{
+				&ToolResultBlock{ToolUseID: "toolu_1", Content: "ok", IsError: &isError},
+			}},
+			wantDiff: []string{"content[0].is_error: unexpected true"},
+		},
+		{
+			name: "assistant_equal_ignoring_block_message_type",
+			expected: &AssistantMessage{Model: "claude-sonnet-4-5", Content: []ContentBlock{
+				&TextBlock{Text: "hi"},
+				&ToolUseBlock{ToolUseID: "toolu_1", Name: "Read", Input: map[string]any{"limit": 10}},
+			}},
+			actual: &AssistantMessage{Model: "claude-sonnet-4-5", Content: []ContentBlock{
+				&TextBlock{MessageType: ContentBlockTypeText, Text: "hi"},
+				&ToolUseBlock{ToolUseID: "toolu_1", Name: "Read", Input: map[string]any{"limit": float64(10)}},
+			}},
+		},
+		{
+			name: "assistant_block_type_differs",
+			expected: &AssistantMessage{Content: []ContentBlock{
+				&TextBlock{Text: "hmm"},
+			}},
+			actual: &AssistantMessage{Content: []ContentBlock{
+				&ThinkingBlock{Thinking: "hmm"},
+			}},
+			wantDiff: []string{`content[0].type: expected "text", got "thinking"`, "content[0].text: missing"},
+		},
+		{
+			name: "assistant_block_count_differs",
+			expected: &AssistantMessage{Content: []ContentBlock{
+				&TextBlock{Text: "a"}, &TextBlock{Text: "b"},
+			}},
+			actual: &AssistantMessage{Content: []ContentBlock{
+				&TextBlock{Text: "a"},
+			}},
+			wantDiff: []string{"content: expected 2 items, got 1"},
+		},
+		{
+			name:     "system_equal",
+			expected: &SystemMessage{Subtype: "init", Data: map[string]any{"cwd": "/tmp"}},
+			actual:   &SystemMessage{Subtype: "init", Data: map[string]any{"cwd": "/tmp"}},
+		},
+		{
+			name:     "system_data_differs",
+			expected: &SystemMessage{Subtype: "init", Data: map[string]any{"cwd": "/tmp"}},
+			actual:   &SystemMessage{Subtype: "init", Data: map[string]any{"cwd": "/home"}},
+			wantDiff: []string{`cwd: expected "/tmp", got "/home"`},
+		},
+		{
+			name:     "result_equal",
+			expected: &ResultMessage{Subtype: "success", NumTurns: 1, TotalCostUSD: &cost, Result: &result},
+			actual:   &ResultMessage{Subtype: "success", NumTurns: 1, TotalCostUSD: &cost, Result: &result},
+		},
+		{
+			name:     "result_differs",
+			expected: &ResultMessage{Subtype: "success", NumTurns: 1},
+			actual:   &ResultMessage{Subtype: "success", NumTurns: 3, IsError: true},
+			wantDiff: []string{"is_error: expected false, got true", "num_turns: expected 1, got 3"},
+		},
+		{
+			name:     "stream_event_differs",
+			expected: &StreamEvent{UUID: "u1", Event: map[string]any{"type": StreamEventTypeMessageStart}},
+			actual:   &StreamEvent{UUID: "u1", Event: map[string]any{"type": StreamEventTypeMessageStop}},
+			wantDiff: []string{`event.type: expected "message_start", got "message_stop"`},
+		},
+		{
+			name:     "different_types",
+			expected: &UserMessage{Content: "x"},
+			actual:   &AssistantMessage{},
+			wantDiff: []string{"type: expected *shared.UserMessage (user), got *shared.AssistantMessage (assistant)"},
+		},
+		{
+			name:     "both_nil",
+			expected: nil,
+			actual:   (*UserMessage)(nil),
+		},
+		{
+			name:     "nil_vs_message",
+			expected: nil,
+			actual:   &ResultMessage{},
+			wantDiff: []string{"message: expected <nil>, got *shared.ResultMessage (result)"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffMessages(test.expected, test.actual)
+			equal := MessagesEqual(test.expected, test.actual)
+
+			if test.wantDiff == nil {
+				if !equal || diff != "" {
+					t.Errorf("Expected messages to be equal, got diff:\n%s", diff)
+				}
+				return
+			}
+
+			if equal {
+				t.Fatal("Expected messages to differ")
+			}
+			for _, want := range test.wantDiff {
+				if !strings.Contains(diff, want) {
+					t.Errorf("Expected diff to contain %q, got:\n%s", want, diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// MinDeduplicatedToolResultBytes is the smallest tool result content, in
+// JSON-encoded bytes, that ToolResultDeduplicator replaces when repeated.
+// Shorter results cost less than the note that would replace them.
+const MinDeduplicatedToolResultBytes = 1024
+
+// ToolResultDeduplicator replaces tool result content identical to an
+// earlier result in the same session with a short note referring back to it.
+// It is safe for concurrent use.
+type ToolResultDeduplicator struct {
+	mu   sync.Mutex
+	seen map[string]map[[sha256.Size]byte]string // Session ID to content hash to the tool that first returned it
+}
+
+// NewToolResultDeduplicator creates a deduplicator that has seen no results.
+func NewToolResultDeduplicator() *ToolResultDeduplicator {
+	return &ToolResultDeduplicator{seen: make(map[string]map[[sha256.Size]byte]string)}
+}
+
+// Process returns content unchanged the first time it is seen in sessionID,
+// and a note naming the tool that first returned it on later calls in that
+// session. Content that cannot be encoded as JSON, or is shorter than
+// MinDeduplicatedToolResultBytes, is always returned unchanged.
+func (d *ToolResultDeduplicator) Process(sessionID, toolName string, content any) any {
+	data, err := json.Marshal(content)
+	if err != nil || len(data) < MinDeduplicatedToolResultBytes {
+		return content
+	}
+	key := sha256.Sum256(data)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	session := d.seen[sessionID]
+	if session == nil {
+		session = make(map[[sha256.Size]byte]string)
+		d.seen[sessionID] = session
+	}
+	first, seen := session[key]
+	if !seen {
+		session[key] = toolName
+		return content
+	}
+	if first == "" {
+		first = "tool"
+	}
+	return fmt.Sprintf("[Duplicate tool result: identical to an earlier %s result in this session; "+
+		"%d bytes omitted]", first, len(data))
+}
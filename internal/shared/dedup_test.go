@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestToolResultDeduplicator tests repeated large results are replaced with
+// a note and everything else is passed through
+func TestToolResultDeduplicator(t *testing.T) {
+	large := strings.Repeat("package main\n", 200)
+	dedup := NewToolResultDeduplicator()
+
+	if got := dedup.Process("s1", "Read", large); got != large {
+		t.Error("Expected first result unchanged")
+	}
+	note, ok := dedup.Process("s1", "Bash", large).(string)
+	if !ok || note == large {
+		t.Fatalf("Expected repeated result to be replaced, got %v", note)
+	}
+	if !strings.Contains(note, "earlier Read result") {
+		t.Errorf("Expected note to name the first tool, got %q", note)
+	}
+
+	// The same text in a content list is a different result
+	list := func() any { return []any{map[string]any{"type": "text", "text": large}} }
+	if _, replaced := dedup.Process("s1", "Read", list()).(string); replaced {
+		t.Error("Expected content list seen for the first time unchanged")
+	}
+	if _, replaced := dedup.Process("s1", "Read", list()).(string); !replaced {
+		t.Error("Expected repeated content list to be replaced")
+	}
+
+	small := "ok"
+	for i := 0; i < 2; i++ {
+		if got := dedup.Process("s1", "Bash", small); got != small {
+			t.Errorf("Expected small result unchanged on call %d, got %v", i+1, got)
+		}
+	}
+	if got := dedup.Process("s1", "Read", large+"!"); got != large+"!" {
+		t.Error("Expected different content unchanged")
+	}
+
+	// Another session has not seen the result
+	if got := dedup.Process("s2", "Read", large); got != large {
+		t.Error("Expected result first seen in another session unchanged")
+	}
+	if _, replaced := dedup.Process("s2", "Read", large).(string); !replaced {
+		t.Error("Expected result repeated within the other session to be replaced")
+	}
+}
@@ -0,0 +1,79 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestUnifiedDiff tests hunks, context, and file creation and deletion
+func TestUnifiedDiff(t *testing.T) {
+	// Lines "1" through "20"
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprint(i))
+	}
+	numbered := strings.Join(lines, "\n") + "\n"
+
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		{
+			name:   "new_file",
+			before: "",
+			after:  "package main\n\nfunc main() {}\n",
+			want: "--- f.go\n+++ f.go\n@@ -0,0 +1,3 @@\n" +
+				"+package main\n+\n+func main() {}\n",
+		},
+		{
+			name:   "emptied_file",
+			before: "a\nb\n",
+			after:  "",
+			want:   "--- f.go\n+++ f.go\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:   "single_change_with_context",
+			before: numbered,
+			after:  strings.Replace(numbered, "10\n", "ten\n", 1),
+			want:   "--- f.go\n+++ f.go\n@@ -7,7 +7,7 @@\n 7\n 8\n 9\n-10\n+ten\n 11\n 12\n 13\n",
+		},
+		{
+			name:   "distant_changes_separate_hunks",
+			before: numbered,
+			after:  strings.Replace(strings.Replace(numbered, "2\n", "two\n", 1), "19\n", "nineteen\n", 1),
+			want: "--- f.go\n+++ f.go\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+two\n 3\n 4\n 5\n" +
+				"@@ -16,5 +16,5 @@\n 16\n 17\n 18\n-19\n+nineteen\n 20\n",
+		},
+		{
+			name:   "nearby_changes_share_hunk",
+			before: numbered,
+			after:  strings.Replace(strings.Replace(numbered, "5\n", "five\n", 1), "9\n", "nine\n", 1),
+			want: "--- f.go\n+++ f.go\n@@ -2,11 +2,11 @@\n" +
+				" 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n-9\n+nine\n 10\n 11\n 12\n",
+		},
+		{
+			name:   "insertion",
+			before: "a\nc\n",
+			after:  "a\nb\nc\n",
+			want:   "--- f.go\n+++ f.go\n@@ -1,2 +1,3 @@\n a\n+b\n c\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := UnifiedDiff("f.go", test.before, test.after); got != test.want {
+				t.Errorf("Expected diff:\n%s\ngot:\n%s", test.want, got)
+			}
+		})
+	}
+}
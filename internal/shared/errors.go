@@ -2,8 +2,12 @@
 package shared
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // SDKError is the base interface for all Claude Agent SDK errors.
@@ -240,3 +244,413 @@ func AsMessageParseError(err error) *MessageParseError {
 	}
 	return nil
 }
+
+// ToolExecutionError indicates a tool returned an error result.
+// Surfaced when fail-fast mode aborts a session on the first tool error.
+type ToolExecutionError struct {
+	BaseError
+	ToolUseID string
+	Content   any
+}
+
+// Type returns the error type for ToolExecutionError.
+func (e *ToolExecutionError) Type() string {
+	return "tool_execution_error"
+}
+
+// NewToolExecutionError creates a new ToolExecutionError.
+func NewToolExecutionError(toolUseID string, content any) *ToolExecutionError {
+	message := "tool execution failed"
+	if toolUseID != "" {
+		message = fmt.Sprintf("%s: %s", message, toolUseID)
+	}
+	if text, ok := content.(string); ok && text != "" {
+		message = fmt.Sprintf("%s: %s", message, text)
+	}
+	return &ToolExecutionError{
+		BaseError: BaseError{message: message},
+		ToolUseID: toolUseID,
+		Content:   content,
+	}
+}
+
+// IsToolExecutionError reports whether err is or wraps a ToolExecutionError.
+func IsToolExecutionError(err error) bool {
+	var target *ToolExecutionError
+	return errors.As(err, &target)
+}
+
+// AsToolExecutionError returns the error as a *ToolExecutionError if it is one,
+// or nil otherwise. This allows convenient field access after type checking.
+func AsToolExecutionError(err error) *ToolExecutionError {
+	var target *ToolExecutionError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// StructuredOutputError indicates structured output contains fields the
+// output schema does not allow. Surfaced in strict JSON schema mode.
+type StructuredOutputError struct {
+	BaseError
+	Fields []string
+	Output any
+}
+
+// Type returns the error type for StructuredOutputError.
+func (e *StructuredOutputError) Type() string {
+	return "structured_output_error"
+}
+
+// NewStructuredOutputError creates a new StructuredOutputError for the given
+// field paths.
+func NewStructuredOutputError(fields []string, output any) *StructuredOutputError {
+	return &StructuredOutputError{
+		BaseError: BaseError{message: fmt.Sprintf(
+			"structured output has fields not allowed by schema: %s", strings.Join(fields, ", "))},
+		Fields: fields,
+		Output: output,
+	}
+}
+
+// IsStructuredOutputError reports whether err is or wraps a StructuredOutputError.
+func IsStructuredOutputError(err error) bool {
+	var target *StructuredOutputError
+	return errors.As(err, &target)
+}
+
+// AsStructuredOutputError returns the error as a *StructuredOutputError if it
+// is one, or nil otherwise.
+func AsStructuredOutputError(err error) *StructuredOutputError {
+	var target *StructuredOutputError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// ValidationError indicates an option has an invalid value.
+type ValidationError struct {
+	BaseError
+	Field string
+	Value any
+}
+
+// Type returns the error type for ValidationError.
+func (e *ValidationError) Type() string {
+	return "validation_error"
+}
+
+// NewValidationError creates a new ValidationError for an option field.
+func NewValidationError(field string, value any, message string) *ValidationError {
+	return &ValidationError{
+		BaseError: BaseError{message: message},
+		Field:     field,
+		Value:     value,
+	}
+}
+
+// IsValidationError reports whether err is or wraps a ValidationError.
+func IsValidationError(err error) bool {
+	var target *ValidationError
+	return errors.As(err, &target)
+}
+
+// AsValidationError returns the error as a *ValidationError if it is one,
+// or nil otherwise.
+func AsValidationError(err error) *ValidationError {
+	var target *ValidationError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// PromptTooLargeError indicates a prompt exceeded the large prompt threshold
+// and was rejected rather than sent.
+type PromptTooLargeError struct {
+	BaseError
+	Size      int
+	Threshold int
+}
+
+// Type returns the error type for PromptTooLargeError.
+func (e *PromptTooLargeError) Type() string {
+	return "prompt_too_large_error"
+}
+
+// NewPromptTooLargeError creates a new PromptTooLargeError for a prompt of
+// size bytes.
+func NewPromptTooLargeError(size, threshold int) *PromptTooLargeError {
+	return &PromptTooLargeError{
+		BaseError: BaseError{message: fmt.Sprintf("prompt is %d bytes, exceeding the %d byte limit", size, threshold)},
+		Size:      size,
+		Threshold: threshold,
+	}
+}
+
+// IsPromptTooLargeError reports whether err is or wraps a PromptTooLargeError.
+func IsPromptTooLargeError(err error) bool {
+	var target *PromptTooLargeError
+	return errors.As(err, &target)
+}
+
+// AsPromptTooLargeError returns the error as a *PromptTooLargeError if it is
+// one, or nil otherwise.
+func AsPromptTooLargeError(err error) *PromptTooLargeError {
+	var target *PromptTooLargeError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// OutputLimitExceededError indicates the CLI was terminated after its output
+// exceeded the session's byte limit.
+type OutputLimitExceededError struct {
+	BaseError
+	Limit int64
+}
+
+// Type returns the error type for OutputLimitExceededError.
+func (e *OutputLimitExceededError) Type() string {
+	return "output_limit_exceeded_error"
+}
+
+// NewOutputLimitExceededError creates a new OutputLimitExceededError for the given limit.
+func NewOutputLimitExceededError(limit int64) *OutputLimitExceededError {
+	return &OutputLimitExceededError{
+		BaseError: BaseError{message: fmt.Sprintf("CLI output exceeded the %d byte limit", limit)},
+		Limit:     limit,
+	}
+}
+
+// IsOutputLimitExceededError reports whether err is or wraps an OutputLimitExceededError.
+func IsOutputLimitExceededError(err error) bool {
+	var target *OutputLimitExceededError
+	return errors.As(err, &target)
+}
+
+// AsOutputLimitExceededError returns the error as an *OutputLimitExceededError
+// if it is one, or nil otherwise.
+func AsOutputLimitExceededError(err error) *OutputLimitExceededError {
+	var target *OutputLimitExceededError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// PartialResultsError is returned when a query's context is cancelled and
+// partial results were requested. It wraps the context error, so
+// errors.Is(err, context.Canceled) still reports the cancellation.
+type PartialResultsError struct {
+	BaseError
+	// Messages holds every message the query received before cancellation,
+	// including those already returned by Next.
+	Messages []Message
+}
+
+// Type returns the error type for PartialResultsError.
+func (e *PartialResultsError) Type() string {
+	return "partial_results_error"
+}
+
+// NewPartialResultsError creates a new PartialResultsError wrapping the
+// context error that cancelled the query.
+func NewPartialResultsError(messages []Message, cause error) *PartialResultsError {
+	return &PartialResultsError{
+		BaseError: BaseError{
+			message: fmt.Sprintf("query cancelled after %d messages", len(messages)),
+			cause:   cause,
+		},
+		Messages: messages,
+	}
+}
+
+// IsPartialResultsError reports whether err is or wraps a PartialResultsError.
+func IsPartialResultsError(err error) bool {
+	var target *PartialResultsError
+	return errors.As(err, &target)
+}
+
+// AsPartialResultsError returns the error as a *PartialResultsError if it is
+// one, or nil otherwise.
+func AsPartialResultsError(err error) *PartialResultsError {
+	var target *PartialResultsError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// SessionExpiredError indicates a session was terminated after exceeding its
+// maximum duration.
+type SessionExpiredError struct {
+	BaseError
+	MaxDuration time.Duration
+}
+
+// Type returns the error type for SessionExpiredError.
+func (e *SessionExpiredError) Type() string {
+	return "session_expired_error"
+}
+
+// NewSessionExpiredError creates a new SessionExpiredError for the given limit.
+func NewSessionExpiredError(maxDuration time.Duration) *SessionExpiredError {
+	return &SessionExpiredError{
+		BaseError:   BaseError{message: fmt.Sprintf("session exceeded maximum duration of %s", maxDuration)},
+		MaxDuration: maxDuration,
+	}
+}
+
+// IsSessionExpiredError reports whether err is or wraps a SessionExpiredError.
+func IsSessionExpiredError(err error) bool {
+	var target *SessionExpiredError
+	return errors.As(err, &target)
+}
+
+// AsSessionExpiredError returns the error as a *SessionExpiredError if it is
+// one, or nil otherwise.
+func AsSessionExpiredError(err error) *SessionExpiredError {
+	var target *SessionExpiredError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// IdleDisconnectError indicates a Client was disconnected after going unused
+// for its maximum idle time. Reconnect to continue.
+type IdleDisconnectError struct {
+	BaseError
+	MaxIdleTime time.Duration
+}
+
+// Type returns the error type for IdleDisconnectError.
+func (e *IdleDisconnectError) Type() string {
+	return "idle_disconnect_error"
+}
+
+// NewIdleDisconnectError creates a new IdleDisconnectError for the given limit.
+func NewIdleDisconnectError(maxIdleTime time.Duration) *IdleDisconnectError {
+	return &IdleDisconnectError{
+		BaseError:   BaseError{message: fmt.Sprintf("client disconnected after %s idle; reconnect to continue", maxIdleTime)},
+		MaxIdleTime: maxIdleTime,
+	}
+}
+
+// IsIdleDisconnectError reports whether err is or wraps an IdleDisconnectError.
+func IsIdleDisconnectError(err error) bool {
+	var target *IdleDisconnectError
+	return errors.As(err, &target)
+}
+
+// AsIdleDisconnectError returns the error as an *IdleDisconnectError if it is
+// one, or nil otherwise.
+func AsIdleDisconnectError(err error) *IdleDisconnectError {
+	var target *IdleDisconnectError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// CLIResultError carries a result message that ended its turn in an error,
+// with the CLI's original JSON for details the SDK does not parse. Errors the
+// SDK derives from error results, such as from Client.QueryTo or QueryJSON,
+// wrap it, so errors.As recovers it.
+type CLIResultError struct {
+	BaseError
+	Subtype   string
+	ErrorType ResultErrorType
+	Result    string // Result text, if any
+	// Raw is the result message as received from the CLI, or the result
+	// re-encoded if it was not parsed from CLI output.
+	Raw json.RawMessage
+}
+
+// Type returns the error type for CLIResultError.
+func (e *CLIResultError) Type() string {
+	return "cli_result_error"
+}
+
+// NewCLIResultError creates a new CLIResultError for an error result.
+func NewCLIResultError(result *ResultMessage) *CLIResultError {
+	raw := result.Raw
+	if raw == nil {
+		// Encoding a ResultMessage fails only for unencodable structured output
+		raw, _ = json.Marshal(result)
+	}
+	e := &CLIResultError{
+		Subtype:   result.Subtype,
+		ErrorType: result.ErrorType,
+		Raw:       append(json.RawMessage(nil), raw...),
+	}
+	message := fmt.Sprintf("CLI error result (%s)", result.Subtype)
+	if result.Result != nil && *result.Result != "" {
+		e.Result = *result.Result
+		message = fmt.Sprintf("%s: %s", message, e.Result)
+	}
+	e.BaseError = BaseError{message: message}
+	return e
+}
+
+// Retryable reports whether the turn failed for a transient reason: the API
+// was overloaded, rate limited, or had a server error.
+func (e *CLIResultError) Retryable() bool {
+	switch e.ErrorType {
+	case ResultErrorOverloaded, ResultErrorRateLimit, ResultErrorServer:
+		return true
+	}
+	return false
+}
+
+// IsCLIResultError reports whether err is or wraps a CLIResultError.
+func IsCLIResultError(err error) bool {
+	var target *CLIResultError
+	return errors.As(err, &target)
+}
+
+// AsCLIResultError returns the error as a *CLIResultError if it is one, or
+// nil otherwise.
+func AsCLIResultError(err error) *CLIResultError {
+	var target *CLIResultError
+	if errors.As(err, &target) {
+		return target
+	}
+	return nil
+}
+
+// IsRetryable reports whether err is a transient failure that may succeed if
+// the operation is retried. Errors in the chain can classify themselves with
+// a Retryable() bool method, as CLIResultError does for overloaded,
+// rate-limited, and server error results; otherwise a ConnectionError is
+// retryable unless it was caused by context cancellation or a missing CLI.
+// The SDK has no stall error: a stream that stops responding surfaces as
+// the context's error, which is not retryable. Errors that will
+// recur on retry, such as CLINotFoundError, ValidationError,
+// PromptTooLargeError, OutputLimitExceededError, SessionExpiredError, and
+// parse errors, are not.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var classified interface{ Retryable() bool }
+	if errors.As(err, &classified) {
+		return classified.Retryable()
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch {
+	case IsCLINotFoundError(err), IsValidationError(err), IsPromptTooLargeError(err),
+		IsOutputLimitExceededError(err), IsSessionExpiredError(err),
+		IsJSONDecodeError(err), IsMessageParseError(err), IsStructuredOutputError(err):
+		return false
+	}
+	return IsConnectionError(err)
+}
@@ -1,9 +1,12 @@
 package shared
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 )
 
 // Test constants to avoid magic strings.
@@ -293,3 +296,248 @@ func TestErrorHelpersWithWrappedChain(t *testing.T) {
 		}
 	})
 }
+
+func TestToolExecutionErrorHelpers(t *testing.T) {
+	err := NewToolExecutionError("toolu_01", "exit status 1")
+
+	if err.Type() != "tool_execution_error" {
+		t.Errorf("Expected type tool_execution_error, got %q", err.Type())
+	}
+	if err.Error() != "tool execution failed: toolu_01: exit status 1" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+
+	wrapped := fmt.Errorf("query failed: %w", err)
+	if !IsToolExecutionError(wrapped) {
+		t.Error("IsToolExecutionError should return true for wrapped error")
+	}
+	if result := AsToolExecutionError(wrapped); result == nil || result.ToolUseID != "toolu_01" {
+		t.Errorf("AsToolExecutionError should extract ToolUseID, got %+v", result)
+	}
+	if IsToolExecutionError(NewConnectionError("other", nil)) {
+		t.Error("IsToolExecutionError should return false for other error types")
+	}
+}
+
+func TestPromptTooLargeErrorHelpers(t *testing.T) {
+	err := NewPromptTooLargeError(2048, 1024)
+
+	if err.Type() != "prompt_too_large_error" {
+		t.Errorf("Expected type prompt_too_large_error, got %q", err.Type())
+	}
+	if err.Error() != "prompt is 2048 bytes, exceeding the 1024 byte limit" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+
+	wrapped := fmt.Errorf("query failed: %w", err)
+	if !IsPromptTooLargeError(wrapped) {
+		t.Error("IsPromptTooLargeError should return true for wrapped error")
+	}
+	if result := AsPromptTooLargeError(wrapped); result == nil || result.Size != 2048 || result.Threshold != 1024 {
+		t.Errorf("AsPromptTooLargeError should extract Size and Threshold, got %+v", result)
+	}
+	if IsPromptTooLargeError(NewConnectionError("other", nil)) {
+		t.Error("IsPromptTooLargeError should return false for other error types")
+	}
+}
+
+func TestOutputLimitExceededErrorHelpers(t *testing.T) {
+	err := NewOutputLimitExceededError(4096)
+
+	if err.Type() != "output_limit_exceeded_error" {
+		t.Errorf("Expected type output_limit_exceeded_error, got %q", err.Type())
+	}
+	if err.Error() != "CLI output exceeded the 4096 byte limit" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+
+	wrapped := fmt.Errorf("receive failed: %w", err)
+	if !IsOutputLimitExceededError(wrapped) {
+		t.Error("IsOutputLimitExceededError should return true for wrapped error")
+	}
+	if result := AsOutputLimitExceededError(wrapped); result == nil || result.Limit != 4096 {
+		t.Errorf("AsOutputLimitExceededError should extract Limit, got %+v", result)
+	}
+	if IsOutputLimitExceededError(NewConnectionError("other", nil)) {
+		t.Error("IsOutputLimitExceededError should return false for other error types")
+	}
+}
+
+// TestIsRetryable tests retry classification across error categories.
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection_error", NewConnectionError("CLI closed the connection", nil), true},
+		{"wrapped_connection_error", fmt.Errorf("send: %w", NewConnectionError("broken pipe", errors.New("EPIPE"))), true},
+		{"connection_error_from_cancel", NewConnectionError("interrupted", context.Canceled), false},
+		{"connection_error_from_deadline", NewConnectionError("timed out", context.DeadlineExceeded), false},
+		{"connection_error_from_missing_cli", NewConnectionError("start failed", NewCLINotFoundError(testCLIPath, "not found")), false},
+		{"self_classified_retryable", &retryableTestError{retryable: true}, true},
+		{"self_classified_not_retryable", NewConnectionError("rejected", &retryableTestError{}), false},
+		{"cli_not_found", NewCLINotFoundError(testCLIPath, "Claude CLI not found"), false},
+		{"validation", NewValidationError("MaxTurns", -1, "must be non-negative"), false},
+		{"prompt_too_large", NewPromptTooLargeError(2048, 1024), false},
+		{"output_limit_exceeded", NewOutputLimitExceededError(1024), false},
+		{"session_expired", NewSessionExpiredError(time.Minute), false},
+		{"json_decode", NewJSONDecodeError("{", 1, errors.New("unexpected EOF")), false},
+		{"process", NewProcessError("CLI exited", 1, testStderrOutput), false},
+		{"result_overloaded", cliResultTestError(ResultErrorOverloaded), true},
+		{"result_rate_limit", cliResultTestError(ResultErrorRateLimit), true},
+		{"result_server_error", cliResultTestError(ResultErrorServer), true},
+		{"wrapped_result_overloaded", fmt.Errorf("query failed: %w", cliResultTestError(ResultErrorOverloaded)), true},
+		{"result_invalid_request", cliResultTestError(ResultErrorInvalidRequest), false},
+		{"result_auth_failed", cliResultTestError(ResultErrorAuthFailed), false},
+		{"result_max_turns", cliResultTestError(ResultErrorMaxTurns), false},
+		{"result_unknown", cliResultTestError(ResultErrorUnknown), false},
+		{"context_canceled", context.Canceled, false},
+		{"plain", errors.New("boom"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsRetryable(test.err); got != test.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+// cliResultTestError returns a CLIResultError for an error result of errorType.
+func cliResultTestError(errorType ResultErrorType) *CLIResultError {
+	return NewCLIResultError(&ResultMessage{Subtype: "error_during_execution", IsError: true, ErrorType: errorType})
+}
+
+func TestPartialResultsErrorHelpers(t *testing.T) {
+	messages := []Message{&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "partial"}}}}
+	err := NewPartialResultsError(messages, context.Canceled)
+
+	if err.Type() != "partial_results_error" {
+		t.Errorf("Expected type partial_results_error, got %q", err.Type())
+	}
+	if err.Error() != "query cancelled after 1 messages: context canceled" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Error("PartialResultsError should wrap the context error")
+	}
+
+	wrapped := fmt.Errorf("query failed: %w", err)
+	if !IsPartialResultsError(wrapped) {
+		t.Error("IsPartialResultsError should return true for wrapped error")
+	}
+	if result := AsPartialResultsError(wrapped); result == nil || len(result.Messages) != 1 {
+		t.Errorf("AsPartialResultsError should extract Messages, got %+v", result)
+	}
+	if IsPartialResultsError(context.Canceled) {
+		t.Error("IsPartialResultsError should return false for other errors")
+	}
+}
+
+func TestSessionExpiredErrorHelpers(t *testing.T) {
+	err := NewSessionExpiredError(90 * time.Second)
+
+	if err.Type() != "session_expired_error" {
+		t.Errorf("Expected type session_expired_error, got %q", err.Type())
+	}
+	if err.Error() != "session exceeded maximum duration of 1m30s" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+
+	wrapped := fmt.Errorf("receive failed: %w", err)
+	if !IsSessionExpiredError(wrapped) {
+		t.Error("IsSessionExpiredError should return true for wrapped error")
+	}
+	if result := AsSessionExpiredError(wrapped); result == nil || result.MaxDuration != 90*time.Second {
+		t.Errorf("AsSessionExpiredError should extract MaxDuration, got %+v", result)
+	}
+	if IsSessionExpiredError(NewConnectionError("other", nil)) {
+		t.Error("IsSessionExpiredError should return false for other error types")
+	}
+}
+
+func TestIdleDisconnectErrorHelpers(t *testing.T) {
+	err := NewIdleDisconnectError(5 * time.Minute)
+
+	if err.Type() != "idle_disconnect_error" {
+		t.Errorf("Expected type idle_disconnect_error, got %q", err.Type())
+	}
+	if err.Error() != "client disconnected after 5m0s idle; reconnect to continue" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+
+	wrapped := fmt.Errorf("query failed: %w", err)
+	if !IsIdleDisconnectError(wrapped) {
+		t.Error("IsIdleDisconnectError should return true for wrapped error")
+	}
+	if result := AsIdleDisconnectError(wrapped); result == nil || result.MaxIdleTime != 5*time.Minute {
+		t.Errorf("AsIdleDisconnectError should extract MaxIdleTime, got %+v", result)
+	}
+	if IsIdleDisconnectError(NewConnectionError("other", nil)) {
+		t.Error("IsIdleDisconnectError should return false for other error types")
+	}
+}
+
+// retryableTestError classifies itself via a Retryable method, as overload
+// and stall errors do.
+type retryableTestError struct {
+	retryable bool
+}
+
+func (e *retryableTestError) Error() string   { return "classified error" }
+func (e *retryableTestError) Retryable() bool { return e.retryable }
+
+func TestCLIResultErrorHelpers(t *testing.T) {
+	raw := `{"type":"result","subtype":"error_during_execution","is_error":true,"result":"API Error: 529","error":{"type":"overloaded_error"}}`
+	text := "API Error: 529"
+	result := &ResultMessage{
+		Subtype:   "error_during_execution",
+		IsError:   true,
+		Result:    &text,
+		ErrorType: ResultErrorOverloaded,
+		Raw:       []byte(raw),
+	}
+	err := NewCLIResultError(result)
+
+	if err.Type() != "cli_result_error" {
+		t.Errorf("Expected type cli_result_error, got %q", err.Type())
+	}
+	if err.Error() != "CLI error result (error_during_execution): API Error: 529" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+	if string(err.Raw) != raw {
+		t.Errorf("Expected the original payload, got %s", err.Raw)
+	}
+	result.Raw[0] = 'X'
+	if string(err.Raw) != raw {
+		t.Error("Expected the payload to be copied from the result")
+	}
+
+	wrapped := fmt.Errorf("query failed: %w", err)
+	if !IsCLIResultError(wrapped) {
+		t.Error("IsCLIResultError should return true for wrapped error")
+	}
+	got := AsCLIResultError(wrapped)
+	if got == nil || got.ErrorType != ResultErrorOverloaded || got.Subtype != "error_during_execution" || got.Result != text {
+		t.Errorf("AsCLIResultError should extract the result fields, got %+v", got)
+	}
+	if IsCLIResultError(NewConnectionError("other", nil)) {
+		t.Error("IsCLIResultError should return false for other error types")
+	}
+
+	// Results not parsed from CLI output are re-encoded
+	err = NewCLIResultError(&ResultMessage{Subtype: "error_max_turns", IsError: true, SessionID: "s1"})
+	if err.Error() != "CLI error result (error_max_turns)" {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+	var payload map[string]any
+	if decodeErr := json.Unmarshal(err.Raw, &payload); decodeErr != nil {
+		t.Fatalf("Expected re-encoded JSON, got %s: %v", err.Raw, decodeErr)
+	}
+	if payload["type"] != "result" || payload["subtype"] != "error_max_turns" || payload["session_id"] != "s1" {
+		t.Errorf("Unexpected re-encoded payload: %v", payload)
+	}
+}
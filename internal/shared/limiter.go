@@ -0,0 +1,51 @@
+package shared
+
+import "context"
+
+// SubprocessLimiter bounds the number of CLI subprocesses running at once
+// across every Query and Client sharing it. It is safe for concurrent use.
+type SubprocessLimiter struct {
+	slots chan struct{}
+}
+
+// NewSubprocessLimiter creates a limiter allowing max live subprocesses.
+// It panics if max is not positive.
+func NewSubprocessLimiter(max int) *SubprocessLimiter {
+	if max <= 0 {
+		panic("claudecode: non-positive max for NewSubprocessLimiter")
+	}
+	return &SubprocessLimiter{slots: make(chan struct{}, max)}
+}
+
+// Acquire waits for a free slot, returning ctx's error if ctx ends first.
+func (l *SubprocessLimiter) Acquire(ctx context.Context) error {
+	// Fail fast on an ended context even when a slot is free
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (l *SubprocessLimiter) Release() {
+	select {
+	case <-l.slots:
+	default:
+		panic("claudecode: SubprocessLimiter released more than acquired")
+	}
+}
+
+// InUse returns the number of slots currently held.
+func (l *SubprocessLimiter) InUse() int {
+	return len(l.slots)
+}
+
+// Max returns the maximum number of live subprocesses.
+func (l *SubprocessLimiter) Max() int {
+	return cap(l.slots)
+}
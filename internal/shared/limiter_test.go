@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestSubprocessLimiter tests slots are bounded, waited for, and released
+func TestSubprocessLimiter(t *testing.T) {
+	t.Run("bounds_slots", func(t *testing.T) {
+		limiter := NewSubprocessLimiter(2)
+		if limiter.Max() != 2 {
+			t.Errorf("Expected Max 2, got %d", limiter.Max())
+		}
+		for i := 0; i < 2; i++ {
+			if err := limiter.Acquire(context.Background()); err != nil {
+				t.Fatalf("Unexpected error acquiring slot %d: %v", i, err)
+			}
+		}
+		if limiter.InUse() != 2 {
+			t.Errorf("Expected 2 slots in use, got %d", limiter.InUse())
+		}
+
+		acquired := make(chan error, 1)
+		go func() { acquired <- limiter.Acquire(context.Background()) }()
+		select {
+		case err := <-acquired:
+			t.Fatalf("Expected Acquire to wait for a slot, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		limiter.Release()
+		select {
+		case err := <-acquired:
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected Acquire to proceed after Release")
+		}
+	})
+
+	t.Run("context_ends", func(t *testing.T) {
+		limiter := NewSubprocessLimiter(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := limiter.Acquire(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled with a free slot, got %v", err)
+		}
+
+		_ = limiter.Acquire(context.Background())
+		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := limiter.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if limiter.InUse() != 1 {
+			t.Errorf("Expected 1 slot in use, got %d", limiter.InUse())
+		}
+	})
+
+	t.Run("invalid_use_panics", func(t *testing.T) {
+		assertPanics(t, "non-positive max", func() { NewSubprocessLimiter(0) })
+		assertPanics(t, "release without acquire", func() { NewSubprocessLimiter(1).Release() })
+	})
+}
+
+func assertPanics(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected %s to panic", name)
+		}
+	}()
+	fn()
+}
@@ -2,6 +2,8 @@ package shared
 
 import (
 	"encoding/json"
+	"strings"
+	"time"
 )
 
 // Message type constants
@@ -21,12 +23,28 @@ const (
 
 // Content block type constants
 const (
-	ContentBlockTypeText       = "text"
-	ContentBlockTypeThinking   = "thinking"
-	ContentBlockTypeToolUse    = "tool_use"
-	ContentBlockTypeToolResult = "tool_result"
+	ContentBlockTypeText                = "text"
+	ContentBlockTypeThinking            = "thinking"
+	ContentBlockTypeToolUse             = "tool_use"
+	ContentBlockTypeToolResult          = "tool_result"
+	ContentBlockTypeServerToolUse       = "server_tool_use"
+	ContentBlockTypeWebSearchToolResult = "web_search_tool_result"
 )
 
+// System message subtype constants
+const (
+	// SystemSubtypeInit is sent when the CLI session starts and reports loaded MCP servers.
+	SystemSubtypeInit = "init"
+	// SystemSubtypeResourceUpdated is the subtype the SDK recognizes as an MCP
+	// resource update. Experimental: the CLI does not document a system
+	// message for resource updates, so this format is the SDK's own guess
+	// and may never be sent.
+	SystemSubtypeResourceUpdated = "mcp_resource_updated"
+)
+
+// McpServerStatusPending is the init status of an MCP server still starting up.
+const McpServerStatusPending = "pending"
+
 // AssistantMessageError represents error types in assistant messages.
 type AssistantMessageError string
 
@@ -40,6 +58,24 @@ const (
 	AssistantMessageErrorUnknown        AssistantMessageError = "unknown"
 )
 
+// ResultErrorType categorizes why a turn ended in an error result.
+type ResultErrorType string
+
+// ResultErrorType constants for error result identification.
+const (
+	ResultErrorRateLimit        ResultErrorType = "rate_limit"
+	ResultErrorInvalidRequest   ResultErrorType = "invalid_request"
+	ResultErrorAuthFailed       ResultErrorType = "authentication_failed"
+	ResultErrorBilling          ResultErrorType = "billing_error"
+	ResultErrorOverloaded       ResultErrorType = "overloaded"
+	ResultErrorServer           ResultErrorType = "server_error"
+	ResultErrorMaxTurns         ResultErrorType = "max_turns"
+	ResultErrorMaxBudget        ResultErrorType = "max_budget"
+	ResultErrorStructuredOutput ResultErrorType = "structured_output"
+	ResultErrorExecution        ResultErrorType = "execution_error" // E.g. a tool or the CLI failed mid-turn
+	ResultErrorUnknown          ResultErrorType = "unknown"
+)
+
 // Message represents any message type in the Claude Code protocol.
 type Message interface {
 	Type() string
@@ -57,6 +93,7 @@ type UserMessage struct {
 	UUID            *string        `json:"uuid,omitempty"`
 	ParentToolUseID *string        `json:"parent_tool_use_id,omitempty"`
 	ToolUseResult   map[string]any `json:"tool_use_result,omitempty"`
+	QueryID         string         `json:"-"` // Set by Client.QueryWithID; not serialized
 }
 
 // Type returns the message type for UserMessage.
@@ -109,6 +146,7 @@ type AssistantMessage struct {
 	Content     []ContentBlock         `json:"content"`
 	Model       string                 `json:"model"`
 	Error       *AssistantMessageError `json:"error,omitempty"`
+	QueryID     string                 `json:"-"` // Set by Client.QueryWithID; not serialized
 }
 
 // Type returns the message type for AssistantMessage.
@@ -134,6 +172,12 @@ func (m *AssistantMessage) IsRateLimited() bool {
 	return m.Error != nil && *m.Error == AssistantMessageErrorRateLimit
 }
 
+// Text returns the concatenated text of the message's TextBlocks, skipping
+// thinking, tool use, and other blocks.
+func (m *AssistantMessage) Text() string {
+	return TextOf(m.Content)
+}
+
 // MarshalJSON implements custom JSON marshaling for AssistantMessage
 func (m *AssistantMessage) MarshalJSON() ([]byte, error) {
 	type assistantMessage AssistantMessage
@@ -152,6 +196,7 @@ type SystemMessage struct {
 	MessageType string         `json:"type"`
 	Subtype     string         `json:"subtype"`
 	Data        map[string]any `json:"-"` // Preserve all original data
+	QueryID     string         `json:"-"` // Set by Client.QueryWithID; not serialized
 }
 
 // Type returns the message type for SystemMessage.
@@ -183,6 +228,22 @@ type ResultMessage struct {
 	Usage            *map[string]any `json:"usage,omitempty"`
 	Result           *string         `json:"result,omitempty"`
 	StructuredOutput any             `json:"structured_output,omitempty"`
+	QueryID          string          `json:"-"` // Set by Client.QueryWithID; not serialized
+
+	// ErrorType categorizes an error result, parsed from the subtype, the
+	// error field, and API error status codes in the result text. It is empty
+	// for successful results.
+	ErrorType ResultErrorType `json:"-"` // Not serialized
+
+	// Duration is the wall-clock time of the turn and APIDuration the part of
+	// it spent waiting on the API, parsed from duration_ms and duration_api_ms
+	// at full precision. The remainder is mostly tool execution and CLI overhead.
+	Duration    time.Duration `json:"-"` // Not serialized
+	APIDuration time.Duration `json:"-"` // Not serialized
+
+	// Raw is the result message as received from the CLI, or nil if it was
+	// not parsed from CLI output.
+	Raw json.RawMessage `json:"-"` // Not serialized
 }
 
 // Type returns the message type for ResultMessage.
@@ -203,10 +264,46 @@ func (m *ResultMessage) MarshalJSON() ([]byte, error) {
 	return json.Marshal(temp)
 }
 
+// Citation type constants identifying how a citation locates its source.
+const (
+	CitationTypeCharLocation            = "char_location"
+	CitationTypePageLocation            = "page_location"
+	CitationTypeContentBlockLocation    = "content_block_location"
+	CitationTypeWebSearchResultLocation = "web_search_result_location"
+	CitationTypeSearchResultLocation    = "search_result_location"
+)
+
+// Citation references the source document and range supporting a piece of text.
+// Which location fields are set depends on Type.
+type Citation struct {
+	Type          string  `json:"type"`
+	CitedText     string  `json:"cited_text"`
+	DocumentIndex *int    `json:"document_index,omitempty"`
+	DocumentTitle *string `json:"document_title,omitempty"`
+
+	// char_location
+	StartCharIndex *int `json:"start_char_index,omitempty"`
+	EndCharIndex   *int `json:"end_char_index,omitempty"`
+
+	// page_location
+	StartPageNumber *int `json:"start_page_number,omitempty"`
+	EndPageNumber   *int `json:"end_page_number,omitempty"`
+
+	// content_block_location and search_result_location
+	StartBlockIndex *int `json:"start_block_index,omitempty"`
+	EndBlockIndex   *int `json:"end_block_index,omitempty"`
+
+	// web_search_result_location and search_result_location
+	URL    *string `json:"url,omitempty"`
+	Title  *string `json:"title,omitempty"`
+	Source *string `json:"source,omitempty"`
+}
+
 // TextBlock represents text content.
 type TextBlock struct {
-	MessageType string `json:"type"`
-	Text        string `json:"text"`
+	MessageType string     `json:"type"`
+	Text        string     `json:"text"`
+	Citations   []Citation `json:"citations,omitempty"`
 }
 
 // BlockType returns the content block type for TextBlock.
@@ -214,6 +311,18 @@ func (b *TextBlock) BlockType() string {
 	return ContentBlockTypeText
 }
 
+// TextOf returns the concatenated text of the TextBlocks in blocks, skipping
+// thinking, tool use, and other blocks. It returns "" if there are none.
+func TextOf(blocks []ContentBlock) string {
+	var b strings.Builder
+	for _, block := range blocks {
+		if text, ok := block.(*TextBlock); ok && text != nil {
+			b.WriteString(text.Text)
+		}
+	}
+	return b.String()
+}
+
 // ThinkingBlock represents thinking content with signature.
 type ThinkingBlock struct {
 	MessageType string `json:"type"`
@@ -239,6 +348,21 @@ func (b *ToolUseBlock) BlockType() string {
 	return ContentBlockTypeToolUse
 }
 
+// IsMCP reports whether the block calls a tool provided by an MCP server,
+// named mcp__<server>__<tool>, rather than a built-in tool.
+func (b *ToolUseBlock) IsMCP() bool {
+	_, ok := b.ServerName()
+	return ok
+}
+
+// ServerName returns the MCP server providing the called tool, parsed from
+// its mcp__<server>__<tool> name. The second result is false for built-in
+// tools.
+func (b *ToolUseBlock) ServerName() (string, bool) {
+	server := mcpServerOfTool(b.Name)
+	return server, server != ""
+}
+
 // ToolResultBlock represents the result of a tool use.
 type ToolResultBlock struct {
 	MessageType string      `json:"type"`
@@ -252,6 +376,58 @@ func (b *ToolResultBlock) BlockType() string {
 	return ContentBlockTypeToolResult
 }
 
+// ServerToolUseBlock represents a server-side tool invocation such as web search.
+// Server tools run on the API side, so no tool_result is sent back for them.
+type ServerToolUseBlock struct {
+	MessageType string         `json:"type"`
+	ToolUseID   string         `json:"tool_use_id"`
+	Name        string         `json:"name"`
+	Input       map[string]any `json:"input"`
+}
+
+// BlockType returns the content block type for ServerToolUseBlock.
+func (b *ServerToolUseBlock) BlockType() string {
+	return ContentBlockTypeServerToolUse
+}
+
+// WebSearchResult is a single page returned by the web search tool.
+type WebSearchResult struct {
+	URL              string  `json:"url"`
+	Title            string  `json:"title"`
+	EncryptedContent string  `json:"encrypted_content,omitempty"`
+	PageAge          *string `json:"page_age,omitempty"`
+}
+
+// WebSearchResultBlock represents the results of a built-in web search.
+// Query is taken from the matching ServerToolUseBlock in the same message.
+// ErrorCode is set instead of Results when the search failed.
+type WebSearchResultBlock struct {
+	MessageType string            `json:"type"`
+	ToolUseID   string            `json:"tool_use_id"`
+	Query       string            `json:"query,omitempty"`
+	Results     []WebSearchResult `json:"results,omitempty"`
+	ErrorCode   string            `json:"error_code,omitempty"`
+}
+
+// BlockType returns the content block type for WebSearchResultBlock.
+func (b *WebSearchResultBlock) BlockType() string {
+	return ContentBlockTypeWebSearchToolResult
+}
+
+// ServerToolResultBlock represents the result of a built-in server tool other
+// than web search, such as web_fetch_tool_result or code_execution_tool_result.
+// MessageType holds the block type from the CLI and Content the raw payload.
+type ServerToolResultBlock struct {
+	MessageType string `json:"type"`
+	ToolUseID   string `json:"tool_use_id"`
+	Content     any    `json:"content"`
+}
+
+// BlockType returns the content block type for ServerToolResultBlock.
+func (b *ServerToolResultBlock) BlockType() string {
+	return b.MessageType
+}
+
 // RawControlMessage wraps raw control protocol messages for passthrough to the control handler.
 // Control messages are not parsed into typed structs by the parser - they are routed directly
 // to the control protocol handler which performs its own parsing.
@@ -300,9 +476,45 @@ type StreamEvent struct {
 	SessionID       string         `json:"session_id"`
 	Event           map[string]any `json:"event"`
 	ParentToolUseID *string        `json:"parent_tool_use_id,omitempty"`
+	QueryID         string         `json:"-"` // Set by Client.QueryWithID; not serialized
 }
 
 // Type returns the message type for StreamEvent.
 func (m *StreamEvent) Type() string {
 	return MessageTypeStreamEvent
 }
+
+// MessageQueryID returns the query ID attached to msg by Client.QueryWithID,
+// or "" if the message was not produced by an identified query.
+func MessageQueryID(msg Message) string {
+	switch m := msg.(type) {
+	case *UserMessage:
+		return m.QueryID
+	case *AssistantMessage:
+		return m.QueryID
+	case *SystemMessage:
+		return m.QueryID
+	case *ResultMessage:
+		return m.QueryID
+	case *StreamEvent:
+		return m.QueryID
+	}
+	return ""
+}
+
+// SetMessageQueryID attaches a query ID to msg.
+// Messages without a QueryID field are left unchanged.
+func SetMessageQueryID(msg Message, queryID string) {
+	switch m := msg.(type) {
+	case *UserMessage:
+		m.QueryID = queryID
+	case *AssistantMessage:
+		m.QueryID = queryID
+	case *SystemMessage:
+		m.QueryID = queryID
+	case *ResultMessage:
+		m.QueryID = queryID
+	case *StreamEvent:
+		m.QueryID = queryID
+	}
+}
@@ -541,6 +541,37 @@ func TestAssistantMessageGetError(t *testing.T) {
 	}
 }
 
+// TestTextOf tests only text block content is concatenated from mixed blocks
+func TestTextOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []ContentBlock
+		want   string
+	}{
+		{"nil blocks", nil, ""},
+		{"text only", []ContentBlock{&TextBlock{Text: "Hello"}}, "Hello"},
+		{"mixed blocks", []ContentBlock{
+			&ThinkingBlock{Thinking: "Let me check the file", Signature: "sig"},
+			&TextBlock{Text: "The file has "},
+			&ToolUseBlock{ToolUseID: "toolu_01", Name: "Read", Input: map[string]any{"file_path": "main.go"}},
+			&ToolResultBlock{ToolUseID: "toolu_01", Content: "package main"},
+			&TextBlock{Text: "one package."},
+		}, "The file has one package."},
+		{"no text blocks", []ContentBlock{&ThinkingBlock{Thinking: "hmm"}, &ToolUseBlock{Name: "Bash"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TextOf(tt.blocks); got != tt.want {
+				t.Errorf("TextOf() = %q, want %q", got, tt.want)
+			}
+			msg := &AssistantMessage{Content: tt.blocks, Model: "claude-3-sonnet"}
+			if got := msg.Text(); got != tt.want {
+				t.Errorf("Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestAssistantMessageErrorJSONMarshaling tests JSON marshaling with error field
 func TestAssistantMessageErrorJSONMarshaling(t *testing.T) {
 	// Test with error field set
@@ -0,0 +1,23 @@
+package shared
+
+// MessageHandler handles a parsed message on its way to the caller.
+type MessageHandler func(Message)
+
+// MessageMiddleware wraps the next handler in a message pipeline. It may
+// observe a message, pass a transformed message to next, drop it by not
+// calling next, or call next several times. next must be called before the
+// returned handler returns.
+type MessageMiddleware func(next MessageHandler) MessageHandler
+
+// ChainMessageMiddleware returns a handler running middlewares in order
+// around final: the first middleware sees each message first, and the last
+// one passes it to final. Nil middlewares are skipped.
+func ChainMessageMiddleware(final MessageHandler, middlewares ...MessageMiddleware) MessageHandler {
+	handler := final
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			handler = middlewares[i](handler)
+		}
+	}
+	return handler
+}
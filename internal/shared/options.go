@@ -2,13 +2,20 @@ package shared
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"os/exec"
+	"strings"
+	"time"
 )
 
 const (
 	// DefaultMaxThinkingTokens is the default maximum number of thinking tokens.
 	DefaultMaxThinkingTokens = 8000
+
+	// MaxThinkingTokensLimit is the largest accepted thinking token budget.
+	MaxThinkingTokensLimit = 128000
 )
 
 // PermissionMode represents the different permission handling modes.
@@ -25,6 +32,23 @@ const (
 	PermissionModeBypassPermissions PermissionMode = "bypassPermissions"
 )
 
+// DefaultContextFilesMaxBytes is the total size of context file content
+// included in a prompt when ContextFilesMaxBytes is zero.
+const DefaultContextFilesMaxBytes = 100 * 1024
+
+// LargePromptStrategy selects how prompts over the large prompt threshold are handled.
+type LargePromptStrategy string
+
+const (
+	// LargePromptStrategyError rejects the prompt with a PromptTooLargeError.
+	LargePromptStrategyError LargePromptStrategy = "error"
+	// LargePromptStrategyTruncate cuts the prompt to the threshold.
+	LargePromptStrategyTruncate LargePromptStrategy = "truncate"
+	// LargePromptStrategyFile writes the prompt to a temporary file and sends
+	// a short prompt asking the model to read it.
+	LargePromptStrategyFile LargePromptStrategy = "file"
+)
+
 // SdkBeta represents a beta feature identifier.
 // See https://docs.anthropic.com/en/api/beta-headers
 type SdkBeta string
@@ -129,6 +153,45 @@ const (
 	AgentModelInherit AgentModel = "inherit"
 )
 
+// ResourceLimits caps resources available to the CLI subprocess. Limits are
+// inherited by the tool processes the CLI spawns. Zero fields are not limited.
+type ResourceLimits struct {
+	// MaxMemoryBytes limits the virtual address space (RLIMIT_AS) in bytes.
+	MaxMemoryBytes uint64
+	// MaxCPUSeconds limits CPU time (RLIMIT_CPU) in seconds.
+	MaxCPUSeconds uint64
+}
+
+// PartialStreamOptions selects which content_block_delta stream events are
+// forwarded. Other stream events (message and content block boundaries) are
+// always forwarded.
+type PartialStreamOptions struct {
+	// Text forwards text_delta events.
+	Text bool
+	// ToolInput forwards input_json_delta events.
+	ToolInput bool
+	// Thinking forwards thinking_delta and signature_delta events.
+	Thinking bool
+}
+
+// AllowsEvent reports whether a stream event should be forwarded.
+// Deltas of unrecognized types are forwarded.
+func (p PartialStreamOptions) AllowsEvent(event map[string]any) bool {
+	if event["type"] != StreamEventTypeContentBlockDelta {
+		return true
+	}
+	delta, _ := event["delta"].(map[string]any)
+	switch delta["type"] {
+	case StreamDeltaTypeText:
+		return p.Text
+	case StreamDeltaTypeInputJSON:
+		return p.ToolInput
+	case StreamDeltaTypeThinking, StreamDeltaTypeSignature:
+		return p.Thinking
+	}
+	return true
+}
+
 // AgentDefinition defines a programmatic subagent.
 type AgentDefinition struct {
 	// Description is a brief description of the agent's purpose.
@@ -144,6 +207,24 @@ type AgentDefinition struct {
 	Model AgentModel `json:"model,omitempty"`
 }
 
+// AllowsTool reports whether toolName is in the agent's Tools list.
+// An empty list allows every tool. Entries with a rule specifier such as
+// "Bash(git:*)" match on the tool name before the parenthesis.
+func (a AgentDefinition) AllowsTool(toolName string) bool {
+	if len(a.Tools) == 0 {
+		return true
+	}
+	for _, tool := range a.Tools {
+		if idx := strings.IndexByte(tool, '('); idx >= 0 {
+			tool = tool[:idx]
+		}
+		if strings.TrimSpace(tool) == toolName {
+			return true
+		}
+	}
+	return false
+}
+
 // Options configures the Claude Agent SDK behavior.
 type Options struct {
 	// Tool Control
@@ -164,6 +245,38 @@ type Options struct {
 	FallbackModel      *string `json:"fallback_model,omitempty"`
 	MaxThinkingTokens  int     `json:"max_thinking_tokens,omitempty"`
 
+	// LargePromptThreshold is the prompt size in bytes above which
+	// LargePromptStrategy applies. Zero (default) disables the check.
+	LargePromptThreshold int                 `json:"-"` // Not serialized
+	LargePromptStrategy  LargePromptStrategy `json:"-"` // Not serialized
+
+	// InputValidation rejects empty prompts, and prompts shorter than
+	// PromptMinLength or longer than PromptMaxLength bytes, with a
+	// ValidationError before they are sent. Zero PromptMaxLength means no
+	// maximum.
+	InputValidation bool `json:"-"` // Not serialized
+	PromptMinLength int  `json:"-"` // Not serialized
+	PromptMaxLength int  `json:"-"` // Not serialized
+
+	// ContextFiles are read and prepended, with path headers, to the first
+	// prompt sent, within ContextFilesMaxBytes of file content in total.
+	// Zero ContextFilesMaxBytes uses DefaultContextFilesMaxBytes.
+	ContextFiles         []string `json:"-"` // Not serialized
+	ContextFilesMaxBytes int      `json:"-"` // Not serialized
+
+	// ContextManifest lists files relevant to the session without reading
+	// them. The CLI has no manifest flag, so the paths are listed in a section
+	// appended to the system prompt, after AppendSystemPrompt.
+	ContextManifest []string `json:"-"` // Not serialized
+
+	// PromptSuffix is appended, after a blank line, to every text prompt
+	// before the request interceptor runs.
+	PromptSuffix string `json:"-"` // Not serialized
+
+	// PromptCaching enables or disables prompt caching in the CLI.
+	// If nil (default), the CLI's own setting is used.
+	PromptCaching *bool `json:"-"` // Not serialized
+
 	// Budget & Billing
 	MaxBudgetUSD *float64 `json:"max_budget_usd,omitempty"`
 	User         *string  `json:"user,omitempty"`
@@ -178,14 +291,31 @@ type Options struct {
 	// Session & State Management
 	ContinueConversation bool            `json:"continue_conversation,omitempty"`
 	Resume               *string         `json:"resume,omitempty"`
+	ResumeSessionAt      *string         `json:"resume_session_at,omitempty"`
 	MaxTurns             int             `json:"max_turns,omitempty"`
 	Settings             *string         `json:"settings,omitempty"`
 	ForkSession          bool            `json:"fork_session,omitempty"`
 	SettingSources       []SettingSource `json:"setting_sources,omitempty"`
 
+	// FailFast interrupts the session and surfaces a ToolExecutionError
+	// as soon as any tool result reports is_error=true.
+	FailFast bool `json:"fail_fast,omitempty"`
+
+	// StopAfterFirstResponse interrupts the turn once the first complete
+	// AssistantMessage has been delivered.
+	StopAfterFirstResponse bool `json:"stop_after_first_response,omitempty"`
+
+	// StrictContentTypes fails parsing of messages containing content blocks
+	// of unknown type instead of skipping those blocks.
+	StrictContentTypes bool `json:"-"` // Not serialized
+
 	// Partial Message Streaming
 	IncludePartialMessages bool `json:"include_partial_messages,omitempty"`
 
+	// PartialStream selects which content_block_delta types are forwarded when
+	// partial messages are included. Nil forwards all of them.
+	PartialStream *PartialStreamOptions `json:"-"` // Not serialized
+
 	// File Checkpointing (Issue #32)
 	// EnableFileCheckpointing enables file change tracking for rewind support.
 	// When enabled, files can be rewound to their state at any user message
@@ -202,6 +332,11 @@ type Options struct {
 	// MCP Integration
 	McpServers map[string]McpServerConfig `json:"mcp_servers,omitempty"`
 
+	// McpServerStartupTimeout bounds how long MCP servers may take to start.
+	// It is passed to the CLI and limits how long WaitForReady waits for an
+	// init message reporting every server ready. Zero (default) means no limit.
+	McpServerStartupTimeout time.Duration `json:"-"` // Not serialized
+
 	// Sandbox Configuration
 	Sandbox *SandboxSettings `json:"sandbox,omitempty"`
 
@@ -215,10 +350,18 @@ type Options struct {
 	// These are merged with the system environment variables.
 	ExtraEnv map[string]string `json:"extra_env,omitempty"`
 
+	// CLIArgsOverride rewrites the CLI arguments the SDK built, excluding the
+	// executable path, just before the CLI is started. Nil keeps the defaults.
+	CLIArgsOverride func(defaults []string) []string `json:"-"` // Not serialized
+
 	// OutputFormat specifies structured output format with JSON schema.
 	// When set, Claude's response will conform to the provided schema.
 	OutputFormat *OutputFormat `json:"output_format,omitempty"`
 
+	// StrictStructuredOutput rejects structured output with fields not allowed
+	// by OutputFormat's schema. Use with a schema closed by StrictJSONSchema.
+	StrictStructuredOutput bool `json:"-"` // Not serialized
+
 	// CLI Path (for testing and custom installations)
 	CLIPath *string `json:"cli_path,omitempty"`
 
@@ -227,6 +370,15 @@ type Options struct {
 	// Common values: os.Stderr, io.Discard, or a custom io.Writer.
 	DebugWriter io.Writer `json:"-"` // Not serialized
 
+	// RedactDebugOutput masks secret-looking substrings (API keys, bearer
+	// tokens, auth headers) in all stderr output delivered to DebugWriter
+	// or StderrCallback.
+	RedactDebugOutput bool `json:"-"` // Not serialized
+
+	// DebugRedactionPatterns are additional regular expressions redacted
+	// alongside the default secret patterns when RedactDebugOutput is set.
+	DebugRedactionPatterns []string `json:"-"` // Not serialized
+
 	// StderrCallback receives CLI stderr output line-by-line.
 	// If set, takes precedence over DebugWriter for stderr handling.
 	// Each line is stripped of trailing whitespace and empty lines are skipped.
@@ -234,6 +386,220 @@ type Options struct {
 	// Matches Python SDK's stderr callback behavior.
 	StderrCallback func(string) `json:"-"` // Not serialized
 
+	// ResourceLimits caps CPU time and memory of the CLI subprocess.
+	// Applied on Linux only; other platforms ignore it with a warning.
+	ResourceLimits *ResourceLimits `json:"-"` // Not serialized
+
+	// ProcessGroupKill starts the CLI in its own process group and kills the
+	// whole group on shutdown, so processes it spawns are not orphaned.
+	// Unix only; other platforms ignore it with a warning.
+	ProcessGroupKill bool `json:"-"` // Not serialized
+
+	// CmdCustomizer is called with the CLI command after the SDK has
+	// configured it and just before it starts, to tune attributes the SDK
+	// does not expose. It must not replace the command's stdin, stdout, or
+	// stderr, its path, or its arguments.
+	CmdCustomizer func(*exec.Cmd) `json:"-"` // Not serialized
+
+	// SubprocessLimiter bounds live CLI subprocesses across every Query and
+	// Client sharing it. Connect waits for a free slot, held until Close.
+	SubprocessLimiter *SubprocessLimiter `json:"-"` // Not serialized
+
+	// CleanEnv starts the CLI subprocess with a minimal environment: PATH plus
+	// variables the SDK sets and those passed via ExtraEnv. The host
+	// environment is otherwise not inherited.
+	CleanEnv bool `json:"-"` // Not serialized
+
+	// ProgressHeartbeatInterval is how often a progress marker is written
+	// while a turn is active. Zero (default) disables heartbeats.
+	ProgressHeartbeatInterval time.Duration `json:"-"` // Not serialized
+
+	// ProgressHeartbeatWriter receives the progress markers.
+	// Heartbeats are disabled when nil.
+	ProgressHeartbeatWriter io.Writer `json:"-"` // Not serialized
+
+	// GracefulInterruptGrace, when positive, makes cancelling the connect
+	// context interrupt the CLI and wait up to this long for it to exit before
+	// killing it. Zero (default) kills the CLI as soon as the context is done.
+	GracefulInterruptGrace time.Duration `json:"-"` // Not serialized
+
+	// MaxSessionDuration caps how long a connected session may run. When it
+	// elapses the CLI is terminated and a SessionExpiredError is sent on the
+	// error channel. Zero (default) means no limit.
+	MaxSessionDuration time.Duration `json:"-"` // Not serialized
+
+	// MaxIdleTime disconnects a Client after this long with no queries sent
+	// or messages received. Later use returns an IdleDisconnectError until
+	// the Client reconnects. Zero (default) never disconnects.
+	MaxIdleTime time.Duration `json:"-"` // Not serialized
+
+	// OverloadBackoffBase makes a Client resend the latest query's prompt
+	// when its turn ends in an overloaded error, after a jittered delay
+	// starting at this and doubling per retry. Zero (default) disables it.
+	OverloadBackoffBase time.Duration `json:"-"` // Not serialized
+
+	// OverloadBackoffMax caps the overload retry delay. Must be at least
+	// OverloadBackoffBase when that is set.
+	OverloadBackoffMax time.Duration `json:"-"` // Not serialized
+
+	// Warmup makes Client.Connect complete the CLI's initialize handshake
+	// before returning, so the CLI is started before the first query.
+	Warmup bool `json:"-"` // Not serialized
+
+	// PartialResultsOnCancel makes a Query iterator return a
+	// PartialResultsError holding the messages received so far when its
+	// context is cancelled, instead of the bare context error.
+	PartialResultsOnCancel bool `json:"-"` // Not serialized
+
+	// MaxOutputBytes caps the total bytes read from the CLI's stdout in a
+	// session. When exceeded the CLI is killed and an OutputLimitExceededError
+	// is sent on the error channel. Zero (default) means no limit.
+	MaxOutputBytes int64 `json:"-"` // Not serialized
+
+	// TranscriptWriter receives every message read from the CLI as one JSON
+	// object per line, in the CLI's wire format, before MessageFilter is
+	// applied. Control protocol messages are not written. Disabled when nil.
+	TranscriptWriter io.Writer `json:"-"` // Not serialized
+
+	// RawStdoutTee receives the CLI's stdout bytes verbatim, before parsing,
+	// including control protocol traffic and malformed lines. Disabled when nil.
+	RawStdoutTee io.Writer `json:"-"` // Not serialized
+
+	// MessageFilter decides which parsed messages are delivered to the caller.
+	// Return true to deliver, false to drop. If nil, all messages are delivered.
+	// Filtered messages are still tracked for stream validation.
+	// Filter panics are recovered and the message is delivered.
+	MessageFilter func(Message) bool `json:"-"` // Not serialized
+
+	// MessageMiddleware runs in order on each parsed message after stream
+	// validation, callbacks, and trackers have seen it, and before
+	// MessageFilter. Middleware panics are recovered and the original message
+	// is delivered if it had not been passed on.
+	MessageMiddleware []MessageMiddleware `json:"-"` // Not serialized
+
+	// ToolResultPostProcessor transforms SDK-mediated tool results before they
+	// reach the model: SDK MCP tool results and tool_result blocks sent by the SDK.
+	// It receives the tool name and content and returns replacement content.
+	ToolResultPostProcessor func(toolName string, content any) any `json:"-"` // Not serialized
+
+	// ToolResultMaxItems caps SDK-mediated tool result content lists at this
+	// many items, followed by a note counting those omitted, after
+	// ToolResultPostProcessor. Zero (default) means no limit.
+	ToolResultMaxItems int `json:"-"` // Not serialized
+
+	// ToolResultDeduplication replaces SDK-mediated tool result content
+	// identical to an earlier result in the session with a short note,
+	// after ToolResultPostProcessor and ToolResultMaxItems. Only results of at least
+	// MinDeduplicatedToolResultBytes are replaced.
+	ToolResultDeduplication bool `json:"-"` // Not serialized
+
+	// SdkMcpTrace is called with the method and raw params of each JSON-RPC
+	// request dispatched to an SDK MCP server. Callback panics are recovered.
+	SdkMcpTrace func(method string, params json.RawMessage) `json:"-"` // Not serialized
+
+	// CostTracker accumulates usage and cost from every ResultMessage received.
+	// If nil (default), no tracking is performed.
+	CostTracker *CostTracker `json:"-"` // Not serialized
+
+	// ToolMetrics aggregates per-tool invocations, outcomes, and durations
+	// from received messages. If nil (default), no metrics are collected.
+	ToolMetrics *ToolMetrics `json:"-"` // Not serialized
+
+	// ResponseCollector aggregates each turn's text, tool uses, thinking, and
+	// result into a Response. If nil (default), no responses are collected.
+	ResponseCollector *ResponseCollector `json:"-"` // Not serialized
+
+	// Tracer receives spans around turns and SDK MCP tool handler calls.
+	Tracer Tracer `json:"-"` // Not serialized
+
+	// Clock drives session deadlines, idle disconnects, progress heartbeats,
+	// graceful interrupt grace periods, and the MCP startup timeout.
+	// If nil (default), the system clock is used.
+	Clock Clock `json:"-"` // Not serialized
+
+	// RequestInterceptor runs on every text prompt before it is sent to the
+	// CLI. It returns the prompt to send, or an error to reject the prompt.
+	RequestInterceptor func(prompt string) (string, error) `json:"-"` // Not serialized
+
+	// OnThinking is called with each thinking block as assistant messages are
+	// parsed, before MessageFilter is applied. Callback panics are recovered.
+	OnThinking func(*ThinkingBlock) `json:"-"` // Not serialized
+
+	// OnToolResult is called with each tool result block as user messages are
+	// parsed, before MessageFilter is applied. Callback panics are recovered.
+	OnToolResult func(*ToolResultBlock) `json:"-"` // Not serialized
+
+	// OnResultError is called with each result message whose IsError is set,
+	// before MessageFilter is applied. Transport and connection errors do not
+	// reach it. Callback panics are recovered.
+	OnResultError func(*ResultMessage) `json:"-"` // Not serialized
+
+	// OnTurnStart is called with each prompt once it is sent by Query,
+	// QueryWithTransport, or a Client query, and OnTurnEnd with each
+	// ResultMessage before it is delivered. Callback panics are recovered.
+	OnTurnStart func(prompt string)  `json:"-"` // Not serialized
+	OnTurnEnd   func(*ResultMessage) `json:"-"` // Not serialized
+
+	// OnToolsChanged is called with the session's tool list when the first
+	// system message listing tools arrives and whenever a later one changes
+	// it, e.g. after MCP servers reconnect. Callback panics are recovered.
+	OnToolsChanged func([]ToolInfo) `json:"-"` // Not serialized
+
+	// OnResourceUpdate is called with each experimental resource update
+	// system message, before MessageFilter is applied. Callback panics are
+	// recovered.
+	OnResourceUpdate func(ResourceUpdate) `json:"-"` // Not serialized
+
+	// OnStreamEvent is called with each stream event, decoded, as partial
+	// messages are parsed, before MessageFilter is applied. Requires
+	// IncludePartialMessages. Callback panics are recovered.
+	OnStreamEvent func(ParsedStreamEvent) `json:"-"` // Not serialized
+
+	// OnDisconnect is called once when a Client connection ends, with nil
+	// for Disconnect or the error or context error that ended it.
+	// Callback panics are recovered.
+	OnDisconnect func(reason error) `json:"-"` // Not serialized
+
+	// SessionStore persists the Client's CLI session ID under SessionStoreKey
+	// and resumes it on Connect, unless Resume is set explicitly.
+	SessionStore    SessionStore `json:"-"` // Not serialized
+	SessionStoreKey string       `json:"-"` // Not serialized
+
+	// QueryRateLimit paces Client queries to this many per second with
+	// bursts of up to QueryRateBurst, using a token bucket. Queries wait
+	// for their turn. Zero (default) disables pacing.
+	QueryRateLimit float64 `json:"-"` // Not serialized
+	QueryRateBurst int     `json:"-"` // Not serialized
+
+	// OnPlanProposal decides plans Claude proposes in plan mode by calling
+	// ExitPlanMode: true approves the plan, false keeps Claude in plan mode.
+	// Decided through the permission callback, before CanUseTool.
+	OnPlanProposal func(*PlanProposal) bool `json:"-"` // Not serialized
+
+	// EditConfirmation approves Write, Edit, and MultiEdit tool calls from a
+	// unified diff of the change against the current file: true lets the
+	// request continue to CanUseTool, or allows it without CanUseTool, and
+	// false denies it. Decided through the permission callback, before
+	// CanUseTool.
+	EditConfirmation func(path, diff string) bool `json:"-"` // Not serialized
+
+	// EnforceAgentToolAllowlist denies subagent tool requests for tools outside
+	// the requesting agent's AgentDefinition.Tools list, and requests from
+	// agents not in Agents. Enforced through the permission callback, so
+	// CanUseTool still decides tools an agent may use; without CanUseTool
+	// they are denied.
+	EnforceAgentToolAllowlist bool `json:"-"` // Not serialized
+
+	// ToolNameNormalization compares tool names in the SDK's permission
+	// checks and allowlists by their NormalizeToolName form, and passes that
+	// form to CanUseTool. AllowedTools and DisallowedTools are then also
+	// enforced by the permission callback.
+	ToolNameNormalization bool `json:"-"` // Not serialized
+
+	// ToolApprovalCache remembers CanUseTool decisions by tool name and input
+	// and reuses them for identical requests instead of calling CanUseTool.
+	ToolApprovalCache *ToolApprovalCache `json:"-"` // Not serialized
+
 	// CanUseTool is invoked when CLI requests permission to use a tool.
 	// The callback receives the tool name, input parameters, and permission context.
 	// Return PermissionResultAllow to permit, PermissionResultDeny to deny.
@@ -266,6 +632,8 @@ const (
 	McpServerTypeSSE McpServerType = "sse"
 	// McpServerTypeHTTP represents an HTTP-based MCP server.
 	McpServerTypeHTTP McpServerType = "http"
+	// McpServerTypeWebSocket represents a WebSocket MCP server.
+	McpServerTypeWebSocket McpServerType = "ws"
 )
 
 // McpServerConfig represents MCP server configuration.
@@ -310,6 +678,18 @@ func (c *McpHTTPServerConfig) GetType() McpServerType {
 	return McpServerTypeHTTP
 }
 
+// McpWebSocketServerConfig configures an MCP WebSocket server.
+type McpWebSocketServerConfig struct {
+	Type    McpServerType     `json:"type"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// GetType returns the server type for McpWebSocketServerConfig.
+func (c *McpWebSocketServerConfig) GetType() McpServerType {
+	return McpServerTypeWebSocket
+}
+
 // McpServerTypeSdk represents an in-process SDK MCP server.
 const McpServerTypeSdk McpServerType = "sdk"
 
@@ -326,6 +706,17 @@ type McpServer interface {
 	CallTool(ctx context.Context, name string, args map[string]any) (*McpToolResult, error)
 }
 
+// PlanProposal is a plan Claude proposes in plan permission mode when it
+// asks to leave plan mode through the ExitPlanMode tool.
+type PlanProposal struct {
+	// Plan is the proposed plan, usually markdown.
+	Plan string
+	// Input is the raw ExitPlanMode tool input.
+	Input map[string]any
+	// AgentID identifies the subagent proposing the plan, or "" for the main agent.
+	AgentID string
+}
+
 // McpSdkServerConfig configures an in-process SDK MCP server.
 // The Instance field contains the actual server implementation and is
 // excluded from JSON serialization (not sent to CLI).
@@ -366,8 +757,90 @@ type McpContent struct {
 // Validate checks the options for valid values and constraints.
 func (o *Options) Validate() error {
 	// Validate MaxThinkingTokens
-	if o.MaxThinkingTokens < 0 {
-		return fmt.Errorf("MaxThinkingTokens must be non-negative, got %d", o.MaxThinkingTokens)
+	if err := ValidateMaxThinkingTokens(o.MaxThinkingTokens); err != nil {
+		return err
+	}
+
+	// Validate ProgressHeartbeatInterval
+	if o.ProgressHeartbeatInterval < 0 {
+		return fmt.Errorf("ProgressHeartbeatInterval must be non-negative, got %v", o.ProgressHeartbeatInterval)
+	}
+
+	// Validate GracefulInterruptGrace
+	if o.GracefulInterruptGrace < 0 {
+		return fmt.Errorf("GracefulInterruptGrace must be non-negative, got %v", o.GracefulInterruptGrace)
+	}
+
+	// Validate MaxSessionDuration
+	if o.MaxSessionDuration < 0 {
+		return fmt.Errorf("MaxSessionDuration must be non-negative, got %v", o.MaxSessionDuration)
+	}
+	if o.MaxIdleTime < 0 {
+		return fmt.Errorf("MaxIdleTime must be non-negative, got %v", o.MaxIdleTime)
+	}
+
+	// Validate overload backoff
+	if o.OverloadBackoffBase < 0 {
+		return fmt.Errorf("OverloadBackoffBase must be non-negative, got %v", o.OverloadBackoffBase)
+	}
+	if o.OverloadBackoffBase > 0 && o.OverloadBackoffMax < o.OverloadBackoffBase {
+		return fmt.Errorf("OverloadBackoffMax must be at least OverloadBackoffBase (%v), got %v",
+			o.OverloadBackoffBase, o.OverloadBackoffMax)
+	}
+
+	// Validate ToolResultMaxItems
+	if o.ToolResultMaxItems < 0 {
+		return fmt.Errorf("ToolResultMaxItems must be non-negative, got %d", o.ToolResultMaxItems)
+	}
+
+	// Validate MaxOutputBytes
+	if o.MaxOutputBytes < 0 {
+		return fmt.Errorf("MaxOutputBytes must be non-negative, got %d", o.MaxOutputBytes)
+	}
+
+	// Validate query rate limiting
+	if o.QueryRateLimit < 0 {
+		return fmt.Errorf("QueryRateLimit must be non-negative, got %v", o.QueryRateLimit)
+	}
+	if o.QueryRateBurst < 0 {
+		return fmt.Errorf("QueryRateBurst must be non-negative, got %d", o.QueryRateBurst)
+	}
+
+	// Validate McpServerStartupTimeout
+	if o.McpServerStartupTimeout < 0 {
+		return fmt.Errorf("McpServerStartupTimeout must be non-negative, got %v", o.McpServerStartupTimeout)
+	}
+
+	// Validate prompt length bounds
+	if o.PromptMinLength < 0 {
+		return fmt.Errorf("PromptMinLength must be non-negative, got %d", o.PromptMinLength)
+	}
+	if o.PromptMaxLength < 0 {
+		return fmt.Errorf("PromptMaxLength must be non-negative, got %d", o.PromptMaxLength)
+	}
+	if o.PromptMaxLength > 0 && o.PromptMaxLength < o.PromptMinLength {
+		return fmt.Errorf("PromptMaxLength must be at least PromptMinLength (%d), got %d",
+			o.PromptMinLength, o.PromptMaxLength)
+	}
+
+	// Validate large prompt handling
+	if o.LargePromptThreshold < 0 {
+		return fmt.Errorf("LargePromptThreshold must be non-negative, got %d", o.LargePromptThreshold)
+	}
+	switch o.LargePromptStrategy {
+	case "", LargePromptStrategyError, LargePromptStrategyTruncate, LargePromptStrategyFile:
+	default:
+		return fmt.Errorf("unknown LargePromptStrategy %q", o.LargePromptStrategy)
+	}
+	if o.ContextFilesMaxBytes < 0 {
+		return fmt.Errorf("ContextFilesMaxBytes must be non-negative, got %d", o.ContextFilesMaxBytes)
+	}
+
+	// Validate DebugRedactionPatterns compile
+	if o.RedactDebugOutput {
+		if _, err := NewRedactor(o.DebugRedactionPatterns...); err != nil {
+			return err
+		}
 	}
 
 	// Validate MaxTurns
@@ -387,6 +860,46 @@ func (o *Options) Validate() error {
 		}
 	}
 
+	// Validate agent tool allowlists have something to enforce
+	if o.EnforceAgentToolAllowlist {
+		if err := o.validateAgentToolAllowlists(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateMaxThinkingTokens checks a thinking token budget is between 0 and
+// MaxThinkingTokensLimit, returning a *ValidationError otherwise.
+func ValidateMaxThinkingTokens(tokens int) error {
+	if tokens < 0 {
+		return NewValidationError("MaxThinkingTokens", tokens,
+			fmt.Sprintf("MaxThinkingTokens must be non-negative, got %d", tokens))
+	}
+	if tokens > MaxThinkingTokensLimit {
+		return NewValidationError("MaxThinkingTokens", tokens,
+			fmt.Sprintf("MaxThinkingTokens must be at most %d, got %d", MaxThinkingTokensLimit, tokens))
+	}
+	return nil
+}
+
+// validateAgentToolAllowlists checks agent definitions used for tool enforcement.
+func (o *Options) validateAgentToolAllowlists() error {
+	restricted := false
+	for name, agent := range o.Agents {
+		for _, tool := range agent.Tools {
+			if strings.TrimSpace(tool) == "" {
+				return fmt.Errorf("agent '%s' has an empty tool name in Tools", name)
+			}
+		}
+		if len(agent.Tools) > 0 {
+			restricted = true
+		}
+	}
+	if !restricted {
+		return fmt.Errorf("EnforceAgentToolAllowlist requires at least one agent with a Tools list")
+	}
 	return nil
 }
 
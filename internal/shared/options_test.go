@@ -2,6 +2,7 @@ package shared
 
 import (
 	"testing"
+	"time"
 )
 
 // TestOptionsDefaults tests Options struct default values using table-driven approach
@@ -92,6 +93,25 @@ func TestOptionsValidation(t *testing.T) {
 			wantErr: true,
 			errMsg:  "MaxThinkingTokens must be non-negative, got -100",
 		},
+		{
+			name: "thinking_tokens_at_limit",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.MaxThinkingTokens = MaxThinkingTokensLimit
+				return opts
+			},
+			wantErr: false,
+		},
+		{
+			name: "thinking_tokens_above_limit",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.MaxThinkingTokens = MaxThinkingTokensLimit + 1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "MaxThinkingTokens must be at most 128000, got 128001",
+		},
 		{
 			name: "conflicting_tools",
 			setup: func() *Options {
@@ -113,6 +133,159 @@ func TestOptionsValidation(t *testing.T) {
 			wantErr: true,
 			errMsg:  "MaxTurns must be non-negative, got -5",
 		},
+		{
+			name: "negative_mcp_startup_timeout",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.McpServerStartupTimeout = -time.Second
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "McpServerStartupTimeout must be non-negative, got -1s",
+		},
+		{
+			name: "negative_graceful_interrupt_grace",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.GracefulInterruptGrace = -time.Second
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "GracefulInterruptGrace must be non-negative, got -1s",
+		},
+		{
+			name: "negative_max_session_duration",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.MaxSessionDuration = -time.Minute
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "MaxSessionDuration must be non-negative, got -1m0s",
+		},
+		{
+			name: "negative_max_idle_time",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.MaxIdleTime = -time.Minute
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "MaxIdleTime must be non-negative, got -1m0s",
+		},
+		{
+			name: "negative_prompt_min_length",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.PromptMinLength = -1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "PromptMinLength must be non-negative, got -1",
+		},
+		{
+			name: "prompt_max_length_below_min",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.PromptMinLength = 10
+				opts.PromptMaxLength = 5
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "PromptMaxLength must be at least PromptMinLength (10), got 5",
+		},
+		{
+			name: "negative_overload_backoff_base",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.OverloadBackoffBase = -time.Second
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "OverloadBackoffBase must be non-negative, got -1s",
+		},
+		{
+			name: "overload_backoff_max_below_base",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.OverloadBackoffBase = time.Second
+				opts.OverloadBackoffMax = time.Millisecond
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "OverloadBackoffMax must be at least OverloadBackoffBase (1s), got 1ms",
+		},
+		{
+			name: "negative_tool_result_max_items",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.ToolResultMaxItems = -1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "ToolResultMaxItems must be non-negative, got -1",
+		},
+		{
+			name: "negative_max_output_bytes",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.MaxOutputBytes = -1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "MaxOutputBytes must be non-negative, got -1",
+		},
+		{
+			name: "negative_query_rate_limit",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.QueryRateLimit = -0.5
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "QueryRateLimit must be non-negative, got -0.5",
+		},
+		{
+			name: "negative_query_rate_burst",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.QueryRateLimit = 1
+				opts.QueryRateBurst = -1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "QueryRateBurst must be non-negative, got -1",
+		},
+		{
+			name: "negative_large_prompt_threshold",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.LargePromptThreshold = -1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "LargePromptThreshold must be non-negative, got -1",
+		},
+		{
+			name: "unknown_large_prompt_strategy",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.LargePromptStrategy = "split"
+				return opts
+			},
+			wantErr: true,
+			errMsg:  `unknown LargePromptStrategy "split"`,
+		},
+		{
+			name: "negative_context_files_max_bytes",
+			setup: func() *Options {
+				opts := NewOptions()
+				opts.ContextFilesMaxBytes = -1
+				return opts
+			},
+			wantErr: true,
+			errMsg:  "ContextFilesMaxBytes must be non-negative, got -1",
+		},
 	}
 
 	for _, test := range tests {
@@ -156,6 +329,14 @@ func TestMcpServerTypes(t *testing.T) {
 			},
 			expectedType: McpServerTypeHTTP,
 		},
+		{
+			name: "websocket_server",
+			config: &McpWebSocketServerConfig{
+				Type: McpServerTypeWebSocket,
+				URL:  "wss://example.com/ws",
+			},
+			expectedType: McpServerTypeWebSocket,
+		},
 	}
 
 	for _, test := range tests {
@@ -288,3 +469,37 @@ func TestSandboxSettingsTypes(t *testing.T) {
 		t.Error("Expected IgnoreViolations to be set")
 	}
 }
+
+// TestPartialStreamOptionsAllowsEvent tests delta selection for each delta type
+func TestPartialStreamOptionsAllowsEvent(t *testing.T) {
+	delta := func(deltaType string) map[string]any {
+		return map[string]any{
+			"type":  StreamEventTypeContentBlockDelta,
+			"index": 0,
+			"delta": map[string]any{"type": deltaType},
+		}
+	}
+
+	textOnly := PartialStreamOptions{Text: true}
+	tests := []struct {
+		name  string
+		event map[string]any
+		want  bool
+	}{
+		{"text_enabled", delta(StreamDeltaTypeText), true},
+		{"tool_input_disabled", delta(StreamDeltaTypeInputJSON), false},
+		{"thinking_disabled", delta(StreamDeltaTypeThinking), false},
+		{"signature_follows_thinking", delta(StreamDeltaTypeSignature), false},
+		{"unknown_delta_forwarded", delta("citations_delta"), true},
+		{"block_start_forwarded", map[string]any{"type": StreamEventTypeContentBlockStart}, true},
+		{"message_stop_forwarded", map[string]any{"type": StreamEventTypeMessageStop}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := textOnly.AllowsEvent(test.event); got != test.want {
+				t.Errorf("Expected AllowsEvent = %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package shared
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff returns the fields that differ between o and other, keyed by Go field
+// name, each formatted as "<o's value> -> <other's value>". Callbacks and
+// fields holding them, such as CanUseTool, Hooks, and MessageMiddleware, are
+// skipped. Nil and empty slices and maps are equal. Interface values such as
+// Clock or DebugWriter are shown by type, and ExtraEnv values are redacted. A
+// nil Options compares as the zero value.
+//
+// Example:
+//
+//	for field, change := range claudecode.NewOptions().Diff(options) {
+//	    log.Printf("%s: %s", field, change)
+//	}
+func (o *Options) Diff(other *Options) map[string]string {
+	if o == nil {
+		o = &Options{}
+	}
+	if other == nil {
+		other = &Options{}
+	}
+
+	before, after := reflect.ValueOf(o).Elem(), reflect.ValueOf(other).Elem()
+	optionsType := before.Type()
+	diff := make(map[string]string)
+	for i := 0; i < optionsType.NumField(); i++ {
+		field := optionsType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		a, b := before.Field(i), after.Field(i)
+		if holdsCallback(a) || holdsCallback(b) || optionValuesEqual(a, b) {
+			continue
+		}
+		diff[field.Name] = formatOptionValue(field.Name, a) + " -> " + formatOptionValue(field.Name, b)
+	}
+	return diff
+}
+
+// holdsCallback reports whether v is or contains a function.
+func holdsCallback(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return typeHoldsFunc(v.Type(), map[reflect.Type]bool{})
+		}
+		v = v.Elem()
+	}
+	return typeHoldsFunc(v.Type(), map[reflect.Type]bool{})
+}
+
+// typeHoldsFunc reports whether values of t are or contain functions.
+// seen guards against recursive types.
+func typeHoldsFunc(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Func:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return typeHoldsFunc(t.Elem(), seen)
+	case reflect.Map:
+		return typeHoldsFunc(t.Key(), seen) || typeHoldsFunc(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && typeHoldsFunc(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// optionValuesEqual compares two option field values, treating nil and empty
+// slices and maps as equal.
+func optionValuesEqual(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// formatOptionValue formats an option field value for Diff.
+func formatOptionValue(name string, v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "<nil>"
+		}
+		if isOpaqueStruct(v.Elem()) {
+			return fmt.Sprintf("%T", v.Interface())
+		}
+		return formatOptionValue(name, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return "<nil>"
+		}
+		if v.NumMethod() > 0 {
+			// Objects such as clocks and writers have no useful printed form
+			return fmt.Sprintf("%T", v.Interface())
+		}
+		return formatOptionValue(name, v.Elem())
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Struct:
+		return fmt.Sprintf("%+v", v.Interface())
+	case reflect.Map:
+		if name == "ExtraEnv" {
+			return redactedEnv(v)
+		}
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// isOpaqueStruct reports whether v is a struct with only unexported fields,
+// such as a cache or limiter, whose printed form would expose internals.
+func isOpaqueStruct(v reflect.Value) bool {
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+// redactedEnv formats an environment map with its values redacted.
+func redactedEnv(v reflect.Value) string {
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	redacted := make([]string, len(keys))
+	for i, key := range keys {
+		redacted[i] = key + ":" + RedactedPlaceholder
+	}
+	return "map[" + strings.Join(redacted, " ") + "]"
+}
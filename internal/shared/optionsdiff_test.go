@@ -0,0 +1,64 @@
+package shared
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOptionsDiff tests a customized Options is diffed against defaults
+func TestOptionsDiff(t *testing.T) {
+	model := "claude-sonnet-4-5"
+	custom := NewOptions()
+	custom.MaxTurns = 5
+	custom.Model = &model
+	custom.AllowedTools = []string{"Read", "Grep"}
+	custom.MaxSessionDuration = 30 * time.Minute
+	custom.ExtraEnv = map[string]string{"API_KEY": "sk-secret", "DEBUG": "1"}
+	custom.Clock = SystemClock()
+	custom.ToolApprovalCache = NewToolApprovalCache()
+	custom.AddDirs = nil // Nil and empty are equal
+	// Callbacks are never reported
+	custom.CanUseTool = func(context.Context, string, map[string]any, any) (any, error) { return nil, nil }
+	custom.Hooks = map[string][]func(){"PreToolUse": {func() {}}}
+	custom.MessageMiddleware = []MessageMiddleware{func(next MessageHandler) MessageHandler { return next }}
+	custom.OnThinking = func(*ThinkingBlock) {}
+
+	diff := NewOptions().Diff(custom)
+
+	expected := map[string]string{
+		"MaxTurns":           "0 -> 5",
+		"Model":              `<nil> -> "claude-sonnet-4-5"`,
+		"AllowedTools":       "[] -> [Read Grep]",
+		"MaxSessionDuration": "0s -> 30m0s",
+		"ExtraEnv":           "map[] -> map[API_KEY:[REDACTED] DEBUG:[REDACTED]]",
+		"ToolApprovalCache":  "<nil> -> *shared.ToolApprovalCache",
+	}
+	for field, want := range expected {
+		if got := diff[field]; got != want {
+			t.Errorf("Expected %s diff %q, got %q", field, want, got)
+		}
+	}
+	if got := diff["Clock"]; !strings.HasPrefix(got, "<nil> -> ") || strings.Contains(got, "{") {
+		t.Errorf("Expected Clock shown by type, got %q", got)
+	}
+	if len(diff) != len(expected)+1 {
+		t.Errorf("Expected only the changed fields, got %v", diff)
+	}
+
+	// Reversed, the values swap sides
+	if got := custom.Diff(NewOptions())["MaxTurns"]; got != "5 -> 0" {
+		t.Errorf("Expected reversed MaxTurns diff %q, got %q", "5 -> 0", got)
+	}
+	if diff := custom.Diff(custom); len(diff) != 0 {
+		t.Errorf("Expected no diff against itself, got %v", diff)
+	}
+	if diff := (*Options)(nil).Diff(&Options{}); len(diff) != 0 {
+		t.Errorf("Expected nil to equal zero Options, got %v", diff)
+	}
+	if !reflect.DeepEqual(NewOptions().Diff(NewOptions()), map[string]string{}) {
+		t.Error("Expected empty diff between defaults")
+	}
+}
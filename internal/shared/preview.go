@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxPreviewValueRunes caps each input value shown by the generic preview.
+const maxPreviewValueRunes = 40
+
+// PreviewToolUse renders a tool_use block as a one-line, human-readable
+// description of what the tool will do, such as "Read src/main.go" or
+// "Bash: rm -rf build". Read, Write, Edit, Bash, and Grep have dedicated
+// formats; other tools, or known tools missing their main input, render as
+// the tool name followed by their inputs. Returns an empty string for nil.
+func PreviewToolUse(block *ToolUseBlock) string {
+	if block == nil {
+		return ""
+	}
+
+	input := block.Input
+	switch block.Name {
+	case "Read", "Write", "Edit":
+		if path := previewString(input, "file_path"); path != "" {
+			return block.Name + " " + path
+		}
+	case "Bash":
+		if command := previewString(input, "command"); command != "" {
+			return "Bash: " + command
+		}
+	case "Grep":
+		if pattern, ok := input["pattern"].(string); ok && pattern != "" {
+			preview := "Grep " + strconv.Quote(pattern)
+			if path := previewString(input, "path"); path != "" {
+				preview += " in " + path
+			}
+			if glob := previewString(input, "glob"); glob != "" {
+				preview += " (" + glob + ")"
+			}
+			return preview
+		}
+	}
+	return previewGeneric(block.Name, input)
+}
+
+// previewGeneric renders name followed by its inputs as key=value pairs in
+// key order, with long values truncated.
+func previewGeneric(name string, input map[string]any) string {
+	if len(input) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(input))
+	for key := range input {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+previewValue(input[key]))
+	}
+	return name + "(" + strings.Join(pairs, ", ") + ")"
+}
+
+// previewValue renders a single input value on one line.
+func previewValue(value any) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strconv.Quote(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			text = fmt.Sprint(v)
+		} else {
+			text = string(data)
+		}
+	}
+
+	runes := []rune(text)
+	if len(runes) > maxPreviewValueRunes {
+		return string(runes[:maxPreviewValueRunes-1]) + "…"
+	}
+	return text
+}
+
+// previewString returns input[key] on one line, or empty if it is not a
+// string. Runs of spaces and tabs collapse to one space, line breaks show
+// as " ⏎ ", and other control characters, such as ANSI escapes, are
+// escaped so they cannot alter the terminal displaying the preview.
+func previewString(input map[string]any, key string) string {
+	value, _ := input[key].(string)
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, escapeControl(line))
+		}
+	}
+	return strings.Join(lines, " ⏎ ")
+}
+
+// escapeControl replaces each control character in s with a \x or \u escape.
+func escapeControl(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case !unicode.IsControl(r):
+			b.WriteRune(r)
+		case r < 0x100:
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+	return b.String()
+}
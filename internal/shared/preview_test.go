@@ -0,0 +1,103 @@
+package shared
+
+import "testing"
+
+// TestPreviewToolUse tests the preview of each known tool and the fallback
+func TestPreviewToolUse(t *testing.T) {
+	tests := []struct {
+		name  string
+		block *ToolUseBlock
+		want  string
+	}{
+		{
+			name:  "read",
+			block: &ToolUseBlock{Name: "Read", Input: map[string]any{"file_path": "src/main.go", "offset": 10.0}},
+			want:  "Read src/main.go",
+		},
+		{
+			name:  "write",
+			block: &ToolUseBlock{Name: "Write", Input: map[string]any{"file_path": "/tmp/out.txt", "content": "hello"}},
+			want:  "Write /tmp/out.txt",
+		},
+		{
+			name: "edit",
+			block: &ToolUseBlock{Name: "Edit", Input: map[string]any{
+				"file_path": "README.md", "old_string": "foo", "new_string": "bar",
+			}},
+			want: "Edit README.md",
+		},
+		{
+			name:  "bash",
+			block: &ToolUseBlock{Name: "Bash", Input: map[string]any{"command": "rm -rf build", "timeout": 5000.0}},
+			want:  "Bash: rm -rf build",
+		},
+		{
+			name:  "bash_multiline",
+			block: &ToolUseBlock{Name: "Bash", Input: map[string]any{"command": "cd build &&\n  make   test"}},
+			want:  "Bash: cd build && ⏎ make test",
+		},
+		{
+			name:  "bash_crlf_and_blank_lines",
+			block: &ToolUseBlock{Name: "Bash", Input: map[string]any{"command": "make\r\n\n\tmake install\n"}},
+			want:  "Bash: make ⏎ make install",
+		},
+		{
+			name:  "bash_escapes_control_characters",
+			block: &ToolUseBlock{Name: "Bash", Input: map[string]any{"command": "echo \x1b[31mred\x1b[0m\a"}},
+			want:  `Bash: echo \x1b[31mred\x1b[0m\x07`,
+		},
+		{
+			name:  "read_escapes_control_characters",
+			block: &ToolUseBlock{Name: "Read", Input: map[string]any{"file_path": "a\x00b.txt"}},
+			want:  `Read a\x00b.txt`,
+		},
+		{
+			name:  "grep",
+			block: &ToolUseBlock{Name: "Grep", Input: map[string]any{"pattern": "func main"}},
+			want:  `Grep "func main"`,
+		},
+		{
+			name: "grep_with_path_and_glob",
+			block: &ToolUseBlock{Name: "Grep", Input: map[string]any{
+				"pattern": `TODO\(`, "path": "internal", "glob": "*.go",
+			}},
+			want: `Grep "TODO\\(" in internal (*.go)`,
+		},
+		{
+			name: "fallback_unknown_tool",
+			block: &ToolUseBlock{Name: "mcp__docs__search", Input: map[string]any{
+				"query": "context cancellation", "limit": 5.0, "tags": []any{"go"},
+			}},
+			want: `mcp__docs__search(limit=5, query="context cancellation", tags=["go"])`,
+		},
+		{
+			name: "fallback_truncates_long_values",
+			block: &ToolUseBlock{Name: "WebFetch", Input: map[string]any{
+				"url": "https://example.com/a/very/long/path/that/keeps/going",
+			}},
+			want: `WebFetch(url="https://example.com/a/very/long/path/t…)`,
+		},
+		{
+			name:  "fallback_known_tool_missing_input",
+			block: &ToolUseBlock{Name: "Read", Input: map[string]any{"path": "main.go"}},
+			want:  `Read(path="main.go")`,
+		},
+		{
+			name:  "fallback_no_input",
+			block: &ToolUseBlock{Name: "TodoRead"},
+			want:  "TodoRead",
+		},
+		{
+			name: "nil_block",
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := PreviewToolUse(test.block); got != test.want {
+				t.Errorf("Expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
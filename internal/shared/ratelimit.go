@@ -0,0 +1,84 @@
+package shared
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket allowing events at a steady rate with
+// occasional bursts. It is safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	clock  Clock
+	rate   float64 // Tokens added per second
+	burst  float64 // Bucket capacity
+	tokens float64 // Negative while waiters hold reservations
+	last   time.Time
+}
+
+// NewRateLimiter creates a full bucket allowing rps events per second with
+// bursts of up to burst events. A burst below 1 is treated as 1. If clock is
+// nil, the system clock is used. It panics if rps is not positive.
+func NewRateLimiter(rps float64, burst int, clock Clock) *RateLimiter {
+	if rps <= 0 {
+		panic("claudecode: non-positive rate for NewRateLimiter")
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	clock = ClockOrSystem(clock)
+	return &RateLimiter{
+		clock:  clock,
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+// Wait blocks until an event is allowed, returning ctx's error if ctx ends
+// first. An event that gives up waiting does not count against the rate.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := l.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,134 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+)
+
+// RedactedPlaceholder replaces secrets matched by a Redactor.
+const RedactedPlaceholder = "[REDACTED]"
+
+// maxRedactLineSize bounds buffering of output without a newline.
+const maxRedactLineSize = 64 * 1024
+
+// redactionRule is a compiled pattern and its replacement template.
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// defaultRedactionRules match common secret-looking substrings.
+// Key/value rules keep the key so redacted output stays readable.
+var defaultRedactionRules = []redactionRule{
+	// Anthropic API keys and OAuth tokens
+	{regexp.MustCompile(`sk-ant-[A-Za-z0-9_\-]+`), RedactedPlaceholder},
+	// Bearer tokens in Authorization headers
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=\-]+`), "${1}" + RedactedPlaceholder},
+	// key=value or "key": "value" pairs for API keys, tokens, secrets, passwords
+	{
+		regexp.MustCompile(`(?i)((?:api[_-]?key|auth[_-]?token|access[_-]?token|secret|password|x-api-key)["']?\s*[:=]\s*["']?)[^\s"',}]+`),
+		"${1}" + RedactedPlaceholder,
+	},
+	// AWS access key IDs
+	{regexp.MustCompile(`AKIA[0-9A-Z]{16}`), RedactedPlaceholder},
+	// GitHub tokens
+	{regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`), RedactedPlaceholder},
+}
+
+// Redactor masks secret-looking substrings in text.
+type Redactor struct {
+	rules []redactionRule
+}
+
+// NewRedactor creates a Redactor using the default secret patterns plus any
+// additional regular expressions. Whole matches of additional patterns are
+// replaced with RedactedPlaceholder.
+func NewRedactor(patterns ...string) (*Redactor, error) {
+	rules := make([]redactionRule, len(defaultRedactionRules), len(defaultRedactionRules)+len(patterns))
+	copy(rules, defaultRedactionRules)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		rules = append(rules, redactionRule{pattern: re, replacement: RedactedPlaceholder})
+	}
+	return &Redactor{rules: rules}, nil
+}
+
+// Redact returns s with all matched secrets masked.
+func (r *Redactor) Redact(s string) string {
+	for _, rule := range r.rules {
+		s = rule.pattern.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// RedactingWriter redacts output line by line before writing it to an
+// underlying writer, so secrets split across writes are still matched.
+// Call Flush to write any trailing partial line. It is safe for concurrent use.
+type RedactingWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	redactor *Redactor
+	buf      []byte
+}
+
+// NewRedactingWriter wraps w so everything written is redacted.
+func NewRedactingWriter(w io.Writer, redactor *Redactor) *RedactingWriter {
+	return &RedactingWriter{w: w, redactor: redactor}
+}
+
+// Write buffers p and writes each complete line after redaction.
+// It reports len(p) written unless the underlying writer fails.
+func (rw *RedactingWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.buf = append(rw.buf, p...)
+	for {
+		idx := bytes.IndexByte(rw.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		if err := rw.writeRedacted(rw.buf[:idx+1]); err != nil {
+			return 0, err
+		}
+		rw.buf = rw.buf[idx+1:]
+	}
+
+	if len(rw.buf) > maxRedactLineSize {
+		if err := rw.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush redacts and writes any buffered partial line.
+func (rw *RedactingWriter) Flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.flushLocked()
+}
+
+// flushLocked writes the buffered partial line.
+// Must be called with mutex already held.
+func (rw *RedactingWriter) flushLocked() error {
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	err := rw.writeRedacted(rw.buf)
+	rw.buf = nil
+	return err
+}
+
+// writeRedacted redacts a chunk and writes it to the underlying writer.
+// Must be called with mutex already held.
+func (rw *RedactingWriter) writeRedacted(chunk []byte) error {
+	_, err := io.WriteString(rw.w, rw.redactor.Redact(string(chunk)))
+	return err
+}
@@ -0,0 +1,60 @@
+package shared
+
+// ResourceUpdate reports that an MCP resource changed during a session.
+// Re-read the resource to get its new contents. Experimental; see
+// SystemSubtypeResourceUpdated.
+type ResourceUpdate struct {
+	// Server is the name of the MCP server owning the resource, or empty if
+	// the CLI did not say.
+	Server string
+	// URI identifies the resource that changed.
+	URI string
+	// Title is the resource's human-readable title, if provided.
+	Title string
+	// SessionID is the session the update arrived in.
+	SessionID string
+	// Data holds the system message's raw fields, for anything else the
+	// CLI sends.
+	Data map[string]any
+}
+
+// ResourceUpdateFromSystemMessage returns the resource update carried by a
+// system message with subtype SystemSubtypeResourceUpdated, an experimental
+// format not documented by the CLI. The server name is read from "server" or "server_name",
+// and the update's fields may also be nested under "params" as in the MCP
+// notifications/resources/updated notification. The second result is false
+// if the message is not a resource update or names no resource URI.
+func ResourceUpdateFromSystemMessage(msg *SystemMessage) (ResourceUpdate, bool) {
+	if msg == nil || msg.Subtype != SystemSubtypeResourceUpdated {
+		return ResourceUpdate{}, false
+	}
+
+	fields := msg.Data
+	if params, ok := msg.Data["params"].(map[string]any); ok {
+		fields = params
+	}
+	update := ResourceUpdate{
+		Server:    firstString(msg.Data, "server", "server_name"),
+		URI:       firstString(fields, "uri"),
+		Title:     firstString(fields, "title"),
+		SessionID: firstString(msg.Data, "session_id"),
+		Data:      msg.Data,
+	}
+	if update.Server == "" {
+		update.Server = firstString(fields, "server", "server_name")
+	}
+	if update.URI == "" {
+		return ResourceUpdate{}, false
+	}
+	return update, true
+}
+
+// firstString returns the first non-empty string value among keys in data.
+func firstString(data map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := data[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
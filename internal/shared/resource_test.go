@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestResourceUpdateFromSystemMessage tests resource updates are read from system messages
+func TestResourceUpdateFromSystemMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    *SystemMessage
+		want   ResourceUpdate
+		wantOK bool
+	}{
+		{
+			name: "flat_fields",
+			msg: &SystemMessage{Subtype: SystemSubtypeResourceUpdated, Data: map[string]any{
+				"server": "docs", "uri": "file:///notes.md", "title": "Notes", "session_id": "s1",
+			}},
+			want:   ResourceUpdate{Server: "docs", URI: "file:///notes.md", Title: "Notes", SessionID: "s1"},
+			wantOK: true,
+		},
+		{
+			name: "mcp_notification_params",
+			msg: &SystemMessage{Subtype: SystemSubtypeResourceUpdated, Data: map[string]any{
+				"server_name": "db",
+				"params":      map[string]any{"uri": "db://tables/users"},
+			}},
+			want:   ResourceUpdate{Server: "db", URI: "db://tables/users"},
+			wantOK: true,
+		},
+		{
+			name: "missing_uri",
+			msg:  &SystemMessage{Subtype: SystemSubtypeResourceUpdated, Data: map[string]any{"server": "docs"}},
+		},
+		{
+			name: "other_subtype",
+			msg:  &SystemMessage{Subtype: SystemSubtypeInit, Data: map[string]any{"uri": "file:///notes.md"}},
+		},
+		{
+			name: "nil_message",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := ResourceUpdateFromSystemMessage(test.msg)
+			if ok != test.wantOK {
+				t.Fatalf("Expected ok=%v, got %v", test.wantOK, ok)
+			}
+			if ok {
+				test.want.Data = test.msg.Data
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package shared
+
+import "sync"
+
+// Response aggregates the content of one turn, from the first assistant
+// message after the previous result up to and including the turn's result.
+type Response struct {
+	// Text is the turn's text blocks joined with newlines.
+	Text string
+	// ToolUses are the turn's tool_use blocks in the order received.
+	ToolUses []*ToolUseBlock
+	// Thinking are the turn's thinking blocks in the order received.
+	Thinking []*ThinkingBlock
+	// Result is the ResultMessage that completed the turn.
+	Result *ResultMessage
+}
+
+// ResponseCollector aggregates received messages into a Response per turn.
+// Messages from subagents are included. The zero value is ready to use and
+// it is safe for concurrent use.
+type ResponseCollector struct {
+	mu      sync.Mutex
+	current *Response
+	last    *Response
+}
+
+// NewResponseCollector creates an empty response collector.
+func NewResponseCollector() *ResponseCollector {
+	return &ResponseCollector{}
+}
+
+// Record adds a received message to the current turn. A ResultMessage
+// completes the turn, making it available from Last.
+func (c *ResponseCollector) Record(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch v := msg.(type) {
+	case *AssistantMessage:
+		if c.current == nil {
+			c.current = &Response{}
+		}
+		for _, block := range v.Content {
+			switch b := block.(type) {
+			case *TextBlock:
+				if c.current.Text != "" {
+					c.current.Text += "\n"
+				}
+				c.current.Text += b.Text
+			case *ToolUseBlock:
+				c.current.ToolUses = append(c.current.ToolUses, b)
+			case *ThinkingBlock:
+				c.current.Thinking = append(c.current.Thinking, b)
+			}
+		}
+	case *ResultMessage:
+		response := c.current
+		if response == nil {
+			response = &Response{}
+		}
+		response.Result = v
+		c.last = response
+		c.current = nil
+	}
+}
+
+// Last returns the most recently completed turn's Response, or nil if no
+// turn has completed. The collector does not modify a Response once returned.
+func (c *ResponseCollector) Last() *Response {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Reset discards the completed and in-progress turns.
+func (c *ResponseCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current = nil
+	c.last = nil
+}
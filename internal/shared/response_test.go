@@ -0,0 +1,114 @@
+package shared
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestResponseCollector tests a multi-message turn is aggregated into one Response
+func TestResponseCollector(t *testing.T) {
+	t.Run("aggregates_turn", func(t *testing.T) {
+		collector := NewResponseCollector()
+		result := &ResultMessage{Subtype: "success", SessionID: "s1", NumTurns: 2}
+
+		collector.Record(&SystemMessage{Subtype: "init"})
+		collector.Record(&AssistantMessage{Content: []ContentBlock{
+			&ThinkingBlock{Thinking: "Check the config first"},
+			&TextBlock{Text: "Reading the config."},
+			&ToolUseBlock{ToolUseID: "toolu_1", Name: "Read"},
+		}})
+		if collector.Last() != nil {
+			t.Error("Expected no completed response before the result")
+		}
+		collector.Record(&UserMessage{Content: []ContentBlock{
+			&ToolResultBlock{ToolUseID: "toolu_1", Content: "port: 8080"},
+		}})
+		collector.Record(&AssistantMessage{Content: []ContentBlock{
+			&ThinkingBlock{Thinking: "The port is set"},
+			&ToolUseBlock{ToolUseID: "toolu_2", Name: "Bash"},
+			&TextBlock{Text: "The server listens on 8080."},
+		}})
+		collector.Record(result)
+
+		response := collector.Last()
+		if response == nil {
+			t.Fatal("Expected a completed response")
+		}
+		if response.Text != "Reading the config.\nThe server listens on 8080." {
+			t.Errorf("Unexpected text: %q", response.Text)
+		}
+		if len(response.ToolUses) != 2 || response.ToolUses[0].Name != "Read" || response.ToolUses[1].Name != "Bash" {
+			t.Errorf("Expected Read and Bash tool uses in order, got %+v", response.ToolUses)
+		}
+		if len(response.Thinking) != 2 || response.Thinking[1].Thinking != "The port is set" {
+			t.Errorf("Expected 2 thinking blocks in order, got %+v", response.Thinking)
+		}
+		if response.Result != result {
+			t.Errorf("Expected the turn's result, got %+v", response.Result)
+		}
+	})
+
+	t.Run("turns_are_separate", func(t *testing.T) {
+		collector := NewResponseCollector()
+		collector.Record(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "first"}}})
+		collector.Record(&ResultMessage{SessionID: "s1"})
+		first := collector.Last()
+
+		collector.Record(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "second"}}})
+		if collector.Last() != first {
+			t.Error("Expected the first response until the second turn completes")
+		}
+		collector.Record(&ResultMessage{SessionID: "s1"})
+
+		if first.Text != "first" {
+			t.Errorf("Expected the first response to be unchanged, got %q", first.Text)
+		}
+		if got := collector.Last().Text; got != "second" {
+			t.Errorf("Expected second turn text only, got %q", got)
+		}
+	})
+
+	t.Run("result_only_turn", func(t *testing.T) {
+		collector := NewResponseCollector()
+		collector.Record(&ResultMessage{Subtype: "error_max_turns", IsError: true})
+
+		response := collector.Last()
+		if response == nil || response.Result == nil || response.Text != "" || len(response.ToolUses) != 0 {
+			t.Errorf("Expected an empty response with the result, got %+v", response)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		collector := NewResponseCollector()
+		collector.Record(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "dropped"}}})
+		collector.Record(&ResultMessage{})
+		collector.Record(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "pending"}}})
+		collector.Reset()
+
+		if collector.Last() != nil {
+			t.Error("Expected no response after Reset")
+		}
+		collector.Record(&ResultMessage{})
+		if got := collector.Last().Text; got != "" {
+			t.Errorf("Expected pending text to be discarded, got %q", got)
+		}
+	})
+
+	t.Run("concurrent_use", func(t *testing.T) {
+		var collector ResponseCollector
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				collector.Record(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "x"}}})
+				_ = collector.Last()
+			}()
+		}
+		wg.Wait()
+		collector.Record(&ResultMessage{})
+		if got := len(collector.Last().Text); got != 19 {
+			t.Errorf("Expected 10 joined text blocks, got length %d", got)
+		}
+	})
+}
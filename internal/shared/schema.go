@@ -0,0 +1,530 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaMapKeywords hold maps of named subschemas rather than a single schema.
+var schemaMapKeywords = map[string]bool{
+	"properties":        true,
+	"patternProperties": true,
+	"$defs":             true,
+	"definitions":       true,
+}
+
+// schemaValueKeywords hold literal JSON values that must not be rewritten.
+var schemaValueKeywords = map[string]bool{
+	"enum":     true,
+	"const":    true,
+	"default":  true,
+	"examples": true,
+}
+
+// StrictJSONSchema returns a copy of schema with additionalProperties set to
+// false on every object-level schema, including nested properties, array
+// items, combinators, and definitions. Object schemas whose
+// additionalProperties is itself a schema (map types) keep it.
+//
+// allOf branches, and definitions they reference, are left open, since each
+// branch sees only its own properties. The schema holding the allOf is
+// closed as the merged object: the branches' property names are added to its
+// properties, unconstrained, so it accepts every field of every branch. If a
+// branch cannot be resolved, the holding schema is left open too.
+// The input schema is not modified.
+func StrictJSONSchema(schema map[string]any) map[string]any {
+	if schema == nil {
+		return nil
+	}
+	s := strictifier{root: schema, openRefs: make(map[string]bool)}
+	s.collectAllOfRefs(schema)
+	strict, _ := s.node(schema, false).(map[string]any)
+	return strict
+}
+
+// strictifier closes the object schemas of one root schema.
+type strictifier struct {
+	root     map[string]any
+	openRefs map[string]bool // $ref values used as allOf branches
+}
+
+// collectAllOfRefs records every local $ref used directly as an allOf branch.
+func (s *strictifier) collectAllOfRefs(node any) {
+	switch v := node.(type) {
+	case map[string]any:
+		for _, branch := range schemaList(v["allOf"]) {
+			if ref, ok := branch["$ref"].(string); ok {
+				s.openRefs[ref] = true
+			}
+		}
+		for key, value := range v {
+			if !schemaValueKeywords[key] {
+				s.collectAllOfRefs(value)
+			}
+		}
+	case []map[string]any:
+		for _, item := range v {
+			s.collectAllOfRefs(item)
+		}
+	case []any:
+		for _, item := range v {
+			s.collectAllOfRefs(item)
+		}
+	}
+}
+
+// node deep-copies a schema node, closing object schemas unless open is set.
+func (s *strictifier) node(node any, open bool) any {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v)+1)
+		for key, value := range v {
+			switch {
+			case schemaValueKeywords[key]:
+				out[key] = value
+			case schemaMapKeywords[key]:
+				named, ok := value.(map[string]any)
+				if !ok {
+					out[key] = value
+					continue
+				}
+				copied := make(map[string]any, len(named))
+				for name, sub := range named {
+					copied[name] = s.node(sub, s.isOpenDefinition(key, name))
+				}
+				out[key] = copied
+			case key == "allOf":
+				branches := schemaList(value)
+				copied := make([]any, len(branches))
+				for i, branch := range branches {
+					copied[i] = s.node(branch, true)
+				}
+				out[key] = copied
+			default:
+				out[key] = s.node(value, false)
+			}
+		}
+		if _, ok := v["allOf"]; ok && !s.mergeAllOf(out, v["allOf"]) {
+			open = true
+		}
+		if !open && isObjectSchema(out) {
+			if _, isSchema := out["additionalProperties"].(map[string]any); !isSchema {
+				out["additionalProperties"] = false
+			}
+		}
+		return out
+
+	case []map[string]any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = s.node(item, false)
+		}
+		return out
+
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = s.node(item, false)
+		}
+		return out
+	}
+	return node
+}
+
+// isOpenDefinition reports whether the definition name under keyword is
+// referenced as an allOf branch.
+func (s *strictifier) isOpenDefinition(keyword, name string) bool {
+	if keyword != "$defs" && keyword != "definitions" {
+		return false
+	}
+	return s.openRefs["#/"+keyword+"/"+name]
+}
+
+// mergeAllOf adds the property names of the allOf branches to out's
+// properties as unconstrained schemas. Returns false if a branch cannot be
+// resolved or combines further with anyOf or oneOf.
+func (s *strictifier) mergeAllOf(out map[string]any, allOf any) bool {
+	var names []string
+	if !s.allOfPropertyNames(allOf, &names, make(map[string]bool)) {
+		return false
+	}
+	if len(names) == 0 {
+		return true
+	}
+	properties, ok := out["properties"].(map[string]any)
+	if !ok {
+		if _, exists := out["properties"]; exists {
+			return false
+		}
+		properties = make(map[string]any, len(names))
+		out["properties"] = properties
+	}
+	for _, name := range names {
+		if _, exists := properties[name]; !exists {
+			properties[name] = map[string]any{}
+		}
+	}
+	return true
+}
+
+// allOfPropertyNames appends the property names declared by each allOf
+// branch, following local references and nested allOf. seen guards against
+// reference cycles.
+func (s *strictifier) allOfPropertyNames(allOf any, names *[]string, seen map[string]bool) bool {
+	for _, branch := range schemaList(allOf) {
+		if ref, ok := branch["$ref"].(string); ok {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+		}
+		resolved := resolveSchemaRef(s.root, branch)
+		if resolved == nil {
+			return false
+		}
+		if _, ok := resolved["anyOf"]; ok {
+			return false
+		}
+		if _, ok := resolved["oneOf"]; ok {
+			return false
+		}
+		properties, _ := resolved["properties"].(map[string]any)
+		for name := range properties {
+			*names = append(*names, name)
+		}
+		if !s.allOfPropertyNames(resolved["allOf"], names, seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// isObjectSchema reports whether a schema node describes a JSON object.
+func isObjectSchema(schema map[string]any) bool {
+	if _, ok := schema["properties"]; ok {
+		return true
+	}
+	switch t := schema["type"].(type) {
+	case string:
+		return t == "object"
+	case []any:
+		for _, item := range t {
+			if item == "object" {
+				return true
+			}
+		}
+	case []string:
+		for _, item := range t {
+			if item == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateStrictOutput checks structured output against a schema for fields
+// not allowed by additionalProperties: false. It returns a
+// *StructuredOutputError listing the paths of extra fields, or nil.
+// Only additional properties are checked; types and required fields are
+// left to the model's schema-constrained generation.
+func ValidateStrictOutput(schema map[string]any, output any) error {
+	if schema == nil || output == nil {
+		return nil
+	}
+	var extra []string
+	collectExtraFields(schema, schema, output, "", &extra)
+	if len(extra) == 0 {
+		return nil
+	}
+	sort.Strings(extra)
+	return NewStructuredOutputError(extra, output)
+}
+
+// collectExtraFields appends the path of every field in value that schema
+// does not allow.
+func collectExtraFields(root, schema map[string]any, value any, path string, extra *[]string) {
+	schema = resolveSchemaRef(root, schema)
+	if schema == nil {
+		return
+	}
+
+	// allOf: every branch applies
+	for _, branch := range schemaList(schema["allOf"]) {
+		collectExtraFields(root, branch, value, path, extra)
+	}
+
+	// anyOf/oneOf: valid if any branch accepts the value
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		branches := schemaList(schema[keyword])
+		if len(branches) == 0 {
+			continue
+		}
+		var best []string
+		for i, branch := range branches {
+			var branchExtra []string
+			collectExtraFields(root, branch, value, path, &branchExtra)
+			if i == 0 || len(branchExtra) < len(best) {
+				best = branchExtra
+			}
+		}
+		*extra = append(*extra, best...)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		patterns, _ := schema["patternProperties"].(map[string]any)
+		for key, fieldValue := range v {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			if sub, ok := properties[key].(map[string]any); ok {
+				collectExtraFields(root, sub, fieldValue, fieldPath, extra)
+				continue
+			}
+			if _, ok := properties[key]; ok {
+				continue
+			}
+			if matchesPatternProperty(patterns, key) {
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					*extra = append(*extra, fieldPath)
+				}
+			case map[string]any:
+				collectExtraFields(root, additional, fieldValue, fieldPath, extra)
+			}
+		}
+
+	case []any:
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return
+		}
+		for i, item := range v {
+			collectExtraFields(root, items, item, fmt.Sprintf("%s[%d]", path, i), extra)
+		}
+	}
+}
+
+// resolveSchemaRef follows a local "#/$defs/..." or "#/definitions/..." reference.
+func resolveSchemaRef(root, schema map[string]any) map[string]any {
+	ref, ok := schema["$ref"].(string)
+	if !ok {
+		return schema
+	}
+	var node any = root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil
+		}
+		node = m[part]
+	}
+	resolved, _ := node.(map[string]any)
+	return resolved
+}
+
+// schemaList returns the subschemas of a combinator keyword.
+func schemaList(value any) []map[string]any {
+	switch v := value.(type) {
+	case []map[string]any:
+		return v
+	case []any:
+		schemas := make([]map[string]any, 0, len(v))
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok {
+				schemas = append(schemas, m)
+			}
+		}
+		return schemas
+	}
+	return nil
+}
+
+// matchesPatternProperty reports whether key matches any patternProperties regex.
+func matchesPatternProperty(patterns map[string]any, key string) bool {
+	for pattern := range patterns {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// JSONSchemaFromType generates a JSON schema for the type of v by
+// reflection, following encoding/json field naming. Struct fields use their
+// json tag names, are required unless tagged omitempty, and skip "-".
+// Two extra struct tags are read: enum (comma-separated allowed values,
+// applied to the items of slice fields) and description. For example:
+//
+//	type TaskList struct {
+//	    Tasks    []string `json:"tasks" description:"Tasks found in the text"`
+//	    Priority string   `json:"priority" enum:"low,medium,high"`
+//	}
+//
+// time.Time maps to a date-time string, []byte to a string, maps to objects
+// with typed additionalProperties, and interfaces or types with custom JSON
+// marshaling to an unconstrained schema. Channel, function, and complex
+// fields are omitted. A nil v returns nil.
+func JSONSchemaFromType(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	return typeSchema(t, make(map[reflect.Type]bool))
+}
+
+// typeSchema returns the schema for t. visiting holds the structs being
+// generated, so recursive types end in an open object schema.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType, t.Implements(jsonMarshalerType), reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]any{"type": "string"} // base64, as encoding/json does
+		}
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]any{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := make(map[string]any)
+		var required []string
+		collectStructFields(t, visiting, properties, &required)
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	// Interfaces and any other kinds accept any value
+	return map[string]any{}
+}
+
+// collectStructFields adds the schema of each JSON-visible field of t to
+// properties, promoting fields of untagged embedded structs.
+func collectStructFields(t reflect.Type, visiting map[reflect.Type]bool, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, tagOptions, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			// An embedded struct already being generated, such as *Self,
+			// adds no fields
+			if !visiting[fieldType] {
+				visiting[fieldType] = true
+				collectStructFields(fieldType, visiting, properties, required)
+				delete(visiting, fieldType)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		switch fieldType.Kind() {
+		case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := typeSchema(field.Type, visiting)
+		if description := field.Tag.Get("description"); description != "" {
+			schema["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			// On a slice or array field the enum constrains its items
+			target, valueType := schema, fieldType
+			if items, ok := schema["items"].(map[string]any); ok {
+				target, valueType = items, fieldType.Elem()
+				for valueType.Kind() == reflect.Ptr {
+					valueType = valueType.Elem()
+				}
+			}
+			target["enum"] = enumValues(valueType, strings.Split(enum, ","))
+		}
+		properties[name] = schema
+		if !strings.Contains(","+tagOptions+",", ",omitempty,") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// enumValues converts enum tag values to the field's JSON type, keeping
+// values that do not parse as strings.
+func enumValues(t reflect.Type, values []string) []any {
+	out := make([]any, len(values))
+	for i, value := range values {
+		value = strings.TrimSpace(value)
+		out[i] = value
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				out[i] = n
+			}
+		case reflect.Float32, reflect.Float64:
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				out[i] = f
+			}
+		case reflect.Bool:
+			if b, err := strconv.ParseBool(value); err == nil {
+				out[i] = b
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,371 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestStrictJSONSchema tests additionalProperties: false is added at every object level
+func TestStrictJSONSchema(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"address": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+			"tags": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "object", "properties": map[string]any{"label": map[string]any{"type": "string"}}},
+			},
+			"labels": map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+			"contact": map[string]any{
+				"anyOf": []any{
+					map[string]any{"type": "object", "properties": map[string]any{"email": map[string]any{"type": "string"}}},
+					map[string]any{"type": "string"},
+				},
+			},
+			"default_obj": map[string]any{"type": "string", "default": map[string]any{"type": "object"}},
+		},
+		"$defs": map[string]any{
+			"point": map[string]any{"type": "object", "properties": map[string]any{"x": map[string]any{"type": "number"}}},
+		},
+		"additionalProperties": true,
+	}
+
+	strict := StrictJSONSchema(schema)
+	props := strict["properties"].(map[string]any)
+
+	checks := []struct {
+		name string
+		node map[string]any
+		want any
+	}{
+		{"root_overrides_true", strict, false},
+		{"nested_object", props["address"].(map[string]any), false},
+		{"array_items", props["tags"].(map[string]any)["items"].(map[string]any), false},
+		{"any_of_branch", props["contact"].(map[string]any)["anyOf"].([]any)[0].(map[string]any), false},
+		{"defs", strict["$defs"].(map[string]any)["point"].(map[string]any), false},
+		{"map_type_kept", props["labels"].(map[string]any), map[string]any{"type": "string"}},
+	}
+	for _, check := range checks {
+		if got := check.node["additionalProperties"]; !reflect.DeepEqual(got, check.want) {
+			t.Errorf("%s: expected additionalProperties %v, got %v", check.name, check.want, got)
+		}
+	}
+
+	if _, ok := props["name"].(map[string]any)["additionalProperties"]; ok {
+		t.Error("Expected non-object schema to be left without additionalProperties")
+	}
+	if _, ok := props["default_obj"].(map[string]any)["default"].(map[string]any)["additionalProperties"]; ok {
+		t.Error("Expected literal default value to be left unchanged")
+	}
+	if schema["additionalProperties"] != true {
+		t.Error("Expected input schema to be left unmodified")
+	}
+	if StrictJSONSchema(nil) != nil {
+		t.Error("Expected nil schema to stay nil")
+	}
+}
+
+// TestStrictJSONSchemaAllOf tests allOf branches stay open and the merged object is closed
+func TestStrictJSONSchemaAllOf(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"allOf": []any{
+			map[string]any{"$ref": "#/$defs/base"},
+			map[string]any{
+				"properties": map[string]any{
+					"name":  map[string]any{"type": "string"},
+					"owner": map[string]any{"type": "object", "properties": map[string]any{"id": map[string]any{"type": "string"}}},
+				},
+			},
+		},
+		"$defs": map[string]any{
+			"base":  map[string]any{"type": "object", "properties": map[string]any{"id": map[string]any{"type": "integer"}}},
+			"other": map[string]any{"type": "object", "properties": map[string]any{"x": map[string]any{"type": "number"}}},
+		},
+	}
+
+	strict := StrictJSONSchema(schema)
+	branches := strict["allOf"].([]any)
+	defs := strict["$defs"].(map[string]any)
+
+	if _, ok := branches[1].(map[string]any)["additionalProperties"]; ok {
+		t.Error("Expected allOf branch to be left open")
+	}
+	if _, ok := defs["base"].(map[string]any)["additionalProperties"]; ok {
+		t.Error("Expected definition referenced from allOf to be left open")
+	}
+	if got := defs["other"].(map[string]any)["additionalProperties"]; got != false {
+		t.Errorf("Expected other definitions to be closed, got %v", got)
+	}
+	owner := branches[1].(map[string]any)["properties"].(map[string]any)["owner"].(map[string]any)
+	if got := owner["additionalProperties"]; got != false {
+		t.Errorf("Expected objects nested in a branch to be closed, got %v", got)
+	}
+	if got := strict["additionalProperties"]; got != false {
+		t.Errorf("Expected merged object to be closed, got %v", got)
+	}
+
+	if err := ValidateStrictOutput(strict, map[string]any{"id": 1.0, "name": "a", "owner": map[string]any{"id": "u"}}); err != nil {
+		t.Errorf("Expected fields from every branch to be allowed, got %v", err)
+	}
+	err := ValidateStrictOutput(strict, map[string]any{"id": 1.0, "extra": true, "owner": map[string]any{"id": "u", "role": "x"}})
+	var outputErr *StructuredOutputError
+	if !errors.As(err, &outputErr) || !reflect.DeepEqual(outputErr.Fields, []string{"extra", "owner.role"}) {
+		t.Errorf("Expected extra and owner.role to be rejected, got %v", err)
+	}
+
+	t.Run("unresolved_branch_leaves_holder_open", func(t *testing.T) {
+		strict := StrictJSONSchema(map[string]any{
+			"type":  "object",
+			"allOf": []any{map[string]any{"$ref": "https://example.com/schema.json"}},
+		})
+		if _, ok := strict["additionalProperties"]; ok {
+			t.Error("Expected schema with an unresolved allOf branch to be left open")
+		}
+	})
+}
+
+// TestValidateStrictOutput tests extra fields are rejected at every object level
+func TestValidateStrictOutput(t *testing.T) {
+	schema := StrictJSONSchema(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"address": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			},
+			"tags": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "object", "properties": map[string]any{"label": map[string]any{"type": "string"}}},
+			},
+			"point":  map[string]any{"$ref": "#/$defs/point"},
+			"labels": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		},
+		"$defs": map[string]any{
+			"point": map[string]any{"type": "object", "properties": map[string]any{"x": map[string]any{"type": "number"}}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		output     any
+		wantFields []string
+	}{
+		{
+			name:   "valid_output",
+			output: map[string]any{"name": "Ada", "address": map[string]any{"city": "London"}, "labels": map[string]any{"any": "key"}},
+		},
+		{
+			name:       "extra_root_field",
+			output:     map[string]any{"name": "Ada", "age": float64(36)},
+			wantFields: []string{"age"},
+		},
+		{
+			name: "extra_nested_fields",
+			output: map[string]any{
+				"address": map[string]any{"city": "London", "zip": "N1"},
+				"tags":    []any{map[string]any{"label": "a"}, map[string]any{"label": "b", "color": "red"}},
+				"point":   map[string]any{"x": float64(1), "y": float64(2)},
+			},
+			wantFields: []string{"address.zip", "point.y", "tags[1].color"},
+		},
+		{
+			name:   "nil_output",
+			output: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateStrictOutput(schema, test.output)
+			if test.wantFields == nil {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			outputErr := AsStructuredOutputError(err)
+			if outputErr == nil {
+				t.Fatalf("Expected StructuredOutputError, got %v", err)
+			}
+			if !reflect.DeepEqual(outputErr.Fields, test.wantFields) {
+				t.Errorf("Expected fields %v, got %v", test.wantFields, outputErr.Fields)
+			}
+			if outputErr.Type() != "structured_output_error" {
+				t.Errorf("Expected type structured_output_error, got %q", outputErr.Type())
+			}
+		})
+	}
+
+	t.Run("any_of_accepts_matching_branch", func(t *testing.T) {
+		anyOf := StrictJSONSchema(map[string]any{
+			"anyOf": []any{
+				map[string]any{"type": "object", "properties": map[string]any{"a": map[string]any{}}},
+				map[string]any{"type": "object", "properties": map[string]any{"b": map[string]any{}}},
+			},
+		})
+		if err := ValidateStrictOutput(anyOf, map[string]any{"b": 1}); err != nil {
+			t.Errorf("Expected second branch to accept output, got %v", err)
+		}
+		if err := ValidateStrictOutput(anyOf, map[string]any{"c": 1}); !IsStructuredOutputError(err) {
+			t.Errorf("Expected StructuredOutputError, got %v", err)
+		}
+	})
+}
+
+// TestJSONSchemaFromType tests schemas generated from Go structs
+func TestJSONSchemaFromType(t *testing.T) {
+	type TaskList struct {
+		Tasks    []string `json:"tasks" description:"List of tasks extracted from the text"`
+		Priority string   `json:"priority" enum:"low,medium,high" description:"Overall priority level of the tasks"`
+	}
+	type Contact struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Phone string `json:"phone,omitempty"`
+	}
+
+	t.Run("task_list", func(t *testing.T) {
+		expected := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"tasks": map[string]any{
+					"type":        "array",
+					"items":       map[string]any{"type": "string"},
+					"description": "List of tasks extracted from the text",
+				},
+				"priority": map[string]any{
+					"type":        "string",
+					"enum":        []any{"low", "medium", "high"},
+					"description": "Overall priority level of the tasks",
+				},
+			},
+			"required": []string{"tasks", "priority"},
+		}
+		if got := JSONSchemaFromType(TaskList{}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected schema %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("contact_omitempty_not_required", func(t *testing.T) {
+		expected := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name":  map[string]any{"type": "string"},
+				"email": map[string]any{"type": "string"},
+				"phone": map[string]any{"type": "string"},
+			},
+			"required": []string{"name", "email"},
+		}
+		if got := JSONSchemaFromType(&Contact{}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected schema %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("types_and_nesting", func(t *testing.T) {
+		type Base struct {
+			ID int64 `json:"id"`
+		}
+		type Node struct {
+			Base
+			Score    float64         `json:"score"`
+			Done     bool            `json:"done"`
+			Level    int             `json:"level" enum:"1,2,3"`
+			Labels   []string        `json:"labels,omitempty" enum:"bug,feature"`
+			Owner    *Contact        `json:"owner,omitempty"`
+			Meta     map[string]int  `json:"meta,omitempty"`
+			Extra    any             `json:"extra,omitempty"`
+			Created  time.Time       `json:"created"`
+			Raw      json.RawMessage `json:"raw,omitempty"`
+			Data     []byte          `json:"data,omitempty"`
+			Children []*Node         `json:"children,omitempty"`
+			Untagged string
+			Skipped  string            `json:"-"`
+			Callback func()            `json:"callback,omitempty"`
+			private  string            //nolint:unused // unexported fields are ignored
+			Lookup   map[string]string `json:"lookup,omitempty"`
+		}
+
+		schema := JSONSchemaFromType(Node{})
+		properties := schema["properties"].(map[string]any)
+
+		checks := map[string]map[string]any{
+			"id":      {"type": "integer"},
+			"score":   {"type": "number"},
+			"done":    {"type": "boolean"},
+			"level":   {"type": "integer", "enum": []any{int64(1), int64(2), int64(3)}},
+			"labels":  {"type": "array", "items": map[string]any{"type": "string", "enum": []any{"bug", "feature"}}},
+			"meta":    {"type": "object", "additionalProperties": map[string]any{"type": "integer"}},
+			"extra":   {},
+			"created": {"type": "string", "format": "date-time"},
+			"raw":     {},
+			"data":    {"type": "string"},
+			"lookup":  {"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		}
+		for name, want := range checks {
+			if got := properties[name]; !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected %s schema %v, got %v", name, want, got)
+			}
+		}
+
+		owner, _ := properties["owner"].(map[string]any)
+		if owner["type"] != "object" || owner["properties"].(map[string]any)["email"] == nil {
+			t.Errorf("Expected nested owner object schema, got %v", owner)
+		}
+		children, _ := properties["children"].(map[string]any)
+		if got := children["items"]; !reflect.DeepEqual(got, map[string]any{"type": "object"}) {
+			t.Errorf("Expected recursive type to end in an open object, got %v", got)
+		}
+		if _, ok := properties["Untagged"]; !ok {
+			t.Error("Expected untagged field to use its Go name")
+		}
+		for _, name := range []string{"Skipped", "-", "callback", "private", "Base"} {
+			if _, ok := properties[name]; ok {
+				t.Errorf("Expected no %q property", name)
+			}
+		}
+
+		expectedRequired := []string{"id", "score", "done", "level", "created", "Untagged"}
+		if got := schema["required"]; !reflect.DeepEqual(got, expectedRequired) {
+			t.Errorf("Expected required %v, got %v", expectedRequired, got)
+		}
+	})
+
+	t.Run("embedded_self_pointer", func(t *testing.T) {
+		type Tree struct {
+			*Tree
+			Name string `json:"name"`
+		}
+		expected := map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"name": map[string]any{"type": "string"}},
+			"required":   []string{"name"},
+		}
+		if got := JSONSchemaFromType(Tree{}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected schema %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("non_struct_and_nil", func(t *testing.T) {
+		if got := JSONSchemaFromType([]int{}); !reflect.DeepEqual(got, map[string]any{"type": "array", "items": map[string]any{"type": "integer"}}) {
+			t.Errorf("Expected integer array schema, got %v", got)
+		}
+		if got := JSONSchemaFromType(reflect.TypeOf("")); !reflect.DeepEqual(got, map[string]any{"type": "string"}) {
+			t.Errorf("Expected string schema from reflect.Type, got %v", got)
+		}
+		if JSONSchemaFromType(nil) != nil {
+			t.Error("Expected nil for nil value")
+		}
+	})
+}
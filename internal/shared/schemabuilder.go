@@ -0,0 +1,147 @@
+package shared
+
+// SchemaBuilder builds a JSON schema fluently, as an alternative to writing
+// nested map[string]any literals. Start from SchemaObject, SchemaString,
+// SchemaInteger, SchemaNumber, SchemaBoolean, or SchemaArray, chain keyword
+// methods, and call Build. Methods modify and return the builder, so a
+// builder should not be shared between schemas.
+//
+// Example:
+//
+//	schema := SchemaObject().
+//	    Property("name", SchemaString().Desc("Full name of the person")).
+//	    Property("email", SchemaString().Desc("Email address")).
+//	    Required("name", "email").
+//	    Build()
+type SchemaBuilder struct {
+	keywords   map[string]any
+	properties map[string]*SchemaBuilder
+	required   []string
+	items      *SchemaBuilder
+}
+
+// newSchemaBuilder creates a builder for a schema of the given JSON type.
+func newSchemaBuilder(schemaType string) *SchemaBuilder {
+	return &SchemaBuilder{keywords: map[string]any{"type": schemaType}}
+}
+
+// SchemaObject starts an object schema. Add fields with Property and Required.
+func SchemaObject() *SchemaBuilder {
+	return newSchemaBuilder("object")
+}
+
+// SchemaString starts a string schema.
+func SchemaString() *SchemaBuilder {
+	return newSchemaBuilder("string")
+}
+
+// SchemaInteger starts an integer schema.
+func SchemaInteger() *SchemaBuilder {
+	return newSchemaBuilder("integer")
+}
+
+// SchemaNumber starts a number schema.
+func SchemaNumber() *SchemaBuilder {
+	return newSchemaBuilder("number")
+}
+
+// SchemaBoolean starts a boolean schema.
+func SchemaBoolean() *SchemaBuilder {
+	return newSchemaBuilder("boolean")
+}
+
+// SchemaArray starts an array schema whose items match items. A nil items
+// allows any items.
+func SchemaArray(items *SchemaBuilder) *SchemaBuilder {
+	b := newSchemaBuilder("array")
+	b.items = items
+	return b
+}
+
+// Desc sets the schema's description.
+func (b *SchemaBuilder) Desc(description string) *SchemaBuilder {
+	return b.Set("description", description)
+}
+
+// Enum restricts the schema to the given values.
+func (b *SchemaBuilder) Enum(values ...any) *SchemaBuilder {
+	return b.Set("enum", append([]any(nil), values...))
+}
+
+// Format sets the schema's format, e.g. "date-time" or "email".
+func (b *SchemaBuilder) Format(format string) *SchemaBuilder {
+	return b.Set("format", format)
+}
+
+// Property adds a named property to an object schema, replacing any earlier
+// property of the same name. A nil schema allows any value.
+func (b *SchemaBuilder) Property(name string, schema *SchemaBuilder) *SchemaBuilder {
+	if b.properties == nil {
+		b.properties = make(map[string]*SchemaBuilder)
+	}
+	b.properties[name] = schema
+	return b
+}
+
+// Required marks properties of an object schema as required, in order.
+// Names already required are not repeated.
+func (b *SchemaBuilder) Required(names ...string) *SchemaBuilder {
+	for _, name := range names {
+		if !containsString(b.required, name) {
+			b.required = append(b.required, name)
+		}
+	}
+	return b
+}
+
+// AdditionalProperties sets whether an object schema allows properties not
+// listed with Property.
+func (b *SchemaBuilder) AdditionalProperties(allowed bool) *SchemaBuilder {
+	return b.Set("additionalProperties", allowed)
+}
+
+// Set sets any other schema keyword, such as "minimum" or "maxItems".
+func (b *SchemaBuilder) Set(keyword string, value any) *SchemaBuilder {
+	if b.keywords == nil {
+		b.keywords = make(map[string]any)
+	}
+	b.keywords[keyword] = value
+	return b
+}
+
+// Build returns the schema as the map[string]any expected by WithJSONSchema.
+// Each call returns a new map, so later changes to the builder do not affect
+// schemas already built. A nil builder builds an unconstrained schema.
+func (b *SchemaBuilder) Build() map[string]any {
+	if b == nil {
+		return map[string]any{}
+	}
+	schema := make(map[string]any, len(b.keywords)+3)
+	for keyword, value := range b.keywords {
+		schema[keyword] = value
+	}
+	if len(b.properties) > 0 {
+		properties := make(map[string]any, len(b.properties))
+		for name, property := range b.properties {
+			properties[name] = property.Build()
+		}
+		schema["properties"] = properties
+	}
+	if len(b.required) > 0 {
+		schema["required"] = append([]string(nil), b.required...)
+	}
+	if b.items != nil {
+		schema["items"] = b.items.Build()
+	}
+	return schema
+}
+
+// containsString reports whether values contains value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSchemaBuilder tests schemas built fluently against hand-written ones
+func TestSchemaBuilder(t *testing.T) {
+	t.Run("task_list", func(t *testing.T) {
+		expected := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"tasks": map[string]any{
+					"type":        "array",
+					"items":       map[string]any{"type": "string"},
+					"description": "List of tasks extracted from the text",
+				},
+				"priority": map[string]any{
+					"type":        "string",
+					"enum":        []any{"low", "medium", "high"},
+					"description": "Overall priority level of the tasks",
+				},
+			},
+			"required": []string{"tasks", "priority"},
+		}
+		got := SchemaObject().
+			Property("tasks", SchemaArray(SchemaString()).Desc("List of tasks extracted from the text")).
+			Property("priority", SchemaString().Enum("low", "medium", "high").Desc("Overall priority level of the tasks")).
+			Required("tasks", "priority").
+			Build()
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected schema %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("contact", func(t *testing.T) {
+		expected := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name": map[string]any{
+					"type":        "string",
+					"description": "Full name of the person",
+				},
+				"email": map[string]any{
+					"type":        "string",
+					"description": "Email address",
+				},
+				"phone": map[string]any{
+					"type":        "string",
+					"description": "Phone number if available",
+				},
+			},
+			"required": []string{"name", "email"},
+		}
+		got := SchemaObject().
+			Property("name", SchemaString().Desc("Full name of the person")).
+			Property("email", SchemaString().Desc("Email address")).
+			Property("phone", SchemaString().Desc("Phone number if available")).
+			Required("name", "email").
+			Build()
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected schema %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("keywords_and_nesting", func(t *testing.T) {
+		expected := map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"score":   map[string]any{"type": "number", "minimum": 0},
+				"count":   map[string]any{"type": "integer"},
+				"done":    map[string]any{"type": "boolean"},
+				"due":     map[string]any{"type": "string", "format": "date-time"},
+				"extra":   map[string]any{},
+				"anyList": map[string]any{"type": "array"},
+				"owner": map[string]any{
+					"type":                 "object",
+					"properties":           map[string]any{"id": map[string]any{"type": "integer"}},
+					"required":             []string{"id"},
+					"additionalProperties": false,
+				},
+			},
+			"required": []string{"score", "owner"},
+		}
+		got := SchemaObject().
+			Property("score", SchemaNumber().Set("minimum", 0)).
+			Property("count", SchemaInteger()).
+			Property("done", SchemaBoolean()).
+			Property("due", SchemaString().Format("date-time")).
+			Property("extra", nil).
+			Property("anyList", SchemaArray(nil)).
+			Property("owner", SchemaObject().Property("id", SchemaInteger()).Required("id").AdditionalProperties(false)).
+			Required("score", "owner", "score").
+			Build()
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected schema %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("build_returns_independent_maps", func(t *testing.T) {
+		builder := SchemaObject().Property("name", SchemaString()).Required("name")
+		first := builder.Build()
+		builder.Property("email", SchemaString()).Required("email")
+		if got := len(first["properties"].(map[string]any)); got != 1 {
+			t.Errorf("Expected earlier schema to keep 1 property, got %d", got)
+		}
+		if got := first["required"]; !reflect.DeepEqual(got, []string{"name"}) {
+			t.Errorf("Expected earlier schema to keep required [name], got %v", got)
+		}
+		if got := SchemaObject().Build(); !reflect.DeepEqual(got, map[string]any{"type": "object"}) {
+			t.Errorf("Expected bare object schema, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package shared
+
+import "context"
+
+// SessionStore persists CLI session IDs under application-chosen keys, so a
+// Client can resume its conversation after reconnecting, even from another
+// process. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Save stores sessionID under key, replacing any previous value.
+	Save(ctx context.Context, key, sessionID string) error
+	// Load returns the session ID stored under key. found is false, with a
+	// nil error, when nothing is stored.
+	Load(ctx context.Context, key string) (sessionID string, found bool, err error)
+	// Delete removes the session ID stored under key. Deleting a missing key
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
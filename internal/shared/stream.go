@@ -8,9 +8,50 @@ type StreamMessage struct {
 	Message         interface{}            `json:"message,omitempty"`
 	ParentToolUseID *string                `json:"parent_tool_use_id,omitempty"`
 	SessionID       string                 `json:"session_id,omitempty"`
+	UUID            string                 `json:"uuid,omitempty"`
 	RequestID       string                 `json:"request_id,omitempty"`
 	Request         map[string]interface{} `json:"request,omitempty"`
 	Response        map[string]interface{} `json:"response,omitempty"`
+	QueryID         string                 `json:"-"` // Attached to messages of the turn; not serialized
+}
+
+// StartsTurn reports whether m starts a turn of its own, answered by a
+// ResultMessage. Replies to a tool use, sent with a parent tool use ID or
+// with only tool result content, continue the turn that is waiting for them.
+func (m StreamMessage) StartsTurn() bool {
+	if m.ParentToolUseID != nil {
+		return false
+	}
+	body, ok := m.Message.(map[string]interface{})
+	if !ok {
+		return true
+	}
+	var types []interface{}
+	switch content := body["content"].(type) {
+	case []map[string]interface{}:
+		for _, block := range content {
+			types = append(types, block["type"])
+		}
+	case []interface{}:
+		for _, block := range content {
+			fields, ok := block.(map[string]interface{})
+			if !ok {
+				return true
+			}
+			types = append(types, fields["type"])
+		}
+	default:
+		return true
+	}
+	if len(types) == 0 {
+		return true
+	}
+	for _, blockType := range types {
+		if blockType != ContentBlockTypeToolResult {
+			return true
+		}
+	}
+	return false
 }
 
 // MessageIterator provides an iterator pattern for streaming messages.
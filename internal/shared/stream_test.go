@@ -55,6 +55,39 @@ func TestStreamMessageJSON(t *testing.T) {
 	}
 }
 
+// TestStreamMessageStartsTurn tests prompts start turns and tool use replies do not
+func TestStreamMessageStartsTurn(t *testing.T) {
+	parent := "toolu_1"
+	user := func(content interface{}) StreamMessage {
+		return StreamMessage{Type: "user", Message: map[string]interface{}{"role": "user", "content": content}}
+	}
+	tests := []struct {
+		name string
+		msg  StreamMessage
+		want bool
+	}{
+		{"text_prompt", user("What is 2+2?"), true},
+		{"no_body", StreamMessage{Type: "user"}, true},
+		{"text_block", user([]map[string]interface{}{{"type": "text", "text": "hi"}}), true},
+		{"tool_results", user([]map[string]interface{}{{"type": "tool_result", "tool_use_id": parent}}), false},
+		{"decoded_tool_results", user([]interface{}{map[string]interface{}{"type": "tool_result"}}), false},
+		{"tool_result_and_text", user([]interface{}{
+			map[string]interface{}{"type": "tool_result"},
+			map[string]interface{}{"type": "text"},
+		}), true},
+		{"empty_blocks", user([]interface{}{}), true},
+		{"parent_tool_use", StreamMessage{Type: "user", Message: map[string]interface{}{"content": "ok"}, ParentToolUseID: &parent}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.msg.StartsTurn(); got != test.want {
+				t.Errorf("Expected StartsTurn()=%v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
 // TestMessageIteratorInterface tests MessageIterator interface compliance
 func TestMessageIteratorInterface(t *testing.T) {
 	// Create a simple mock implementation to verify interface compliance
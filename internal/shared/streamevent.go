@@ -0,0 +1,112 @@
+package shared
+
+// ParsedStreamEvent is a StreamEvent with the fields of its common event
+// shapes decoded. Fields that do not apply to the event type are zero.
+type ParsedStreamEvent struct {
+	// Type is the event type, one of the StreamEventType constants.
+	Type string
+	// Index is the content block index of content_block_start,
+	// content_block_delta, and content_block_stop events.
+	Index int
+	// ContentBlock is the raw block started by a content_block_start event.
+	ContentBlock map[string]any
+	// Delta is the decoded delta of a content_block_delta event.
+	Delta *StreamDelta
+	// Message describes the message begun by a message_start event.
+	Message *StreamMessageStart
+	// StopReason is why the message ended, from a message_delta event.
+	StopReason string
+	// Usage holds the token counts of message_start and message_delta events.
+	Usage *Usage
+	// Raw is the event as received.
+	Raw *StreamEvent
+}
+
+// StreamDelta is the delta of a content_block_delta event. Only the field
+// matching Type is set.
+type StreamDelta struct {
+	// Type is the delta type, one of the StreamDeltaType constants.
+	Type string
+	// Text is the partial text of a text_delta.
+	Text string
+	// PartialJSON is the partial tool input JSON of an input_json_delta.
+	PartialJSON string
+	// Thinking is the partial thinking of a thinking_delta.
+	Thinking string
+	// Signature is the thinking signature of a signature_delta.
+	Signature string
+}
+
+// StreamMessageStart describes the message begun by a message_start event.
+type StreamMessageStart struct {
+	ID    string
+	Model string
+	Role  string
+}
+
+// ParseStreamEvent decodes the common fields of a stream event. Unknown event
+// types are returned with only Type and Raw set. Returns a zero value for nil.
+func ParseStreamEvent(event *StreamEvent) ParsedStreamEvent {
+	if event == nil {
+		return ParsedStreamEvent{}
+	}
+
+	data := event.Event
+	parsed := ParsedStreamEvent{Raw: event}
+	parsed.Type, _ = data["type"].(string)
+
+	switch parsed.Type {
+	case StreamEventTypeContentBlockStart:
+		parsed.Index = eventIndex(data)
+		parsed.ContentBlock, _ = data["content_block"].(map[string]any)
+
+	case StreamEventTypeContentBlockDelta:
+		parsed.Index = eventIndex(data)
+		if delta, ok := data["delta"].(map[string]any); ok {
+			parsed.Delta = parseStreamDelta(delta)
+		}
+
+	case StreamEventTypeContentBlockStop:
+		parsed.Index = eventIndex(data)
+
+	case StreamEventTypeMessageStart:
+		message, _ := data["message"].(map[string]any)
+		start := &StreamMessageStart{}
+		start.ID, _ = message["id"].(string)
+		start.Model, _ = message["model"].(string)
+		start.Role, _ = message["role"].(string)
+		parsed.Message = start
+		if usage, ok := message["usage"].(map[string]any); ok {
+			u := UsageFromMap(usage)
+			parsed.Usage = &u
+		}
+
+	case StreamEventTypeMessageDelta:
+		if delta, ok := data["delta"].(map[string]any); ok {
+			parsed.StopReason, _ = delta["stop_reason"].(string)
+		}
+		if usage, ok := data["usage"].(map[string]any); ok {
+			u := UsageFromMap(usage)
+			parsed.Usage = &u
+		}
+	}
+
+	return parsed
+}
+
+// parseStreamDelta decodes a content_block_delta's delta object.
+func parseStreamDelta(delta map[string]any) *StreamDelta {
+	parsed := &StreamDelta{}
+	parsed.Type, _ = delta["type"].(string)
+	switch parsed.Type {
+	case StreamDeltaTypeText:
+		parsed.Text, _ = delta["text"].(string)
+	case StreamDeltaTypeInputJSON:
+		parsed.PartialJSON, _ = delta["partial_json"].(string)
+	case StreamDeltaTypeThinking:
+		parsed.Thinking, _ = delta["thinking"].(string)
+	case StreamDeltaTypeSignature:
+		parsed.Signature, _ = delta["signature"].(string)
+	}
+	return parsed
+}
@@ -0,0 +1,152 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// ToolStat holds aggregated usage of a single tool.
+// Durations are measured from when the SDK receives the tool_use block to
+// when it receives the matching result, and cover completed calls only.
+type ToolStat struct {
+	Invocations   int
+	Successes     int
+	Errors        int
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+}
+
+// Completed returns the number of calls that have produced a result.
+func (s ToolStat) Completed() int {
+	return s.Successes + s.Errors
+}
+
+// AverageDuration returns the mean duration of completed calls, or zero.
+func (s ToolStat) AverageDuration() time.Duration {
+	if s.Completed() == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Completed())
+}
+
+// pendingToolCall is a tool_use awaiting its result.
+type pendingToolCall struct {
+	name    string
+	started time.Time
+}
+
+// ToolMetrics aggregates invocations, outcomes, and durations per tool name
+// by correlating tool_use blocks with their results. Server-side tools such
+// as web search are included. The zero value is ready to use and it is safe
+// for concurrent use.
+type ToolMetrics struct {
+	mu      sync.Mutex
+	stats   map[string]*ToolStat
+	pending map[string]pendingToolCall
+	now     func() time.Time // For tests; nil means time.Now
+}
+
+// NewToolMetrics creates an empty tool metrics collector.
+func NewToolMetrics() *ToolMetrics {
+	return &ToolMetrics{}
+}
+
+// Record updates the metrics from a received message. Tool use blocks in
+// assistant messages start a call; tool result blocks complete it.
+// Results without a known tool_use are ignored.
+func (m *ToolMetrics) Record(msg Message) {
+	var blocks []ContentBlock
+	switch v := msg.(type) {
+	case *AssistantMessage:
+		blocks = v.Content
+	case *UserMessage:
+		blocks, _ = v.Content.([]ContentBlock)
+	}
+	if len(blocks) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now
+	if m.now != nil {
+		now = m.now
+	}
+	at := now()
+
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *ToolUseBlock:
+			m.start(b.ToolUseID, b.Name, at)
+		case *ServerToolUseBlock:
+			m.start(b.ToolUseID, b.Name, at)
+		case *ToolResultBlock:
+			m.complete(b.ToolUseID, b.IsError != nil && *b.IsError, at)
+		case *WebSearchResultBlock:
+			m.complete(b.ToolUseID, b.ErrorCode != "", at)
+		case *ServerToolResultBlock:
+			m.complete(b.ToolUseID, false, at)
+		}
+	}
+}
+
+// Snapshot returns a copy of the current stats keyed by tool name.
+func (m *ToolMetrics) Snapshot() map[string]ToolStat {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]ToolStat, len(m.stats))
+	for name, stat := range m.stats {
+		snapshot[name] = *stat
+	}
+	return snapshot
+}
+
+// Reset clears all stats and pending calls.
+func (m *ToolMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = nil
+	m.pending = nil
+}
+
+// start records a tool invocation.
+// Must be called with mutex already held.
+func (m *ToolMetrics) start(toolUseID, name string, at time.Time) {
+	if m.stats == nil {
+		m.stats = make(map[string]*ToolStat)
+		m.pending = make(map[string]pendingToolCall)
+	}
+	stat, ok := m.stats[name]
+	if !ok {
+		stat = &ToolStat{}
+		m.stats[name] = stat
+	}
+	stat.Invocations++
+	if toolUseID != "" {
+		m.pending[toolUseID] = pendingToolCall{name: name, started: at}
+	}
+}
+
+// complete records the outcome of a pending tool call.
+// Must be called with mutex already held.
+func (m *ToolMetrics) complete(toolUseID string, isError bool, at time.Time) {
+	call, ok := m.pending[toolUseID]
+	if !ok {
+		return
+	}
+	delete(m.pending, toolUseID)
+
+	stat := m.stats[call.name]
+	if isError {
+		stat.Errors++
+	} else {
+		stat.Successes++
+	}
+	duration := at.Sub(call.started)
+	stat.TotalDuration += duration
+	if duration > stat.MaxDuration {
+		stat.MaxDuration = duration
+	}
+}
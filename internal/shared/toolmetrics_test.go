@@ -0,0 +1,143 @@
+package shared
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestToolMetrics tests per-tool aggregation across several tool uses
+func TestToolMetrics(t *testing.T) {
+	t.Run("aggregates_per_tool", func(t *testing.T) {
+		metrics := NewToolMetrics()
+		clock := time.Unix(0, 0)
+		metrics.now = func() time.Time { return clock }
+		isError := true
+
+		metrics.Record(&AssistantMessage{Content: []ContentBlock{
+			&TextBlock{Text: "Reading files"},
+			&ToolUseBlock{ToolUseID: "toolu_1", Name: "Read"},
+			&ToolUseBlock{ToolUseID: "toolu_2", Name: "Bash"},
+		}})
+		clock = clock.Add(2 * time.Second)
+		metrics.Record(&UserMessage{Content: []ContentBlock{
+			&ToolResultBlock{ToolUseID: "toolu_1", Content: "contents"},
+		}})
+		clock = clock.Add(time.Second)
+		metrics.Record(&UserMessage{Content: []ContentBlock{
+			&ToolResultBlock{ToolUseID: "toolu_2", Content: "exit 1", IsError: &isError},
+		}})
+
+		metrics.Record(&AssistantMessage{Content: []ContentBlock{
+			&ToolUseBlock{ToolUseID: "toolu_3", Name: "Read"},
+		}})
+		clock = clock.Add(4 * time.Second)
+		metrics.Record(&UserMessage{Content: []ContentBlock{
+			&ToolResultBlock{ToolUseID: "toolu_3", Content: "contents"},
+		}})
+
+		// Started but not yet completed
+		metrics.Record(&AssistantMessage{Content: []ContentBlock{
+			&ToolUseBlock{ToolUseID: "toolu_4", Name: "Read"},
+		}})
+
+		snapshot := metrics.Snapshot()
+		if len(snapshot) != 2 {
+			t.Fatalf("Expected stats for 2 tools, got %d", len(snapshot))
+		}
+
+		expectedRead := ToolStat{Invocations: 3, Successes: 2, TotalDuration: 6 * time.Second, MaxDuration: 4 * time.Second}
+		if got := snapshot["Read"]; got != expectedRead {
+			t.Errorf("Expected Read stats %+v, got %+v", expectedRead, got)
+		}
+		if got := snapshot["Read"].AverageDuration(); got != 3*time.Second {
+			t.Errorf("Expected Read average 3s, got %v", got)
+		}
+
+		expectedBash := ToolStat{Invocations: 1, Errors: 1, TotalDuration: 3 * time.Second, MaxDuration: 3 * time.Second}
+		if got := snapshot["Bash"]; got != expectedBash {
+			t.Errorf("Expected Bash stats %+v, got %+v", expectedBash, got)
+		}
+	})
+
+	t.Run("server_tools", func(t *testing.T) {
+		metrics := NewToolMetrics()
+
+		metrics.Record(&AssistantMessage{Content: []ContentBlock{
+			&ServerToolUseBlock{ToolUseID: "srvtoolu_1", Name: "web_search"},
+			&WebSearchResultBlock{ToolUseID: "srvtoolu_1"},
+			&ServerToolUseBlock{ToolUseID: "srvtoolu_2", Name: "web_search"},
+			&WebSearchResultBlock{ToolUseID: "srvtoolu_2", ErrorCode: "max_uses_exceeded"},
+			&ServerToolUseBlock{ToolUseID: "srvtoolu_3", Name: "code_execution"},
+			&ServerToolResultBlock{MessageType: "code_execution_tool_result", ToolUseID: "srvtoolu_3"},
+		}})
+
+		snapshot := metrics.Snapshot()
+		if got := snapshot["web_search"]; got.Invocations != 2 || got.Successes != 1 || got.Errors != 1 {
+			t.Errorf("Expected web_search 2 calls, 1 success, 1 error, got %+v", got)
+		}
+		if got := snapshot["code_execution"]; got.Invocations != 1 || got.Successes != 1 {
+			t.Errorf("Expected code_execution 1 successful call, got %+v", got)
+		}
+	})
+
+	t.Run("unmatched_results_ignored", func(t *testing.T) {
+		var metrics ToolMetrics
+
+		metrics.Record(&UserMessage{Content: []ContentBlock{
+			&ToolResultBlock{ToolUseID: "toolu_unknown", Content: "orphan"},
+		}})
+		metrics.Record(&UserMessage{Content: "plain prompt"})
+		metrics.Record(&ResultMessage{Subtype: "success"})
+
+		if got := metrics.Snapshot(); len(got) != 0 {
+			t.Errorf("Expected no stats, got %+v", got)
+		}
+	})
+
+	t.Run("snapshot_is_copy_and_reset_clears", func(t *testing.T) {
+		metrics := NewToolMetrics()
+		metrics.Record(&AssistantMessage{Content: []ContentBlock{
+			&ToolUseBlock{ToolUseID: "toolu_1", Name: "Read"},
+		}})
+
+		snapshot := metrics.Snapshot()
+		stat := snapshot["Read"]
+		stat.Invocations = 99
+		snapshot["Read"] = stat
+		if got := metrics.Snapshot()["Read"].Invocations; got != 1 {
+			t.Errorf("Expected snapshot changes not to affect metrics, got %d invocations", got)
+		}
+
+		metrics.Reset()
+		if got := metrics.Snapshot(); len(got) != 0 {
+			t.Errorf("Expected no stats after Reset, got %+v", got)
+		}
+		// Pending calls are cleared too
+		metrics.Record(&UserMessage{Content: []ContentBlock{
+			&ToolResultBlock{ToolUseID: "toolu_1", Content: "late"},
+		}})
+		if got := metrics.Snapshot(); len(got) != 0 {
+			t.Errorf("Expected late result to be ignored after Reset, got %+v", got)
+		}
+	})
+
+	t.Run("concurrent_records", func(t *testing.T) {
+		metrics := NewToolMetrics()
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				metrics.Record(&AssistantMessage{Content: []ContentBlock{
+					&ToolUseBlock{Name: "Grep"},
+				}})
+			}()
+		}
+		wg.Wait()
+
+		if got := metrics.Snapshot()["Grep"].Invocations; got != 50 {
+			t.Errorf("Expected 50 invocations, got %d", got)
+		}
+	})
+}
@@ -0,0 +1,34 @@
+package shared
+
+import "fmt"
+
+// TruncateToolResultItems returns tool result content cut to its first
+// maxItems content items, followed by a text item noting how many were
+// omitted. Content that is not a list of items, lists within the limit, and
+// a maxItems of zero or less are returned unchanged.
+func TruncateToolResultItems(content any, maxItems int) any {
+	if maxItems <= 0 {
+		return content
+	}
+	switch items := content.(type) {
+	case []any:
+		if len(items) > maxItems {
+			kept := append([]any{}, items[:maxItems]...)
+			return append(kept, truncatedItemsNote(len(items), maxItems))
+		}
+	case []map[string]any:
+		if len(items) > maxItems {
+			kept := append([]map[string]any{}, items[:maxItems]...)
+			return append(kept, truncatedItemsNote(len(items), maxItems))
+		}
+	}
+	return content
+}
+
+// truncatedItemsNote is the text content item appended to a truncated list.
+func truncatedItemsNote(total, kept int) map[string]any {
+	return map[string]any{
+		"type": ContentBlockTypeText,
+		"text": fmt.Sprintf("[Tool result truncated: %d of %d content items omitted]", total-kept, total),
+	}
+}
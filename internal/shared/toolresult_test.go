@@ -0,0 +1,43 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTruncateToolResultItems tests content lists are cut to the limit with a
+// note and everything else is passed through
+func TestTruncateToolResultItems(t *testing.T) {
+	item := func(text string) map[string]any { return map[string]any{"type": "text", "text": text} }
+	note := item("[Tool result truncated: 2 of 4 content items omitted]")
+
+	tests := []struct {
+		name     string
+		content  any
+		maxItems int
+		want     any
+	}{
+		{"any_list_truncated", []any{item("a"), item("b"), item("c"), item("d")}, 2, []any{item("a"), item("b"), note}},
+		{"map_list_truncated", []map[string]any{item("a"), item("b"), item("c"), item("d")}, 2, []map[string]any{item("a"), item("b"), note}},
+		{"within_limit", []any{item("a"), item("b")}, 2, []any{item("a"), item("b")}},
+		{"no_limit", []any{item("a"), item("b"), item("c")}, 0, []any{item("a"), item("b"), item("c")}},
+		{"string_content", "plain text", 1, "plain text"},
+		{"nil_content", nil, 1, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := TruncateToolResultItems(test.content, test.maxItems)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Expected %v, got %v", test.want, got)
+			}
+		})
+	}
+
+	// The input list is not modified
+	original := []any{item("a"), item("b"), item("c")}
+	_ = TruncateToolResultItems(original, 1)
+	if len(original) != 3 || original[1].(map[string]any)["text"] != "b" {
+		t.Errorf("Expected input list unchanged, got %v", original)
+	}
+}
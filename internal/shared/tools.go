@@ -0,0 +1,83 @@
+package shared
+
+import "strings"
+
+// mcpToolPrefix prefixes the names of tools provided by MCP servers, as in
+// mcp__<server>__<tool>.
+const mcpToolPrefix = "mcp__"
+
+// ToolInfo describes a tool available to Claude in the current session.
+type ToolInfo struct {
+	// Name is the tool name as used in tool_use blocks and AllowedTools.
+	Name string
+	// McpServer is the MCP server providing the tool, or empty for built-in tools.
+	McpServer string
+}
+
+// ToolsFromSystemMessage returns the tool list carried by a system message,
+// such as the init message or an update sent after MCP servers reconnect.
+// Tools are listed either by name or as objects with a "name" field.
+// The second result is false if the message carries no tool list.
+func ToolsFromSystemMessage(msg *SystemMessage) ([]ToolInfo, bool) {
+	if msg == nil {
+		return nil, false
+	}
+	entries, ok := msg.Data["tools"].([]any)
+	if !ok {
+		return nil, false
+	}
+
+	tools := make([]ToolInfo, 0, len(entries))
+	for _, entry := range entries {
+		var name string
+		switch v := entry.(type) {
+		case string:
+			name = v
+		case map[string]any:
+			name, _ = v["name"].(string)
+		}
+		if name == "" {
+			continue
+		}
+		tools = append(tools, ToolInfo{Name: name, McpServer: mcpServerOfTool(name)})
+	}
+	return tools, true
+}
+
+// NormalizeToolName returns the canonical form of a tool name, so names that
+// differ only in formatting compare equal. Surrounding whitespace is trimmed.
+// MCP tool names (mcp__<server>__<tool>) are also lowercased, and characters
+// other than ASCII letters, digits, and underscores become underscores, since
+// CLI versions sanitize server and tool names differently: mcp__My-Server__get
+// and mcp__my_server__get are the same tool. Other tool names are case
+// sensitive and otherwise unchanged.
+func NormalizeToolName(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) < len(mcpToolPrefix) || !strings.EqualFold(name[:len(mcpToolPrefix)], mcpToolPrefix) {
+		return name
+	}
+
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// mcpServerOfTool returns the server name of an mcp__<server>__<tool> name,
+// or empty for other tools.
+func mcpServerOfTool(name string) string {
+	if !strings.HasPrefix(name, mcpToolPrefix) {
+		return ""
+	}
+	rest := name[len(mcpToolPrefix):]
+	if i := strings.Index(rest, "__"); i > 0 {
+		return rest[:i]
+	}
+	return ""
+}
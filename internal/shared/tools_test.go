@@ -0,0 +1,141 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestToolsFromSystemMessage tests tool lists are read from system messages
+func TestToolsFromSystemMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    *SystemMessage
+		want   []ToolInfo
+		wantOK bool
+	}{
+		{
+			name: "tool_names",
+			msg: &SystemMessage{Subtype: "init", Data: map[string]any{
+				"tools": []any{"Read", "Bash", "mcp__docs__search"},
+			}},
+			want: []ToolInfo{
+				{Name: "Read"},
+				{Name: "Bash"},
+				{Name: "mcp__docs__search", McpServer: "docs"},
+			},
+			wantOK: true,
+		},
+		{
+			name: "tool_objects",
+			msg: &SystemMessage{Subtype: "tools_changed", Data: map[string]any{
+				"tools": []any{
+					map[string]any{"name": "mcp__git_tools__log"},
+					map[string]any{"description": "no name"},
+					42.0,
+				},
+			}},
+			want:   []ToolInfo{{Name: "mcp__git_tools__log", McpServer: "git_tools"}},
+			wantOK: true,
+		},
+		{
+			name: "malformed_mcp_names",
+			msg: &SystemMessage{Data: map[string]any{
+				"tools": []any{"mcp__", "mcp__docs", "mcp____search"},
+			}},
+			want:   []ToolInfo{{Name: "mcp__"}, {Name: "mcp__docs"}, {Name: "mcp____search"}},
+			wantOK: true,
+		},
+		{
+			name:   "empty_list",
+			msg:    &SystemMessage{Data: map[string]any{"tools": []any{}}},
+			want:   []ToolInfo{},
+			wantOK: true,
+		},
+		{
+			name: "no_tools",
+			msg:  &SystemMessage{Subtype: "status", Data: map[string]any{"status": "compacting"}},
+		},
+		{
+			name: "nil_message",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := ToolsFromSystemMessage(test.msg)
+			if ok != test.wantOK {
+				t.Fatalf("Expected ok %v, got %v", test.wantOK, ok)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Expected tools %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+// TestNormalizeToolName tests equivalent tool names normalize to the same form
+func TestNormalizeToolName(t *testing.T) {
+	equivalent := [][]string{
+		{"mcp__my_server__search", "mcp__my-server__search", "MCP__My-Server__Search", " mcp__my.server__search "},
+		{"mcp__docs__get_page", "mcp__docs__get-page", "mcp__Docs__GET_PAGE"},
+		{"Read", " Read", "Read\n"},
+	}
+	for _, names := range equivalent {
+		want := NormalizeToolName(names[0])
+		for _, name := range names[1:] {
+			if got := NormalizeToolName(name); got != want {
+				t.Errorf("Expected %q to normalize to %q, got %q", name, want, got)
+			}
+		}
+	}
+
+	distinct := [][2]string{
+		{"Read", "read"},
+		{"mcp__docs__search", "mcp__docs__search_all"},
+		{"mcp__docs__search", "mcp__web__search"},
+	}
+	for _, pair := range distinct {
+		if NormalizeToolName(pair[0]) == NormalizeToolName(pair[1]) {
+			t.Errorf("Expected %q and %q to stay distinct", pair[0], pair[1])
+		}
+	}
+
+	if got := NormalizeToolName("MCP__My-Server__Search"); got != "mcp__my_server__search" {
+		t.Errorf("Expected canonical mcp__my_server__search, got %q", got)
+	}
+}
+
+// TestToolUseBlockMCP tests tool use blocks are classified as built-in or MCP
+// tools by name
+func TestToolUseBlockMCP(t *testing.T) {
+	tests := []struct {
+		name       string
+		toolName   string
+		wantMCP    bool
+		wantServer string
+	}{
+		{"builtin_read", "Read", false, ""},
+		{"builtin_bash", "Bash", false, ""},
+		{"mcp_tool", "mcp__docs__search", true, "docs"},
+		{"mcp_server_with_underscore", "mcp__git_tools__log", true, "git_tools"},
+		{"mcp_tool_with_double_underscore", "mcp__calc__add__v2", true, "calc"},
+		{"prefix_only", "mcp__", false, ""},
+		{"no_tool_separator", "mcp__docs", false, ""},
+		{"empty_server", "mcp____search", false, ""},
+		{"uppercase_prefix", "MCP__docs__search", false, ""},
+		{"empty_name", "", false, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := &ToolUseBlock{Name: test.toolName}
+			if got := block.IsMCP(); got != test.wantMCP {
+				t.Errorf("IsMCP() = %v, want %v", got, test.wantMCP)
+			}
+			server, ok := block.ServerName()
+			if server != test.wantServer || ok != test.wantMCP {
+				t.Errorf("ServerName() = %q, %v, want %q, %v", server, ok, test.wantServer, test.wantMCP)
+			}
+		})
+	}
+}
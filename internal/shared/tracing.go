@@ -0,0 +1,28 @@
+package shared
+
+import "context"
+
+// Span names passed to Tracer.StartSpan.
+const (
+	// SpanNameTurn covers one turn, from sending a prompt to its ResultMessage.
+	// Attributes: "session_id", and "query_id" when the query has one.
+	SpanNameTurn = "claude.turn"
+	// SpanNameToolCall covers one SDK MCP tool handler call.
+	// Attributes: "mcp.server" and "tool.name" (the mcp__<server>__<tool> name).
+	SpanNameToolCall = "claude.tool_call"
+)
+
+// Tracer starts spans around SDK operations. It is small enough to adapt to
+// OpenTelemetry or another tracing system without the SDK depending on one.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// StartSpan starts a span as a child of any span carried by ctx and
+	// returns a context carrying the new span.
+	StartSpan(ctx context.Context, name string, attributes map[string]any) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer.
+type Span interface {
+	// End finishes the span. err is nil when the operation succeeded.
+	End(err error)
+}
@@ -0,0 +1,134 @@
+package shared
+
+import (
+	"sync"
+)
+
+// Usage holds token counts reported in a ResultMessage's usage field.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// UsageFromMap extracts token counts from a raw usage map.
+// Missing or non-numeric fields are treated as zero.
+func UsageFromMap(usage map[string]any) Usage {
+	return Usage{
+		InputTokens:              usageInt(usage, "input_tokens"),
+		OutputTokens:             usageInt(usage, "output_tokens"),
+		CacheCreationInputTokens: usageInt(usage, "cache_creation_input_tokens"),
+		CacheReadInputTokens:     usageInt(usage, "cache_read_input_tokens"),
+	}
+}
+
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		InputTokens:              u.InputTokens + other.InputTokens,
+		OutputTokens:             u.OutputTokens + other.OutputTokens,
+		CacheCreationInputTokens: u.CacheCreationInputTokens + other.CacheCreationInputTokens,
+		CacheReadInputTokens:     u.CacheReadInputTokens + other.CacheReadInputTokens,
+	}
+}
+
+// TotalTokens returns the sum of all token counts.
+func (u Usage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// CacheHitRate returns the fraction of input tokens read from the prompt
+// cache, from 0 to 1, or zero when no input tokens were reported.
+func (u Usage) CacheHitRate() float64 {
+	input := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	if input == 0 {
+		return 0
+	}
+	return float64(u.CacheReadInputTokens) / float64(input)
+}
+
+// TokenUsage returns the typed token counts from the message's usage field,
+// including prompt cache creation and read tokens.
+func (m *ResultMessage) TokenUsage() Usage {
+	if m == nil || m.Usage == nil {
+		return Usage{}
+	}
+	return UsageFromMap(*m.Usage)
+}
+
+// CostTracker accumulates usage and cost from ResultMessages across turns.
+// The zero value is ready to use and it is safe for concurrent use.
+type CostTracker struct {
+	mu      sync.RWMutex
+	usage   Usage
+	costUSD float64
+	results int
+}
+
+// NewCostTracker creates an empty cost tracker.
+func NewCostTracker() *CostTracker {
+	return &CostTracker{}
+}
+
+// Record adds the usage and cost reported by a ResultMessage.
+// Nil messages and missing fields are ignored.
+func (c *CostTracker) Record(result *ResultMessage) {
+	if result == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if result.Usage != nil {
+		c.usage = c.usage.Add(UsageFromMap(*result.Usage))
+	}
+	if result.TotalCostUSD != nil {
+		c.costUSD += *result.TotalCostUSD
+	}
+	c.results++
+}
+
+// Total returns the accumulated token usage.
+func (c *CostTracker) Total() Usage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.usage
+}
+
+// TotalCostUSD returns the accumulated cost in USD.
+func (c *CostTracker) TotalCostUSD() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.costUSD
+}
+
+// Results returns the number of ResultMessages recorded.
+func (c *CostTracker) Results() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.results
+}
+
+// Reset clears all accumulated usage and cost.
+func (c *CostTracker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usage = Usage{}
+	c.costUSD = 0
+	c.results = 0
+}
+
+// usageInt extracts a token count from a usage map.
+func usageInt(usage map[string]any, key string) int {
+	switch v := usage[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package shared
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestCostTracker tests usage and cost accumulation across turns
+func TestCostTracker(t *testing.T) {
+	t.Run("accumulates_across_turns", func(t *testing.T) {
+		tracker := NewCostTracker()
+
+		tracker.Record(newUsageResult(0.01, map[string]any{
+			"input_tokens":                float64(100),
+			"output_tokens":               float64(50),
+			"cache_creation_input_tokens": float64(10),
+			"cache_read_input_tokens":     float64(5),
+		}))
+		tracker.Record(newUsageResult(0.02, map[string]any{
+			"input_tokens":  float64(200),
+			"output_tokens": float64(75),
+		}))
+
+		expected := Usage{InputTokens: 300, OutputTokens: 125, CacheCreationInputTokens: 10, CacheReadInputTokens: 5}
+		if got := tracker.Total(); got != expected {
+			t.Errorf("Expected usage %+v, got %+v", expected, got)
+		}
+		if got := tracker.Total().TotalTokens(); got != 440 {
+			t.Errorf("Expected 440 total tokens, got %d", got)
+		}
+		if got := tracker.TotalCostUSD(); got < 0.0299 || got > 0.0301 {
+			t.Errorf("Expected total cost 0.03, got %f", got)
+		}
+		if got := tracker.Results(); got != 2 {
+			t.Errorf("Expected 2 results, got %d", got)
+		}
+	})
+
+	t.Run("missing_fields_ignored", func(t *testing.T) {
+		var tracker CostTracker
+		tracker.Record(nil)
+		tracker.Record(&ResultMessage{Subtype: "error_during_execution"})
+		tracker.Record(newUsageResult(0.5, map[string]any{"input_tokens": "bad"}))
+
+		if got := tracker.Total(); got != (Usage{}) {
+			t.Errorf("Expected zero usage, got %+v", got)
+		}
+		if got := tracker.TotalCostUSD(); got != 0.5 {
+			t.Errorf("Expected cost 0.5, got %f", got)
+		}
+		if got := tracker.Results(); got != 2 {
+			t.Errorf("Expected 2 results, got %d", got)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		tracker := NewCostTracker()
+		tracker.Record(newUsageResult(1, map[string]any{"output_tokens": float64(1)}))
+		tracker.Reset()
+
+		if tracker.Total() != (Usage{}) || tracker.TotalCostUSD() != 0 || tracker.Results() != 0 {
+			t.Error("Expected tracker to be empty after Reset")
+		}
+	})
+
+	t.Run("concurrent_record", func(t *testing.T) {
+		tracker := NewCostTracker()
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tracker.Record(newUsageResult(0.5, map[string]any{"input_tokens": float64(2)}))
+				_ = tracker.Total()
+			}()
+		}
+		wg.Wait()
+
+		if got := tracker.Total().InputTokens; got != 100 {
+			t.Errorf("Expected 100 input tokens, got %d", got)
+		}
+		if got := tracker.TotalCostUSD(); got != 25 {
+			t.Errorf("Expected cost 25, got %f", got)
+		}
+	})
+}
+
+// TestUsageCacheHitRate tests the share of input tokens read from the prompt cache
+func TestUsageCacheHitRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage Usage
+		want  float64
+	}{
+		{"no_tokens", Usage{}, 0},
+		{"no_cache", Usage{InputTokens: 100, OutputTokens: 50}, 0},
+		{"all_cached", Usage{CacheReadInputTokens: 400, OutputTokens: 50}, 1},
+		{"mixed", Usage{InputTokens: 100, CacheCreationInputTokens: 100, CacheReadInputTokens: 200}, 0.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.usage.CacheHitRate(); got != test.want {
+				t.Errorf("Expected cache hit rate %v, got %v", test.want, got)
+			}
+		})
+	}
+
+	var nilResult *ResultMessage
+	if got := nilResult.TokenUsage(); got != (Usage{}) {
+		t.Errorf("Expected zero usage for nil result, got %+v", got)
+	}
+	if got := (&ResultMessage{}).TokenUsage(); got != (Usage{}) {
+		t.Errorf("Expected zero usage without usage field, got %+v", got)
+	}
+}
+
+func newUsageResult(cost float64, usage map[string]any) *ResultMessage {
+	return &ResultMessage{Subtype: "success", SessionID: "s1", TotalCostUSD: &cost, Usage: &usage}
+}
@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"sort"
 	"sync"
 )
 
@@ -13,6 +14,12 @@ type StreamValidator struct {
 	hasResultMessage bool            // Whether we've seen a result message
 	streamEnded      bool            // Whether stream has ended
 	issues           []StreamIssue   // Validation issues found
+	initReceived     bool            // Whether a ready init system message was seen
+	initSeen         bool            // Whether any init system message was seen
+	pendingMcp       []string        // MCP servers pending in the latest init message
+	readyCh          chan struct{}   // Closed once initReceived becomes true
+	endedCh          chan struct{}   // Closed once the stream has ended
+	unexpectedEnd    bool            // Whether the stream ended mid-turn
 }
 
 // StreamIssue represents a validation issue found in the stream.
@@ -29,6 +36,7 @@ type StreamStats struct {
 	PendingTools   []string `json:"pending_tools"`   // Tool IDs still awaiting results
 	HasResult      bool     `json:"has_result"`      // Whether result message was seen
 	StreamEnded    bool     `json:"stream_ended"`    // Whether stream has ended
+	Ready          bool     `json:"ready"`           // Whether init confirmed CLI and MCP servers loaded
 }
 
 // NewStreamValidator creates a new stream validator.
@@ -76,16 +84,87 @@ func (v *StreamValidator) TrackMessage(msg Message) {
 			}
 		}
 
+	case *SystemMessage:
+		if m.Subtype != SystemSubtypeInit || v.initReceived {
+			break
+		}
+		v.initSeen = true
+		v.pendingMcp = pendingMcpServers(m.Data)
+		if len(v.pendingMcp) == 0 {
+			v.initReceived = true
+			close(v.readyChan())
+		}
+
 	case *ResultMessage:
 		v.hasResultMessage = true
 	}
 }
 
+// Ready returns a channel that is closed once an init system message reports
+// that the CLI and all MCP servers have finished loading.
+func (v *StreamValidator) Ready() <-chan struct{} {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.readyChan()
+}
+
+// Ended returns a channel that is closed once the stream has ended.
+func (v *StreamValidator) Ended() <-chan struct{} {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.endedChan()
+}
+
+// readyChan lazily creates the ready channel so zero-value validators work.
+// Must be called with mutex already held.
+func (v *StreamValidator) readyChan() chan struct{} {
+	if v.readyCh == nil {
+		v.readyCh = make(chan struct{})
+	}
+	return v.readyCh
+}
+
+// endedChan lazily creates the ended channel so zero-value validators work.
+// Must be called with mutex already held.
+func (v *StreamValidator) endedChan() chan struct{} {
+	if v.endedCh == nil {
+		v.endedCh = make(chan struct{})
+	}
+	return v.endedCh
+}
+
+// PendingMcpServers returns the sorted names of MCP servers still pending in
+// the latest init message, and whether any init message has been seen.
+func (v *StreamValidator) PendingMcpServers() ([]string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return append([]string(nil), v.pendingMcp...), v.initSeen
+}
+
+// pendingMcpServers returns the sorted names of MCP servers in init data that
+// are still pending.
+func pendingMcpServers(data map[string]any) []string {
+	var pending []string
+	servers, _ := data["mcp_servers"].([]any)
+	for _, server := range servers {
+		serverMap, ok := server.(map[string]any)
+		if ok && serverMap["status"] == McpServerStatusPending {
+			name, _ := serverMap["name"].(string)
+			pending = append(pending, name)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
 // MarkStreamEnd marks the stream as ended and performs final validation.
 func (v *StreamValidator) MarkStreamEnd() {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 
+	if !v.streamEnded {
+		close(v.endedChan())
+	}
 	v.streamEnded = true
 
 	// Check for missing tool results
@@ -106,6 +185,29 @@ func (v *StreamValidator) MarkStreamEnd() {
 	}
 }
 
+// MarkUnexpectedEnd records that the stream ended while a turn was still
+// active, before its result message arrived. Call before MarkStreamEnd.
+func (v *StreamValidator) MarkUnexpectedEnd() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.unexpectedEnd {
+		return
+	}
+	v.unexpectedEnd = true
+	v.issues = append(v.issues, StreamIssue{
+		Type:        "unexpected_eof",
+		Description: "Stream ended before the active turn completed",
+	})
+}
+
+// EndedUnexpectedly reports whether the stream ended mid-turn.
+func (v *StreamValidator) EndedUnexpectedly() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.unexpectedEnd
+}
+
 // GetIssues returns all validation issues found.
 func (v *StreamValidator) GetIssues() []StreamIssue {
 	v.mu.RLock()
@@ -133,6 +235,7 @@ func (v *StreamValidator) GetStats() StreamStats {
 		PendingTools:   pendingTools,
 		HasResult:      v.hasResultMessage,
 		StreamEnded:    v.streamEnded,
+		Ready:          v.initReceived,
 	}
 }
 
@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"strings"
 	"sync"
 	"testing"
 )
@@ -214,6 +215,27 @@ func TestStreamValidator_MissingResultMessage(t *testing.T) {
 	}
 }
 
+func TestStreamValidator_UnexpectedEnd(t *testing.T) {
+	validator := NewStreamValidator()
+	validator.TrackMessage(&AssistantMessage{Content: []ContentBlock{&TextBlock{Text: "Working"}}})
+
+	if validator.EndedUnexpectedly() {
+		t.Error("Expected EndedUnexpectedly to be false before the stream ends")
+	}
+
+	validator.MarkUnexpectedEnd()
+	validator.MarkUnexpectedEnd()
+	validator.MarkStreamEnd()
+
+	if !validator.EndedUnexpectedly() {
+		t.Error("Expected EndedUnexpectedly to be true")
+	}
+	issues := validator.GetIssues()
+	if len(issues) != 1 || issues[0].Type != "unexpected_eof" {
+		t.Errorf("Expected a single unexpected_eof issue, got %+v", issues)
+	}
+}
+
 func TestStreamValidator_ThreadSafety(t *testing.T) {
 	validator := NewStreamValidator()
 	var wg sync.WaitGroup
@@ -316,3 +338,87 @@ func TestStreamValidator_PartialCompletion(t *testing.T) {
 		t.Errorf("Expected 1 pending tool, got %d", len(stats.PendingTools))
 	}
 }
+
+func TestStreamValidatorReadiness(t *testing.T) {
+	initMsg := func(statuses ...string) *SystemMessage {
+		servers := make([]any, 0, len(statuses))
+		for _, status := range statuses {
+			servers = append(servers, map[string]any{"name": "srv", "status": status})
+		}
+		return &SystemMessage{Subtype: SystemSubtypeInit, Data: map[string]any{"mcp_servers": servers}}
+	}
+
+	t.Run("ready_after_init", func(t *testing.T) {
+		validator := NewStreamValidator()
+		assertNotClosed(t, validator.Ready())
+
+		validator.TrackMessage(&SystemMessage{Subtype: "status", Data: map[string]any{}})
+		assertNotClosed(t, validator.Ready())
+
+		validator.TrackMessage(initMsg("connected", "failed"))
+		assertClosed(t, validator.Ready())
+		if !validator.GetStats().Ready {
+			t.Error("Expected stats to report ready")
+		}
+
+		// Repeated init messages must not panic on double close
+		validator.TrackMessage(initMsg("connected"))
+	})
+
+	t.Run("pending_mcp_server_not_ready", func(t *testing.T) {
+		validator := NewStreamValidator()
+		validator.TrackMessage(initMsg("connected", McpServerStatusPending))
+		assertNotClosed(t, validator.Ready())
+
+		validator.TrackMessage(initMsg("connected", "connected"))
+		assertClosed(t, validator.Ready())
+	})
+
+	t.Run("pending_mcp_server_names", func(t *testing.T) {
+		validator := NewStreamValidator()
+		if _, seen := validator.PendingMcpServers(); seen {
+			t.Error("Expected no init message seen")
+		}
+
+		validator.TrackMessage(&SystemMessage{Subtype: SystemSubtypeInit, Data: map[string]any{
+			"mcp_servers": []any{
+				map[string]any{"name": "search", "status": McpServerStatusPending},
+				map[string]any{"name": "docs", "status": "connected"},
+				map[string]any{"name": "db", "status": McpServerStatusPending},
+			},
+		}})
+		pending, seen := validator.PendingMcpServers()
+		if !seen {
+			t.Error("Expected init message seen")
+		}
+		if strings.Join(pending, ",") != "db,search" {
+			t.Errorf("Expected pending servers [db search], got %v", pending)
+		}
+	})
+
+	t.Run("ended_signaled_once", func(t *testing.T) {
+		validator := &StreamValidator{}
+		assertNotClosed(t, validator.Ended())
+		validator.MarkStreamEnd()
+		validator.MarkStreamEnd()
+		assertClosed(t, validator.Ended())
+	})
+}
+
+func assertClosed(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	default:
+		t.Error("Expected channel to be closed")
+	}
+}
+
+func assertNotClosed(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Error("Expected channel to be open")
+	default:
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/cli"
 	"github.com/severity1/claude-agent-sdk-go/internal/control"
@@ -73,6 +75,14 @@ func (t *Transport) GetValidator() *shared.StreamValidator {
 	return t.validator
 }
 
+// CLIVersion returns the CLI version detected on Connect, or an empty string
+// if it is unknown or CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK is set.
+func (t *Transport) CLIVersion() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.cliVersion
+}
+
 // SetModel changes the AI model during a streaming session.
 // This method requires control protocol integration which is only available
 // in streaming mode (when closeStdin is false).
@@ -146,37 +156,110 @@ func (t *Transport) RewindFiles(ctx context.Context, userMessageID string) error
 	return t.protocol.RewindFiles(ctx, userMessageID)
 }
 
+// SetAllowedTools restricts the tools the permission callback approves for
+// the rest of the session. Nil removes the restriction. Enforcement happens in
+// the SDK, so it requires a permission callback (CanUseTool or agent tool
+// allowlist enforcement) to receive the CLI's permission requests.
+func (t *Transport) SetAllowedTools(_ context.Context, tools []string) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if !t.connected {
+		return fmt.Errorf("transport not connected")
+	}
+
+	// Control protocol integration is only available in streaming mode
+	if t.closeStdin {
+		return fmt.Errorf("SetAllowedTools not available in one-shot mode")
+	}
+
+	if t.protocol == nil || t.permissionCallback() == nil {
+		return fmt.Errorf("SetAllowedTools requires a permission callback; configure WithCanUseTool")
+	}
+
+	var scope []string
+	if tools != nil {
+		scope = append([]string{}, tools...)
+		if t.options.ToolNameNormalization {
+			scope = normalizeToolEntries(scope)
+		}
+	}
+
+	t.toolScopeMu.Lock()
+	t.toolScope = scope
+	t.toolScopeMu.Unlock()
+	return nil
+}
+
+// toolInScope reports whether toolName is allowed by SetAllowedTools.
+func (t *Transport) toolInScope(toolName string) bool {
+	t.toolScopeMu.RLock()
+	defer t.toolScopeMu.RUnlock()
+
+	if t.toolScope == nil {
+		return true
+	}
+	for _, tool := range t.toolScope {
+		if idx := strings.IndexByte(tool, '('); idx >= 0 {
+			tool = tool[:idx]
+		}
+		if strings.TrimSpace(tool) == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeToolEntries returns tool list entries with their tool names
+// normalized, keeping rule specifiers such as the (git:*) of Bash(git:*).
+func normalizeToolEntries(entries []string) []string {
+	if entries == nil {
+		return nil
+	}
+	normalized := make([]string, len(entries))
+	for i, entry := range entries {
+		name, specifier := entry, ""
+		if idx := strings.IndexByte(entry, '('); idx >= 0 {
+			name, specifier = entry[:idx], entry[idx:]
+		}
+		normalized[i] = shared.NormalizeToolName(name) + specifier
+	}
+	return normalized
+}
+
+// normalizeAgentTools returns a copy of agents with their tool lists
+// normalized for the agent tool allowlist.
+func normalizeAgentTools(agents map[string]shared.AgentDefinition) map[string]shared.AgentDefinition {
+	if agents == nil {
+		return nil
+	}
+	normalized := make(map[string]shared.AgentDefinition, len(agents))
+	for name, agent := range agents {
+		agent.Tools = normalizeToolEntries(agent.Tools)
+		normalized[name] = agent
+	}
+	return normalized
+}
+
+// listsWholeTool reports whether entries name toolName without a rule
+// specifier, so the entry applies to every use of the tool.
+func listsWholeTool(entries []string, toolName string) bool {
+	for _, entry := range entries {
+		if !strings.Contains(entry, "(") && strings.TrimSpace(entry) == toolName {
+			return true
+		}
+	}
+	return false
+}
+
 // buildProtocolOptions constructs control protocol options from transport configuration.
 // This extracts callback wiring logic from Connect to reduce cyclomatic complexity.
 func (t *Transport) buildProtocolOptions() []control.ProtocolOption {
 	var opts []control.ProtocolOption
 
 	// Wire permission callback if configured
-	if t.options != nil && t.options.CanUseTool != nil {
-		// Create adapter that converts between shared.Options (any types)
-		// and control package (strongly-typed) to avoid import cycles
-		optionsCallback := t.options.CanUseTool
-		opts = append(opts,
-			control.WithCanUseToolCallback(func(
-				ctx context.Context,
-				toolName string,
-				input map[string]any,
-				permCtx control.ToolPermissionContext,
-			) (control.PermissionResult, error) {
-				// Call the Options callback with any-typed permCtx
-				result, err := optionsCallback(ctx, toolName, input, permCtx)
-				if err != nil {
-					return nil, err
-				}
-
-				// Convert result back to strongly-typed PermissionResult
-				if pr, ok := result.(control.PermissionResult); ok {
-					return pr, nil
-				}
-
-				// Fallback: deny if result type is unexpected
-				return control.NewPermissionResultDeny("invalid permission result type"), nil
-			}))
+	if callback := t.permissionCallback(); callback != nil {
+		opts = append(opts, control.WithCanUseToolCallback(callback))
 	}
 
 	// Wire hooks if configured
@@ -192,7 +275,7 @@ func (t *Transport) buildProtocolOptions() []control.ProtocolOption {
 		sdkServers := make(map[string]control.McpServer)
 		for name, config := range t.options.McpServers {
 			if sdkConfig, ok := config.(*shared.McpSdkServerConfig); ok && sdkConfig.Instance != nil {
-				sdkServers[name] = sdkConfig.Instance
+				sdkServers[name] = t.traceMcpServer(name, sdkConfig.Instance)
 			}
 		}
 		if len(sdkServers) > 0 {
@@ -200,9 +283,241 @@ func (t *Transport) buildProtocolOptions() []control.ProtocolOption {
 		}
 	}
 
+	// Wire tool result processing for SDK MCP tool results
+	if processor := t.mcpToolResultProcessor(); processor != nil {
+		opts = append(opts, control.WithToolResultPostProcessor(processor))
+	}
+
+	// Wire JSON-RPC tracing for SDK MCP servers
+	if t.options != nil && t.options.SdkMcpTrace != nil {
+		opts = append(opts, control.WithSdkMcpTrace(t.options.SdkMcpTrace))
+	}
+
 	return opts
 }
 
+// permissionCallback builds the control protocol permission callback from
+// options, or returns nil if none of CanUseTool, agent tool allowlist
+// enforcement, OnPlanProposal, or EditConfirmation is configured. Requests
+// that none of the configured callbacks decide are denied, never allowed.
+func (t *Transport) permissionCallback() control.CanUseToolCallback {
+	if t.options == nil || (t.options.CanUseTool == nil && !t.options.EnforceAgentToolAllowlist &&
+		t.options.OnPlanProposal == nil && t.options.EditConfirmation == nil) {
+		return nil
+	}
+
+	// Create adapter that converts between shared.Options (any types)
+	// and control package (strongly-typed) to avoid import cycles
+	optionsCallback := t.options.CanUseTool
+	enforceAllowlist := t.options.EnforceAgentToolAllowlist
+	agents := t.options.Agents
+	onPlanProposal := t.options.OnPlanProposal
+	editConfirmation := t.options.EditConfirmation
+	cwd := ""
+	if t.options.Cwd != nil {
+		cwd = *t.options.Cwd
+	}
+	approvals := t.options.ToolApprovalCache
+
+	// With normalization, the CLI's allow and deny lists are also checked
+	// here, as the CLI may not match names formatted differently
+	normalizeNames := t.options.ToolNameNormalization
+	var allowedTools, disallowedTools []string
+	if normalizeNames {
+		agents = normalizeAgentTools(agents)
+		allowedTools = normalizeToolEntries(t.options.AllowedTools)
+		disallowedTools = normalizeToolEntries(t.options.DisallowedTools)
+	}
+	return func(
+		ctx context.Context,
+		toolName string,
+		input map[string]any,
+		permCtx control.ToolPermissionContext,
+	) (control.PermissionResult, error) {
+		if normalizeNames {
+			toolName = shared.NormalizeToolName(toolName)
+			if listsWholeTool(disallowedTools, toolName) {
+				return control.NewPermissionResultDeny(fmt.Sprintf(
+					"tool %s is in the disallowed tools", toolName)), nil
+			}
+		}
+
+		// Deny tools removed by SetAllowedTools before any other check
+		if !t.toolInScope(toolName) {
+			return control.NewPermissionResultDeny(fmt.Sprintf(
+				"tool %s is not in the allowed tools for this session", toolName)), nil
+		}
+
+		// Deny tools outside the requesting agent's definition before the user
+		// callback. An agent that is not defined has no tool list to allow from.
+		if enforceAllowlist && permCtx.AgentID != "" {
+			agent, ok := agents[permCtx.AgentID]
+			if !ok {
+				return control.NewPermissionResultDeny(fmt.Sprintf(
+					"agent %s is not defined, so tool %s is not allowed", permCtx.AgentID, toolName)), nil
+			}
+			if !agent.AllowsTool(toolName) {
+				return control.NewPermissionResultDeny(fmt.Sprintf(
+					"tool %s is not in the tool list for agent %s", toolName, permCtx.AgentID)), nil
+			}
+		}
+
+		// Plan proposals are decided by OnPlanProposal instead of CanUseTool
+		if onPlanProposal != nil && toolName == exitPlanModeTool {
+			return decidePlanProposal(onPlanProposal, input, permCtx.AgentID), nil
+		}
+
+		// File edits must be confirmed from their diff before CanUseTool.
+		// Without CanUseTool the confirmation is the whole decision.
+		if editConfirmation != nil && isFileEditTool(toolName) {
+			if !confirmEdit(editConfirmation, cwd, toolName, input) {
+				return control.NewPermissionResultDeny(editRejectedMessage), nil
+			}
+			if optionsCallback == nil {
+				return control.NewPermissionResultAllow(), nil
+			}
+		}
+
+		if normalizeNames && listsWholeTool(allowedTools, toolName) {
+			return control.NewPermissionResultAllow(), nil
+		}
+
+		// The CLI only asks about tools it would have prompted for. With no
+		// CanUseTool to answer, deny them as the CLI does when it cannot ask.
+		if optionsCallback == nil {
+			return control.NewPermissionResultDeny(fmt.Sprintf(
+				"tool %s requires permission and no permission callback is set", toolName)), nil
+		}
+
+		// Reuse an earlier decision for an identical request
+		if approvals != nil {
+			if cached, ok := approvals.Lookup(toolName, input); ok {
+				return cached.(control.PermissionResult), nil
+			}
+		}
+
+		// Call the Options callback with any-typed permCtx
+		result, err := optionsCallback(ctx, toolName, input, permCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		// Convert result back to strongly-typed PermissionResult
+		if pr, ok := result.(control.PermissionResult); ok {
+			if approvals != nil && pr != nil {
+				approvals.Store(toolName, input, pr)
+			}
+			return pr, nil
+		}
+
+		// Fallback: deny if result type is unexpected
+		return control.NewPermissionResultDeny("invalid permission result type"), nil
+	}
+}
+
+// exitPlanModeTool is the tool Claude calls to present its plan and leave plan mode.
+const exitPlanModeTool = "ExitPlanMode"
+
+// planRejectedMessage tells Claude its plan was rejected.
+const planRejectedMessage = "The plan was not approved. Stay in plan mode and revise the plan."
+
+// decidePlanProposal asks onPlanProposal to approve an ExitPlanMode request.
+// A panicking callback rejects the plan rather than crashing the SDK.
+func decidePlanProposal(
+	onPlanProposal func(*shared.PlanProposal) bool,
+	input map[string]any,
+	agentID string,
+) (result control.PermissionResult) {
+	plan, _ := input["plan"].(string)
+	proposal := &shared.PlanProposal{Plan: plan, Input: input, AgentID: agentID}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = control.NewPermissionResultDeny(planRejectedMessage)
+		}
+	}()
+	if onPlanProposal(proposal) {
+		return control.NewPermissionResultAllow()
+	}
+	return control.NewPermissionResultDeny(planRejectedMessage)
+}
+
+// editRejectedMessage tells Claude its file edit was rejected.
+const editRejectedMessage = "The edit was not approved. Do not retry it unchanged."
+
+// isFileEditTool reports whether toolName writes a file.
+func isFileEditTool(toolName string) bool {
+	switch toolName {
+	case "Write", "Edit", "MultiEdit":
+		return true
+	}
+	return false
+}
+
+// confirmEdit asks editConfirmation to approve a file edit, showing the diff
+// between the file's current content and the content after the edit. A file
+// that does not exist is diffed as empty. A panicking callback rejects the edit.
+func confirmEdit(
+	editConfirmation func(path, diff string) bool,
+	cwd, toolName string,
+	input map[string]any,
+) (approved bool) {
+	path, _ := input["file_path"].(string)
+	resolved := path
+	if cwd != "" && !filepath.IsAbs(path) {
+		resolved = filepath.Join(cwd, path)
+	}
+	var before string
+	if data, err := os.ReadFile(resolved); err == nil {
+		before = string(data)
+	}
+	diff := shared.UnifiedDiff(path, before, editedContent(toolName, input, before))
+
+	defer func() {
+		if r := recover(); r != nil {
+			approved = false
+		}
+	}()
+	return editConfirmation(path, diff)
+}
+
+// editedContent returns the file content after applying a Write, Edit, or
+// MultiEdit tool input to before. Edits whose old_string is not found leave
+// the content unchanged, as the tool itself would fail.
+func editedContent(toolName string, input map[string]any, before string) string {
+	switch toolName {
+	case "Write":
+		content, _ := input["content"].(string)
+		return content
+	case "Edit":
+		return applyEdit(before, input)
+	case "MultiEdit":
+		edits, _ := input["edits"].([]any)
+		content := before
+		for _, edit := range edits {
+			if fields, ok := edit.(map[string]any); ok {
+				content = applyEdit(content, fields)
+			}
+		}
+		return content
+	}
+	return before
+}
+
+// applyEdit replaces old_string with new_string in content, every occurrence
+// when replace_all is set and the first otherwise.
+func applyEdit(content string, edit map[string]any) string {
+	oldString, _ := edit["old_string"].(string)
+	newString, _ := edit["new_string"].(string)
+	if oldString == "" {
+		return content
+	}
+	if replaceAll, _ := edit["replace_all"].(bool); replaceAll {
+		return strings.ReplaceAll(content, oldString, newString)
+	}
+	return strings.Replace(content, oldString, newString, 1)
+}
+
 // hasSdkMcpServers checks if any SDK MCP servers are configured.
 // Returns true if at least one SDK server with a valid Instance exists.
 func (t *Transport) hasSdkMcpServers() bool {
@@ -221,6 +536,9 @@ func (t *Transport) hasSdkMcpServers() bool {
 // This extracts environment setup logic from Connect to reduce cyclomatic complexity.
 func (t *Transport) buildEnvironment() []string {
 	env := os.Environ()
+	if t.options != nil && t.options.CleanEnv {
+		env = minimalEnvironment(env)
+	}
 
 	// Set entrypoint to identify SDK to CLI
 	env = append(env, "CLAUDE_CODE_ENTRYPOINT="+t.entrypoint)
@@ -230,6 +548,20 @@ func (t *Transport) buildEnvironment() []string {
 		env = append(env, "CLAUDE_CODE_ENABLE_SDK_FILE_CHECKPOINTING=true")
 	}
 
+	// Bound MCP server startup in the CLI (milliseconds)
+	if t.options != nil && t.options.McpServerStartupTimeout > 0 {
+		env = append(env, fmt.Sprintf("MCP_TIMEOUT=%d", t.options.McpServerStartupTimeout.Milliseconds()))
+	}
+
+	// Prompt caching; later entries override the host value
+	if t.options != nil && t.options.PromptCaching != nil {
+		if *t.options.PromptCaching {
+			env = append(env, "DISABLE_PROMPT_CACHING=0")
+		} else {
+			env = append(env, "DISABLE_PROMPT_CACHING=1")
+		}
+	}
+
 	// Add user-specified environment variables
 	if t.options != nil && t.options.ExtraEnv != nil {
 		for key, value := range t.options.ExtraEnv {
@@ -240,6 +572,19 @@ func (t *Transport) buildEnvironment() []string {
 	return env
 }
 
+// minimalEnvironment returns only the PATH entries of a host environment,
+// so the CLI can still locate its runtime without inheriting other variables.
+func minimalEnvironment(hostEnv []string) []string {
+	env := make([]string, 0, 1)
+	for _, entry := range hostEnv {
+		key, _, _ := strings.Cut(entry, "=")
+		if strings.EqualFold(key, "PATH") {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
 // prepareMcpConfig generates MCP config file if needed and returns modified options.
 // Returns the original options unchanged if no MCP servers are configured.
 func (t *Transport) prepareMcpConfig() (*shared.Options, error) {
@@ -267,10 +612,12 @@ func (t *Transport) prepareMcpConfig() (*shared.Options, error) {
 	return &optsCopy, nil
 }
 
-// emitCLIVersionWarning performs a non-blocking CLI version check and emits
-// a warning via StderrCallback if the CLI version is outdated.
+// emitCLIVersionWarning performs a non-blocking CLI version check, recording
+// the version for CLIVersion, and emits a warning via StderrCallback if the
+// CLI version is outdated.
 func (t *Transport) emitCLIVersionWarning(ctx context.Context) {
-	if warning := cli.CheckCLIVersion(ctx, t.cliPath); warning != "" {
+	t.cliVersion = cli.DetectCLIVersion(ctx, t.cliPath)
+	if warning := cli.CLIVersionWarning(t.cliVersion); warning != "" {
 		if t.options != nil && t.options.StderrCallback != nil {
 			t.options.StderrCallback(warning)
 		}
@@ -3,12 +3,17 @@ package subprocess
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/severity1/claude-agent-sdk-go/internal/control"
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
@@ -116,6 +121,33 @@ func TestSubprocessEnvironmentVariables(t *testing.T) {
 				assertEnvContains(t, env, "CLAUDE_CODE_ENTRYPOINT=sdk-go")
 			},
 		},
+		{
+			name: "mcp_startup_timeout_in_milliseconds",
+			options: &shared.Options{
+				McpServerStartupTimeout: 15 * time.Second,
+			},
+			validate: func(t *testing.T, env []string) {
+				assertEnvContains(t, env, "MCP_TIMEOUT=15000")
+			},
+		},
+		{
+			name: "prompt_caching_disabled",
+			options: &shared.Options{
+				PromptCaching: boolPtr(false),
+			},
+			validate: func(t *testing.T, env []string) {
+				assertEnvContains(t, env, "DISABLE_PROMPT_CACHING=1")
+			},
+		},
+		{
+			name: "prompt_caching_enabled",
+			options: &shared.Options{
+				PromptCaching: boolPtr(true),
+			},
+			validate: func(t *testing.T, env []string) {
+				assertEnvContains(t, env, "DISABLE_PROMPT_CACHING=0")
+			},
+		},
 		{
 			name: "proxy_configuration_example",
 			options: &shared.Options{
@@ -286,6 +318,46 @@ func TestTransportMcpServerConfiguration(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "websocket_server_serialized",
+			setup: func() *Transport {
+				options := &shared.Options{
+					McpServers: map[string]shared.McpServerConfig{
+						"ws-server": &shared.McpWebSocketServerConfig{
+							Type:    shared.McpServerTypeWebSocket,
+							URL:     "wss://mcp.example.com/ws",
+							Headers: map[string]string{"Authorization": "Bearer token"},
+						},
+					},
+				}
+				return New(newTransportMockCLI(), options, false, "sdk-go")
+			},
+			validate: func(t *testing.T, transport *Transport) {
+				t.Helper()
+				if transport.mcpConfigFile == nil {
+					t.Fatal("Expected MCP config file to be generated")
+				}
+				configData, err := os.ReadFile(transport.mcpConfigFile.Name())
+				if err != nil {
+					t.Fatalf("Failed to read MCP config file: %v", err)
+				}
+
+				var config struct {
+					McpServers map[string]map[string]any `json:"mcpServers"`
+				}
+				if err := json.Unmarshal(configData, &config); err != nil {
+					t.Fatalf("MCP config is not valid JSON: %v", err)
+				}
+				expected := map[string]any{
+					"type":    "ws",
+					"url":     "wss://mcp.example.com/ws",
+					"headers": map[string]any{"Authorization": "Bearer token"},
+				}
+				if got := config.McpServers["ws-server"]; !reflect.DeepEqual(got, expected) {
+					t.Errorf("Expected ws-server config %v, got %v", expected, got)
+				}
+			},
+		},
 		{
 			name: "mcp_config_file_cleaned_up",
 			setup: func() *Transport {
@@ -407,3 +479,618 @@ func assertEnvContains(t *testing.T, env []string, expected string) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// TestAgentToolAllowlistPermission tests subagents are denied tools outside their definition
+func TestAgentToolAllowlistPermission(t *testing.T) {
+	agents := map[string]shared.AgentDefinition{
+		"reviewer": {Description: "Reviews code", Prompt: "Review", Tools: []string{"Read", "Bash(git:*)"}},
+		"general":  {Description: "Does anything", Prompt: "Help"},
+	}
+
+	tests := []struct {
+		name        string
+		canUseTool  bool
+		agentID     string
+		toolName    string
+		wantAllowed bool
+		wantUser    bool
+		wantDeny    string // Substring of the deny message when not allowed
+	}{
+		{"subagent_tool_outside_list_denied", false, "reviewer", "Write", false, false, "agent reviewer"},
+		{"subagent_tool_in_list_delegates_to_user_callback", true, "reviewer", "Read", true, true, ""},
+		{"rule_specifier_matches_tool_name", true, "reviewer", "Bash", true, true, ""},
+		{"agent_without_tools_unrestricted", true, "general", "Write", true, true, ""},
+		{"main_agent_unrestricted", true, "", "Write", true, true, ""},
+		{"unknown_agent_denied", false, "other", "Write", false, false, "agent other is not defined"},
+		{"unknown_agent_denied_before_user_callback", true, "other", "Read", false, false, "agent other is not defined"},
+		{"denied_before_user_callback", true, "reviewer", "Write", false, false, "agent reviewer"},
+		{"enforcement_only_does_not_allow_listed_tool", false, "reviewer", "Read", false, false, "no permission callback"},
+		{"enforcement_only_does_not_allow_main_agent", false, "", "Write", false, false, "no permission callback"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userCalled := false
+			options := &shared.Options{Agents: agents, EnforceAgentToolAllowlist: true}
+			if test.canUseTool {
+				options.CanUseTool = func(context.Context, string, map[string]any, any) (any, error) {
+					userCalled = true
+					return control.NewPermissionResultAllow(), nil
+				}
+			}
+			transport := &Transport{options: options}
+
+			callback := transport.permissionCallback()
+			if callback == nil {
+				t.Fatal("Expected permission callback when allowlist enforcement is enabled")
+			}
+			result, err := callback(context.Background(), test.toolName, map[string]any{},
+				control.ToolPermissionContext{AgentID: test.agentID})
+			assertNoTransportError(t, err)
+
+			_, allowed := result.(control.PermissionResultAllow)
+			if allowed != test.wantAllowed {
+				t.Errorf("Expected allowed=%v, got %#v", test.wantAllowed, result)
+			}
+			if userCalled != test.wantUser {
+				t.Errorf("Expected user callback called=%v, got %v", test.wantUser, userCalled)
+			}
+			if deny, ok := result.(control.PermissionResultDeny); ok && !strings.Contains(deny.Message, test.wantDeny) {
+				t.Errorf("Expected deny message containing %q, got %q", test.wantDeny, deny.Message)
+			}
+		})
+	}
+
+	t.Run("no_callback_without_enforcement", func(t *testing.T) {
+		transport := &Transport{options: &shared.Options{Agents: agents}}
+		if transport.permissionCallback() != nil {
+			t.Error("Expected no permission callback without CanUseTool or enforcement")
+		}
+		if transport.needsProtocolHandshake() {
+			t.Error("Expected no handshake without CanUseTool or enforcement")
+		}
+	})
+}
+
+// TestToolApprovalCachePermission tests repeated identical requests reuse
+// the cached decision instead of calling CanUseTool again
+func TestToolApprovalCachePermission(t *testing.T) {
+	var calls []string
+	var fail bool
+	options := &shared.Options{
+		ToolApprovalCache: shared.NewToolApprovalCache(),
+		CanUseTool: func(_ context.Context, toolName string, input map[string]any, _ any) (any, error) {
+			calls = append(calls, toolName)
+			if fail {
+				return nil, errors.New("prompt failed")
+			}
+			if input["command"] == "rm -rf build" {
+				return control.NewPermissionResultDeny("no deleting"), nil
+			}
+			return control.NewPermissionResultAllow(), nil
+		},
+	}
+	callback := (&Transport{options: options}).permissionCallback()
+	ask := func(toolName string, input map[string]any) control.PermissionResult {
+		t.Helper()
+		result, err := callback(context.Background(), toolName, input, control.ToolPermissionContext{})
+		assertNoTransportError(t, err)
+		return result
+	}
+
+	ask("Read", map[string]any{"file_path": "a.go", "limit": 10})
+	if _, ok := ask("Read", map[string]any{"limit": 10, "file_path": "a.go"}).(control.PermissionResultAllow); !ok {
+		t.Error("Expected cached allow for an identical Read")
+	}
+	ask("Bash", map[string]any{"command": "rm -rf build"})
+	deny, ok := ask("Bash", map[string]any{"command": "rm -rf build"}).(control.PermissionResultDeny)
+	if !ok || deny.Message != "no deleting" {
+		t.Errorf("Expected cached deny for an identical Bash, got %#v", deny)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 CanUseTool calls for repeated requests, got %v", calls)
+	}
+
+	// Different input and different tool are decided again
+	ask("Read", map[string]any{"file_path": "b.go"})
+	ask("Write", map[string]any{"file_path": "a.go", "limit": 10})
+	if len(calls) != 4 {
+		t.Errorf("Expected new requests to reach CanUseTool, got %v", calls)
+	}
+
+	// Errors are not cached
+	fail = true
+	for i := 0; i < 2; i++ {
+		if _, err := callback(context.Background(), "Glob", map[string]any{}, control.ToolPermissionContext{}); err == nil {
+			t.Error("Expected CanUseTool error to be returned")
+		}
+	}
+	if len(calls) != 6 {
+		t.Errorf("Expected failed decisions not to be cached, got %v", calls)
+	}
+
+	// Cleared decisions are asked again
+	fail = false
+	options.ToolApprovalCache.Clear()
+	ask("Read", map[string]any{"file_path": "a.go", "limit": 10})
+	if len(calls) != 7 {
+		t.Errorf("Expected CanUseTool after Clear, got %v", calls)
+	}
+}
+
+// TestEditConfirmationPermission tests file edits are confirmed from a diff
+// against the current file before reaching CanUseTool
+func TestEditConfirmationPermission(t *testing.T) {
+	dir := t.TempDir()
+	assertNoTransportError(t, os.WriteFile(filepath.Join(dir, "main.go"),
+		[]byte("package main\n\nfunc main() {}\n"), 0o600))
+
+	type confirmation struct{ path, diff string }
+	var confirmations []confirmation
+	var userCalls []string
+	approve := true
+	options := &shared.Options{
+		Cwd: &dir,
+		EditConfirmation: func(path, diff string) bool {
+			confirmations = append(confirmations, confirmation{path, diff})
+			return approve
+		},
+		CanUseTool: func(_ context.Context, toolName string, _ map[string]any, _ any) (any, error) {
+			userCalls = append(userCalls, toolName)
+			return control.NewPermissionResultAllow(), nil
+		},
+	}
+	transport := &Transport{options: options}
+	if !transport.needsProtocolHandshake() {
+		t.Error("Expected EditConfirmation to require the protocol handshake")
+	}
+	callback := transport.permissionCallback()
+	ask := func(toolName string, input map[string]any) control.PermissionResult {
+		t.Helper()
+		result, err := callback(context.Background(), toolName, input, control.ToolPermissionContext{})
+		assertNoTransportError(t, err)
+		return result
+	}
+
+	writeInput := map[string]any{"file_path": "main.go", "content": "package main\n\nfunc main() { run() }\n"}
+	wantDiff := "--- main.go\n+++ main.go\n@@ -1,3 +1,3 @@\n package main\n \n-func main() {}\n+func main() { run() }\n"
+
+	t.Run("write_blocked", func(t *testing.T) {
+		confirmations, userCalls, approve = nil, nil, false
+		deny, ok := ask("Write", writeInput).(control.PermissionResultDeny)
+		if !ok || !strings.Contains(deny.Message, "not approved") {
+			t.Fatalf("Expected rejected Write to be denied, got %#v", deny)
+		}
+		if len(confirmations) != 1 || confirmations[0].path != "main.go" || confirmations[0].diff != wantDiff {
+			t.Errorf("Expected confirmation with diff:\n%s\ngot %+v", wantDiff, confirmations)
+		}
+		if len(userCalls) != 0 {
+			t.Errorf("Expected rejected edit not to reach CanUseTool, got %v", userCalls)
+		}
+	})
+
+	t.Run("write_approved_reaches_can_use_tool", func(t *testing.T) {
+		confirmations, userCalls, approve = nil, nil, true
+		if _, ok := ask("Write", writeInput).(control.PermissionResultAllow); !ok {
+			t.Error("Expected approved Write to be allowed")
+		}
+		if len(confirmations) != 1 || len(userCalls) != 1 {
+			t.Errorf("Expected one confirmation and one CanUseTool call, got %d and %v", len(confirmations), userCalls)
+		}
+	})
+
+	t.Run("edit_and_new_file", func(t *testing.T) {
+		confirmations, approve = nil, true
+		ask("Edit", map[string]any{"file_path": "main.go", "old_string": "{}", "new_string": "{ run() }"})
+		ask("Write", map[string]any{"file_path": filepath.Join(dir, "new.go"), "content": "package main\n"})
+		if len(confirmations) != 2 || confirmations[0].diff != wantDiff {
+			t.Fatalf("Expected Edit diff:\n%s\ngot %+v", wantDiff, confirmations)
+		}
+		if !strings.Contains(confirmations[1].diff, "@@ -0,0 +1,1 @@\n+package main\n") {
+			t.Errorf("Expected new file diffed against empty content, got %q", confirmations[1].diff)
+		}
+	})
+
+	t.Run("other_tools_not_confirmed", func(t *testing.T) {
+		confirmations, approve = nil, false
+		if _, ok := ask("Read", map[string]any{"file_path": "main.go"}).(control.PermissionResultAllow); !ok {
+			t.Error("Expected Read to bypass edit confirmation")
+		}
+		if len(confirmations) != 0 {
+			t.Errorf("Expected no confirmation for Read, got %+v", confirmations)
+		}
+	})
+
+	t.Run("confirmation_alone", func(t *testing.T) {
+		approve := true
+		options := &shared.Options{Cwd: &dir, EditConfirmation: func(string, string) bool { return approve }}
+		callback := (&Transport{options: options}).permissionCallback()
+		ask := func(toolName string, input map[string]any) control.PermissionResult {
+			t.Helper()
+			result, err := callback(context.Background(), toolName, input, control.ToolPermissionContext{})
+			assertNoTransportError(t, err)
+			return result
+		}
+
+		if _, ok := ask("Write", writeInput).(control.PermissionResultAllow); !ok {
+			t.Error("Expected a confirmed Write to be allowed without CanUseTool")
+		}
+		approve = false
+		if _, ok := ask("Write", writeInput).(control.PermissionResultDeny); !ok {
+			t.Error("Expected a rejected Write to be denied")
+		}
+		for _, toolName := range []string{"Bash", "Read", "WebFetch"} {
+			if _, ok := ask(toolName, map[string]any{}).(control.PermissionResultDeny); !ok {
+				t.Errorf("Expected %s not to be auto-allowed when only EditConfirmation is set", toolName)
+			}
+		}
+	})
+
+	t.Run("panic_rejects", func(t *testing.T) {
+		options := &shared.Options{EditConfirmation: func(string, string) bool { panic("boom") }}
+		result, err := (&Transport{options: options}).permissionCallback()(context.Background(), "Write",
+			map[string]any{"file_path": filepath.Join(dir, "x.go"), "content": "x"}, control.ToolPermissionContext{})
+		assertNoTransportError(t, err)
+		if _, ok := result.(control.PermissionResultDeny); !ok {
+			t.Errorf("Expected panicking confirmation to deny, got %#v", result)
+		}
+	})
+}
+
+// TestPlanProposalPermission tests ExitPlanMode requests are decided by
+// OnPlanProposal and the decision is sent back to the CLI
+func TestPlanProposalPermission(t *testing.T) {
+	planInput := map[string]any{"plan": "1. Add tests\n2. Fix the bug"}
+
+	tests := []struct {
+		name         string
+		decide       func(*shared.PlanProposal) bool
+		wantBehavior string
+	}{
+		{"approved", func(*shared.PlanProposal) bool { return true }, "allow"},
+		{"rejected", func(*shared.PlanProposal) bool { return false }, "deny"},
+		{"panic_rejects", func(*shared.PlanProposal) bool { panic("boom") }, "deny"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+			defer cancel()
+
+			var proposals []shared.PlanProposal
+			var userCalls []string
+			options := &shared.Options{
+				OnPlanProposal: func(p *shared.PlanProposal) bool {
+					proposals = append(proposals, *p)
+					return test.decide(p)
+				},
+				CanUseTool: func(_ context.Context, toolName string, _ map[string]any, _ any) (any, error) {
+					userCalls = append(userCalls, toolName)
+					return control.NewPermissionResultAllow(), nil
+				},
+			}
+			transport := &Transport{options: options}
+			if !transport.needsProtocolHandshake() {
+				t.Error("Expected OnPlanProposal to require the protocol handshake")
+			}
+
+			// Route a CLI permission request through the control protocol
+			var written strings.Builder
+			protocol := control.NewProtocol(NewProtocolAdapter(&written), transport.buildProtocolOptions()...)
+			assertNoTransportError(t, protocol.Start(ctx))
+			defer func() { _ = protocol.Close() }()
+
+			err := protocol.HandleIncomingMessage(ctx, map[string]any{
+				"type":       control.MessageTypeControlRequest,
+				"request_id": "req_plan_1",
+				"request": map[string]any{
+					"subtype":   control.SubtypeCanUseTool,
+					"tool_name": "ExitPlanMode",
+					"input":     planInput,
+					"agent_id":  "planner",
+				},
+			})
+			assertNoTransportError(t, err)
+
+			var resp control.SDKControlResponse
+			assertNoTransportError(t, json.Unmarshal([]byte(written.String()), &resp))
+			data, _ := resp.Response.Response.(map[string]any)
+			if resp.Response.RequestID != "req_plan_1" || data["behavior"] != test.wantBehavior {
+				t.Fatalf("Expected %s response for req_plan_1, got %s", test.wantBehavior, written.String())
+			}
+			if test.wantBehavior == "deny" && !strings.Contains(fmt.Sprint(data["message"]), "not approved") {
+				t.Errorf("Expected rejection message, got %v", data["message"])
+			}
+
+			if len(proposals) != 1 {
+				t.Fatalf("Expected 1 plan proposal, got %d", len(proposals))
+			}
+			if proposals[0].Plan != "1. Add tests\n2. Fix the bug" || proposals[0].AgentID != "planner" {
+				t.Errorf("Unexpected proposal: %+v", proposals[0])
+			}
+			if len(userCalls) != 0 {
+				t.Errorf("Expected ExitPlanMode not to reach CanUseTool, got %v", userCalls)
+			}
+		})
+	}
+
+	t.Run("other_tools_use_can_use_tool", func(t *testing.T) {
+		planCalled, userCalled := false, false
+		options := &shared.Options{
+			OnPlanProposal: func(*shared.PlanProposal) bool { planCalled = true; return true },
+			CanUseTool: func(context.Context, string, map[string]any, any) (any, error) {
+				userCalled = true
+				return control.NewPermissionResultDeny("no"), nil
+			},
+		}
+		callback := (&Transport{options: options}).permissionCallback()
+		result, err := callback(context.Background(), "Bash", map[string]any{}, control.ToolPermissionContext{})
+		assertNoTransportError(t, err)
+		if _, denied := result.(control.PermissionResultDeny); !denied || !userCalled || planCalled {
+			t.Errorf("Expected Bash decided by CanUseTool only, got %#v", result)
+		}
+	})
+
+	t.Run("plan_callback_alone_intercepts_only_exit_plan_mode", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+		defer cancel()
+
+		planCalled := false
+		options := &shared.Options{OnPlanProposal: func(*shared.PlanProposal) bool { planCalled = true; return true }}
+		transport := &Transport{options: options}
+
+		var written strings.Builder
+		protocol := control.NewProtocol(NewProtocolAdapter(&written), transport.buildProtocolOptions()...)
+		assertNoTransportError(t, protocol.Start(ctx))
+		defer func() { _ = protocol.Close() }()
+
+		err := protocol.HandleIncomingMessage(ctx, map[string]any{
+			"type":       control.MessageTypeControlRequest,
+			"request_id": "req_write_1",
+			"request": map[string]any{
+				"subtype":   control.SubtypeCanUseTool,
+				"tool_name": "Write",
+				"input":     map[string]any{"file_path": "main.go", "content": "x"},
+			},
+		})
+		assertNoTransportError(t, err)
+
+		var resp control.SDKControlResponse
+		assertNoTransportError(t, json.Unmarshal([]byte(written.String()), &resp))
+		data, _ := resp.Response.Response.(map[string]any)
+		if data["behavior"] != "deny" {
+			t.Errorf("Expected Write denied when only OnPlanProposal is set, got %s", written.String())
+		}
+		if planCalled {
+			t.Error("Expected Write not to reach OnPlanProposal")
+		}
+	})
+
+	t.Run("plan_callback_alone_does_not_allow_other_tools", func(t *testing.T) {
+		options := &shared.Options{OnPlanProposal: func(*shared.PlanProposal) bool { return true }}
+		callback := (&Transport{options: options}).permissionCallback()
+		if callback == nil {
+			t.Fatal("Expected permission callback when OnPlanProposal is set")
+		}
+		result, err := callback(context.Background(), "Bash", map[string]any{"command": "rm -rf build"},
+			control.ToolPermissionContext{})
+		assertNoTransportError(t, err)
+		if _, denied := result.(control.PermissionResultDeny); !denied {
+			t.Errorf("Expected Bash denied without CanUseTool, got %#v", result)
+		}
+	})
+}
+
+// TestSetAllowedTools tests tools removed mid-session are denied on subsequent permission requests
+func TestSetAllowedTools(t *testing.T) {
+	ctx := context.Background()
+	var userCalls []string
+	options := &shared.Options{
+		CanUseTool: func(_ context.Context, toolName string, _ map[string]any, _ any) (any, error) {
+			userCalls = append(userCalls, toolName)
+			return control.NewPermissionResultAllow(), nil
+		},
+	}
+	transport := &Transport{options: options, connected: true}
+	transport.protocol = control.NewProtocol(nil)
+
+	callback := transport.permissionCallback()
+	requestTool := func(toolName string) bool {
+		t.Helper()
+		result, err := callback(ctx, toolName, map[string]any{}, control.ToolPermissionContext{})
+		assertNoTransportError(t, err)
+		_, allowed := result.(control.PermissionResultAllow)
+		return allowed
+	}
+
+	// Unrestricted until SetAllowedTools is called
+	if !requestTool("Write") {
+		t.Error("Expected Write to be allowed before SetAllowedTools")
+	}
+
+	tools := []string{"Read", "Bash(git:*)"}
+	assertNoTransportError(t, transport.SetAllowedTools(ctx, tools))
+	tools[0] = "Write" // Caller's slice is copied
+
+	for _, test := range []struct {
+		toolName    string
+		wantAllowed bool
+	}{
+		{"Read", true},
+		{"Bash", true},
+		{"Write", false},
+		{"Edit", false},
+	} {
+		if got := requestTool(test.toolName); got != test.wantAllowed {
+			t.Errorf("Expected %s allowed=%v, got %v", test.toolName, test.wantAllowed, got)
+		}
+	}
+	if want := []string{"Write", "Read", "Bash"}; !reflect.DeepEqual(userCalls, want) {
+		t.Errorf("Expected user callback only for in-scope tools %v, got %v", want, userCalls)
+	}
+
+	result, _ := callback(ctx, "Write", map[string]any{}, control.ToolPermissionContext{})
+	if deny, ok := result.(control.PermissionResultDeny); !ok || !strings.Contains(deny.Message, "Write") {
+		t.Errorf("Expected deny message naming Write, got %#v", result)
+	}
+
+	// Empty list denies everything; nil restores the default
+	assertNoTransportError(t, transport.SetAllowedTools(ctx, []string{}))
+	if requestTool("Read") {
+		t.Error("Expected Read to be denied with an empty allowed list")
+	}
+	assertNoTransportError(t, transport.SetAllowedTools(ctx, nil))
+	if !requestTool("Write") {
+		t.Error("Expected Write to be allowed after clearing the restriction")
+	}
+
+	t.Run("requires_permission_callback", func(t *testing.T) {
+		transport := &Transport{options: &shared.Options{}, connected: true, protocol: control.NewProtocol(nil)}
+		err := transport.SetAllowedTools(ctx, []string{"Read"})
+		if err == nil || !strings.Contains(err.Error(), "WithCanUseTool") {
+			t.Errorf("Expected error naming WithCanUseTool, got %v", err)
+		}
+	})
+
+	t.Run("not_connected", func(t *testing.T) {
+		transport := &Transport{options: options}
+		if err := transport.SetAllowedTools(ctx, []string{"Read"}); err == nil {
+			t.Error("Expected error when not connected")
+		}
+	})
+
+	t.Run("one_shot_mode", func(t *testing.T) {
+		transport := &Transport{options: options, connected: true, closeStdin: true}
+		if err := transport.SetAllowedTools(ctx, []string{"Read"}); err == nil {
+			t.Error("Expected error in one-shot mode")
+		}
+	})
+}
+
+// TestToolNameNormalizationPermission tests differently formatted MCP tool
+// names match allowlists when normalization is enabled
+func TestToolNameNormalizationPermission(t *testing.T) {
+	ctx := context.Background()
+	agents := map[string]shared.AgentDefinition{
+		"searcher": {Description: "Searches", Prompt: "Search", Tools: []string{"mcp__my-server__search"}},
+	}
+
+	newCallback := func(t *testing.T, normalize bool, userCalls *[]string) (*Transport, control.CanUseToolCallback) {
+		t.Helper()
+		options := &shared.Options{
+			AllowedTools:              []string{"mcp__Docs-Server__get_page"},
+			DisallowedTools:           []string{"mcp__my-server__delete"},
+			Agents:                    agents,
+			EnforceAgentToolAllowlist: true,
+			ToolNameNormalization:     normalize,
+			CanUseTool: func(_ context.Context, toolName string, _ map[string]any, _ any) (any, error) {
+				*userCalls = append(*userCalls, toolName)
+				return control.NewPermissionResultDeny("user denied"), nil
+			},
+		}
+		transport := &Transport{options: options, connected: true, protocol: control.NewProtocol(nil)}
+		return transport, transport.permissionCallback()
+	}
+	request := func(t *testing.T, callback control.CanUseToolCallback, toolName, agentID string) bool {
+		t.Helper()
+		result, err := callback(ctx, toolName, map[string]any{}, control.ToolPermissionContext{AgentID: agentID})
+		assertNoTransportError(t, err)
+		_, allowed := result.(control.PermissionResultAllow)
+		return allowed
+	}
+
+	t.Run("equivalent_names_match", func(t *testing.T) {
+		var userCalls []string
+		transport, callback := newCallback(t, true, &userCalls)
+
+		if !request(t, callback, "mcp__docs_server__get_page", "") {
+			t.Error("Expected tool in AllowedTools to be allowed despite formatting")
+		}
+		if request(t, callback, "mcp__My_Server__delete", "") {
+			t.Error("Expected tool in DisallowedTools to be denied despite formatting")
+		}
+		if request(t, callback, "mcp__my_server__search", "searcher") {
+			t.Error("Expected in-list agent tool to reach the user callback, which denies")
+		}
+		if request(t, callback, "mcp__my_server__index", "searcher") {
+			t.Error("Expected agent tool outside its list to be denied")
+		}
+
+		assertNoTransportError(t, transport.SetAllowedTools(ctx, []string{"mcp__Docs.Server__get_page"}))
+		if !request(t, callback, "mcp__docs-server__get_page", "") {
+			t.Error("Expected SetAllowedTools scope to match despite formatting")
+		}
+		if request(t, callback, "mcp__my_server__search", "") {
+			t.Error("Expected tool outside SetAllowedTools scope to be denied")
+		}
+
+		// Only the in-list agent tool reached the user callback, normalized
+		if want := []string{"mcp__my_server__search"}; !reflect.DeepEqual(userCalls, want) {
+			t.Errorf("Expected user callback calls %v, got %v", want, userCalls)
+		}
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		var userCalls []string
+		_, callback := newCallback(t, false, &userCalls)
+
+		if request(t, callback, "mcp__docs_server__get_page", "") {
+			t.Error("Expected differently formatted name to reach the user callback, which denies")
+		}
+		if request(t, callback, "mcp__my_server__search", "searcher") {
+			t.Error("Expected differently formatted agent tool to be denied")
+		}
+		if want := []string{"mcp__docs_server__get_page"}; !reflect.DeepEqual(userCalls, want) {
+			t.Errorf("Expected tool names passed unchanged %v, got %v", want, userCalls)
+		}
+	})
+}
+
+// TestCleanEnvironment tests host variables are not inherited with CleanEnv
+func TestCleanEnvironment(t *testing.T) {
+	t.Setenv("SDK_TEST_HOST_SECRET", "s3cret")
+
+	t.Run("inherits_host_by_default", func(t *testing.T) {
+		transport := New("echo", &shared.Options{}, true, "sdk-go")
+		assertEnvContains(t, transport.buildEnvironment(), "SDK_TEST_HOST_SECRET=s3cret")
+	})
+
+	t.Run("clean_env_drops_host_vars", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := New("echo", &shared.Options{
+			CleanEnv:                true,
+			EnableFileCheckpointing: true,
+			ExtraEnv:                map[string]string{"ANTHROPIC_API_KEY": "explicit"},
+		}, true, "sdk-go")
+		defer func() {
+			if transport.IsConnected() {
+				_ = transport.Close()
+			}
+		}()
+		assertNoTransportError(t, transport.Connect(ctx))
+
+		env := transport.cmd.Env
+		for _, entry := range env {
+			if strings.HasPrefix(entry, "SDK_TEST_HOST_SECRET=") {
+				t.Errorf("Expected host variable to be absent, got %s", entry)
+			}
+		}
+		assertEnvContains(t, env, "ANTHROPIC_API_KEY=explicit")
+		assertEnvContains(t, env, "CLAUDE_CODE_ENTRYPOINT=sdk-go")
+		assertEnvContains(t, env, "CLAUDE_CODE_ENABLE_SDK_FILE_CHECKPOINTING=true")
+		if path := os.Getenv("PATH"); path != "" && runtime.GOOS != windowsOS {
+			assertEnvContains(t, env, "PATH="+path)
+		}
+
+		// Only PATH, SDK-set, and explicit variables remain
+		if len(env) > 4 {
+			t.Errorf("Expected a minimal environment, got %v", env)
+		}
+	})
+}
@@ -2,21 +2,38 @@ package subprocess
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/severity1/claude-agent-sdk-go/internal/control"
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
 // handleStdout processes stdout in a separate goroutine
 func (t *Transport) handleStdout() {
 	defer t.wg.Done()
+	defer close(t.stdoutDone)
 	defer close(t.msgChan)
 	defer close(t.errChan)
 	defer t.validator.MarkStreamEnd() // Mark stream end for validation
+	defer t.abandonTurns(errTurnNotCompleted)
 
-	scanner := bufio.NewScanner(t.stdout)
+	var stdout io.Reader = t.stdout
+	if t.options != nil && t.options.RawStdoutTee != nil {
+		stdout = io.TeeReader(t.stdout, &teeWriter{w: t.options.RawStdoutTee})
+	}
+	// The scanner splits on newline bytes only, so a multibyte UTF-8 rune
+	// split across pipe reads is reassembled before the line is decoded.
+	scanner := bufio.NewScanner(stdout)
 
 	// Increase scanner buffer to handle large tool results (files, etc.)
 	// Default bufio.Scanner has MaxScanTokenSize of 64KB which is insufficient
@@ -26,6 +43,9 @@ func (t *Transport) handleStdout() {
 	buf := make([]byte, maxScanTokenSize)
 	scanner.Buffer(buf, maxScanTokenSize)
 
+	pipeline := t.newMessagePipeline()
+
+	var outputBytes int64
 	for scanner.Scan() {
 		select {
 		case <-t.ctx.Done():
@@ -34,12 +54,17 @@ func (t *Transport) handleStdout() {
 		}
 
 		line := scanner.Text()
+		outputBytes += int64(len(line)) + 1 // Including the newline
+		if t.options != nil && t.options.MaxOutputBytes > 0 && outputBytes > t.options.MaxOutputBytes {
+			t.stopForOutputLimit(t.options.MaxOutputBytes)
+			return
+		}
 		if line == "" {
 			continue
 		}
 
 		// Parse line with the parser
-		messages, err := t.parser.ProcessLine(line)
+		messages, raws, err := t.parser.ProcessLineRaw(line)
 		if err != nil {
 			select {
 			case t.errChan <- err:
@@ -50,7 +75,7 @@ func (t *Transport) handleStdout() {
 		}
 
 		// Send parsed messages and track for validation
-		for _, msg := range messages {
+		for i, msg := range messages {
 			if msg == nil {
 				continue
 			}
@@ -67,12 +92,40 @@ func (t *Transport) handleStdout() {
 				continue
 			}
 
+			t.writeTranscript(raws[i])
+
 			// Track regular message for stream validation
 			t.validator.TrackMessage(msg)
+			t.trackToolNames(msg)
+			t.notifyThinking(msg)
+			t.notifyToolResults(msg)
+			t.notifyResultError(msg)
+			t.notifyToolsChanged(msg)
+			t.notifyResourceUpdate(msg)
+			t.notifyStreamEvent(msg)
+			if t.options != nil && t.options.ToolMetrics != nil {
+				t.options.ToolMetrics.Record(msg)
+			}
+			if queryID := t.currentQueryID(); queryID != "" {
+				shared.SetMessageQueryID(msg, queryID)
+			}
+			if t.options != nil && t.options.ResponseCollector != nil {
+				t.options.ResponseCollector.Record(msg)
+			}
 
-			select {
-			case t.msgChan <- msg:
-			case <-t.ctx.Done():
+			// A result message completes the active turn
+			if result, ok := msg.(*shared.ResultMessage); ok {
+				t.endTurn()
+				t.completeTurn(result)
+				if _, pending := t.currentTurn(); pending {
+					t.beginTurn()
+				}
+				if t.options != nil && t.options.CostTracker != nil {
+					t.options.CostTracker.Record(result)
+				}
+			}
+
+			if !pipeline.handle(msg) {
 				return
 			}
 		}
@@ -84,6 +137,248 @@ func (t *Transport) handleStdout() {
 		case <-t.ctx.Done():
 		}
 	}
+
+	// Stdout closed because the session deadline terminated the CLI
+	if atomic.LoadInt32(&t.sessionExpired) == 1 {
+		select {
+		case t.errChan <- shared.NewSessionExpiredError(t.options.MaxSessionDuration):
+		case <-t.ctx.Done():
+		}
+		return
+	}
+
+	// Stdout closed while a turn was active: the CLI exited before its result
+	if _, active := t.activeTurn(); active && t.ctx.Err() == nil {
+		t.validator.MarkUnexpectedEnd()
+	}
+}
+
+// messagePipeline passes messages through the configured middleware and
+// then the message filter to msgChan. Used only by handleStdout.
+type messagePipeline struct {
+	t       *Transport
+	handler shared.MessageHandler
+	passed  bool // The current message reached send
+	stopped bool // The context ended while sending
+}
+
+// newMessagePipeline creates the pipeline for the configured middleware.
+func (t *Transport) newMessagePipeline() *messagePipeline {
+	p := &messagePipeline{t: t}
+	p.handler = p.send
+	if t.options != nil {
+		p.handler = shared.ChainMessageMiddleware(p.send, t.options.MessageMiddleware...)
+	}
+	return p
+}
+
+// handle runs msg through the pipeline, reporting false once the context
+// has ended. If a middleware panics before passing msg on, msg is sent as is.
+func (p *messagePipeline) handle(msg shared.Message) bool {
+	p.passed = false
+	func() {
+		defer func() {
+			if r := recover(); r != nil && !p.passed {
+				p.send(msg)
+			}
+		}()
+		p.handler(msg)
+	}()
+	return !p.stopped
+}
+
+// send delivers msg to msgChan if it passes the message filter.
+func (p *messagePipeline) send(msg shared.Message) {
+	p.passed = true
+	if p.stopped || msg == nil || !p.t.deliverMessage(msg) {
+		return
+	}
+	select {
+	case p.t.msgChan <- msg:
+	case <-p.t.ctx.Done():
+		p.stopped = true
+	}
+}
+
+// stopForOutputLimit kills the CLI once its output exceeds limit bytes and
+// reports the error. Must be called from handleStdout.
+func (t *Transport) stopForOutputLimit(limit int64) {
+	t.debugf("CLI output exceeded %d bytes, killing CLI", limit)
+	if t.cmd != nil && t.cmd.Process != nil {
+		_ = t.killProcess(t.cmd.Process)
+	}
+	select {
+	case t.errChan <- shared.NewOutputLimitExceededError(limit):
+	case <-t.ctx.Done():
+	}
+}
+
+// teeWriter forwards writes to w until the first error, then discards them,
+// so a failing tee never interrupts reading the CLI's output.
+type teeWriter struct {
+	w      io.Writer
+	failed bool
+}
+
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	if !tw.failed {
+		if _, err := tw.w.Write(p); err != nil {
+			tw.failed = true
+		}
+	}
+	return len(p), nil
+}
+
+// writeTranscript appends a received message to the transcript writer, if one
+// is configured. Write errors are ignored so a failing transcript never
+// interrupts the message stream.
+func (t *Transport) writeTranscript(raw string) {
+	if t.options == nil || t.options.TranscriptWriter == nil {
+		return
+	}
+	_, _ = io.WriteString(t.options.TranscriptWriter, raw+"\n")
+}
+
+// notifyThinking passes each thinking block of an assistant message to the
+// OnThinking callback.
+func (t *Transport) notifyThinking(msg shared.Message) {
+	if t.options == nil || t.options.OnThinking == nil {
+		return
+	}
+	assistant, ok := msg.(*shared.AssistantMessage)
+	if !ok {
+		return
+	}
+	for _, block := range assistant.Content {
+		if thinking, ok := block.(*shared.ThinkingBlock); ok {
+			shared.SafeCallback(func() { t.options.OnThinking(thinking) })
+		}
+	}
+}
+
+// notifyToolResults passes each tool result block of a user message to the
+// OnToolResult callback.
+func (t *Transport) notifyToolResults(msg shared.Message) {
+	if t.options == nil || t.options.OnToolResult == nil {
+		return
+	}
+	user, ok := msg.(*shared.UserMessage)
+	if !ok {
+		return
+	}
+	blocks, _ := user.Content.([]shared.ContentBlock)
+	for _, block := range blocks {
+		if result, ok := block.(*shared.ToolResultBlock); ok {
+			shared.SafeCallback(func() { t.options.OnToolResult(result) })
+		}
+	}
+}
+
+// notifyResultError passes a result message ending its turn in an error to
+// the OnResultError callback.
+func (t *Transport) notifyResultError(msg shared.Message) {
+	if t.options == nil || t.options.OnResultError == nil {
+		return
+	}
+	result, ok := msg.(*shared.ResultMessage)
+	if !ok || !result.IsError {
+		return
+	}
+	shared.SafeCallback(func() { t.options.OnResultError(result) })
+}
+
+// notifyToolsChanged passes the tool list of a system message to the
+// OnToolsChanged callback when it is the first list seen or differs from the
+// previous one. Must be called from handleStdout.
+func (t *Transport) notifyToolsChanged(msg shared.Message) {
+	if t.options == nil || t.options.OnToolsChanged == nil {
+		return
+	}
+	system, ok := msg.(*shared.SystemMessage)
+	if !ok {
+		return
+	}
+	tools, ok := shared.ToolsFromSystemMessage(system)
+	if !ok {
+		return
+	}
+	if t.toolList != nil && sameTools(t.toolList, tools) {
+		return
+	}
+	t.toolList = tools
+
+	shared.SafeCallback(func() { t.options.OnToolsChanged(append([]shared.ToolInfo(nil), tools...)) })
+}
+
+// notifyResourceUpdate passes the resource update carried by a system
+// message to the OnResourceUpdate callback.
+func (t *Transport) notifyResourceUpdate(msg shared.Message) {
+	if t.options == nil || t.options.OnResourceUpdate == nil {
+		return
+	}
+	system, ok := msg.(*shared.SystemMessage)
+	if !ok {
+		return
+	}
+	update, ok := shared.ResourceUpdateFromSystemMessage(system)
+	if !ok {
+		return
+	}
+	shared.SafeCallback(func() { t.options.OnResourceUpdate(update) })
+}
+
+// notifyStreamEvent passes a decoded stream event to the OnStreamEvent
+// callback.
+func (t *Transport) notifyStreamEvent(msg shared.Message) {
+	if t.options == nil || t.options.OnStreamEvent == nil {
+		return
+	}
+	event, ok := msg.(*shared.StreamEvent)
+	if !ok {
+		return
+	}
+	shared.SafeCallback(func() { t.options.OnStreamEvent(shared.ParseStreamEvent(event)) })
+}
+
+// sameTools reports whether a and b list the same tools, in any order.
+func sameTools(a, b []shared.ToolInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	names := make(map[string]int, len(a))
+	for _, tool := range a {
+		names[tool.Name]++
+	}
+	for _, tool := range b {
+		if names[tool.Name] == 0 {
+			return false
+		}
+		names[tool.Name]--
+	}
+	return true
+}
+
+// deliverMessage reports whether msg passes the partial stream selection and
+// the configured message filter.
+// A panicking filter delivers the message rather than crashing the SDK.
+func (t *Transport) deliverMessage(msg shared.Message) (deliver bool) {
+	if t.options == nil {
+		return true
+	}
+	if event, ok := msg.(*shared.StreamEvent); ok && t.options.PartialStream != nil {
+		if !t.options.PartialStream.AllowsEvent(event.Event) {
+			return false
+		}
+	}
+	if t.options.MessageFilter == nil {
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			deliver = true
+		}
+	}()
+	return t.options.MessageFilter(msg)
 }
 
 // handleStderrCallback processes stderr in a separate goroutine.
@@ -115,16 +410,292 @@ func (t *Transport) handleStderrCallback() {
 			defer func() {
 				_ = recover() // Silently ignore callback panics (matches Python's pass)
 			}()
+			if t.redactor != nil {
+				line = t.redactor.Redact(line)
+			}
+			t.stderrTail.add(line)
 			t.options.StderrCallback(line)
 		}()
 	}
 	// Silently ignore scanner errors (matches Python SDK's except Exception: pass)
 }
 
+// handleHeartbeat writes a progress marker every interval while a turn is active.
+// Runs until the transport context is cancelled.
+func (t *Transport) handleHeartbeat(interval time.Duration, w io.Writer) {
+	defer t.wg.Done()
+
+	clock := t.clock()
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C():
+			if start, active := t.activeTurn(); active {
+				elapsed := clock.Now().Sub(start).Round(time.Second)
+				_, _ = fmt.Fprintf(w, "[claude] turn in progress (%s elapsed)\n", elapsed)
+			}
+		}
+	}
+}
+
+// handleSessionDeadline terminates the CLI once the maximum session duration
+// elapses. handleStdout reports the expiry when stdout closes.
+func (t *Transport) handleSessionDeadline(d time.Duration, process *os.Process) {
+	defer t.wg.Done()
+
+	timer := t.clock().NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-t.ctx.Done():
+		return
+	case <-timer.C():
+	}
+
+	atomic.StoreInt32(&t.sessionExpired, 1)
+	t.debugf("session exceeded maximum duration of %s, terminating CLI", d)
+
+	// SIGTERM first so the CLI can exit cleanly, SIGKILL if it does not
+	if err := t.signalProcess(process, syscall.SIGTERM); err != nil {
+		_ = t.killProcess(process)
+		return
+	}
+	select {
+	case <-t.ctx.Done():
+	case <-time.After(terminationTimeoutSeconds * time.Second):
+		_ = t.killProcess(process)
+	}
+}
+
+// handleProcessGroupCancel kills the CLI's whole process group when ctx is
+// cancelled, so processes the CLI spawned, such as MCP servers, do not
+// outlive it until Close. Runs until the CLI exits or the transport is closed.
+func (t *Transport) handleProcessGroupCancel(ctx context.Context, process *os.Process) {
+	defer t.wg.Done()
+
+	select {
+	case <-ctx.Done():
+	case <-t.ctx.Done():
+	case <-t.stdoutDone:
+	}
+	if ctx.Err() != nil {
+		t.killProcessGroup(process)
+	}
+}
+
+// handleGracefulCancel shuts the CLI down cleanly when ctx is cancelled: it
+// sends an interrupt (a control request in streaming mode, SIGINT otherwise),
+// closes stdin so the CLI can exit, and kills it if it is still running once
+// grace has elapsed. Runs until the CLI exits or the transport is closed.
+func (t *Transport) handleGracefulCancel(
+	ctx context.Context,
+	grace time.Duration,
+	protocol *control.Protocol,
+	stdin io.Closer,
+	process *os.Process,
+) {
+	defer t.wg.Done()
+
+	select {
+	case <-t.ctx.Done():
+		return
+	case <-t.stdoutDone:
+		return
+	case <-ctx.Done():
+	}
+
+	t.debugf("context cancelled, interrupting CLI (grace period %s)", grace)
+	deadline := t.clock().NewTimer(grace)
+	defer deadline.Stop()
+
+	interrupted := false
+	if protocol != nil {
+		interruptCtx, cancel := context.WithTimeout(t.ctx, grace)
+		interrupted = protocol.Interrupt(interruptCtx) == nil
+		cancel()
+	}
+	if !interrupted && runtime.GOOS != windowsOS {
+		_ = process.Signal(os.Interrupt)
+	}
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+
+	select {
+	case <-t.stdoutDone:
+	case <-t.ctx.Done():
+	case <-deadline.C():
+		t.debugf("CLI still running after grace period, killing it")
+		_ = t.killProcess(process)
+	}
+}
+
+// clock returns the configured Clock, or the system clock.
+func (t *Transport) clock() shared.Clock {
+	if t.options == nil {
+		return shared.SystemClock()
+	}
+	return shared.ClockOrSystem(t.options.Clock)
+}
+
+// beginTurn marks a turn as active if one isn't already.
+func (t *Transport) beginTurn() {
+	t.turnMu.Lock()
+	defer t.turnMu.Unlock()
+	if t.turnStart.IsZero() {
+		t.turnStart = t.clock().Now()
+	}
+}
+
+// endTurn marks the active turn as complete.
+func (t *Transport) endTurn() {
+	t.turnMu.Lock()
+	defer t.turnMu.Unlock()
+	t.turnStart = time.Time{}
+}
+
+// activeTurn returns the start time of the active turn and whether one is active.
+func (t *Transport) activeTurn() (time.Time, bool) {
+	t.turnMu.Lock()
+	defer t.turnMu.Unlock()
+	return t.turnStart, !t.turnStart.IsZero()
+}
+
+// pendingTurn is a sent turn awaiting its ResultMessage.
+type pendingTurn struct {
+	seq       uint64          // Order in which the turn was queued
+	sessionID string          // Session the turn was sent in
+	queryID   string          // Empty for turns sent without a query ID
+	spanCtx   context.Context // Turn span context (only with a Tracer)
+	span      shared.Span     // Turn span (only with a Tracer)
+}
+
+// pushTurn queues a turn about to be sent until its result arrives, opening
+// its turn span, and returns its sequence number. Every turn is queued, with
+// an empty query ID when it has none, so each result completes the turn it
+// belongs to.
+func (t *Transport) pushTurn(ctx context.Context, sessionID, queryID string) uint64 {
+	spanCtx, span := t.startTurnSpan(ctx, sessionID, queryID)
+	t.pendingMu.Lock()
+	t.turnSeq++
+	seq := t.turnSeq
+	t.pendingTurns = append(t.pendingTurns, pendingTurn{
+		seq: seq, sessionID: sessionID, queryID: queryID, spanCtx: spanCtx, span: span,
+	})
+	t.pendingMu.Unlock()
+	if queryID != "" {
+		t.debugf("query %s sent", queryID)
+	}
+	return seq
+}
+
+// dropTurn removes a queued turn whose message could not be written, ending
+// its span with err.
+func (t *Transport) dropTurn(seq uint64, err error) {
+	t.pendingMu.Lock()
+	var dropped *pendingTurn
+	for i := range t.pendingTurns {
+		if t.pendingTurns[i].seq == seq {
+			turn := t.pendingTurns[i]
+			dropped = &turn
+			t.pendingTurns = append(t.pendingTurns[:i:i], t.pendingTurns[i+1:]...)
+			break
+		}
+	}
+	pending := len(t.pendingTurns) > 0
+	t.pendingMu.Unlock()
+
+	if !pending {
+		t.endTurn()
+	}
+	if dropped != nil && dropped.span != nil {
+		dropped.span.End(err)
+	}
+}
+
+// currentTurn returns the oldest turn awaiting its result, if any.
+func (t *Transport) currentTurn() (pendingTurn, bool) {
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+	if len(t.pendingTurns) == 0 {
+		return pendingTurn{}, false
+	}
+	return t.pendingTurns[0], true
+}
+
+// currentQueryID returns the query ID of the oldest turn awaiting its result, or "".
+func (t *Transport) currentQueryID() string {
+	turn, _ := t.currentTurn()
+	return turn.queryID
+}
+
+// completeTurn removes the oldest pending turn once its result arrives and
+// ends its span with the result's outcome.
+func (t *Transport) completeTurn(result *shared.ResultMessage) {
+	t.pendingMu.Lock()
+	if len(t.pendingTurns) == 0 {
+		t.pendingMu.Unlock()
+		return
+	}
+	turn := t.pendingTurns[0]
+	t.pendingTurns = t.pendingTurns[1:]
+	t.pendingMu.Unlock()
+	if turn.queryID != "" {
+		t.debugf("query %s completed", turn.queryID)
+	}
+	if turn.span != nil {
+		var err error
+		if result.IsError {
+			err = fmt.Errorf("turn ended with %s", result.Subtype)
+		}
+		turn.span.End(err)
+	}
+}
+
+// abandonTurns drops every pending turn, ending open spans with err.
+func (t *Transport) abandonTurns(err error) {
+	t.pendingMu.Lock()
+	turns := t.pendingTurns
+	t.pendingTurns = nil
+	t.pendingMu.Unlock()
+
+	for _, turn := range turns {
+		if turn.span != nil {
+			turn.span.End(err)
+		}
+	}
+}
+
+// debugf writes an SDK diagnostic line to the debug writer, if one is configured.
+func (t *Transport) debugf(format string, args ...any) {
+	if t.options == nil || t.options.DebugWriter == nil {
+		return
+	}
+	var w io.Writer = t.options.DebugWriter
+	if t.redactedStderr != nil {
+		w = t.redactedStderr
+	}
+	_, _ = fmt.Fprintf(w, "[claude-agent-sdk] "+format+"\n", args...)
+}
+
 // setupStderr configures stderr handling based on options.
 // Precedence: StderrCallback > DebugWriter > temp file (default).
 // This extracts stderr setup logic from Connect to reduce cyclomatic complexity.
 func (t *Transport) setupStderr() error {
+	t.redactor, t.redactedStderr = nil, nil
+	t.stderrTail = &stderrTail{}
+	if t.options != nil && t.options.RedactDebugOutput {
+		redactor, err := shared.NewRedactor(t.options.DebugRedactionPatterns...)
+		if err != nil {
+			return err
+		}
+		t.redactor = redactor
+	}
+
 	switch {
 	case t.options != nil && t.options.StderrCallback != nil:
 		// Create pipe for callback-based stderr handling
@@ -136,6 +707,12 @@ func (t *Transport) setupStderr() error {
 	case t.options != nil && t.options.DebugWriter != nil:
 		// Use custom debug writer provided by user
 		t.cmd.Stderr = t.options.DebugWriter
+		if t.redactor != nil {
+			t.redactedStderr = shared.NewRedactingWriter(t.options.DebugWriter, t.redactor)
+			t.cmd.Stderr = t.redactedStderr
+		}
+		t.stderrTail.redactor = t.redactor
+		t.cmd.Stderr = io.MultiWriter(t.cmd.Stderr, t.stderrTail)
 	default:
 		// Isolate stderr using temporary file to prevent deadlocks
 		// This matches Python SDK pattern to avoid subprocess pipe deadlocks
@@ -174,3 +751,135 @@ func (t *Transport) setupIoPipes() error {
 
 	return nil
 }
+
+// recentStderrLines is the number of stderr lines kept for RecentStderr.
+const recentStderrLines = 20
+
+// stderrFileTailBytes bounds how much of the stderr temp file is read for
+// RecentStderr.
+const stderrFileTailBytes = 64 * 1024
+
+// RecentStderr returns up to the last 20 non-empty lines the CLI wrote to
+// stderr, oldest first, redacted if RedactDebugOutput is set. Returns nil if
+// nothing was written or the transport never connected.
+func (t *Transport) RecentStderr() []string {
+	t.mu.RLock()
+	tail, stderrFile, redactor := t.stderrTail, t.stderr, t.redactor
+	t.mu.RUnlock()
+
+	if stderrFile == nil {
+		if tail == nil {
+			return nil
+		}
+		return tail.snapshot()
+	}
+
+	// Lines written straight to the temp file are redacted here
+	lines := readTailLines(stderrFile.Name())
+	if redactor != nil {
+		for i, line := range lines {
+			lines[i] = redactor.Redact(line)
+		}
+	}
+	return lines
+}
+
+// stderrTail keeps the last lines written to the CLI's stderr. Written lines
+// are split on newlines; a line without one is held until it is completed.
+type stderrTail struct {
+	redactor *shared.Redactor // Applied to written lines; nil for none
+
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+// Write records the complete lines in p. It never fails.
+func (s *stderrTail) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(s.partial[:i])
+		if s.redactor != nil {
+			line = s.redactor.Redact(line)
+		}
+		s.addLocked(line)
+		s.partial = s.partial[i+1:]
+	}
+	if len(s.partial) > stderrFileTailBytes {
+		s.partial = s.partial[len(s.partial)-stderrFileTailBytes:]
+	}
+	return len(p), nil
+}
+
+// add records a complete line.
+func (s *stderrTail) add(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addLocked(line)
+}
+
+// addLocked records line unless it is blank, dropping the oldest line when
+// full. Must be called with s.mu held.
+func (s *stderrTail) addLocked(line string) {
+	line = strings.TrimRight(line, " \t\r\n")
+	if line == "" {
+		return
+	}
+	if len(s.lines) == recentStderrLines {
+		copy(s.lines, s.lines[1:])
+		s.lines = s.lines[:len(s.lines)-1]
+	}
+	s.lines = append(s.lines, line)
+}
+
+// snapshot returns a copy of the recorded lines, or nil if there are none.
+func (s *stderrTail) snapshot() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.lines) == 0 {
+		return nil
+	}
+	return append([]string(nil), s.lines...)
+}
+
+// readTailLines returns the last non-empty lines of the file at path, reading
+// at most stderrFileTailBytes from its end. Returns nil on any error.
+func readTailLines(path string) []string {
+	f, err := os.Open(path) //nolint:gosec // G304: Path is the transport's own stderr temp file
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	offset := info.Size() - stderrFileTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil
+	}
+	// Drop a line cut by the read offset; the last line may still be partial
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	tail := &stderrTail{}
+	for _, line := range strings.Split(string(data), "\n") {
+		tail.addLocked(line)
+	}
+	return tail.snapshot()
+}
@@ -1,13 +1,21 @@
 package subprocess
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/severity1/claude-agent-sdk-go/claudecodetest"
+	"github.com/severity1/claude-agent-sdk-go/internal/parser"
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
@@ -325,3 +333,1721 @@ sleep 0.5
 
 	return createTransportTempScript(script, extension)
 }
+
+// heartbeatBuffer is a goroutine-safe writer that counts heartbeat markers.
+type heartbeatBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *heartbeatBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *heartbeatBuffer) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Count(b.buf.String(), "turn in progress")
+}
+
+func (b *heartbeatBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestProgressHeartbeat tests heartbeat markers are written only while a turn is active
+func TestProgressHeartbeat(t *testing.T) {
+	t.Run("writes_during_active_turn_and_stops_after", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := &Transport{}
+		transport.ctx, transport.cancel = context.WithCancel(ctx)
+		out := &heartbeatBuffer{}
+
+		transport.beginTurn()
+		transport.wg.Add(1)
+		go transport.handleHeartbeat(10*time.Millisecond, out)
+
+		time.Sleep(60 * time.Millisecond)
+		if out.count() == 0 {
+			t.Fatal("Expected heartbeats during active turn")
+		}
+
+		transport.endTurn()
+		time.Sleep(20 * time.Millisecond) // Allow an in-flight tick to finish
+		afterTurn := out.count()
+		time.Sleep(60 * time.Millisecond)
+		if got := out.count(); got != afterTurn {
+			t.Errorf("Expected heartbeats to stop after turn, got %d more", got-afterTurn)
+		}
+
+		transport.cancel()
+		transport.wg.Wait()
+	})
+
+	t.Run("fake_clock_reports_elapsed_time", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		transport := &Transport{options: &shared.Options{Clock: clock}}
+		transport.ctx, transport.cancel = context.WithCancel(ctx)
+		out := &heartbeatBuffer{}
+
+		transport.beginTurn()
+		transport.wg.Add(1)
+		go transport.handleHeartbeat(30*time.Second, out)
+
+		clock.BlockUntil(1)
+		clock.Advance(30 * time.Second)
+		for out.count() == 0 {
+			select {
+			case <-ctx.Done():
+				t.Fatal("Timed out waiting for heartbeat")
+			case <-time.After(time.Millisecond):
+			}
+		}
+		if !strings.Contains(out.String(), "(30s elapsed)") {
+			t.Errorf("Expected elapsed time from the fake clock, got %q", out.String())
+		}
+
+		transport.cancel()
+		transport.wg.Wait()
+	})
+
+	t.Run("no_heartbeat_without_turn", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := &Transport{}
+		transport.ctx, transport.cancel = context.WithCancel(ctx)
+		out := &heartbeatBuffer{}
+
+		transport.wg.Add(1)
+		go transport.handleHeartbeat(10*time.Millisecond, out)
+
+		time.Sleep(50 * time.Millisecond)
+		transport.cancel()
+		transport.wg.Wait()
+
+		if got := out.count(); got != 0 {
+			t.Errorf("Expected no heartbeats without active turn, got %d", got)
+		}
+	})
+
+	t.Run("result_message_ends_turn", func(t *testing.T) {
+		if runtime.GOOS == windowsOS {
+			t.Skip("mock CLI script requires a POSIX shell")
+		}
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+read -r _
+sleep 0.3
+echo '{"type":"result","subtype":"success","duration_ms":300,"duration_api_ms":250,"is_error":false,"num_turns":1,"session_id":"s1"}'
+while read -r _; do :; done
+`
+		cliPath := createTransportTempScript(script, "")
+		defer func() { _ = os.Remove(cliPath) }()
+
+		out := &heartbeatBuffer{}
+		options := &shared.Options{
+			ProgressHeartbeatInterval: 50 * time.Millisecond,
+			ProgressHeartbeatWriter:   out,
+		}
+		transport := New(cliPath, options, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1"})
+		assertNoTransportError(t, err)
+
+		msgChan, _ := transport.ReceiveMessages(ctx)
+		select {
+		case msg := <-msgChan:
+			if _, ok := msg.(*shared.ResultMessage); !ok {
+				t.Fatalf("Expected ResultMessage, got %T", msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for result message")
+		}
+
+		if out.count() == 0 {
+			t.Error("Expected heartbeats while waiting for result")
+		}
+		afterResult := out.count()
+		time.Sleep(200 * time.Millisecond)
+		if got := out.count(); got != afterResult {
+			t.Errorf("Expected heartbeats to stop after result, got %d more", got-afterResult)
+		}
+	})
+}
+
+// TestMessageFilter tests filtered messages are dropped before reaching msgChan
+func TestMessageFilter(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"system","subtype":"init","data":{}}'
+echo '{"type":"stream_event","uuid":"u1","session_id":"s1","event":{"type":"message_start"}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hello"}],"model":"claude-sonnet-4-5"}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	filterCalls := 0
+	options := &shared.Options{
+		MessageFilter: func(msg shared.Message) bool {
+			filterCalls++
+			switch msg.(type) {
+			case *shared.SystemMessage, *shared.StreamEvent:
+				return false
+			}
+			return true
+		},
+	}
+	transport := New(cliPath, options, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	var received []shared.Message
+	for len(received) < 2 {
+		select {
+		case msg := <-msgChan:
+			received = append(received, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for messages, got %d", len(received))
+		}
+	}
+
+	if _, ok := received[0].(*shared.AssistantMessage); !ok {
+		t.Errorf("Expected AssistantMessage first, got %T", received[0])
+	}
+	if _, ok := received[1].(*shared.ResultMessage); !ok {
+		t.Errorf("Expected ResultMessage second, got %T", received[1])
+	}
+	if filterCalls != 4 {
+		t.Errorf("Expected filter to see 4 messages, got %d", filterCalls)
+	}
+}
+
+// TestDeliverMessage tests message filter defaults and panic recovery
+func TestDeliverMessage(t *testing.T) {
+	msg := &shared.SystemMessage{Subtype: "status"}
+
+	if !(&Transport{}).deliverMessage(msg) {
+		t.Error("Expected delivery without options")
+	}
+	if !(&Transport{options: &shared.Options{}}).deliverMessage(msg) {
+		t.Error("Expected delivery without filter")
+	}
+
+	panicking := &Transport{options: &shared.Options{
+		MessageFilter: func(shared.Message) bool { panic("boom") },
+	}}
+	if !panicking.deliverMessage(msg) {
+		t.Error("Expected delivery when filter panics")
+	}
+}
+
+// TestMessageMiddleware tests middlewares run in order and their transformed
+// messages are filtered and delivered
+func TestMessageMiddleware(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"system","subtype":"init","data":{}}'
+echo '{"type":"stream_event","uuid":"u1","session_id":"s1","event":{"type":"message_start"}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hello"}],"model":"claude-sonnet-4-5"}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	var calls []string
+	observe := func(next shared.MessageHandler) shared.MessageHandler {
+		return func(msg shared.Message) {
+			calls = append(calls, "observe "+msg.Type())
+			next(msg)
+		}
+	}
+	// transform drops system messages and upper-cases assistant text
+	transform := func(next shared.MessageHandler) shared.MessageHandler {
+		return func(msg shared.Message) {
+			calls = append(calls, "transform "+msg.Type())
+			switch m := msg.(type) {
+			case *shared.SystemMessage:
+				return
+			case *shared.AssistantMessage:
+				text := m.Content[0].(*shared.TextBlock).Text
+				msg = &shared.AssistantMessage{
+					Content: []shared.ContentBlock{&shared.TextBlock{Text: strings.ToUpper(text)}},
+					Model:   m.Model,
+				}
+			}
+			next(msg)
+		}
+	}
+	var filtered []string
+	options := &shared.Options{
+		MessageMiddleware: []shared.MessageMiddleware{observe, transform},
+		MessageFilter: func(msg shared.Message) bool {
+			filtered = append(filtered, msg.Type())
+			_, isEvent := msg.(*shared.StreamEvent)
+			return !isEvent
+		},
+	}
+	transport := New(cliPath, options, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	var received []shared.Message
+	for len(received) < 2 {
+		select {
+		case msg := <-msgChan:
+			received = append(received, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for messages, got %d", len(received))
+		}
+	}
+
+	assistant, ok := received[0].(*shared.AssistantMessage)
+	if !ok {
+		t.Fatalf("Expected AssistantMessage first, got %T", received[0])
+	}
+	if text := assistant.Content[0].(*shared.TextBlock).Text; text != "HELLO" {
+		t.Errorf("Expected transformed text HELLO, got %q", text)
+	}
+	if _, ok := received[1].(*shared.ResultMessage); !ok {
+		t.Errorf("Expected ResultMessage second, got %T", received[1])
+	}
+
+	wantCalls := []string{
+		"observe system", "transform system",
+		"observe stream_event", "transform stream_event",
+		"observe assistant", "transform assistant",
+		"observe result", "transform result",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("Expected middleware calls %q, got %q", wantCalls, calls)
+	}
+	// The filter runs after middleware, so it never sees the dropped system message
+	wantFiltered := []string{"stream_event", "assistant", "result"}
+	if !reflect.DeepEqual(filtered, wantFiltered) {
+		t.Errorf("Expected filter to see %q, got %q", wantFiltered, filtered)
+	}
+}
+
+// TestMessagePipelinePanic tests a panicking middleware delivers the original
+// message once, whether or not it passed the message on first
+func TestMessagePipelinePanic(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware shared.MessageMiddleware
+	}{
+		{"before_next", func(next shared.MessageHandler) shared.MessageHandler {
+			return func(shared.Message) { panic("boom") }
+		}},
+		{"after_next", func(next shared.MessageHandler) shared.MessageHandler {
+			return func(msg shared.Message) {
+				next(msg)
+				panic("boom")
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			transport := &Transport{
+				options: &shared.Options{MessageMiddleware: []shared.MessageMiddleware{test.middleware}},
+				msgChan: make(chan shared.Message, 2),
+				ctx:     ctx,
+			}
+
+			msg := &shared.SystemMessage{Subtype: "status"}
+			if !transport.newMessagePipeline().handle(msg) {
+				t.Fatal("Expected pipeline to continue")
+			}
+			if got := len(transport.msgChan); got != 1 {
+				t.Fatalf("Expected 1 delivered message, got %d", got)
+			}
+			if got := <-transport.msgChan; got != msg {
+				t.Errorf("Expected original message, got %v", got)
+			}
+		})
+	}
+}
+
+// TestCostTrackerRecordsResults tests usage and cost are accumulated across turns
+func TestCostTrackerRecordsResults(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+read -r _
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1","total_cost_usd":0.25,"usage":{"input_tokens":100,"output_tokens":40}}'
+read -r _
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":2,"session_id":"s1","total_cost_usd":0.5,"usage":{"input_tokens":150,"output_tokens":60,"cache_read_input_tokens":20}}'
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	tracker := shared.NewCostTracker()
+	transport := New(cliPath, &shared.Options{CostTracker: tracker}, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	for turn := 1; turn <= 2; turn++ {
+		err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1"})
+		assertNoTransportError(t, err)
+
+		select {
+		case <-msgChan:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for result of turn %d", turn)
+		}
+	}
+
+	expected := shared.Usage{InputTokens: 250, OutputTokens: 100, CacheReadInputTokens: 20}
+	if got := tracker.Total(); got != expected {
+		t.Errorf("Expected usage %+v, got %+v", expected, got)
+	}
+	if got := tracker.TotalCostUSD(); got != 0.75 {
+		t.Errorf("Expected total cost 0.75, got %f", got)
+	}
+	if got := tracker.Results(); got != 2 {
+		t.Errorf("Expected 2 recorded results, got %d", got)
+	}
+}
+
+// TestDebugRedaction tests secrets are scrubbed from the debug stream
+func TestDebugRedaction(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo "[DEBUG] using ANTHROPIC_API_KEY=sk-ant-api03-TOPSECRET" >&2
+echo "[DEBUG] mcp header Authorization: Bearer mcp-token-123" >&2
+echo "[DEBUG] tenant corp-424242" >&2
+echo '{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s1"}'
+while read -r _; do :; done
+`
+	secrets := []string{"TOPSECRET", "mcp-token-123", "corp-424242"}
+
+	t.Run("debug_writer", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		cliPath := createTransportTempScript(script, "")
+		defer func() { _ = os.Remove(cliPath) }()
+
+		out := &heartbeatBuffer{}
+		options := &shared.Options{
+			DebugWriter:            out,
+			RedactDebugOutput:      true,
+			DebugRedactionPatterns: []string{`corp-\d+`},
+		}
+		transport := New(cliPath, options, false, "sdk-go")
+		connectTransportSafely(ctx, t, transport)
+
+		msgChan, _ := transport.ReceiveMessages(ctx)
+		select {
+		case <-msgChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for result message")
+		}
+		disconnectTransportSafely(t, transport)
+
+		out.mu.Lock()
+		debug := out.buf.String()
+		out.mu.Unlock()
+		if !strings.Contains(debug, "ANTHROPIC_API_KEY=[REDACTED]") {
+			t.Errorf("Expected API key to be redacted, got %q", debug)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(debug, secret) {
+				t.Errorf("Secret %q leaked into debug output: %q", secret, debug)
+			}
+		}
+	})
+
+	t.Run("stderr_callback", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		cliPath := createTransportTempScript(script, "")
+		defer func() { _ = os.Remove(cliPath) }()
+
+		var mu sync.Mutex
+		var lines []string
+		options := &shared.Options{
+			StderrCallback: func(line string) {
+				mu.Lock()
+				defer mu.Unlock()
+				lines = append(lines, line)
+			},
+			RedactDebugOutput:      true,
+			DebugRedactionPatterns: []string{`corp-\d+`},
+		}
+		transport := New(cliPath, options, false, "sdk-go")
+		connectTransportSafely(ctx, t, transport)
+
+		msgChan, _ := transport.ReceiveMessages(ctx)
+		select {
+		case <-msgChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for result message")
+		}
+		time.Sleep(100 * time.Millisecond) // Allow stderr lines to be delivered
+		disconnectTransportSafely(t, transport)
+
+		mu.Lock()
+		defer mu.Unlock()
+		joined := strings.Join(lines, "\n")
+		if !strings.Contains(joined, "Bearer [REDACTED]") {
+			t.Errorf("Expected bearer token to be redacted, got %q", joined)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(joined, secret) {
+				t.Errorf("Secret %q leaked into stderr callback: %q", secret, joined)
+			}
+		}
+	})
+}
+
+// TestUnexpectedEOF tests the validator records a CLI exit mid-turn but not after a result
+func TestUnexpectedEOF(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	tests := []struct {
+		name           string
+		output         string
+		wantUnexpected bool
+	}{
+		{
+			name:           "exit_mid_turn",
+			output:         `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Working"}],"model":"claude-sonnet-4-5"}}`,
+			wantUnexpected: true,
+		},
+		{
+			name:           "exit_after_result",
+			output:         `{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}`,
+			wantUnexpected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+read -r _
+echo '` + test.output + `'
+exit 1
+`
+			cliPath := createTransportTempScript(script, "")
+			defer func() { _ = os.Remove(cliPath) }()
+
+			transport := New(cliPath, &shared.Options{}, false, "sdk-go")
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			msgChan, _ := transport.ReceiveMessages(ctx)
+			err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1"})
+			assertNoTransportError(t, err)
+
+			// Drain until the stream closes
+			for open := true; open; {
+				select {
+				case _, open = <-msgChan:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for stream to close")
+				}
+			}
+
+			validator := transport.GetValidator()
+			if got := validator.EndedUnexpectedly(); got != test.wantUnexpected {
+				t.Errorf("Expected EndedUnexpectedly=%v, got %v (issues: %+v)", test.wantUnexpected, got, validator.GetIssues())
+			}
+		})
+	}
+}
+
+// TestQueryIDTagging tests messages of each turn carry the ID of the query
+// that started it, with turns sent without an ID interleaved
+func TestQueryIDTagging(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+while read -r _; do
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Working"}],"model":"claude-sonnet-4-5"}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	debug := &heartbeatBuffer{}
+	transport := New(cliPath, &shared.Options{DebugWriter: debug}, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	for _, queryID := range []string{"query_1", "", "query_2"} {
+		err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1", QueryID: queryID})
+		assertNoTransportError(t, err)
+	}
+
+	expected := []string{"query_1", "query_1", "", "", "query_2", "query_2"}
+	for i, want := range expected {
+		select {
+		case msg := <-msgChan:
+			if got := shared.MessageQueryID(msg); got != want {
+				t.Errorf("Message %d (%T): expected query ID %q, got %q", i, msg, want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for message %d", i)
+		}
+	}
+
+	logs := debug.String()
+	for _, want := range []string{"query query_1 sent", "query query_1 completed", "query query_2 completed"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("Expected debug output to contain %q, got:\n%s", want, logs)
+		}
+	}
+}
+
+// TestSendMessageQueuesTurnBeforeWrite tests a turn is queued before its
+// message is written, so a result read right away finds it, and is dropped
+// again if the write fails
+func TestSendMessageQueuesTurnBeforeWrite(t *testing.T) {
+	ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+	defer cancel()
+
+	stdin := &turnRecordingWriter{}
+	transport := &Transport{connected: true, stdin: stdin}
+	stdin.transport = transport
+
+	err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1", QueryID: "query_1"})
+	assertNoTransportError(t, err)
+	if stdin.queryIDAtWrite != "query_1" {
+		t.Errorf("Expected query_1 queued when its message was written, got %q", stdin.queryIDAtWrite)
+	}
+	transport.completeTurn(&shared.ResultMessage{Subtype: "success"})
+
+	stdin.err = errors.New("broken pipe")
+	err = transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1", QueryID: "query_2"})
+	if err == nil {
+		t.Fatal("Expected the write error")
+	}
+	if turn, pending := transport.currentTurn(); pending {
+		t.Errorf("Expected the unsent turn to be dropped, got %+v", turn)
+	}
+	if _, active := transport.activeTurn(); active {
+		t.Error("Expected no active turn after the failed send")
+	}
+}
+
+// turnRecordingWriter records the query ID of the current turn on each
+// write, failing with err if set.
+type turnRecordingWriter struct {
+	transport      *Transport
+	queryIDAtWrite string
+	err            error
+}
+
+func (w *turnRecordingWriter) Write(p []byte) (int, error) {
+	w.queryIDAtWrite = w.transport.currentQueryID()
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+func (w *turnRecordingWriter) Close() error { return nil }
+
+// TestTranscriptWriter tests every received message is written as a re-parsable JSON line
+func TestTranscriptWriter(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"system","subtype":"init","session_id":"s1"}'
+echo '{"type":"control_response","response":{"subtype":"success","request_id":"req_1"}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}],"model":"claude-sonnet-4-5"}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	transcript := &heartbeatBuffer{}
+	options := &shared.Options{
+		TranscriptWriter: transcript,
+		// Filtered messages are still recorded
+		MessageFilter: func(msg shared.Message) bool { return msg.Type() != shared.MessageTypeSystem },
+	}
+	transport := New(cliPath, options, true, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	for open := true; open; {
+		select {
+		case _, open = <-msgChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for stream to close")
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(transcript.String(), "\n"), "\n")
+	wantTypes := []string{shared.MessageTypeSystem, shared.MessageTypeAssistant, shared.MessageTypeResult}
+	if len(lines) != len(wantTypes) {
+		t.Fatalf("Expected %d transcript lines, got %d:\n%s", len(wantTypes), len(lines), transcript.String())
+	}
+
+	replay := parser.New()
+	for i, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("Line %d is not valid JSON: %s", i, line)
+			continue
+		}
+		messages, err := replay.ProcessLine(line)
+		if err != nil || len(messages) != 1 {
+			t.Errorf("Line %d did not re-parse to one message: %v (%d messages)", i, err, len(messages))
+			continue
+		}
+		if got := messages[0].Type(); got != wantTypes[i] {
+			t.Errorf("Line %d: expected %s message, got %s", i, wantTypes[i], got)
+		}
+	}
+}
+
+// TestRawStdoutTee tests the tee receives the CLI's stdout bytes unchanged
+func TestRawStdoutTee(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	output := `{"type":"system","subtype":"init","session_id":"s1"}` + "\n" +
+		`{"type":"control_response","response":{"subtype":"success","request_id":"req_1"}}` + "\n" +
+		"\n" +
+		`{"type": "assistant", "message": {"role":"assistant","content":[{"type":"text","text":"Hi \u00e9"}],"model":"claude-sonnet-4-5"}}` + "\n" +
+		`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}` + "\n"
+	outputFile, err := os.CreateTemp("", "raw_stdout_*.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to create output file: %v", err)
+	}
+	defer func() { _ = os.Remove(outputFile.Name()) }()
+	if _, err := outputFile.WriteString(output); err != nil {
+		t.Fatalf("Failed to write output file: %v", err)
+	}
+	_ = outputFile.Close()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+cat '` + outputFile.Name() + `'
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	run := func(t *testing.T, tee io.Writer) int {
+		t.Helper()
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		transport := New(cliPath, &shared.Options{RawStdoutTee: tee}, true, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		received := 0
+		msgChan, _ := transport.ReceiveMessages(ctx)
+		for open := true; open; {
+			select {
+			case _, open = <-msgChan:
+				if open {
+					received++
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for stream to close")
+			}
+		}
+		return received
+	}
+
+	t.Run("bytes_match_output", func(t *testing.T) {
+		tee := &heartbeatBuffer{}
+		if got := run(t, tee); got != 3 {
+			t.Errorf("Expected 3 parsed messages, got %d", got)
+		}
+		if got := tee.String(); got != output {
+			t.Errorf("Expected tee'd bytes to equal CLI output\nwant: %q\ngot:  %q", output, got)
+		}
+	})
+
+	t.Run("write_error_does_not_stop_parsing", func(t *testing.T) {
+		tee := &failingWriter{}
+		if got := run(t, tee); got != 3 {
+			t.Errorf("Expected 3 parsed messages despite tee errors, got %d", got)
+		}
+		if tee.writes != 1 {
+			t.Errorf("Expected tee to be skipped after its first error, got %d writes", tee.writes)
+		}
+	})
+}
+
+// failingWriter fails every write and counts attempts
+type failingWriter struct {
+	writes int
+}
+
+func (f *failingWriter) Write([]byte) (int, error) {
+	f.writes++
+	return 0, errors.New("disk full")
+}
+
+// TestPartialStreamSelection tests only enabled delta types are delivered
+func TestPartialStreamSelection(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	event := func(payload string) string {
+		return `echo '{"type":"stream_event","uuid":"u","session_id":"s1","event":` + payload + `}'` + "\n"
+	}
+	script := "#!/bin/bash\n" +
+		`if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi` + "\n" +
+		event(`{"type":"message_start","message":{}}`) +
+		event(`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hmm"}}`) +
+		event(`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hi"}}`) +
+		event(`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{"}}`) +
+		event(`{"type":"message_stop"}`)
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	options := &shared.Options{
+		IncludePartialMessages: true,
+		PartialStream:          &shared.PartialStreamOptions{Text: true},
+	}
+	transport := New(cliPath, options, true, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	var delivered []string
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	for open := true; open; {
+		select {
+		case msg, ok := <-msgChan:
+			if open = ok; !ok {
+				break
+			}
+			event := msg.(*shared.StreamEvent).Event
+			label, _ := event["type"].(string)
+			if delta, ok := event["delta"].(map[string]any); ok {
+				label, _ = delta["type"].(string)
+			}
+			delivered = append(delivered, label)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for stream to close")
+		}
+	}
+
+	want := "message_start,text_delta,message_stop"
+	if got := strings.Join(delivered, ","); got != want {
+		t.Errorf("Expected delivered events %s, got %s", want, got)
+	}
+}
+
+// TestOnThinkingCallback tests the callback receives each thinking block with its signature
+func TestOnThinkingCallback(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"thinking","thinking":"Check the tests first","signature":"sig-1"},{"type":"text","text":"Done"},{"type":"thinking","thinking":"Then the docs","signature":"sig-2"}],"model":"claude-sonnet-4-5"}}'
+`
+
+	tests := []struct {
+		name  string
+		panic bool
+	}{
+		{name: "receives_text_and_signature"},
+		{name: "panic_does_not_drop_message", panic: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			cliPath := createTransportTempScript(script, "")
+			defer func() { _ = os.Remove(cliPath) }()
+
+			var mu sync.Mutex
+			var seen []shared.ThinkingBlock
+			options := &shared.Options{
+				OnThinking: func(block *shared.ThinkingBlock) {
+					mu.Lock()
+					seen = append(seen, *block)
+					mu.Unlock()
+					if test.panic {
+						panic("boom")
+					}
+				},
+			}
+			transport := New(cliPath, options, true, "sdk-go")
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			msgChan, _ := transport.ReceiveMessages(ctx)
+			select {
+			case msg := <-msgChan:
+				if _, ok := msg.(*shared.AssistantMessage); !ok {
+					t.Fatalf("Expected AssistantMessage to be delivered, got %T", msg)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for assistant message")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) != 2 {
+				t.Fatalf("Expected 2 thinking blocks, got %d", len(seen))
+			}
+			if seen[0].Thinking != "Check the tests first" || seen[0].Signature != "sig-1" {
+				t.Errorf("Unexpected first thinking block: %+v", seen[0])
+			}
+			if seen[1].Thinking != "Then the docs" || seen[1].Signature != "sig-2" {
+				t.Errorf("Unexpected second thinking block: %+v", seen[1])
+			}
+		})
+	}
+}
+
+// TestOnToolResultCallback tests each tool result block is passed to the callback
+func TestOnToolResultCallback(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"user","message":{"role":"user","content":"plain prompt"}}'
+echo '{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"file contents"},{"type":"text","text":"note"},{"type":"tool_result","tool_use_id":"toolu_2","content":[{"type":"text","text":"exit 1"}],"is_error":true}]}}'
+`
+
+	tests := []struct {
+		name  string
+		panic bool
+	}{
+		{name: "receives_id_and_content"},
+		{name: "panic_does_not_drop_message", panic: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			cliPath := createTransportTempScript(script, "")
+			defer func() { _ = os.Remove(cliPath) }()
+
+			var mu sync.Mutex
+			var seen []shared.ToolResultBlock
+			options := &shared.Options{
+				OnToolResult: func(block *shared.ToolResultBlock) {
+					mu.Lock()
+					seen = append(seen, *block)
+					mu.Unlock()
+					if test.panic {
+						panic("boom")
+					}
+				},
+				// Filtered messages still reach the callback
+				MessageFilter: func(msg shared.Message) bool {
+					user, ok := msg.(*shared.UserMessage)
+					return !ok || user.Content == "plain prompt"
+				},
+			}
+			transport := New(cliPath, options, true, "sdk-go")
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			msgChan, _ := transport.ReceiveMessages(ctx)
+			for open := true; open; {
+				select {
+				case _, open = <-msgChan:
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for stream to close")
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) != 2 {
+				t.Fatalf("Expected 2 tool result blocks, got %d", len(seen))
+			}
+			if seen[0].ToolUseID != "toolu_1" || seen[0].Content != "file contents" || seen[0].IsError != nil {
+				t.Errorf("Unexpected first tool result: %+v", seen[0])
+			}
+			content, _ := seen[1].Content.([]any)
+			if seen[1].ToolUseID != "toolu_2" || len(content) != 1 || seen[1].IsError == nil || !*seen[1].IsError {
+				t.Errorf("Unexpected second tool result: %+v", seen[1])
+			}
+		})
+	}
+}
+
+// TestOnResultErrorCallback tests the callback receives error results only
+func TestOnResultErrorCallback(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1","result":"done"}'
+echo '{"type":"result","subtype":"error_max_turns","duration_ms":10,"duration_api_ms":5,"is_error":true,"num_turns":3,"session_id":"s1","result":"Reached max turns"}'
+`
+
+	tests := []struct {
+		name  string
+		panic bool
+	}{
+		{name: "receives_text_and_error_type"},
+		{name: "panic_does_not_drop_message", panic: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			cliPath := createTransportTempScript(script, "")
+			defer func() { _ = os.Remove(cliPath) }()
+
+			var mu sync.Mutex
+			var seen []shared.ResultMessage
+			options := &shared.Options{
+				OnResultError: func(result *shared.ResultMessage) {
+					mu.Lock()
+					seen = append(seen, *result)
+					mu.Unlock()
+					if test.panic {
+						panic("boom")
+					}
+				},
+			}
+			transport := New(cliPath, options, true, "sdk-go")
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			msgChan, _ := transport.ReceiveMessages(ctx)
+			received := 0
+			for open := true; open; {
+				select {
+				case msg, ok := <-msgChan:
+					open = ok
+					if ok && msg != nil {
+						received++
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("Timed out waiting for stream to close")
+				}
+			}
+			if received != 2 {
+				t.Errorf("Expected both results delivered, got %d", received)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) != 1 {
+				t.Fatalf("Expected 1 error result, got %d", len(seen))
+			}
+			if seen[0].Result == nil || *seen[0].Result != "Reached max turns" {
+				t.Errorf("Expected result text, got %v", seen[0].Result)
+			}
+			if seen[0].ErrorType != shared.ResultErrorMaxTurns {
+				t.Errorf("Expected error type %q, got %q", shared.ResultErrorMaxTurns, seen[0].ErrorType)
+			}
+		})
+	}
+}
+
+// TestOnToolsChangedCallback tests the callback receives the init tool list
+// and mid-session updates, but not repeated identical lists
+func TestOnToolsChangedCallback(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"system","subtype":"init","session_id":"s1","tools":["Read","mcp__docs__search"]}'
+echo '{"type":"system","subtype":"tools_changed","session_id":"s1","tools":["Read","mcp__docs__search","mcp__git__log"]}'
+echo '{"type":"system","subtype":"tools_changed","session_id":"s1","tools":["mcp__git__log","Read","mcp__docs__search"]}'
+echo '{"type":"system","subtype":"status","session_id":"s1"}'
+`
+
+	tests := []struct {
+		name  string
+		panic bool
+	}{
+		{name: "reports_init_and_changed_lists"},
+		{name: "panic_does_not_drop_messages", panic: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			cliPath := createTransportTempScript(script, "")
+			defer func() { _ = os.Remove(cliPath) }()
+
+			var mu sync.Mutex
+			var seen [][]shared.ToolInfo
+			options := &shared.Options{
+				OnToolsChanged: func(tools []shared.ToolInfo) {
+					mu.Lock()
+					seen = append(seen, tools)
+					mu.Unlock()
+					if test.panic {
+						panic("boom")
+					}
+				},
+			}
+			transport := New(cliPath, options, true, "sdk-go")
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			msgChan, _ := transport.ReceiveMessages(ctx)
+			for i := 0; i < 4; i++ {
+				select {
+				case msg := <-msgChan:
+					if _, ok := msg.(*shared.SystemMessage); !ok {
+						t.Fatalf("Expected SystemMessage %d to be delivered, got %T", i, msg)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Timed out waiting for system message %d", i)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) != 2 {
+				t.Fatalf("Expected 2 tool list callbacks, got %d: %+v", len(seen), seen)
+			}
+			wantInit := []shared.ToolInfo{
+				{Name: "Read"},
+				{Name: "mcp__docs__search", McpServer: "docs"},
+			}
+			if !reflect.DeepEqual(seen[0], wantInit) {
+				t.Errorf("Expected init tools %+v, got %+v", wantInit, seen[0])
+			}
+			wantUpdate := append(wantInit, shared.ToolInfo{Name: "mcp__git__log", McpServer: "git"})
+			if !reflect.DeepEqual(seen[1], wantUpdate) {
+				t.Errorf("Expected updated tools %+v, got %+v", wantUpdate, seen[1])
+			}
+		})
+	}
+}
+
+// TestOnResourceUpdateCallback tests MCP resource updates are passed to the
+// callback and still delivered as system messages
+func TestOnResourceUpdateCallback(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"system","subtype":"init","session_id":"s1","tools":["Read"]}'
+echo '{"type":"system","subtype":"mcp_resource_updated","session_id":"s1","server":"docs","uri":"file:///notes.md","title":"Notes"}'
+echo '{"type":"system","subtype":"mcp_resource_updated","session_id":"s1","server":"docs"}'
+`
+
+	tests := []struct {
+		name  string
+		panic bool
+	}{
+		{name: "receives_update"},
+		{name: "panic_does_not_drop_messages", panic: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			cliPath := createTransportTempScript(script, "")
+			defer func() { _ = os.Remove(cliPath) }()
+
+			var mu sync.Mutex
+			var seen []shared.ResourceUpdate
+			options := &shared.Options{
+				OnResourceUpdate: func(update shared.ResourceUpdate) {
+					mu.Lock()
+					seen = append(seen, update)
+					mu.Unlock()
+					if test.panic {
+						panic("boom")
+					}
+				},
+			}
+			transport := New(cliPath, options, true, "sdk-go")
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			msgChan, _ := transport.ReceiveMessages(ctx)
+			for i := 0; i < 3; i++ {
+				select {
+				case msg := <-msgChan:
+					if _, ok := msg.(*shared.SystemMessage); !ok {
+						t.Fatalf("Expected SystemMessage %d to be delivered, got %T", i, msg)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Timed out waiting for system message %d", i)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(seen) != 1 {
+				t.Fatalf("Expected 1 resource update, got %d: %+v", len(seen), seen)
+			}
+			got := seen[0]
+			if got.Server != "docs" || got.URI != "file:///notes.md" || got.Title != "Notes" || got.SessionID != "s1" {
+				t.Errorf("Unexpected resource update: %+v", got)
+			}
+		})
+	}
+}
+
+// TestOnStreamEventCallback tests each stream event is decoded and passed to
+// the callback
+func TestOnStreamEventCallback(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"stream_event","uuid":"e1","session_id":"s1","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}}'
+echo '{"type":"stream_event","uuid":"e2","session_id":"s1","event":{"type":"message_stop"}}'
+`
+
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	var mu sync.Mutex
+	var seen []shared.ParsedStreamEvent
+	options := &shared.Options{
+		OnStreamEvent: func(event shared.ParsedStreamEvent) {
+			mu.Lock()
+			seen = append(seen, event)
+			mu.Unlock()
+			panic("boom") // Recovered; messages are still delivered
+		},
+	}
+	transport := New(cliPath, options, true, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-msgChan:
+			if _, ok := msg.(*shared.StreamEvent); !ok {
+				t.Fatalf("Expected StreamEvent %d to be delivered, got %T", i, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for stream event %d", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 2 {
+		t.Fatalf("Expected 2 stream events, got %d", len(seen))
+	}
+	if seen[0].Delta == nil || seen[0].Delta.Text != "Hi" || seen[0].Raw.UUID != "e1" {
+		t.Errorf("Unexpected first event: %+v", seen[0])
+	}
+	if seen[1].Type != shared.StreamEventTypeMessageStop {
+		t.Errorf("Expected message_stop, got %q", seen[1].Type)
+	}
+}
+
+// TestMultibyteSplitAcrossReads tests UTF-8 runes split across stdout reads
+// are reassembled into text without replacement characters
+func TestMultibyteSplitAcrossReads(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	// "café 世界 🎉" written with every multibyte rune split between writes
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+printf '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"caf\xc3'
+sleep 0.1
+printf '\xa9 \xe4\xb8'
+sleep 0.1
+printf '\x96\xe7\x95\x8c \xf0\x9f'
+sleep 0.1
+printf '\x8e\x89"}],"model":"claude-sonnet-4-5"}}\n'
+printf '{"type":"stream_event","uuid":"e1","session_id":"s1","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"\xf0\x9f\x8e'
+sleep 0.1
+printf '\x89 \xc3\xa9"}}}\n'
+`
+
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	transport := New(cliPath, &shared.Options{}, true, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, errChan := transport.ReceiveMessages(ctx)
+	var texts []string
+	for len(texts) < 2 {
+		select {
+		case msg := <-msgChan:
+			switch m := msg.(type) {
+			case *shared.AssistantMessage:
+				if text, ok := m.Content[0].(*shared.TextBlock); ok {
+					texts = append(texts, text.Text)
+				}
+			case *shared.StreamEvent:
+				texts = append(texts, shared.ParseStreamEvent(m).Delta.Text)
+			}
+		case err := <-errChan:
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for messages, got %q", texts)
+		}
+	}
+
+	if texts[0] != "café 世界 🎉" || texts[1] != "🎉 é" {
+		t.Errorf("Expected reassembled text, got %q", texts)
+	}
+	for _, text := range texts {
+		if strings.ContainsRune(text, '\uFFFD') {
+			t.Errorf("Expected no replacement characters, got %q", text)
+		}
+	}
+}
+
+// TestRecentStderr tests the last stderr lines and CLI version are reported
+// for every stderr destination
+func TestRecentStderr(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "2.3.4"; exit 0; fi
+for i in $(seq 1 25); do echo "line $i token=secret" >&2; done
+echo >&2
+while read -r line; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	tests := []struct {
+		name    string
+		options *shared.Options
+	}{
+		{"temp_file", &shared.Options{}},
+		{"stderr_callback", &shared.Options{StderrCallback: func(string) {}}},
+		{"debug_writer", &shared.Options{DebugWriter: io.Discard}},
+		{"redacted", &shared.Options{
+			DebugWriter:            io.Discard,
+			RedactDebugOutput:      true,
+			DebugRedactionPatterns: []string{`secret`},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+			defer cancel()
+
+			transport := New(cliPath, test.options, false, "sdk-go")
+			if lines := transport.RecentStderr(); lines != nil {
+				t.Errorf("Expected no lines before Connect, got %q", lines)
+			}
+			defer disconnectTransportSafely(t, transport)
+			connectTransportSafely(ctx, t, transport)
+
+			if got := transport.CLIVersion(); got != "2.3.4" {
+				t.Errorf("Expected CLI version 2.3.4, got %q", got)
+			}
+
+			var lines []string
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				lines = transport.RecentStderr()
+				if len(lines) > 0 && strings.HasPrefix(lines[len(lines)-1], "line 25 ") {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			if len(lines) != recentStderrLines {
+				t.Fatalf("Expected %d lines, got %d: %q", recentStderrLines, len(lines), lines)
+			}
+			if !strings.HasPrefix(lines[0], "line 6 ") {
+				t.Errorf("Expected oldest kept line to be line 6, got %q", lines[0])
+			}
+			secretShown := strings.Contains(lines[0], "secret")
+			if wantShown := !test.options.RedactDebugOutput; secretShown != wantShown {
+				t.Errorf("Expected secret shown = %v, got line %q", wantShown, lines[0])
+			}
+		})
+	}
+}
+
+// TestMaxSessionDuration tests the CLI is terminated and a SessionExpiredError
+// surfaced once the session deadline elapses
+func TestMaxSessionDuration(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"system","subtype":"init","session_id":"s1"}'
+while read -r line; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	t.Run("expires_and_closes_stream", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		transport := New(cliPath, &shared.Options{MaxSessionDuration: 200 * time.Millisecond}, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		start := time.Now()
+		msgChan, errChan := transport.ReceiveMessages(ctx)
+		var expiredErr error
+		for msgChan != nil || errChan != nil {
+			select {
+			case _, ok := <-msgChan:
+				if !ok {
+					msgChan = nil
+				}
+			case err, ok := <-errChan:
+				if !ok {
+					errChan = nil
+					continue
+				}
+				expiredErr = err
+			case <-ctx.Done():
+				t.Fatal("Timed out waiting for session to expire")
+			}
+		}
+
+		expired := shared.AsSessionExpiredError(expiredErr)
+		if expired == nil {
+			t.Fatalf("Expected SessionExpiredError, got %v", expiredErr)
+		}
+		if expired.MaxDuration != 200*time.Millisecond {
+			t.Errorf("Expected MaxDuration 200ms, got %v", expired.MaxDuration)
+		}
+		if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+			t.Errorf("Session expired too early after %v", elapsed)
+		}
+	})
+
+	t.Run("fake_clock_expires_without_waiting", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		clock := claudecodetest.NewFakeClock(time.Unix(0, 0))
+		options := &shared.Options{MaxSessionDuration: 24 * time.Hour, Clock: clock}
+		transport := New(cliPath, options, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		clock.BlockUntil(1) // The deadline timer is waiting
+		clock.Advance(24 * time.Hour)
+
+		_, errChan := transport.ReceiveMessages(ctx)
+		for {
+			select {
+			case err, ok := <-errChan:
+				if !ok {
+					t.Fatal("Expected SessionExpiredError before the stream closed")
+				}
+				if shared.IsSessionExpiredError(err) {
+					return
+				}
+			case <-ctx.Done():
+				t.Fatal("Timed out waiting for session to expire")
+			}
+		}
+	})
+
+	t.Run("close_before_deadline", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		transport := New(cliPath, &shared.Options{MaxSessionDuration: time.Hour}, false, "sdk-go")
+		connectTransportSafely(ctx, t, transport)
+		_, errChan := transport.ReceiveMessages(ctx)
+
+		if err := transport.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		for err := range errChan {
+			if shared.IsSessionExpiredError(err) {
+				t.Errorf("Unexpected SessionExpiredError after Close: %v", err)
+			}
+		}
+	})
+}
+
+// TestMaxOutputBytes tests the CLI is killed and the stream ends with an
+// OutputLimitExceededError once its output exceeds the byte cap
+func TestMaxOutputBytes(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	// Each line is 72 bytes including the newline. The CLI keeps writing
+	// until it is killed.
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+for i in 1 2 3; do
+  echo '{"type":"system","subtype":"status","session_id":"s1","data":"xxxxxxx"}'
+done
+if [ -n "$ENDLESS" ]; then
+  while true; do
+    echo '{"type":"system","subtype":"status","session_id":"s1","data":"xxxxxxx"}'
+  done
+fi
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	receiveAll := func(ctx context.Context, t *testing.T, transport *Transport) (int, []error) {
+		t.Helper()
+		msgChan, errChan := transport.ReceiveMessages(ctx)
+		var count int
+		var errs []error
+		for msgChan != nil || errChan != nil {
+			select {
+			case _, ok := <-msgChan:
+				if !ok {
+					msgChan = nil
+					continue
+				}
+				count++
+			case err, ok := <-errChan:
+				if !ok {
+					errChan = nil
+					continue
+				}
+				errs = append(errs, err)
+			case <-ctx.Done():
+				t.Fatal("Timed out waiting for stream to close")
+			}
+		}
+		return count, errs
+	}
+
+	t.Run("exceeded_kills_cli", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		options := &shared.Options{
+			MaxOutputBytes: 200,
+			ExtraEnv:       map[string]string{"ENDLESS": "1"},
+		}
+		transport := New(cliPath, options, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		count, errs := receiveAll(ctx, t, transport)
+		if count != 2 {
+			t.Errorf("Expected 2 messages within the 200 byte limit, got %d", count)
+		}
+		if len(errs) != 1 {
+			t.Fatalf("Expected 1 error, got %v", errs)
+		}
+		limitErr := shared.AsOutputLimitExceededError(errs[0])
+		if limitErr == nil {
+			t.Fatalf("Expected OutputLimitExceededError, got %v", errs[0])
+		}
+		if limitErr.Limit != 200 {
+			t.Errorf("Expected Limit 200, got %d", limitErr.Limit)
+		}
+	})
+
+	t.Run("within_limit", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		transport := New(cliPath, &shared.Options{MaxOutputBytes: 216}, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		count, errs := receiveAll(ctx, t, transport)
+		if count != 3 {
+			t.Errorf("Expected all 3 messages, got %d", count)
+		}
+		for _, err := range errs {
+			if shared.IsOutputLimitExceededError(err) {
+				t.Errorf("Unexpected OutputLimitExceededError at exactly the limit: %v", err)
+			}
+		}
+	})
+}
+
+// TestGracefulInterruptOnCancel tests cancelling the connect context sends an
+// interrupt and only kills the CLI once the grace period has elapsed
+func TestGracefulInterruptOnCancel(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	t.Run("cli_exits_after_interrupt", func(t *testing.T) {
+		capturePath := filepath.Join(t.TempDir(), "stdin.jsonl")
+		script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+while read -r line; do
+  echo "$line" >> "` + capturePath + `"
+  if [[ "$line" == *'"subtype":"interrupt"'* ]]; then
+    [[ "$line" =~ \"request_id\":\"([^\"]+)\" ]] && id="${BASH_REMATCH[1]}"
+    echo "{\"type\":\"control_response\",\"response\":{\"subtype\":\"success\",\"request_id\":\"$id\"}}"
+  fi
+done
+exit 0
+`
+		cliPath := createTransportTempScript(script, "")
+		defer func() { _ = os.Remove(cliPath) }()
+
+		testCtx, testCancel := setupTransportTestContext(t, 10*time.Second)
+		defer testCancel()
+		ctx, cancel := context.WithCancel(testCtx)
+
+		transport := New(cliPath, &shared.Options{GracefulInterruptGrace: 5 * time.Second}, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+		msgChan, _ := transport.ReceiveMessages(testCtx)
+
+		start := time.Now()
+		cancel()
+		waitForStreamClose(testCtx, t, msgChan)
+
+		if elapsed := time.Since(start); elapsed >= 5*time.Second {
+			t.Errorf("Expected CLI to exit on interrupt before the grace period, took %v", elapsed)
+		}
+		if line := waitForCapturedLine(t, capturePath); !strings.Contains(line, `"subtype":"interrupt"`) {
+			t.Errorf("Expected interrupt control request, got %s", line)
+		}
+	})
+
+	t.Run("cli_killed_after_grace", func(t *testing.T) {
+		capturePath := filepath.Join(t.TempDir(), "stdin.jsonl")
+		script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+trap '' INT
+while read -r line; do echo "$line" >> "` + capturePath + `"; done
+while true; do sleep 0.05; done
+`
+		cliPath := createTransportTempScript(script, "")
+		defer func() { _ = os.Remove(cliPath) }()
+
+		testCtx, testCancel := setupTransportTestContext(t, 10*time.Second)
+		defer testCancel()
+		ctx, cancel := context.WithCancel(testCtx)
+
+		grace := 300 * time.Millisecond
+		transport := New(cliPath, &shared.Options{GracefulInterruptGrace: grace}, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+		msgChan, _ := transport.ReceiveMessages(testCtx)
+
+		start := time.Now()
+		cancel()
+		waitForStreamClose(testCtx, t, msgChan)
+
+		if elapsed := time.Since(start); elapsed < grace {
+			t.Errorf("Expected CLI to be killed only after the grace period, took %v", elapsed)
+		}
+		if line := waitForCapturedLine(t, capturePath); !strings.Contains(line, `"subtype":"interrupt"`) {
+			t.Errorf("Expected interrupt control request before kill, got %s", line)
+		}
+	})
+}
+
+// waitForStreamClose drains msgChan until the transport closes it.
+func waitForStreamClose(ctx context.Context, t *testing.T, msgChan <-chan shared.Message) {
+	t.Helper()
+	for {
+		select {
+		case _, ok := <-msgChan:
+			if !ok {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the message stream to close")
+		}
+	}
+}
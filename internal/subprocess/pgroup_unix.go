@@ -0,0 +1,38 @@
+//go:build !windows
+
+package subprocess
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// configureProcessGroup starts the CLI in a new process group led by the CLI,
+// so every process it spawns can be signaled together.
+func (t *Transport) configureProcessGroup() {
+	if t.options == nil || !t.options.ProcessGroupKill {
+		return
+	}
+	if t.cmd.SysProcAttr == nil {
+		t.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	t.cmd.SysProcAttr.Setpgid = true
+}
+
+// startedInProcessGroup reports whether cmd was started as the leader of its
+// own process group. A CmdCustomizer may have replaced SysProcAttr.
+func startedInProcessGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid && cmd.SysProcAttr.Pgid == 0
+}
+
+// signalProcessGroup sends sig to every process in the group led by pid.
+// A group with no processes left reports os.ErrProcessDone.
+func signalProcessGroup(pid int, sig syscall.Signal) error {
+	err := syscall.Kill(-pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
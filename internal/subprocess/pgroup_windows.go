@@ -0,0 +1,35 @@
+//go:build windows
+
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// configureProcessGroup warns that process group kill is unsupported on this
+// platform. Only the CLI process itself is killed.
+func (t *Transport) configureProcessGroup() {
+	if t.options == nil || !t.options.ProcessGroupKill {
+		return
+	}
+	warning := fmt.Sprintf("Warning: process group kill is not supported on %s; only the CLI process is killed", runtime.GOOS)
+	if t.options.StderrCallback != nil {
+		t.options.StderrCallback(warning)
+	}
+	t.debugf("%s", warning)
+}
+
+// startedInProcessGroup reports false: the CLI never leads a process group
+// the SDK can signal.
+func startedInProcessGroup(*exec.Cmd) bool {
+	return false
+}
+
+// signalProcessGroup is never called on this platform.
+func signalProcessGroup(int, syscall.Signal) error {
+	return os.ErrProcessDone
+}
@@ -0,0 +1,136 @@
+package subprocess
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// toolResultProcessor returns the function applied to SDK-mediated tool
+// results in a session: the post-processor, then the item limit, then
+// deduplication. Returns nil if none is configured.
+func (t *Transport) toolResultProcessor() func(sessionID, toolName string, content any) any {
+	var stages []func(string, string, any) any
+	if t.options != nil && t.options.ToolResultPostProcessor != nil {
+		postProcess := t.options.ToolResultPostProcessor
+		stages = append(stages, func(_, toolName string, content any) any {
+			return postProcess(toolName, content)
+		})
+	}
+	if t.options != nil && t.options.ToolResultMaxItems > 0 {
+		maxItems := t.options.ToolResultMaxItems
+		stages = append(stages, func(_, _ string, content any) any {
+			return shared.TruncateToolResultItems(content, maxItems)
+		})
+	}
+	if t.toolResultDedup != nil {
+		stages = append(stages, t.toolResultDedup.Process)
+	}
+
+	switch len(stages) {
+	case 0:
+		return nil
+	case 1:
+		return stages[0]
+	}
+	return func(sessionID, toolName string, content any) any {
+		for _, stage := range stages {
+			content = stage(sessionID, toolName, content)
+		}
+		return content
+	}
+}
+
+// mcpToolResultProcessor returns the tool result processor for SDK MCP tool
+// results, which belong to the session of the turn in progress. Returns nil
+// if none is configured.
+func (t *Transport) mcpToolResultProcessor() func(toolName string, content any) any {
+	processor := t.toolResultProcessor()
+	if processor == nil {
+		return nil
+	}
+	return func(toolName string, content any) any {
+		turn, _ := t.currentTurn()
+		return processor(turn.sessionID, toolName, content)
+	}
+}
+
+// trackToolNames records tool_use IDs and names from assistant messages so
+// tool results sent later can be matched to the tool that produced them.
+// Only tracks when tool results are processed.
+func (t *Transport) trackToolNames(msg shared.Message) {
+	if t.toolResultProcessor() == nil {
+		return
+	}
+	assistant, ok := msg.(*shared.AssistantMessage)
+	if !ok {
+		return
+	}
+
+	t.toolNamesMu.Lock()
+	defer t.toolNamesMu.Unlock()
+	for _, block := range assistant.Content {
+		if toolUse, ok := block.(*shared.ToolUseBlock); ok {
+			if t.toolNames == nil {
+				t.toolNames = make(map[string]string)
+			}
+			t.toolNames[toolUse.ToolUseID] = toolUse.Name
+		}
+	}
+}
+
+// toolName returns the tool name recorded for a tool_use ID, or "" if unknown.
+func (t *Transport) toolName(toolUseID string) string {
+	t.toolNamesMu.Lock()
+	defer t.toolNamesMu.Unlock()
+	return t.toolNames[toolUseID]
+}
+
+// postProcessToolResults applies the tool result processing stages to every
+// tool_result block in a serialized user message.
+// Frames without tool results are returned unchanged.
+func (t *Transport) postProcessToolResults(data []byte) ([]byte, error) {
+	processor := t.toolResultProcessor()
+	if processor == nil {
+		return data, nil
+	}
+
+	var frame map[string]any
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return data, nil //nolint:nilerr // Not a JSON object; nothing to process
+	}
+	message, _ := frame["message"].(map[string]any)
+	blocks, _ := message["content"].([]any)
+	sessionID, _ := frame["session_id"].(string)
+
+	processed := false
+	for _, raw := range blocks {
+		block, ok := raw.(map[string]any)
+		if !ok || block["type"] != shared.ContentBlockTypeToolResult {
+			continue
+		}
+		toolUseID, _ := block["tool_use_id"].(string)
+		block["content"] = processToolResult(processor, sessionID, t.toolName(toolUseID), block["content"])
+		processed = true
+	}
+	if !processed {
+		return data, nil
+	}
+
+	result, err := json.Marshal(frame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal post-processed message: %w", err)
+	}
+	return result, nil
+}
+
+// processToolResult calls processor, keeping the original content on panic.
+func processToolResult(processor func(string, string, any) any, sessionID, toolName string, content any) (result any) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = content
+		}
+	}()
+	return processor(sessionID, toolName, content)
+}
@@ -0,0 +1,280 @@
+package subprocess
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// TestToolResultPostProcessorSerializedMessage tests injected tool results are
+// transformed in the user message written to the CLI
+func TestToolResultPostProcessorSerializedMessage(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	capturePath := filepath.Join(t.TempDir(), "stdin.jsonl")
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_01","name":"Bash","input":{"command":"make"}}],"model":"claude-sonnet-4-5"}}'
+while read -r line; do echo "$line" >> "` + capturePath + `"; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	var seenTool string
+	options := &shared.Options{
+		ToolResultPostProcessor: func(toolName string, content any) any {
+			seenTool = toolName
+			text, _ := content.(string)
+			return "[" + toolName + "] " + strings.ToUpper(text)
+		},
+	}
+	transport := New(cliPath, options, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	// Receive the tool_use so its name is known before the result is injected
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	select {
+	case <-msgChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for tool_use message")
+	}
+
+	err := transport.SendMessage(ctx, shared.StreamMessage{
+		Type: "user",
+		Message: map[string]any{
+			"role": "user",
+			"content": []any{
+				map[string]any{"type": "tool_result", "tool_use_id": "toolu_01", "content": "build ok"},
+				map[string]any{"type": "text", "text": "untouched"},
+			},
+		},
+		SessionID: "s1",
+	})
+	assertNoTransportError(t, err)
+
+	line := waitForCapturedLine(t, capturePath)
+	var frame struct {
+		Message struct {
+			Content []map[string]any `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(line), &frame); err != nil {
+		t.Fatalf("Failed to parse serialized message %q: %v", line, err)
+	}
+
+	if seenTool != "Bash" {
+		t.Errorf("Expected tool name Bash, got %q", seenTool)
+	}
+	if got := frame.Message.Content[0]["content"]; got != "[Bash] BUILD OK" {
+		t.Errorf("Expected processed tool result, got %v", got)
+	}
+	if got := frame.Message.Content[1]["text"]; got != "untouched" {
+		t.Errorf("Expected text block unchanged, got %v", got)
+	}
+}
+
+// TestToolResultDeduplication tests a repeated tool result is replaced with a
+// note in the second user message written to the CLI, but not in another session
+func TestToolResultDeduplication(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	capturePath := filepath.Join(t.TempDir(), "stdin.jsonl")
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_01","name":"Read","input":{"file_path":"main.go"}},{"type":"tool_use","id":"toolu_02","name":"Read","input":{"file_path":"main.go"}}],"model":"claude-sonnet-4-5"}}'
+while read -r line; do echo "$line" >> "` + capturePath + `"; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	transport := New(cliPath, &shared.Options{ToolResultDeduplication: true}, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	select {
+	case <-msgChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for tool_use message")
+	}
+
+	fileContent := strings.Repeat("package main\n", 200)
+	sends := []struct{ toolUseID, sessionID string }{{"toolu_01", "s1"}, {"toolu_02", "s1"}, {"toolu_02", "s2"}}
+	for _, send := range sends {
+		err := transport.SendMessage(ctx, shared.StreamMessage{
+			Type: "user",
+			Message: map[string]any{
+				"role": "user",
+				"content": []any{
+					map[string]any{"type": "tool_result", "tool_use_id": send.toolUseID, "content": fileContent},
+				},
+			},
+			SessionID: send.sessionID,
+		})
+		assertNoTransportError(t, err)
+	}
+
+	var data []byte
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(string(data), "\n") < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		data, _ = os.ReadFile(capturePath) // #nosec G304 - Test reads its own temp file
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("Expected 3 captured messages, got %d", len(lines)-1)
+	}
+
+	contents := make([]any, 3)
+	for i, line := range lines[:3] {
+		var frame struct {
+			Message struct {
+				Content []map[string]any `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			t.Fatalf("Failed to parse serialized message %q: %v", line, err)
+		}
+		contents[i] = frame.Message.Content[0]["content"]
+	}
+
+	if contents[0] != fileContent {
+		t.Errorf("Expected first result unchanged, got %.60v", contents[0])
+	}
+	note, _ := contents[1].(string)
+	if !strings.HasPrefix(note, "[Duplicate tool result") || !strings.Contains(note, "earlier Read result") {
+		t.Errorf("Expected second result deduplicated, got %.60q", note)
+	}
+	if contents[2] != fileContent {
+		t.Errorf("Expected result in another session unchanged, got %.60v", contents[2])
+	}
+}
+
+// TestPostProcessToolResults tests frame rewriting edge cases
+func TestPostProcessToolResults(t *testing.T) {
+	frame := []byte(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_x","content":"out"}]}}`)
+
+	t.Run("no_processor_unchanged", func(t *testing.T) {
+		transport := &Transport{options: &shared.Options{}}
+		data, err := transport.postProcessToolResults(frame)
+		assertNoTransportError(t, err)
+		if string(data) != string(frame) {
+			t.Errorf("Expected frame unchanged, got %s", data)
+		}
+	})
+
+	t.Run("no_tool_results_unchanged", func(t *testing.T) {
+		transport := &Transport{options: &shared.Options{
+			ToolResultPostProcessor: func(string, any) any { return "changed" },
+		}}
+		plain := []byte(`{"type":"user","message":{"role":"user","content":"hello"}}`)
+		data, err := transport.postProcessToolResults(plain)
+		assertNoTransportError(t, err)
+		if string(data) != string(plain) {
+			t.Errorf("Expected frame unchanged, got %s", data)
+		}
+	})
+
+	t.Run("deduplicates_after_post_processing", func(t *testing.T) {
+		large := []byte(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_x","content":"` +
+			strings.Repeat("x", shared.MinDeduplicatedToolResultBytes) + `"}]}}`)
+		transport := &Transport{
+			options: &shared.Options{
+				ToolResultPostProcessor: func(_ string, content any) any {
+					text, _ := content.(string)
+					return strings.ToUpper(text)
+				},
+			},
+			toolResultDedup: shared.NewToolResultDeduplicator(),
+		}
+		first, err := transport.postProcessToolResults(large)
+		assertNoTransportError(t, err)
+		if !strings.Contains(string(first), strings.Repeat("X", 100)) {
+			t.Errorf("Expected post-processed first result, got %.120s", first)
+		}
+		second, err := transport.postProcessToolResults(large)
+		assertNoTransportError(t, err)
+		if !strings.Contains(string(second), "[Duplicate tool result") {
+			t.Errorf("Expected deduplicated second result, got %.120s", second)
+		}
+	})
+
+	t.Run("truncates_items_after_post_processing", func(t *testing.T) {
+		items := []byte(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_x","content":[` +
+			`{"type":"text","text":"a"},{"type":"text","text":"b"},{"type":"text","text":"c"},{"type":"text","text":"d"}]}]}}`)
+		transport := &Transport{options: &shared.Options{
+			ToolResultPostProcessor: func(_ string, content any) any {
+				list, _ := content.([]any)
+				return append(list, map[string]any{"type": "text", "text": "e"})
+			},
+			ToolResultMaxItems: 2,
+		}}
+		data, err := transport.postProcessToolResults(items)
+		assertNoTransportError(t, err)
+		var frame struct {
+			Message struct {
+				Content []struct {
+					Content []map[string]any `json:"content"`
+				} `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(data, &frame); err != nil {
+			t.Fatalf("Failed to parse rewritten frame %s: %v", data, err)
+		}
+		got := frame.Message.Content[0].Content
+		if len(got) != 3 || got[0]["text"] != "a" || got[1]["text"] != "b" {
+			t.Fatalf("Expected first 2 items and a note, got %v", got)
+		}
+		if got[2]["text"] != "[Tool result truncated: 3 of 5 content items omitted]" {
+			t.Errorf("Expected truncation note, got %v", got[2]["text"])
+		}
+	})
+
+	t.Run("unknown_tool_and_panic_recovery", func(t *testing.T) {
+		seenTool := "unset"
+		transport := &Transport{options: &shared.Options{
+			ToolResultPostProcessor: func(toolName string, _ any) any {
+				seenTool = toolName
+				panic("boom")
+			},
+		}}
+		data, err := transport.postProcessToolResults(frame)
+		assertNoTransportError(t, err)
+		if seenTool != "" {
+			t.Errorf("Expected empty tool name for unknown tool_use, got %q", seenTool)
+		}
+		if !strings.Contains(string(data), `"content":"out"`) {
+			t.Errorf("Expected original content after panic, got %s", data)
+		}
+	})
+}
+
+// waitForCapturedLine polls a capture file until it contains a line.
+func waitForCapturedLine(t *testing.T, path string) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(path) // #nosec G304 - Test reads its own temp file
+		if err == nil && strings.HasSuffix(string(data), "\n") {
+			return strings.SplitN(string(data), "\n", 2)[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for captured stdin in %s", path)
+	return ""
+}
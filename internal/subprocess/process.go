@@ -1,10 +1,13 @@
 package subprocess
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
 // isProcessAlreadyFinishedError checks if an error indicates the process has already terminated.
@@ -20,20 +23,62 @@ func isProcessAlreadyFinishedError(err error) bool {
 		strings.Contains(errStr, "signal: killed")
 }
 
+// customizeCmd passes the configured command to the CmdCustomizer, if any.
+// A panicking customizer is reported as a connection error.
+func (t *Transport) customizeCmd() (err error) {
+	if t.options == nil || t.options.CmdCustomizer == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = shared.NewConnectionError(fmt.Sprintf("cmd customizer panicked: %v", r), nil)
+		}
+	}()
+	t.options.CmdCustomizer(t.cmd)
+	return nil
+}
+
+// signalProcess sends sig to the CLI process, or to its whole process group
+// if it leads one.
+func (t *Transport) signalProcess(process *os.Process, sig syscall.Signal) error {
+	if t.processGroup {
+		return signalProcessGroup(process.Pid, sig)
+	}
+	return process.Signal(sig)
+}
+
+// killProcess kills the CLI process, or its whole process group if it leads
+// one.
+func (t *Transport) killProcess(process *os.Process) error {
+	if t.processGroup {
+		return signalProcessGroup(process.Pid, syscall.SIGKILL)
+	}
+	return process.Kill()
+}
+
+// killProcessGroup kills any processes left in the CLI's process group, such
+// as MCP servers that outlived the CLI.
+func (t *Transport) killProcessGroup(process *os.Process) {
+	if t.processGroup {
+		_ = signalProcessGroup(process.Pid, syscall.SIGKILL)
+	}
+}
+
 // terminateProcess implements the 5-second SIGTERM -> SIGKILL sequence
 func (t *Transport) terminateProcess() error {
 	if t.cmd == nil || t.cmd.Process == nil {
 		return nil
 	}
+	defer t.killProcessGroup(t.cmd.Process)
 
 	// Send SIGTERM
-	if err := t.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+	if err := t.signalProcess(t.cmd.Process, syscall.SIGTERM); err != nil {
 		// If process is already finished, that's success
 		if isProcessAlreadyFinishedError(err) {
 			return nil
 		}
 		// If SIGTERM fails for other reasons, try SIGKILL immediately
-		killErr := t.cmd.Process.Kill()
+		killErr := t.killProcess(t.cmd.Process)
 		if killErr != nil && !isProcessAlreadyFinishedError(killErr) {
 			return killErr
 		}
@@ -60,7 +105,7 @@ func (t *Transport) terminateProcess() error {
 		return err
 	case <-time.After(terminationTimeoutSeconds * time.Second):
 		// Force kill after 5 seconds
-		if killErr := t.cmd.Process.Kill(); killErr != nil && !isProcessAlreadyFinishedError(killErr) {
+		if killErr := t.killProcess(t.cmd.Process); killErr != nil && !isProcessAlreadyFinishedError(killErr) {
 			return killErr
 		}
 		// Wait for process to exit after kill
@@ -68,7 +113,7 @@ func (t *Transport) terminateProcess() error {
 		return nil
 	case <-t.ctx.Done():
 		// Context canceled - force kill immediately
-		if killErr := t.cmd.Process.Kill(); killErr != nil && !isProcessAlreadyFinishedError(killErr) {
+		if killErr := t.killProcess(t.cmd.Process); killErr != nil && !isProcessAlreadyFinishedError(killErr) {
 			return killErr
 		}
 		// Wait for process to exit after kill, but don't return context error
@@ -98,6 +143,12 @@ func (t *Transport) cleanup() {
 		t.stderr = nil
 	}
 
+	if t.redactedStderr != nil {
+		// Write any trailing partial line of redacted debug output
+		_ = t.redactedStderr.Flush()
+		t.redactedStderr = nil
+	}
+
 	if t.mcpConfigFile != nil {
 		// Clean up temporary MCP config file
 		_ = t.mcpConfigFile.Close()
@@ -2,9 +2,17 @@ package subprocess
 
 import (
 	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
 // TestTransportProcessManagement tests process control and termination
@@ -107,3 +115,193 @@ func TestTransportTerminateProcessPaths(t *testing.T) {
 		assertNoTransportError(t, err)
 	})
 }
+
+// TestCmdCustomizer tests the customizer sees the configured command before
+// it starts and its changes reach the CLI process
+func TestCmdCustomizer(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+echo "{\"type\":\"system\",\"subtype\":\"status\",\"marker\":\"$CUSTOM_MARKER\"}"
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	t.Run("invoked_with_configured_command", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		cwd := t.TempDir()
+		var calls int
+		var seen *exec.Cmd
+		var started bool
+		options := &shared.Options{
+			Cwd: &cwd,
+			CmdCustomizer: func(cmd *exec.Cmd) {
+				calls++
+				seen = cmd
+				started = cmd.Process != nil
+				cmd.Env = append(cmd.Env, "CUSTOM_MARKER=customized")
+			},
+		}
+		transport := New(cliPath, options, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+		connectTransportSafely(ctx, t, transport)
+
+		if calls != 1 {
+			t.Fatalf("Expected customizer to be called once, got %d", calls)
+		}
+		if seen != transport.cmd {
+			t.Error("Expected customizer to receive the transport's command")
+		}
+		if started {
+			t.Error("Expected customizer to run before the process starts")
+		}
+		if seen.Path != cliPath || seen.Dir != cwd {
+			t.Errorf("Expected configured path and dir, got %q in %q", seen.Path, seen.Dir)
+		}
+		if !strings.Contains(strings.Join(seen.Args, " "), "--output-format stream-json") {
+			t.Errorf("Expected configured arguments, got %q", seen.Args)
+		}
+		if seen.Stdout == nil {
+			t.Error("Expected stdout to be configured before the customizer runs")
+		}
+
+		msgChan, errChan := transport.ReceiveMessages(ctx)
+		select {
+		case msg := <-msgChan:
+			system, ok := msg.(*shared.SystemMessage)
+			if !ok || system.Data["marker"] != "customized" {
+				t.Errorf("Expected customized environment in the CLI, got %#v", msg)
+			}
+		case err := <-errChan:
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for message")
+		}
+	})
+
+	t.Run("panic_fails_connect", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		options := &shared.Options{CmdCustomizer: func(*exec.Cmd) { panic("boom") }}
+		transport := New(cliPath, options, false, "sdk-go")
+		defer disconnectTransportSafely(t, transport)
+
+		err := transport.Connect(ctx)
+		if err == nil || !strings.Contains(err.Error(), "cmd customizer panicked: boom") {
+			t.Fatalf("Expected customizer panic error, got %v", err)
+		}
+		if !shared.IsConnectionError(err) {
+			t.Errorf("Expected ConnectionError, got %T", err)
+		}
+		assertTransportConnected(t, transport, false)
+	})
+}
+
+// TestProcessGroupKill tests closing the transport kills a process the CLI
+// forked when the CLI runs in its own process group, and orphans it otherwise
+func TestProcessGroupKill(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("process groups require a POSIX platform")
+	}
+	// The forked child inherits fd 3, the write end of a pipe; the read end
+	// sees EOF once the CLI and the child have both exited
+	pidPath := filepath.Join(t.TempDir(), "child.pid")
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+sleep 600 >/dev/null 2>&1 &
+echo "$!" > "` + pidPath + `"
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	// stopAndWaitForExit closes the transport, or with cancelCtx cancels the
+	// Connect context, and reports whether every holder of the pipe exited
+	// within the timeout
+	stopAndWaitForExit := func(t *testing.T, groupKill, cancelCtx bool) bool {
+		t.Helper()
+		testCtx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+		ctx, cancelConnect := context.WithCancel(testCtx)
+		defer cancelConnect()
+
+		_ = os.Remove(pidPath)
+		r, w, err := os.Pipe()
+		assertNoTransportError(t, err)
+		defer func() { _ = r.Close() }()
+
+		options := &shared.Options{
+			ProcessGroupKill: groupKill,
+			CmdCustomizer:    func(cmd *exec.Cmd) { cmd.ExtraFiles = []*os.File{w} },
+		}
+		transport := New(cliPath, options, false, "sdk-go")
+		connectTransportSafely(ctx, t, transport)
+		_ = w.Close()
+		childPID := waitForChildPID(t, pidPath)
+
+		if transport.processGroup != groupKill {
+			t.Errorf("Expected processGroup %v, got %v", groupKill, transport.processGroup)
+		}
+		if cancelCtx {
+			defer disconnectTransportSafely(t, transport)
+			cancelConnect()
+		} else {
+			assertNoTransportError(t, transport.Close())
+		}
+
+		exited := make(chan struct{})
+		go func() {
+			_, _ = io.Copy(io.Discard, r)
+			close(exited)
+		}()
+		select {
+		case <-exited:
+			return true
+		case <-time.After(3 * time.Second):
+			// Clean up the orphan so it does not outlive the test
+			if child, err := os.FindProcess(childPID); err == nil {
+				_ = child.Kill()
+			}
+			return false
+		}
+	}
+
+	t.Run("kills_forked_child", func(t *testing.T) {
+		if !stopAndWaitForExit(t, true, false) {
+			t.Error("Expected the forked child to be killed with the CLI")
+		}
+	})
+
+	t.Run("context_cancel_kills_forked_child", func(t *testing.T) {
+		if !stopAndWaitForExit(t, true, true) {
+			t.Error("Expected the forked child to be killed when the context is cancelled")
+		}
+	})
+
+	t.Run("orphans_child_without_option", func(t *testing.T) {
+		if stopAndWaitForExit(t, false, false) {
+			t.Error("Expected the forked child to outlive the CLI without process group kill")
+		}
+	})
+}
+
+// waitForChildPID polls a file for the PID written by the mock CLI.
+func waitForChildPID(t *testing.T, path string) int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(path) // #nosec G304 - Test reads its own temp file
+		if pid, convErr := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && convErr == nil {
+			return pid
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for child PID in %s", path)
+	return 0
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// applyResourceLimits sets the configured rlimits on the started CLI process.
+// Go's SysProcAttr cannot carry rlimits, so they are applied with prlimit(2)
+// immediately after the process starts; processes the CLI spawns inherit them.
+func (t *Transport) applyResourceLimits() error {
+	if t.options == nil || t.options.ResourceLimits == nil {
+		return nil
+	}
+	limits := t.options.ResourceLimits
+	pid := t.cmd.Process.Pid
+
+	if limits.MaxMemoryBytes > 0 {
+		if err := setProcessRlimit(pid, syscall.RLIMIT_AS, limits.MaxMemoryBytes); err != nil {
+			return fmt.Errorf("memory limit: %w", err)
+		}
+	}
+	if limits.MaxCPUSeconds > 0 {
+		if err := setProcessRlimit(pid, syscall.RLIMIT_CPU, limits.MaxCPUSeconds); err != nil {
+			return fmt.Errorf("CPU limit: %w", err)
+		}
+	}
+	return nil
+}
+
+// setProcessRlimit sets both the soft and hard limit of a resource for pid.
+func setProcessRlimit(pid, resource int, value uint64) error {
+	limit := syscall.Rlimit{Cur: value, Max: value}
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+		uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(&limit)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// TestResourceLimitsApplied tests rlimits are set on the spawned CLI process
+func TestResourceLimitsApplied(t *testing.T) {
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	const memoryLimit uint64 = 16 << 30
+	options := &shared.Options{
+		ResourceLimits: &shared.ResourceLimits{MaxMemoryBytes: memoryLimit, MaxCPUSeconds: 300},
+	}
+	transport := New(cliPath, options, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	limits := readProcessLimits(t, transport.cmd.Process.Pid)
+	wantLines := map[string]string{
+		"Max cpu time":      "300 300 seconds",
+		"Max address space": fmt.Sprintf("%d %d bytes", memoryLimit, memoryLimit),
+	}
+	for name, want := range wantLines {
+		if got := limits[name]; got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+// TestResourceLimitsUnsetLeavesDefaults tests zero fields are not limited
+func TestResourceLimitsUnsetLeavesDefaults(t *testing.T) {
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+while read -r _; do :; done
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	parent := readProcessLimits(t, os.Getpid())
+	options := &shared.Options{ResourceLimits: &shared.ResourceLimits{MaxCPUSeconds: 60}}
+	transport := New(cliPath, options, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	limits := readProcessLimits(t, transport.cmd.Process.Pid)
+	if limits["Max address space"] != parent["Max address space"] {
+		t.Errorf("Expected address space limit inherited as %q, got %q",
+			parent["Max address space"], limits["Max address space"])
+	}
+	if limits["Max cpu time"] != "60 60 seconds" {
+		t.Errorf("Expected CPU limit %q, got %q", "60 60 seconds", limits["Max cpu time"])
+	}
+}
+
+// readProcessLimits parses /proc/<pid>/limits into "soft hard units" by limit name.
+func readProcessLimits(t *testing.T, pid int) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		t.Fatalf("Failed to read process limits: %v", err)
+	}
+	limits := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if len(line) < 26 {
+			continue
+		}
+		// Limit names occupy a fixed-width first column
+		name := strings.TrimSpace(line[:26])
+		limits[name] = strings.Join(strings.Fields(line[26:]), " ")
+	}
+	return limits
+}
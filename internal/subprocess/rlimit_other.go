@@ -0,0 +1,22 @@
+//go:build !linux
+
+package subprocess
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// applyResourceLimits warns that resource limits are unsupported on this
+// platform. The CLI runs without them.
+func (t *Transport) applyResourceLimits() error {
+	if t.options == nil || t.options.ResourceLimits == nil {
+		return nil
+	}
+	warning := fmt.Sprintf("Warning: resource limits are not supported on %s and were not applied", runtime.GOOS)
+	if t.options.StderrCallback != nil {
+		t.options.StderrCallback(warning)
+	}
+	t.debugf("%s", warning)
+	return nil
+}
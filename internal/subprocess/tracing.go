@@ -0,0 +1,101 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// errTurnNotCompleted ends turn spans still open when the stream ends.
+var errTurnNotCompleted = errors.New("connection ended before the turn completed")
+
+// startTurnSpan opens a turn span if a tracer is configured, returning its
+// context and the span, or nils without a tracer.
+func (t *Transport) startTurnSpan(ctx context.Context, sessionID, queryID string) (context.Context, shared.Span) {
+	if t.options == nil || t.options.Tracer == nil {
+		return nil, nil
+	}
+	attributes := make(map[string]any)
+	if sessionID != "" {
+		attributes["session_id"] = sessionID
+	}
+	if queryID != "" {
+		attributes["query_id"] = queryID
+	}
+	return t.options.Tracer.StartSpan(ctx, shared.SpanNameTurn, attributes)
+}
+
+// currentTurnContext returns the span context of the oldest pending turn, or nil.
+func (t *Transport) currentTurnContext() context.Context {
+	turn, _ := t.currentTurn()
+	return turn.spanCtx
+}
+
+// traceMcpServer wraps server so its tool calls are traced, if a tracer is configured.
+func (t *Transport) traceMcpServer(name string, server shared.McpServer) shared.McpServer {
+	if t.options == nil || t.options.Tracer == nil {
+		return server
+	}
+	return &tracedMcpServer{
+		McpServer:   server,
+		name:        name,
+		tracer:      t.options.Tracer,
+		turnContext: t.currentTurnContext,
+	}
+}
+
+// tracedMcpServer opens a tool call span around each CallTool, as a child of
+// the active turn span when there is one.
+type tracedMcpServer struct {
+	shared.McpServer
+	name        string
+	tracer      shared.Tracer
+	turnContext func() context.Context
+}
+
+// CallTool calls the wrapped server's tool inside a tool call span.
+// Tool results with IsError set end the span with an error.
+func (s *tracedMcpServer) CallTool(ctx context.Context, name string, args map[string]any) (*shared.McpToolResult, error) {
+	parent := ctx
+	if turnCtx := s.turnContext(); turnCtx != nil {
+		parent = spanParentContext{Context: ctx, spans: turnCtx}
+	}
+	ctx, span := s.tracer.StartSpan(parent, shared.SpanNameToolCall, map[string]any{
+		"mcp.server": s.name,
+		"tool.name":  fmt.Sprintf("mcp__%s__%s", s.name, name),
+	})
+
+	ended := false
+	defer func() {
+		if !ended {
+			// The handler panicked; the protocol recovers and reports it
+			span.End(fmt.Errorf("tool %s panicked", name))
+		}
+	}()
+
+	result, err := s.McpServer.CallTool(ctx, name, args)
+	spanErr := err
+	if err == nil && result != nil && result.IsError {
+		spanErr = fmt.Errorf("tool %s returned an error result", name)
+	}
+	ended = true
+	span.End(spanErr)
+	return result, err
+}
+
+// spanParentContext keeps the cancellation of the tool call's context while
+// taking values, such as the tracer's current span, from the turn span's.
+type spanParentContext struct {
+	context.Context
+	spans context.Context
+}
+
+// Value looks key up in the turn span's context first.
+func (c spanParentContext) Value(key any) any {
+	if value := c.spans.Value(key); value != nil {
+		return value
+	}
+	return c.Context.Value(key)
+}
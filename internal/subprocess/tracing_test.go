@@ -0,0 +1,276 @@
+package subprocess
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// TestTurnSpans tests a turn span opens on send and ends at its result, or
+// with an error when the stream ends first. Tool results sent mid-turn do
+// not open spans of their own.
+func TestTurnSpans(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+read -r _
+read -r _
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+read -r _
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	tracer := &fakeTracer{}
+	transport := New(cliPath, &shared.Options{Tracer: tracer}, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1", QueryID: "q1"})
+	assertNoTransportError(t, err)
+	err = transport.SendMessage(ctx, shared.StreamMessage{
+		Type: "user",
+		Message: map[string]interface{}{
+			"role":    "user",
+			"content": []map[string]interface{}{{"type": "tool_result", "tool_use_id": "toolu_1"}},
+		},
+		SessionID: "s1",
+	})
+	assertNoTransportError(t, err)
+
+	msgChan, _ := transport.ReceiveMessages(ctx)
+	select {
+	case msg := <-msgChan:
+		if _, ok := msg.(*shared.ResultMessage); !ok {
+			t.Fatalf("Expected ResultMessage, got %T", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for result message")
+	}
+
+	spans := tracer.waitEnded(t, 1)
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 ended span after the result, got %d", len(spans))
+	}
+	first := spans[0]
+	if first.name != shared.SpanNameTurn || first.err != nil {
+		t.Errorf("Expected successful %s span, got %s with %v", shared.SpanNameTurn, first.name, first.err)
+	}
+	if first.attributes["session_id"] != "s1" || first.attributes["query_id"] != "q1" {
+		t.Errorf("Expected session and query ID attributes, got %v", first.attributes)
+	}
+
+	// The CLI exits before answering the second prompt
+	err = transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1"})
+	assertNoTransportError(t, err)
+	for open := true; open; {
+		select {
+		case _, open = <-msgChan:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for stream to close")
+		}
+	}
+
+	spans = tracer.waitEnded(t, 2)
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 ended spans, got %d", len(spans))
+	}
+	if !errors.Is(spans[1].err, errTurnNotCompleted) {
+		t.Errorf("Expected incomplete turn error, got %v", spans[1].err)
+	}
+	if _, ok := spans[1].attributes["query_id"]; ok {
+		t.Errorf("Expected no query_id attribute without a query ID, got %v", spans[1].attributes)
+	}
+}
+
+// TestTracedMcpServer tests SDK MCP tool calls are wrapped in spans nested
+// under the active turn
+func TestTracedMcpServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  *tracingMcpServer
+		wantErr string
+		panics  bool
+	}{
+		{
+			name:   "success",
+			server: &tracingMcpServer{result: &shared.McpToolResult{}},
+		},
+		{
+			name:    "handler_error",
+			server:  &tracingMcpServer{err: errors.New("database unavailable")},
+			wantErr: "database unavailable",
+		},
+		{
+			name:    "error_result",
+			server:  &tracingMcpServer{result: &shared.McpToolResult{IsError: true}},
+			wantErr: "tool lookup returned an error result",
+		},
+		{
+			name:    "panic",
+			server:  &tracingMcpServer{panics: true},
+			wantErr: "tool lookup panicked",
+			panics:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+			defer cancel()
+
+			tracer := &fakeTracer{}
+			transport := New("claude", &shared.Options{Tracer: tracer}, false, "sdk-go")
+			transport.pushTurn(ctx, "s1", "")
+			server := transport.traceMcpServer("db", test.server)
+
+			func() {
+				defer func() {
+					if r := recover(); (r != nil) != test.panics {
+						t.Errorf("Expected panic %v, got %v", test.panics, r)
+					}
+				}()
+				_, _ = server.CallTool(ctx, "lookup", map[string]any{"id": 1})
+			}()
+
+			spans := tracer.finished()
+			if len(spans) != 1 {
+				t.Fatalf("Expected 1 ended tool span, got %d", len(spans))
+			}
+			span := spans[0]
+			if span.name != shared.SpanNameToolCall {
+				t.Errorf("Expected %s span, got %s", shared.SpanNameToolCall, span.name)
+			}
+			if span.attributes["mcp.server"] != "db" || span.attributes["tool.name"] != "mcp__db__lookup" {
+				t.Errorf("Unexpected attributes: %v", span.attributes)
+			}
+			if span.parent == nil || span.parent.name != shared.SpanNameTurn {
+				t.Errorf("Expected tool span nested under the turn span, got parent %+v", span.parent)
+			}
+			if !test.server.sawSpan {
+				t.Error("Expected handler context to carry the tool span")
+			}
+			if !test.server.sawCancel {
+				t.Error("Expected handler context to keep the caller's cancellation")
+			}
+			if test.wantErr == "" && span.err != nil {
+				t.Errorf("Expected no span error, got %v", span.err)
+			}
+			if test.wantErr != "" && (span.err == nil || span.err.Error() != test.wantErr) {
+				t.Errorf("Expected span error %q, got %v", test.wantErr, span.err)
+			}
+		})
+	}
+
+	t.Run("no_tracer_returns_server", func(t *testing.T) {
+		server := &tracingMcpServer{}
+		transport := New("claude", &shared.Options{}, false, "sdk-go")
+		if got := transport.traceMcpServer("db", server); got != server {
+			t.Errorf("Expected server unchanged without a tracer, got %T", got)
+		}
+	})
+}
+
+// fakeSpanKey is the context key fakeTracer stores its current span under.
+type fakeSpanKey struct{}
+
+// fakeSpan records a span started by fakeTracer.
+type fakeSpan struct {
+	tracer     *fakeTracer
+	name       string
+	attributes map[string]any
+	parent     *fakeSpan
+	err        error
+}
+
+func (s *fakeSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.err = err
+	s.tracer.ended = append(s.tracer.ended, s)
+	if s.tracer.changed != nil {
+		close(s.tracer.changed)
+		s.tracer.changed = nil
+	}
+}
+
+// fakeTracer records spans in the order they end.
+type fakeTracer struct {
+	mu      sync.Mutex
+	ended   []*fakeSpan
+	changed chan struct{} // Closed when the next span ends
+}
+
+func (f *fakeTracer) StartSpan(ctx context.Context, name string, attributes map[string]any) (context.Context, shared.Span) {
+	parent, _ := ctx.Value(fakeSpanKey{}).(*fakeSpan)
+	span := &fakeSpan{tracer: f, name: name, attributes: attributes, parent: parent}
+	return context.WithValue(ctx, fakeSpanKey{}, span), span
+}
+
+func (f *fakeTracer) finished() []*fakeSpan {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*fakeSpan(nil), f.ended...)
+}
+
+// waitEnded waits until n spans have ended and returns the ended spans.
+func (f *fakeTracer) waitEnded(t *testing.T, n int) []*fakeSpan {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		f.mu.Lock()
+		if len(f.ended) >= n {
+			spans := append([]*fakeSpan(nil), f.ended...)
+			f.mu.Unlock()
+			return spans
+		}
+		if f.changed == nil {
+			f.changed = make(chan struct{})
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %d ended spans, got %d", n, len(f.finished()))
+		}
+	}
+}
+
+// tracingMcpServer is an McpServer whose tool records what its context carries.
+type tracingMcpServer struct {
+	result    *shared.McpToolResult
+	err       error
+	panics    bool
+	sawSpan   bool
+	sawCancel bool
+}
+
+func (s *tracingMcpServer) Name() string    { return "db" }
+func (s *tracingMcpServer) Version() string { return "1.0.0" }
+
+func (s *tracingMcpServer) ListTools(_ context.Context) ([]shared.McpToolDefinition, error) {
+	return nil, nil
+}
+
+func (s *tracingMcpServer) CallTool(ctx context.Context, _ string, _ map[string]any) (*shared.McpToolResult, error) {
+	span, _ := ctx.Value(fakeSpanKey{}).(*fakeSpan)
+	s.sawSpan = span != nil && span.name == shared.SpanNameToolCall
+	_, s.sawCancel = ctx.Deadline()
+	if s.panics {
+		panic("boom")
+	}
+	return s.result, s.err
+}
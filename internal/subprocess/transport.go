@@ -2,6 +2,7 @@
 package subprocess
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"os/exec"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/cli"
@@ -47,6 +49,16 @@ type Transport struct {
 	stderr     *os.File      // Temporary file for stderr isolation
 	stderrPipe io.ReadCloser // Pipe for callback-based stderr handling
 
+	// Debug output redaction (nil unless RedactDebugOutput is set)
+	redactor       *shared.Redactor
+	redactedStderr *shared.RedactingWriter
+
+	// Last stderr lines, for RecentStderr (unused with the stderr temp file)
+	stderrTail *stderrTail
+
+	// CLI version detected on Connect, or empty if unknown
+	cliVersion string
+
 	// Temporary files (cleaned up on Close)
 	mcpConfigFile *os.File // Temporary MCP config file
 
@@ -60,6 +72,42 @@ type Transport struct {
 	msgChan chan shared.Message
 	errChan chan error
 
+	// Tool names by tool_use ID, for post-processing injected tool results
+	toolNamesMu sync.Mutex
+	toolNames   map[string]string
+
+	// Deduplicates tool results within a connection (nil unless enabled)
+	toolResultDedup *shared.ToolResultDeduplicator
+
+	// Subprocess limiter slot held while connected (nil when none is held)
+	limiterSlot *shared.SubprocessLimiter
+
+	// The CLI leads its own process group, which is signaled as a whole
+	processGroup bool
+
+	// Tool list last passed to OnToolsChanged (used only by handleStdout)
+	toolList []shared.ToolInfo
+
+	// Tools allowed by SetAllowedTools (nil means unrestricted)
+	toolScopeMu sync.RWMutex
+	toolScope   []string
+
+	// Turn tracking for progress heartbeats (zero when no turn is active)
+	turnMu    sync.Mutex
+	turnStart time.Time
+
+	// Closed when handleStdout returns, i.e. the CLI closed its stdout
+	stdoutDone chan struct{}
+
+	// Set to 1 once MaxSessionDuration elapses and the CLI is terminated
+	sessionExpired int32
+
+	// Sent turns awaiting their result, in send order
+	pendingMu    sync.Mutex
+	pendingTurns []pendingTurn
+	turnSeq      uint64     // Identifies the last queued turn; guarded by pendingMu
+	sendMu       sync.Mutex // Keeps queued turns in the order they are written
+
 	// Control protocol (for streaming mode only)
 	protocol        *control.Protocol
 	protocolAdapter *ProtocolAdapter
@@ -77,7 +125,7 @@ func New(cliPath string, options *shared.Options, closeStdin bool, entrypoint st
 		options:    options,
 		closeStdin: closeStdin,
 		entrypoint: entrypoint,
-		parser:     parser.New(),
+		parser:     newParser(options),
 		validator:  shared.NewStreamValidator(),
 	}
 }
@@ -89,12 +137,21 @@ func NewWithPrompt(cliPath string, options *shared.Options, prompt string) *Tran
 		options:    options,
 		closeStdin: true,
 		entrypoint: "sdk-go", // Query mode uses sdk-go
-		parser:     parser.New(),
+		parser:     newParser(options),
 		validator:  shared.NewStreamValidator(),
 		promptArg:  &prompt,
 	}
 }
 
+// newParser creates a message parser configured from options.
+func newParser(options *shared.Options) *parser.Parser {
+	p := parser.New()
+	if options != nil && options.StrictContentTypes {
+		p.SetStrictContentTypes(true)
+	}
+	return p
+}
+
 // IsConnected returns whether the transport is currently connected.
 func (t *Transport) IsConnected() bool {
 	t.mu.RLock()
@@ -103,7 +160,7 @@ func (t *Transport) IsConnected() bool {
 }
 
 // Connect starts the Claude CLI subprocess.
-func (t *Transport) Connect(ctx context.Context) error {
+func (t *Transport) Connect(ctx context.Context) (err error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -111,6 +168,20 @@ func (t *Transport) Connect(ctx context.Context) error {
 		return fmt.Errorf("transport already connected")
 	}
 
+	// Wait for a subprocess slot, giving it back if the connection fails
+	if t.options != nil && t.options.SubprocessLimiter != nil {
+		limiter := t.options.SubprocessLimiter
+		if err := limiter.Acquire(ctx); err != nil {
+			return shared.NewConnectionError(fmt.Sprintf("waiting for a subprocess slot: %v", err), err)
+		}
+		t.limiterSlot = limiter
+		defer func() {
+			if err != nil {
+				t.releaseLimiterSlot()
+			}
+		}()
+	}
+
 	// Generate MCP config file if McpServers are specified
 	opts, err := t.prepareMcpConfig()
 	if err != nil {
@@ -126,8 +197,20 @@ func (t *Transport) Connect(ctx context.Context) error {
 		// Streaming mode or regular one-shot
 		args = cli.BuildCommand(t.cliPath, opts, t.closeStdin)
 	}
-	//nolint:gosec // G204: This is the core CLI SDK functionality - subprocess execution is required
-	t.cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	if t.options != nil && t.options.CLIArgsOverride != nil {
+		// The override sees a copy of the arguments; the executable is fixed
+		defaults := append([]string(nil), args[1:]...)
+		args = append([]string{args[0]}, t.options.CLIArgsOverride(defaults)...)
+	}
+	graceful := t.options != nil && t.options.GracefulInterruptGrace > 0
+	if graceful {
+		// Cancellation is handled by handleGracefulCancel instead of an immediate kill
+		//nolint:gosec // G204: This is the core CLI SDK functionality - subprocess execution is required
+		t.cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		//nolint:gosec // G204: This is the core CLI SDK functionality - subprocess execution is required
+		t.cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	}
 
 	// Set up environment and apply to command
 	t.cmd.Env = t.buildEnvironment()
@@ -148,6 +231,13 @@ func (t *Transport) Connect(ctx context.Context) error {
 		return err
 	}
 
+	// Let the caller tune the fully configured command
+	t.configureProcessGroup()
+	if err := t.customizeCmd(); err != nil {
+		t.cleanup()
+		return err
+	}
+
 	// Start the process
 	if err := t.cmd.Start(); err != nil {
 		t.cleanup()
@@ -156,15 +246,50 @@ func (t *Transport) Connect(ctx context.Context) error {
 			err,
 		)
 	}
+	t.processGroup = t.options != nil && t.options.ProcessGroupKill && startedInProcessGroup(t.cmd)
+
+	// Apply resource limits before the CLI spawns any tool processes
+	if err := t.applyResourceLimits(); err != nil {
+		_ = t.killProcess(t.cmd.Process)
+		_ = t.cmd.Wait()
+		t.cleanup()
+		return shared.NewConnectionError(
+			fmt.Sprintf("failed to apply resource limits: %v", err),
+			err,
+		)
+	}
 
-	// Set up context for goroutine management
-	t.ctx, t.cancel = context.WithCancel(ctx)
+	// Set up context for goroutine management. With a graceful interrupt,
+	// goroutines keep running after ctx is cancelled until the CLI exits.
+	if graceful {
+		t.ctx, t.cancel = context.WithCancel(context.Background())
+	} else {
+		t.ctx, t.cancel = context.WithCancel(ctx)
+	}
+	t.stdoutDone = make(chan struct{})
+	t.toolList = nil
+	t.toolResultDedup = nil
+	if t.options != nil && t.options.ToolResultDeduplication {
+		t.toolResultDedup = shared.NewToolResultDeduplicator()
+	}
 
 	// Initialize channels
 	t.msgChan = make(chan shared.Message, channelBufferSize)
 	t.errChan = make(chan error, channelBufferSize)
 
+	// One-shot queries with promptArg start their turn immediately.
+	// Set before reading stdout so an early exit is seen mid-turn.
+	t.endTurn()
+	t.pendingMu.Lock()
+	t.pendingTurns = nil
+	t.pendingMu.Unlock()
+	if t.promptArg != nil {
+		t.pushTurn(ctx, "", "")
+		t.beginTurn()
+	}
+
 	// Start I/O handling goroutines
+	atomic.StoreInt32(&t.sessionExpired, 0)
 	t.wg.Add(1)
 	go t.handleStdout()
 
@@ -174,6 +299,24 @@ func (t *Transport) Connect(ctx context.Context) error {
 		go t.handleStderrCallback()
 	}
 
+	// Start progress heartbeat goroutine if configured
+	if t.options != nil && t.options.ProgressHeartbeatInterval > 0 && t.options.ProgressHeartbeatWriter != nil {
+		t.wg.Add(1)
+		go t.handleHeartbeat(t.options.ProgressHeartbeatInterval, t.options.ProgressHeartbeatWriter)
+	}
+
+	// Start session deadline goroutine if a maximum duration is configured
+	if t.options != nil && t.options.MaxSessionDuration > 0 {
+		t.wg.Add(1)
+		go t.handleSessionDeadline(t.options.MaxSessionDuration, t.cmd.Process)
+	}
+
+	// exec.CommandContext kills only the CLI when ctx is cancelled
+	if t.processGroup && !graceful {
+		t.wg.Add(1)
+		go t.handleProcessGroupCancel(ctx, t.cmd.Process)
+	}
+
 	// Note: Do NOT close stdin here for one-shot mode
 	// The CLI still needs stdin to receive the message, even with --print flag
 	// stdin will be closed after sending the message in SendMessage()
@@ -183,6 +326,12 @@ func (t *Transport) Connect(ctx context.Context) error {
 		return err
 	}
 
+	// Start graceful cancellation goroutine once the protocol is available
+	if graceful {
+		t.wg.Add(1)
+		go t.handleGracefulCancel(ctx, t.options.GracefulInterruptGrace, t.protocol, t.stdin, t.cmd.Process)
+	}
+
 	t.connected = true
 	return nil
 }
@@ -220,10 +369,33 @@ func (t *Transport) needsProtocolHandshake() bool {
 	}
 	return t.options.Hooks != nil ||
 		t.options.CanUseTool != nil ||
+		t.options.EnforceAgentToolAllowlist ||
+		t.options.OnPlanProposal != nil ||
+		t.options.EditConfirmation != nil ||
 		t.options.EnableFileCheckpointing ||
 		t.hasSdkMcpServers()
 }
 
+// Initialize completes the control protocol handshake if it has not been
+// done yet, returning once the CLI answers. A no-op in one-shot mode.
+func (t *Transport) Initialize(ctx context.Context) error {
+	t.mu.RLock()
+	connected := t.connected
+	protocol := t.protocol
+	t.mu.RUnlock()
+
+	if !connected {
+		return fmt.Errorf("transport not connected")
+	}
+	if protocol == nil {
+		return nil
+	}
+	if _, err := protocol.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to initialize control protocol: %w", err)
+	}
+	return nil
+}
+
 // SendMessage sends a message to the CLI subprocess.
 func (t *Transport) SendMessage(ctx context.Context, message shared.StreamMessage) error {
 	t.mu.RLock()
@@ -252,9 +424,65 @@ func (t *Transport) SendMessage(ctx context.Context, message shared.StreamMessag
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	// Send with newline
-	_, err = t.stdin.Write(append(data, '\n'))
+	data, err = t.postProcessToolResults(data)
 	if err != nil {
+		return err
+	}
+
+	// Queue the turn before writing it, so even its first messages and a
+	// fast result find it
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+	var seq uint64
+	if message.StartsTurn() {
+		seq = t.pushTurn(ctx, message.SessionID, message.QueryID)
+		t.beginTurn()
+	}
+
+	if err := t.writeFrameUnlocked(data); err != nil {
+		if seq != 0 {
+			t.dropTurn(seq, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// SendRaw writes a pre-serialized protocol frame to the CLI subprocess.
+// The frame must contain exactly one JSON value; it is compacted and newline-terminated.
+func (t *Transport) SendRaw(ctx context.Context, frame []byte) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	// One-shot queries with promptArg don't accept input via stdin
+	if t.promptArg != nil {
+		return nil // No-op for one-shot queries
+	}
+
+	if !t.connected || t.stdin == nil {
+		return fmt.Errorf("transport not connected or stdin closed")
+	}
+
+	// Check context cancellation
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	// Compact to a single line so the frame can't break newline delimiting
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, frame); err != nil {
+		return fmt.Errorf("invalid frame: %w", err)
+	}
+
+	return t.writeFrameUnlocked(buf.Bytes())
+}
+
+// writeFrameUnlocked writes a serialized frame followed by a newline.
+// Must be called with the read lock held.
+func (t *Transport) writeFrameUnlocked(data []byte) error {
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
 		return fmt.Errorf("failed to write message: %w", err)
 	}
 
@@ -357,6 +585,16 @@ func (t *Transport) Close() error {
 
 	// Cleanup resources
 	t.cleanup()
+	t.releaseLimiterSlot()
 
 	return err
 }
+
+// releaseLimiterSlot gives back the subprocess slot taken by Connect, if any.
+// Must be called with t.mu held.
+func (t *Transport) releaseLimiterSlot() {
+	if t.limiterSlot != nil {
+		t.limiterSlot.Release()
+		t.limiterSlot = nil
+	}
+}
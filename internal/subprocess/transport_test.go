@@ -2,15 +2,18 @@ package subprocess
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/severity1/claude-agent-sdk-go/internal/cli"
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
@@ -516,6 +519,195 @@ func TestNewWithPrompt(t *testing.T) {
 	}
 }
 
+// TestCLIArgsOverride tests the override receives the default arguments and
+// its result is the command line that runs
+func TestCLIArgsOverride(t *testing.T) {
+	ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+	defer cancel()
+
+	cliPath := newTransportMockCLI()
+	var received []string
+	options := &shared.Options{
+		Model: stringPtr(testModelName),
+		CLIArgsOverride: func(defaults []string) []string {
+			received = defaults
+			return []string{"--input-format", "stream-json", "--output-format", "stream-json", "--new-flag"}
+		},
+	}
+	transport := New(cliPath, options, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	want := cli.BuildCommand(cliPath, options, false)[1:]
+	if !reflect.DeepEqual(received, want) {
+		t.Errorf("Expected override to receive default args %v, got %v", want, received)
+	}
+
+	args := transport.cmd.Args
+	if args[0] != cliPath {
+		t.Errorf("Expected executable %q to be kept, got %q", cliPath, args[0])
+	}
+	if got := strings.Join(args[1:], " "); got != "--input-format stream-json --output-format stream-json --new-flag" {
+		t.Errorf("Expected overridden args to be run, got %q", got)
+	}
+}
+
+// TestSubprocessLimiter tests Connect waits for a free limiter slot, proceeds
+// once another transport closes, and gives the slot back when it fails
+func TestSubprocessLimiter(t *testing.T) {
+	t.Run("blocks_until_slot_released", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		limiter := shared.NewSubprocessLimiter(1)
+		options := &shared.Options{SubprocessLimiter: limiter}
+		first := New(newTransportMockCLI(), options, false, "sdk-go")
+		connectTransportSafely(ctx, t, first)
+
+		second := New(newTransportMockCLI(), options, false, "sdk-go")
+		defer disconnectTransportSafely(t, second)
+		connected := make(chan error, 1)
+		go func() { connected <- second.Connect(ctx) }()
+
+		select {
+		case err := <-connected:
+			t.Fatalf("Expected Connect to wait for a slot, got %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		disconnectTransportSafely(t, first)
+		select {
+		case err := <-connected:
+			assertNoTransportError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected Connect to proceed once the slot was released")
+		}
+		if limiter.InUse() != 1 {
+			t.Errorf("Expected 1 slot in use, got %d", limiter.InUse())
+		}
+
+		disconnectTransportSafely(t, second)
+		if limiter.InUse() != 0 {
+			t.Errorf("Expected all slots released after Close, got %d", limiter.InUse())
+		}
+	})
+
+	t.Run("context_ends_while_waiting", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+		defer cancel()
+
+		limiter := shared.NewSubprocessLimiter(1)
+		options := &shared.Options{SubprocessLimiter: limiter}
+		first := New(newTransportMockCLI(), options, false, "sdk-go")
+		defer disconnectTransportSafely(t, first)
+		connectTransportSafely(ctx, t, first)
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer waitCancel()
+		second := New(newTransportMockCLI(), options, false, "sdk-go")
+		err := second.Connect(waitCtx)
+		if !shared.IsConnectionError(err) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Expected ConnectionError wrapping DeadlineExceeded, got %v", err)
+		}
+		if limiter.InUse() != 1 {
+			t.Errorf("Expected only the first slot in use, got %d", limiter.InUse())
+		}
+	})
+
+	t.Run("failed_connect_releases_slot", func(t *testing.T) {
+		ctx, cancel := setupTransportTestContext(t, 5*time.Second)
+		defer cancel()
+
+		limiter := shared.NewSubprocessLimiter(1)
+		transport := New("/nonexistent/cli/path", &shared.Options{SubprocessLimiter: limiter}, false, "sdk-go")
+		if err := transport.Connect(ctx); err == nil {
+			t.Fatal("Expected Connect to fail")
+		}
+		if limiter.InUse() != 0 {
+			t.Errorf("Expected the slot to be released, got %d in use", limiter.InUse())
+		}
+	})
+}
+
+// TestSendRawMidTurnInput tests user input written with SendRaw during a turn
+// reaches the CLI and is answered within that turn
+func TestSendRawMidTurnInput(t *testing.T) {
+	if runtime.GOOS == windowsOS {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+	ctx, cancel := setupTransportTestContext(t, 10*time.Second)
+	defer cancel()
+
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+read -r _
+echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Working"}]}}'
+read -r input
+case "$input" in
+  *"Keep the API"*) echo '{"type":"assistant","message":{"role":"assistant","model":"claude-sonnet-4-5","content":[{"type":"text","text":"ack"}]}}' ;;
+esac
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+read -r _
+`
+	cliPath := createTransportTempScript(script, "")
+	defer func() { _ = os.Remove(cliPath) }()
+
+	tracer := &fakeTracer{}
+	transport := New(cliPath, &shared.Options{Tracer: tracer}, false, "sdk-go")
+	defer disconnectTransportSafely(t, transport)
+	connectTransportSafely(ctx, t, transport)
+
+	msgChan, errChan := transport.ReceiveMessages(ctx)
+	next := func() shared.Message {
+		t.Helper()
+		select {
+		case msg := <-msgChan:
+			return msg
+		case err := <-errChan:
+			t.Fatalf("Unexpected error: %v", err)
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for message")
+		}
+		return nil
+	}
+
+	err := transport.SendMessage(ctx, shared.StreamMessage{Type: "user", SessionID: "s1"})
+	assertNoTransportError(t, err)
+	if _, ok := next().(*shared.AssistantMessage); !ok {
+		t.Fatal("Expected the turn to start")
+	}
+
+	err = transport.SendRaw(ctx, []byte(`{"type":"user","message":{"role":"user","content":"Keep the API"},"session_id":"s1"}`))
+	assertNoTransportError(t, err)
+
+	ack, ok := next().(*shared.AssistantMessage)
+	if !ok || ack.Content[0].(*shared.TextBlock).Text != "ack" {
+		t.Fatalf("Expected the CLI to acknowledge the input, got %+v", ack)
+	}
+	if _, ok := next().(*shared.ResultMessage); !ok {
+		t.Fatal("Expected the turn's result")
+	}
+
+	if spans := tracer.waitEnded(t, 1); len(spans) != 1 || spans[0].err != nil {
+		t.Errorf("Expected the input to stay within one successful turn, got %d spans", len(spans))
+	}
+}
+
+// TestTransportStrictContentTypes tests the parser follows StrictContentTypes
+func TestTransportStrictContentTypes(t *testing.T) {
+	line := `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"hologram"}]}}`
+
+	lenient := New("/usr/bin/claude", nil, false, "sdk-go")
+	if _, err := lenient.parser.ProcessLine(line); err != nil {
+		t.Errorf("Expected unknown block to be skipped by default, got %v", err)
+	}
+
+	strict := NewWithPrompt("/usr/bin/claude", &shared.Options{StrictContentTypes: true}, "hi")
+	if _, err := strict.parser.ProcessLine(line); !shared.IsMessageParseError(err) {
+		t.Errorf("Expected MessageParseError in strict mode, got %v", err)
+	}
+}
+
 // TestTransportConnectErrorPaths tests uncovered Connect error scenarios
 func TestTransportConnectErrorPaths(t *testing.T) {
 	ctx, cancel := setupTransportTestContext(t, 5*time.Second)
@@ -770,6 +962,30 @@ func TestTransportControlProtocolIntegration(t *testing.T) {
 			errSubstr:   "",
 			skipWindows: true, // Batch script can't properly parse/respond to control requests
 		},
+		{
+			name: "Initialize_requires_connection",
+			setup: func() *Transport {
+				return setupTransportForTest(t, newTransportMockCLI())
+			},
+			operation: func(ctx context.Context, t *Transport) error {
+				// Don't connect first
+				return t.Initialize(ctx)
+			},
+			wantErr:   true,
+			errSubstr: "not connected",
+		},
+		{
+			name: "Initialize_in_streaming_mode_with_protocol",
+			setup: func() *Transport {
+				return setupTransportForTest(t, newTransportMockCLIWithControlProtocol())
+			},
+			operation: func(ctx context.Context, t *Transport) error {
+				return t.Initialize(ctx)
+			},
+			wantErr:     false,
+			errSubstr:   "",
+			skipWindows: true, // Batch script can't properly parse/respond to control requests
+		},
 	}
 
 	for _, tt := range tests {
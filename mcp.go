@@ -3,7 +3,9 @@ package claudecode
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
@@ -187,3 +189,147 @@ func (s *SdkMcpServer) CallTool(ctx context.Context, name string, args map[strin
 
 	return tool.Call(ctx, args)
 }
+
+// MergeSDKMcpServers combines the tools of several servers created with
+// CreateSDKMcpServer into one server, so tools built in separate packages
+// share a single mcp__<name>__ namespace. Nil servers are ignored.
+// Returns an error if two servers define a tool with the same name, or if a
+// server was not created with CreateSDKMcpServer.
+//
+// Example:
+//
+//	tools, err := claudecode.MergeSDKMcpServers("tools", "1.0.0", mathServer, textServer)
+//	if err != nil {
+//	    return err
+//	}
+//	client := claudecode.NewClient(claudecode.WithSdkMcpServer("tools", tools))
+func MergeSDKMcpServers(name, version string, servers ...*McpSdkServerConfig) (*McpSdkServerConfig, error) {
+	merged := &SdkMcpServer{
+		name:    name,
+		version: version,
+		tools:   make(map[string]*McpTool),
+	}
+	owners := make(map[string]string)
+	for _, config := range servers {
+		if config == nil {
+			continue
+		}
+		server, ok := config.Instance.(*SdkMcpServer)
+		if !ok {
+			return nil, fmt.Errorf("MCP server '%s' was not created with CreateSDKMcpServer", config.Name)
+		}
+
+		server.mu.RLock()
+		for toolName, tool := range server.tools {
+			if owner, exists := owners[toolName]; exists {
+				server.mu.RUnlock()
+				return nil, fmt.Errorf("tool '%s' is defined by both MCP server '%s' and '%s'", toolName, owner, server.name)
+			}
+			owners[toolName] = server.name
+			merged.tools[toolName] = tool
+		}
+		server.mu.RUnlock()
+	}
+	return &McpSdkServerConfig{
+		Type:     McpServerTypeSdk,
+		Name:     name,
+		Instance: merged,
+	}, nil
+}
+
+// NewStdioMcpServer creates a stdio MCP server configuration from a command
+// line. The command line is split into Command and Args using shell quoting
+// rules: single quotes preserve text literally, double quotes allow backslash
+// escapes of \" \\ \$ and \`, and a backslash outside quotes escapes the next
+// character. No variable expansion or globbing is performed.
+// Returns an error if the command line is empty or has an unterminated quote.
+//
+// Example:
+//
+//	server, err := claudecode.NewStdioMcpServer(`npx -y @acme/mcp --root "/my docs"`,
+//	    map[string]string{"ACME_TOKEN": token})
+func NewStdioMcpServer(commandLine string, env map[string]string) (*McpStdioServerConfig, error) {
+	words, err := splitCommandLine(commandLine)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty MCP server command line")
+	}
+
+	config := &McpStdioServerConfig{
+		Type:    McpServerTypeStdio,
+		Command: words[0],
+	}
+	if len(words) > 1 {
+		config.Args = words[1:]
+	}
+	if len(env) > 0 {
+		config.Env = make(map[string]string, len(env))
+		for key, value := range env {
+			config.Env[key] = value
+		}
+	}
+	return config, nil
+}
+
+// splitCommandLine splits s into words following POSIX shell quoting rules.
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			// Inside double quotes, backslash only escapes special characters
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command line: %s", quote, s)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash in command line: %s", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
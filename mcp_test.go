@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -416,6 +419,157 @@ func TestSdkMcpServerName(t *testing.T) {
 	}
 }
 
+// TestMergeSDKMcpServers tests combining servers into one namespace.
+func TestMergeSDKMcpServers(t *testing.T) {
+	ctx, cancel := setupMcpTestContext(t, 5*time.Second)
+	defer cancel()
+
+	textHandler := func(text string) McpToolHandler {
+		return func(_ context.Context, _ map[string]any) (*McpToolResult, error) {
+			return &McpToolResult{Content: []McpContent{{Type: "text", Text: text}}}, nil
+		}
+	}
+	math := CreateSDKMcpServer("math", "1.0.0",
+		NewTool("add", "Add", nil, textHandler("add")),
+		NewTool("sub", "Subtract", nil, textHandler("sub")),
+	)
+	text := CreateSDKMcpServer("text", "2.0.0", NewTool("upper", "Uppercase", nil, textHandler("upper")))
+
+	t.Run("combines_tools", func(t *testing.T) {
+		merged, err := MergeSDKMcpServers("tools", "3.0.0", math, nil, text)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if merged.Type != McpServerTypeSdk || merged.Name != "tools" {
+			t.Errorf("Unexpected config: %+v", merged)
+		}
+		if merged.Instance.Name() != "tools" || merged.Instance.Version() != "3.0.0" {
+			t.Errorf("Expected tools 3.0.0, got %s %s", merged.Instance.Name(), merged.Instance.Version())
+		}
+
+		defs, err := merged.Instance.ListTools(ctx)
+		if err != nil {
+			t.Fatalf("ListTools error: %v", err)
+		}
+		var names []string
+		for _, def := range defs {
+			names = append(names, def.Name)
+		}
+		sort.Strings(names)
+		if want := []string{"add", "sub", "upper"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Expected tools %v, got %v", want, names)
+		}
+
+		for _, name := range names {
+			result, err := merged.Instance.CallTool(ctx, name, nil)
+			if err != nil {
+				t.Fatalf("CallTool(%s) error: %v", name, err)
+			}
+			if result.Content[0].Text != name {
+				t.Errorf("CallTool(%s) reached the wrong handler: %q", name, result.Content[0].Text)
+			}
+		}
+	})
+
+	t.Run("name_collision", func(t *testing.T) {
+		other := CreateSDKMcpServer("other", "1.0.0", NewTool("add", "Add again", nil, dummyHandler))
+		_, err := MergeSDKMcpServers("tools", "1.0.0", math, other)
+		if err == nil {
+			t.Fatal("Expected error for duplicate tool name")
+		}
+		if !strings.Contains(err.Error(), "'add'") || !strings.Contains(err.Error(), "'math'") ||
+			!strings.Contains(err.Error(), "'other'") {
+			t.Errorf("Expected error naming the tool and both servers, got %v", err)
+		}
+	})
+
+	t.Run("foreign_server", func(t *testing.T) {
+		foreign := &McpSdkServerConfig{Type: McpServerTypeSdk, Name: "custom", Instance: foreignMcpServer{}}
+		if _, err := MergeSDKMcpServers("tools", "1.0.0", math, foreign); err == nil {
+			t.Error("Expected error for a server not created with CreateSDKMcpServer")
+		}
+	})
+}
+
+// TestNewStdioMcpServer tests building stdio server configs from command lines.
+func TestNewStdioMcpServer(t *testing.T) {
+	tests := []struct {
+		name        string
+		commandLine string
+		wantCommand string
+		wantArgs    []string
+	}{
+		{"command_only", "uvx", "uvx", nil},
+		{"plain_args", "  npx -y   @acme/mcp  ", "npx", []string{"-y", "@acme/mcp"}},
+		{"double_quoted_arg", `node server.js --root "/my docs"`, "node", []string{"server.js", "--root", "/my docs"}},
+		{"single_quoted_literal", `sh -c 'echo "$HOME" \n'`, "sh", []string{"-c", `echo "$HOME" \n`}},
+		{"quoted_command", `"/opt/my tools/mcp" serve`, "/opt/my tools/mcp", []string{"serve"}},
+		{"escaped_space", `python3 /srv/my\ server.py`, "python3", []string{"/srv/my server.py"}},
+		{"double_quote_escapes", `cmd "say \"hi\" \$x \w"`, "cmd", []string{`say "hi" $x \w`}},
+		{"empty_quoted_arg", `cmd "" next`, "cmd", []string{"", "next"}},
+		{"adjacent_quotes_join", `cmd --name="a b"'c'`, "cmd", []string{"--name=a bc"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := NewStdioMcpServer(test.commandLine, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if config.Type != McpServerTypeStdio {
+				t.Errorf("Type = %q, want %q", config.Type, McpServerTypeStdio)
+			}
+			if config.Command != test.wantCommand {
+				t.Errorf("Command = %q, want %q", config.Command, test.wantCommand)
+			}
+			if !reflect.DeepEqual(config.Args, test.wantArgs) {
+				t.Errorf("Args = %q, want %q", config.Args, test.wantArgs)
+			}
+			if config.Env != nil {
+				t.Errorf("Expected nil Env, got %v", config.Env)
+			}
+		})
+	}
+
+	t.Run("env_copied", func(t *testing.T) {
+		env := map[string]string{"API_TOKEN": "secret", "LOG_LEVEL": "debug"}
+		config, err := NewStdioMcpServer("mcp-server --stdio", env)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(config.Env, env) {
+			t.Errorf("Env = %v, want %v", config.Env, env)
+		}
+		env["API_TOKEN"] = "changed"
+		if config.Env["API_TOKEN"] != "secret" {
+			t.Error("Expected Env to be copied, not aliased")
+		}
+	})
+
+	errorTests := []struct {
+		name        string
+		commandLine string
+		wantErr     string
+	}{
+		{"empty", "", "empty MCP server command line"},
+		{"whitespace_only", " \t ", "empty MCP server command line"},
+		{"unterminated_double_quote", `node "server.js`, `unterminated " quote`},
+		{"unterminated_single_quote", `node 'server.js`, "unterminated ' quote"},
+		{"trailing_backslash", `node server.js \`, "trailing backslash"},
+	}
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := NewStdioMcpServer(test.commandLine, nil)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+			if config != nil {
+				t.Errorf("Expected nil config on error, got %+v", config)
+			}
+		})
+	}
+}
+
 // =============================================================================
 // Helper Functions (utilities)
 // =============================================================================
@@ -437,3 +591,17 @@ func dummyHandler(_ context.Context, _ map[string]any) (*McpToolResult, error) {
 func formatFloat(f float64) string {
 	return fmt.Sprintf("%.2f", f)
 }
+
+// foreignMcpServer is an McpServer not created with CreateSDKMcpServer.
+type foreignMcpServer struct{}
+
+func (foreignMcpServer) Name() string    { return "custom" }
+func (foreignMcpServer) Version() string { return "1.0.0" }
+
+func (foreignMcpServer) ListTools(_ context.Context) ([]McpToolDefinition, error) {
+	return nil, nil
+}
+
+func (foreignMcpServer) CallTool(_ context.Context, _ string, _ map[string]any) (*McpToolResult, error) {
+	return nil, nil
+}
@@ -2,8 +2,13 @@ package claudecode
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/control"
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
@@ -15,6 +20,9 @@ type Options = shared.Options
 // PermissionMode defines the permission handling mode.
 type PermissionMode = shared.PermissionMode
 
+// LargePromptStrategy selects how oversized prompts are handled.
+type LargePromptStrategy = shared.LargePromptStrategy
+
 // McpServerType defines the type of MCP server.
 type McpServerType = shared.McpServerType
 
@@ -30,6 +38,9 @@ type McpSSEServerConfig = shared.McpSSEServerConfig
 // McpHTTPServerConfig represents an HTTP MCP server configuration.
 type McpHTTPServerConfig = shared.McpHTTPServerConfig
 
+// McpWebSocketServerConfig represents a WebSocket MCP server configuration.
+type McpWebSocketServerConfig = shared.McpWebSocketServerConfig
+
 // SdkBeta represents a beta feature identifier.
 type SdkBeta = shared.SdkBeta
 
@@ -57,6 +68,12 @@ type SdkPluginConfig = shared.SdkPluginConfig
 // OutputFormat specifies the format for structured output.
 type OutputFormat = shared.OutputFormat
 
+// ResourceLimits caps CPU time and memory of the CLI subprocess.
+type ResourceLimits = shared.ResourceLimits
+
+// PartialStreamOptions selects which delta types are forwarded during partial streaming.
+type PartialStreamOptions = shared.PartialStreamOptions
+
 // =============================================================================
 // Permission Callback Types (Issue #8)
 // =============================================================================
@@ -101,11 +118,17 @@ const (
 	McpServerTypeStdio              = shared.McpServerTypeStdio
 	McpServerTypeSSE                = shared.McpServerTypeSSE
 	McpServerTypeHTTP               = shared.McpServerTypeHTTP
+	McpServerTypeWebSocket          = shared.McpServerTypeWebSocket
 	SdkBetaContext1M                = shared.SdkBetaContext1M
 	SettingSourceUser               = shared.SettingSourceUser
 	SettingSourceProject            = shared.SettingSourceProject
 	SettingSourceLocal              = shared.SettingSourceLocal
 	SdkPluginTypeLocal              = shared.SdkPluginTypeLocal
+	DefaultMaxThinkingTokens        = shared.DefaultMaxThinkingTokens
+	MaxThinkingTokensLimit          = shared.MaxThinkingTokensLimit
+	LargePromptStrategyError        = shared.LargePromptStrategyError
+	LargePromptStrategyTruncate     = shared.LargePromptStrategyTruncate
+	LargePromptStrategyFile         = shared.LargePromptStrategyFile
 )
 
 // Permission update type constants
@@ -164,6 +187,30 @@ func WithSystemPrompt(prompt string) Option {
 	}
 }
 
+// SystemPromptLayerSeparator separates layers joined by WithSystemPromptLayers.
+const SystemPromptLayerSeparator = "\n\n---\n\n"
+
+// WithSystemPromptLayers sets the system prompt from multiple instruction layers
+// (e.g. base persona, task, safety). Layers are joined in the order given with
+// SystemPromptLayerSeparator; blank layers are skipped. Like WithSystemPrompt,
+// this replaces any previously set system prompt.
+func WithSystemPromptLayers(layers ...string) Option {
+	return func(o *Options) {
+		parts := make([]string, 0, len(layers))
+		for _, layer := range layers {
+			if trimmed := strings.TrimSpace(layer); trimmed != "" {
+				parts = append(parts, trimmed)
+			}
+		}
+		if len(parts) == 0 {
+			o.SystemPrompt = nil
+			return
+		}
+		prompt := strings.Join(parts, SystemPromptLayerSeparator)
+		o.SystemPrompt = &prompt
+	}
+}
+
 // WithAppendSystemPrompt sets the append system prompt.
 func WithAppendSystemPrompt(prompt string) Option {
 	return func(o *Options) {
@@ -185,6 +232,21 @@ func WithFallbackModel(model string) Option {
 	}
 }
 
+// WithPromptCaching explicitly enables or disables prompt caching in the CLI.
+// The CLI caches prompts by default; disabling it can help when comparing
+// runs or debugging stale context. It is passed as DISABLE_PROMPT_CACHING and
+// overrides that variable in the host environment. Cache effectiveness is
+// reported per turn by ResultMessage.TokenUsage().
+//
+// Example:
+//
+//	client := claudecode.NewClient(claudecode.WithPromptCaching(false))
+func WithPromptCaching(enabled bool) Option {
+	return func(o *Options) {
+		o.PromptCaching = &enabled
+	}
+}
+
 // WithMaxBudgetUSD sets the maximum budget in USD for API usage.
 func WithMaxBudgetUSD(budget float64) Option {
 	return func(o *Options) {
@@ -206,13 +268,34 @@ func WithMaxBufferSize(size int) Option {
 	}
 }
 
-// WithMaxThinkingTokens sets the maximum thinking tokens.
+// WithMaxThinkingTokens sets the maximum thinking tokens, passed to the CLI
+// as --max-thinking-tokens. Zero passes no budget, leaving thinking to the
+// CLI's default. Values must be between 0 and MaxThinkingTokensLimit;
+// Connect and Query return a *ValidationError otherwise.
 func WithMaxThinkingTokens(tokens int) Option {
 	return func(o *Options) {
 		o.MaxThinkingTokens = tokens
 	}
 }
 
+// WithThinkingBudget is an alias for WithMaxThinkingTokens.
+func WithThinkingBudget(tokens int) Option {
+	return WithMaxThinkingTokens(tokens)
+}
+
+// WithExtendedThinking toggles extended thinking. Enabling sets the thinking
+// budget to DefaultMaxThinkingTokens; disabling sets it to zero, so no budget
+// is passed to the CLI.
+func WithExtendedThinking(enabled bool) Option {
+	return func(o *Options) {
+		if enabled {
+			o.MaxThinkingTokens = DefaultMaxThinkingTokens
+			return
+		}
+		o.MaxThinkingTokens = 0
+	}
+}
+
 // WithPermissionMode sets the permission mode.
 func WithPermissionMode(mode PermissionMode) Option {
 	return func(o *Options) {
@@ -241,6 +324,95 @@ func WithResume(sessionID string) Option {
 	}
 }
 
+// WithSessionStore persists the Client's CLI session ID in store under key,
+// so a later Connect, even from another process, resumes the conversation.
+// Connect loads the stored ID and resumes it unless WithResume sets a session
+// explicitly; a load error fails Connect. The session ID is saved whenever
+// the CLI reports a new one, and a failed save is delivered on the error
+// channel. After Reset, the store holds the session of the cleared
+// conversation, never the reset one. Query ignores the store. The Options
+// passed in are not modified; the stored ID is only passed to the CLI.
+//
+// Example:
+//
+//	client := claudecode.NewClient(
+//	    claudecode.WithSessionStore(redisStore, "user:"+userID),
+//	)
+func WithSessionStore(store SessionStore, key string) Option {
+	return func(o *Options) {
+		o.SessionStore = store
+		o.SessionStoreKey = key
+	}
+}
+
+// WithRateLimiter paces the Client's Query, QueryWithSession, and
+// QueryWithID calls to rps queries per second, allowing bursts of up to
+// burst queries, to stay under API rate limits. A query over the rate waits
+// for its turn before it is sent, returning the context's error if the
+// context ends first. A burst below 1 is treated as 1. A non-positive rps
+// disables pacing.
+//
+// Example:
+//
+//	client := claudecode.NewClient(
+//	    claudecode.WithRateLimiter(0.5, 2), // One query every 2s, bursts of 2
+//	)
+func WithRateLimiter(rps float64, burst int) Option {
+	if rps < 0 {
+		rps = 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return func(o *Options) {
+		o.QueryRateLimit = rps
+		o.QueryRateBurst = burst
+	}
+}
+
+// WithResumeAt resumes a session as of a specific message UUID.
+// Turns after the given message are not carried into the resumed conversation.
+// Combine with WithForkSession(true) to branch into a new session ID.
+func WithResumeAt(sessionID, messageUUID string) Option {
+	return func(o *Options) {
+		o.Resume = &sessionID
+		o.ResumeSessionAt = &messageUUID
+	}
+}
+
+// WithFailFast aborts on the first tool error instead of letting Claude recover.
+// When a ToolResultBlock with is_error=true is observed while iterating
+// (Query or Client.ReceiveResponse), the session is interrupted, the rest of
+// the turn up to its ResultMessage is read and discarded, and the iterator
+// returns a *ToolExecutionError. The next ReceiveResponse starts clean.
+func WithFailFast() Option {
+	return func(o *Options) {
+		o.FailFast = true
+	}
+}
+
+// WithStopAfterFirstResponse stops generation once the first complete
+// AssistantMessage arrives, e.g. for classification tasks that need only the
+// model's first answer. The iterator (Query or Client.ReceiveResponse)
+// interrupts the session, reads and discards the rest of the turn up to its
+// ResultMessage, returns that message, and then reports ErrNoMoreMessages.
+// The next ReceiveResponse starts clean.
+func WithStopAfterFirstResponse() Option {
+	return func(o *Options) {
+		o.StopAfterFirstResponse = true
+	}
+}
+
+// WithStrictContentTypes rejects content blocks the SDK does not recognize.
+// By default, blocks of unknown type are skipped so newer CLI versions keep
+// working. With this option, a message containing one is not delivered and
+// a *MessageParseError with the block's raw data is sent on the error channel.
+func WithStrictContentTypes() Option {
+	return func(o *Options) {
+		o.StrictContentTypes = true
+	}
+}
+
 // WithCwd sets the working directory.
 func WithCwd(cwd string) Option {
 	return func(o *Options) {
@@ -262,6 +434,136 @@ func WithMcpServers(servers map[string]McpServerConfig) Option {
 	}
 }
 
+// WithGracefulInterruptOnCancel shuts the CLI down cleanly when the context
+// passed to Connect (or Query) is cancelled. Instead of killing the process
+// immediately, the SDK sends an interrupt (a control request in streaming
+// mode, SIGINT otherwise), closes stdin, and waits up to grace for the CLI to
+// exit before killing it. Zero restores the immediate kill.
+func WithGracefulInterruptOnCancel(grace time.Duration) Option {
+	return func(o *Options) {
+		o.GracefulInterruptGrace = grace
+	}
+}
+
+// WithMaxSessionDuration caps how long a session may run after Connect.
+// Once d elapses the CLI is terminated and a SessionExpiredError is delivered
+// on the error channel before the message stream closes. Zero disables the cap.
+func WithMaxSessionDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxSessionDuration = d
+	}
+}
+
+// WithMaxIdleTime disconnects a Client after d with no queries sent or
+// messages received, freeing the CLI subprocess of an unused connection, e.g.
+// in a pool. The idle time is paused from sending a turn until its result, so
+// a quiet turn, such as a long tool run or a slow permission answer, is not
+// idle. Once disconnected, queries and other calls that need a connection
+// return an IdleDisconnectError until Connect is called again, and the
+// disconnect callback receives the same error. Zero disables the limit.
+//
+// Example:
+//
+//	client := claudecode.NewClient(claudecode.WithMaxIdleTime(10 * time.Minute))
+//	...
+//	if err := client.Query(ctx, prompt); claudecode.IsIdleDisconnectError(err) {
+//	    if err := client.Connect(ctx); err != nil {
+//	        return err
+//	    }
+//	    err = client.Query(ctx, prompt)
+//	}
+func WithMaxIdleTime(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxIdleTime = d
+	}
+}
+
+// WithOverloadBackoff makes a Client retry a query whose turn ends in an
+// overloaded error (ResultErrorOverloaded), resending the same prompt after a
+// jittered exponential delay: the nth retry waits between half and all of
+// base doubled n-1 times, capped at max. Up to MaxOverloadRetries retries are
+// made; the overloaded ResultMessage of a retried turn is not delivered, so
+// ReceiveResponse keeps reading until the retried turn ends. Each result is
+// matched to its turn in send order, so with several queries in flight only
+// the overloaded one is resent. Prompts sent with Query, QueryWithSession, or
+// QueryWithID are retried, and the delays follow WithClock. Unlike a general
+// retry, other errors are delivered immediately. Zero base disables retries.
+//
+// Example:
+//
+//	client := claudecode.NewClient(
+//	    claudecode.WithOverloadBackoff(2*time.Second, time.Minute),
+//	)
+func WithOverloadBackoff(base, max time.Duration) Option {
+	return func(o *Options) {
+		o.OverloadBackoffBase = base
+		o.OverloadBackoffMax = max
+	}
+}
+
+// WithWarmup makes Client.Connect complete the CLI's initialize handshake
+// before returning, so the CLI subprocess is started and answering requests
+// when the first query is sent. No prompt is sent, so nothing is added to the
+// conversation, no model turn is billed, and the turn callbacks are not
+// called. MCP servers may still be loading; call Client.WaitForReady after
+// the first query to confirm they are. If the handshake fails or the Connect
+// context ends first, Connect disconnects and returns the error. A custom
+// transport without an Initialize(ctx) error method is not warmed up.
+// Query ignores it.
+//
+// Example:
+//
+//	client := claudecode.NewClient(claudecode.WithWarmup())
+//	if err := client.Connect(ctx); err != nil { // Returns once warmed up
+//	    return err
+//	}
+func WithWarmup() Option {
+	return func(o *Options) {
+		o.Warmup = true
+	}
+}
+
+// WithPartialResultsOnCancel keeps the work done before a Query is cancelled.
+// When the query's context is cancelled, Next returns a *PartialResultsError
+// whose Messages holds every message received so far, including any still
+// buffered, and which wraps the context error. Applies to Query and
+// QueryWithTransport.
+//
+// Example:
+//
+//	iter, _ := claudecode.Query(ctx, prompt, claudecode.WithPartialResultsOnCancel())
+//	// ... ctx is cancelled mid-stream ...
+//	if partial := claudecode.AsPartialResultsError(err); partial != nil {
+//	    save(partial.Messages)
+//	}
+func WithPartialResultsOnCancel() Option {
+	return func(o *Options) {
+		o.PartialResultsOnCancel = true
+	}
+}
+
+// WithMaxOutputBytes caps the total bytes the SDK reads from the CLI in a
+// session, as a safety limit for untrusted workloads. Every line of CLI
+// output counts, including control messages and messages dropped by filters.
+// The line that crosses the limit is discarded, the CLI is killed, and an
+// OutputLimitExceededError is delivered on the error channel before the
+// message stream closes. Zero disables the cap.
+func WithMaxOutputBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxOutputBytes = n
+	}
+}
+
+// WithMcpServerStartupTimeout bounds how long MCP servers may take to start.
+// The CLI stops waiting for servers after d, and Client.WaitForReady, called
+// after the first query, returns a ConnectionError naming the servers still
+// pending once d has elapsed. Zero disables the limit.
+func WithMcpServerStartupTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.McpServerStartupTimeout = d
+	}
+}
+
 // WithSdkMcpServer adds an in-process SDK MCP server by name.
 // This is a convenience method for adding SDK MCP servers created with CreateSDKMcpServer.
 // Multiple calls accumulate servers.
@@ -320,7 +622,26 @@ func WithExtraArgs(args map[string]*string) Option {
 	}
 }
 
-// WithCLIPath sets a custom CLI path.
+// WithCLIArgsOverride gives full control of the CLI command line. fn receives
+// the arguments the SDK would run, excluding the executable path, and returns
+// the arguments to run instead. It is an escape hatch for flags the SDK does
+// not know about; removing the stream-json flags breaks the SDK's protocol.
+//
+// Example:
+//
+//	client := claudecode.NewClient(
+//	    claudecode.WithCLIArgsOverride(func(args []string) []string {
+//	        return append(args, "--new-flag", "value")
+//	    }),
+//	)
+func WithCLIArgsOverride(fn func(defaults []string) []string) Option {
+	return func(o *Options) {
+		o.CLIArgsOverride = fn
+	}
+}
+
+// WithCLIPath runs the CLI at path instead of discovering it, e.g. for a
+// custom installation or a claudecodetest.FakeCLI.
 func WithCLIPath(path string) Option {
 	return func(o *Options) {
 		o.CLIPath = &path
@@ -353,6 +674,17 @@ func WithEnvVar(key, value string) Option {
 	}
 }
 
+// WithCleanEnv starts the CLI subprocess without inheriting the host
+// environment. Only PATH, variables the SDK sets, and variables passed via
+// WithEnv or WithEnvVar reach the subprocess (and any MCP servers it starts).
+// Pass credentials such as ANTHROPIC_API_KEY, or HOME for stored logins,
+// explicitly with WithEnv.
+func WithCleanEnv() Option {
+	return func(o *Options) {
+		o.CleanEnv = true
+	}
+}
+
 // WithBetas sets the SDK beta features to enable.
 // See https://docs.anthropic.com/en/api/beta-headers
 func WithBetas(betas ...SdkBeta) Option {
@@ -458,6 +790,43 @@ func WithAgent(name string, agent AgentDefinition) Option {
 	}
 }
 
+// WithToolAllowlistPerAgent denies subagent tool requests for tools outside
+// the requesting agent's AgentDefinition.Tools list.
+// Enforcement runs in the permission callback before any WithCanUseTool
+// callback; agents without a Tools list and the main agent are unrestricted,
+// and agents not in Agents are denied. Tools the allowlist permits still
+// need a WithCanUseTool decision: without one, the CLI's permission requests
+// are denied. Requires at least one agent with a Tools list.
+func WithToolAllowlistPerAgent() Option {
+	return func(o *Options) {
+		o.EnforceAgentToolAllowlist = true
+	}
+}
+
+// WithToolNameNormalization makes the SDK's permission checks compare tool
+// names by their NormalizeToolName form, so MCP tool names formatted
+// differently by other CLI versions (mcp__My-Server__get vs
+// mcp__my_server__get) still match. It applies to SetAllowedTools, agent
+// tool allowlists, and the tool approval cache, and the WithCanUseTool
+// callback receives the normalized name. Because the CLI may not match such
+// names against AllowedTools and DisallowedTools, the permission callback
+// also allows and denies tools those lists name in full. Checks run in the
+// permission callback, so this needs WithCanUseTool, WithToolAllowlistPerAgent,
+// or another option that installs one.
+//
+// Example:
+//
+//	claudecode.NewClient(
+//	    claudecode.WithAllowedTools("mcp__my-server__search"),
+//	    claudecode.WithCanUseTool(askUser),
+//	    claudecode.WithToolNameNormalization(),
+//	)
+func WithToolNameNormalization() Option {
+	return func(o *Options) {
+		o.ToolNameNormalization = true
+	}
+}
+
 const customTransportMarker = "custom_transport"
 
 // WithTransport sets a custom transport for testing.
@@ -487,6 +856,97 @@ func NewOptions(opts ...Option) *Options {
 	return options
 }
 
+// WithResourceLimits caps the CPU time and memory of the CLI subprocess to
+// contain runaway CLI or tool processes. On Linux the limits are set with
+// prlimit(2) as the process starts and are inherited by every process the CLI
+// spawns; Connect fails if they cannot be applied. Other platforms run without
+// limits and report a warning through the stderr callback or debug writer.
+//
+// Example:
+//
+//	claudecode.WithResourceLimits(claudecode.ResourceLimits{
+//	    MaxMemoryBytes: 8 << 30, // 8 GiB address space
+//	    MaxCPUSeconds:  600,
+//	})
+func WithResourceLimits(limits ResourceLimits) Option {
+	return func(o *Options) {
+		o.ResourceLimits = &limits
+	}
+}
+
+// WithProcessGroupKill starts the CLI subprocess in its own process group and
+// signals the whole group when the SDK terminates or kills the CLI, including
+// when the Connect or Query context is cancelled, so MCP servers and other
+// processes the CLI spawned are not left orphaned if the CLI exits without
+// stopping them. Interrupts still go to the CLI alone. The CLI no longer
+// receives terminal signals such as Ctrl-C sent to the program's process
+// group. Unix only; other platforms kill only the CLI and report a warning
+// through the stderr callback or debug writer.
+func WithProcessGroupKill() Option {
+	return func(o *Options) {
+		o.ProcessGroupKill = true
+	}
+}
+
+// WithCmdCustomizer registers a function that adjusts the CLI subprocess
+// command just before it starts, after the SDK has set its path, arguments,
+// environment, working directory, and I/O. Use it for attributes the SDK does
+// not expose, such as SysProcAttr (process group, credentials) or
+// ExtraFiles. The SDK relies on the fields it manages: the customizer must
+// not change Stdin, Stdout, or Stderr, Path, or Args, and should add to Env
+// rather than replace it. A panicking customizer fails Connect.
+//
+// Example - run the CLI in its own process group (Unix):
+//
+//	claudecode.WithCmdCustomizer(func(cmd *exec.Cmd) {
+//	    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+//	})
+func WithCmdCustomizer(customize func(*exec.Cmd)) Option {
+	return func(o *Options) {
+		o.CmdCustomizer = customize
+	}
+}
+
+// WithSubprocessLimiter shares limiter between every Query and Client that
+// uses it, bounding the CLI subprocesses they run at once. Connect (and
+// Query) waits for a free slot until its context ends, and the slot is
+// released when the connection closes.
+//
+// Example:
+//
+//	limiter := claudecode.NewSubprocessLimiter(4)
+//	// In each worker goroutine:
+//	iter, err := claudecode.Query(ctx, prompt, claudecode.WithSubprocessLimiter(limiter))
+func WithSubprocessLimiter(limiter *SubprocessLimiter) Option {
+	return func(o *Options) {
+		o.SubprocessLimiter = limiter
+	}
+}
+
+// WithTranscriptWriter tees the session's message stream to w as JSON Lines:
+// each message received from the CLI is written as one JSON object per line,
+// in the CLI's wire format, so the file can be replayed or analyzed later.
+// Messages are written before WithMessageFilter is applied; control protocol
+// traffic and debug output are not included. Write errors are ignored.
+func WithTranscriptWriter(w io.Writer) Option {
+	return func(o *Options) {
+		o.TranscriptWriter = w
+	}
+}
+
+// WithRawStdoutTee copies the CLI's stdout bytes to w verbatim as they are
+// read, before parsing, so a wrapping tool can forward the CLI's output
+// unchanged. Unlike WithTranscriptWriter, nothing is filtered or
+// re-encoded: control protocol traffic, blank lines, and lines that fail to
+// parse are included. Writes happen on the reading goroutine, so a slow
+// writer delays message delivery. After the first write error, w is no
+// longer written to and parsing continues.
+func WithRawStdoutTee(w io.Writer) Option {
+	return func(o *Options) {
+		o.RawStdoutTee = w
+	}
+}
+
 // WithDebugWriter sets the writer for CLI debug output.
 // If not set, stderr is isolated to a temporary file (default behavior).
 // Common values: os.Stderr, io.Discard, or a custom io.Writer like bytes.Buffer.
@@ -508,6 +968,18 @@ func WithDebugDisabled() Option {
 	return WithDebugWriter(io.Discard)
 }
 
+// WithDebugRedaction masks secrets in all debug and stderr output before it
+// reaches WithDebugWriter or WithStderrCallback. Known secret-looking patterns
+// (Anthropic API keys, bearer tokens, api_key/token/secret/password values,
+// AWS and GitHub keys) are always redacted; patterns adds extra regular
+// expressions whose matches are replaced with "[REDACTED]".
+func WithDebugRedaction(patterns ...string) Option {
+	return func(o *Options) {
+		o.RedactDebugOutput = true
+		o.DebugRedactionPatterns = append(o.DebugRedactionPatterns, patterns...)
+	}
+}
+
 // WithStderrCallback sets a callback for receiving CLI stderr output.
 // The callback is invoked for each non-empty line of stderr output.
 // Lines are stripped of trailing whitespace before being passed to the callback.
@@ -520,6 +992,527 @@ func WithStderrCallback(callback func(string)) Option {
 	}
 }
 
+// WithProgressHeartbeat periodically writes a short progress marker to w
+// while a turn is active, stopping once the turn's result arrives.
+// Useful in CI where long quiet turns look like hangs.
+// The writer is used from a background goroutine.
+func WithProgressHeartbeat(interval time.Duration, w io.Writer) Option {
+	return func(o *Options) {
+		o.ProgressHeartbeatInterval = interval
+		o.ProgressHeartbeatWriter = w
+	}
+}
+
+// WithHeartbeatToStderr writes progress heartbeats to os.Stderr.
+// Equivalent to WithProgressHeartbeat(interval, os.Stderr).
+func WithHeartbeatToStderr(interval time.Duration) Option {
+	return WithProgressHeartbeat(interval, os.Stderr)
+}
+
+// WithMessageFilter drops messages before they reach ReceiveMessages or an iterator.
+// The filter returns true to deliver a message and false to drop it.
+// Filtered messages still count toward GetStreamIssues and GetStreamStats.
+//
+// Example - suppress system messages and stream events:
+//
+//	claudecode.WithMessageFilter(func(msg claudecode.Message) bool {
+//	    switch msg.(type) {
+//	    case *claudecode.SystemMessage, *claudecode.StreamEvent:
+//	        return false
+//	    }
+//	    return true
+//	})
+func WithMessageFilter(filter func(Message) bool) Option {
+	return func(o *Options) {
+		o.MessageFilter = filter
+	}
+}
+
+// WithMessageMiddleware adds middleware that observes or transforms messages
+// before they reach ReceiveMessages or an iterator, e.g. for logging,
+// metrics, or redaction. Middlewares run in order, the first seeing each
+// message first; repeated calls append. A middleware passes a message on by
+// calling next, drops it by not calling next, and may call next with a
+// different message. Middleware runs after stream validation, callbacks,
+// and trackers, and before WithMessageFilter. Panics are recovered and the
+// original message is delivered if it had not been passed on.
+//
+// Example - log every message and strip thinking blocks:
+//
+//	claudecode.WithMessageMiddleware(
+//	    func(next claudecode.MessageHandler) claudecode.MessageHandler {
+//	        return func(msg claudecode.Message) {
+//	            log.Printf("message: %s", msg.Type())
+//	            next(msg)
+//	        }
+//	    },
+//	    func(next claudecode.MessageHandler) claudecode.MessageHandler {
+//	        return func(msg claudecode.Message) {
+//	            if m, ok := msg.(*claudecode.AssistantMessage); ok {
+//	                msg = withoutThinking(m)
+//	            }
+//	            next(msg)
+//	        }
+//	    },
+//	)
+func WithMessageMiddleware(middleware ...MessageMiddleware) Option {
+	return func(o *Options) {
+		o.MessageMiddleware = append(o.MessageMiddleware, middleware...)
+	}
+}
+
+// WithToolResultPostProcessor transforms tool results before Claude sees them,
+// e.g. to truncate noisy logs or add line numbers. It applies to results from
+// SDK MCP tools (toolName is mcp__<server>__<tool>, content is the MCP content
+// list) and to tool_result blocks the SDK sends in user messages (toolName is
+// resolved from the matching tool_use, content is the block's content).
+// Returning a string from an SDK MCP tool result replaces it with a single
+// text item. Processor panics leave the content unchanged.
+func WithToolResultPostProcessor(processor func(toolName string, content any) any) Option {
+	return func(o *Options) {
+		o.ToolResultPostProcessor = processor
+	}
+}
+
+// MinDeduplicatedToolResultBytes is the smallest JSON-encoded tool result
+// that WithToolResultDeduplication replaces when repeated.
+const MinDeduplicatedToolResultBytes = shared.MinDeduplicatedToolResultBytes
+
+// WithToolResultDeduplication replaces tool result content identical to an
+// earlier result in the session with a short note referring back to it, so
+// repeated large results do not reach Claude twice. Like
+// WithToolResultPostProcessor it applies to SDK MCP tool results and to
+// tool_result blocks the SDK sends, after the post-processor; results the CLI
+// produces itself, such as built-in Read, are not affected. Results shorter
+// than MinDeduplicatedToolResultBytes are never replaced. Results are
+// compared within a session only: a result first seen in another session
+// (QueryWithSession, after Reset, or from another QueryPool caller) is
+// passed through. Reconnecting forgets all results.
+func WithToolResultDeduplication() Option {
+	return func(o *Options) {
+		o.ToolResultDeduplication = true
+	}
+}
+
+// WithToolResultMaxItems caps tool result content lists at their first n
+// items, followed by a text item noting how many were omitted, so a tool
+// returning many content items (e.g. one per search hit) cannot flood the
+// context. It applies to the same results as WithToolResultPostProcessor,
+// after the post-processor and before deduplication. Plain string results
+// are not affected. Zero (default) means no limit.
+func WithToolResultMaxItems(n int) Option {
+	return func(o *Options) {
+		o.ToolResultMaxItems = n
+	}
+}
+
+// WithSdkMcpTrace registers a callback that receives the method and raw
+// params of every JSON-RPC request the CLI dispatches to an SDK MCP server,
+// such as initialize, tools/list, and tools/call, to debug how tools are
+// invoked. params is nil for requests without params. The callback runs
+// before the server handles the request and should return quickly; panics
+// are recovered.
+//
+// Example:
+//
+//	claudecode.WithSdkMcpTrace(func(method string, params json.RawMessage) {
+//	    log.Printf("mcp %s %s", method, params)
+//	})
+func WithSdkMcpTrace(trace func(method string, params json.RawMessage)) Option {
+	return func(o *Options) {
+		o.SdkMcpTrace = trace
+	}
+}
+
+// WithCostTracker records usage and cost from every ResultMessage into tracker.
+// Share one tracker across a Client session (or several sessions) to keep a
+// running total for billing.
+//
+// Example:
+//
+//	tracker := claudecode.NewCostTracker()
+//	client := claudecode.NewClient(claudecode.WithCostTracker(tracker))
+//	// ... run several turns ...
+//	fmt.Printf("tokens=%d cost=$%.4f\n", tracker.Total().TotalTokens(), tracker.TotalCostUSD())
+func WithCostTracker(tracker *CostTracker) Option {
+	return func(o *Options) {
+		o.CostTracker = tracker
+	}
+}
+
+// WithToolMetrics records per-tool invocations, successes, errors, and
+// durations into metrics by correlating tool_use blocks with their results.
+//
+// Example:
+//
+//	metrics := claudecode.NewToolMetrics()
+//	client := claudecode.NewClient(claudecode.WithToolMetrics(metrics))
+//	// ... run several turns ...
+//	for name, stat := range metrics.Snapshot() {
+//	    fmt.Printf("%s: %d calls, %d errors, avg %s\n", name, stat.Invocations, stat.Errors, stat.AverageDuration())
+//	}
+func WithToolMetrics(metrics *ToolMetrics) Option {
+	return func(o *Options) {
+		o.ToolMetrics = metrics
+	}
+}
+
+// WithResponseCollector aggregates each turn into a Response holding its
+// concatenated text, tool uses, thinking blocks, and result. The Response
+// is available from collector.Last() once the turn's ResultMessage has been
+// received.
+//
+// Example:
+//
+//	collector := claudecode.NewResponseCollector()
+//	client := claudecode.NewClient(claudecode.WithResponseCollector(collector))
+//	// ... send a query and read messages until the ResultMessage ...
+//	response := collector.Last()
+//	fmt.Println(response.Text, len(response.ToolUses))
+func WithResponseCollector(collector *ResponseCollector) Option {
+	return func(o *Options) {
+		o.ResponseCollector = collector
+	}
+}
+
+// WithInputValidation makes Query, QueryWithTransport, and the client's Query,
+// QueryWithSession, and QueryWithID return a *ValidationError for the
+// "prompt" field, without starting the CLI or sending anything, when a prompt
+// is empty or only whitespace, shorter than minLen bytes, or longer than
+// maxLen bytes. A maxLen of zero sets no maximum. Prompts are checked as
+// passed, before context files, the request interceptor, and large prompt
+// handling apply.
+//
+// Example:
+//
+//	client := claudecode.NewClient(claudecode.WithInputValidation(1, 100_000))
+//	if err := client.Query(ctx, prompt); claudecode.IsValidationError(err) {
+//	    return fmt.Errorf("bad prompt: %w", err)
+//	}
+func WithInputValidation(minLen, maxLen int) Option {
+	return func(o *Options) {
+		o.InputValidation = true
+		o.PromptMinLength = minLen
+		o.PromptMaxLength = maxLen
+	}
+}
+
+// WithLargePromptHandling applies strategy to text prompts larger than
+// threshold bytes, after any request interceptor has run:
+//
+//   - LargePromptStrategyError rejects the prompt with a *PromptTooLargeError.
+//   - LargePromptStrategyTruncate cuts it to at most threshold bytes, on a
+//     UTF-8 boundary.
+//   - LargePromptStrategyFile writes it to a temporary file (mode 0600) and
+//     sends a short prompt asking the model to read that file. The model needs
+//     permission to read the system temp directory (see WithAddDirs). A
+//     client's file is removed when its turn's ResultMessage arrives, or on
+//     Client.Disconnect; a Query iterator's when it is closed.
+//
+// It applies to Query, QueryWithTransport, and the client's Query,
+// QueryWithSession, and QueryWithID. A threshold of zero disables it, and an
+// empty strategy behaves like LargePromptStrategyError.
+//
+// Example:
+//
+//	claudecode.WithLargePromptHandling(512*1024, claudecode.LargePromptStrategyFile)
+func WithLargePromptHandling(threshold int, strategy LargePromptStrategy) Option {
+	return func(o *Options) {
+		o.LargePromptThreshold = threshold
+		o.LargePromptStrategy = strategy
+	}
+}
+
+// DefaultContextFilesMaxBytes is the context file budget used by
+// WithContextFiles unless WithContextFilesBudget sets another.
+const DefaultContextFilesMaxBytes = shared.DefaultContextFilesMaxBytes
+
+// WithContextFiles reads the files at paths and prepends their contents to
+// the first prompt sent, each wrapped in a <file path="..."> header, so
+// questions about a codebase start with the relevant files in context.
+// Paths are read when the prompt is sent, relative to the current directory
+// of the process. Calls accumulate.
+//
+// File content is limited to DefaultContextFilesMaxBytes in total (see
+// WithContextFilesBudget): a file that does not fit is cut on a UTF-8
+// boundary and marked truncated="true", and files after it are listed with
+// empty content. A file that cannot be read fails the query.
+//
+// It applies to Query and QueryWithTransport, and to the first Query,
+// QueryWithSession, or QueryWithID of each client connection or after
+// Client.Reset. The request interceptor and large prompt handling see the
+// prompt with the files included.
+//
+// Example:
+//
+//	claudecode.WithContextFiles("go.mod", "internal/parser/json.go")
+func WithContextFiles(paths ...string) Option {
+	return func(o *Options) {
+		o.ContextFiles = append(o.ContextFiles, paths...)
+	}
+}
+
+// WithContextManifest tells the CLI which files are relevant to the session
+// without reading them into the prompt, so it can read them with its tools as
+// needed. The CLI has no native manifest, so the paths are listed in a section
+// appended to the system prompt, after any WithAppendSystemPrompt text. Paths
+// are passed as given; relative paths resolve against the working directory.
+// Calls accumulate.
+//
+// Example:
+//
+//	claudecode.WithContextManifest("docs/architecture.md", "internal/parser/json.go")
+func WithContextManifest(paths ...string) Option {
+	return func(o *Options) {
+		o.ContextManifest = append(o.ContextManifest, paths...)
+	}
+}
+
+// WithContextFilesBudget limits the file content WithContextFiles includes
+// to maxBytes in total. Zero uses DefaultContextFilesMaxBytes.
+func WithContextFilesBudget(maxBytes int) Option {
+	return func(o *Options) {
+		o.ContextFilesMaxBytes = maxBytes
+	}
+}
+
+// WithPromptSuffix appends standing instructions to every text prompt, so
+// they need not be repeated in each one: Query, QueryWithTransport, and the
+// Client's Query, QueryWithSession, and QueryWithID. The suffix follows the
+// prompt after a blank line. Messages sent with QueryStream or
+// SendUserMessage are unchanged. Input validation checks the prompt without
+// the suffix; the request interceptor and large prompt handling see it with
+// the suffix. An empty suffix appends nothing.
+//
+// Example:
+//
+//	claudecode.WithPromptSuffix("Always respond in Markdown.")
+func WithPromptSuffix(text string) Option {
+	return func(o *Options) {
+		o.PromptSuffix = text
+	}
+}
+
+// WithRequestInterceptor runs interceptor on every text prompt before it is
+// sent to the CLI: Query, QueryWithTransport, and the Client's Query,
+// QueryWithSession, and QueryWithID. The interceptor returns the prompt to
+// send, so it can rewrite it (for example to scrub PII), or an error to reject
+// it. A rejected prompt is not sent and the call returns an error wrapping the
+// interceptor's error. Messages sent with QueryStream are not intercepted.
+//
+// Example:
+//
+//	claudecode.WithRequestInterceptor(func(prompt string) (string, error) {
+//	    return emailPattern.ReplaceAllString(prompt, "[EMAIL]"), nil
+//	})
+func WithRequestInterceptor(interceptor func(prompt string) (string, error)) Option {
+	return func(o *Options) {
+		o.RequestInterceptor = interceptor
+	}
+}
+
+// WithOnThinking registers a callback that receives every extended thinking
+// block as assistant messages are parsed, so reasoning can be logged without
+// inspecting content blocks in the receive loop. The callback runs on the
+// message reader goroutine and should return quickly; panics are recovered.
+//
+// Example:
+//
+//	claudecode.WithOnThinking(func(block *claudecode.ThinkingBlock) {
+//	    log.Printf("thinking: %s", block.Thinking)
+//	})
+func WithOnThinking(callback func(*ThinkingBlock)) Option {
+	return func(o *Options) {
+		o.OnThinking = callback
+	}
+}
+
+// WithTurnCallback registers callbacks marking the start and end of each
+// turn, for logging and metrics. onStart is called with the prompt once it is
+// sent by the client's Query, QueryWithSession, or QueryWithID, or by Query
+// and QueryWithTransport on the iterator's first Next, after context files,
+// the request interceptor, and large prompt handling have applied. A prompt
+// that fails to send is not reported. onEnd is called with each
+// ResultMessage before it is delivered, including results of turns started by
+// QueryStream or SendUserMessage; results held back by WithOverloadBackoff
+// for a retry are not. A turn's onStart is always called before its onEnd.
+// Either callback may be nil. Callbacks run on the caller's or the message
+// reader's goroutine and should return quickly; panics are recovered.
+//
+// Example:
+//
+//	claudecode.WithTurnCallback(
+//	    func(prompt string) { log.Printf("turn started: %.40q", prompt) },
+//	    func(result *claudecode.ResultMessage) {
+//	        log.Printf("turn ended: %s in %v", result.Subtype, result.Duration)
+//	    },
+//	)
+func WithTurnCallback(onStart func(prompt string), onEnd func(*ResultMessage)) Option {
+	return func(o *Options) {
+		o.OnTurnStart = onStart
+		o.OnTurnEnd = onEnd
+	}
+}
+
+// WithOnToolResult registers a callback that receives every tool result block
+// as user messages are parsed, so tool output can be observed without a
+// PostToolUse hook (which requires the control protocol). Match results to
+// calls by ToolUseID. The callback runs on the message reader goroutine and
+// should return quickly; panics are recovered.
+//
+// Example:
+//
+//	claudecode.WithOnToolResult(func(block *claudecode.ToolResultBlock) {
+//	    log.Printf("result for %s: %v", block.ToolUseID, block.Content)
+//	})
+func WithOnToolResult(callback func(*ToolResultBlock)) Option {
+	return func(o *Options) {
+		o.OnToolResult = callback
+	}
+}
+
+// WithOnResultError registers a callback that receives every result message
+// ending a turn in an error (IsError set), with the result text in Result and
+// its category in ErrorType. Unlike the errors returned by Connect, Query, or
+// the error channel, it sees only turns the CLI completed unsuccessfully, not
+// transport or connection failures. The callback runs on the message reader
+// goroutine and should return quickly; panics are recovered.
+//
+// Example:
+//
+//	claudecode.WithOnResultError(func(result *claudecode.ResultMessage) {
+//	    if result.Result != nil {
+//	        log.Printf("turn failed (%s): %s", result.ErrorType, *result.Result)
+//	    }
+//	})
+func WithOnResultError(callback func(*ResultMessage)) Option {
+	return func(o *Options) {
+		o.OnResultError = callback
+	}
+}
+
+// WithOnToolsChanged registers a callback that receives the session's tool
+// list from the init system message, and again whenever the CLI reports a
+// different list mid-session, for example after an MCP server reconnects.
+// The callback runs on the message reader goroutine and should return
+// quickly; panics are recovered.
+//
+// Example:
+//
+//	claudecode.WithOnToolsChanged(func(tools []claudecode.ToolInfo) {
+//	    ui.SetTools(tools)
+//	})
+func WithOnToolsChanged(callback func([]ToolInfo)) Option {
+	return func(o *Options) {
+		o.OnToolsChanged = callback
+	}
+}
+
+// WithOnResourceUpdate registers a callback that receives each MCP resource
+// update reported during a session. Re-read the resource by its URI to get
+// the new contents. The callback runs on the message reader goroutine and
+// should return quickly; panics are recovered.
+//
+// Experimental: the CLI does not document a message for resource updates.
+// The callback fires only for SystemMessages with subtype
+// SystemSubtypeResourceUpdated, a format the SDK recognizes but the CLI may
+// never send. The format may change once the CLI defines one.
+//
+// Example:
+//
+//	claudecode.WithOnResourceUpdate(func(update claudecode.ResourceUpdate) {
+//	    log.Printf("%s changed on %s", update.URI, update.Server)
+//	})
+func WithOnResourceUpdate(callback func(ResourceUpdate)) Option {
+	return func(o *Options) {
+		o.OnResourceUpdate = callback
+	}
+}
+
+// WithOnStreamEvent registers a callback that receives every stream event
+// with its common fields decoded, such as text and tool input deltas, so
+// partial output can be rendered without inspecting StreamEvent.Event maps.
+// Stream events are only sent with WithPartialStreaming. The callback runs
+// on the message reader goroutine and should return quickly; panics are
+// recovered.
+//
+// Example:
+//
+//	claudecode.WithOnStreamEvent(func(event claudecode.ParsedStreamEvent) {
+//	    if event.Delta != nil && event.Delta.Type == claudecode.StreamDeltaTypeText {
+//	        fmt.Print(event.Delta.Text)
+//	    }
+//	})
+func WithOnStreamEvent(callback func(ParsedStreamEvent)) Option {
+	return func(o *Options) {
+		o.OnStreamEvent = callback
+	}
+}
+
+// WithDisconnectCallback registers a callback that runs once when a Client
+// connection ends, for cleanup such as flushing metrics. reason is nil when
+// Disconnect closed the connection, the Connect context's error when it was
+// cancelled, and otherwise the last error received before the CLI stopped
+// (ErrUnexpectedEOF or a *ConnectionError if there was none).
+//
+// Disconnect waits for the callback to return, unless the callback is
+// already running for another reason; the callback may itself call
+// Disconnect. In other cases it runs on the message reader goroutine; panics
+// are recovered. It fires again for each new Connect. Query and
+// QueryWithTransport ignore it.
+//
+// Example:
+//
+//	claudecode.WithDisconnectCallback(func(reason error) {
+//	    metrics.Flush()
+//	    if reason != nil {
+//	        log.Printf("connection lost: %v", reason)
+//	    }
+//	})
+func WithDisconnectCallback(callback func(reason error)) Option {
+	return func(o *Options) {
+		o.OnDisconnect = callback
+	}
+}
+
+// WithTracer opens spans through tracer around each turn (SpanNameTurn, from
+// sending a prompt to its ResultMessage) and each SDK MCP tool handler call
+// (SpanNameToolCall). Tool results sent back mid-turn, with a parent tool use
+// ID or only tool result content, continue the turn. Tool call spans are
+// children of the active turn span, and handlers receive a context carrying
+// their span. Spans end with an error for error results, failed handlers, or
+// a connection that ends mid-turn. Spans come from the built-in CLI
+// transport, so custom transports have none.
+//
+// Example:
+//
+//	claudecode.WithTracer(otelTracerAdapter{tracer: otel.Tracer("claude")})
+func WithTracer(tracer Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
+// WithClock replaces the clock behind the SDK's time-dependent behavior:
+// session deadlines (WithMaxSessionDuration), idle disconnects
+// (WithMaxIdleTime), overload retry delays (WithOverloadBackoff), progress
+// heartbeats, graceful interrupt grace periods, and the MCP startup timeout
+// in WaitForReady. Tests can pass a claudecodetest.FakeClock to trigger these
+// without real sleeps. Waits for the CLI process to exit still use real time.
+//
+// Example:
+//
+//	clock := claudecodetest.NewFakeClock(time.Now())
+//	client := claudecode.NewClient(
+//	    claudecode.WithClock(clock),
+//	    claudecode.WithMaxSessionDuration(time.Hour),
+//	)
+func WithClock(clock Clock) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
 // OutputFormatJSONSchema creates an OutputFormat for JSON schema constraints.
 func OutputFormatJSONSchema(schema map[string]any) *OutputFormat {
 	return &OutputFormat{
@@ -547,9 +1540,44 @@ func WithJSONSchema(schema map[string]any) Option {
 	}
 }
 
+// WithJSONSchemaStrict sets a JSON schema output format with
+// additionalProperties: false added at every object level, and rejects
+// structured output containing extra fields. Iterators return a
+// *StructuredOutputError for a ResultMessage whose StructuredOutput has
+// fields the schema does not allow. A nil schema clears the output format.
+func WithJSONSchemaStrict(schema map[string]any) Option {
+	return func(o *Options) {
+		if schema == nil {
+			o.OutputFormat = nil
+			o.StrictStructuredOutput = false
+			return
+		}
+		o.OutputFormat = OutputFormatJSONSchema(StrictJSONSchema(schema))
+		o.StrictStructuredOutput = true
+	}
+}
+
+// WithResponseSchemaFromType sets a JSON schema output format generated from
+// the Go type of v by JSONSchemaFromType. Pass a zero value of the struct the
+// structured output will be decoded into. A nil v clears the output format.
+//
+// Example:
+//
+//	type TaskList struct {
+//	    Tasks    []string `json:"tasks" description:"Tasks found in the text"`
+//	    Priority string   `json:"priority" enum:"low,medium,high"`
+//	}
+//
+//	claudecode.WithResponseSchemaFromType(TaskList{})
+func WithResponseSchemaFromType(v any) Option {
+	return WithJSONSchema(JSONSchemaFromType(v))
+}
+
 // WithIncludePartialMessages enables streaming of partial message updates.
 // When true, StreamEvent messages are emitted during response generation,
-// providing real-time progress as the model generates content.
+// providing real-time progress as the model generates content. Works with
+// both Client and Query: the Query iterator's Next yields the StreamEvents
+// before the complete AssistantMessage.
 func WithIncludePartialMessages(include bool) Option {
 	return func(o *Options) {
 		o.IncludePartialMessages = include
@@ -562,6 +1590,19 @@ func WithPartialStreaming() Option {
 	return WithIncludePartialMessages(true)
 }
 
+// WithPartialStreamingOptions enables partial message streaming and selects
+// which content_block_delta types are forwarded. Deltas of disabled types are
+// dropped by the SDK; message and content block boundary events are always
+// forwarded. For example, to stream text but not noisy tool input:
+//
+//	claudecode.WithPartialStreamingOptions(claudecode.PartialStreamOptions{Text: true})
+func WithPartialStreamingOptions(opts PartialStreamOptions) Option {
+	return func(o *Options) {
+		o.IncludePartialMessages = true
+		o.PartialStream = &opts
+	}
+}
+
 // =============================================================================
 // File Checkpointing Options (Issue #32)
 // =============================================================================
@@ -651,6 +1692,160 @@ func WithCanUseTool(callback CanUseToolCallback) Option {
 	}
 }
 
+// PlanProposal is a plan Claude proposes in plan mode through ExitPlanMode.
+type PlanProposal = shared.PlanProposal
+
+// WithOnPlanProposal decides plans Claude proposes in plan permission mode
+// (see WithPermissionMode and PermissionModePlan). When Claude calls the
+// ExitPlanMode tool, callback receives the plan: returning true approves it
+// and lets Claude leave plan mode, returning false denies the request so
+// Claude stays in plan mode and revises the plan. A panicking callback
+// rejects the plan.
+//
+// ExitPlanMode requests are decided here instead of by WithCanUseTool, which
+// still decides all other tools. Without WithCanUseTool, other tools the CLI
+// asks about are denied, as the CLI does when it cannot prompt; allow them
+// up front with WithAllowedTools. Only available with Client.
+//
+// Example:
+//
+//	claudecode.WithPermissionMode(claudecode.PermissionModePlan),
+//	claudecode.WithOnPlanProposal(func(p *claudecode.PlanProposal) bool {
+//	    fmt.Println(p.Plan)
+//	    return askYesNo("Approve this plan?")
+//	}),
+func WithOnPlanProposal(callback func(*PlanProposal) (approve bool)) Option {
+	return func(o *Options) {
+		o.OnPlanProposal = callback
+	}
+}
+
+// WithEditConfirmation asks confirm to approve each Write, Edit, and MultiEdit
+// tool call before it runs. confirm receives the file path from the tool
+// input and a unified diff (see UnifiedDiff) from the file's current content
+// to its content after the edit; a file that does not exist yet is diffed as
+// empty, and relative paths are read from the working directory set with
+// WithCwd. Returning false denies the tool call; returning true passes it on
+// to WithCanUseTool, or allows it if no callback is set. Other tools the
+// CLI asks about still need WithCanUseTool and are denied without it. A
+// panicking callback rejects the edit. Only available with Client.
+//
+// Example:
+//
+//	claudecode.WithEditConfirmation(func(path, diff string) bool {
+//	    fmt.Print(diff)
+//	    return askYesNo("Apply changes to " + path + "?")
+//	}),
+func WithEditConfirmation(confirm func(path, diff string) bool) Option {
+	return func(o *Options) {
+		o.EditConfirmation = confirm
+	}
+}
+
+// ToolConfirmation is a pending tool permission request delivered over the
+// channel given to WithToolConfirmationChannel. Send exactly one decision on
+// Reply, or use Approve, Deny, or Respond.
+type ToolConfirmation struct {
+	// ToolName is the tool the CLI wants to use.
+	ToolName string
+	// Input holds the tool's input parameters.
+	Input map[string]any
+	// Context carries CLI suggestions and the requesting agent, if any.
+	Context ToolPermissionContext
+	// Reply receives the decision. It is buffered, so replying never blocks.
+	Reply chan<- PermissionResult
+}
+
+// Approve allows the tool use unchanged.
+func (c ToolConfirmation) Approve() {
+	c.Respond(NewPermissionResultAllow())
+}
+
+// Deny rejects the tool use with a message shown to the model.
+func (c ToolConfirmation) Deny(message string) {
+	c.Respond(NewPermissionResultDeny(message))
+}
+
+// Respond sends a decision. Only the first decision is used; later ones are dropped.
+func (c ToolConfirmation) Respond(result PermissionResult) {
+	select {
+	case c.Reply <- result:
+	default:
+	}
+}
+
+// WithToolConfirmationChannel routes tool permission requests to confirmations
+// for human-in-the-loop approval: for each request the SDK sends a
+// ToolConfirmation and waits for a decision on its Reply channel. It is an
+// asynchronous alternative to WithCanUseTool and replaces any callback set
+// with it (the last of the two options wins).
+//
+// If the request's context ends before the confirmation is received or
+// answered, the CLI gets an error response and the tool does not run.
+// A nil decision denies the tool.
+//
+// Example:
+//
+//	confirmations := make(chan claudecode.ToolConfirmation)
+//	client := claudecode.NewClient(claudecode.WithToolConfirmationChannel(confirmations))
+//	go func() {
+//	    for req := range confirmations {
+//	        if askUser(req.ToolName, req.Input) {
+//	            req.Approve()
+//	        } else {
+//	            req.Deny("rejected by user")
+//	        }
+//	    }
+//	}()
+func WithToolConfirmationChannel(confirmations chan ToolConfirmation) Option {
+	if confirmations == nil {
+		return WithCanUseTool(nil)
+	}
+	return WithCanUseTool(func(
+		ctx context.Context,
+		toolName string,
+		input map[string]any,
+		permCtx ToolPermissionContext,
+	) (PermissionResult, error) {
+		reply := make(chan PermissionResult, 1)
+		request := ToolConfirmation{ToolName: toolName, Input: input, Context: permCtx, Reply: reply}
+
+		select {
+		case confirmations <- request:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("tool confirmation for %s not received: %w", toolName, ctx.Err())
+		}
+
+		select {
+		case result := <-reply:
+			if result == nil {
+				return NewPermissionResultDeny("no decision for tool " + toolName), nil
+			}
+			return result, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("tool confirmation for %s not answered: %w", toolName, ctx.Err())
+		}
+	})
+}
+
+// WithToolApprovalCache remembers the allow and deny decisions made by
+// WithCanUseTool (or WithToolConfirmationChannel) and applies them to later
+// requests for the same tool with the same input, without asking again.
+// Inputs match when their JSON encodings are equal, so key order does not
+// matter. Decisions are kept across reconnects until Client.ClearApprovalCache.
+//
+// Example:
+//
+//	client := claudecode.NewClient(
+//	    claudecode.WithToolConfirmationChannel(confirmations),
+//	    claudecode.WithToolApprovalCache(),
+//	)
+func WithToolApprovalCache() Option {
+	return func(o *Options) {
+		o.ToolApprovalCache = shared.NewToolApprovalCache()
+	}
+}
+
 // =============================================================================
 // Hook Types (Issue #9)
 // =============================================================================
@@ -786,3 +1981,40 @@ func WithPreToolUseHook(matcher string, callback HookCallback) Option {
 func WithPostToolUseHook(matcher string, callback HookCallback) Option {
 	return WithHook(HookEventPostToolUse, matcher, callback)
 }
+
+// WithBashTimeout injects a default timeout into Bash tool calls that don't
+// specify one. The timeout is applied through a PreToolUse hook that rewrites
+// the tool input; calls that already set "timeout" are left unchanged.
+// The Bash tool expects milliseconds and caps timeouts at 10 minutes.
+func WithBashTimeout(d time.Duration) Option {
+	return WithPreToolUseHook("Bash", bashTimeoutHook(d))
+}
+
+// bashTimeoutHook returns a PreToolUse callback that adds a default timeout
+// to Bash tool inputs lacking one.
+func bashTimeoutHook(d time.Duration) HookCallback {
+	timeoutMs := d.Milliseconds()
+	return func(_ context.Context, input any, _ *string, _ HookContext) (HookJSONOutput, error) {
+		preToolUse, ok := input.(*PreToolUseHookInput)
+		if !ok || preToolUse.ToolName != "Bash" || timeoutMs <= 0 {
+			return HookJSONOutput{}, nil
+		}
+		if _, exists := preToolUse.ToolInput["timeout"]; exists {
+			return HookJSONOutput{}, nil
+		}
+
+		// Copy so the original input map is never mutated
+		updated := make(map[string]any, len(preToolUse.ToolInput)+1)
+		for k, v := range preToolUse.ToolInput {
+			updated[k] = v
+		}
+		updated["timeout"] = timeoutMs
+
+		return HookJSONOutput{
+			HookSpecificOutput: PreToolUseHookSpecificOutput{
+				HookEventName: string(HookEventPreToolUse),
+				UpdatedInput:  updated,
+			},
+		}, nil
+	}
+}
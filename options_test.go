@@ -3,9 +3,14 @@ package claudecode
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
+	"os/exec"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // Ensure context is used (for mock transport)
@@ -144,6 +149,60 @@ func TestSystemPromptOptions(t *testing.T) {
 	assertOptionsSystemPromptNil(t, appendOnlyOptions)
 }
 
+// TestWithSystemPromptLayers tests composing the system prompt from ordered layers
+func TestWithSystemPromptLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		layers   []string
+		expected *string
+	}{
+		{
+			name:     "ordered_layers",
+			layers:   []string{"You are a code reviewer.", "Review the diff.", "Never reveal secrets."},
+			expected: stringPtr("You are a code reviewer.\n\n---\n\nReview the diff.\n\n---\n\nNever reveal secrets."),
+		},
+		{
+			name:     "single_layer",
+			layers:   []string{"Base persona"},
+			expected: stringPtr("Base persona"),
+		},
+		{
+			name:     "blank_layers_skipped_and_trimmed",
+			layers:   []string{"  Base  ", "", "\n", "Task\n"},
+			expected: stringPtr("Base" + SystemPromptLayerSeparator + "Task"),
+		},
+		{
+			name:     "no_layers",
+			layers:   nil,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := NewOptions(WithSystemPromptLayers(test.layers...))
+			if test.expected == nil {
+				assertOptionsSystemPromptNil(t, options)
+				return
+			}
+			assertOptionsSystemPrompt(t, options, *test.expected)
+		})
+	}
+
+	t.Run("order_is_preserved", func(t *testing.T) {
+		options := NewOptions(WithSystemPromptLayers("safety", "persona"))
+		assertOptionsSystemPrompt(t, options, "safety"+SystemPromptLayerSeparator+"persona")
+	})
+
+	t.Run("replaces_previous_system_prompt", func(t *testing.T) {
+		options := NewOptions(
+			WithSystemPrompt("old"),
+			WithSystemPromptLayers("base", "task"),
+		)
+		assertOptionsSystemPrompt(t, options, "base"+SystemPromptLayerSeparator+"task")
+	})
+}
+
 // T019: Session Continuation Options
 func TestSessionContinuationOptions(t *testing.T) {
 	// Test continue_conversation and resume options
@@ -1713,6 +1772,36 @@ func TestSessionManagementOptions(t *testing.T) {
 	})
 }
 
+// TestWithResumeAt tests resuming a session as of a specific message UUID
+func TestWithResumeAt(t *testing.T) {
+	t.Run("sets_resume_and_message", func(t *testing.T) {
+		options := NewOptions(WithResumeAt("session-123", "msg-uuid-456"))
+		assertOptionsResume(t, options, "session-123")
+		if options.ResumeSessionAt == nil || *options.ResumeSessionAt != "msg-uuid-456" {
+			t.Errorf("Expected ResumeSessionAt = %q, got %v", "msg-uuid-456", options.ResumeSessionAt)
+		}
+	})
+
+	t.Run("nil_by_default", func(t *testing.T) {
+		options := NewOptions(WithResume("session-123"))
+		if options.ResumeSessionAt != nil {
+			t.Errorf("Expected ResumeSessionAt = nil, got %q", *options.ResumeSessionAt)
+		}
+	})
+
+	t.Run("composes_with_fork_session", func(t *testing.T) {
+		options := NewOptions(
+			WithResumeAt("session-123", "msg-uuid-456"),
+			WithForkSession(true),
+		)
+		assertOptionsResume(t, options, "session-123")
+		assertOptionsForkSession(t, options, true)
+		if options.ResumeSessionAt == nil || *options.ResumeSessionAt != "msg-uuid-456" {
+			t.Errorf("Expected ResumeSessionAt = %q, got %v", "msg-uuid-456", options.ResumeSessionAt)
+		}
+	})
+}
+
 // assertOptionsForkSession verifies ForkSession value
 func assertOptionsForkSession(t *testing.T, options *Options, expected bool) {
 	t.Helper()
@@ -1868,6 +1957,37 @@ func TestDebugWriterConvenienceFunctions(t *testing.T) {
 	})
 }
 
+// TestWithProgressHeartbeat tests progress heartbeat options
+func TestWithProgressHeartbeat(t *testing.T) {
+	t.Run("sets_interval_and_writer", func(t *testing.T) {
+		var buf bytes.Buffer
+		options := NewOptions(WithProgressHeartbeat(30*time.Second, &buf))
+		if options.ProgressHeartbeatInterval != 30*time.Second {
+			t.Errorf("Expected interval 30s, got %v", options.ProgressHeartbeatInterval)
+		}
+		if options.ProgressHeartbeatWriter != &buf {
+			t.Errorf("Expected custom writer, got %T", options.ProgressHeartbeatWriter)
+		}
+	})
+
+	t.Run("WithHeartbeatToStderr_uses_os_stderr", func(t *testing.T) {
+		options := NewOptions(WithHeartbeatToStderr(time.Minute))
+		if options.ProgressHeartbeatWriter != os.Stderr {
+			t.Errorf("Expected os.Stderr, got %T", options.ProgressHeartbeatWriter)
+		}
+		if options.ProgressHeartbeatInterval != time.Minute {
+			t.Errorf("Expected interval 1m, got %v", options.ProgressHeartbeatInterval)
+		}
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		options := NewOptions()
+		if options.ProgressHeartbeatInterval != 0 || options.ProgressHeartbeatWriter != nil {
+			t.Error("Expected heartbeat to be disabled by default")
+		}
+	})
+}
+
 // T037: OutputFormat Option - Structured Output Support (Issue #29)
 func TestWithOutputFormat(t *testing.T) {
 	tests := []struct {
@@ -2657,6 +2777,13 @@ func TestIncludePartialMessagesOption(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "streaming_options_enable_partial_messages",
+			setup: func() *Options {
+				return NewOptions(WithPartialStreamingOptions(PartialStreamOptions{Text: true}))
+			},
+			expected: true,
+		},
 		{
 			name: "default_is_false",
 			setup: func() *Options {
@@ -2684,6 +2811,19 @@ func TestIncludePartialMessagesOption(t *testing.T) {
 	}
 }
 
+// TestWithPartialStreamingOptions tests selecting forwarded delta types
+func TestWithPartialStreamingOptions(t *testing.T) {
+	if NewOptions(WithPartialStreaming()).PartialStream != nil {
+		t.Error("Expected WithPartialStreaming to forward all delta types")
+	}
+
+	options := NewOptions(WithPartialStreamingOptions(PartialStreamOptions{Text: true, Thinking: true}))
+	want := PartialStreamOptions{Text: true, Thinking: true}
+	if options.PartialStream == nil || *options.PartialStream != want {
+		t.Errorf("Expected PartialStream %+v, got %+v", want, options.PartialStream)
+	}
+}
+
 // assertOptionsIncludePartialMessages verifies IncludePartialMessages field
 func assertOptionsIncludePartialMessages(t *testing.T, options *Options, expected bool) {
 	t.Helper()
@@ -3599,3 +3739,1053 @@ func TestWithSdkMcpServer(t *testing.T) {
 		}
 	})
 }
+
+// TestWithBashTimeout tests default timeout injection into Bash tool inputs
+func TestWithBashTimeout(t *testing.T) {
+	options := NewOptions(WithBashTimeout(90 * time.Second))
+
+	storedHooks, ok := options.Hooks.(map[HookEvent][]HookMatcher)
+	if !ok {
+		t.Fatalf("Expected Hooks to be map[HookEvent][]HookMatcher, got %T", options.Hooks)
+	}
+	matchers := storedHooks[HookEventPreToolUse]
+	if len(matchers) != 1 || matchers[0].Matcher != "Bash" || len(matchers[0].Hooks) != 1 {
+		t.Fatalf("Expected one Bash PreToolUse hook, got %+v", matchers)
+	}
+	hook := matchers[0].Hooks[0]
+	ctx := context.Background()
+
+	t.Run("injects_timeout_when_missing", func(t *testing.T) {
+		toolInput := map[string]any{"command": "sleep 1000"}
+		input := &PreToolUseHookInput{ToolName: "Bash", ToolInput: toolInput}
+
+		output, err := hook(ctx, input, nil, HookContext{})
+		assertNoError(t, err)
+
+		specific, ok := output.HookSpecificOutput.(PreToolUseHookSpecificOutput)
+		if !ok {
+			t.Fatalf("Expected PreToolUseHookSpecificOutput, got %T", output.HookSpecificOutput)
+		}
+		if specific.HookEventName != "PreToolUse" {
+			t.Errorf("HookEventName = %q, want %q", specific.HookEventName, "PreToolUse")
+		}
+		if specific.UpdatedInput["timeout"] != int64(90000) {
+			t.Errorf("Expected timeout 90000, got %v", specific.UpdatedInput["timeout"])
+		}
+		if specific.UpdatedInput["command"] != "sleep 1000" {
+			t.Errorf("Expected command preserved, got %v", specific.UpdatedInput["command"])
+		}
+		if _, mutated := toolInput["timeout"]; mutated {
+			t.Error("Expected original tool input to be left unmodified")
+		}
+	})
+
+	t.Run("leaves_existing_timeout_unchanged", func(t *testing.T) {
+		input := &PreToolUseHookInput{
+			ToolName:  "Bash",
+			ToolInput: map[string]any{"command": "ls", "timeout": float64(5000)},
+		}
+
+		output, err := hook(ctx, input, nil, HookContext{})
+		assertNoError(t, err)
+		if output.HookSpecificOutput != nil {
+			t.Errorf("Expected no input rewrite, got %+v", output.HookSpecificOutput)
+		}
+	})
+
+	t.Run("ignores_other_tools", func(t *testing.T) {
+		input := &PreToolUseHookInput{ToolName: "Read", ToolInput: map[string]any{"file_path": "/tmp/x"}}
+
+		output, err := hook(ctx, input, nil, HookContext{})
+		assertNoError(t, err)
+		if output.HookSpecificOutput != nil {
+			t.Errorf("Expected no input rewrite, got %+v", output.HookSpecificOutput)
+		}
+	})
+}
+
+// TestWithMessageFilter tests the message filter option is stored and applied
+func TestWithMessageFilter(t *testing.T) {
+	options := NewOptions()
+	if options.MessageFilter != nil {
+		t.Error("Expected nil MessageFilter by default")
+	}
+
+	options = NewOptions(WithMessageFilter(func(msg Message) bool {
+		_, isSystem := msg.(*SystemMessage)
+		return !isSystem
+	}))
+	if options.MessageFilter == nil {
+		t.Fatal("Expected MessageFilter to be set")
+	}
+	if options.MessageFilter(&SystemMessage{Subtype: "init"}) {
+		t.Error("Expected SystemMessage to be filtered out")
+	}
+	if !options.MessageFilter(&AssistantMessage{}) {
+		t.Error("Expected AssistantMessage to pass the filter")
+	}
+}
+
+// TestWithMessageMiddleware tests repeated calls append middleware in order
+func TestWithMessageMiddleware(t *testing.T) {
+	if NewOptions().MessageMiddleware != nil {
+		t.Error("Expected no MessageMiddleware by default")
+	}
+
+	var order []string
+	tag := func(name string) MessageMiddleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(msg Message) {
+				order = append(order, name)
+				next(msg)
+			}
+		}
+	}
+	options := NewOptions(
+		WithMessageMiddleware(tag("first"), tag("second")),
+		WithMessageMiddleware(tag("third")),
+	)
+	if len(options.MessageMiddleware) != 3 {
+		t.Fatalf("Expected 3 middlewares, got %d", len(options.MessageMiddleware))
+	}
+
+	handler := ChainMessageMiddleware(func(Message) { order = append(order, "final") }, options.MessageMiddleware...)
+	handler(&AssistantMessage{})
+	if want := []string{"first", "second", "third", "final"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Expected order %q, got %q", want, order)
+	}
+}
+
+// TestWithCostTracker tests the cost tracker option is stored on Options
+func TestWithCostTracker(t *testing.T) {
+	if NewOptions().CostTracker != nil {
+		t.Error("Expected nil CostTracker by default")
+	}
+
+	tracker := NewCostTracker()
+	options := NewOptions(WithCostTracker(tracker))
+	if options.CostTracker != tracker {
+		t.Error("Expected CostTracker to be the provided tracker")
+	}
+}
+
+// TestWithToolMetrics tests the tool metrics option is stored on Options
+func TestWithToolMetrics(t *testing.T) {
+	if NewOptions().ToolMetrics != nil {
+		t.Error("Expected nil ToolMetrics by default")
+	}
+
+	metrics := NewToolMetrics()
+	options := NewOptions(WithToolMetrics(metrics))
+	if options.ToolMetrics != metrics {
+		t.Error("Expected ToolMetrics to be the provided collector")
+	}
+}
+
+// TestWithResponseCollector tests the response collector option
+func TestWithResponseCollector(t *testing.T) {
+	if NewOptions().ResponseCollector != nil {
+		t.Error("Expected nil ResponseCollector by default")
+	}
+
+	collector := NewResponseCollector()
+	options := NewOptions(WithResponseCollector(collector))
+	if options.ResponseCollector != collector {
+		t.Error("Expected ResponseCollector to be the provided collector")
+	}
+}
+
+// TestWithToolResultPostProcessor tests the post-processor option is stored on Options
+func TestWithToolResultPostProcessor(t *testing.T) {
+	if NewOptions().ToolResultPostProcessor != nil {
+		t.Error("Expected nil ToolResultPostProcessor by default")
+	}
+
+	options := NewOptions(WithToolResultPostProcessor(func(toolName string, content any) any {
+		return toolName + ":" + content.(string)
+	}))
+	if options.ToolResultPostProcessor == nil {
+		t.Fatal("Expected ToolResultPostProcessor to be set")
+	}
+	if got := options.ToolResultPostProcessor("Read", "data"); got != "Read:data" {
+		t.Errorf("Expected processor to be invoked, got %v", got)
+	}
+}
+
+// TestWithToolResultDeduplication tests the deduplication option is stored on Options
+func TestWithToolResultDeduplication(t *testing.T) {
+	if NewOptions().ToolResultDeduplication {
+		t.Error("Expected deduplication disabled by default")
+	}
+	if !NewOptions(WithToolResultDeduplication()).ToolResultDeduplication {
+		t.Error("Expected deduplication enabled")
+	}
+}
+
+// TestWithToolResultMaxItems tests the item limit is stored on Options
+func TestWithToolResultMaxItems(t *testing.T) {
+	if got := NewOptions().ToolResultMaxItems; got != 0 {
+		t.Errorf("Expected no item limit by default, got %d", got)
+	}
+	if got := NewOptions(WithToolResultMaxItems(5)).ToolResultMaxItems; got != 5 {
+		t.Errorf("Expected ToolResultMaxItems 5, got %d", got)
+	}
+}
+
+// TestWithDebugRedaction tests debug redaction options accumulate patterns
+func TestWithDebugRedaction(t *testing.T) {
+	options := NewOptions()
+	if options.RedactDebugOutput {
+		t.Error("Expected redaction disabled by default")
+	}
+
+	options = NewOptions(WithDebugRedaction())
+	if !options.RedactDebugOutput || len(options.DebugRedactionPatterns) != 0 {
+		t.Errorf("Expected default-only redaction, got %v %v", options.RedactDebugOutput, options.DebugRedactionPatterns)
+	}
+
+	options = NewOptions(WithDebugRedaction(`corp-\d+`), WithDebugRedaction(`tenant-\w+`))
+	if len(options.DebugRedactionPatterns) != 2 {
+		t.Errorf("Expected 2 custom patterns, got %v", options.DebugRedactionPatterns)
+	}
+	assertNoError(t, options.Validate())
+}
+
+// TestWithToolAllowlistPerAgent tests enforcement is enabled and validated
+func TestWithToolAllowlistPerAgent(t *testing.T) {
+	if NewOptions().EnforceAgentToolAllowlist {
+		t.Error("Expected allowlist enforcement disabled by default")
+	}
+
+	options := NewOptions(
+		WithAgent("reviewer", AgentDefinition{Description: "Reviews", Prompt: "Review", Tools: []string{"Read"}}),
+		WithToolAllowlistPerAgent(),
+	)
+	if !options.EnforceAgentToolAllowlist {
+		t.Error("Expected allowlist enforcement enabled")
+	}
+	assertNoError(t, options.Validate())
+
+	if !options.Agents["reviewer"].AllowsTool("Read") || options.Agents["reviewer"].AllowsTool("Write") {
+		t.Error("Expected reviewer to allow only Read")
+	}
+
+	invalid := []struct {
+		name   string
+		agents map[string]AgentDefinition
+	}{
+		{"no_agents", nil},
+		{"no_tool_lists", map[string]AgentDefinition{"general": {Description: "Any", Prompt: "Help"}}},
+		{"empty_tool_name", map[string]AgentDefinition{"reviewer": {Description: "R", Prompt: "R", Tools: []string{"Read", " "}}}},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			options := NewOptions(WithAgents(test.agents), WithToolAllowlistPerAgent())
+			if err := options.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+// TestWithToolNameNormalization tests the tool name normalization option
+func TestWithToolNameNormalization(t *testing.T) {
+	if NewOptions().ToolNameNormalization {
+		t.Error("Expected tool name normalization disabled by default")
+	}
+	if !NewOptions(WithToolNameNormalization()).ToolNameNormalization {
+		t.Error("Expected tool name normalization enabled")
+	}
+}
+
+// TestWithJSONSchemaStrict tests the schema is closed and strict validation enabled
+func TestWithJSONSchemaStrict(t *testing.T) {
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"name": map[string]any{"type": "string"}},
+	}
+
+	options := NewOptions(WithJSONSchemaStrict(schema))
+	if !options.StrictStructuredOutput {
+		t.Error("Expected StrictStructuredOutput to be enabled")
+	}
+	if options.OutputFormat == nil || options.OutputFormat.Type != "json_schema" {
+		t.Fatalf("Expected json_schema output format, got %+v", options.OutputFormat)
+	}
+	if got := options.OutputFormat.Schema["additionalProperties"]; got != false {
+		t.Errorf("Expected additionalProperties false, got %v", got)
+	}
+	if _, ok := schema["additionalProperties"]; ok {
+		t.Error("Expected caller's schema to be left unmodified")
+	}
+
+	options = NewOptions(WithJSONSchemaStrict(schema), WithJSONSchemaStrict(nil))
+	if options.OutputFormat != nil || options.StrictStructuredOutput {
+		t.Error("Expected nil schema to clear strict output format")
+	}
+}
+
+// TestWithResponseSchemaFromType tests the output format is generated from a Go struct
+func TestWithResponseSchemaFromType(t *testing.T) {
+	type Contact struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+		Phone string `json:"phone,omitempty"`
+	}
+
+	options := NewOptions(WithResponseSchemaFromType(Contact{}))
+	assertOutputFormatType(t, options, "json_schema")
+	expected := JSONSchemaFromType(Contact{})
+	if !reflect.DeepEqual(options.OutputFormat.Schema, expected) {
+		t.Errorf("Expected schema %v, got %v", expected, options.OutputFormat.Schema)
+	}
+
+	options = NewOptions(WithResponseSchemaFromType(Contact{}), WithResponseSchemaFromType(nil))
+	assertOutputFormatNil(t, options)
+}
+
+// TestThinkingBudgetOptions tests the thinking budget alias, toggle, and validation bounds
+func TestThinkingBudgetOptions(t *testing.T) {
+	t.Run("alias", func(t *testing.T) {
+		assertOptionsMaxThinkingTokens(t, NewOptions(WithThinkingBudget(20000)), 20000)
+	})
+
+	t.Run("extended_thinking_toggle", func(t *testing.T) {
+		assertOptionsMaxThinkingTokens(t, NewOptions(WithExtendedThinking(false)), 0)
+		assertOptionsMaxThinkingTokens(t, NewOptions(WithThinkingBudget(500), WithExtendedThinking(true)), DefaultMaxThinkingTokens)
+	})
+
+	bounds := []struct {
+		name    string
+		tokens  int
+		wantErr bool
+	}{
+		{"zero", 0, false},
+		{"limit", MaxThinkingTokensLimit, false},
+		{"negative", -1, true},
+		{"above_limit", MaxThinkingTokensLimit + 1, true},
+	}
+	for _, test := range bounds {
+		t.Run("bounds_"+test.name, func(t *testing.T) {
+			err := NewOptions(WithThinkingBudget(test.tokens)).Validate()
+			if !test.wantErr {
+				assertNoError(t, err)
+				return
+			}
+			validationErr := AsValidationError(err)
+			if validationErr == nil {
+				t.Fatalf("Expected ValidationError, got %v", err)
+			}
+			if validationErr.Field != "MaxThinkingTokens" || validationErr.Value != test.tokens {
+				t.Errorf("Expected MaxThinkingTokens=%d, got %s=%v", test.tokens, validationErr.Field, validationErr.Value)
+			}
+		})
+	}
+
+	t.Run("rejected_on_connect_and_query", func(t *testing.T) {
+		ctx, cancel := setupClientTestContext(t, 5*time.Second)
+		defer cancel()
+
+		client := NewClientWithTransport(newClientMockTransport(), WithThinkingBudget(MaxThinkingTokensLimit*2))
+		if err := client.Connect(ctx); !IsValidationError(err) {
+			t.Errorf("Expected ValidationError from Connect, got %v", err)
+		}
+
+		_, err := QueryWithTransport(ctx, "hi", newQueryMockTransport(), WithThinkingBudget(-5))
+		if !IsValidationError(err) {
+			t.Errorf("Expected ValidationError from Query, got %v", err)
+		}
+	})
+}
+
+// TestWithCleanEnv tests clean environment mode composes with explicit env vars
+func TestWithCleanEnv(t *testing.T) {
+	if NewOptions().CleanEnv {
+		t.Error("Expected host environment to be inherited by default")
+	}
+
+	options := NewOptions(WithCleanEnv(), WithEnvVar("ANTHROPIC_API_KEY", "key"))
+	if !options.CleanEnv {
+		t.Error("Expected CleanEnv to be enabled")
+	}
+	if options.ExtraEnv["ANTHROPIC_API_KEY"] != "key" {
+		t.Errorf("Expected explicit env var to be kept, got %v", options.ExtraEnv)
+	}
+}
+
+// TestWithPromptCaching tests the prompt caching option is stored on Options
+func TestWithPromptCaching(t *testing.T) {
+	if NewOptions().PromptCaching != nil {
+		t.Error("Expected nil PromptCaching by default")
+	}
+
+	for _, enabled := range []bool{true, false} {
+		options := NewOptions(WithPromptCaching(enabled))
+		if options.PromptCaching == nil || *options.PromptCaching != enabled {
+			t.Errorf("Expected PromptCaching %v, got %v", enabled, options.PromptCaching)
+		}
+	}
+}
+
+// TestWithMcpServerStartupTimeout tests the MCP server startup timeout option
+func TestWithMcpServerStartupTimeout(t *testing.T) {
+	if NewOptions().McpServerStartupTimeout != 0 {
+		t.Error("Expected no MCP startup timeout by default")
+	}
+
+	options := NewOptions(WithMcpServerStartupTimeout(20 * time.Second))
+	if options.McpServerStartupTimeout != 20*time.Second {
+		t.Errorf("Expected McpServerStartupTimeout 20s, got %v", options.McpServerStartupTimeout)
+	}
+}
+
+// TestWithStrictContentTypes tests the strict content type option
+func TestWithStrictContentTypes(t *testing.T) {
+	if NewOptions().StrictContentTypes {
+		t.Error("Expected lenient content types by default")
+	}
+	if !NewOptions(WithStrictContentTypes()).StrictContentTypes {
+		t.Error("Expected StrictContentTypes to be set")
+	}
+}
+
+// TestWithGracefulInterruptOnCancel tests the graceful cancellation option
+func TestWithGracefulInterruptOnCancel(t *testing.T) {
+	if NewOptions().GracefulInterruptGrace != 0 {
+		t.Error("Expected immediate kill on cancel by default")
+	}
+
+	options := NewOptions(WithGracefulInterruptOnCancel(3 * time.Second))
+	if options.GracefulInterruptGrace != 3*time.Second {
+		t.Errorf("Expected GracefulInterruptGrace 3s, got %v", options.GracefulInterruptGrace)
+	}
+}
+
+// TestWithMaxSessionDuration tests the session duration cap option
+func TestWithMaxSessionDuration(t *testing.T) {
+	if NewOptions().MaxSessionDuration != 0 {
+		t.Error("Expected no session duration cap by default")
+	}
+
+	options := NewOptions(WithMaxSessionDuration(30 * time.Minute))
+	if options.MaxSessionDuration != 30*time.Minute {
+		t.Errorf("Expected MaxSessionDuration 30m, got %v", options.MaxSessionDuration)
+	}
+}
+
+// TestWithMaxIdleTime tests the idle disconnect option
+func TestWithMaxIdleTime(t *testing.T) {
+	if NewOptions().MaxIdleTime != 0 {
+		t.Error("Expected no idle limit by default")
+	}
+
+	options := NewOptions(WithMaxIdleTime(10 * time.Minute))
+	if options.MaxIdleTime != 10*time.Minute {
+		t.Errorf("Expected MaxIdleTime 10m, got %v", options.MaxIdleTime)
+	}
+}
+
+// TestWithWarmup tests the connect warmup option
+func TestWithWarmup(t *testing.T) {
+	if NewOptions().Warmup {
+		t.Error("Expected warmup disabled by default")
+	}
+	if !NewOptions(WithWarmup()).Warmup {
+		t.Error("Expected warmup enabled")
+	}
+}
+
+// TestWithInputValidation tests prompt bounds are stored on Options
+func TestWithInputValidation(t *testing.T) {
+	if NewOptions().InputValidation {
+		t.Error("Expected input validation disabled by default")
+	}
+	options := NewOptions(WithInputValidation(1, 1000))
+	if !options.InputValidation || options.PromptMinLength != 1 || options.PromptMaxLength != 1000 {
+		t.Errorf("Expected validation of 1 to 1000 bytes, got %v %d %d",
+			options.InputValidation, options.PromptMinLength, options.PromptMaxLength)
+	}
+}
+
+// TestWithProcessGroupKill tests the process group kill option is stored on Options
+func TestWithProcessGroupKill(t *testing.T) {
+	if NewOptions().ProcessGroupKill {
+		t.Error("Expected process group kill disabled by default")
+	}
+	if !NewOptions(WithProcessGroupKill()).ProcessGroupKill {
+		t.Error("Expected process group kill enabled")
+	}
+}
+
+// TestWithOverloadBackoff tests the overload backoff delays are stored on Options
+func TestWithOverloadBackoff(t *testing.T) {
+	if options := NewOptions(); options.OverloadBackoffBase != 0 || options.OverloadBackoffMax != 0 {
+		t.Error("Expected overload retries disabled by default")
+	}
+	options := NewOptions(WithOverloadBackoff(time.Second, time.Minute))
+	if options.OverloadBackoffBase != time.Second || options.OverloadBackoffMax != time.Minute {
+		t.Errorf("Expected backoff 1s up to 1m, got %v up to %v", options.OverloadBackoffBase, options.OverloadBackoffMax)
+	}
+}
+
+// TestWithCLIArgsOverride tests the command line override option
+func TestWithCLIArgsOverride(t *testing.T) {
+	if NewOptions().CLIArgsOverride != nil {
+		t.Error("Expected no args override by default")
+	}
+
+	options := NewOptions(WithCLIArgsOverride(func(args []string) []string {
+		return append(args, "--new-flag")
+	}))
+	if options.CLIArgsOverride == nil {
+		t.Fatal("Expected CLIArgsOverride to be set")
+	}
+	if got := options.CLIArgsOverride([]string{"--verbose"}); !reflect.DeepEqual(got, []string{"--verbose", "--new-flag"}) {
+		t.Errorf("Unexpected override result: %v", got)
+	}
+}
+
+// TestWithPartialResultsOnCancel tests the partial results option
+func TestWithPartialResultsOnCancel(t *testing.T) {
+	if NewOptions().PartialResultsOnCancel {
+		t.Error("Expected partial results to be disabled by default")
+	}
+	if !NewOptions(WithPartialResultsOnCancel()).PartialResultsOnCancel {
+		t.Error("Expected PartialResultsOnCancel to be enabled")
+	}
+}
+
+// TestWithMaxOutputBytes tests the CLI output cap option
+func TestWithMaxOutputBytes(t *testing.T) {
+	if NewOptions().MaxOutputBytes != 0 {
+		t.Error("Expected no output cap by default")
+	}
+
+	options := NewOptions(WithMaxOutputBytes(10 << 20))
+	if options.MaxOutputBytes != 10<<20 {
+		t.Errorf("Expected MaxOutputBytes 10MiB, got %d", options.MaxOutputBytes)
+	}
+}
+
+// TestWithTranscriptWriter tests the transcript writer option
+func TestWithTranscriptWriter(t *testing.T) {
+	if NewOptions().TranscriptWriter != nil {
+		t.Error("Expected no transcript writer by default")
+	}
+
+	var buf bytes.Buffer
+	options := NewOptions(WithTranscriptWriter(&buf))
+	if options.TranscriptWriter != &buf {
+		t.Errorf("Expected TranscriptWriter to be set, got %v", options.TranscriptWriter)
+	}
+}
+
+// TestWithRawStdoutTee tests the raw stdout tee option
+func TestWithRawStdoutTee(t *testing.T) {
+	if NewOptions().RawStdoutTee != nil {
+		t.Error("Expected no raw stdout tee by default")
+	}
+
+	var buf bytes.Buffer
+	options := NewOptions(WithRawStdoutTee(&buf))
+	if options.RawStdoutTee != &buf {
+		t.Errorf("Expected RawStdoutTee to be set, got %v", options.RawStdoutTee)
+	}
+}
+
+// TestWithLargePromptHandling tests the large prompt threshold and strategy option
+func TestWithLargePromptHandling(t *testing.T) {
+	defaults := NewOptions()
+	if defaults.LargePromptThreshold != 0 || defaults.LargePromptStrategy != "" {
+		t.Errorf("Expected large prompt handling disabled by default, got %d/%q",
+			defaults.LargePromptThreshold, defaults.LargePromptStrategy)
+	}
+
+	options := NewOptions(WithLargePromptHandling(4096, LargePromptStrategyTruncate))
+	if options.LargePromptThreshold != 4096 {
+		t.Errorf("Expected LargePromptThreshold 4096, got %d", options.LargePromptThreshold)
+	}
+	if options.LargePromptStrategy != LargePromptStrategyTruncate {
+		t.Errorf("Expected LargePromptStrategy truncate, got %q", options.LargePromptStrategy)
+	}
+}
+
+// TestWithContextFiles tests context file paths accumulate and the budget is set
+func TestWithContextFiles(t *testing.T) {
+	defaults := NewOptions()
+	if len(defaults.ContextFiles) != 0 || defaults.ContextFilesMaxBytes != 0 {
+		t.Errorf("Expected no context files by default, got %v/%d",
+			defaults.ContextFiles, defaults.ContextFilesMaxBytes)
+	}
+
+	options := NewOptions(WithContextFiles("go.mod", "main.go"), WithContextFiles("README.md"),
+		WithContextFilesBudget(4096))
+	if !reflect.DeepEqual(options.ContextFiles, []string{"go.mod", "main.go", "README.md"}) {
+		t.Errorf("Expected context files to accumulate, got %v", options.ContextFiles)
+	}
+	if options.ContextFilesMaxBytes != 4096 {
+		t.Errorf("Expected ContextFilesMaxBytes 4096, got %d", options.ContextFilesMaxBytes)
+	}
+}
+
+// TestWithContextManifest tests manifest paths accumulate across calls
+func TestWithContextManifest(t *testing.T) {
+	if len(NewOptions().ContextManifest) != 0 {
+		t.Error("Expected no context manifest by default")
+	}
+
+	options := NewOptions(WithContextManifest("docs/design.md", "go.mod"), WithContextManifest("README.md"))
+	if !reflect.DeepEqual(options.ContextManifest, []string{"docs/design.md", "go.mod", "README.md"}) {
+		t.Errorf("Expected context manifest to accumulate, got %v", options.ContextManifest)
+	}
+}
+
+// TestWithDisconnectCallback tests the disconnect callback option
+func TestWithDisconnectCallback(t *testing.T) {
+	if NewOptions().OnDisconnect != nil {
+		t.Error("Expected no disconnect callback by default")
+	}
+
+	var got error
+	options := NewOptions(WithDisconnectCallback(func(reason error) { got = reason }))
+	if options.OnDisconnect == nil {
+		t.Fatal("Expected OnDisconnect to be set")
+	}
+	options.OnDisconnect(ErrUnexpectedEOF)
+	if got != ErrUnexpectedEOF {
+		t.Errorf("Expected callback to receive the reason, got %v", got)
+	}
+}
+
+// TestWithTracer tests the tracer option
+func TestWithTracer(t *testing.T) {
+	if NewOptions().Tracer != nil {
+		t.Error("Expected no tracer by default")
+	}
+
+	tracer := &noopTracer{}
+	options := NewOptions(WithTracer(tracer))
+	if options.Tracer != tracer {
+		t.Errorf("Expected Tracer to be set, got %v", options.Tracer)
+	}
+}
+
+// noopTracer is a Tracer whose spans do nothing
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, _ string, _ map[string]any) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// noopSpan is a Span that does nothing
+type noopSpan struct{}
+
+func (noopSpan) End(error) {}
+
+// TestWithOnPlanProposal tests the plan proposal callback option
+func TestWithOnPlanProposal(t *testing.T) {
+	if NewOptions().OnPlanProposal != nil {
+		t.Error("Expected no plan proposal callback by default")
+	}
+
+	var got string
+	options := NewOptions(WithOnPlanProposal(func(p *PlanProposal) bool {
+		got = p.Plan
+		return true
+	}))
+	if options.OnPlanProposal == nil {
+		t.Fatal("Expected OnPlanProposal to be set")
+	}
+	if !options.OnPlanProposal(&PlanProposal{Plan: "refactor"}) || got != "refactor" {
+		t.Errorf("Expected callback to receive the plan and approve, got %q", got)
+	}
+}
+
+// TestWithEditConfirmation tests the edit confirmation option
+func TestWithEditConfirmation(t *testing.T) {
+	if NewOptions().EditConfirmation != nil {
+		t.Error("Expected no edit confirmation by default")
+	}
+
+	var gotPath string
+	options := NewOptions(WithEditConfirmation(func(path, _ string) bool {
+		gotPath = path
+		return false
+	}))
+	if options.EditConfirmation == nil {
+		t.Fatal("Expected EditConfirmation to be set")
+	}
+	if options.EditConfirmation("main.go", "") || gotPath != "main.go" {
+		t.Errorf("Expected callback to receive the path and reject, got %q", gotPath)
+	}
+}
+
+// TestWithClock tests the clock option
+func TestWithClock(t *testing.T) {
+	if NewOptions().Clock != nil {
+		t.Error("Expected no clock by default")
+	}
+
+	clock := SystemClock()
+	options := NewOptions(WithClock(clock))
+	if options.Clock != clock {
+		t.Errorf("Expected Clock to be set, got %v", options.Clock)
+	}
+}
+
+// TestWithOnThinking tests the thinking callback option
+func TestWithOnThinking(t *testing.T) {
+	if NewOptions().OnThinking != nil {
+		t.Error("Expected no thinking callback by default")
+	}
+
+	var got string
+	options := NewOptions(WithOnThinking(func(block *ThinkingBlock) { got = block.Thinking }))
+	if options.OnThinking == nil {
+		t.Fatal("Expected OnThinking to be set")
+	}
+	options.OnThinking(&ThinkingBlock{Thinking: "plan"})
+	if got != "plan" {
+		t.Errorf("Expected callback to receive the block, got %q", got)
+	}
+}
+
+// TestWithOnToolResult tests the tool result callback option
+func TestWithOnToolResult(t *testing.T) {
+	if NewOptions().OnToolResult != nil {
+		t.Error("Expected no tool result callback by default")
+	}
+
+	var got string
+	options := NewOptions(WithOnToolResult(func(block *ToolResultBlock) { got = block.ToolUseID }))
+	if options.OnToolResult == nil {
+		t.Fatal("Expected OnToolResult to be set")
+	}
+	options.OnToolResult(&ToolResultBlock{ToolUseID: "toolu_1"})
+	if got != "toolu_1" {
+		t.Errorf("Expected callback to receive the block, got %q", got)
+	}
+}
+
+// TestWithOnResultError tests the error result callback option
+func TestWithOnResultError(t *testing.T) {
+	if NewOptions().OnResultError != nil {
+		t.Error("Expected no result error callback by default")
+	}
+
+	var got ResultErrorType
+	options := NewOptions(WithOnResultError(func(result *ResultMessage) { got = result.ErrorType }))
+	if options.OnResultError == nil {
+		t.Fatal("Expected OnResultError to be set")
+	}
+	options.OnResultError(&ResultMessage{IsError: true, ErrorType: ResultErrorMaxTurns})
+	if got != ResultErrorMaxTurns {
+		t.Errorf("Expected callback to receive the result, got %q", got)
+	}
+}
+
+// TestWithPromptSuffix tests the prompt suffix option
+func TestWithPromptSuffix(t *testing.T) {
+	if NewOptions().PromptSuffix != "" {
+		t.Error("Expected no prompt suffix by default")
+	}
+	if got := NewOptions(WithPromptSuffix("Always respond in Markdown.")).PromptSuffix; got != "Always respond in Markdown." {
+		t.Errorf("Expected prompt suffix to be set, got %q", got)
+	}
+}
+
+// TestWithTurnCallback tests the turn start and end callback option
+func TestWithTurnCallback(t *testing.T) {
+	if options := NewOptions(); options.OnTurnStart != nil || options.OnTurnEnd != nil {
+		t.Error("Expected no turn callbacks by default")
+	}
+
+	var started string
+	var ended *ResultMessage
+	options := NewOptions(WithTurnCallback(
+		func(prompt string) { started = prompt },
+		func(result *ResultMessage) { ended = result },
+	))
+	if options.OnTurnStart == nil || options.OnTurnEnd == nil {
+		t.Fatal("Expected OnTurnStart and OnTurnEnd to be set")
+	}
+	result := &ResultMessage{Subtype: "success"}
+	options.OnTurnStart("hello")
+	options.OnTurnEnd(result)
+	if started != "hello" || ended != result {
+		t.Errorf("Expected callbacks to receive the prompt and result, got %q and %v", started, ended)
+	}
+
+	if options := NewOptions(WithTurnCallback(nil, func(*ResultMessage) {})); options.OnTurnStart != nil || options.OnTurnEnd == nil {
+		t.Error("Expected a nil callback to leave its field unset")
+	}
+}
+
+// TestWithOnToolsChanged tests the tool list callback option
+func TestWithOnToolsChanged(t *testing.T) {
+	if NewOptions().OnToolsChanged != nil {
+		t.Error("Expected no tools changed callback by default")
+	}
+
+	var got []ToolInfo
+	options := NewOptions(WithOnToolsChanged(func(tools []ToolInfo) { got = tools }))
+	if options.OnToolsChanged == nil {
+		t.Fatal("Expected OnToolsChanged to be set")
+	}
+	options.OnToolsChanged([]ToolInfo{{Name: "mcp__docs__search", McpServer: "docs"}})
+	if len(got) != 1 || got[0].McpServer != "docs" {
+		t.Errorf("Expected callback to receive the tool list, got %+v", got)
+	}
+}
+
+// TestWithOnResourceUpdate tests the MCP resource update callback option
+func TestWithOnResourceUpdate(t *testing.T) {
+	if NewOptions().OnResourceUpdate != nil {
+		t.Error("Expected no resource update callback by default")
+	}
+
+	var got string
+	options := NewOptions(WithOnResourceUpdate(func(update ResourceUpdate) { got = update.URI }))
+	if options.OnResourceUpdate == nil {
+		t.Fatal("Expected OnResourceUpdate to be set")
+	}
+	options.OnResourceUpdate(ResourceUpdate{URI: "file:///notes.md"})
+	if got != "file:///notes.md" {
+		t.Errorf("Expected callback to receive the update, got %q", got)
+	}
+}
+
+// TestWithOnStreamEvent tests the decoded stream event callback option
+func TestWithOnStreamEvent(t *testing.T) {
+	if NewOptions().OnStreamEvent != nil {
+		t.Error("Expected no stream event callback by default")
+	}
+
+	var got string
+	options := NewOptions(WithOnStreamEvent(func(event ParsedStreamEvent) { got = event.Type }))
+	if options.OnStreamEvent == nil {
+		t.Fatal("Expected OnStreamEvent to be set")
+	}
+	options.OnStreamEvent(ParseStreamEvent(&StreamEvent{Event: map[string]any{"type": "message_stop"}}))
+	if got != "message_stop" {
+		t.Errorf("Expected callback to receive the event, got %q", got)
+	}
+}
+
+// TestWithResourceLimits tests the subprocess resource limits option
+func TestWithResourceLimits(t *testing.T) {
+	if NewOptions().ResourceLimits != nil {
+		t.Error("Expected no resource limits by default")
+	}
+
+	want := ResourceLimits{MaxMemoryBytes: 4 << 30, MaxCPUSeconds: 120}
+	options := NewOptions(WithResourceLimits(want))
+	if options.ResourceLimits == nil || *options.ResourceLimits != want {
+		t.Errorf("Expected ResourceLimits %+v, got %+v", want, options.ResourceLimits)
+	}
+}
+
+// TestWithCmdCustomizer tests the command customizer option is stored on Options
+func TestWithCmdCustomizer(t *testing.T) {
+	if NewOptions().CmdCustomizer != nil {
+		t.Error("Expected no cmd customizer by default")
+	}
+
+	options := NewOptions(WithCmdCustomizer(func(cmd *exec.Cmd) { cmd.Dir = "/work" }))
+	if options.CmdCustomizer == nil {
+		t.Fatal("Expected CmdCustomizer to be set")
+	}
+	cmd := &exec.Cmd{}
+	options.CmdCustomizer(cmd)
+	if cmd.Dir != "/work" {
+		t.Errorf("Expected customizer to be invoked, got Dir %q", cmd.Dir)
+	}
+}
+
+// TestWithSubprocessLimiter tests the shared subprocess limiter option
+func TestWithSubprocessLimiter(t *testing.T) {
+	if NewOptions().SubprocessLimiter != nil {
+		t.Error("Expected no subprocess limiter by default")
+	}
+
+	limiter := NewSubprocessLimiter(3)
+	first := NewOptions(WithSubprocessLimiter(limiter))
+	second := NewOptions(WithSubprocessLimiter(limiter))
+	if first.SubprocessLimiter != limiter || second.SubprocessLimiter != limiter {
+		t.Error("Expected both options to share the limiter")
+	}
+}
+
+// TestWithSessionStore tests the session store option
+func TestWithSessionStore(t *testing.T) {
+	options := NewOptions()
+	if options.SessionStore != nil || options.SessionStoreKey != "" {
+		t.Error("Expected no session store by default")
+	}
+
+	store := newMemorySessionStore()
+	options = NewOptions(WithSessionStore(store, "user-1"))
+	if options.SessionStore != store || options.SessionStoreKey != "user-1" {
+		t.Errorf("Expected store and key to be set, got %v and %q", options.SessionStore, options.SessionStoreKey)
+	}
+}
+
+// TestWithSdkMcpTrace tests the SDK MCP trace option
+func TestWithSdkMcpTrace(t *testing.T) {
+	if NewOptions().SdkMcpTrace != nil {
+		t.Error("Expected no SDK MCP trace by default")
+	}
+
+	var got string
+	options := NewOptions(WithSdkMcpTrace(func(method string, params json.RawMessage) {
+		got = method + " " + string(params)
+	}))
+	if options.SdkMcpTrace == nil {
+		t.Fatal("Expected SdkMcpTrace to be set")
+	}
+	options.SdkMcpTrace("tools/call", json.RawMessage(`{"name":"add"}`))
+	if got != `tools/call {"name":"add"}` {
+		t.Errorf("Expected callback to receive the request, got %q", got)
+	}
+}
+
+// TestWithRateLimiter tests the query rate limiting option
+func TestWithRateLimiter(t *testing.T) {
+	options := NewOptions()
+	if options.QueryRateLimit != 0 || options.QueryRateBurst != 0 {
+		t.Error("Expected no query rate limit by default")
+	}
+
+	options = NewOptions(WithRateLimiter(0.5, 3))
+	if options.QueryRateLimit != 0.5 || options.QueryRateBurst != 3 {
+		t.Errorf("Expected rate 0.5 and burst 3, got %v and %d", options.QueryRateLimit, options.QueryRateBurst)
+	}
+
+	// Out-of-range arguments are clamped rather than failing validation
+	options = NewOptions(WithRateLimiter(-1, -2))
+	if options.QueryRateLimit != 0 || options.QueryRateBurst != 1 {
+		t.Errorf("Expected rate 0 and burst 1, got %v and %d", options.QueryRateLimit, options.QueryRateBurst)
+	}
+	if err := options.Validate(); err != nil {
+		t.Errorf("Expected clamped options to validate, got %v", err)
+	}
+}
+
+// TestWithToolConfirmationChannel tests approving and denying tool use over a channel
+func TestWithToolConfirmationChannel(t *testing.T) {
+	ask := func(ctx context.Context, options *Options, toolName string) (PermissionResult, error) {
+		result, err := options.CanUseTool(ctx, toolName, map[string]any{"command": "ls"},
+			ToolPermissionContext{AgentID: "reviewer"})
+		pr, _ := result.(PermissionResult)
+		return pr, err
+	}
+
+	t.Run("approval_and_denial", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		confirmations := make(chan ToolConfirmation)
+		options := NewOptions(WithToolConfirmationChannel(confirmations))
+		if options.CanUseTool == nil {
+			t.Fatal("Expected CanUseTool to be set")
+		}
+
+		var seen []ToolConfirmation
+		go func() {
+			for req := range confirmations {
+				seen = append(seen, req)
+				switch req.ToolName {
+				case "Read":
+					req.Approve()
+				case "Bash":
+					req.Deny("rejected by user")
+				default:
+					req.Respond(nil)
+				}
+			}
+		}()
+
+		result, err := ask(ctx, options, "Read")
+		assertNoError(t, err)
+		if _, ok := result.(PermissionResultAllow); !ok {
+			t.Errorf("Expected allow for Read, got %T", result)
+		}
+
+		result, err = ask(ctx, options, "Bash")
+		assertNoError(t, err)
+		deny, ok := result.(PermissionResultDeny)
+		if !ok || deny.Message != "rejected by user" {
+			t.Errorf("Expected deny with user message for Bash, got %+v", result)
+		}
+
+		result, err = ask(ctx, options, "Write")
+		assertNoError(t, err)
+		if _, ok := result.(PermissionResultDeny); !ok {
+			t.Errorf("Expected deny for a nil decision, got %T", result)
+		}
+		close(confirmations)
+
+		if len(seen) != 3 || seen[1].Input["command"] != "ls" || seen[1].Context.AgentID != "reviewer" {
+			t.Errorf("Expected confirmations to carry tool input and context, got %+v", seen)
+		}
+	})
+
+	t.Run("context_ends_while_waiting", func(t *testing.T) {
+		confirmations := make(chan ToolConfirmation, 1)
+		options := NewOptions(WithToolConfirmationChannel(confirmations))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// Confirmation is received but never answered
+		_, err := ask(ctx, options, "Bash")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if req := <-confirmations; req.ToolName != "Bash" {
+			t.Errorf("Expected pending confirmation for Bash, got %q", req.ToolName)
+		}
+	})
+
+	t.Run("only_first_decision_used", func(t *testing.T) {
+		reply := make(chan PermissionResult, 1)
+		req := ToolConfirmation{ToolName: "Read", Reply: reply}
+		req.Approve()
+		req.Deny("too late")
+		if _, ok := (<-reply).(PermissionResultAllow); !ok {
+			t.Error("Expected the first decision to win")
+		}
+	})
+
+	t.Run("nil_channel_clears_callback", func(t *testing.T) {
+		options := NewOptions(WithToolConfirmationChannel(make(chan ToolConfirmation)), WithToolConfirmationChannel(nil))
+		if options.CanUseTool != nil {
+			t.Error("Expected nil channel to clear the permission callback")
+		}
+	})
+}
+
+// TestWithToolApprovalCache tests the option installs a cache that the
+// client can clear
+func TestWithToolApprovalCache(t *testing.T) {
+	options := NewOptions()
+	if options.ToolApprovalCache != nil {
+		t.Error("Expected no approval cache by default")
+	}
+
+	options = NewOptions(WithToolApprovalCache())
+	if options.ToolApprovalCache == nil {
+		t.Fatal("Expected WithToolApprovalCache to install a cache")
+	}
+
+	client := NewClient(WithToolApprovalCache())
+	cache := client.(*ClientImpl).options.ToolApprovalCache
+	cache.Store("Read", map[string]any{"file_path": "a.go"}, NewPermissionResultAllow())
+	client.ClearApprovalCache()
+	if cache.Len() != 0 {
+		t.Errorf("Expected ClearApprovalCache to empty the cache, got %d decisions", cache.Len())
+	}
+
+	// Clearing without a cache is a no-op
+	NewClient().ClearApprovalCache()
+}
@@ -0,0 +1,152 @@
+package claudecode
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// MaxOverloadRetries is the most times WithOverloadBackoff resends a prompt
+// whose turn ended in an overloaded error.
+const MaxOverloadRetries = 5
+
+// overloadRetrier holds back overloaded results and resends the prompt of
+// the turn they ended after a backoff instead.
+type overloadRetrier struct {
+	clock     Clock
+	base      time.Duration
+	max       time.Duration
+	transport Transport
+	stop      <-chan struct{} // Closed when the client disconnects
+
+	mu      sync.Mutex
+	pending []*pendingPrompt // Sent turns awaiting their result, in send order
+}
+
+// pendingPrompt is a sent turn awaiting its result.
+type pendingPrompt struct {
+	prompt   *StreamMessage // Resent if overloaded; nil for turns not retried
+	attempts int            // Retries of prompt so far
+}
+
+// newOverloadRetrier creates a retrier resending prompts through transport
+// until stop is closed.
+func newOverloadRetrier(options *Options, transport Transport, stop <-chan struct{}) *overloadRetrier {
+	return &overloadRetrier{
+		clock:     shared.ClockOrSystem(options.Clock),
+		base:      options.OverloadBackoffBase,
+		max:       options.OverloadBackoffMax,
+		transport: transport,
+		stop:      stop,
+	}
+}
+
+// hook returns the stream hook holding back overloaded results that are
+// retried. Messages arriving during the backoff wait until it ends.
+func (r *overloadRetrier) hook() streamHook {
+	return streamHook{
+		message: func(msg Message) (bool, error) {
+			result, isResult := msg.(*ResultMessage)
+			return !isResult || !r.retry(result), nil
+		},
+	}
+}
+
+// retry resends the prompt of the oldest pending turn after a backoff if
+// result ended that turn in an overloaded error with retries left, and
+// reports whether it did. The resent prompt is queued behind turns sent
+// since, as the CLI answers it after them.
+func (r *overloadRetrier) retry(result *ResultMessage) bool {
+	r.mu.Lock()
+	if len(r.pending) == 0 {
+		r.mu.Unlock()
+		return false
+	}
+	turn := r.pending[0]
+	r.pending = r.pending[1:]
+	r.mu.Unlock()
+	if turn.prompt == nil || !result.IsError ||
+		result.ErrorType != ResultErrorOverloaded || turn.attempts >= MaxOverloadRetries {
+		return false
+	}
+
+	timer := r.clock.NewTimer(equalJitter(r.backoff(turn.attempts)))
+	select {
+	case <-timer.C():
+	case <-r.stop:
+		timer.Stop()
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	retried := &pendingPrompt{prompt: turn.prompt, attempts: turn.attempts + 1}
+	r.push(retried)
+	if err := r.transport.SendMessage(ctx, *turn.prompt); err != nil {
+		// Deliver the overloaded result if the prompt cannot be resent
+		r.remove(retried)
+		return false
+	}
+	return true
+}
+
+// backoff returns the un-jittered delay before retry attempt (from zero):
+// base doubled attempt times, capped at max.
+func (r *overloadRetrier) backoff(attempt int) time.Duration {
+	d := r.base
+	for i := 0; i < attempt && d < r.max; i++ {
+		d *= 2
+	}
+	if d > r.max {
+		d = r.max
+	}
+	return d
+}
+
+// record queues a turn about to be sent until its result arrives, and
+// returns it for remove. Its prompt is resent if the turn is overloaded;
+// pass nil for turns that are not retried.
+func (r *overloadRetrier) record(prompt *StreamMessage) *pendingPrompt {
+	turn := &pendingPrompt{prompt: prompt}
+	r.push(turn)
+	return turn
+}
+
+// push queues turn behind the turns already pending.
+func (r *overloadRetrier) push(turn *pendingPrompt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, turn)
+}
+
+// remove drops turn from the queue after its prompt failed to send.
+func (r *overloadRetrier) remove(turn *pendingPrompt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, pending := range r.pending {
+		if pending == turn {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// equalJitter returns a random delay between half of d and d, so retries
+// from many clients spread out while still backing off.
+func equalJitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(d-half)+1)) // #nosec G404 - Jitter needs no cryptographic randomness
+}
@@ -0,0 +1,234 @@
+package claudecode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPoolClosed is returned by QueryPool.Query after the pool has been closed.
+var ErrPoolClosed = errors.New("query pool closed")
+
+// QueryPool keeps up to size connected CLI processes warm and reuses them for
+// one-shot queries, avoiding a subprocess start per query. The CLI
+// conversation is cleared before a process is reused, so no conversation
+// state carries over between uses.
+// QueryPool is safe for concurrent use.
+//
+// Example:
+//
+//	pool := claudecode.NewQueryPool(4, claudecode.WithModel("claude-sonnet-4-5"))
+//	defer pool.Close()
+//
+//	iterator, err := pool.Query(ctx, "Summarize this diff: ...")
+//	if err != nil {
+//	    return err
+//	}
+//	defer iterator.Close()
+//	for {
+//	    msg, err := iterator.Next(ctx)
+//	    if errors.Is(err, claudecode.ErrNoMoreMessages) {
+//	        break
+//	    }
+//	    ...
+//	}
+type QueryPool struct {
+	newClient func() Client
+	slots     chan struct{} // One token per process in use
+
+	// Processes are only started when none is idle, so
+	// in-use plus idle never exceeds the pool size
+	mu     sync.Mutex
+	idle   []Client
+	closed bool
+}
+
+// NewQueryPool creates a pool of at most size CLI processes configured with
+// opts. Processes are started on demand and kept running between queries
+// until Close. A size below 1 is treated as 1.
+func NewQueryPool(size int, opts ...Option) *QueryPool {
+	return newQueryPool(size, func() Client { return NewClient(opts...) })
+}
+
+// newQueryPool creates a pool using newClient to create its clients.
+func newQueryPool(size int, newClient func() Client) *QueryPool {
+	if size < 1 {
+		size = 1
+	}
+	return &QueryPool{
+		newClient: newClient,
+		slots:     make(chan struct{}, size),
+	}
+}
+
+// Query sends prompt to a pooled CLI process in a new session and returns an
+// iterator over the response. A reused process is first cleared with
+// Client.Reset, which sends the CLI's /clear command, so the previous
+// caller's conversation does not carry over. When all processes are busy,
+// Query waits for one to be released or for ctx to be done.
+//
+// The process returns to the pool once the iterator yields the ResultMessage.
+// Closing the iterator earlier, or an error during the turn, stops that
+// process instead, since its turn may still be running.
+func (p *QueryPool) Query(ctx context.Context, prompt string) (MessageIterator, error) {
+	client, reused, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A reused process still holds the previous caller's conversation
+	if reused {
+		if err := client.Reset(ctx); err != nil {
+			p.release(client, false)
+			return nil, fmt.Errorf("failed to reset pooled session: %w", err)
+		}
+	}
+	if err := client.Query(ctx, prompt); err != nil {
+		p.release(client, false)
+		return nil, err
+	}
+
+	iterator := client.ReceiveResponse(ctx)
+	if iterator == nil {
+		p.release(client, false)
+		return nil, fmt.Errorf("client not connected")
+	}
+	return &poolIterator{pool: p, client: client, inner: iterator}, nil
+}
+
+// Close stops all idle processes and prevents new queries. Processes still
+// in use are stopped when their iterators finish.
+func (p *QueryPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var errs []error
+	for _, client := range idle {
+		if err := client.Disconnect(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close pooled clients: %v", errs)
+	}
+	return nil
+}
+
+// acquire waits for a free slot and returns an idle client, or connects a
+// new one if none is idle. reused reports whether the client served an
+// earlier query.
+func (p *QueryPool) acquire(ctx context.Context) (client Client, reused bool, err error) {
+	if p.isClosed() {
+		return nil, false, ErrPoolClosed
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, false, ErrPoolClosed
+	}
+	if n := len(p.idle); n > 0 {
+		client := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return client, true, nil
+	}
+	p.mu.Unlock()
+
+	client = p.newClient()
+	if err := client.Connect(ctx); err != nil {
+		<-p.slots
+		return nil, false, err
+	}
+	return client, false, nil
+}
+
+// release returns a client to the idle list if reusable and the pool is
+// open, and disconnects it otherwise. Either way its slot is freed.
+func (p *QueryPool) release(client Client, reusable bool) {
+	p.mu.Lock()
+	if reusable && !p.closed {
+		p.idle = append(p.idle, client)
+		p.mu.Unlock()
+		<-p.slots
+		return
+	}
+	p.mu.Unlock()
+
+	_ = client.Disconnect()
+	<-p.slots
+}
+
+// isClosed reports whether Close has been called.
+func (p *QueryPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// poolIterator yields one turn from a pooled client and releases the client
+// when the turn ends.
+type poolIterator struct {
+	pool   *QueryPool
+	client Client
+	inner  MessageIterator
+
+	mu   sync.Mutex
+	done bool
+}
+
+func (pi *poolIterator) Next(ctx context.Context) (Message, error) {
+	pi.mu.Lock()
+	done := pi.done
+	pi.mu.Unlock()
+	if done {
+		return nil, ErrNoMoreMessages
+	}
+
+	// Not holding the mutex while waiting, so Close can interrupt Next
+	msg, err := pi.inner.Next(ctx)
+
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+	if err != nil {
+		// The turn did not complete, so the process state is unknown
+		pi.finish(false)
+		return nil, err
+	}
+	if _, ok := msg.(*ResultMessage); ok {
+		pi.finish(true)
+	}
+	return msg, nil
+}
+
+func (pi *poolIterator) Close() error {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+	pi.finish(false)
+	return nil
+}
+
+// finish ends the iterator and releases its client once.
+// Must be called with mutex already held.
+func (pi *poolIterator) finish(reusable bool) {
+	if pi.done {
+		return
+	}
+	pi.done = true
+	pi.pool.release(pi.client, reusable)
+}
@@ -0,0 +1,234 @@
+package claudecode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestQueryPoolReusesProcesses tests sequential queries share one pooled
+// process, each in a fresh session
+func TestQueryPoolReusesProcesses(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	pool, transports := newTestQueryPool(2)
+	defer func() { _ = pool.Close() }()
+
+	for i := 0; i < 3; i++ {
+		iterator, err := pool.Query(ctx, "ping")
+		assertNoError(t, err)
+		drainPoolIterator(ctx, t, iterator)
+	}
+
+	if got := transports.count(); got != 1 {
+		t.Fatalf("Expected 1 pooled process for sequential queries, got %d", got)
+	}
+
+	// The CLI conversation is cleared before each reuse of the process
+	transport := transports.get(0)
+	var contents, sessions []string
+	for i := 0; i < transport.getSentMessageCount(); i++ {
+		msg, _ := transport.getSentMessage(i)
+		content, _ := msg.Message.(map[string]interface{})["content"].(string)
+		contents = append(contents, content)
+		if content != clearCommand {
+			sessions = append(sessions, msg.SessionID)
+		}
+	}
+	want := []string{"ping", clearCommand, "ping", clearCommand, "ping"}
+	if strings.Join(contents, "|") != strings.Join(want, "|") {
+		t.Fatalf("Expected %q sent to the reused process, got %q", want, contents)
+	}
+	seen := make(map[string]bool)
+	for i, sessionID := range sessions {
+		if sessionID == "" || seen[sessionID] {
+			t.Errorf("Expected a fresh session for query %d, got %q", i, sessionID)
+		}
+		seen[sessionID] = true
+	}
+}
+
+// TestQueryPoolCapsProcesses tests the pool never starts more than size
+// processes and waits for one to be released
+func TestQueryPoolCapsProcesses(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	pool, transports := newTestQueryPool(2)
+	defer func() { _ = pool.Close() }()
+
+	first, err := pool.Query(ctx, "one")
+	assertNoError(t, err)
+	second, err := pool.Query(ctx, "two")
+	assertNoError(t, err)
+
+	// Both processes are busy, so a third query waits until ctx is done
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = pool.Query(waitCtx, "three")
+	waitCancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded while pool is full, got %v", err)
+	}
+
+	// Finishing a turn releases its process to the waiting query
+	done := make(chan error, 1)
+	go func() {
+		iterator, err := pool.Query(ctx, "three")
+		if err == nil {
+			drainPoolIterator(ctx, t, iterator)
+		}
+		done <- err
+	}()
+	drainPoolIterator(ctx, t, first)
+	select {
+	case err := <-done:
+		assertNoError(t, err)
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for released process")
+	}
+	drainPoolIterator(ctx, t, second)
+
+	if got := transports.count(); got != 2 {
+		t.Errorf("Expected 2 pooled processes, got %d", got)
+	}
+}
+
+// TestQueryPoolDiscardsUnfinishedTurns tests a process whose turn did not
+// complete is stopped rather than reused
+func TestQueryPoolDiscardsUnfinishedTurns(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	pool, transports := newTestQueryPool(1)
+	defer func() { _ = pool.Close() }()
+
+	iterator, err := pool.Query(ctx, "abandoned")
+	assertNoError(t, err)
+	if _, err := iterator.Next(ctx); err != nil {
+		t.Fatalf("Expected first message, got %v", err)
+	}
+	assertNoError(t, iterator.Close())
+	if _, err := iterator.Next(ctx); !errors.Is(err, ErrNoMoreMessages) {
+		t.Errorf("Expected ErrNoMoreMessages after Close, got %v", err)
+	}
+
+	iterator, err = pool.Query(ctx, "fresh")
+	assertNoError(t, err)
+	drainPoolIterator(ctx, t, iterator)
+
+	if got := transports.count(); got != 2 {
+		t.Fatalf("Expected a new process after an unfinished turn, got %d", got)
+	}
+	if !transports.get(0).isClosed() {
+		t.Error("Expected unfinished process to be closed")
+	}
+}
+
+// TestQueryPoolClose tests Close stops idle processes and rejects new queries
+func TestQueryPoolClose(t *testing.T) {
+	ctx, cancel := setupClientTestContext(t, 5*time.Second)
+	defer cancel()
+
+	pool, transports := newTestQueryPool(2)
+
+	iterator, err := pool.Query(ctx, "ping")
+	assertNoError(t, err)
+	drainPoolIterator(ctx, t, iterator)
+
+	assertNoError(t, pool.Close())
+	assertNoError(t, pool.Close())
+
+	if !transports.get(0).isClosed() {
+		t.Error("Expected idle process to be closed")
+	}
+	if _, err := pool.Query(ctx, "late"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+// poolMockTransport answers every prompt with an assistant and result
+// message, and the clear command with a result only
+type poolMockTransport struct {
+	*clientMockTransport
+}
+
+func (p *poolMockTransport) SendMessage(ctx context.Context, message StreamMessage) error {
+	if err := p.clientMockTransport.SendMessage(ctx, message); err != nil {
+		return err
+	}
+	if body, ok := message.Message.(map[string]interface{}); ok && body["content"] == clearCommand {
+		return nil
+	}
+	p.injectTestMessage(&AssistantMessage{
+		Content: []ContentBlock{&TextBlock{Text: "pong"}},
+		Model:   "claude-sonnet-4-5",
+	})
+	p.injectTestMessage(&ResultMessage{Subtype: "success", SessionID: message.SessionID, NumTurns: 1})
+	return nil
+}
+
+func (p *poolMockTransport) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// poolTransports records the transports created by a test pool
+type poolTransports struct {
+	mu   sync.Mutex
+	list []*poolMockTransport
+}
+
+func (pt *poolTransports) add() *poolMockTransport {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	transport := &poolMockTransport{newClientMockTransport()}
+	pt.list = append(pt.list, transport)
+	return transport
+}
+
+func (pt *poolTransports) count() int {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return len(pt.list)
+}
+
+func (pt *poolTransports) get(index int) *poolMockTransport {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return pt.list[index]
+}
+
+// newTestQueryPool creates a pool whose clients use poolMockTransports
+func newTestQueryPool(size int) (*QueryPool, *poolTransports) {
+	transports := &poolTransports{}
+	pool := newQueryPool(size, func() Client {
+		return NewClientWithTransport(transports.add())
+	})
+	return pool, transports
+}
+
+// drainPoolIterator reads a pooled response through its ResultMessage
+func drainPoolIterator(ctx context.Context, t *testing.T, iterator MessageIterator) {
+	t.Helper()
+	for {
+		msg, err := iterator.Next(ctx)
+		if errors.Is(err, ErrNoMoreMessages) {
+			return
+		}
+		if err != nil {
+			t.Errorf("Unexpected iterator error: %v", err)
+			return
+		}
+		if _, ok := msg.(*ResultMessage); ok {
+			if _, err := iterator.Next(ctx); !errors.Is(err, ErrNoMoreMessages) {
+				t.Errorf("Expected ErrNoMoreMessages after result, got %v", err)
+			}
+			return
+		}
+	}
+}
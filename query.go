@@ -4,28 +4,60 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"sync"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/cli"
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 	"github.com/severity1/claude-agent-sdk-go/internal/subprocess"
 )
 
 // ErrNoMoreMessages indicates the message iterator has no more messages.
+// Iterators return it (compare with errors.Is) when the stream completes normally.
 var ErrNoMoreMessages = errors.New("no more messages")
 
+// ErrUnexpectedEOF indicates the message stream ended mid-turn, before a
+// ResultMessage arrived, typically because the CLI process exited. It wraps
+// io.ErrUnexpectedEOF and is distinct from ErrNoMoreMessages.
+var ErrUnexpectedEOF = fmt.Errorf("message stream ended before a result message: %w", io.ErrUnexpectedEOF)
+
+// endOfStreamError returns the error for a closed message stream:
+// ErrUnexpectedEOF if the transport saw the stream end mid-turn,
+// ErrNoMoreMessages otherwise.
+func endOfStreamError(transport Transport) error {
+	if transport == nil {
+		return ErrNoMoreMessages
+	}
+	if validator := transport.GetValidator(); validator != nil && validator.EndedUnexpectedly() {
+		return ErrUnexpectedEOF
+	}
+	return ErrNoMoreMessages
+}
+
 // Query executes a one-shot query with automatic cleanup.
 // This follows the Python SDK pattern but uses dependency injection for transport.
 func Query(ctx context.Context, prompt string, opts ...Option) (MessageIterator, error) {
 	options := NewOptions(opts...)
+	if err := validatePrompt(options, prompt); err != nil {
+		return nil, err
+	}
+
+	prompt, promptFile, err := preparePrompt(options, prompt, true)
+	if err != nil {
+		return nil, err
+	}
 
 	// For one-shot queries, create a transport that passes prompt as CLI argument
 	// This matches the Python SDK behavior where prompt is passed via --print flag
 	transport, err := createQueryTransport(prompt, options)
 	if err != nil {
+		removePromptFile(promptFile)
 		return nil, fmt.Errorf("failed to create query transport: %w", err)
 	}
 
-	return queryWithTransportAndOptions(ctx, prompt, transport, options)
+	return queryWithTransportAndOptions(ctx, prompt, promptFile, transport, options)
 }
 
 // QueryWithTransport executes a query with a custom transport.
@@ -41,26 +73,145 @@ func QueryWithTransport(
 	}
 
 	options := NewOptions(opts...)
-	return queryWithTransportAndOptions(ctx, prompt, transport, options)
+	if err := validatePrompt(options, prompt); err != nil {
+		return nil, err
+	}
+	prompt, promptFile, err := preparePrompt(options, prompt, true)
+	if err != nil {
+		return nil, err
+	}
+	return queryWithTransportAndOptions(ctx, prompt, promptFile, transport, options)
+}
+
+// validatePrompt checks a prompt against the InputValidation bounds,
+// returning a *ValidationError if it is empty or out of bounds.
+func validatePrompt(options *Options, prompt string) error {
+	if options == nil || !options.InputValidation {
+		return nil
+	}
+	size := len(prompt)
+	switch {
+	case strings.TrimSpace(prompt) == "":
+		return NewValidationError("prompt", size, "prompt is empty")
+	case size < options.PromptMinLength:
+		return NewValidationError("prompt", size,
+			fmt.Sprintf("prompt is %d bytes, shorter than the minimum of %d", size, options.PromptMinLength))
+	case options.PromptMaxLength > 0 && size > options.PromptMaxLength:
+		return NewValidationError("prompt", size,
+			fmt.Sprintf("prompt is %d bytes, longer than the maximum of %d", size, options.PromptMaxLength))
+	}
+	return nil
+}
+
+// preparePrompt prepends the context files if withContextFiles is set and
+// appends the prompt suffix, then applies the request interceptor and large
+// prompt handling to a text prompt.
+// promptFile is the temporary file written by LargePromptStrategyFile, or ""
+// if none; the caller must remove it.
+func preparePrompt(options *Options, prompt string, withContextFiles bool) (result, promptFile string, err error) {
+	if withContextFiles {
+		if prompt, err = prependContextFiles(options, prompt); err != nil {
+			return "", "", err
+		}
+	}
+	if options != nil && options.PromptSuffix != "" {
+		prompt += "\n\n" + options.PromptSuffix
+	}
+	prompt, err = interceptPrompt(options, prompt)
+	if err != nil {
+		return "", "", err
+	}
+	return handleLargePrompt(options, prompt)
+}
+
+// interceptPrompt applies the configured request interceptor to a prompt.
+// A rejected prompt (interceptor error or panic) must not be sent.
+func interceptPrompt(options *Options, prompt string) (result string, err error) {
+	if options == nil || options.RequestInterceptor == nil {
+		return prompt, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = "", fmt.Errorf("request interceptor panicked: %v", r)
+		}
+	}()
+	result, err = options.RequestInterceptor(prompt)
+	if err != nil {
+		return "", fmt.Errorf("prompt rejected by request interceptor: %w", err)
+	}
+	return result, nil
+}
+
+// handleLargePrompt applies the configured LargePromptStrategy to a prompt
+// over LargePromptThreshold bytes. promptFile is the temporary file holding
+// the original prompt for LargePromptStrategyFile, or "" otherwise.
+func handleLargePrompt(options *Options, prompt string) (result, promptFile string, err error) {
+	if options == nil || options.LargePromptThreshold <= 0 || len(prompt) <= options.LargePromptThreshold {
+		return prompt, "", nil
+	}
+	threshold := options.LargePromptThreshold
+
+	switch options.LargePromptStrategy {
+	case "", LargePromptStrategyError:
+		return "", "", NewPromptTooLargeError(len(prompt), threshold)
+
+	case LargePromptStrategyTruncate:
+		return truncateUTF8(prompt, threshold), "", nil
+
+	case LargePromptStrategyFile:
+		file, err := os.CreateTemp("", "claude_prompt_*.txt")
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create prompt file: %w", err)
+		}
+		if _, err := file.WriteString(prompt); err != nil {
+			_ = file.Close()
+			removePromptFile(file.Name())
+			return "", "", fmt.Errorf("failed to write prompt file: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			removePromptFile(file.Name())
+			return "", "", fmt.Errorf("failed to write prompt file: %w", err)
+		}
+		return fmt.Sprintf("The prompt for this request is %d bytes, too large to send directly. "+
+			"It has been saved to %s. Read that file in full and treat its contents as the prompt.",
+			len(prompt), file.Name()), file.Name(), nil
+	}
+	return "", "", fmt.Errorf("unknown large prompt strategy %q", options.LargePromptStrategy)
+}
+
+// removePromptFile removes a prompt file written by handleLargePrompt.
+func removePromptFile(path string) {
+	if path != "" {
+		_ = os.Remove(path)
+	}
 }
 
 // Internal helper functions
 func queryWithTransportAndOptions(
 	ctx context.Context,
 	prompt string,
+	promptFile string,
 	transport Transport,
 	options *Options,
 ) (MessageIterator, error) {
 	if transport == nil {
+		removePromptFile(promptFile)
 		return nil, fmt.Errorf("transport is required")
 	}
+	if options != nil {
+		if err := shared.ValidateMaxThinkingTokens(options.MaxThinkingTokens); err != nil {
+			removePromptFile(promptFile)
+			return nil, err
+		}
+	}
 
 	// Create iterator that manages the transport lifecycle
 	return &queryIterator{
-		transport: transport,
-		prompt:    prompt,
-		ctx:       ctx,
-		options:   options,
+		transport:  transport,
+		prompt:     prompt,
+		promptFile: promptFile,
+		ctx:        ctx,
+		options:    options,
 	}, nil
 }
 
@@ -76,6 +227,13 @@ type queryIterator struct {
 	mu        sync.Mutex
 	closed    bool
 	closeOnce sync.Once
+
+	// promptFile holds an oversized prompt (see LargePromptStrategyFile)
+	// and is removed on Close
+	promptFile string
+
+	// received holds the messages delivered so far for PartialResultsOnCancel
+	received []Message
 }
 
 func (qi *queryIterator) Next(_ context.Context) (Message, error) {
@@ -96,26 +254,115 @@ func (qi *queryIterator) Next(_ context.Context) (Message, error) {
 	qi.mu.Unlock()
 
 	// Read from message channels
-	select {
-	case msg, ok := <-qi.msgChan:
-		if !ok {
+	for {
+		select {
+		case msg, ok := <-qi.msgChan:
+			return qi.handleMessage(msg, ok)
+		case err, ok := <-qi.errChan:
+			if !ok {
+				// Error channel closed; drain buffered messages until msgChan closes
+				qi.errChan = nil
+				continue
+			}
+			qi.mu.Lock()
+			qi.closed = true
+			qi.mu.Unlock()
+			if qi.keepPartialResults() && qi.ctx.Err() != nil {
+				return nil, qi.partialResultsError()
+			}
+			return nil, err
+		case <-qi.ctx.Done():
+			qi.mu.Lock()
+			qi.closed = true
+			qi.mu.Unlock()
+			if qi.keepPartialResults() {
+				return nil, qi.partialResultsError()
+			}
+			return nil, qi.ctx.Err()
+		}
+	}
+}
+
+// keepPartialResults reports whether WithPartialResultsOnCancel is set.
+func (qi *queryIterator) keepPartialResults() bool {
+	return qi.options != nil && qi.options.PartialResultsOnCancel
+}
+
+// partialResultsError drains messages already buffered on msgChan and returns
+// them, after the messages delivered so far, with the context error.
+func (qi *queryIterator) partialResultsError() error {
+	qi.mu.Lock()
+	defer qi.mu.Unlock()
+	for {
+		select {
+		case msg, ok := <-qi.msgChan:
+			if ok {
+				qi.received = append(qi.received, msg)
+				continue
+			}
+		default:
+		}
+		break
+	}
+	return NewPartialResultsError(append([]Message(nil), qi.received...), qi.ctx.Err())
+}
+
+// handleMessage applies iterator options to a message received from msgChan.
+// ok is false when the channel has been closed.
+func (qi *queryIterator) handleMessage(msg Message, ok bool) (Message, error) {
+	qi.mu.Lock()
+	if !ok {
+		qi.closed = true
+		qi.mu.Unlock()
+		if qi.keepPartialResults() && qi.ctx.Err() != nil {
+			return nil, qi.partialResultsError()
+		}
+		return nil, endOfStreamError(qi.transport)
+	}
+	qi.mu.Unlock()
+
+	if qi.options != nil {
+		notifyTurnEnd(qi.options.OnTurnEnd, msg)
+	}
+
+	if qi.options != nil && qi.options.FailFast {
+		if toolErr := findToolExecutionError(msg); toolErr != nil {
 			qi.mu.Lock()
 			qi.closed = true
 			qi.mu.Unlock()
-			return nil, ErrNoMoreMessages
+			qi.interruptTurn()
+			return nil, toolErr
 		}
-		return msg, nil
-	case err := <-qi.errChan:
+	}
+	if err := validateStrictOutput(strictOutputSchema(qi.options), msg); err != nil {
 		qi.mu.Lock()
 		qi.closed = true
 		qi.mu.Unlock()
 		return nil, err
-	case <-qi.ctx.Done():
+	}
+	if _, ok := msg.(*AssistantMessage); ok && qi.options != nil && qi.options.StopAfterFirstResponse {
 		qi.mu.Lock()
 		qi.closed = true
 		qi.mu.Unlock()
-		return nil, qi.ctx.Err()
+		qi.interruptTurn()
 	}
+	if qi.keepPartialResults() {
+		qi.mu.Lock()
+		qi.received = append(qi.received, msg)
+		qi.mu.Unlock()
+	}
+	return msg, nil
+}
+
+// interruptTurn interrupts the query's turn and discards the rest of it,
+// still reporting its result to the turn end callback.
+func (qi *queryIterator) interruptTurn() {
+	_ = qi.transport.Interrupt(qi.ctx)
+	drainTurn(qi.ctx, qi.msgChan, qi.errChan, func(msg Message) {
+		if qi.options != nil {
+			notifyTurnEnd(qi.options.OnTurnEnd, msg)
+		}
+	})
 }
 
 func (qi *queryIterator) Close() error {
@@ -127,6 +374,7 @@ func (qi *queryIterator) Close() error {
 		if qi.transport != nil {
 			err = qi.transport.Close()
 		}
+		removePromptFile(qi.promptFile)
 	})
 	return err
 }
@@ -152,15 +400,24 @@ func (qi *queryIterator) start() error {
 	if err := qi.transport.SendMessage(qi.ctx, streamMsg); err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
+	if qi.options != nil {
+		notifyTurnStart(qi.options.OnTurnStart, qi.prompt)
+	}
 
 	return nil
 }
 
+// findCLI returns the CLI path set with WithCLIPath, or discovers the CLI.
+func findCLI(options *Options) (string, error) {
+	if options != nil && options.CLIPath != nil && *options.CLIPath != "" {
+		return *options.CLIPath, nil
+	}
+	return cli.FindCLI()
+}
+
 // createQueryTransport creates a transport for one-shot queries with prompt as CLI argument.
 func createQueryTransport(prompt string, options *Options) (Transport, error) {
-	// Import here to avoid issues - actual imports are at the top of the file
-	// Find Claude CLI binary
-	cliPath, err := cli.FindCLI()
+	cliPath, err := findCLI(options)
 	if err != nil {
 		return nil, err
 	}
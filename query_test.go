@@ -2,13 +2,19 @@ package claudecode
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/subprocess"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
@@ -812,6 +818,77 @@ func TestQueryIteratorContextCancellation(t *testing.T) {
 	}
 }
 
+// TestQueryPartialResultsOnCancel tests cancelling mid-stream returns every
+// message received so far alongside the context error
+func TestQueryPartialResultsOnCancel(t *testing.T) {
+	run := func(t *testing.T, opts ...Option) ([]Message, error) {
+		t.Helper()
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport(
+			WithQueryAssistantResponse("Reading the files"),
+			WithQueryAssistantResponse("Found two issues"),
+			WithQueryAssistantResponse("Fixing the first"),
+		)
+		iter, err := QueryWithTransport(ctx, "Fix the bugs", transport, opts...)
+		assertNoError(t, err)
+		defer func() { _ = iter.Close() }()
+
+		first, err := iter.Next(ctx)
+		assertNoError(t, err)
+		delivered := []Message{first}
+
+		// Wait until the rest are buffered, then cancel mid-stream
+		for deadline := time.Now().Add(time.Second); len(transport.msgChan) < 2; {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for buffered messages")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+
+		for {
+			msg, err := iter.Next(ctx)
+			if err != nil {
+				return delivered, err
+			}
+			delivered = append(delivered, msg)
+		}
+	}
+
+	t.Run("returns_messages_so_far", func(t *testing.T) {
+		delivered, err := run(t, WithPartialResultsOnCancel())
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected error to wrap context.Canceled, got %v", err)
+		}
+		partial := AsPartialResultsError(err)
+		if partial == nil {
+			t.Fatalf("Expected PartialResultsError, got %v", err)
+		}
+		if len(partial.Messages) != 3 {
+			t.Fatalf("Expected all 3 received messages, got %d", len(partial.Messages))
+		}
+		for i, msg := range delivered {
+			if partial.Messages[i] != msg {
+				t.Errorf("Expected message %d to be the one already delivered", i)
+			}
+		}
+		assertQueryTextContent(t, assertQueryAssistantMessage(t, partial.Messages[2]), "Fixing the first")
+	})
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		_, err := run(t)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if IsPartialResultsError(err) {
+			t.Error("Expected no partial results without the option")
+		}
+	})
+}
+
 // Mock Transport Implementation
 type queryMockTransport struct {
 	mu               sync.RWMutex
@@ -826,6 +903,8 @@ type queryMockTransport struct {
 	sendError        error
 	delay            time.Duration
 	optionsReceived  bool
+	interruptCount   int
+	validator        *StreamValidator
 }
 
 func (q *queryMockTransport) Connect(ctx context.Context) error {
@@ -908,6 +987,28 @@ func (q *queryMockTransport) SendMessage(ctx context.Context, message StreamMess
 	return nil
 }
 
+func (q *queryMockTransport) SendRaw(ctx context.Context, frame []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if q.sendError != nil {
+		return q.sendError
+	}
+	if !q.connected {
+		return fmt.Errorf("not connected")
+	}
+	if !json.Valid(frame) {
+		return fmt.Errorf("invalid frame")
+	}
+	return nil
+}
+
 func (q *queryMockTransport) ReceiveMessages(_ context.Context) (<-chan Message, <-chan error) {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
@@ -915,6 +1016,9 @@ func (q *queryMockTransport) ReceiveMessages(_ context.Context) (<-chan Message,
 }
 
 func (q *queryMockTransport) Interrupt(_ context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.interruptCount++
 	return nil
 }
 
@@ -939,6 +1043,9 @@ func (q *queryMockTransport) Close() error {
 }
 
 func (q *queryMockTransport) GetValidator() *StreamValidator {
+	if q.validator != nil {
+		return q.validator
+	}
 	return &StreamValidator{}
 }
 
@@ -950,6 +1057,191 @@ func (q *queryMockTransport) hasReceivedOptions() bool {
 	return q.optionsReceived
 }
 
+// TestQueryFailFast tests that WithFailFast aborts a query on the first tool error
+func TestQueryFailFast(t *testing.T) {
+	ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newQueryMockTransport(
+		WithQueryAssistantResponse("Running the command"),
+		WithQueryToolErrorResult("toolu_01", "permission denied"),
+		WithQueryAssistantResponse("Recovering"),
+	)
+
+	iter, err := QueryWithTransport(ctx, "Run it", transport, WithFailFast())
+	assertNoError(t, err)
+	defer iter.Close()
+
+	if _, err := iter.Next(ctx); err != nil {
+		t.Fatalf("Expected first message, got error: %v", err)
+	}
+
+	_, err = iter.Next(ctx)
+	if !IsToolExecutionError(err) {
+		t.Fatalf("Expected ToolExecutionError, got %v", err)
+	}
+	if toolErr := AsToolExecutionError(err); toolErr.ToolUseID != "toolu_01" {
+		t.Errorf("Expected ToolUseID toolu_01, got %q", toolErr.ToolUseID)
+	}
+
+	transport.mu.RLock()
+	interrupts := transport.interruptCount
+	transport.mu.RUnlock()
+	if interrupts != 1 {
+		t.Errorf("Expected session to be interrupted once, got %d", interrupts)
+	}
+
+	if _, err := iter.Next(ctx); err != ErrNoMoreMessages {
+		t.Errorf("Expected ErrNoMoreMessages after fail-fast, got %v", err)
+	}
+}
+
+// TestQueryStopAfterFirstResponse tests the query stops after the first assistant message
+func TestQueryStopAfterFirstResponse(t *testing.T) {
+	ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newQueryMockTransport(
+		WithQuerySystemMessage("init", map[string]any{}),
+		WithQueryAssistantResponse("positive"),
+		WithQueryAssistantResponse("Let me also check with a tool..."),
+		WithQueryResultMessage(false, 1000, 2),
+	)
+
+	iter, err := QueryWithTransport(ctx, "Classify: great product", transport, WithStopAfterFirstResponse())
+	assertNoError(t, err)
+	defer iter.Close()
+
+	if msg, err := iter.Next(ctx); err != nil {
+		t.Fatalf("Expected system message, got error: %v", err)
+	} else if _, ok := msg.(*SystemMessage); !ok {
+		t.Fatalf("Expected SystemMessage, got %T", msg)
+	}
+
+	msg, err := iter.Next(ctx)
+	assertNoError(t, err)
+	assistant, ok := msg.(*AssistantMessage)
+	if !ok {
+		t.Fatalf("Expected AssistantMessage, got %T", msg)
+	}
+	if text := assistant.Content[0].(*TextBlock).Text; text != "positive" {
+		t.Errorf("Expected first response 'positive', got %q", text)
+	}
+
+	transport.mu.RLock()
+	interrupts := transport.interruptCount
+	transport.mu.RUnlock()
+	if interrupts != 1 {
+		t.Errorf("Expected session to be interrupted once, got %d", interrupts)
+	}
+
+	if _, err := iter.Next(ctx); err != ErrNoMoreMessages {
+		t.Errorf("Expected ErrNoMoreMessages after first response, got %v", err)
+	}
+}
+
+// TestQueryJSONSchemaStrict tests structured output with extra fields is rejected
+func TestQueryJSONSchemaStrict(t *testing.T) {
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"sentiment": map[string]any{"type": "string"}},
+	}
+
+	tests := []struct {
+		name    string
+		output  map[string]any
+		wantErr bool
+	}{
+		{"declared_fields_accepted", map[string]any{"sentiment": "positive"}, false},
+		{"extra_fields_rejected", map[string]any{"sentiment": "positive", "confidence": 0.9}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newQueryMockTransport(WithQueryStructuredResult(test.output))
+			iter, err := QueryWithTransport(ctx, "Classify: great product", transport, WithJSONSchemaStrict(schema))
+			assertNoError(t, err)
+			defer iter.Close()
+
+			msg, err := iter.Next(ctx)
+			if !test.wantErr {
+				assertNoError(t, err)
+				if _, ok := msg.(*ResultMessage); !ok {
+					t.Fatalf("Expected ResultMessage, got %T", msg)
+				}
+				return
+			}
+
+			outputErr := AsStructuredOutputError(err)
+			if outputErr == nil {
+				t.Fatalf("Expected StructuredOutputError, got %v", err)
+			}
+			if len(outputErr.Fields) != 1 || outputErr.Fields[0] != "confidence" {
+				t.Errorf("Expected extra field confidence, got %v", outputErr.Fields)
+			}
+			if _, err := iter.Next(ctx); err != ErrNoMoreMessages {
+				t.Errorf("Expected ErrNoMoreMessages after rejection, got %v", err)
+			}
+		})
+	}
+}
+
+// TestQueryStreamTermination tests normal completion and premature EOF return distinct errors
+func TestQueryStreamTermination(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []QueryMockOption
+		wantErr error
+	}{
+		{
+			name:    "normal_completion",
+			options: []QueryMockOption{WithQueryAssistantResponse("4"), WithQueryResultMessage(false, 1000, 1)},
+			wantErr: ErrNoMoreMessages,
+		},
+		{
+			name:    "premature_eof",
+			options: []QueryMockOption{WithQueryAssistantResponse("Working on it"), WithQueryUnexpectedEOF()},
+			wantErr: ErrUnexpectedEOF,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+			defer cancel()
+
+			iter, err := QueryWithTransport(ctx, "What is 2+2?", newQueryMockTransport(test.options...))
+			assertNoError(t, err)
+			defer iter.Close()
+
+			var endErr error
+			for endErr == nil {
+				_, endErr = iter.Next(ctx)
+			}
+
+			if !errors.Is(endErr, test.wantErr) {
+				t.Fatalf("Expected %v, got %v", test.wantErr, endErr)
+			}
+			if test.wantErr == ErrUnexpectedEOF {
+				if errors.Is(endErr, ErrNoMoreMessages) {
+					t.Error("Expected premature EOF to be distinct from ErrNoMoreMessages")
+				}
+				if !errors.Is(endErr, io.ErrUnexpectedEOF) {
+					t.Error("Expected premature EOF to wrap io.ErrUnexpectedEOF")
+				}
+			}
+
+			// Subsequent calls report normal exhaustion
+			if _, err := iter.Next(ctx); !errors.Is(err, ErrNoMoreMessages) {
+				t.Errorf("Expected ErrNoMoreMessages after end of stream, got %v", err)
+			}
+		})
+	}
+}
+
 // Mock Transport Options
 type QueryMockOption func(*queryMockTransport)
 
@@ -1003,6 +1295,34 @@ func WithQueryResultMessage(isError bool, durationMs, numTurns int) QueryMockOpt
 	}
 }
 
+func WithQueryToolErrorResult(toolUseID, content string) QueryMockOption {
+	return func(q *queryMockTransport) {
+		isError := true
+		q.responseMessages = append(q.responseMessages, &UserMessage{
+			Content: []ContentBlock{&ToolResultBlock{ToolUseID: toolUseID, Content: content, IsError: &isError}},
+		})
+	}
+}
+
+func WithQueryStructuredResult(output any) QueryMockOption {
+	return func(q *queryMockTransport) {
+		q.responseMessages = append(q.responseMessages, &ResultMessage{
+			Subtype:          "success",
+			NumTurns:         1,
+			SessionID:        "test-session",
+			StructuredOutput: output,
+		})
+	}
+}
+
+// WithQueryUnexpectedEOF simulates the CLI exiting before the turn's result.
+func WithQueryUnexpectedEOF() QueryMockOption {
+	return func(q *queryMockTransport) {
+		q.validator = NewStreamValidator()
+		q.validator.MarkUnexpectedEnd()
+	}
+}
+
 func WithQueryConnectError(err error) QueryMockOption {
 	return func(q *queryMockTransport) {
 		q.connectError = err
@@ -1237,3 +1557,464 @@ func TestQueryFunction(t *testing.T) {
 		})
 	}
 }
+
+// TestQueryRequestInterceptor tests one-shot prompts are rewritten or rejected before sending
+func TestQueryRequestInterceptor(t *testing.T) {
+	errRejected := errors.New("blocked")
+	interceptor := func(prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "block") {
+			return "", errRejected
+		}
+		return strings.ToUpper(prompt), nil
+	}
+
+	t.Run("rewritten", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, "hello", transport, WithRequestInterceptor(interceptor))
+		assertNoError(t, err)
+		defer iter.Close()
+		_ = collectQueryMessages(ctx, t, iter)
+
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		if len(transport.receivedMessages) != 1 {
+			t.Fatalf("Expected 1 sent message, got %d", len(transport.receivedMessages))
+		}
+		userMsg, ok := transport.receivedMessages[0].Message.(*UserMessage)
+		if !ok || userMsg.Content != "HELLO" {
+			t.Errorf("Expected rewritten prompt HELLO, got %+v", transport.receivedMessages[0].Message)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, "block me", transport, WithRequestInterceptor(interceptor))
+		if !errors.Is(err, errRejected) {
+			t.Fatalf("Expected error wrapping the interceptor error, got %v", err)
+		}
+		if iter != nil {
+			t.Error("Expected no iterator for a rejected prompt")
+		}
+
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		if transport.connected || len(transport.receivedMessages) != 0 {
+			t.Error("Expected rejected prompt to never reach the transport")
+		}
+	})
+}
+
+// TestQueryInputValidation tests empty and out-of-bounds prompts are rejected
+// before reaching the transport
+func TestQueryInputValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		prompt  string
+		wantErr string
+	}{
+		{"empty", "", "prompt is empty"},
+		{"whitespace_only", " \n\t", "prompt is empty"},
+		{"too_short", "hi", "prompt is 2 bytes, shorter than the minimum of 3"},
+		{"too_long", strings.Repeat("x", 21), "prompt is 21 bytes, longer than the maximum of 20"},
+		{"valid", "What is Go?", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newQueryMockTransport()
+			iter, err := QueryWithTransport(ctx, test.prompt, transport, WithInputValidation(3, 20))
+			if test.wantErr == "" {
+				assertNoError(t, err)
+				defer iter.Close()
+				_ = collectQueryMessages(ctx, t, iter)
+				transport.mu.RLock()
+				defer transport.mu.RUnlock()
+				if len(transport.receivedMessages) != 1 {
+					t.Errorf("Expected valid prompt sent, got %d messages", len(transport.receivedMessages))
+				}
+				return
+			}
+
+			validationErr := AsValidationError(err)
+			if validationErr == nil || validationErr.Field != "prompt" || err.Error() != test.wantErr {
+				t.Fatalf("Expected prompt ValidationError %q, got %v", test.wantErr, err)
+			}
+			if validationErr.Value != len(test.prompt) {
+				t.Errorf("Expected Value %d, got %v", len(test.prompt), validationErr.Value)
+			}
+			transport.mu.RLock()
+			defer transport.mu.RUnlock()
+			if iter != nil || transport.connected || len(transport.receivedMessages) != 0 {
+				t.Error("Expected invalid prompt to never reach the transport")
+			}
+		})
+	}
+
+	t.Run("query_fails_before_starting_cli", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		// With validation the empty prompt is rejected before the CLI is looked up
+		_, err := Query(ctx, "", WithInputValidation(0, 0), WithCLIPath("/nonexistent/claude"))
+		if !IsValidationError(err) {
+			t.Errorf("Expected ValidationError, got %v", err)
+		}
+	})
+}
+
+// TestFindCLI tests a CLI path set with WithCLIPath is used instead of discovery
+func TestFindCLI(t *testing.T) {
+	path, err := findCLI(NewOptions(WithCLIPath("/opt/claude/bin/claude")))
+	assertNoError(t, err)
+	if path != "/opt/claude/bin/claude" {
+		t.Errorf("Expected the configured CLI path, got %q", path)
+	}
+}
+
+// TestQueryLargePromptHandling tests oversized one-shot prompts under each strategy
+func TestQueryLargePromptHandling(t *testing.T) {
+	const threshold = 16
+	oversized := strings.Repeat("x", 14) + "héllo" // 20 bytes, é spans bytes 15-16
+
+	sentPrompt := func(t *testing.T, transport *queryMockTransport) string {
+		t.Helper()
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		if len(transport.receivedMessages) != 1 {
+			t.Fatalf("Expected 1 sent message, got %d", len(transport.receivedMessages))
+		}
+		userMsg, ok := transport.receivedMessages[0].Message.(*UserMessage)
+		if !ok {
+			t.Fatalf("Expected *UserMessage, got %T", transport.receivedMessages[0].Message)
+		}
+		prompt, _ := userMsg.Content.(string)
+		return prompt
+	}
+
+	t.Run("under_threshold_unchanged", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, "short", transport,
+			WithLargePromptHandling(threshold, LargePromptStrategyError))
+		assertNoError(t, err)
+		defer iter.Close()
+		_ = collectQueryMessages(ctx, t, iter)
+
+		if got := sentPrompt(t, transport); got != "short" {
+			t.Errorf("Expected prompt unchanged, got %q", got)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, oversized, transport,
+			WithLargePromptHandling(threshold, LargePromptStrategyError))
+		if iter != nil {
+			t.Error("Expected no iterator for an oversized prompt")
+		}
+		tooLarge := AsPromptTooLargeError(err)
+		if tooLarge == nil {
+			t.Fatalf("Expected *PromptTooLargeError, got %v", err)
+		}
+		if tooLarge.Size != len(oversized) || tooLarge.Threshold != threshold {
+			t.Errorf("Expected size %d and threshold %d, got %d and %d",
+				len(oversized), threshold, tooLarge.Size, tooLarge.Threshold)
+		}
+
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		if transport.connected || len(transport.receivedMessages) != 0 {
+			t.Error("Expected oversized prompt to never reach the transport")
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, oversized, transport,
+			WithLargePromptHandling(threshold, LargePromptStrategyTruncate))
+		assertNoError(t, err)
+		defer iter.Close()
+		_ = collectQueryMessages(ctx, t, iter)
+
+		// Cutting at 16 bytes would split é, so the prompt ends before it
+		expected := strings.Repeat("x", 14) + "h"
+		if got := sentPrompt(t, transport); got != expected {
+			t.Errorf("Expected truncated prompt %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, oversized, transport,
+			WithLargePromptHandling(threshold, LargePromptStrategyFile))
+		assertNoError(t, err)
+		_ = collectQueryMessages(ctx, t, iter)
+
+		prompt := sentPrompt(t, transport)
+		path := iter.(*queryIterator).promptFile
+		if path == "" || !strings.Contains(prompt, path) {
+			t.Fatalf("Expected prompt to reference the prompt file, got %q", prompt)
+		}
+		content, err := os.ReadFile(path)
+		assertNoError(t, err)
+		if string(content) != oversized {
+			t.Errorf("Expected prompt file to hold the original prompt, got %q", content)
+		}
+
+		assertNoError(t, iter.Close())
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected prompt file removed on Close, got %v", err)
+		}
+	})
+}
+
+// TestQueryContextFiles tests context files are prepended to the prompt
+// within the size budget
+func TestQueryContextFiles(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "main.go")
+	notesPath := filepath.Join(dir, "notes.txt")
+	assertNoError(t, os.WriteFile(mainPath, []byte("package main\n"), 0o600))
+	assertNoError(t, os.WriteFile(notesPath, []byte("héllo world"), 0o600))
+
+	sendPrompt := func(t *testing.T, opts ...Option) string {
+		t.Helper()
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		iter, err := QueryWithTransport(ctx, "Explain this code", transport, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer iter.Close()
+		_ = collectQueryMessages(ctx, t, iter)
+
+		transport.mu.RLock()
+		defer transport.mu.RUnlock()
+		userMsg, _ := transport.receivedMessages[0].Message.(*UserMessage)
+		prompt, _ := userMsg.Content.(string)
+		return prompt
+	}
+
+	t.Run("contents_prepended", func(t *testing.T) {
+		prompt := sendPrompt(t, WithContextFiles(mainPath), WithContextFiles(notesPath))
+		want := fmt.Sprintf("<file path=%q>\npackage main\n</file>\n\n<file path=%q>\nhéllo world\n</file>\n\n"+
+			"Explain this code", mainPath, notesPath)
+		if prompt != want {
+			t.Errorf("Expected prompt:\n%s\ngot:\n%s", want, prompt)
+		}
+	})
+
+	t.Run("budget_truncates", func(t *testing.T) {
+		// 13 bytes of main.go leave 2 for notes.txt, which would split é
+		prompt := sendPrompt(t, WithContextFiles(mainPath, notesPath, mainPath), WithContextFilesBudget(15))
+		want := fmt.Sprintf("<file path=%q>\npackage main\n</file>\n\n<file path=%q truncated=\"true\">\nh\n</file>\n\n"+
+			"<file path=%q truncated=\"true\">\n</file>\n\nExplain this code", mainPath, notesPath, mainPath)
+		if prompt != want {
+			t.Errorf("Expected prompt:\n%s\ngot:\n%s", want, prompt)
+		}
+	})
+
+	t.Run("missing_file", func(t *testing.T) {
+		ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+		defer cancel()
+
+		transport := newQueryMockTransport()
+		missing := filepath.Join(dir, "missing.go")
+		_, err := QueryWithTransport(ctx, "Explain", transport, WithContextFiles(missing))
+		if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), missing) {
+			t.Errorf("Expected error naming the missing file, got %v", err)
+		}
+	})
+}
+
+// TestQueryPartialStreaming tests the one-shot CLI is started with partial
+// messages enabled and the Query iterator yields its stream events
+func TestQueryPartialStreaming(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock CLI script requires a POSIX shell")
+	}
+
+	// Emits deltas only when started in one-shot mode with partial messages
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+case " $* " in *" --print "*" --include-partial-messages "*)
+echo '{"type":"stream_event","uuid":"e1","session_id":"s1","event":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}}'
+echo '{"type":"stream_event","uuid":"e2","session_id":"s1","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}}'
+echo '{"type":"stream_event","uuid":"e3","session_id":"s1","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}}'
+echo '{"type":"stream_event","uuid":"e4","session_id":"s1","event":{"type":"content_block_stop","index":0}}'
+;;
+esac
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hello"}],"model":"claude-sonnet-4-5"}}'
+echo '{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":5,"is_error":false,"num_turns":1,"session_id":"s1"}'
+`
+	cliPath := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(cliPath, []byte(script), 0o755); err != nil { // #nosec G306 - Test script needs to be executable
+		t.Fatalf("Failed to write mock CLI: %v", err)
+	}
+
+	receive := func(t *testing.T, opts ...Option) (deltas []string, types []string) {
+		t.Helper()
+		ctx, cancel := setupQueryTestContext(t, 10*time.Second)
+		defer cancel()
+
+		transport := subprocess.NewWithPrompt(cliPath, NewOptions(opts...), "Say hello")
+		iter, err := QueryWithTransport(ctx, "Say hello", transport, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer iter.Close()
+
+		for _, msg := range collectQueryMessages(ctx, t, iter) {
+			types = append(types, msg.Type())
+			if event, ok := msg.(*StreamEvent); ok {
+				if parsed := ParseStreamEvent(event); parsed.Delta != nil {
+					deltas = append(deltas, parsed.Delta.Text)
+				}
+			}
+		}
+		return deltas, types
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		deltas, types := receive(t, WithPartialStreaming())
+		if strings.Join(deltas, "|") != "Hel|lo" {
+			t.Errorf("Expected text deltas Hel|lo, got %v", deltas)
+		}
+		want := []string{
+			MessageTypeStreamEvent, MessageTypeStreamEvent, MessageTypeStreamEvent, MessageTypeStreamEvent,
+			MessageTypeAssistant, MessageTypeResult,
+		}
+		if strings.Join(types, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected messages %v, got %v", want, types)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		deltas, types := receive(t)
+		if len(deltas) != 0 || strings.Join(types, ",") != MessageTypeAssistant+","+MessageTypeResult {
+			t.Errorf("Expected no stream events without partial streaming, got %v", types)
+		}
+	})
+}
+
+// TestQueryTurnCallback tests a one-shot query reports its turn start once
+// sent, before any message, and its end with the result
+func TestQueryTurnCallback(t *testing.T) {
+	ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newQueryMockTransport(
+		WithQueryAssistantResponse("Hello"),
+		WithQueryResultMessage(false, 100, 1),
+	)
+	var events []string
+	var ended *ResultMessage
+	iter, err := QueryWithTransport(ctx, "Say hello", transport, WithTurnCallback(
+		func(prompt string) {
+			transport.mu.RLock()
+			connected := transport.connected
+			transport.mu.RUnlock()
+			events = append(events, fmt.Sprintf("start %q connected=%v", prompt, connected))
+		},
+		func(result *ResultMessage) {
+			events = append(events, "end")
+			ended = result
+		},
+	))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer iter.Close()
+	if len(events) != 0 {
+		t.Errorf("Expected no callbacks before the first Next, got %v", events)
+	}
+
+	for {
+		msg, err := iter.Next(ctx)
+		if err == ErrNoMoreMessages {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Iterator error: %v", err)
+		}
+		events = append(events, msg.Type())
+		if result, ok := msg.(*ResultMessage); ok && result != ended {
+			t.Errorf("Expected onEnd to receive the delivered result, got %p and %p", ended, result)
+		}
+	}
+	want := []string{`start "Say hello" connected=true`, MessageTypeAssistant, "end", MessageTypeResult}
+	if strings.Join(events, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected events %v, got %v", want, events)
+	}
+}
+
+// TestQueryTurnCallbackSendFailure tests a one-shot query whose prompt
+// fails to send reports no turn start
+func TestQueryTurnCallbackSendFailure(t *testing.T) {
+	ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+	defer cancel()
+
+	transport := newQueryMockTransport(WithQuerySendError(errors.New("broken pipe")))
+	var started []string
+	iter, err := QueryWithTransport(ctx, "Say hello", transport, WithTurnCallback(
+		func(prompt string) { started = append(started, prompt) }, nil))
+	assertNoError(t, err)
+	defer iter.Close()
+
+	if _, err := iter.Next(ctx); err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Fatalf("Expected the send error, got %v", err)
+	}
+	if len(started) != 0 {
+		t.Errorf("Expected no onStart for a failed send, got %q", started)
+	}
+}
+
+// TestQueryPromptSuffix tests one-shot queries send the prompt with the
+// suffix appended
+func TestQueryPromptSuffix(t *testing.T) {
+	for _, prompt := range []string{"hello", "What is 2+2?"} {
+		t.Run(prompt, func(t *testing.T) {
+			ctx, cancel := setupQueryTestContext(t, 5*time.Second)
+			defer cancel()
+
+			transport := newQueryMockTransport()
+			iter, err := QueryWithTransport(ctx, prompt, transport, WithPromptSuffix("Be brief."))
+			assertNoError(t, err)
+			defer iter.Close()
+			_ = collectQueryMessages(ctx, t, iter)
+
+			transport.mu.RLock()
+			defer transport.mu.RUnlock()
+			if len(transport.receivedMessages) != 1 {
+				t.Fatalf("Expected 1 sent message, got %d", len(transport.receivedMessages))
+			}
+			want := prompt + "\n\nBe brief."
+			userMsg, ok := transport.receivedMessages[0].Message.(*UserMessage)
+			if !ok || userMsg.Content != want {
+				t.Errorf("Expected prompt %q, got %+v", want, transport.receivedMessages[0].Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package claudecode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// outputSchemaClient is implemented by clients whose output schema can be
+// set before connecting, for QueryJSON.
+type outputSchemaClient interface {
+	useOutputSchema(ctx context.Context, schema map[string]any) error
+}
+
+// QueryJSON sends prompt on client and decodes the turn's structured output
+// into T. The CLI fixes the output schema when it starts, so if client is not
+// connected QueryJSON sets schema as its output format and connects it; the
+// caller still owns Disconnect. A connected client must have been configured
+// with the same schema, e.g. by WithJSONSchema. A nil schema uses the
+// client's configured output format as is.
+//
+// Returns an error if the turn fails, or if its ResultMessage carries no
+// structured output or the output does not decode into T.
+//
+// Example:
+//
+//	type Summary struct {
+//	    Title  string   `json:"title"`
+//	    Points []string `json:"points"`
+//	}
+//
+//	client := claudecode.NewClient()
+//	defer client.Disconnect()
+//	summary, err := claudecode.QueryJSON[Summary](ctx, client,
+//	    "Summarize README.md", claudecode.JSONSchemaFromType(Summary{}))
+func QueryJSON[T any](ctx context.Context, client Client, prompt string, schema map[string]any) (T, error) {
+	var out T
+	if schema != nil {
+		if c, ok := client.(outputSchemaClient); ok {
+			if err := c.useOutputSchema(ctx, schema); err != nil {
+				return out, err
+			}
+		}
+	}
+
+	if err := client.Query(ctx, prompt); err != nil {
+		return out, err
+	}
+	iter := client.ReceiveResponse(ctx)
+	if iter == nil {
+		return out, fmt.Errorf("client not connected")
+	}
+	defer func() { _ = iter.Close() }()
+
+	for {
+		msg, err := iter.Next(ctx)
+		if err != nil {
+			return out, err
+		}
+		result, ok := msg.(*ResultMessage)
+		if !ok {
+			continue
+		}
+		if err := resultMessageError(result); err != nil {
+			return out, err
+		}
+		if result.StructuredOutput == nil {
+			return out, fmt.Errorf("result has no structured output")
+		}
+		data, err := json.Marshal(result.StructuredOutput)
+		if err != nil {
+			return out, fmt.Errorf("failed to encode structured output: %w", err)
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			return out, fmt.Errorf("failed to decode structured output into %T: %w", out, err)
+		}
+		return out, nil
+	}
+}
+
+// useOutputSchema makes schema the client's output format, connecting the
+// client if it is not connected. Returns an error if the client is connected
+// with a different output format.
+func (c *ClientImpl) useOutputSchema(ctx context.Context, schema map[string]any) error {
+	c.mu.Lock()
+	if c.connected {
+		format := c.options.OutputFormat
+		c.mu.Unlock()
+		if format == nil || !(reflect.DeepEqual(format.Schema, schema) ||
+			reflect.DeepEqual(format.Schema, StrictJSONSchema(schema))) {
+			return fmt.Errorf("client is connected with a different output schema; " +
+				"the schema is fixed when the client connects")
+		}
+		return nil
+	}
+	if c.options.OutputFormat == nil || !reflect.DeepEqual(c.options.OutputFormat.Schema, schema) {
+		c.options.OutputFormat = OutputFormatJSONSchema(schema)
+		c.options.StrictStructuredOutput = false
+	}
+	c.mu.Unlock()
+
+	return c.Connect(ctx)
+}
@@ -0,0 +1,124 @@
+package claudecode
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// sessionPersister saves each new session ID the CLI reports to a SessionStore.
+type sessionPersister struct {
+	store SessionStore
+	key   string
+
+	mu        sync.Mutex
+	saved     string // Session ID last saved, or empty
+	discarded string // Session ID never to save again, or empty
+}
+
+// newSessionPersister creates a persister for key whose store already holds saved.
+func newSessionPersister(store SessionStore, key, saved string) *sessionPersister {
+	return &sessionPersister{
+		store: store,
+		key:   key,
+		saved: saved,
+	}
+}
+
+// hook returns the stream hook saving the session ID each message reports.
+// A failed save is delivered as an error before the message that reported
+// the session ID.
+func (p *sessionPersister) hook(ctx context.Context) streamHook {
+	return streamHook{
+		message: func(msg Message) (bool, error) {
+			return true, p.save(ctx, msg)
+		},
+	}
+}
+
+// save stores the session ID reported by msg if it differs from the last one saved.
+func (p *sessionPersister) save(ctx context.Context, msg Message) error {
+	sessionID := reportedSessionID(msg)
+	if sessionID == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	skip := sessionID == p.saved || sessionID == p.discarded
+	p.mu.Unlock()
+	if skip {
+		return nil
+	}
+
+	if err := p.store.Save(ctx, p.key, sessionID); err != nil {
+		return fmt.Errorf("failed to save session %s to store: %w", sessionID, err)
+	}
+	p.mu.Lock()
+	p.saved = sessionID
+	p.mu.Unlock()
+	return nil
+}
+
+// current returns the session ID last saved, or empty.
+func (p *sessionPersister) current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.saved
+}
+
+// discard deletes the stored session and stops sessionID from being saved
+// again, so a later Connect does not resume it.
+func (p *sessionPersister) discard(ctx context.Context, sessionID string) error {
+	if err := p.store.Delete(ctx, p.key); err != nil {
+		return fmt.Errorf("failed to delete session from store: %w", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.saved = ""
+	p.discarded = sessionID
+	return nil
+}
+
+// reportedSessionID returns the CLI session ID carried by a system or result
+// message, or empty for other messages.
+func reportedSessionID(msg Message) string {
+	switch m := msg.(type) {
+	case *SystemMessage:
+		sessionID, _ := m.Data["session_id"].(string)
+		return sessionID
+	case *ResultMessage:
+		return m.SessionID
+	}
+	return ""
+}
+
+// resumeFromStore returns the session ID saved in the session store, or
+// empty if there is none or Resume was set explicitly. Must be called with
+// c.mu held.
+func (c *ClientImpl) resumeFromStore(ctx context.Context) (string, error) {
+	if c.options.Resume != nil {
+		return "", nil
+	}
+
+	sessionID, found, err := c.options.SessionStore.Load(ctx, c.options.SessionStoreKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to load session from store: %w", err)
+	}
+	if !found {
+		return "", nil
+	}
+	return sessionID, nil
+}
+
+// transportOptions returns the options to start the CLI with: the client's
+// own, with Resume set to the session resumed from the store. The caller's
+// Options are left unchanged. Must be called with c.mu held.
+func (c *ClientImpl) transportOptions() *Options {
+	if c.resumedSession == "" {
+		return c.options
+	}
+	opts := *c.options
+	sessionID := c.resumedSession
+	opts.Resume = &sessionID
+	return &opts
+}
@@ -0,0 +1,96 @@
+package claudecode
+
+import (
+	"sync"
+	"time"
+)
+
+// ClientStats holds cumulative counts for a Client's current or most recent
+// connection, as returned by Client.Stats.
+type ClientStats struct {
+	// ConnectedSince is when the connection was made, or zero if the client
+	// has never connected.
+	ConnectedSince time.Time
+	// TurnsCompleted counts result messages, successful or not.
+	TurnsCompleted int
+	// Messages counts every message delivered. Overloaded results held back
+	// by WithOverloadBackoff while their turn is retried are not counted.
+	Messages int
+	// ToolUses counts tool use blocks in assistant messages.
+	ToolUses int
+	// Errors counts errors received on the error channel and result messages
+	// ending a turn in an error.
+	Errors int
+}
+
+// statsCounter counts the messages and errors a client receives into
+// ClientStats.
+type statsCounter struct {
+	mu    sync.Mutex
+	stats ClientStats
+}
+
+// newStatsCounter creates a counter for a connection made at connectedSince.
+func newStatsCounter(connectedSince time.Time) *statsCounter {
+	return &statsCounter{stats: ClientStats{ConnectedSince: connectedSince}}
+}
+
+// hook returns the stream hook counting each message and error before it
+// is delivered.
+func (s *statsCounter) hook() streamHook {
+	return streamHook{
+		message: func(msg Message) (bool, error) {
+			s.recordMessage(msg)
+			return true, nil
+		},
+		error: func(error) { s.recordError() },
+	}
+}
+
+// recordMessage counts msg, its tool uses, and the turn it completes.
+func (s *statsCounter) recordMessage(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Messages++
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		for _, block := range m.Content {
+			if _, ok := block.(*ToolUseBlock); ok {
+				s.stats.ToolUses++
+			}
+		}
+	case *ResultMessage:
+		s.stats.TurnsCompleted++
+		if m.IsError {
+			s.stats.Errors++
+		}
+	}
+}
+
+// recordError counts an error from the error channel.
+func (s *statsCounter) recordError() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Errors++
+}
+
+// snapshot returns the counts so far.
+func (s *statsCounter) snapshot() ClientStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Stats returns cumulative counts for the current connection, or for the
+// most recent one after Disconnect. Counts start at zero on each Connect, and
+// a client that has never connected returns zero stats. Unlike
+// GetStreamStats, it needs no transport support and is cheap to call at any
+// time.
+func (c *ClientImpl) Stats() ClientStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stats == nil {
+		return ClientStats{}
+	}
+	return c.stats.snapshot()
+}
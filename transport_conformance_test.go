@@ -0,0 +1,57 @@
+package claudecode
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/severity1/claude-agent-sdk-go/claudecodetest"
+	"github.com/severity1/claude-agent-sdk-go/internal/subprocess"
+)
+
+// The built-in CLI transport implements the optional transport interfaces.
+var (
+	_ RawSender          = (*subprocess.Transport)(nil)
+	_ AllowedToolsSetter = (*subprocess.Transport)(nil)
+)
+
+// TestTransportConformance runs the exported Transport contract suite against
+// every transport implementation shipped with or used by the SDK.
+func TestTransportConformance(t *testing.T) {
+	t.Run("client_mock_transport", func(t *testing.T) {
+		claudecodetest.RunTransportConformance(t, func(_ *testing.T) claudecodetest.Transport {
+			return newClientMockTransport()
+		})
+	})
+
+	t.Run("query_mock_transport", func(t *testing.T) {
+		claudecodetest.RunTransportConformance(t, func(_ *testing.T) claudecodetest.Transport {
+			return newQueryMockTransport()
+		})
+	})
+
+	t.Run("subprocess_transport", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("conformance CLI script requires a POSIX shell")
+		}
+		cliPath := newConformanceCLI(t)
+		claudecodetest.RunTransportConformance(t, func(_ *testing.T) claudecodetest.Transport {
+			return subprocess.New(cliPath, NewOptions(), false, "sdk-go-client")
+		})
+	})
+}
+
+// newConformanceCLI writes a fake CLI that consumes stdin until it is closed.
+func newConformanceCLI(t *testing.T) string {
+	t.Helper()
+	script := `#!/bin/bash
+if [ "$1" = "-v" ]; then echo "3.0.0"; exit 0; fi
+while read -r _; do :; done
+`
+	path := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil { // #nosec G306 - Test script needs to be executable
+		t.Fatalf("Failed to write conformance CLI: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,127 @@
+package claudecode
+
+import (
+	"sync"
+
+	"github.com/severity1/claude-agent-sdk-go/internal/shared"
+)
+
+// turnQueue tracks a client's sent turns until their results arrive, in
+// send order. At each result it removes the turn's prompt file and passes
+// the result to onEnd, unless the SDK sent the turn itself.
+type turnQueue struct {
+	onStart func(string)         // OnTurnStart callback; may be nil
+	onEnd   func(*ResultMessage) // OnTurnEnd callback; may be nil
+
+	mu    sync.Mutex
+	turns []*queuedTurn
+
+	notifyMu sync.Mutex // Orders each turn's onStart before its onEnd
+}
+
+// queuedTurn is a sent turn awaiting its result.
+type queuedTurn struct {
+	promptFile string  // Large prompt file removed at the result, or ""
+	internal   bool    // Sent by the SDK, e.g. by Reset, so not reported to onEnd
+	prompt     *string // Reported to onStart once sent; nil for turns not reported
+	started    bool    // onStart was called; guarded by notifyMu
+}
+
+// hook returns the stream hook completing the oldest turn at each result.
+func (q *turnQueue) hook() streamHook {
+	return streamHook{
+		message: func(msg Message) (bool, error) {
+			if _, ok := msg.(*ResultMessage); !ok {
+				return true, nil
+			}
+			turn := q.pop()
+			removePromptFile(turn.promptFile)
+			if !turn.internal {
+				q.notifyMu.Lock()
+				// The result may be read before the send returns and calls start
+				q.startLocked(turn)
+				notifyTurnEnd(q.onEnd, msg)
+				q.notifyMu.Unlock()
+			}
+			return true, nil
+		},
+	}
+}
+
+// push queues a turn about to be sent and returns it for remove.
+func (q *turnQueue) push(turn queuedTurn) *queuedTurn {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued := &turn
+	q.turns = append(q.turns, queued)
+	return queued
+}
+
+// remove drops turn from the queue after its message failed to send.
+func (q *turnQueue) remove(turn *queuedTurn) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, queued := range q.turns {
+		if queued == turn {
+			q.turns = append(q.turns[:i], q.turns[i+1:]...)
+			return
+		}
+	}
+}
+
+// pop removes and returns the oldest turn, or a zero turn if none is queued.
+func (q *turnQueue) pop() *queuedTurn {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.turns) == 0 {
+		return &queuedTurn{}
+	}
+	turn := q.turns[0]
+	q.turns = q.turns[1:]
+	return turn
+}
+
+// start reports turn to onStart once its message is sent, unless its result
+// already did.
+func (q *turnQueue) start(turn *queuedTurn) {
+	q.notifyMu.Lock()
+	defer q.notifyMu.Unlock()
+	q.startLocked(turn)
+}
+
+// startLocked is start for callers holding q.notifyMu.
+func (q *turnQueue) startLocked(turn *queuedTurn) {
+	if turn.prompt == nil || turn.started {
+		return
+	}
+	turn.started = true
+	notifyTurnStart(q.onStart, *turn.prompt)
+}
+
+// removeAll drops every pending turn, removing their prompt files.
+func (q *turnQueue) removeAll() {
+	q.mu.Lock()
+	turns := q.turns
+	q.turns = nil
+	q.mu.Unlock()
+	for _, turn := range turns {
+		removePromptFile(turn.promptFile)
+	}
+}
+
+// notifyTurnStart passes prompt to onStart, if set.
+func notifyTurnStart(onStart func(string), prompt string) {
+	if onStart == nil {
+		return
+	}
+	shared.SafeCallback(func() { onStart(prompt) })
+}
+
+// notifyTurnEnd passes msg to onEnd if it is a result message ending a turn.
+func notifyTurnEnd(onEnd func(*ResultMessage), msg Message) {
+	result, ok := msg.(*ResultMessage)
+	if !ok || onEnd == nil {
+		return
+	}
+	shared.SafeCallback(func() { onEnd(result) })
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/severity1/claude-agent-sdk-go/internal/control"
+	"github.com/severity1/claude-agent-sdk-go/internal/parser"
 	"github.com/severity1/claude-agent-sdk-go/internal/shared"
 )
 
@@ -22,6 +23,9 @@ type AssistantMessage = shared.AssistantMessage
 // AssistantMessageError represents error types in assistant messages.
 type AssistantMessageError = shared.AssistantMessageError
 
+// ResultErrorType categorizes why a turn ended in an error result.
+type ResultErrorType = shared.ResultErrorType
+
 // SystemMessage represents a system prompt message.
 type SystemMessage = shared.SystemMessage
 
@@ -31,6 +35,9 @@ type ResultMessage = shared.ResultMessage
 // TextBlock represents a text content block.
 type TextBlock = shared.TextBlock
 
+// Citation references the source document and range supporting a piece of text.
+type Citation = shared.Citation
+
 // ThinkingBlock represents a thinking content block.
 type ThinkingBlock = shared.ThinkingBlock
 
@@ -40,6 +47,37 @@ type ToolUseBlock = shared.ToolUseBlock
 // ToolResultBlock represents a tool result content block.
 type ToolResultBlock = shared.ToolResultBlock
 
+// ServerToolUseBlock represents a server-side tool invocation such as web search.
+type ServerToolUseBlock = shared.ServerToolUseBlock
+
+// WebSearchResultBlock represents the results of a built-in web search.
+type WebSearchResultBlock = shared.WebSearchResultBlock
+
+// ServerToolResultBlock represents the result of a built-in server tool other than web search.
+type ServerToolResultBlock = shared.ServerToolResultBlock
+
+// WebSearchResult is a single page returned by the web search tool.
+type WebSearchResult = shared.WebSearchResult
+
+// ContentBlockParser parses the raw JSON object of a custom content block type.
+type ContentBlockParser = parser.ContentBlockParser
+
+// RegisterContentBlockParser teaches the SDK's parser a content block type it
+// does not know about, so blocks of that type parse into a custom ContentBlock
+// instead of being skipped. A nil parser removes the registration.
+//
+// Example:
+//
+//	type DiagramBlock struct{ Source string }
+//
+//	func (b *DiagramBlock) BlockType() string { return "diagram" }
+//
+//	claudecode.RegisterContentBlockParser("diagram", func(data map[string]any) (claudecode.ContentBlock, error) {
+//	    source, _ := data["source"].(string)
+//	    return &DiagramBlock{Source: source}, nil
+//	})
+var RegisterContentBlockParser = parser.RegisterContentBlockParser
+
 // StreamMessage represents a message in the streaming protocol.
 type StreamMessage = shared.StreamMessage
 
@@ -49,12 +87,165 @@ type MessageIterator = shared.MessageIterator
 // StreamValidator tracks tool requests and results to detect incomplete streams.
 type StreamValidator = shared.StreamValidator
 
+// NewStreamValidator creates a new stream validator for custom Transport implementations.
+var NewStreamValidator = shared.NewStreamValidator
+
 // StreamIssue represents a validation issue found in the stream.
 type StreamIssue = shared.StreamIssue
 
 // StreamStats provides statistics about the message stream.
 type StreamStats = shared.StreamStats
 
+// ToolInputAccumulator assembles tool_use inputs from partial stream events.
+type ToolInputAccumulator = shared.ToolInputAccumulator
+
+// PartialToolInput is a tool_use input assembled from input_json_delta stream events.
+type PartialToolInput = shared.PartialToolInput
+
+// NewToolInputAccumulator creates an empty accumulator.
+var NewToolInputAccumulator = shared.NewToolInputAccumulator
+
+// ParsedStreamEvent is a StreamEvent with its common event fields decoded.
+type ParsedStreamEvent = shared.ParsedStreamEvent
+
+// StreamDelta is the decoded delta of a content_block_delta event.
+type StreamDelta = shared.StreamDelta
+
+// StreamMessageStart describes the message begun by a message_start event.
+type StreamMessageStart = shared.StreamMessageStart
+
+// ParseStreamEvent decodes the common fields of a stream event.
+var ParseStreamEvent = shared.ParseStreamEvent
+
+// MessageHandler handles a parsed message on its way to the caller.
+type MessageHandler = shared.MessageHandler
+
+// MessageMiddleware wraps the next handler in a message pipeline.
+type MessageMiddleware = shared.MessageMiddleware
+
+// ChainMessageMiddleware returns a handler running middlewares in order around final.
+var ChainMessageMiddleware = shared.ChainMessageMiddleware
+
+// Usage holds token counts reported in a ResultMessage's usage field.
+type Usage = shared.Usage
+
+// CostTracker accumulates usage and cost from ResultMessages across turns.
+type CostTracker = shared.CostTracker
+
+// NewCostTracker creates an empty cost tracker.
+var NewCostTracker = shared.NewCostTracker
+
+// ToolMetrics aggregates per-tool invocations, outcomes, and durations.
+type ToolMetrics = shared.ToolMetrics
+
+// ToolStat holds aggregated usage of a single tool.
+type ToolStat = shared.ToolStat
+
+// NewToolMetrics creates an empty tool metrics collector.
+var NewToolMetrics = shared.NewToolMetrics
+
+// Response aggregates the text, tool uses, thinking, and result of one turn.
+type Response = shared.Response
+
+// ResponseCollector aggregates received messages into a Response per turn.
+type ResponseCollector = shared.ResponseCollector
+
+// NewResponseCollector creates an empty response collector.
+var NewResponseCollector = shared.NewResponseCollector
+
+// ToolInfo describes a tool available to Claude in the current session.
+type ToolInfo = shared.ToolInfo
+
+// NormalizeToolName returns the canonical form of a tool name: trimmed, and
+// for MCP tools lowercased with non-alphanumeric characters replaced by
+// underscores.
+var NormalizeToolName = shared.NormalizeToolName
+
+// ResourceUpdate reports that an MCP resource changed during a session.
+// Experimental; see WithOnResourceUpdate.
+type ResourceUpdate = shared.ResourceUpdate
+
+// ResourceUpdateFromSystemMessage returns the resource update carried by a
+// system message, if any.
+var ResourceUpdateFromSystemMessage = shared.ResourceUpdateFromSystemMessage
+
+// PreviewToolUse renders a tool_use block as a one-line description of what
+// the tool will do, such as "Read src/main.go" or "Bash: rm -rf build".
+var PreviewToolUse = shared.PreviewToolUse
+
+// UnifiedDiff returns a unified diff turning before into after, with three
+// lines of context, or an empty string if they are equal.
+var UnifiedDiff = shared.UnifiedDiff
+
+// SubprocessLimiter bounds live CLI subprocesses across Queries and Clients.
+type SubprocessLimiter = shared.SubprocessLimiter
+
+// NewSubprocessLimiter creates a limiter allowing max live subprocesses.
+var NewSubprocessLimiter = shared.NewSubprocessLimiter
+
+// SessionStore persists CLI session IDs for WithSessionStore.
+type SessionStore = shared.SessionStore
+
+// Tracer starts spans around turns and SDK MCP tool calls.
+type Tracer = shared.Tracer
+
+// Span is an operation started by a Tracer.
+type Span = shared.Span
+
+// Clock is the source of time for session deadlines, heartbeats, and timeouts.
+type Clock = shared.Clock
+
+// Timer is a single-use timer created by a Clock.
+type Timer = shared.Timer
+
+// Ticker is a repeating timer created by a Clock.
+type Ticker = shared.Ticker
+
+// SystemClock returns the Clock backed by the time package.
+var SystemClock = shared.SystemClock
+
+// UsageFromMap extracts token counts from a raw ResultMessage usage map.
+var UsageFromMap = shared.UsageFromMap
+
+// MessagesEqual reports whether two messages are the same type with deeply equal content.
+var MessagesEqual = shared.MessagesEqual
+
+// MessageQueryID returns the query ID attached to a message by
+// Client.QueryWithID, or "" if none.
+var MessageQueryID = shared.MessageQueryID
+
+// TextOf returns the concatenated text of the TextBlocks in a content block slice.
+var TextOf = shared.TextOf
+
+// DiffMessages returns a readable, line-per-difference diff of an expected and
+// actual message, or "" if they are equal. Useful in test failure output.
+var DiffMessages = shared.DiffMessages
+
+// StrictJSONSchema returns a copy of a JSON schema with additionalProperties: false
+// at every object level.
+var StrictJSONSchema = shared.StrictJSONSchema
+
+// JSONSchemaFromType generates a JSON schema from a Go type using its json,
+// enum, and description struct tags.
+var JSONSchemaFromType = shared.JSONSchemaFromType
+
+// ValidateStrictOutput reports fields in structured output that a schema does not allow.
+var ValidateStrictOutput = shared.ValidateStrictOutput
+
+// SchemaBuilder builds a JSON schema fluently for WithJSONSchema.
+type SchemaBuilder = shared.SchemaBuilder
+
+// Schema builder constructors, e.g.
+// SchemaObject().Property("name", SchemaString().Desc("Full name")).Required("name").Build().
+var (
+	SchemaObject  = shared.SchemaObject
+	SchemaString  = shared.SchemaString
+	SchemaInteger = shared.SchemaInteger
+	SchemaNumber  = shared.SchemaNumber
+	SchemaBoolean = shared.SchemaBoolean
+	SchemaArray   = shared.SchemaArray
+)
+
 // Re-export message type constants
 const (
 	MessageTypeUser      = shared.MessageTypeUser
@@ -70,12 +261,36 @@ const (
 	MessageTypeStreamEvent = shared.MessageTypeStreamEvent
 )
 
+// Re-export system message subtype and MCP server status constants
+const (
+	SystemSubtypeInit            = shared.SystemSubtypeInit
+	SystemSubtypeResourceUpdated = shared.SystemSubtypeResourceUpdated
+	McpServerStatusPending       = shared.McpServerStatusPending
+)
+
+// Re-export span name constants passed to Tracer.StartSpan
+const (
+	SpanNameTurn     = shared.SpanNameTurn
+	SpanNameToolCall = shared.SpanNameToolCall
+)
+
 // Re-export content block type constants
 const (
-	ContentBlockTypeText       = shared.ContentBlockTypeText
-	ContentBlockTypeThinking   = shared.ContentBlockTypeThinking
-	ContentBlockTypeToolUse    = shared.ContentBlockTypeToolUse
-	ContentBlockTypeToolResult = shared.ContentBlockTypeToolResult
+	ContentBlockTypeText                = shared.ContentBlockTypeText
+	ContentBlockTypeThinking            = shared.ContentBlockTypeThinking
+	ContentBlockTypeToolUse             = shared.ContentBlockTypeToolUse
+	ContentBlockTypeToolResult          = shared.ContentBlockTypeToolResult
+	ContentBlockTypeServerToolUse       = shared.ContentBlockTypeServerToolUse
+	ContentBlockTypeWebSearchToolResult = shared.ContentBlockTypeWebSearchToolResult
+)
+
+// Re-export citation type constants
+const (
+	CitationTypeCharLocation            = shared.CitationTypeCharLocation
+	CitationTypePageLocation            = shared.CitationTypePageLocation
+	CitationTypeContentBlockLocation    = shared.CitationTypeContentBlockLocation
+	CitationTypeWebSearchResultLocation = shared.CitationTypeWebSearchResultLocation
+	CitationTypeSearchResultLocation    = shared.CitationTypeSearchResultLocation
 )
 
 // Re-export stream event type constants for Event["type"] discrimination.
@@ -86,6 +301,12 @@ const (
 	StreamEventTypeMessageStart      = shared.StreamEventTypeMessageStart
 	StreamEventTypeMessageDelta      = shared.StreamEventTypeMessageDelta
 	StreamEventTypeMessageStop       = shared.StreamEventTypeMessageStop
+
+	// Delta types carried by content_block_delta events.
+	StreamDeltaTypeText      = shared.StreamDeltaTypeText
+	StreamDeltaTypeInputJSON = shared.StreamDeltaTypeInputJSON
+	StreamDeltaTypeThinking  = shared.StreamDeltaTypeThinking
+	StreamDeltaTypeSignature = shared.StreamDeltaTypeSignature
 )
 
 // Re-export AssistantMessageError constants
@@ -98,6 +319,21 @@ const (
 	AssistantMessageErrorUnknown        = shared.AssistantMessageErrorUnknown
 )
 
+// Re-export ResultErrorType constants
+const (
+	ResultErrorRateLimit        = shared.ResultErrorRateLimit
+	ResultErrorInvalidRequest   = shared.ResultErrorInvalidRequest
+	ResultErrorAuthFailed       = shared.ResultErrorAuthFailed
+	ResultErrorBilling          = shared.ResultErrorBilling
+	ResultErrorOverloaded       = shared.ResultErrorOverloaded
+	ResultErrorServer           = shared.ResultErrorServer
+	ResultErrorMaxTurns         = shared.ResultErrorMaxTurns
+	ResultErrorMaxBudget        = shared.ResultErrorMaxBudget
+	ResultErrorStructuredOutput = shared.ResultErrorStructuredOutput
+	ResultErrorExecution        = shared.ResultErrorExecution
+	ResultErrorUnknown          = shared.ResultErrorUnknown
+)
+
 // AgentModel represents the model to use for an agent.
 type AgentModel = shared.AgentModel
 
@@ -114,6 +350,14 @@ const (
 
 // Transport abstracts the communication layer with Claude Code CLI.
 // This interface stays in main package because it's used by client code.
+//
+// Frames are newline-delimited JSON objects. Outgoing frames are written with
+// SendMessage; incoming frames are parsed and delivered on the channels
+// returned by ReceiveMessages. Alternative transports (sockets, test
+// harnesses) must satisfy the same contract as the subprocess transport:
+// operations before Connect or after Close fail, cancelled contexts are
+// honored, and Close is idempotent.
+// claudecodetest.RunTransportConformance checks this contract.
 type Transport interface {
 	Connect(ctx context.Context) error
 	SendMessage(ctx context.Context, message StreamMessage) error
@@ -130,6 +374,24 @@ type Transport interface {
 	GetValidator() *StreamValidator
 }
 
+// RawSender is implemented by transports that can also write pre-serialized
+// protocol frames. The built-in CLI transport implements it; other transports
+// may, and RunTransportConformance checks SendRaw when they do.
+type RawSender interface {
+	// SendRaw writes a single pre-serialized protocol frame.
+	// The frame must be one JSON value; a trailing newline is optional.
+	SendRaw(ctx context.Context, frame []byte) error
+}
+
+// AllowedToolsSetter is implemented by transports that can restrict the
+// tools approved mid-session, as Client.SetAllowedTools requires. The
+// built-in CLI transport implements it.
+type AllowedToolsSetter interface {
+	// SetAllowedTools restricts the tools the SDK approves for the rest of the
+	// session. Nil removes the restriction.
+	SetAllowedTools(ctx context.Context, tools []string) error
+}
+
 // RawControlMessage wraps raw control protocol messages for passthrough.
 type RawControlMessage = shared.RawControlMessage
 
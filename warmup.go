@@ -0,0 +1,27 @@
+package claudecode
+
+import "context"
+
+// initializingTransport is implemented by transports that can complete the
+// CLI's initialize handshake on demand.
+type initializingTransport interface {
+	Initialize(ctx context.Context) error
+}
+
+// warmup completes the CLI's initialize handshake, so the subprocess is
+// started and answering control requests before Connect returns. No user
+// message is sent, so the conversation and turn callbacks are untouched.
+// Transports without a handshake are left as they are.
+func (c *ClientImpl) warmup(ctx context.Context) error {
+	c.mu.RLock()
+	transport := c.transport
+	c.mu.RUnlock()
+	if transport == nil {
+		return c.notConnectedError()
+	}
+
+	if it, ok := transport.(initializingTransport); ok {
+		return it.Initialize(ctx)
+	}
+	return nil
+}